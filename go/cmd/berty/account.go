@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+
+	"berty.tech/berty/v2/go/internal/accountfsck"
+	account_svc "berty.tech/berty/v2/go/pkg/bertyaccount"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func accountRebuildDBCommand() *ffcli.Command {
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty account rebuild-db", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		manager.SetupLoggingFlags(fs) // also available at root level
+		manager.SetupDatastoreFlags(fs)
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "rebuild-db",
+		ShortUsage:     "berty [global flags] account rebuild-db [flags] <account-id>",
+		ShortHelp:      "rebuild the messenger db of a closed account of account-daemon from its group logs",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+
+			logger, err := manager.GetLogger()
+			if err != nil {
+				return err
+			}
+
+			svc, err := account_svc.NewService(&account_svc.Options{
+				Logger:              logger,
+				AppRootDirectory:    manager.Datastore.AppDir,
+				SharedRootDirectory: manager.Datastore.SharedDir,
+			})
+			if err != nil {
+				return err
+			}
+			defer svc.Close()
+
+			rebuilder, ok := svc.(account_svc.MessengerDBRebuilder)
+			if !ok {
+				return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the account service cannot rebuild the messenger db"))
+			}
+
+			return rebuilder.RebuildMessengerDB(ctx, args[0], func(step string) {
+				fmt.Println(step)
+			})
+		},
+	}
+}
+
+func accountFsckCommand() *ffcli.Command {
+	var jsonFlag bool
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty account fsck", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		fs.BoolVar(&jsonFlag, "json", false, "print the report as JSON, for the scripts")
+		manager.SetupLoggingFlags(fs) // also available at root level
+		manager.SetupDatastoreFlags(fs)
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "fsck",
+		ShortUsage:     "berty [global flags] account fsck [flags] <account-id>",
+		ShortHelp:      "check the integrity of the data of an account of account-daemon, it fails if a check fails",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+
+			logger, err := manager.GetLogger()
+			if err != nil {
+				return err
+			}
+
+			svc, err := account_svc.NewService(&account_svc.Options{
+				Logger:              logger,
+				AppRootDirectory:    manager.Datastore.AppDir,
+				SharedRootDirectory: manager.Datastore.SharedDir,
+			})
+			if err != nil {
+				return err
+			}
+			defer svc.Close()
+
+			checker, ok := svc.(account_svc.AccountChecker)
+			if !ok {
+				return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the account service cannot check the accounts"))
+			}
+
+			report, err := checker.CheckAccount(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			if jsonFlag {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				printFsckReport(report)
+			}
+
+			if report.Status == accountfsck.StatusError {
+				return fmt.Errorf("the account %s failed its checks", report.AccountID)
+			}
+			return nil
+		},
+	}
+}
+
+func printFsckReport(report *accountfsck.Report) {
+	fmt.Printf("account %s in %s\n", report.AccountID, report.Dir)
+	for _, check := range report.Checks {
+		fmt.Printf("  %-8s %-15s %s\n", check.Status, check.Name, check.Detail)
+	}
+
+	namespaces := make([]string, 0, len(report.DatastoreKeys))
+	for namespace := range report.DatastoreKeys {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		fmt.Printf("  %8d keys in %s\n", report.DatastoreKeys[namespace], namespace)
+	}
+
+	for _, file := range report.OrphanFiles {
+		fmt.Printf("  orphan %s\n", file)
+	}
+
+	fmt.Printf("status: %s\n", report.Status)
+}
+
+func accountCommand() *ffcli.Command {
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty account [command]", flag.ExitOnError)
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "account",
+		ShortUsage:     "berty account [command]",
+		ShortHelp:      "manage the accounts of account-daemon",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			return flag.ErrHelp
+		},
+		Subcommands: []*ffcli.Command{
+			accountRebuildDBCommand(),
+			accountFsckCommand(),
+		},
+	}
+}
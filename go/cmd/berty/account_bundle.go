@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+
+	account_svc "berty.tech/berty/v2/go/pkg/bertyaccount"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func accountBundleCommand() *ffcli.Command {
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty account-bundle", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		manager.SetupLoggingFlags(fs) // also available at root level
+		manager.SetupDatastoreFlags(fs)
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "account-bundle",
+		ShortUsage:     "berty [global flags] account-bundle [flags] <bundle|unbundle> <account-id>",
+		ShortHelp:      "convert a closed account of account-daemon between directories and a single bundle file",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return flag.ErrHelp
+			}
+
+			logger, err := manager.GetLogger()
+			if err != nil {
+				return err
+			}
+
+			svc, err := account_svc.NewService(&account_svc.Options{
+				Logger:              logger,
+				AppRootDirectory:    manager.Datastore.AppDir,
+				SharedRootDirectory: manager.Datastore.SharedDir,
+			})
+			if err != nil {
+				return err
+			}
+			defer svc.Close()
+
+			bundler, ok := svc.(account_svc.AccountBundler)
+			if !ok {
+				return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the account service cannot bundle accounts"))
+			}
+
+			switch args[0] {
+			case "bundle":
+				return bundler.BundleAccount(ctx, args[1])
+			case "unbundle":
+				return bundler.UnbundleAccount(ctx, args[1])
+			default:
+				return flag.ErrHelp
+			}
+		},
+	}
+}
@@ -3,16 +3,26 @@ package main
 import (
 	"context"
 	"flag"
+	"time"
 
 	"github.com/oklog/run"
 	"github.com/peterbourgon/ff/v3/ffcli"
 
+	"berty.tech/berty/v2/go/internal/accounthealth"
+	"berty.tech/berty/v2/go/internal/accountsession"
 	"berty.tech/berty/v2/go/internal/grpcserver"
+	"berty.tech/berty/v2/go/internal/versionrpc"
 	"berty.tech/berty/v2/go/pkg/accounttypes"
 	account_svc "berty.tech/berty/v2/go/pkg/bertyaccount"
 )
 
 func accountDaemonCommand() *ffcli.Command {
+	var (
+		bundleNewAccounts     bool
+		deleteRevokedAccounts bool
+		sessionLeaseTTL       time.Duration
+	)
+
 	fsBuilder := func() (*flag.FlagSet, error) {
 		fs := flag.NewFlagSet("berty account-daemon", flag.ExitOnError)
 
@@ -20,6 +30,9 @@ func accountDaemonCommand() *ffcli.Command {
 		manager.SetupDefaultGRPCListenersFlags(fs)
 		manager.SetupDefaultGRPCAccountListenersFlags(fs)
 		manager.SetupDatastoreFlags(fs)
+		fs.BoolVar(&bundleNewAccounts, "account.bundle-new", false, "store the created accounts as a single encrypted bundle file, see account-bundle")
+		fs.BoolVar(&deleteRevokedAccounts, "account.delete-revoked", false, "delete the account data when another device of the account revokes this one, the user is only notified otherwise")
+		fs.DurationVar(&sessionLeaseTTL, "account.lease-ttl", accountsession.DefaultLeaseTTL, "validity of the leases on the accounts opened by the session service, the account is closed if its lease is not renewed")
 
 		return fs, nil
 	}
@@ -65,6 +78,10 @@ func accountDaemonCommand() *ffcli.Command {
 				Logger:              logger,
 				AppRootDirectory:    manager.Datastore.AppDir,
 				SharedRootDirectory: manager.Datastore.SharedDir,
+				BundleNewAccounts:   bundleNewAccounts,
+				SessionLeaseTTL:     sessionLeaseTTL,
+
+				DeleteRevokedAccounts: deleteRevokedAccounts,
 			})
 			if err != nil {
 				return err
@@ -72,6 +89,9 @@ func accountDaemonCommand() *ffcli.Command {
 
 			// register grpc service
 			accounttypes.RegisterAccountServiceServer(server, serviceAccount)
+			accountsession.Register(server, serviceAccount.Sessions())
+			accounthealth.Register(server, serviceAccount)
+			versionrpc.Register(server)
 			if err := accounttypes.RegisterAccountServiceHandlerServer(ctx, serverMux, serviceAccount); err != nil {
 				return err
 			}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+
+	"berty.tech/berty/v2/go/internal/addressbook"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func addressBookCommand() *ffcli.Command {
+	var format string
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty address-book", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		fs.StringVar(&format, "format", "", "export format, json or vcard, guessed from the file extension if empty")
+		manager.SetupLoggingFlags(fs)              // also available at root level
+		manager.SetupLocalMessengerServerFlags(fs) // by default, start a new local messenger server,
+		manager.SetupRemoteNodeFlags(fs)           // but allow to set a remote server instead
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "address-book",
+		ShortUsage:     "berty [global flags] address-book [flags] <export|import> <path>",
+		ShortHelp:      "export the contacts and conversations to a JSON or vCard file, or import a JSON one",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return flag.ErrHelp
+			}
+
+			if format == "" {
+				format = "json"
+				if ext := strings.ToLower(filepath.Ext(args[1])); ext == ".vcf" || ext == ".vcard" {
+					format = "vcard"
+				}
+			}
+			if format != "json" && format != "vcard" {
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown format %q", format))
+			}
+
+			switch args[0] {
+			case "export":
+				manager.DisableIPFSNetwork()
+			case "import":
+				if format != "json" {
+					return errcode.ErrInvalidInput.Wrap(fmt.Errorf("only JSON address books can be imported"))
+				}
+			default:
+				return flag.ErrHelp
+			}
+
+			messenger, err := manager.GetMessengerClient()
+			if err != nil {
+				return err
+			}
+
+			if args[0] == "import" {
+				return importAddressBook(ctx, messenger, args[1])
+			}
+			return exportAddressBook(ctx, messenger, args[1], format)
+		},
+	}
+}
+
+func exportAddressBook(ctx context.Context, messenger messengertypes.MessengerServiceClient, path, format string) error {
+	ret, err := messenger.AddressBookExport(ctx, &messengertypes.AddressBookExport_Request{})
+	if err != nil {
+		return err
+	}
+	book := addressbook.FromProto(ret.GetBook())
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if format == "vcard" {
+		err = addressbook.WriteVCard(f, book)
+	} else {
+		err = addressbook.WriteJSON(f, book)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("exported %d contact(s) and %d conversation(s) to %s\n", len(book.Contacts), len(book.Conversations), path)
+	return nil
+}
+
+func importAddressBook(ctx context.Context, messenger messengertypes.MessengerServiceClient, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	book, err := addressbook.ReadJSON(f)
+	if err != nil {
+		return err
+	}
+
+	report, err := messenger.AddressBookImport(ctx, &messengertypes.AddressBookImport_Request{Book: book.ToProto()})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d contact request(s) sent, %d conversation(s) joined, %d skipped, %d failed\n",
+		report.ContactsRequested, report.ConversationsJoined, report.Skipped, len(report.Failed))
+	for _, failure := range report.Failed {
+		fmt.Printf("  %s: %s\n", failure.PublicKey, failure.Error)
+	}
+
+	return nil
+}
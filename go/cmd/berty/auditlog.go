@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+
+	"berty.tech/berty/v2/go/internal/auditlog"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func auditLogCommand() *ffcli.Command {
+	var (
+		filter     auditlog.Filter
+		since      time.Duration
+		format     string
+		outputPath string
+		verify     bool
+	)
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty audit-log", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		manager.SetupLoggingFlags(fs) // also available at root level
+		manager.SetupDatastoreFlags(fs)
+		fs.StringVar(&filter.Event, "event", "", "only list this kind of event, e.g. contact_accepted")
+		fs.DurationVar(&since, "since", 0, "only list the events of this last period, e.g. 72h")
+		fs.IntVar(&filter.Limit, "limit", 0, "only list the last events")
+		fs.StringVar(&format, "format", "text", "output format, text or json")
+		fs.StringVar(&outputPath, "output", "", "write the events to this path instead of stdout")
+		fs.BoolVar(&verify, "verify", false, "check that no event was modified or removed before listing them")
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "audit-log",
+		ShortUsage:     "berty [global flags] audit-log [flags]",
+		ShortHelp:      "list or export the security-relevant events recorded by the account",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				return flag.ErrHelp
+			}
+
+			if format != "text" && format != "json" {
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown format %q", format))
+			}
+
+			if since > 0 {
+				filter.Since = time.Now().Add(-since)
+			}
+
+			rootDS, err := manager.GetRootDatastore()
+			if err != nil {
+				return err
+			}
+
+			if verify {
+				if err := auditlog.Verify(ctx, rootDS); err != nil {
+					return err
+				}
+			}
+
+			entries, err := auditlog.List(ctx, rootDS, filter)
+			if err != nil {
+				return err
+			}
+
+			var w io.Writer = os.Stdout
+			if outputPath != "" {
+				f, err := os.Create(outputPath)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+
+			if format == "json" {
+				return auditlog.WriteJSON(w, entries)
+			}
+			return auditlog.WriteText(w, entries)
+		},
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+
+	"berty.tech/berty/v2/go/internal/cloudbackup"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func cloudBackupCommand() *ffcli.Command {
+	var config cloudbackup.Config
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty cloud-backup", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		fs.StringVar(&config.URL, "url", "", "WebDAV collection holding the snapshots, as in -node.cloud-backup-url")
+		fs.StringVar(&config.Username, "username", "", "user of the WebDAV collection")
+		fs.StringVar(&config.Password, "password", "", "password of the WebDAV collection")
+		fs.StringVar(&config.Passphrase, "passphrase", "", "passphrase of the snapshots, only required to restore them")
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "cloud-backup",
+		ShortUsage:     "berty [global flags] cloud-backup [flags] <list|restore <snapshot-id> <export-path>>",
+		ShortHelp:      "list the encrypted snapshots of an account on a WebDAV server, or restore one as an export for -node.restore-export-path",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return flag.ErrHelp
+			}
+
+			target, err := config.Target()
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case args[0] == "list" && len(args) == 1:
+				snapshots, err := cloudbackup.List(ctx, target)
+				if err != nil {
+					return err
+				}
+
+				for _, snapshot := range snapshots {
+					fmt.Printf("%s\t%s\t%d bytes\n", snapshot.ID, snapshot.CreatedAt.Local().Format("2006-01-02 15:04:05"), snapshot.Size)
+				}
+				return nil
+
+			case args[0] == "restore" && len(args) == 3:
+				if config.Passphrase == "" {
+					return errcode.ErrMissingInput.Wrap(fmt.Errorf("the -passphrase of the snapshots is required"))
+				}
+
+				f, err := os.OpenFile(args[2], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+				if err != nil {
+					return err
+				}
+
+				_, err = cloudbackup.Restore(ctx, target, config.Passphrase, args[1], f)
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					os.Remove(args[2])
+					return err
+				}
+
+				fmt.Printf("snapshot %s restored to %s\n", args[1], args[2])
+				return nil
+
+			default:
+				return flag.ErrHelp
+			}
+		},
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"berty.tech/berty/v2/go/internal/configloader"
+	"berty.tech/berty/v2/go/internal/configreload"
+	"berty.tech/berty/v2/go/internal/initutil"
+)
+
+func configCommand() *ffcli.Command {
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty config [command]", flag.ExitOnError)
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "config",
+		ShortUsage:     "berty config [command]",
+		ShortHelp:      "inspect or reload the configuration of the daemon",
+		LongHelp:       "The settings are read, by order of precedence, from the command line flags, the BERTY_ environment variables\nand the config file given by -config, in the plain, YAML or TOML format.",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			return flag.ErrHelp
+		},
+		Subcommands: []*ffcli.Command{
+			configPrintEffectiveCommand(),
+			configReloadCommand(),
+		},
+	}
+}
+
+func configPrintEffectiveCommand() *ffcli.Command {
+	newFlagSet := func() *flag.FlagSet {
+		fs := newDaemonFlagSet(&initutil.Manager{}, &daemonFlags{})
+		fs.Init("berty config print-effective", flag.ContinueOnError)
+		return fs
+	}
+
+	return &ffcli.Command{
+		Name:       "print-effective",
+		ShortUsage: "berty config print-effective [daemon flags]",
+		ShortHelp:  "print the settings the daemon would run with, and where each one comes from",
+		// the flags are validated as the daemon does
+		FlagSetBuilder: func() (*flag.FlagSet, error) { return newFlagSet(), nil },
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				return flag.ErrHelp
+			}
+
+			// ffcli does not keep the command line, the sources are found by
+			// parsing it again
+			daemonArgs := []string{}
+			for i, arg := range os.Args {
+				if arg == "print-effective" {
+					daemonArgs = os.Args[i+1:]
+					break
+				}
+			}
+
+			fs := newFlagSet()
+			settings, err := configloader.Effective(fs, daemonArgs, configloader.EnvPrefix)
+			if err != nil {
+				return err
+			}
+
+			width := len("NAME")
+			for _, s := range settings {
+				if len(s.Name) > width {
+					width = len(s.Name)
+				}
+			}
+
+			fmt.Printf("%-*s  %-7s  %s\n", width, "NAME", "SOURCE", "VALUE")
+			for _, s := range settings {
+				fmt.Printf("%-*s  %-7s  %s\n", width, s.Name, s.Source, s.Value)
+			}
+
+			for _, name := range configloader.UnknownEnv(fs, configloader.EnvPrefix) {
+				fmt.Fprintf(os.Stderr, "warning: %s does not match any setting of the daemon\n", name)
+			}
+
+			return nil
+		},
+	}
+}
+
+func configReloadCommand() *ffcli.Command {
+	var remoteAddr string
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty config reload", flag.ExitOnError)
+		fs.StringVar(&remoteAddr, "remote", "127.0.0.1:9091", "gRPC address of the running daemon")
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "reload",
+		ShortUsage:     "berty config reload [flags]",
+		ShortHelp:      "reload the configuration of a running daemon, as SIGHUP does, and print the settings which need a restart",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				return flag.ErrHelp
+			}
+
+			cc, err := grpc.Dial(remoteAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				return err
+			}
+			defer cc.Close()
+
+			report, err := configreload.Reload(ctx, cc)
+			if err != nil {
+				return err
+			}
+
+			for _, change := range report.Applied {
+				fmt.Printf("applied           %s\n", change)
+			}
+			for _, change := range report.RestartRequired {
+				if change.Error != "" {
+					fmt.Printf("restart required  %s (%s)\n", change, change.Error)
+				} else {
+					fmt.Printf("restart required  %s\n", change)
+				}
+			}
+			for _, change := range report.Failed {
+				fmt.Printf("failed            %s: %s\n", change, change.Error)
+			}
+			if len(report.Applied)+len(report.RestartRequired)+len(report.Failed) == 0 {
+				fmt.Println("no setting changed")
+			}
+
+			return nil
+		},
+	}
+}
@@ -5,12 +5,17 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/mdp/qrterminal/v3"
 	"github.com/peterbourgon/ff/v3/ffcli"
+	"go.uber.org/zap"
 
+	"berty.tech/berty/v2/go/internal/initutil"
 	"berty.tech/berty/v2/go/pkg/banner"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
@@ -18,27 +23,41 @@ import (
 	"berty.tech/weshnet/pkg/protocoltypes"
 )
 
+type daemonFlags struct {
+	noQR         bool
+	noBanner     bool
+	noSystemInfo bool
+	passphrase   string
+	tenants      string
+}
+
+func newDaemonFlagSet(m *initutil.Manager, flags *daemonFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet("berty daemon", flag.ExitOnError)
+	fs.String("config", "", "config file (optional) in the plain, YAML or TOML format, reloaded on SIGHUP")
+	m.Session.Kind = "cli.daemon"
+	m.SetupLoggingFlags(fs)              // also available at root level
+	m.SetupLocalMessengerServerFlags(fs) // we want to configure a local messenger server
+	m.SetupDefaultGRPCListenersFlags(fs)
+	m.SetupMetricsFlags(fs)
+	m.SetupDebugFlags(fs)
+	m.SetupMatrixBridgeFlags(fs)
+	m.SetupInitTimeout(fs)
+	fs.StringVar(&flags.passphrase, "passphrase", flags.passphrase, "optional sharing-link encryption passphrase")
+	fs.BoolVar(&flags.noQR, "no-qr", flags.noQR, "do not print the QR code in terminal on startup")
+	fs.BoolVar(&flags.noBanner, "no-banner", flags.noQR, "do not print the Berty banner on startup")
+	fs.BoolVar(&flags.noSystemInfo, "no-system-info", flags.noQR, "do not print system info on startup")
+	fs.StringVar(&flags.tenants, "tenants", flags.tenants, "comma-separated list of account IDs to serve concurrently, calls are routed using the `berty-account-id` gRPC metadata")
+	return fs
+}
+
 func daemonCommand() *ffcli.Command {
 	var (
-		noQRFlag         = false
-		noBannerFlag     = false
-		noSystemInfoFlag = false
-		passphraseFlag   = ""
+		flags    daemonFlags
+		daemonFS *flag.FlagSet
 	)
 	fsBuilder := func() (*flag.FlagSet, error) {
-		fs := flag.NewFlagSet("berty daemon", flag.ExitOnError)
-		fs.String("config", "", "config file (optional)")
-		manager.Session.Kind = "cli.daemon"
-		manager.SetupLoggingFlags(fs)              // also available at root level
-		manager.SetupLocalMessengerServerFlags(fs) // we want to configure a local messenger server
-		manager.SetupDefaultGRPCListenersFlags(fs)
-		manager.SetupMetricsFlags(fs)
-		manager.SetupInitTimeout(fs)
-		fs.StringVar(&passphraseFlag, "passphrase", passphraseFlag, "optional sharing-link encryption passphrase")
-		fs.BoolVar(&noQRFlag, "no-qr", noQRFlag, "do not print the QR code in terminal on startup")
-		fs.BoolVar(&noBannerFlag, "no-banner", noQRFlag, "do not print the Berty banner on startup")
-		fs.BoolVar(&noSystemInfoFlag, "no-system-info", noQRFlag, "do not print system info on startup")
-		return fs, nil
+		daemonFS = newDaemonFlagSet(manager, &flags)
+		return daemonFS, nil
 	}
 
 	return &ffcli.Command{
@@ -53,11 +72,21 @@ func daemonCommand() *ffcli.Command {
 				return flag.ErrHelp
 			}
 
+			if flags.tenants != "" {
+				return runMultiTenantDaemon(ctx, strings.Split(flags.tenants, ","))
+			}
+
 			logger, err := manager.GetLogger()
 			if err != nil {
 				return err
 			}
 
+			expiresAt := manager.EphemeralExpiry()
+			if !expiresAt.IsZero() {
+				logger.Named("main").Warn("ephemeral account, nothing is saved", zap.Time("expires-at", expiresAt))
+				printEphemeralWarning(expiresAt)
+			}
+
 			// since this command is daemon, we want to be sure to run a local daemon with protocol and messenger
 			{
 				_, err := manager.GetLocalProtocolServer()
@@ -83,23 +112,35 @@ func daemonCommand() *ffcli.Command {
 				logger.Named("main").Info("daemon initialized", logutil.PrivateString("peer-id", info.PeerID), logutil.PrivateStrings("listeners", info.Listeners))
 			}
 
+			// reload the configuration on SIGHUP
+			{
+				err := manager.SetupConfigReload(daemonFS, func(m *initutil.Manager) *flag.FlagSet {
+					return newDaemonFlagSet(m, &daemonFlags{})
+				}, os.Args[1:], ffSubcommandOptions())
+				if err != nil {
+					return err
+				}
+
+				go handleReloadSignal(ctx, logger.Named("reload"))
+			}
+
 			// display startup info
 			var printLock sync.Mutex
-			if !noBannerFlag {
+			if !flags.noBanner {
 				time.AfterFunc(time.Second, func() {
 					printLock.Lock()
 					fmt.Fprintln(os.Stderr, banner.OfTheDay())
 					printLock.Unlock()
 				})
 			}
-			if !noQRFlag {
+			if !flags.noQR {
 				messenger, err := manager.GetMessengerClient()
 				if err != nil {
 					return errcode.TODO.Wrap(err)
 				}
 				ret, err := messenger.InstanceShareableBertyID(ctx, &messengertypes.InstanceShareableBertyID_Request{
 					DisplayName: manager.Node.Messenger.DisplayName,
-					Passphrase:  []byte(passphraseFlag),
+					Passphrase:  []byte(flags.passphrase),
 				})
 				if err != nil {
 					return errcode.TODO.Wrap(err)
@@ -112,7 +153,7 @@ func daemonCommand() *ffcli.Command {
 					printLock.Unlock()
 				})
 			}
-			if !noSystemInfoFlag {
+			if !flags.noSystemInfo {
 				messenger, err := manager.GetMessengerClient()
 				if err != nil {
 					return errcode.TODO.Wrap(err)
@@ -132,7 +173,36 @@ func daemonCommand() *ffcli.Command {
 				})
 			}
 
-			return manager.RunWorkers(ctx)
+			err = manager.RunWorkers(ctx)
+			if ephemeralExpired(expiresAt) {
+				fmt.Fprintln(os.Stderr, "the ephemeral account expired, it was discarded")
+				return nil
+			}
+			return err
 		},
 	}
 }
+
+// handleReloadSignal reloads the configuration on SIGHUP until ctx is done.
+func handleReloadSignal(ctx context.Context, logger *zap.Logger) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			report, err := manager.ReloadConfig()
+			if err != nil {
+				logger.Error("unable to reload the configuration", zap.Error(err))
+				continue
+			}
+
+			for _, change := range report.RestartRequired {
+				fmt.Fprintf(os.Stderr, "restart required to apply %s\n", change)
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/oklog/run"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/internal/grpcserver"
+	"berty.tech/berty/v2/go/internal/initutil"
+	"berty.tech/berty/v2/go/internal/multitenant"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/logutil"
+)
+
+// runMultiTenantDaemon opens every given account with its own node and
+// serves all of them on the daemon listeners, each call being routed to the
+// account named in its metadata.
+func runMultiTenantDaemon(ctx context.Context, accountIDs []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	logger, err := manager.GetLogger()
+	if err != nil {
+		return err
+	}
+
+	appDir, err := manager.GetAppDataDir()
+	if err != nil {
+		return err
+	}
+
+	sharedDir, err := manager.GetSharedDataDir()
+	if err != nil {
+		return err
+	}
+
+	var workers run.Group
+	router := multitenant.NewRouter(logger.Named("tenants"))
+	if _, _, _, err := grpcserver.InitGRPCServer(&workers, &grpcserver.GRPCOpts{
+		Logger:                   logger,
+		AuthPublicKey:            manager.Node.Protocol.AuthPublicKey,
+		AuthSecret:               manager.Node.Protocol.AuthSecret,
+		Listeners:                manager.Node.GRPC.Listeners,
+		KeepExistingGlobalLogger: true,
+		ServerOptions:            router.ServerOptions(),
+	}); err != nil {
+		return err
+	}
+
+	var tenants []*initutil.Manager
+	defer func() {
+		for _, tenant := range tenants {
+			tenant.Close(nil)
+		}
+	}()
+
+	for _, accountID := range accountIDs {
+		accountID = strings.TrimSpace(accountID)
+		if accountID == "" {
+			continue
+		}
+
+		tenant, err := openTenant(logger, accountID, appDir, sharedDir)
+		if err != nil {
+			return err
+		}
+		tenants = append(tenants, tenant)
+
+		if _, err := tenant.GetLocalMessengerServer(); err != nil {
+			return errcode.ErrBertyAccountOpenAccount.Wrap(err)
+		}
+
+		cc, err := tenant.GetGRPCClientConn()
+		if err != nil {
+			return errcode.ErrBertyAccountGRPCClient.Wrap(err)
+		}
+
+		router.Register(accountID, cc)
+		workers.Add(func() error {
+			return tenant.RunWorkers(ctx)
+		}, func(error) {
+			router.Unregister(accountID)
+			cancel()
+		})
+	}
+
+	if len(router.AccountIDs()) == 0 {
+		return errcode.ErrBertyAccountNoIDSpecified
+	}
+
+	logger.Named("main").Info("multi-tenant daemon initialized", logutil.PrivateStrings("accounts", router.AccountIDs()))
+
+	workers.Add(func() error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, func(error) {
+		cancel()
+	})
+
+	return workers.Run()
+}
+
+// openTenant configures a dedicated manager for the given account, storing
+// its data in the same layout as the account service does.
+func openTenant(logger *zap.Logger, accountID, appDir, sharedDir string) (*initutil.Manager, error) {
+	appDir = accountutils.GetAccountDir(appDir, accountID)
+	sharedDir = accountutils.GetAccountDir(sharedDir, accountID)
+	for _, dir := range []string{appDir, sharedDir} {
+		if err := accountutils.CreateDataDir(dir); err != nil {
+			return nil, errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+	}
+
+	tenant, err := initutil.New(&initutil.ManagerOpts{
+		DoNotSetDefaultDir: true,
+		AccountID:          accountID,
+	})
+	if err != nil {
+		return nil, errcode.ErrBertyAccountManagerOpen.Wrap(err)
+	}
+
+	fs := flag.NewFlagSet("tenant", flag.ContinueOnError)
+	tenant.Session.Kind = "cli.daemon.tenant"
+	tenant.SetupLocalMessengerServerFlags(fs)
+	tenant.SetupEmptyGRPCListenersFlags(fs)
+
+	// tenants only share the daemon listeners, every other listener would
+	// conflict between them
+	args := []string{
+		"-store.dir", appDir,
+		"-store.shared-dir", sharedDir,
+		"-store.inmem=" + strconv.FormatBool(manager.Datastore.InMemory),
+		"-store.ephemeral", manager.Datastore.Ephemeral.String(),
+		"-preset", manager.Node.Preset,
+		"-p2p.ipfs-api-listeners", "",
+		"-p2p.webui-listener", "",
+	}
+	if err := fs.Parse(args); err != nil {
+		tenant.Close(nil)
+		return nil, errcode.ErrBertyAccountInvalidCLIArgs.Wrap(fmt.Errorf("account `%s`: %w", accountID, err))
+	}
+
+	tenant.SetLogger(logger.Named("tenant").With(logutil.PrivateString("account-id", accountID)))
+
+	return tenant, nil
+}
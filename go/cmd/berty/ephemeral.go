@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// printEphemeralWarning warns that nothing of an ephemeral account is saved,
+// see -store.ephemeral.
+func printEphemeralWarning(expiresAt time.Time) {
+	fmt.Fprintf(os.Stderr, "\n  /!\\ EPHEMERAL ACCOUNT /!\\\n")
+	fmt.Fprintf(os.Stderr, "  nothing is saved: the account, its contacts and its messages are discarded\n")
+	fmt.Fprintf(os.Stderr, "  on exit, or when it expires at %s (in %s)\n\n", expiresAt.Format("15:04"), time.Until(expiresAt).Round(time.Second))
+}
+
+// ephemeralExpired returns true if the account is ephemeral and expired, the
+// node is then stopped.
+func ephemeralExpired(expiresAt time.Time) bool {
+	return !expiresAt.IsZero() && !time.Now().Before(expiresAt)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+
+	"berty.tech/berty/v2/go/internal/groupmigration"
+	"berty.tech/berty/v2/go/pkg/bertymessenger"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func groupMigrationCommand() *ffcli.Command {
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty group-migration", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		manager.SetupLoggingFlags(fs)              // also available at root level
+		manager.SetupLocalMessengerServerFlags(fs) // the history is only available in-process
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "group-migration",
+		ShortUsage:     "berty [global flags] group-migration [flags] <export <conversation-pk> <file>|import <file>|announce <conversation-pk> <link>>",
+		ShortHelp:      "move a group to another account: export it with its history, re-create it from the export and invite back its members",
+		LongHelp:       "export writes the definition, the members and the text history of a group, the file is not encrypted. import re-creates the group under the account running it, invites the members who are contacts of the account and prints the link to share with the others. announce posts this link in the previous group, from the previous account, for every member to rejoin. The messages are sent the next time the account is online.",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return flag.ErrHelp
+			}
+
+			switch {
+			case args[0] == "export" && len(args) == 3,
+				args[0] == "import" && len(args) == 2,
+				args[0] == "announce" && len(args) == 3:
+			default:
+				return flag.ErrHelp
+			}
+
+			migrator, err := localGroupMigrator()
+			if err != nil {
+				return err
+			}
+
+			switch args[0] {
+			case "export":
+				bundle, err := migrator.ExportGroup(ctx, args[1])
+				if err != nil {
+					return err
+				}
+
+				f, err := os.OpenFile(args[2], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+				if err != nil {
+					return err
+				}
+
+				err = groupmigration.Write(f, bundle)
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					os.Remove(args[2])
+					return err
+				}
+
+				fmt.Printf("exported group %q with %d member(s) and %d message(s) to %s\n", bundle.Group.DisplayName, len(bundle.Members), len(bundle.Messages), args[2])
+				return nil
+
+			case "import":
+				f, err := os.Open(args[1])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				bundle, err := groupmigration.Read(f)
+				if err != nil {
+					return err
+				}
+
+				result, err := migrator.ImportGroup(ctx, bundle)
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("created group %s with %d imported message(s), %d contact(s) invited\n", result.ConversationPK, result.Messages, len(result.Invited))
+				for _, m := range result.NotInvited {
+					name := m.DisplayName
+					if name == "" {
+						name = m.PublicKey
+					}
+					fmt.Printf("not a contact, to invite with the link: %s\n", name)
+				}
+				fmt.Printf("invitation link: %s\n", result.Link)
+				return nil
+
+			default:
+				if err := migrator.AnnounceGroupMigration(ctx, args[1], args[2]); err != nil {
+					return err
+				}
+
+				fmt.Println("the invitation to the new group is posted in the previous group")
+				return nil
+			}
+		},
+	}
+}
+
+// localGroupMigrator opens the account without network, the messages are
+// read from the local store and the new ones are sent the next time the
+// account is online.
+func localGroupMigrator() (bertymessenger.GroupMigrator, error) {
+	manager.DisableIPFSNetwork()
+
+	server, err := manager.GetLocalMessengerServer()
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, ok := server.(bertymessenger.GroupMigrator)
+	if !ok {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("the messenger cannot migrate groups"))
+	}
+
+	return migrator, nil
+}
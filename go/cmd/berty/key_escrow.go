@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+
+	"berty.tech/berty/v2/go/internal/keyescrow"
+	"berty.tech/berty/v2/go/pkg/bertymessenger"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func keyEscrowCommand() *ffcli.Command {
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty key-escrow", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		manager.SetupLoggingFlags(fs)              // also available at root level
+		manager.SetupLocalMessengerServerFlags(fs) // the keys are only available in-process
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "key-escrow",
+		ShortUsage:     "berty [global flags] key-escrow [flags] <keygen <key-file>|enable <pk> <escrow-key>|disable <pk>|status <pk>|export <pk> <file>|open <key-file> <file>>",
+		ShortHelp:      "opt a conversation in to the export of its keys and messages to a file sealed to an escrow, recorded in the audit log",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return flag.ErrHelp
+			}
+
+			switch {
+			case args[0] == "keygen" && len(args) == 2:
+				pub, priv, err := keyescrow.GenerateRecipient()
+				if err != nil {
+					return err
+				}
+
+				f, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+				if err != nil {
+					return err
+				}
+				if _, err := fmt.Fprintln(f, keyescrow.EncodeKey(priv)); err != nil {
+					f.Close()
+					return err
+				}
+				if err := f.Close(); err != nil {
+					return err
+				}
+
+				fmt.Printf("private key written to %s, the escrow key is %s\n", args[1], keyescrow.EncodeKey(pub))
+				return nil
+
+			case args[0] == "open" && len(args) == 3:
+				raw, err := os.ReadFile(args[1])
+				if err != nil {
+					return err
+				}
+
+				priv, err := keyescrow.ParseKey(strings.TrimSpace(string(raw)))
+				if err != nil {
+					return err
+				}
+
+				f, err := os.Open(args[2])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				archive, err := keyescrow.Open(f, keyescrow.PublicKey(priv), priv)
+				if err != nil {
+					return err
+				}
+
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(archive)
+			}
+
+			escrow, err := localKeyEscrow()
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case args[0] == "enable" && len(args) == 3:
+				recipient, err := keyescrow.ParseKey(args[2])
+				if err != nil {
+					return err
+				}
+
+				enrollment, err := escrow.EnableKeyEscrow(ctx, args[1], recipient)
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("key escrow enabled for conversation %s, sealed to %s\n", enrollment.ConversationPK, keyescrow.Fingerprint(recipient))
+				return nil
+
+			case args[0] == "disable" && len(args) == 2:
+				if err := escrow.DisableKeyEscrow(ctx, args[1]); err != nil {
+					return err
+				}
+
+				fmt.Println("key escrow disabled, the exported files stay readable by the escrow")
+				return nil
+
+			case args[0] == "status" && len(args) == 2:
+				enrollment, err := escrow.KeyEscrowEnrollment(ctx, args[1])
+				if errcode.Is(err, errcode.ErrNotFound) {
+					fmt.Println("key escrow disabled")
+					return nil
+				} else if err != nil {
+					return err
+				}
+
+				recipient, err := keyescrow.ParseKey(enrollment.Recipient)
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("key escrow enabled since %s, sealed to %s\n", enrollment.EnabledAt.Local().Format("2006-01-02 15:04:05"), keyescrow.Fingerprint(recipient))
+				return nil
+
+			case args[0] == "export" && len(args) == 3:
+				f, err := os.OpenFile(args[2], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+				if err != nil {
+					return err
+				}
+
+				archive, err := escrow.ExportKeyEscrow(ctx, args[1], f)
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					os.Remove(args[2])
+					return err
+				}
+
+				fmt.Printf("exported the keys and %d message(s) of conversation %s to %s\n", len(archive.Messages), archive.ConversationPK, args[2])
+				return nil
+
+			default:
+				return flag.ErrHelp
+			}
+		},
+	}
+}
+
+// localKeyEscrow opens the account without network, the messages are read
+// from the local store.
+func localKeyEscrow() (bertymessenger.KeyEscrow, error) {
+	manager.DisableIPFSNetwork()
+
+	server, err := manager.GetLocalMessengerServer()
+	if err != nil {
+		return nil, err
+	}
+
+	escrow, ok := server.(bertymessenger.KeyEscrow)
+	if !ok {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("the messenger has no key escrow"))
+	}
+
+	return escrow, nil
+}
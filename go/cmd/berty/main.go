@@ -11,6 +11,7 @@ import (
 	ff "github.com/peterbourgon/ff/v3"
 	"github.com/peterbourgon/ff/v3/ffcli"
 
+	"berty.tech/berty/v2/go/internal/configloader"
 	"berty.tech/berty/v2/go/internal/initutil"
 	"berty.tech/berty/v2/go/pkg/errcode"
 )
@@ -56,13 +57,15 @@ func runMain(args []string) error {
 			ShortUsage: "berty [global flags] <subcommand> [flags] [args...]",
 			FlagSet:    fs,
 			Options: []ff.Option{
-				ff.WithEnvVarPrefix("BERTY"),
+				ff.WithEnvVarPrefix(configloader.EnvPrefix),
 			},
 			Exec:      func(context.Context, []string) error { return flag.ErrHelp },
 			UsageFunc: usageFunc,
 			Subcommands: []*ffcli.Command{
 				daemonCommand(),
 				accountDaemonCommand(),
+				accountBundleCommand(),
+				accountCommand(),
 				miniCommand(),
 				bannerCommand(),
 				versionCommand(),
@@ -72,7 +75,12 @@ func runMain(args []string) error {
 				tokenServerCommand(),
 				replicationServerCommand(),
 				peersCommand(),
+				peerListCommand(),
 				exportCommand(),
+				addressBookCommand(),
+				matrixExportCommand(),
+				groupMigrationCommand(),
+				matrixBridgeCommand(),
 				remoteLogsCommand(),
 				serviceKeyCommand(),
 				pushServerCommand(),
@@ -80,6 +88,13 @@ func runMain(args []string) error {
 				relayServerCommand(),
 				vcIssuerCommand(),
 				directoryServiceCommand(),
+				usageStatsCommand(),
+				auditLogCommand(),
+				keyEscrowCommand(),
+				cloudBackupCommand(),
+				shortLinkRelayCommand(),
+				storeCommand(),
+				configCommand(),
 			},
 		}
 
@@ -140,9 +155,5 @@ func usageFunc(c *ffcli.Command) string {
 }
 
 func ffSubcommandOptions() []ff.Option {
-	return []ff.Option{
-		ff.WithEnvVarPrefix("BERTY"),
-		ff.WithConfigFileFlag("config"),
-		ff.WithConfigFileParser(ff.PlainParser),
-	}
+	return configloader.Options(configloader.EnvPrefix)
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"berty.tech/berty/v2/go/internal/matrixbridge"
+)
+
+// matrixBridgeRemoteFlag adds the -remote flag of the matrix-bridge
+// subcommands.
+func matrixBridgeRemoteFlag(fs *flag.FlagSet, remoteAddr *string) {
+	fs.StringVar(remoteAddr, "remote", "127.0.0.1:9091", "gRPC address of the daemon running the bridge (see `berty daemon -matrix.homeserver`)")
+}
+
+// withMatrixBridge calls f with a connection to the daemon at remoteAddr.
+func withMatrixBridge(remoteAddr string, f func(cc *grpc.ClientConn) error) error {
+	cc, err := grpc.Dial(remoteAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	return f(cc)
+}
+
+func matrixBridgeLinkCommand() *ffcli.Command {
+	var remoteAddr string
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty matrix-bridge link", flag.ExitOnError)
+		matrixBridgeRemoteFlag(fs, &remoteAddr)
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "link",
+		ShortUsage:     "berty matrix-bridge link [flags] <group-pk> <room-id>",
+		ShortHelp:      "relay the messages of a group to a Matrix room and back, the room must let the bridge users join",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return flag.ErrHelp
+			}
+
+			return withMatrixBridge(remoteAddr, func(cc *grpc.ClientConn) error {
+				link, err := matrixbridge.LinkRoom(ctx, cc, args[0], args[1])
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("group %s relayed to %s\n", link.GroupPK, link.RoomID)
+				return nil
+			})
+		},
+	}
+}
+
+func matrixBridgeUnlinkCommand() *ffcli.Command {
+	var remoteAddr string
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty matrix-bridge unlink", flag.ExitOnError)
+		matrixBridgeRemoteFlag(fs, &remoteAddr)
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "unlink",
+		ShortUsage:     "berty matrix-bridge unlink [flags] <group-pk>",
+		ShortHelp:      "stop relaying a group",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+
+			return withMatrixBridge(remoteAddr, func(cc *grpc.ClientConn) error {
+				return matrixbridge.UnlinkRoom(ctx, cc, args[0])
+			})
+		},
+	}
+}
+
+func matrixBridgeListCommand() *ffcli.Command {
+	var remoteAddr string
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty matrix-bridge list", flag.ExitOnError)
+		matrixBridgeRemoteFlag(fs, &remoteAddr)
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "list",
+		ShortUsage:     "berty matrix-bridge list [flags]",
+		ShortHelp:      "list the groups relayed to Matrix",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				return flag.ErrHelp
+			}
+
+			return withMatrixBridge(remoteAddr, func(cc *grpc.ClientConn) error {
+				links, err := matrixbridge.ListLinks(ctx, cc)
+				if err != nil {
+					return err
+				}
+
+				for _, link := range links {
+					fmt.Printf("%s\t%s\tsince %s\n", link.GroupPK, link.RoomID, link.LinkedAt.Local().Format("2006-01-02 15:04"))
+				}
+				return nil
+			})
+		},
+	}
+}
+
+func matrixBridgeCommand() *ffcli.Command {
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty matrix-bridge [command]", flag.ExitOnError)
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "matrix-bridge",
+		ShortUsage:     "berty matrix-bridge [command]",
+		ShortHelp:      "manage the groups relayed to Matrix rooms by a running daemon",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			return flag.ErrHelp
+		},
+		Subcommands: []*ffcli.Command{
+			matrixBridgeLinkCommand(),
+			matrixBridgeUnlinkCommand(),
+			matrixBridgeListCommand(),
+		},
+	}
+}
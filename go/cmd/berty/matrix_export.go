@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+
+	"berty.tech/berty/v2/go/internal/matrixexport"
+	"berty.tech/berty/v2/go/pkg/bertymessenger"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// The files written by matrix-export in its output directory.
+const (
+	matrixEventsFilename  = "events.json"
+	matrixSendersFilename = "senders.json"
+)
+
+func matrixExportCommand() *ffcli.Command {
+	var serverName string
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty matrix-export", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		fs.StringVar(&serverName, "server-name", matrixexport.DefaultServerName, "homeserver of the Matrix IDs of the room and the senders")
+		manager.SetupLoggingFlags(fs)              // also available at root level
+		manager.SetupLocalMessengerServerFlags(fs) // the history is only available in-process
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "matrix-export",
+		ShortUsage:     "berty [global flags] matrix-export [flags] <contact-or-conversation-pk> <dir>",
+		ShortHelp:      "export the messages of a conversation as Matrix room events, with the mapping of the senders to Matrix IDs",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return flag.ErrHelp
+			}
+
+			manager.DisableIPFSNetwork()
+
+			server, err := manager.GetLocalMessengerServer()
+			if err != nil {
+				return err
+			}
+
+			exporter, ok := server.(bertymessenger.MatrixExporter)
+			if !ok {
+				return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the messenger cannot export to Matrix"))
+			}
+
+			export, err := exporter.ExportConversationToMatrix(ctx, args[0], serverName)
+			if err != nil {
+				return err
+			}
+
+			if err := os.MkdirAll(args[1], 0o700); err != nil {
+				return err
+			}
+
+			eventsPath := filepath.Join(args[1], matrixEventsFilename)
+			if err := writeMatrixFile(eventsPath, export, matrixexport.WriteEvents); err != nil {
+				return err
+			}
+
+			sendersPath := filepath.Join(args[1], matrixSendersFilename)
+			if err := writeMatrixFile(sendersPath, export, matrixexport.WriteSenders); err != nil {
+				return err
+			}
+
+			fmt.Printf("exported %d event(s) of room %s to %s, and %d sender(s) to %s\n", len(export.Messages), export.RoomID, eventsPath, len(export.Senders), sendersPath)
+			return nil
+		},
+	}
+}
+
+func writeMatrixFile(path string, export *matrixexport.Export, write func(w io.Writer, e *matrixexport.Export) error) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := write(f, export); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
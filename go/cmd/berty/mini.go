@@ -3,21 +3,53 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
 	"berty.tech/berty/v2/go/cmd/berty/mini"
+	"berty.tech/berty/v2/go/internal/initutil"
+	"berty.tech/berty/v2/go/internal/multitenant"
+	"berty.tech/berty/v2/go/internal/netconf"
+	"berty.tech/berty/v2/go/internal/versionrpc"
+	"berty.tech/berty/v2/go/pkg/bertymessenger"
+	"berty.tech/berty/v2/go/pkg/bertyversion"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
 )
 
 func miniCommand() *ffcli.Command {
-	var groupFlag string
+	var groupFlag, accountsFlag, templateFlag, scriptsFlag, aliasesFlag, bookmarksFlag, spellDictsFlag, spellFileFlag string
+	markReadAfterFlag := miniMarkReadAfter
+	awayAfterFlag := miniAwayAfter
+	accessibleFlag := false
 	fsBuilder := func() (*flag.FlagSet, error) {
 		fs := flag.NewFlagSet("berty mini", flag.ExitOnError)
 		fs.String("config", "", "config file (optional)")
 		fs.StringVar(&groupFlag, "mini.group", groupFlag, "group to join, leave empty to create a new group")
+		fs.StringVar(&accountsFlag, "mini.accounts", accountsFlag, "comma-separated list of accounts served by the remote multi-tenant daemon (see `berty daemon -tenants`), the first one is used on startup")
+		fs.StringVar(&templateFlag, "mini.message-template", mini.DefaultMessageTemplate, "Go template used to render messages, tabs split columns (fields: .Time, .ReceivedAt, .Sender, .Text, .Kind; functions: pad, padLeft, trunc, markdown)")
+		fs.StringVar(&scriptsFlag, "mini.scripts-dir", "", "directory of the Starlark bot scripts (*.star) reacting to the messages and contact requests, defaults to berty/mini-scripts in the user config directory when it exists")
+		fs.StringVar(&aliasesFlag, "mini.aliases-file", "", "file of the command aliases, one `name = expansion` per line (e.g. brb = Be right back, gm = /group members), listed with /alias, defaults to berty/mini-aliases in the user config directory when it exists")
+		fs.StringVar(&bookmarksFlag, "mini.bookmarks-file", "", "file of the messages starred with /star, defaults to berty/mini-bookmarks.json in the user config directory, created on the first star")
+		fs.StringVar(&spellDictsFlag, "mini.spell-dicts", "", "directory of the hunspell dictionaries (<language>.dic with its <language>.aff) checking the spelling of the input, their languages are enabled in /settings, defaults to berty/mini-dictionaries in the user config directory when it exists, else to /usr/share/hunspell")
+		fs.StringVar(&spellFileFlag, "mini.spell-file", "", "file of the spelling languages enabled in /settings, defaults to berty/mini-spelling.json in the user config directory")
+		fs.DurationVar(&markReadAfterFlag, "mini.mark-read-after", markReadAfterFlag, "mark a group with unread messages as read after displaying it this long, 0 to only mark them with /read")
+		fs.DurationVar(&awayAfterFlag, "mini.away-after", awayAfterFlag, "show the account away to the contacts after this long without keyboard input, 0 to only be away with /presence away")
+		fs.BoolVar(&accessibleFlag, "mini.accessible", accessibleFlag, "screen reader mode: no list of the conversations beside the history, the events of the other conversations announced as text, no color-only signals")
 		manager.Session.Kind = "cli.mini"
+		// keep the desktop notifications while inactive, see -node.inactive-sync
+		manager.Node.Messenger.InactiveSync = string(bertymessenger.InactiveSyncLight)
 		manager.SetupLoggingFlags(fs)              // also available at root level
 		manager.SetupMetricsFlags(fs)              // add flags to enable metrics
+		manager.SetupDebugFlags(fs)                // add flags to enable pprof
+		manager.SetupPresetFlags(fs)               // network profile of the local node, also chosen on the first run
 		manager.SetupLocalMessengerServerFlags(fs) // add flags to allow creating a full node in the same process
 		manager.SetupEmptyGRPCListenersFlags(fs)   // by default, we don't want to expose gRPC server for mini
 		manager.SetupRemoteNodeFlags(fs)           // mini can be run against an already running server
@@ -49,29 +81,299 @@ func miniCommand() *ffcli.Command {
 			}
 			miniLogger := logger.Named("mini")
 
-			// messenger client
-			messengerClient, err := manager.GetMessengerClient()
-			if err != nil {
-				return err
+			var (
+				messengerClient messengertypes.MessengerServiceClient
+				protocolClient  protocoltypes.ProtocolServiceClient
+				accountID       string
+				accounts        mini.AccountSwitcher
+				onboarding      *mini.Onboarding
+				hider           mini.ProfileHider
+				privacySettings mini.PrivacySettings
+				netConfig       mini.NetworkConfigEditor
+				readMarker      mini.ReadMarker
+				syncReporter    mini.GroupSyncReporter
+				presence        mini.PresencePublisher
+				conn            mini.Conn
+			)
+
+			if accountsFlag != "" {
+				cc, err := manager.GetGRPCClientConn()
+				if err != nil {
+					return err
+				}
+
+				if err := checkDaemonVersion(ctx, miniLogger, cc, multitenant.Feature); err != nil {
+					return err
+				}
+
+				switcher := &tenantSwitcher{cc: cc, accountIDs: strings.Split(accountsFlag, ",")}
+				accountID = switcher.accountIDs[0]
+				if messengerClient, protocolClient, err = switcher.Clients(accountID); err != nil {
+					return err
+				}
+				accounts = switcher
+				conn = cc
+			} else {
+				// the account is created by the local node, walk the user
+				// through its settings before starting it
+				if manager.Node.GRPC.RemoteAddr == "" {
+					exists, err := manager.HasAccountData()
+					if err != nil {
+						return err
+					}
+
+					if !exists && !manager.Datastore.InMemory {
+						onboarding, err = mini.RunOnboarding(manager.Node.Messenger.DisplayName, onboardingProfiles, manager.Node.Preset)
+						if err != nil {
+							return err
+						}
+						if onboarding == nil {
+							return nil
+						}
+
+						manager.Node.Messenger.DisplayName = onboarding.DisplayName
+						manager.Node.Preset = onboarding.Profile.Preset
+					}
+				}
+
+				// messenger client
+				if messengerClient, err = manager.GetMessengerClient(); err != nil {
+					return err
+				}
+
+				// protocol client
+				if protocolClient, err = manager.GetProtocolClient(); err != nil {
+					return err
+				}
+
+				if manager.Node.GRPC.RemoteAddr != "" {
+					// watch the connection to the remote daemon
+					cc, err := manager.GetGRPCClientConn()
+					if err != nil {
+						return err
+					}
+					if err := checkDaemonVersion(ctx, miniLogger, cc, messengertypes.MessengerService_ServiceDesc.ServiceName); err != nil {
+						return err
+					}
+					conn = cc
+				} else {
+					// the profile privacy is not exposed over grpc, it is only
+					// possible in-process
+					server, err := manager.GetLocalMessengerServer()
+					if err != nil {
+						return err
+					}
+					hider, _ = server.(mini.ProfileHider)
+					privacySettings, _ = server.(mini.PrivacySettings)
+					readMarker, _ = server.(mini.ReadMarker)
+					syncReporter, _ = server.(mini.GroupSyncReporter)
+					presence, _ = server.(mini.PresencePublisher)
+
+					// the network configuration of the account is kept in its
+					// root datastore
+					rootDS, err := manager.GetRootDatastore()
+					if err != nil {
+						return err
+					}
+					netConfig = netconf.NewStore(rootDS)
+				}
 			}
 
-			// protocol client
-			protocolClient, err := manager.GetProtocolClient()
-			if err != nil {
-				return err
+			if scriptsFlag == "" {
+				scriptsFlag = defaultMiniScriptsDir()
+			}
+			if aliasesFlag == "" {
+				aliasesFlag = defaultMiniAliasesFile()
+			}
+			if bookmarksFlag == "" {
+				bookmarksFlag = defaultMiniBookmarksFile()
+			}
+			if spellDictsFlag == "" {
+				spellDictsFlag = defaultMiniSpellDictsDir()
+			}
+			if spellFileFlag == "" {
+				spellFileFlag = defaultMiniSpellFile()
 			}
 
 			lcmanager := manager.GetLifecycleManager()
 
-			return mini.Main(ctx, &mini.Opts{
-				GroupInvitation:  groupFlag,
-				MessengerClient:  messengerClient,
-				ProtocolClient:   protocolClient,
-				Logger:           miniLogger,
-				DisplayName:      manager.Node.Messenger.DisplayName,
-				LifecycleManager: lcmanager,
-				NetManager:       manager.Node.Protocol.NetManager,
+			// the lifecycle of a remote daemon is not managed by mini, and
+			// suspending all the groups would drop the desktop notifications,
+			// the sync is only lowered while away when the contact groups
+			// stay synced
+			inactiveWhenAway := accountsFlag == "" && manager.Node.GRPC.RemoteAddr == "" &&
+				manager.Node.Messenger.InactiveSync == string(bertymessenger.InactiveSyncLight)
+
+			// an ephemeral account only lives in the local node
+			var expiresAt time.Time
+			if accountsFlag == "" && manager.Node.GRPC.RemoteAddr == "" {
+				expiresAt = manager.EphemeralExpiry()
+			}
+
+			err = mini.Main(ctx, &mini.Opts{
+				GroupInvitation:      groupFlag,
+				MessengerClient:      messengerClient,
+				ProtocolClient:       protocolClient,
+				Logger:               miniLogger,
+				DisplayName:          manager.Node.Messenger.DisplayName,
+				LifecycleManager:     lcmanager,
+				NetManager:           manager.Node.Protocol.NetManager,
+				AccountID:            accountID,
+				Accounts:             accounts,
+				Conn:                 conn,
+				ProfileHider:         hider,
+				PrivacySettings:      privacySettings,
+				NetworkConfig:        netConfig,
+				ReadMarker:           readMarker,
+				MarkReadAfter:        markReadAfterFlag,
+				GroupSyncReporter:    syncReporter,
+				MessageTemplate:      templateFlag,
+				ScriptsDir:           scriptsFlag,
+				AliasesFile:          aliasesFlag,
+				BookmarksFile:        bookmarksFlag,
+				SpellDictionariesDir: spellDictsFlag,
+				SpellingFile:         spellFileFlag,
+				AwayAfter:            awayAfterFlag,
+				PresencePublisher:    presence,
+				InactiveWhenAway:     inactiveWhenAway,
+				Onboarding:           onboarding,
+				ExpiresAt:            expiresAt,
+				Accessible:           accessibleFlag,
 			})
+			if err == nil && ephemeralExpired(expiresAt) {
+				fmt.Fprintln(os.Stderr, "the ephemeral account expired, it was discarded")
+			}
+			return err
 		},
 	}
 }
+
+// daemonVersionTimeout bounds the version negotiation with a remote daemon.
+const daemonVersionTimeout = 10 * time.Second
+
+// checkDaemonVersion fails if mini cannot use the remote daemon. The daemon
+// is not checked when it is unreachable, mini then displays the connection
+// state, or when it predates the version service.
+func checkDaemonVersion(ctx context.Context, logger *zap.Logger, cc grpc.ClientConnInterface, required ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, daemonVersionTimeout)
+	defer cancel()
+
+	info, err := versionrpc.Get(ctx, cc)
+	if err != nil {
+		logger.Warn("unable to check the compatibility of the remote daemon", zap.Error(err))
+		return nil
+	}
+
+	logger.Info("remote daemon", zap.String("version", info.Version), zap.Strings("features", info.Features))
+	return versionrpc.Check(info, bertyversion.Version, required...)
+}
+
+// miniAwayAfter is how long mini waits without keyboard input before
+// showing the account away, and lowering the sync of the node.
+const miniAwayAfter = 5 * time.Minute
+
+// miniMarkReadAfter is how long a group is displayed before its unread
+// messages are marked as read.
+const miniMarkReadAfter = 5 * time.Second
+
+// onboardingProfiles are the network profiles offered on the first run, see
+// the -preset flag.
+var onboardingProfiles = []mini.OnboardingProfile{
+	{Preset: "", Name: "default", Description: "all the transports, including mDNS and Bluetooth to reach nearby devices"},
+	{Preset: initutil.AnonymityPreset, Name: initutil.AnonymityPreset, Description: "no proximity transport, the device is not advertised to nearby ones"},
+}
+
+// tenantSwitcher gives mini access to the accounts of a multi-tenant daemon,
+// all of them sharing the same connection.
+type tenantSwitcher struct {
+	cc         *grpc.ClientConn
+	accountIDs []string
+}
+
+func (s *tenantSwitcher) AccountIDs() []string {
+	return s.accountIDs
+}
+
+func (s *tenantSwitcher) Clients(accountID string) (messengertypes.MessengerServiceClient, protocoltypes.ProtocolServiceClient, error) {
+	for _, id := range s.accountIDs {
+		if id == accountID {
+			cc := multitenant.NewAccountConn(s.cc, accountID)
+			return messengertypes.NewMessengerServiceClient(cc), protocoltypes.NewProtocolServiceClient(cc), nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("unknown account %s, known accounts are %s", accountID, strings.Join(s.accountIDs, ", "))
+}
+
+// defaultMiniScriptsDir returns the scripts directory of the user, empty if
+// it does not exist.
+func defaultMiniScriptsDir() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	dir := filepath.Join(configDir, "berty", "mini-scripts")
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return ""
+	}
+
+	return dir
+}
+
+// defaultMiniAliasesFile returns the aliases file of the user, empty if it
+// does not exist.
+func defaultMiniAliasesFile() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	path := filepath.Join(configDir, "berty", "mini-aliases")
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return ""
+	}
+
+	return path
+}
+
+// defaultMiniBookmarksFile returns the bookmarks file of the user, it is
+// created on the first star. The bookmarks are only kept in memory without
+// a user config directory.
+func defaultMiniBookmarksFile() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(configDir, "berty", "mini-bookmarks.json")
+}
+
+// defaultMiniSpellDictsDir returns the dictionaries directory of the user,
+// or the one of the system hunspell dictionaries, empty if neither exists.
+func defaultMiniSpellDictsDir() string {
+	dirs := []string{"/usr/share/hunspell"}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append([]string{filepath.Join(configDir, "berty", "mini-dictionaries")}, dirs...)
+	}
+
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+
+	return ""
+}
+
+// defaultMiniSpellFile returns the spelling settings file of the user, it is
+// created when a language is first toggled. The languages are only kept in
+// memory without a user config directory.
+func defaultMiniSpellFile() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(configDir, "berty", "mini-spelling.json")
+}
@@ -0,0 +1,117 @@
+package mini
+
+import (
+	"fmt"
+
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// The accessibility mode, see Opts.Accessible, is for the users of a screen
+// reader:
+//   - the list of the conversations is not displayed, the history of the
+//     displayed one is the only scrolling region, /goto and the quick
+//     switcher list the conversations,
+//   - the events of the other conversations are announced with a line of
+//     text in the displayed one, e.g. "new message from Alice in contact
+//     Alice", as is the conversation displayed after a switch,
+//   - the signals conveyed by a color are also written, e.g. the errors are
+//     prefixed with "error:" and the selected items of the lists with ">",
+//   - the ASCII art banner is not displayed.
+//
+// mini never rings the terminal bell, in this mode or not.
+
+// selectedMarker prefixes the selected line of a list in the accessibility
+// mode.
+const selectedMarker = "> "
+
+// accessible returns true in the accessibility mode.
+func (a *accountManager) accessible() bool {
+	return a.opts.Accessible
+}
+
+// selectedLine highlights the selected line of a list, line is already
+// escaped.
+func selectedLine(a *accountManager, line string) string {
+	if a.accessible() {
+		line = selectedMarker + line
+	}
+
+	return fmt.Sprintf("[white:blue]%s[-:-]", line)
+}
+
+// groupLabel returns the kind and the name of a conversation, as listed by
+// the quick switcher. v.lock must not be held.
+func (v *tabbedGroupsView) groupLabel(vg *groupView) string {
+	for _, entry := range v.quickSwitchEntries() {
+		if entry.group == vg {
+			return fmt.Sprintf("%s %s", entry.kind, entry.label)
+		}
+	}
+
+	return pkAsShortID(vg.g.PublicKey)
+}
+
+// announce writes a line in the displayed conversation for the screen reader
+// to read it, in the accessibility mode only. v.lock must not be held.
+func (v *tabbedGroupsView) announce(format string, args ...interface{}) {
+	if !v.accounts.accessible() {
+		return
+	}
+
+	v.lock.RLock()
+	displayed := v.displayedGroupView
+	v.lock.RUnlock()
+
+	// an invitation is displayed, its text is read instead
+	if displayed == nil {
+		return
+	}
+
+	displayed.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(fmt.Sprintf(format, args...)),
+	})
+}
+
+// announceMessage announces a message received in a conversation which is
+// not displayed.
+func (v *groupView) announceMessage(m *historyMessage) {
+	if !v.v.accounts.accessible() {
+		return
+	}
+
+	v.v.lock.RLock()
+	displayed := v.v.displayedGroupView == v
+	contactName := v.v.contactNames[string(v.g.PublicKey)]
+	v.v.lock.RUnlock()
+
+	if displayed {
+		return
+	}
+
+	sender := m.Sender()
+	if v.g.GroupType == protocoltypes.GroupTypeContact && contactName != "" {
+		sender = contactName
+	}
+
+	v.v.announce("new message from %s in %s", sender, v.v.groupLabel(v))
+}
+
+// announceDisplayed announces the conversation displayed after a switch,
+// with whether it has unread messages.
+func (v *tabbedGroupsView) announceDisplayed(vg *groupView) {
+	if !v.accounts.accessible() || vg == nil {
+		return
+	}
+
+	vg.muUnread.Lock()
+	unread := vg.unread.first != nil
+	vg.muUnread.Unlock()
+
+	if unread {
+		v.announce("now in %s, with unread messages", v.groupLabel(vg))
+		return
+	}
+
+	v.announce("now in %s", v.groupLabel(vg))
+}
@@ -0,0 +1,330 @@
+package mini
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rivo/tview"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// AccountSwitcher gives mini access to the other accounts opened on the node
+// it is attached to.
+type AccountSwitcher interface {
+	// AccountIDs returns the IDs of the opened accounts.
+	AccountIDs() []string
+
+	// Clients returns the clients bound to the given account.
+	Clients(accountID string) (messengertypes.MessengerServiceClient, protocoltypes.ProtocolServiceClient, error)
+}
+
+// accountState is what is preserved for an account while mini is attached
+// to another one.
+type accountState struct {
+	draft         string
+	selectedGroup []byte
+	// rowsFromEnd is stable while the history is reloaded, unlike offsets
+	rowsFromEnd map[string]int
+	// declinedInvitations are the groups whose invitations were declined
+	declinedInvitations map[string]bool
+}
+
+type accountSession struct {
+	accountID string
+	cancel    context.CancelFunc
+	view      *tabbedGroupsView
+	messenger messengertypes.MessengerServiceClient
+	protocol  protocoltypes.ProtocolServiceClient
+}
+
+type accountManager struct {
+	rootCtx  context.Context
+	opts     *Opts
+	app      *tview.Application
+	input    *tview.InputField
+	tabs     *tview.Flex
+	history  *tview.Flex
+	mu       sync.Mutex
+	current  *accountSession
+	states   map[string]*accountState
+	switcher AccountSwitcher
+	template *messageTemplate
+	perf     *perfPanel
+	redraws  *redrawThrottle
+	privacy  *privacyMode
+	jump     *quickSwitcher
+	selector *messageSelector
+	settings *settingsPanel
+	sync     *syncTracker
+	scripts  *scriptHost
+	aliases  *aliasSet
+	starred  *bookmarkStore
+	spell    *spellChecker
+	spelling *spellPopup
+	drafts   *draftKeeper
+	slow     *slowModeBar
+	away     *awayTimer
+	netconf  *netconfApplier
+}
+
+func newAccountManager(ctx context.Context, opts *Opts, app *tview.Application, input *tview.InputField, template *messageTemplate) *accountManager {
+	redraws := newRedrawThrottle(app)
+	a := &accountManager{
+		perf:     newPerfPanel(app, opts.Conn != nil, redraws),
+		redraws:  redraws,
+		rootCtx:  ctx,
+		opts:     opts,
+		app:      app,
+		input:    input,
+		tabs:     tview.NewFlex(),
+		history:  tview.NewFlex().SetDirection(tview.FlexRow),
+		states:   map[string]*accountState{},
+		switcher: opts.Accounts,
+		template: template,
+		netconf:  newNetconfApplier(opts.NetManager),
+	}
+	a.privacy = newPrivacyMode(a.setMasked)
+	a.jump = newQuickSwitcher(a)
+	a.selector = newMessageSelector(a)
+	a.settings = newSettingsPanel(a)
+	a.sync = newSyncTracker(a)
+	a.drafts = newDraftKeeper(a)
+	a.slow = newSlowModeBar(a)
+	a.spelling = newSpellPopup(a)
+	a.away = newAwayTimer(a)
+	return a
+}
+
+// setMasked masks or reveals the messages of the current account, the other
+// accounts are masked when they are attached.
+func (a *accountManager) setMasked(masked bool) {
+	current := a.Current()
+	if current == nil {
+		return
+	}
+
+	for _, view := range current.view.groupViews() {
+		view.messages.SetMasked(masked)
+	}
+}
+
+// Current returns the session of the account mini is attached to.
+func (a *accountManager) Current() *accountSession {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.current
+}
+
+// AccountIDs returns the accounts mini can be attached to, if any.
+func (a *accountManager) AccountIDs() []string {
+	if a.switcher == nil {
+		return nil
+	}
+
+	return a.switcher.AccountIDs()
+}
+
+// Switch tears down the views and streams of the current account and
+// attaches mini to the given one, the current account is kept on failure.
+func (a *accountManager) Switch(accountID string) error {
+	if a.switcher == nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("mini is not attached to a multi-account node"))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	prev := a.current
+	if prev != nil && prev.accountID == accountID {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("already using account %s", accountID))
+	}
+
+	messenger, protocol, err := a.switcher.Clients(accountID)
+	if err != nil {
+		return errcode.ErrNotFound.Wrap(err)
+	}
+
+	if prev != nil {
+		a.states[prev.accountID] = prev.view.saveState(a.input.GetText())
+	}
+
+	if err := a.attach(accountID, messenger, protocol); err != nil {
+		return err
+	}
+
+	if prev != nil {
+		prev.cancel()
+	}
+
+	return nil
+}
+
+// Reload rebuilds the views and streams of the current account, keeping its
+// state.
+func (a *accountManager) Reload() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	prev := a.current
+	if prev == nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("no current account"))
+	}
+
+	a.states[prev.accountID] = prev.view.saveState(a.input.GetText())
+	if err := a.attach(prev.accountID, prev.messenger, prev.protocol); err != nil {
+		return err
+	}
+
+	prev.cancel()
+
+	return nil
+}
+
+// Next switches to the account following the current one.
+func (a *accountManager) Next() error {
+	ids := a.AccountIDs()
+	if len(ids) < 2 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("no other account to switch to"))
+	}
+
+	current := a.Current()
+	for i, id := range ids {
+		if current != nil && id == current.accountID {
+			return a.Switch(ids[(i+1)%len(ids)])
+		}
+	}
+
+	return a.Switch(ids[0])
+}
+
+func (a *accountManager) attach(accountID string, messenger messengertypes.MessengerServiceClient, protocol protocoltypes.ProtocolServiceClient) error {
+	ctx, cancel := context.WithCancel(a.rootCtx)
+
+	config, err := protocol.ServiceGetConfiguration(ctx, &protocoltypes.ServiceGetConfiguration_Request{})
+	if err != nil {
+		cancel()
+		return errcode.TODO.Wrap(err)
+	}
+
+	accountGroup, err := protocol.GroupInfo(ctx, &protocoltypes.GroupInfo_Request{
+		GroupPK: config.AccountGroupPK,
+	})
+	if err != nil {
+		cancel()
+		return errcode.TODO.Wrap(err)
+	}
+
+	if a.opts.Logger != nil {
+		globalLogger = a.opts.Logger.Named(pkAsShortID(accountGroup.Group.PublicKey))
+	} else {
+		globalLogger = zap.NewNop()
+	}
+
+	state := a.states[accountID]
+	view := newTabbedGroups(ctx, accountGroup, protocol, messenger, a.app, a.opts.DisplayName, a.opts.NetManager, a, state, a.template)
+
+	a.tabs.Clear()
+	a.tabs.AddItem(view.GetTabs(), 0, 1, false)
+	a.history.Clear()
+	a.history.AddItem(view.GetHistory(), 0, 1, false)
+
+	draft := ""
+	if state != nil {
+		draft = state.draft
+	}
+	a.input.SetText(draft)
+
+	a.current = &accountSession{
+		accountID: accountID,
+		cancel:    cancel,
+		view:      view,
+		messenger: messenger,
+		protocol:  protocol,
+	}
+
+	return nil
+}
+
+// saveState captures the draft, the selected group and the scroll positions
+// of the account views.
+func (v *tabbedGroupsView) saveState(draft string) *accountState {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	state := &accountState{
+		draft:         draft,
+		selectedGroup: v.selectedGroupView.g.PublicKey,
+		rowsFromEnd:   map[string]int{},
+
+		declinedInvitations: map[string]bool{},
+	}
+
+	for groupPK := range v.declinedInvitations {
+		state.declinedInvitations[groupPK] = true
+	}
+
+	for _, vg := range v.getChannelViewGroups() {
+		if vg != nil {
+			state.rowsFromEnd[string(vg.g.PublicKey)] = vg.messages.RowsFromEnd()
+		}
+	}
+
+	return state
+}
+
+// restoreGroupState applies the saved state of the account to a group view
+// once its history is loaded.
+func (v *tabbedGroupsView) restoreGroupState(vg *groupView) {
+	if v.restored == nil {
+		return
+	}
+
+	if rows, ok := v.restored.rowsFromEnd[string(vg.g.PublicKey)]; ok {
+		vg.messages.ScrollToRowsFromEnd(rows)
+	}
+
+	if bytes.Equal(v.restored.selectedGroup, vg.g.PublicKey) {
+		v.lock.Lock()
+		v.selectedGroupView = vg
+		v.lock.Unlock()
+
+		v.recomputeChannelList(true)
+	}
+}
+
+func accountListCommand(_ context.Context, v *groupView, _ string) error {
+	ids := v.v.accounts.AccountIDs()
+	if len(ids) == 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("mini is not attached to a multi-account node"))
+	}
+
+	current := v.v.accounts.Current()
+	for _, id := range ids {
+		marker := " "
+		if current != nil && current.accountID == id {
+			marker = "*"
+		}
+
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(fmt.Sprintf("%s %s", marker, id)),
+		})
+	}
+
+	return nil
+}
+
+func accountSwitchCommand(_ context.Context, v *groupView, cmd string) error {
+	if cmd == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /account switch <id>"))
+	}
+
+	return v.v.accounts.Switch(cmd)
+}
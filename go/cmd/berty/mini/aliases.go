@@ -0,0 +1,227 @@
+package mini
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// aliasMaxDepth bounds the expansion of the aliases using other aliases.
+const aliasMaxDepth = 8
+
+// alias is a command defined by the user, see loadAliases.
+type alias struct {
+	name      string
+	expansion string
+	// steps are submitted in order, as if typed in the input.
+	steps []string
+}
+
+// aliasSet holds the aliases of the user, the methods accept a nil set.
+type aliasSet struct {
+	byName map[string]*alias
+}
+
+// loadAliases reads the aliases defined in path, one per line as
+// `name = expansion`, the empty lines and the ones starting with # are
+// ignored. An expansion is a message or a command, several of them are
+// separated by `;`. $1 to $9 are replaced by the arguments given to the
+// alias and $* by all of them, the arguments are appended to the last step
+// when the expansion has none of them, e.g.
+//
+//	brb = Be right back
+//	gm = /group members
+//	away = /profile hide; Away from keyboard: $*
+//
+// It returns nil when path is empty.
+func loadAliases(path string) (*aliasSet, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to read the aliases: %w", err))
+	}
+	defer f.Close()
+
+	reserved := map[string]bool{}
+	for _, cmd := range commandList() {
+		if word := strings.Fields(cmd.title)[0]; word != "/" {
+			reserved[word] = true
+		}
+	}
+
+	s := &aliasSet{byName: map[string]*alias{}}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		name, expansion, ok := strings.Cut(text, "=")
+		name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "/"))
+		expansion = strings.TrimSpace(expansion)
+
+		switch {
+		case !ok || name == "" || expansion == "":
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("%s:%d: expected `name = expansion`", path, line))
+		case strings.ContainsAny(name, " \t/"):
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("%s:%d: invalid alias name %q", path, line, name))
+		case reserved[name]:
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("%s:%d: %q is a mini command", path, line, name))
+		case s.byName[name] != nil:
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("%s:%d: alias %q already defined", path, line, name))
+		}
+
+		a := &alias{name: name, expansion: expansion}
+		for _, step := range strings.Split(expansion, ";") {
+			if step = strings.TrimSpace(step); step != "" {
+				a.steps = append(a.steps, step)
+			}
+		}
+		s.byName[name] = a
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to read the aliases: %w", err))
+	}
+
+	return s, nil
+}
+
+// sorted returns the aliases by name.
+func (s *aliasSet) sorted() []*alias {
+	if s == nil {
+		return nil
+	}
+
+	aliases := make([]*alias, 0, len(s.byName))
+	for _, a := range s.byName {
+		aliases = append(aliases, a)
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].name < aliases[j].name })
+
+	return aliases
+}
+
+// expand returns the steps of the alias used by input, the aliases used by
+// these steps are expanded as well. ok is false when input does not start
+// with an alias.
+func (s *aliasSet) expand(input string) (steps []string, ok bool, err error) {
+	if s == nil || !strings.HasPrefix(input, "/") {
+		return nil, false, nil
+	}
+
+	name, args, _ := strings.Cut(strings.TrimPrefix(input, "/"), " ")
+	a := s.byName[strings.ToLower(name)]
+	if a == nil {
+		return nil, false, nil
+	}
+
+	steps, err = s.expandAlias(a, strings.TrimSpace(args), 0)
+	return steps, true, err
+}
+
+func (s *aliasSet) expandAlias(a *alias, args string, depth int) ([]string, error) {
+	if depth >= aliasMaxDepth {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("alias %q nested too deep, is it recursive?", a.name))
+	}
+
+	steps := substituteArgs(a.steps, args)
+
+	expanded := []string(nil)
+	for _, step := range steps {
+		name, stepArgs, _ := strings.Cut(strings.TrimPrefix(step, "/"), " ")
+		nested := s.byName[strings.ToLower(name)]
+		if !strings.HasPrefix(step, "/") || nested == nil {
+			expanded = append(expanded, step)
+			continue
+		}
+
+		nestedSteps, err := s.expandAlias(nested, strings.TrimSpace(stepArgs), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, nestedSteps...)
+	}
+
+	return expanded, nil
+}
+
+// substituteArgs replaces the $1 to $9 and $* placeholders of steps, args
+// are appended to the last step when there is none.
+func substituteArgs(steps []string, args string) []string {
+	fields := strings.Fields(args)
+
+	replacements := []string{"$*", args}
+	for i := 9; i >= 1; i-- {
+		value := ""
+		if i <= len(fields) {
+			value = fields[i-1]
+		}
+		replacements = append(replacements, "$"+strconv.Itoa(i), value)
+	}
+	replacer := strings.NewReplacer(replacements...)
+
+	substituted := make([]string, len(steps))
+	placeholders := false
+	for i, step := range steps {
+		substituted[i] = strings.TrimSpace(replacer.Replace(step))
+		placeholders = placeholders || substituted[i] != step
+	}
+
+	if !placeholders && args != "" {
+		last := len(substituted) - 1
+		substituted[last] = substituted[last] + " " + args
+	}
+
+	return substituted
+}
+
+// runAlias submits the steps of an alias one after the other, it stops at
+// the first failing one.
+func (v *groupView) runAlias(ctx context.Context, steps []string) error {
+	for _, step := range steps {
+		if err := v.commandParser(ctx, step); err != nil {
+			return fmt.Errorf("%s: %w", step, err)
+		}
+	}
+
+	return nil
+}
+
+// aliasListCommand lists the aliases loaded on startup.
+func aliasListCommand(_ context.Context, v *groupView, _ string) error {
+	aliases := v.v.accounts.aliases.sorted()
+	if len(aliases) == 0 {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("no alias, they are defined in the -mini.aliases-file file"),
+		})
+		return nil
+	}
+
+	longest := 0
+	for _, a := range aliases {
+		if len(a.name) > longest {
+			longest = len(a.name)
+		}
+	}
+
+	for _, a := range aliases {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(fmt.Sprintf("/%s%s  %s", a.name, strings.Repeat(" ", longest-len(a.name)), a.expansion)),
+		})
+	}
+
+	return nil
+}
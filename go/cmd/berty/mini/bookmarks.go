@@ -0,0 +1,356 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rivo/tview"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// bookmarkMarker flags the starred messages.
+const bookmarkMarker = "★"
+
+// bookmark is a message starred with /star. Only its references are saved,
+// its text is read from the loaded history of its group.
+type bookmark struct {
+	// Account is the account group of the message, mini can be attached to
+	// several accounts.
+	Account   string    `json:"account"`
+	Group     string    `json:"group"`
+	CID       string    `json:"cid"`
+	SentAt    time.Time `json:"sentAt"`
+	StarredAt time.Time `json:"starredAt"`
+}
+
+// bookmarkStore holds the starred messages of all the accounts, they are
+// saved in a JSON file when it has a path.
+type bookmarkStore struct {
+	path string
+
+	mu        sync.Mutex
+	bookmarks []*bookmark
+}
+
+// loadBookmarks reads the bookmarks saved in path, a missing file has none.
+// The bookmarks are only kept in memory when path is empty.
+func loadBookmarks(path string) (*bookmarkStore, error) {
+	s := &bookmarkStore{path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return s, nil
+	case err != nil:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to read the bookmarks: %w", err))
+	}
+
+	if err := json.Unmarshal(raw, &s.bookmarks); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("unable to read the bookmarks of %s: %w", path, err))
+	}
+
+	return s, nil
+}
+
+// save writes the bookmarks, s.mu must be held.
+func (s *bookmarkStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(s.bookmarks, "", "  ")
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return errcode.ErrInternal.Wrap(err)
+	}
+
+	// the previous file is kept when the write fails
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return errcode.ErrInternal.Wrap(err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return errcode.ErrInternal.Wrap(err)
+	}
+
+	return nil
+}
+
+// toggle stars b, or unstars it when it was starred, it returns true when b
+// is starred.
+func (s *bookmarkStore) toggle(b *bookmark) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bookmarks := []*bookmark(nil)
+	for _, other := range s.bookmarks {
+		if other.Account != b.Account || other.CID != b.CID {
+			bookmarks = append(bookmarks, other)
+		}
+	}
+
+	starred := len(bookmarks) == len(s.bookmarks)
+	if starred {
+		bookmarks = append(bookmarks, b)
+	}
+
+	previous := s.bookmarks
+	s.bookmarks = bookmarks
+	if err := s.save(); err != nil {
+		s.bookmarks = previous
+		return !starred, err
+	}
+
+	return starred, nil
+}
+
+// isStarred returns true when the message cid of account is starred.
+func (s *bookmarkStore) isStarred(account, cid string) bool {
+	if cid == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range s.bookmarks {
+		if b.Account == account && b.CID == cid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// list returns the bookmarks of account, the last starred first.
+func (s *bookmarkStore) list(account string) []*bookmark {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bookmarks := []*bookmark(nil)
+	for _, b := range s.bookmarks {
+		if b.Account == account {
+			bookmarks = append(bookmarks, b)
+		}
+	}
+
+	sort.SliceStable(bookmarks, func(i, j int) bool { return bookmarks[i].StarredAt.After(bookmarks[j].StarredAt) })
+	return bookmarks
+}
+
+// accountKey returns the key of the bookmarks of the account of v.
+func (v *tabbedGroupsView) accountKey() string {
+	return base64.RawURLEncoding.EncodeToString(v.accountGroupView.g.PublicKey)
+}
+
+// isStarred returns true when the message cid of v is starred.
+func (v *groupView) isStarred(cid string) bool {
+	return v.v.accounts.starred.isStarred(v.v.accountKey(), cid)
+}
+
+// toggleStar stars or unstars m, a message of v.
+func (v *groupView) toggleStar(m *historyMessage) error {
+	if m.cid == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the message is not sent yet"))
+	}
+
+	starred, err := v.v.accounts.starred.toggle(&bookmark{
+		Account:   v.v.accountKey(),
+		Group:     base64.RawURLEncoding.EncodeToString(v.g.PublicKey),
+		CID:       m.cid,
+		SentAt:    m.receivedAt,
+		StarredAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	v.messages.SetStarred(m, starred)
+	v.v.recomputeChannelList(false)
+
+	text := "message unstarred"
+	if starred {
+		text = "message starred, see the Bookmarks tab or /bookmarks"
+	}
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(text),
+	})
+
+	return nil
+}
+
+func starCommand(_ context.Context, v *groupView, cmd string) error {
+	n := 1
+	if cmd != "" {
+		var err error
+		if n, err = strconv.Atoi(cmd); err != nil || n <= 0 {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /star [n]"))
+		}
+	}
+
+	m := v.messages.LastMessage(n)
+	if m == nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("no message #%d from the end of the history", n))
+	}
+
+	return v.toggleStar(m)
+}
+
+func bookmarksCommand(_ context.Context, v *groupView, _ string) error {
+	if len(v.v.accounts.starred.list(v.v.accountKey())) == 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("no starred message, star one with /star [n]"))
+	}
+
+	v.v.SelectBookmarks()
+	return nil
+}
+
+// findGroupView returns the view of the group whose base64 public key is
+// groupPK, v.lock must be held.
+func (v *tabbedGroupsView) findGroupView(groupPK string) *groupView {
+	for _, vg := range v.getChannelViewGroups() {
+		if vg != nil && base64.RawURLEncoding.EncodeToString(vg.g.PublicKey) == groupPK {
+			return vg
+		}
+	}
+
+	return nil
+}
+
+// SelectBookmarks displays the bookmarks in place of a group.
+func (v *tabbedGroupsView) SelectBookmarks() {
+	v.lock.Lock()
+	v.selectedInvitation = nil
+	v.bookmarksSelected = true
+	v.bookmarkCursor = 0
+	v.lock.Unlock()
+
+	v.recomputeChannelList(true)
+	go v.app.Draw()
+}
+
+// BookmarksSelected returns true while the bookmarks are displayed.
+func (v *tabbedGroupsView) BookmarksSelected() bool {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	return v.bookmarksSelected
+}
+
+// MoveBookmarkCursor selects the step-th bookmark after the selected one.
+func (v *tabbedGroupsView) MoveBookmarkCursor(step int) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	count := len(v.accounts.starred.list(v.accountKey()))
+	if count == 0 {
+		return
+	}
+
+	v.bookmarkCursor = (v.bookmarkCursor + step + count) % count
+	v.renderBookmarks()
+}
+
+// OpenSelectedBookmark displays the group of the selected bookmark, scrolled
+// to its message. It returns false when the bookmarks are not displayed.
+func (v *tabbedGroupsView) OpenSelectedBookmark() bool {
+	v.lock.RLock()
+	if !v.bookmarksSelected {
+		v.lock.RUnlock()
+		return false
+	}
+
+	bookmarks := v.accounts.starred.list(v.accountKey())
+	var (
+		target *bookmark
+		vg     *groupView
+	)
+	if v.bookmarkCursor < len(bookmarks) {
+		target = bookmarks[v.bookmarkCursor]
+		vg = v.findGroupView(target.Group)
+	}
+	v.lock.RUnlock()
+
+	if vg == nil {
+		return true
+	}
+
+	v.SelectGroup(vg)
+	if _, ok := vg.messages.JumpToMessage(target.CID); !ok {
+		vg.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("the starred message is not in the loaded history"),
+		})
+	}
+
+	return true
+}
+
+// renderBookmarks lists the bookmarks of the account, v.lock must be held.
+func (v *tabbedGroupsView) renderBookmarks() {
+	bookmarks := v.accounts.starred.list(v.accountKey())
+	if v.bookmarkCursor >= len(bookmarks) {
+		v.bookmarkCursor = 0
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "[::b]Bookmarks[::-] (%d starred message(s))\n\nUp/Down to select, Enter to jump to the message, /star it there again to unstar it.\n", len(bookmarks))
+
+	for i, bm := range bookmarks {
+		group, text, sender := bm.Group, "(not in the loaded history)", ""
+		if pk, err := base64.RawURLEncoding.DecodeString(bm.Group); err == nil {
+			group = pkAsShortID(pk)
+		}
+		if vg := v.findGroupView(bm.Group); vg != nil {
+			group = v.bookmarkGroupLabel(vg)
+			if m := vg.messages.FindMessage(bm.CID); m != nil {
+				text, sender = messageExcerpt(m.Text()), m.Sender()+": "
+			}
+		}
+
+		line := fmt.Sprintf("%s  %s  %s%s", bm.SentAt.Local().Format("2006-01-02 15:04"), tview.Escape(group), tview.Escape(sender), tview.Escape(text))
+		if i == v.bookmarkCursor {
+			line = selectedLine(v.accounts, line)
+		}
+		fmt.Fprintf(b, "\n%s", line)
+	}
+
+	v.bookmarksView.SetText(b.String())
+}
+
+// bookmarkGroupLabel returns the name of the conversation of vg, v.lock must
+// be held.
+func (v *tabbedGroupsView) bookmarkGroupLabel(vg *groupView) string {
+	switch {
+	case vg == v.accountGroupView:
+		return "Account"
+	case v.contactNames[string(vg.g.PublicKey)] != "":
+		return v.contactNames[string(vg.g.PublicKey)]
+	}
+
+	vg.muAggregates.Lock()
+	topic := vg.profile.Profile().Topic
+	vg.muAggregates.Unlock()
+
+	if topic != "" {
+		return topic
+	}
+	return pkAsShortID(vg.g.PublicKey)
+}
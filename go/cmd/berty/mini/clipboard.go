@@ -0,0 +1,91 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+
+	"github.com/atotto/clipboard"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// clipboardUnavailable returns why the clipboard cannot be used, or "". The
+// clipboard commands are pbcopy on macOS, the Windows clipboard, and wl-copy,
+// xclip, xsel or termux-clipboard-set on the other systems.
+func clipboardUnavailable() string {
+	if clipboard.Unsupported {
+		return "no clipboard utility available, e.g. wl-copy, xclip or xsel"
+	}
+
+	// the clipboard of the remote host is of no use to the user
+	ssh := os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != ""
+	display := os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+	if ssh && !display {
+		return "no clipboard in an SSH session"
+	}
+
+	// xclip and xsel need a display
+	if runtime.GOOS != "darwin" && runtime.GOOS != "windows" && runtime.GOOS != "android" && !display {
+		if _, termux := os.LookupEnv("TERMUX_VERSION"); !termux {
+			return "no display to hold the clipboard"
+		}
+	}
+
+	return ""
+}
+
+// copyToClipboard copies txt to the clipboard. When there is no clipboard,
+// txt is printed to be copied from the terminal, unless it was just shown.
+func copyToClipboard(v *groupView, txt string, shown bool) {
+	reason := clipboardUnavailable()
+	if reason == "" {
+		err := clipboard.WriteAll(txt)
+		if err == nil {
+			v.syncMessages <- &historyMessage{
+				messageType: messageTypeMeta,
+				payload:     []byte("(Copied to clipboard)"),
+			}
+			return
+		}
+		reason = fmt.Sprintf("copy to clipboard failed: %v", err)
+	}
+
+	if shown {
+		v.syncMessages <- &historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(fmt.Sprintf("(Not copied, %s, copy it from above)", reason)),
+		}
+		return
+	}
+
+	v.syncMessages <- &historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(fmt.Sprintf("(Not copied, %s, copy it from below)", reason)),
+	}
+	v.syncMessages <- &historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(txt),
+	}
+}
+
+func copyCommand(ctx context.Context, v *groupView, cmd string) error {
+	n := 1
+	if cmd != "" {
+		var err error
+		if n, err = strconv.Atoi(cmd); err != nil || n <= 0 {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /copy [n]"))
+		}
+	}
+
+	m := v.messages.LastMessage(n)
+	if m == nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("no message #%d from the end of the history", n))
+	}
+
+	copyToClipboard(v, m.Text(), false)
+
+	return nil
+}
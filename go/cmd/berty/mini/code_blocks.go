@@ -0,0 +1,129 @@
+package mini
+
+import (
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// The lines of the code blocks are displayed on a distinct background, they
+// start with codeLineStart for wrapText to keep them whole.
+const (
+	codeLineStart = "[:#303030]"
+	codeLineEnd   = "[:-]"
+
+	codeFence = "```"
+
+	// codeTabWidth is the number of spaces replacing a tab, the table cells
+	// cannot display tabs.
+	codeTabWidth = 4
+
+	// codeScrollStep is the number of columns the code blocks move by with
+	// Shift+Left and Shift+Right.
+	codeScrollStep = 8
+)
+
+// renderCodeBlocks escapes text, the lines between ``` fences are rendered
+// as code: their whitespace is preserved, they are padded to the width of
+// the block and they are not wrapped. A fence on a single line, as in
+// ```ls -l```, is a one line block, and a block without its closing fence
+// lasts until the end of the text.
+func renderCodeBlocks(text string) string {
+	if !strings.Contains(text, codeFence) {
+		return tview.Escape(text)
+	}
+
+	lines := []string{}
+	block, inBlock := []string(nil), false
+
+	flush := func() {
+		width := 0
+		for _, line := range block {
+			if w := tview.TaggedStringWidth(line); w > width {
+				width = w
+			}
+		}
+
+		for _, line := range block {
+			padding := strings.Repeat(" ", width-tview.TaggedStringWidth(line))
+			lines = append(lines, codeLineStart+" "+line+padding+" "+codeLineEnd)
+		}
+		block = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !inBlock && len(trimmed) > 2*len(codeFence) && strings.HasPrefix(trimmed, codeFence) && strings.HasSuffix(trimmed, codeFence):
+			block = append(block, escapeCodeLine(strings.TrimSuffix(strings.TrimPrefix(trimmed, codeFence), codeFence)))
+			flush()
+
+		case strings.HasPrefix(trimmed, codeFence):
+			if inBlock {
+				flush()
+			}
+			inBlock = !inBlock
+			lines = append(lines, "[::d]"+tview.Escape(line)+"[::-]")
+
+		case inBlock:
+			block = append(block, escapeCodeLine(line))
+
+		default:
+			lines = append(lines, tview.Escape(line))
+		}
+	}
+	flush()
+
+	return strings.Join(lines, "\n")
+}
+
+func escapeCodeLine(line string) string {
+	return tview.Escape(strings.ReplaceAll(line, "\t", strings.Repeat(" ", codeTabWidth)))
+}
+
+// isCodeLine returns true for a line of a code block rendered by
+// renderCodeBlocks.
+func isCodeLine(line string) bool {
+	return strings.HasPrefix(line, codeLineStart)
+}
+
+// scrollCodeLine returns the columns of a code line from offset, clipped to
+// width when it is not 0. The hidden parts are marked with ‹ and ›.
+func scrollCodeLine(line string, offset, width int) string {
+	code := strings.TrimSuffix(strings.TrimPrefix(line, codeLineStart), codeLineEnd)
+
+	if offset > 0 {
+		_, code = splitTaggedString(code, offset)
+		code = "‹" + code
+	}
+
+	if width > 0 && tview.TaggedStringWidth(code) > width {
+		code, _ = splitTaggedString(code, width-1)
+		code += "›"
+	}
+
+	return codeLineStart + code + codeLineEnd
+}
+
+// hasCodeBlock returns true if m is displayed with a code block.
+func hasCodeBlock(m *historyMessage) bool {
+	return m.messageType == messageTypeMessage && strings.Contains(m.Text(), codeFence)
+}
+
+// ScrollCode moves the code blocks horizontally by step columns, their
+// lines are not wrapped.
+func (h *historyMessageList) ScrollCode(step int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	offset := h.options.codeOffset + step
+	if offset < 0 {
+		offset = 0
+	}
+	if offset == h.options.codeOffset {
+		return
+	}
+	h.options.codeOffset = offset
+
+	h.rerender(hasCodeBlock)
+}
@@ -0,0 +1,221 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/connectivity"
+)
+
+const (
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = 30 * time.Second
+)
+
+// Conn is the connection to a remote daemon, it is implemented by
+// *grpc.ClientConn.
+type Conn interface {
+	GetState() connectivity.State
+	WaitForStateChange(ctx context.Context, sourceState connectivity.State) bool
+	Connect()
+	ResetConnectBackoff()
+}
+
+// connectionMonitor shows a banner while the daemon is unreachable, re-dials
+// it with backoff and resubscribes the streams once it is back. Inputs
+// submitted in the meantime are replayed on reconnection. A change of
+// network re-dials it right away, see reconnectNow.
+type connectionMonitor struct {
+	conn     Conn
+	app      *tview.Application
+	banner   *tview.TextView
+	layout   *tview.Flex
+	accounts *accountManager
+	kick     chan struct{}
+
+	mu           sync.Mutex
+	disconnected bool
+	pending      []string
+}
+
+func newConnectionMonitor(conn Conn, app *tview.Application, accounts *accountManager) *connectionMonitor {
+	banner := tview.NewTextView().
+		SetTextColor(tcell.ColorWhite).
+		SetTextAlign(tview.AlignCenter)
+	banner.SetBackgroundColor(tcell.ColorDarkRed)
+
+	return &connectionMonitor{
+		conn:     conn,
+		app:      app,
+		banner:   banner,
+		accounts: accounts,
+		kick:     make(chan struct{}, 1),
+	}
+}
+
+// reconnectNow stops waiting for the backoff when the daemon is
+// unreachable, it is the hook of the network changes.
+func (c *connectionMonitor) reconnectNow(context.Context) {
+	select {
+	case c.kick <- struct{}{}:
+	default:
+	}
+}
+
+// attachTo adds the banner, hidden until a disconnection, on top of layout.
+func (c *connectionMonitor) attachTo(layout *tview.Flex) {
+	c.layout = layout
+	layout.AddItem(c.banner, 0, 0, false)
+}
+
+// Buffer keeps the input for later when the daemon is unreachable, it
+// returns false when the input can be submitted right away.
+func (c *connectionMonitor) Buffer(input string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.disconnected {
+		return false
+	}
+
+	c.pending = append(c.pending, input)
+	c.setBanner(true, len(c.pending))
+
+	return true
+}
+
+func (c *connectionMonitor) run(ctx context.Context) {
+	backoff := reconnectMinBackoff
+
+	for {
+		state := c.conn.GetState()
+
+		switch state {
+		case connectivity.Shutdown:
+			return
+
+		case connectivity.Ready:
+			backoff = reconnectMinBackoff
+			c.onReady(ctx)
+
+		case connectivity.Idle, connectivity.TransientFailure:
+			c.onDisconnected()
+			if state == connectivity.Idle {
+				c.conn.Connect()
+			}
+		}
+
+		waitCtx, cancel := ctx, context.CancelFunc(func() {})
+		kicked := make(chan struct{})
+		if c.isDisconnected() {
+			waitCtx, cancel = context.WithTimeout(ctx, backoff)
+			go func(waitCtx context.Context, cancel context.CancelFunc) {
+				select {
+				case <-c.kick:
+					close(kicked)
+					cancel()
+				case <-waitCtx.Done():
+				}
+			}(waitCtx, cancel)
+		}
+
+		changed := c.conn.WaitForStateChange(waitCtx, state)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-kicked:
+			// the network changed, the daemon may be reachable again
+			globalLogger.Debug("network changed, re-dialing daemon")
+			backoff = reconnectMinBackoff
+			c.conn.ResetConnectBackoff()
+			c.conn.Connect()
+			continue
+		default:
+		}
+
+		if !changed {
+			// no progress before the backoff expired, dial again
+			globalLogger.Debug("re-dialing daemon", zap.Duration("backoff", backoff))
+			c.conn.Connect()
+
+			if backoff *= 2; backoff > reconnectMaxBackoff {
+				backoff = reconnectMaxBackoff
+			}
+		}
+	}
+}
+
+func (c *connectionMonitor) isDisconnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.disconnected
+}
+
+func (c *connectionMonitor) onDisconnected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.disconnected {
+		return
+	}
+
+	globalLogger.Warn("daemon connection lost")
+	c.disconnected = true
+	c.setBanner(true, len(c.pending))
+}
+
+func (c *connectionMonitor) onReady(ctx context.Context) {
+	c.mu.Lock()
+	if !c.disconnected {
+		c.mu.Unlock()
+		return
+	}
+
+	c.disconnected = false
+	pending := c.pending
+	c.pending = nil
+	c.setBanner(false, 0)
+	c.mu.Unlock()
+
+	globalLogger.Info("daemon connection restored", zap.Int("pending-inputs", len(pending)))
+
+	// the streams of the previous connection are broken
+	if err := c.accounts.Reload(); err != nil {
+		globalLogger.Error("unable to resubscribe after reconnection", zap.Error(err))
+		return
+	}
+
+	for _, input := range pending {
+		c.accounts.Current().view.GetActiveViewGroup().OnSubmit(ctx, input)
+	}
+}
+
+// setBanner must be called with the lock held.
+func (c *connectionMonitor) setBanner(visible bool, pending int) {
+	size := 0
+	text := ""
+	if visible {
+		size = 1
+		text = "disconnected from the daemon, reconnecting..."
+		if pending > 0 {
+			text += fmt.Sprintf(" (%d input(s) queued)", pending)
+		}
+	}
+
+	c.app.QueueUpdateDraw(func() {
+		c.banner.SetText(text)
+		if c.layout != nil {
+			c.layout.ResizeItem(c.banner, size, 0)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package mini
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rivo/tview"
+
+	"berty.tech/berty/v2/go/internal/contactnames"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// contactEntries returns the contacts named by contactNames, their ID is the
+// public key of their group as displayed by mini, so that the references end
+// with the short ID of the conversation. v.lock must be held.
+func (v *tabbedGroupsView) contactEntries() []contactnames.Entry {
+	entries := make([]contactnames.Entry, 0, len(v.contactNames))
+	for gpk, name := range v.contactNames {
+		entries = append(entries, contactnames.Entry{ID: base64.StdEncoding.EncodeToString([]byte(gpk)), Name: name})
+	}
+
+	return entries
+}
+
+// contactReferences returns the unambiguous reference of each contact by
+// group public key, e.g. `Alice#Yk3o9p` when two contacts are named Alice.
+// v.lock must be held.
+func (v *tabbedGroupsView) contactReferences() map[string]string {
+	refs := map[string]string{}
+	for id, ref := range contactnames.References(v.contactEntries()) {
+		if gpk, err := base64.StdEncoding.DecodeString(id); err == nil {
+			refs[string(gpk)] = ref
+		}
+	}
+
+	return refs
+}
+
+// resolveContactGroup returns the group of the contact referenced by query,
+// a display name or a reference. An ambiguous name fails with the references
+// of the candidates.
+func (v *tabbedGroupsView) resolveContactGroup(query string) ([]byte, error) {
+	v.lock.RLock()
+	entries := v.contactEntries()
+	v.lock.RUnlock()
+
+	matches := contactnames.Resolve(entries, query)
+	switch len(matches) {
+	case 0:
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown contact %q", query))
+	case 1:
+		gpk, err := base64.StdEncoding.DecodeString(matches[0].ID)
+		if err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+		return gpk, nil
+	}
+
+	refs := contactnames.References(entries)
+	candidates := make([]string, len(matches))
+	for i, m := range matches {
+		candidates[i] = refs[m.ID]
+	}
+	sort.Strings(candidates)
+
+	return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("%d contacts are named %q, use one of: %s", len(matches), query, strings.Join(candidates, ", ")))
+}
+
+// completeContact completes the contact reference ending the input, the
+// longest one matching is completed, e.g. `/ping Alice Sm` completes
+// `Alice Smith`. When several contacts match, their common prefix is
+// completed and they are listed.
+func (v *tabbedGroupsView) completeContact(input *tview.InputField) {
+	v.lock.RLock()
+	refs := []string{}
+	for _, ref := range v.contactReferences() {
+		refs = append(refs, ref)
+	}
+	v.lock.RUnlock()
+	sort.Strings(refs)
+
+	text := input.GetText()
+	for start := 0; start < len(text); start++ {
+		if start > 0 && text[start-1] != ' ' {
+			continue
+		}
+
+		typed := strings.ToLower(text[start:])
+		candidates := []string{}
+		for _, ref := range refs {
+			if strings.HasPrefix(strings.ToLower(ref), typed) {
+				candidates = append(candidates, ref)
+			}
+		}
+
+		switch len(candidates) {
+		case 0:
+			continue
+		case 1:
+			input.SetText(text[:start] + candidates[0])
+			return
+		}
+
+		if prefix := commonPrefixFold(candidates); len(prefix) > len(text[start:]) {
+			input.SetText(text[:start] + prefix)
+		}
+
+		v.GetActiveViewGroup().messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("contacts: " + strings.Join(candidates, ", ")),
+		})
+		return
+	}
+}
+
+// commonPrefixFold returns the prefix of the first string shared, case
+// insensitively, by all the strings.
+func commonPrefixFold(values []string) string {
+	prefix := []rune(values[0])
+	for _, value := range values[1:] {
+		other := []rune(value)
+		n := 0
+		for n < len(prefix) && n < len(other) && strings.EqualFold(string(prefix[n]), string(other[n])) {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+
+	return string(prefix)
+}
@@ -0,0 +1,102 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// contactOutgoingCommand lists the contact requests sent and not answered
+// yet, with the same ids as /contact requests.
+func contactOutgoingCommand(ctx context.Context, v *groupView, _ string) error {
+	reply, err := v.v.messenger.ContactRequestList(ctx, &messengertypes.ContactRequestList_Request{})
+	if err != nil {
+		return err
+	}
+
+	requests := reply.GetRequests()
+
+	if len(requests) == 0 {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("no outgoing contact requests"),
+		})
+		return nil
+	}
+
+	for _, request := range requests {
+		pk, err := base64.RawURLEncoding.DecodeString(request.ContactPublicKey)
+		if err != nil {
+			return errcode.ErrDeserialization.Wrap(err)
+		}
+
+		status := "waiting to be sent"
+		if request.State == messengertypes.Contact_OutgoingRequestSent {
+			status = fmt.Sprintf("sent %s", time.UnixMilli(request.SentDate).Format(time.Stamp))
+		}
+
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(fmt.Sprintf("%s %s, created %s, %s", base64.StdEncoding.EncodeToString(pk), request.DisplayName, time.UnixMilli(request.CreatedDate).Format(time.Stamp), status)),
+		})
+	}
+
+	return nil
+}
+
+// contactCancelCommand cancels an outgoing contact request, the contact id is
+// the one displayed by /contact outgoing.
+func contactCancelCommand(ctx context.Context, v *groupView, cmd string) error {
+	pk, err := base64.StdEncoding.DecodeString(strings.TrimSpace(cmd))
+	if err != nil || len(pk) == 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /contact cancel <contact id>"))
+	}
+
+	if _, err := v.v.messenger.ContactRequestCancel(ctx, &messengertypes.ContactRequestCancel_Request{ContactPublicKey: base64.RawURLEncoding.EncodeToString(pk)}); err != nil {
+		return err
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte("contact request canceled"),
+	})
+
+	return nil
+}
+
+// contactBacklogCommand lists the deferred contact requests, with the ids of
+// /contact accept and /contact discard.
+func contactBacklogCommand(ctx context.Context, v *groupView, _ string) error {
+	reply, err := v.v.messenger.ContactBacklogList(ctx, &messengertypes.ContactBacklogList_Request{})
+	if err != nil {
+		return err
+	}
+
+	requests := reply.GetRequests()
+	if len(requests) == 0 {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("no deferred contact requests"),
+		})
+		return nil
+	}
+
+	for _, request := range requests {
+		pk, err := base64.RawURLEncoding.DecodeString(request.ContactPublicKey)
+		if err != nil {
+			return errcode.ErrDeserialization.Wrap(err)
+		}
+
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(fmt.Sprintf("%s %s, deferred %s", base64.StdEncoding.EncodeToString(pk), request.DisplayName, time.UnixMilli(request.ReceivedDate).Format(time.Stamp))),
+		})
+	}
+
+	return nil
+}
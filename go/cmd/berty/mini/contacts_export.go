@@ -0,0 +1,135 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"berty.tech/berty/v2/go/internal/groupkeys"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// exportedContact is a line of the contact list written by
+// contactsExportCommand.
+type exportedContact struct {
+	ShortPK     string `json:"short_pk"`
+	PublicKey   string `json:"public_key"`
+	DisplayName string `json:"display_name"`
+	State       string `json:"state"`
+	// Verified is true when the chain keys of the contact group were
+	// exchanged with every device of the contact, see /keys.
+	Verified bool `json:"verified"`
+}
+
+var exportedContactHeader = []string{"short_pk", "public_key", "display_name", "state", "verified"}
+
+// contactsExportCommand writes the contact list to a CSV file, or a JSON one
+// for the other extensions. The public keys are the ones expected by the
+// /contact commands, the address-book command of the daemon exports the
+// links of the contacts as well.
+func contactsExportCommand(ctx context.Context, v *groupView, path string) error {
+	if path == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /contacts export <path.csv|path.json>"))
+	}
+
+	contacts := listContactsForExport(ctx, v.v)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		w := csv.NewWriter(f)
+		_ = w.Write(exportedContactHeader)
+		for _, c := range contacts {
+			_ = w.Write([]string{c.ShortPK, c.PublicKey, c.DisplayName, c.State, yesNo(c.Verified)})
+		}
+		w.Flush()
+		err = w.Error()
+	} else {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(contacts)
+	}
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(fmt.Sprintf("%d contact(s) exported to %s", len(contacts), path)),
+	})
+
+	return nil
+}
+
+// listContactsForExport returns the known contacts, but the removed ones,
+// sorted by display name.
+func listContactsForExport(ctx context.Context, v *tabbedGroupsView) []*exportedContact {
+	type contactEntry struct {
+		pk          []byte
+		state       protocoltypes.ContactState
+		requestName string
+	}
+
+	v.lock.RLock()
+	entries := []*contactEntry{}
+	for pk, state := range v.contactStates {
+		if state == protocoltypes.ContactStateRemoved {
+			continue
+		}
+		entries = append(entries, &contactEntry{pk: []byte(pk), state: state, requestName: v.contactRequests[pk].name})
+	}
+	v.lock.RUnlock()
+
+	contacts := make([]*exportedContact, 0, len(entries))
+	for _, e := range entries {
+		c := &exportedContact{
+			ShortPK:     pkAsShortID(e.pk),
+			PublicKey:   base64.StdEncoding.EncodeToString(e.pk),
+			DisplayName: e.requestName,
+			State:       strings.TrimPrefix(e.state.String(), "ContactState"),
+		}
+
+		// the names and the keys are known by contact group
+		if info, err := v.protocol.GroupInfo(ctx, &protocoltypes.GroupInfo_Request{ContactPK: e.pk}); err == nil {
+			groupPK := info.GetGroup().GetPublicKey()
+
+			v.lock.RLock()
+			if name := v.contactNames[string(groupPK)]; name != "" {
+				c.DisplayName = name
+			}
+			v.lock.RUnlock()
+
+			if e.state == protocoltypes.ContactStateAdded {
+				if report, err := groupkeys.Status(ctx, v.protocol, groupPK); err == nil {
+					c.Verified = report.KeysExchanged()
+				}
+			}
+		}
+
+		contacts = append(contacts, c)
+	}
+
+	sort.Slice(contacts, func(i, j int) bool {
+		if contacts[i].DisplayName != contacts[j].DisplayName {
+			return contacts[i].DisplayName < contacts[j].DisplayName
+		}
+		return contacts[i].PublicKey < contacts[j].PublicKey
+	})
+
+	return contacts
+}
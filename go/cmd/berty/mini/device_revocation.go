@@ -0,0 +1,30 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// deviceRevokeCommand asks a lost device of the account to delete its
+// account data the next time it connects.
+func deviceRevokeCommand(ctx context.Context, v *groupView, cmd string) error {
+	devicePK := strings.TrimSpace(cmd)
+	if devicePK == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /device revoke <device pk>"))
+	}
+
+	if _, err := v.v.messenger.RevokeDevice(ctx, &messengertypes.RevokeDevice_Request{DevicePublicKey: devicePK}); err != nil {
+		return err
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte("revocation sent, the device will delete its account data the next time it connects"),
+	})
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// draftTimeout bounds a call to the messenger.
+const draftTimeout = 5 * time.Second
+
+// draftOp saves or loads the draft of a group in the messenger of its
+// account.
+type draftOp struct {
+	client  messengertypes.MessengerServiceClient
+	groupPK []byte
+	save    bool
+	text    string
+}
+
+// draftKeeper keeps a draft per group: the input is saved when leaving a
+// group and replaced by the draft of the displayed one. The drafts are kept
+// in memory and in the messenger, so that the clients of a daemon share
+// their drafts, the calls to the messenger are made in order by run.
+type draftKeeper struct {
+	accounts *accountManager
+
+	mu       sync.Mutex
+	disabled bool
+	texts    map[string]string
+	pending  []draftOp
+	wake     chan struct{}
+}
+
+func newDraftKeeper(accounts *accountManager) *draftKeeper {
+	return &draftKeeper{
+		accounts: accounts,
+		texts:    map[string]string{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// switchGroup saves the input as the draft of left and replaces it by the
+// draft of shown, either can be nil. It is called from the UI goroutine.
+func (k *draftKeeper) switchGroup(left, shown *groupView) {
+	input := k.accounts.input
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if left != nil {
+		text := input.GetText()
+		k.texts[string(left.g.PublicKey)] = text
+		k.queue(left.g, draftOp{groupPK: left.g.PublicKey, save: true, text: text})
+	}
+
+	text := ""
+	if shown != nil {
+		text = k.texts[string(shown.g.PublicKey)]
+		// another client of the daemon may have edited it
+		k.queue(shown.g, draftOp{groupPK: shown.g.PublicKey, text: text})
+	}
+	input.SetText(text)
+}
+
+// queue adds op to the calls to make to the messenger of the current
+// account, the groups which are not conversations, e.g. the account group,
+// are only kept in memory.
+func (k *draftKeeper) queue(g *protocoltypes.Group, op draftOp) {
+	current := k.accounts.Current()
+	if k.disabled || current == nil || g.GroupType == protocoltypes.GroupTypeAccount {
+		return
+	}
+
+	op.client = current.messenger
+
+	k.pending = append(k.pending, op)
+	select {
+	case k.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (k *draftKeeper) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-k.wake:
+		}
+
+		for {
+			k.mu.Lock()
+			if len(k.pending) == 0 || k.disabled {
+				k.pending = nil
+				k.mu.Unlock()
+				break
+			}
+			op := k.pending[0]
+			k.pending = k.pending[1:]
+			k.mu.Unlock()
+
+			k.apply(ctx, op)
+		}
+	}
+}
+
+func (k *draftKeeper) apply(ctx context.Context, op draftOp) {
+	ctx, cancel := context.WithTimeout(ctx, draftTimeout)
+	defer cancel()
+
+	conversationPK := base64.RawURLEncoding.EncodeToString(op.groupPK)
+
+	if op.save {
+		_, err := op.client.SaveDraft(ctx, &messengertypes.SaveDraft_Request{ConversationPublicKey: conversationPK, Text: op.text})
+		k.failed(err)
+		return
+	}
+
+	reply, err := op.client.GetDraft(ctx, &messengertypes.GetDraft_Request{ConversationPublicKey: conversationPK})
+	if err != nil {
+		k.failed(err)
+		return
+	}
+
+	text := reply.GetDraft().GetText()
+	if text == op.text {
+		return
+	}
+
+	k.accounts.app.QueueUpdateDraw(func() {
+		k.loaded(op, text)
+	})
+}
+
+// loaded replaces the input by the stored draft, if the group is still
+// displayed and the input was not edited since it was.
+func (k *draftKeeper) loaded(op draftOp, text string) {
+	current := k.accounts.Current()
+	if current == nil {
+		return
+	}
+
+	current.view.lock.RLock()
+	displayed := current.view.displayedGroupView
+	current.view.lock.RUnlock()
+	if displayed == nil || string(displayed.g.PublicKey) != string(op.groupPK) {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.accounts.input.GetText() != op.text {
+		return
+	}
+
+	k.texts[string(op.groupPK)] = text
+	k.accounts.input.SetText(text)
+}
+
+// failed logs a failed call to the messenger, the drafts are only kept in
+// memory if it does not keep them, e.g. an older daemon.
+func (k *draftKeeper) failed(err error) {
+	if err == nil {
+		return
+	}
+
+	if errcode.Is(err, errcode.ErrNotImplemented) || status.Code(err) == codes.Unimplemented {
+		k.mu.Lock()
+		k.disabled = true
+		k.mu.Unlock()
+	}
+
+	if logger := k.accounts.opts.Logger; logger != nil {
+		logger.Warn("unable to sync draft", zap.Error(err))
+	}
+}
+
+// flush saves the input as the draft of the displayed group, after the
+// saves still pending. It is called once mini exits.
+func (k *draftKeeper) flush(view *tabbedGroupsView) {
+	view.lock.RLock()
+	displayed := view.displayedGroupView
+	view.lock.RUnlock()
+
+	k.mu.Lock()
+	if displayed != nil {
+		k.queue(displayed.g, draftOp{groupPK: displayed.g.PublicKey, save: true, text: k.accounts.input.GetText()})
+	}
+	pending, disabled := k.pending, k.disabled
+	k.pending = nil
+	k.mu.Unlock()
+
+	if disabled {
+		return
+	}
+
+	for _, op := range pending {
+		if op.save {
+			k.apply(context.Background(), op)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+const ephemeralRefreshInterval = time.Second
+
+// ephemeralBanner is the bar on top of the history of an ephemeral account,
+// it warns that nothing is saved and counts down the time left. mini exits
+// when the account expires.
+type ephemeralBanner struct {
+	app       *tview.Application
+	view      *tview.TextView
+	expiresAt time.Time
+}
+
+func newEphemeralBanner(app *tview.Application, expiresAt time.Time) *ephemeralBanner {
+	view := tview.NewTextView().SetTextAlign(tview.AlignCenter)
+	view.SetTextColor(tcell.ColorWhite)
+	view.SetBackgroundColor(tcell.ColorDarkMagenta)
+
+	b := &ephemeralBanner{app: app, view: view, expiresAt: expiresAt}
+	view.SetText(b.text(time.Now()))
+
+	return b
+}
+
+func (b *ephemeralBanner) text(now time.Time) string {
+	left := b.expiresAt.Sub(now)
+	if left < 0 {
+		left = 0
+	}
+
+	return fmt.Sprintf("EPHEMERAL ACCOUNT: nothing is saved, the account and its messages are discarded on exit or in %s (at %s)",
+		left.Round(time.Second), b.expiresAt.Format("15:04"))
+}
+
+// attachTo adds the banner on top of layout.
+func (b *ephemeralBanner) attachTo(layout *tview.Flex) {
+	layout.AddItem(b.view, 1, 0, false)
+}
+
+func (b *ephemeralBanner) run(ctx context.Context) {
+	ticker := time.NewTicker(ephemeralRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if !now.Before(b.expiresAt) {
+				globalLogger.Info("the ephemeral account expired")
+				b.app.Stop()
+				return
+			}
+
+			text := b.text(now)
+			b.app.QueueUpdateDraw(func() {
+				b.view.SetText(text)
+			})
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+
+	"berty.tech/berty/v2/go/internal/groupkeys"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func keysStatusCommand(ctx context.Context, v *groupView, _ string) error {
+	report, err := groupkeys.Status(ctx, v.v.protocol, v.g.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	if len(report.Devices) == 0 {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("no other device in this group"),
+		})
+		return nil
+	}
+
+	for _, d := range report.Devices {
+		owner := "member " + pkAsShortID(d.MemberPK)
+		if d.Self {
+			owner = "own device"
+		}
+
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			sender:      d.DevicePK,
+			payload:     []byte(fmt.Sprintf("%s: key sent: %s, key received: %s", owner, yesNo(d.KeySent), yesNo(d.KeyReceived))),
+		})
+	}
+
+	if unhealthy := report.Unhealthy(); len(unhealthy) > 0 {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(fmt.Sprintf("%d device(s) missing a key, type /rekey to exchange the keys again", len(unhealthy))),
+		})
+	}
+
+	return nil
+}
+
+func rekeyCommand(ctx context.Context, v *groupView, _ string) error {
+	if _, err := v.v.messenger.RekeyGroup(ctx, &messengertypes.RekeyGroup_Request{GroupPK: v.g.PublicKey}); err != nil {
+		return err
+	}
+
+	// the group streams of mini ended with the rekey
+	return v.v.accounts.Reload()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,124 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/benbjohnson/clock"
+	"github.com/rivo/tview"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/groupprofile"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+func handleGroupProfileEvent(v *groupView, e *protocoltypes.GroupMetadataEvent, isHistory bool, logger *zap.Logger) {
+	v.muAggregates.Lock()
+	changed, err := v.profile.HandleEvent(e)
+	profile := v.profile.Profile()
+	v.muAggregates.Unlock()
+
+	if err != nil {
+		logger.Warn("ignored group profile update", zap.Error(err))
+		addToBuffer(&historyMessage{
+			messageType: messageTypeError,
+			payload:     []byte(fmt.Sprintf("ignored group profile update: %s", err.Error())),
+		}, v, isHistory)
+		return
+	}
+
+	if !changed {
+		return
+	}
+
+	v.header.SetText(groupProfileHeader(profile))
+	go v.v.app.Draw()
+
+	addToBuffer(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(fmt.Sprintf("group profile updated: %s", groupProfileSummary(profile))),
+	}, v, isHistory)
+}
+
+func groupProfileHeader(p groupprofile.Profile) string {
+	parts := []string(nil)
+	if p.Topic != "" {
+		parts = append(parts, fmt.Sprintf("[::b]%s[::-]", tview.Escape(p.Topic)))
+	}
+	if p.Description != "" {
+		// the header is a single line
+		description := strings.SplitN(p.Description, "\n", 2)[0]
+		parts = append(parts, tview.Escape(description))
+	}
+	if p.AvatarCID != "" {
+		parts = append(parts, fmt.Sprintf("[::d]avatar: %s[::-]", tview.Escape(p.AvatarCID)))
+	}
+
+	if len(parts) == 0 {
+		return "[::d]no topic[::-]"
+	}
+
+	return strings.Join(parts, " — ")
+}
+
+func groupProfileSummary(p groupprofile.Profile) string {
+	return fmt.Sprintf("topic: %q, description: %q, avatar: %q", p.Topic, p.Description, p.AvatarCID)
+}
+
+func groupProfileCommand(field string) func(ctx context.Context, v *groupView, cmd string) error {
+	return func(ctx context.Context, v *groupView, cmd string) error {
+		if v.g.GroupType != protocoltypes.GroupTypeMultiMember {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("only multi-member groups have a profile"))
+		}
+
+		// the updates of the other members are ignored by the group
+		v.muAggregates.Lock()
+		allowed := v.profile.CanUpdate(v.memberPK)
+		v.muAggregates.Unlock()
+		if !allowed {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("only the admins of the group can change its %s", field))
+		}
+
+		value := strings.TrimSpace(cmd)
+		update := groupprofile.Update{}
+		switch field {
+		case "topic":
+			update.Topic = &value
+		case "description":
+			update.Description = &value
+		case "avatar":
+			update.AvatarCID = &value
+		}
+
+		return groupprofile.Send(ctx, v.v.protocol, clock.New(), v.g.PublicKey, update)
+	}
+}
+
+// topicCommand shows the topic of the current group, or sets it when a text
+// is given.
+func topicCommand(ctx context.Context, v *groupView, cmd string) error {
+	if cmd != "" {
+		return groupProfileCommand("topic")(ctx, v, cmd)
+	}
+
+	if v.g.GroupType != protocoltypes.GroupTypeMultiMember {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("only multi-member groups have a topic"))
+	}
+
+	v.muAggregates.Lock()
+	topic := v.profile.Profile().Topic
+	v.muAggregates.Unlock()
+
+	line := fmt.Sprintf("topic: %q", topic)
+	if topic == "" {
+		line = "the group has no topic"
+	}
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(line),
+	})
+
+	return nil
+}
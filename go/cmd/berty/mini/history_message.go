@@ -10,6 +10,11 @@ const (
 	messageTypeMeta messageType = iota + 1
 	messageTypeMessage
 	messageTypeError
+	// messageTypeDivider separates the unread messages, it is not rendered
+	// by the message template.
+	messageTypeDivider
+	// messageTypeTrace is a protocol event shown with /trace on.
+	messageTypeTrace
 )
 
 type historyMessage struct {
@@ -17,6 +22,15 @@ type historyMessage struct {
 	sender      []byte
 	receivedAt  time.Time
 	payload     []byte
+	// cid identifies the interaction of a user message.
+	cid string
+	// edited is set when the message edits an earlier one.
+	edited *messageEdit
+	// unsent is the /resend number of a message which was not sent or not
+	// acknowledged.
+	unsent int
+	// starred is set when the message is bookmarked with /star.
+	starred bool
 }
 
 func (h *historyMessage) Text() string {
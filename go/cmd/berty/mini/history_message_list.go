@@ -1,7 +1,9 @@
 package mini
 
 import (
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gdamore/tcell"
@@ -11,14 +13,45 @@ import (
 type historyMessageList struct {
 	lock          sync.RWMutex
 	historyScroll *tview.Table
-	app           *tview.Application
+	redraws       *redrawThrottle
+	template      *messageTemplate
+	options       renderOptions
+
+	// width is the width the messages are wrapped for, 0 until the list is
+	// drawn. drawnWidth is the width of the last draw, the messages are
+	// reflowed when they differ.
+	width      int
+	drawnWidth int32
+	// prefixWidths are the widths of the columns before the text, the
+	// wrapped lines of a message are aligned under its text.
+	prefixWidths []int
 }
 
-func newHistoryMessageList(app *tview.Application) *historyMessageList {
-	return &historyMessageList{
+// continuationRow is the reference of the rows displaying the wrapped lines
+// of a message after its first row, which references the message.
+type continuationRow struct{}
+
+// minWrapWidth is the width of the text column under which the messages are
+// not wrapped, the table is too narrow to show them anyway.
+const minWrapWidth = 10
+
+func newHistoryMessageList(redraws *redrawThrottle, template *messageTemplate) *historyMessageList {
+	h := &historyMessageList{
 		historyScroll: tview.NewTable(),
-		app:           app,
+		redraws:       redraws,
+		template:      template,
 	}
+
+	h.historyScroll.SetDrawFunc(func(_ tcell.Screen, x, y, width, height int) (int, int, int, int) {
+		if atomic.SwapInt32(&h.drawnWidth, int32(width)) != int32(width) {
+			go h.reflow()
+		}
+
+		// the table has no border
+		return x, y, width, height
+	})
+
+	return h
 }
 
 func (h *historyMessageList) View() *tview.Table {
@@ -47,35 +80,559 @@ func (h *historyMessageList) Append(m *historyMessage) {
 		m.receivedAt = time.Now()
 	}
 
-	row := h.historyScroll.GetRowCount()
-	h.historyScroll.SetCellSimple(row, 0, m.Timestamp())
-	h.historyScroll.SetCellSimple(row, 1, m.Sender())
-	h.historyScroll.SetCellSimple(row, 2, m.Text())
+	cells := h.cells(m)
+	grown := h.measure(cells)
+	h.setRows(h.historyScroll.GetRowCount(), m, h.wrap(cells))
 
-	for i := 0; i < 3; i++ {
-		cell := h.historyScroll.GetCell(row, i)
-		if m.messageType == messageTypeError {
-			cell.SetTextColor(tcell.ColorOrangeRed)
-		} else if m.messageType == messageTypeMeta {
-			cell.SetTextColor(tcell.ColorLimeGreen)
-		}
+	if grown {
+		// the text column got narrower
+		h.rerender(func(*historyMessage) bool { return true })
 	}
 
 	h.historyScroll.ScrollToEnd()
-	go h.app.Draw()
+	h.redraws.Request()
 }
 
 func (h *historyMessageList) Prepend(m *historyMessage, receivedAt time.Time) {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
-	if receivedAt.IsZero() {
+	if !receivedAt.IsZero() {
+		m.receivedAt = receivedAt
+	} else if m.receivedAt.IsZero() {
 		m.receivedAt = time.Now()
 	}
 
-	h.historyScroll.InsertRow(0)
-	h.historyScroll.SetCellSimple(0, 0, m.Timestamp())
-	h.historyScroll.SetCellSimple(0, 1, m.Sender())
-	h.historyScroll.SetCellSimple(0, 2, m.Text())
-	go h.app.Draw()
+	cells := h.cells(m)
+	grown := h.measure(cells)
+	rows := h.wrap(cells)
+	for range rows {
+		h.historyScroll.InsertRow(0)
+	}
+	h.setRows(0, m, rows)
+
+	if grown {
+		h.rerender(func(*historyMessage) bool { return true })
+	}
+
+	h.redraws.Request()
+}
+
+// InsertBefore displays m above the rows of before, it returns false when
+// before is not displayed. The view scrolls to m.
+func (h *historyMessageList) InsertBefore(m, before *historyMessage) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for row := 0; row < h.historyScroll.GetRowCount(); row++ {
+		if h.messageAt(row) != before {
+			continue
+		}
+
+		cells := h.cells(m)
+		grown := h.measure(cells)
+		rows := h.wrap(cells)
+		for range rows {
+			h.historyScroll.InsertRow(row)
+		}
+		h.setRows(row, m, rows)
+
+		if grown {
+			h.rerender(func(*historyMessage) bool { return true })
+		}
+
+		h.historyScroll.SetOffset(row, 0)
+		h.redraws.Request()
+		return true
+	}
+
+	return false
+}
+
+// SetHideDiffs switches the edits between their diff and their new text.
+func (h *historyMessageList) SetHideDiffs(hide bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.options.hideDiffs == hide {
+		return
+	}
+	h.options.hideDiffs = hide
+
+	h.rerender(func(m *historyMessage) bool { return m.edited != nil })
+}
+
+// SetMasked masks or reveals the text of the messages.
+func (h *historyMessageList) SetMasked(masked bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.options.masked == masked {
+		return
+	}
+	h.options.masked = masked
+
+	h.rerender(func(m *historyMessage) bool { return m.messageType == messageTypeMessage })
+}
+
+// IsMasked returns true if the text of the messages is masked.
+func (h *historyMessageList) IsMasked() bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return h.options.masked
+}
+
+// SetUnsent flags m for /resend, or unflags it when n is 0.
+func (h *historyMessageList) SetUnsent(m *historyMessage, n int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	m.unsent = n
+	h.rerender(func(other *historyMessage) bool { return other == m })
+}
+
+// SetStarred flags m as bookmarked, or unflags it.
+func (h *historyMessageList) SetStarred(m *historyMessage, starred bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	m.starred = starred
+	h.rerender(func(other *historyMessage) bool { return other == m })
+}
+
+// SetText replaces the text of m, e.g. the results of a poll.
+func (h *historyMessageList) SetText(m *historyMessage, text string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	m.payload = []byte(text)
+	h.rerender(func(other *historyMessage) bool { return other == m })
+}
+
+// Remove removes the rows displaying m.
+func (h *historyMessageList) Remove(m *historyMessage) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for row := 0; row < h.historyScroll.GetRowCount(); row++ {
+		if h.messageAt(row) == m {
+			for n := h.span(row); n > 0; n-- {
+				h.historyScroll.RemoveRow(row)
+			}
+			h.redraws.Request()
+			return
+		}
+	}
+}
+
+// rerender renders again the messages matching filter, the lock must be
+// held.
+func (h *historyMessageList) rerender(filter func(m *historyMessage) bool) {
+	for row := 0; row < h.historyScroll.GetRowCount(); row++ {
+		m := h.messageAt(row)
+		if m == nil || !filter(m) {
+			continue
+		}
+
+		rows := h.wrap(h.cells(m))
+		for n := h.span(row); n > len(rows); n-- {
+			h.historyScroll.RemoveRow(row)
+		}
+		for n := h.span(row); n < len(rows); n++ {
+			h.historyScroll.InsertRow(row + 1)
+		}
+		h.setRows(row, m, rows)
+		row += len(rows) - 1
+	}
+
+	h.redraws.Request()
+}
+
+// reflow wraps again all the messages for the width of the last draw.
+func (h *historyMessageList) reflow() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	width := int(atomic.LoadInt32(&h.drawnWidth))
+	if width == h.width {
+		return
+	}
+	h.width = width
+
+	// a removed message may have been the widest one
+	h.prefixWidths = nil
+	for row := 0; row < h.historyScroll.GetRowCount(); row++ {
+		if m := h.messageAt(row); m != nil {
+			h.measure(h.cells(m))
+		}
+	}
+
+	h.rerender(func(*historyMessage) bool { return true })
+}
+
+// cells returns the table cells of m, a divider only has its text, under
+// the one of the messages. The lock must be held.
+func (h *historyMessageList) cells(m *historyMessage) []string {
+	if m.messageType != messageTypeDivider {
+		return h.template.render(m, h.options)
+	}
+
+	return append(make([]string, len(h.prefixWidths)), tview.Escape(m.Text()))
+}
+
+// measure updates the widths of the columns before the text with the cells
+// of a message, it returns true if one of them grew. The lock must be held.
+func (h *historyMessageList) measure(cells []string) bool {
+	grown := false
+	for i, text := range cells[:len(cells)-1] {
+		if i == len(h.prefixWidths) {
+			h.prefixWidths = append(h.prefixWidths, 0)
+		}
+
+		if width := tview.TaggedStringWidth(text); width > h.prefixWidths[i] {
+			h.prefixWidths[i] = width
+			grown = true
+		}
+	}
+
+	return grown && h.width > 0
+}
+
+// wrap splits the text of a message, its last cell, into the rows
+// displaying it. The following rows only have the text, the prefix cells
+// are empty for the text to be aligned under the one of the first row. The
+// lock must be held.
+func (h *historyMessageList) wrap(cells []string) [][]string {
+	last := len(cells) - 1
+
+	// Table.Draw separates the columns with a space and needs one more
+	// column of margin to draw the last one
+	width := h.width - last - 1
+	for i, prefixWidth := range h.prefixWidths {
+		if i < last {
+			width -= prefixWidth
+		}
+	}
+	if h.width == 0 || width < minWrapWidth {
+		width = 0
+	}
+
+	lines := wrapText(cells[last], width)
+	for i, line := range lines {
+		if isCodeLine(line) {
+			lines[i] = scrollCodeLine(line, h.options.codeOffset, width)
+		}
+	}
+	rows := [][]string{append(cells[:last:last], lines[0])}
+	for _, line := range lines[1:] {
+		row := make([]string, last+1)
+		row[last] = line
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// setRows sets the cells of the rows displaying m from row, the rows must
+// exist. The lock must be held.
+func (h *historyMessageList) setRows(row int, m *historyMessage, rows [][]string) {
+	for i, cells := range rows {
+		for col, text := range cells {
+			h.historyScroll.SetCellSimple(row+i, col, text)
+
+			cell := h.historyScroll.GetCell(row+i, col)
+			if m.messageType == messageTypeError {
+				cell.SetTextColor(tcell.ColorOrangeRed)
+			} else if m.messageType == messageTypeMeta {
+				cell.SetTextColor(tcell.ColorLimeGreen)
+			} else if m.messageType == messageTypeDivider {
+				cell.SetTextColor(tcell.ColorYellow)
+			} else if m.messageType == messageTypeTrace {
+				cell.SetTextColor(tcell.ColorGray).SetAttributes(tcell.AttrDim)
+			}
+		}
+
+		if i == 0 {
+			h.historyScroll.GetCell(row, 0).SetReference(m)
+		} else {
+			h.historyScroll.GetCell(row+i, 0).SetReference(continuationRow{})
+		}
+	}
+}
+
+// span returns the number of rows displaying the message of row. The lock
+// must be held.
+func (h *historyMessageList) span(row int) int {
+	n := 1
+	for row+n < h.historyScroll.GetRowCount() {
+		if _, ok := h.historyScroll.GetCell(row+n, 0).GetReference().(continuationRow); !ok {
+			break
+		}
+		n++
+	}
+
+	return n
+}
+
+// wrapText splits text on its new lines and between its words for the lines
+// not to be wider than width, words wider than width are split. The text
+// may contain style tags. Only the new lines are split when width is 0, the
+// lines of the code blocks are never wrapped.
+func wrapText(text string, width int) []string {
+	lines := []string{}
+	for _, paragraph := range strings.Split(text, "\n") {
+		if width <= 0 || isCodeLine(paragraph) {
+			lines = append(lines, paragraph)
+			continue
+		}
+
+		line, lineWidth, started := "", 0, false
+		for _, word := range strings.Split(paragraph, " ") {
+			wordWidth := tview.TaggedStringWidth(word)
+			if started && lineWidth+1+wordWidth > width {
+				lines = append(lines, line)
+				line, lineWidth, started = "", 0, false
+			}
+
+			for wordWidth > width {
+				var head string
+				head, word = splitTaggedString(word, width)
+				lines = append(lines, head)
+				wordWidth = tview.TaggedStringWidth(word)
+			}
+
+			if started {
+				line += " "
+				lineWidth++
+			}
+			line += word
+			lineWidth += wordWidth
+			started = true
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// splitTaggedString splits s after the last rune which fits in width,
+// without cutting a style tag.
+func splitTaggedString(s string, width int) (string, string) {
+	cut := 0
+	for i := range s {
+		if i > 0 && tview.TaggedStringWidth(s[:i]) > width {
+			break
+		}
+		cut = i
+	}
+	if tview.TaggedStringWidth(s) <= width {
+		cut = len(s)
+	}
+
+	// do not cut inside brackets, they may be a tag
+	if open := strings.LastIndex(s[:cut], "["); open > strings.LastIndex(s[:cut], "]") {
+		cut = open
+	}
+	if cut == 0 {
+		return s, ""
+	}
+
+	return s[:cut], s[cut:]
+}
+
+// RowsFromEnd returns the scroll position counted from the last row.
+func (h *historyMessageList) RowsFromEnd() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	row, _ := h.historyScroll.GetOffset()
+	return h.historyScroll.GetRowCount() - row
+}
+
+// ScrollToRowsFromEnd restores a scroll position returned by RowsFromEnd.
+func (h *historyMessageList) ScrollToRowsFromEnd(rows int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	row := h.historyScroll.GetRowCount() - rows
+	if row < 0 {
+		row = 0
+	}
+
+	h.historyScroll.SetOffset(row, 0)
+	h.redraws.Request()
+}
+
+// messageAt returns the history message displayed at the given row, if any.
+func (h *historyMessageList) messageAt(row int) *historyMessage {
+	m, _ := h.historyScroll.GetCell(row, 0).GetReference().(*historyMessage)
+	return m
+}
+
+// OldestMessage returns the oldest user message displayed, or nil when there
+// are none.
+func (h *historyMessageList) OldestMessage() *historyMessage {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	oldest := (*historyMessage)(nil)
+	for row := 0; row < h.historyScroll.GetRowCount(); row++ {
+		m := h.messageAt(row)
+		if m == nil || m.messageType != messageTypeMessage {
+			continue
+		}
+
+		if oldest == nil || m.receivedAt.Before(oldest.receivedAt) {
+			oldest = m
+		}
+	}
+
+	return oldest
+}
+
+// JumpToDate scrolls the view to the first message received on the given
+// day, or to the first one received after it when there are none. Only the
+// loaded messages are searched, see groupView.loadHistoryUntil.
+func (h *historyMessageList) JumpToDate(day time.Time) (*historyMessage, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+
+	found, foundRow := (*historyMessage)(nil), -1
+	for row := 0; row < h.historyScroll.GetRowCount(); row++ {
+		m := h.messageAt(row)
+		if m == nil || m.messageType != messageTypeMessage || m.receivedAt.Before(start) {
+			continue
+		}
+
+		if found == nil || m.receivedAt.Before(found.receivedAt) {
+			found, foundRow = m, row
+		}
+	}
+
+	if found == nil {
+		return nil, false
+	}
+
+	h.historyScroll.SetOffset(foundRow, 0)
+	h.redraws.Request()
+
+	return found, true
+}
+
+// FindMessage returns the user message of the interaction cid, or nil when
+// it is not loaded.
+func (h *historyMessageList) FindMessage(cid string) *historyMessage {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	for row := 0; row < h.historyScroll.GetRowCount(); row++ {
+		if m := h.messageAt(row); m != nil && m.cid == cid && m.messageType == messageTypeMessage {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// JumpToMessage scrolls the view to the user message of the interaction
+// cid, it returns false when the message is not loaded.
+func (h *historyMessageList) JumpToMessage(cid string) (*historyMessage, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for row := 0; row < h.historyScroll.GetRowCount(); row++ {
+		m := h.messageAt(row)
+		if m == nil || m.cid != cid || m.messageType != messageTypeMessage {
+			continue
+		}
+
+		h.historyScroll.SetOffset(row, 0)
+		h.redraws.Request()
+		return m, true
+	}
+
+	return nil, false
+}
+
+// SelectLast starts selecting the user messages from the last one, it
+// returns false when there are none.
+func (h *historyMessageList) SelectLast() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	row := h.selectableRow(h.historyScroll.GetRowCount()-1, -1)
+	if row < 0 {
+		return false
+	}
+
+	h.historyScroll.SetSelectable(true, false)
+	h.historyScroll.Select(row, 0)
+	h.redraws.Request()
+
+	return true
+}
+
+// LastMessage returns the n-th user message from the end, the last one for
+// 1, or nil.
+func (h *historyMessageList) LastMessage(n int) *historyMessage {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	row := h.historyScroll.GetRowCount()
+	for ; n > 0; n-- {
+		if row = h.selectableRow(row-1, -1); row < 0 {
+			return nil
+		}
+	}
+
+	return h.messageAt(row)
+}
+
+// MoveSelection selects the step-th user message after the selected one.
+func (h *historyMessageList) MoveSelection(step int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	current, _ := h.historyScroll.GetSelection()
+	if row := h.selectableRow(current+step, step); row >= 0 {
+		h.historyScroll.Select(row, 0)
+		h.redraws.Request()
+	}
+}
+
+// Selected returns the selected user message, if any.
+func (h *historyMessageList) Selected() *historyMessage {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	if selectable, _ := h.historyScroll.GetSelectable(); !selectable {
+		return nil
+	}
+
+	row, _ := h.historyScroll.GetSelection()
+	return h.messageAt(row)
+}
+
+// ClearSelection stops selecting the messages.
+func (h *historyMessageList) ClearSelection() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.historyScroll.SetSelectable(false, false)
+	h.redraws.Request()
+}
+
+// selectableRow returns the first row displaying a user message from row,
+// moving by step, or -1. The lock must be held.
+func (h *historyMessageList) selectableRow(row int, step int) int {
+	for ; row >= 0 && row < h.historyScroll.GetRowCount(); row += step {
+		if m := h.messageAt(row); m != nil && m.messageType == messageTypeMessage {
+			return row
+		}
+	}
+
+	return -1
 }
@@ -0,0 +1,150 @@
+package mini
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// historyPageSize is the number of message events loaded at once, when a
+// group is opened and when older messages are needed, e.g. by /goto.
+const historyPageSize = 500
+
+// historyPages tracks the message events of a group loaded from its
+// history, from the newest to cursor.
+type historyPages struct {
+	// cursor is the id of the oldest event loaded, nil before the first
+	// page.
+	cursor []byte
+	// complete is set once the first event of the group is loaded.
+	complete bool
+}
+
+// historyCursor returns the id of the oldest message event loaded.
+func (v *groupView) historyCursor() []byte {
+	v.muHistory.Lock()
+	defer v.muHistory.Unlock()
+
+	return v.history.cursor
+}
+
+// historyComplete returns true once the whole history of the group is
+// loaded.
+func (v *groupView) historyComplete() bool {
+	v.muHistory.Lock()
+	defer v.muHistory.Unlock()
+
+	return v.history.complete
+}
+
+// loadHistoryPage lists the message events preceding the loaded ones, up to
+// historyPageSize, and prepends them to the view. The events are listed from
+// the newest to the oldest one.
+func (v *groupView) loadHistoryPage(ctx context.Context) error {
+	v.muHistory.Lock()
+	defer v.muHistory.Unlock()
+
+	if v.history.complete {
+		return nil
+	}
+
+	req := &protocoltypes.GroupMessageList_Request{GroupPK: v.g.PublicKey, UntilNow: true}
+	if v.history.cursor != nil {
+		req = &protocoltypes.GroupMessageList_Request{GroupPK: v.g.PublicKey, UntilID: v.history.cursor}
+	}
+
+	// the list is not read to its end when the page is full
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cl, err := v.v.protocol.GroupMessageList(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for loaded := 0; loaded < historyPageSize; {
+		evt, err := cl.Recv()
+		if err == io.EOF {
+			v.history.complete = true
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// the bound may be listed
+		if bytes.Equal(evt.EventContext.ID, v.history.cursor) {
+			continue
+		}
+
+		v.history.cursor = evt.EventContext.ID
+		v.prependHistoryEvent(evt)
+		loaded++
+	}
+
+	return nil
+}
+
+// prependHistoryEvent displays a message event of the history above the
+// loaded ones.
+func (v *groupView) prependHistoryEvent(evt *protocoltypes.GroupMessageEvent) {
+	amp, am, err := messengertypes.UnmarshalAppMessage(evt.GetMessage())
+	if err != nil {
+		v.messages.Prepend(&historyMessage{
+			messageType: messageTypeMessage,
+			payload:     []byte(err.Error()),
+			sender:      evt.Headers.DevicePK,
+		}, time.Time{})
+		return
+	}
+
+	switch am.GetType() {
+	case messengertypes.AppMessage_TypeAcknowledge:
+		if !bytes.Equal(evt.Headers.DevicePK, v.devicePK) {
+			return
+		}
+		v.acks.Store(am.TargetCID, true)
+
+	case messengertypes.AppMessage_TypeUserMessage:
+		payload := amp.(*messengertypes.AppMessage_UserMessage)
+		m := &historyMessage{
+			messageType: messageTypeMessage,
+			cid:         eventCID(evt.EventContext),
+			payload:     []byte(userMessageBody(am.GetPayload(), payload.Body)),
+			sender:      evt.Headers.DevicePK,
+			receivedAt:  time.Unix(0, am.GetSentDate()*1000000),
+			starred:     v.isStarred(eventCID(evt.EventContext)),
+		}
+		if !v.trackPoll(eventCID(evt.EventContext), evt.Headers.DevicePK, &am, m) {
+			m.edited = v.trackEdit(eventCID(evt.EventContext), evt.Headers.DevicePK, &am, payload.Body)
+		}
+		v.messages.Prepend(m, time.Time{})
+
+	case messengertypes.AppMessage_TypeGroupInvitation:
+		v.receiveGroupInvitation(evt.Headers.DevicePK, &am, amp.(*messengertypes.AppMessage_GroupInvitation), true)
+	}
+}
+
+// loadHistoryUntil loads the pages of the history until a message older
+// than t is loaded, or the whole history is. It returns the number of pages
+// loaded.
+func (v *groupView) loadHistoryUntil(ctx context.Context, t time.Time) (int, error) {
+	pages := 0
+	for !v.historyComplete() {
+		if oldest := v.messages.OldestMessage(); oldest != nil && oldest.receivedAt.Before(t) {
+			break
+		}
+
+		if err := v.loadHistoryPage(ctx); err != nil {
+			return pages, errcode.ErrStreamRead.Wrap(fmt.Errorf("unable to load the history: %w", err))
+		}
+		pages++
+	}
+
+	return pages, nil
+}
@@ -0,0 +1,224 @@
+package mini
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rivo/tview"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// DefaultMessageTemplate renders messages as timestamp, sender and text
+// columns.
+const DefaultMessageTemplate = "{{.Time}}\t{{.Sender}}\t{{.Text}}"
+
+// messageTemplateData is what message templates are executed with.
+//
+// Templates output one line per message, tabs split the line into columns.
+// The last column is wrapped to the width of the view, its lines are
+// aligned under each other.
+// Text is escaped, use the markdown function to render **bold** and *italic*
+// (shown underlined, the terminal library has no italic attribute). The code
+// blocks between ``` fences are rendered on their own background, unwrapped
+// and scrolled with Shift+Left and Shift+Right. The text
+// of an edit is the diff with the edited message unless diffs are hidden,
+// the text of the messages is masked in privacy mode, and the messages to
+// /resend are prefixed with their number. The starred messages are prefixed
+// with a star.
+//
+// Besides the text/template builtins, templates can use:
+//   - pad N S, padLeft N S: pads S with spaces to N columns, left or right aligned
+//   - trunc N S: truncates S to N columns
+//   - markdown S: renders the markdown-ish emphasis of S
+//
+// e.g. `{{.ReceivedAt.Format "Jan 02 15:04"}} {{padLeft 10 .Sender}} | {{markdown .Text}}`
+type messageTemplateData struct {
+	// Time is the reception time formatted as 15:04:05.
+	Time       string
+	ReceivedAt time.Time
+	Sender     string
+	Text       string
+	// Kind is one of "message", "meta", "error" or "trace".
+	Kind   string
+	Edited bool
+	// Unsent is the /resend number of a message which was not sent or not
+	// acknowledged, 0 otherwise.
+	Unsent int
+	// Starred is set for the messages bookmarked with /star.
+	Starred bool
+}
+
+// renderOptions are the display settings of a message list.
+type renderOptions struct {
+	hideDiffs bool
+	// masked replaces the text of the messages with maskedMessageText.
+	masked bool
+	// codeOffset is the number of columns the code blocks are scrolled by.
+	codeOffset int
+	// accessible writes the signals conveyed by the colors, e.g. the kind
+	// of the errors and the words changed by an edit, see Opts.Accessible.
+	accessible bool
+}
+
+// maskedMessageText does not depend on the length of the masked text.
+const maskedMessageText = "■■■■"
+
+type messageTemplate struct {
+	tmpl *template.Template
+}
+
+var (
+	markdownBoldPattern   = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	markdownItalicPattern = regexp.MustCompile(`(^|[^*\w])[*_]([^*_\n]+)[*_]($|[^*\w])`)
+)
+
+var messageTemplateFuncs = template.FuncMap{
+	"pad": func(width int, s string) string {
+		if missing := width - tview.TaggedStringWidth(s); missing > 0 {
+			return s + strings.Repeat(" ", missing)
+		}
+		return s
+	},
+	"padLeft": func(width int, s string) string {
+		if missing := width - tview.TaggedStringWidth(s); missing > 0 {
+			return strings.Repeat(" ", missing) + s
+		}
+		return s
+	},
+	"trunc": func(width int, s string) string {
+		runes := []rune(s)
+		if width >= 0 && len(runes) > width {
+			return string(runes[:width])
+		}
+		return s
+	},
+	"markdown": renderMarkdown,
+}
+
+// renderMarkdown converts **bold** and *italic* (or _italic_) spans of an
+// escaped text into tview style tags, the code blocks are left as is.
+func renderMarkdown(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if isCodeLine(line) {
+			continue
+		}
+
+		line = markdownBoldPattern.ReplaceAllString(line, "[::b]${1}[::-]")
+		lines[i] = markdownItalicPattern.ReplaceAllString(line, "${1}[::u]${2}[::-]${3}")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func parseMessageTemplate(text string) (*messageTemplate, error) {
+	if text == "" {
+		text = DefaultMessageTemplate
+	}
+
+	tmpl, err := template.New("message").Funcs(messageTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid message template: %w", err))
+	}
+
+	// catch execution errors, like unknown fields, before starting the UI
+	t := &messageTemplate{tmpl: tmpl}
+	if _, err := t.execute(&historyMessage{messageType: messageTypeMessage, receivedAt: time.Now(), payload: []byte("*test*")}, renderOptions{}); err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid message template: %w", err))
+	}
+
+	return t, nil
+}
+
+func (t *messageTemplate) execute(m *historyMessage, opts renderOptions) ([]string, error) {
+	kind := "message"
+	switch m.messageType {
+	case messageTypeMeta:
+		kind = "meta"
+	case messageTypeError:
+		kind = "error"
+	case messageTypeTrace:
+		kind = "trace"
+	}
+
+	buf := bytes.Buffer{}
+	if err := t.tmpl.Execute(&buf, &messageTemplateData{
+		Time:       m.Timestamp(),
+		ReceivedAt: m.receivedAt,
+		Sender:     tview.Escape(m.Sender()),
+		Text:       renderMessageText(m, opts),
+		Kind:       kind,
+		Edited:     m.edited != nil,
+		Unsent:     m.unsent,
+		Starred:    m.starred,
+	}); err != nil {
+		return nil, err
+	}
+
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\t"), nil
+}
+
+// render returns the table cells of a message, the default columns are used
+// when the template fails.
+func (t *messageTemplate) render(m *historyMessage, opts renderOptions) []string {
+	if t != nil {
+		if cells, err := t.execute(m, opts); err == nil {
+			return cells
+		}
+	}
+
+	return []string{m.Timestamp(), tview.Escape(m.Sender()), renderMessageText(m, opts)}
+}
+
+// renderMessageText returns the escaped text of a message.
+func renderMessageText(m *historyMessage, opts renderOptions) string {
+	text := renderMessageBody(m, opts)
+	if m.starred {
+		marker := bookmarkMarker
+		if opts.accessible {
+			marker = "(starred)"
+		}
+		text = fmt.Sprintf("%s %s", marker, text)
+	}
+
+	if m.unsent > 0 {
+		return fmt.Sprintf("%s #%d %s", resendMarker, m.unsent, text)
+	}
+
+	return text
+}
+
+func renderMessageBody(m *historyMessage, opts renderOptions) string {
+	if opts.masked && m.messageType == messageTypeMessage {
+		return maskedMessageText
+	}
+
+	if opts.accessible {
+		switch m.messageType {
+		case messageTypeError:
+			return "error: " + renderCodeBlocks(m.Text())
+		case messageTypeTrace:
+			return "trace: " + renderCodeBlocks(m.Text())
+		}
+	}
+
+	if m.edited == nil {
+		return renderCodeBlocks(m.Text())
+	}
+
+	if opts.hideDiffs {
+		return "(edited) " + renderCodeBlocks(m.Text())
+	}
+
+	// the removed words are only told apart by their color
+	if opts.accessible {
+		return fmt.Sprintf("(edited) %s (previously: %s)", renderCodeBlocks(m.Text()), tview.Escape(m.edited.previous))
+	}
+
+	return "(edited) " + renderEditDiff(m.edited.previous, m.Text())
+}
@@ -0,0 +1,333 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/rivo/tview"
+
+	"berty.tech/berty/v2/go/pkg/bertylinks"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// groupInvitation is a multi-member group invitation received from a
+// contact, waiting to be accepted or declined.
+type groupInvitation struct {
+	groupPK    []byte
+	groupName  string
+	link       string
+	inviter    string
+	devicePK   []byte
+	receivedAt time.Time
+	from       *groupView
+}
+
+func (i *groupInvitation) label() string {
+	if i.groupName != "" {
+		return i.groupName
+	}
+	return pkAsShortID(i.groupPK)
+}
+
+// sidebarItem is a row of the sidebar, a section title when no field is
+// set.
+type sidebarItem struct {
+	group      *groupView
+	invitation *groupInvitation
+	// bookmarks is the row opening the list of the starred messages.
+	bookmarks bool
+}
+
+func (i sidebarItem) isTitle() bool {
+	return i.group == nil && i.invitation == nil && !i.bookmarks
+}
+
+func (v *tabbedGroupsView) getSidebarItems() []sidebarItem {
+	items := []sidebarItem(nil)
+	for _, vg := range v.getChannelViewGroups() {
+		items = append(items, sidebarItem{group: vg})
+	}
+
+	if len(v.invitations) > 0 {
+		items = append(items, sidebarItem{})
+		for _, inv := range v.invitations {
+			items = append(items, sidebarItem{invitation: inv})
+		}
+	}
+
+	if len(v.accounts.starred.list(v.accountKey())) > 0 {
+		items = append(items, sidebarItem{}, sidebarItem{bookmarks: true})
+	}
+
+	return items
+}
+
+func (v *tabbedGroupsView) getSidebarLabels() []string {
+	labels := v.getChannelLabels()
+	if len(v.invitations) > 0 {
+		labels = append(labels, "Invitations")
+		for _, inv := range v.invitations {
+			labels = append(labels, "+"+inv.label())
+		}
+	}
+
+	if count := len(v.accounts.starred.list(v.accountKey())); count > 0 {
+		labels = append(labels, "Bookmarks", fmt.Sprintf(" %s %d starred", bookmarkMarker, count))
+	}
+
+	return labels
+}
+
+func (v *tabbedGroupsView) isSelected(item sidebarItem) bool {
+	if v.bookmarksSelected {
+		return item.bookmarks
+	}
+	if v.selectedInvitation != nil {
+		return item.invitation == v.selectedInvitation
+	}
+	return item.group != nil && item.group == v.selectedGroupView
+}
+
+// moveSelection selects the step-th group, invitation or bookmarks row after
+// the current one in the sidebar, the caller must hold the lock.
+func (v *tabbedGroupsView) moveSelection(step int) {
+	items := v.getSidebarItems()
+
+	current := -1
+	for i, item := range items {
+		if v.isSelected(item) {
+			current = i
+			break
+		}
+	}
+	if current < 0 {
+		return
+	}
+
+	for i := current + step; i >= 0 && i < len(items); i += step {
+		if items[i].isTitle() {
+			continue
+		}
+
+		v.bookmarksSelected = items[i].bookmarks
+		if items[i].bookmarks {
+			v.selectedInvitation = nil
+			v.bookmarkCursor = 0
+		} else if items[i].invitation != nil {
+			v.selectedInvitation = items[i].invitation
+		} else {
+			v.selectedInvitation = nil
+			v.selectedGroupView = items[i].group
+			atomic.StoreInt32(&v.selectedGroupView.hasNew, 0)
+		}
+		return
+	}
+}
+
+// SelectedInvitation returns the invitation shown in place of a group, if
+// any.
+func (v *tabbedGroupsView) SelectedInvitation() *groupInvitation {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	return v.selectedInvitation
+}
+
+func (v *tabbedGroupsView) renderInvitation(inv *groupInvitation) {
+	v.invitationView.SetText(fmt.Sprintf(
+		"[::b]Invitation to %s[::-]\n\nfrom %s (device %s)\nreceived %s\n\nPress Enter to join the group, Esc to decline.",
+		tview.Escape(inv.label()),
+		tview.Escape(inv.inviter),
+		pkAsShortID(inv.devicePK),
+		inv.receivedAt.Format(time.RFC1123),
+	))
+}
+
+// receiveGroupInvitation adds the invitation sent in a contact group to the
+// inbox, unless it was declined or the group is already joined.
+func (v *groupView) receiveGroupInvitation(devicePK []byte, am *messengertypes.AppMessage, payload *messengertypes.AppMessage_GroupInvitation, isHistory bool) {
+	if v.g.GroupType != protocoltypes.GroupTypeContact || string(devicePK) == string(v.devicePK) {
+		return
+	}
+
+	link, err := bertylinks.UnmarshalLink(payload.GetLink(), nil)
+	if err != nil || !link.IsGroup() {
+		addToBuffer(&historyMessage{
+			messageType: messageTypeError,
+			payload:     []byte(fmt.Sprintf("received an invalid group invitation: %v", err)),
+			sender:      devicePK,
+		}, v, isHistory)
+		return
+	}
+
+	inv := &groupInvitation{
+		groupPK:    link.GetBertyGroup().GetGroup().GetPublicKey(),
+		groupName:  link.GetBertyGroup().GetDisplayName(),
+		link:       payload.GetLink(),
+		devicePK:   devicePK,
+		receivedAt: time.Unix(0, am.GetSentDate()*1000000),
+		from:       v,
+	}
+
+	v.v.lock.Lock()
+	inv.inviter = v.v.contactNames[string(v.g.PublicKey)]
+	if inv.inviter == "" {
+		inv.inviter = pkAsShortID(devicePK)
+	}
+
+	pending := !v.v.declinedInvitations[string(inv.groupPK)]
+	for _, vg := range v.v.multiMembersGroupViews {
+		pending = pending && string(vg.g.PublicKey) != string(inv.groupPK)
+	}
+	for _, other := range v.v.invitations {
+		pending = pending && string(other.groupPK) != string(inv.groupPK)
+	}
+	if pending {
+		v.v.invitations = append(v.v.invitations, inv)
+	}
+	v.v.lock.Unlock()
+
+	if !pending {
+		return
+	}
+
+	addToBuffer(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(fmt.Sprintf("invitation to join %s, see the Invitations list", inv.label())),
+		sender:      devicePK,
+	}, v, isHistory)
+
+	v.v.recomputeChannelList(false)
+	go v.v.app.Draw()
+
+	if !isHistory {
+		v.v.announce("invitation to join %s from %s, see the Invitations list", inv.label(), inv.inviter)
+	}
+}
+
+// removeInvitation drops the invitations to a group, and shows the group
+// they were selected from.
+func (v *tabbedGroupsView) removeInvitation(groupPK []byte) {
+	v.lock.Lock()
+	invitations := []*groupInvitation(nil)
+	for _, inv := range v.invitations {
+		if string(inv.groupPK) == string(groupPK) {
+			if inv == v.selectedInvitation {
+				v.selectedInvitation = nil
+			}
+			continue
+		}
+		invitations = append(invitations, inv)
+	}
+	removed := len(invitations) != len(v.invitations)
+	v.invitations = invitations
+	v.lock.Unlock()
+
+	if !removed {
+		return
+	}
+
+	v.recomputeChannelList(true)
+	go v.app.Draw()
+}
+
+// AcceptSelectedInvitation joins the group of the selected invitation, it
+// returns false when no invitation is selected.
+func (v *tabbedGroupsView) AcceptSelectedInvitation(ctx context.Context) bool {
+	inv := v.SelectedInvitation()
+	if inv == nil {
+		return false
+	}
+
+	if err := groupJoinCommand(ctx, v.accountGroupView, inv.link); err != nil {
+		inv.from.messages.AppendErr(err)
+		return true
+	}
+
+	v.removeInvitation(inv.groupPK)
+	inv.from.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(fmt.Sprintf("invitation to %s accepted", inv.label())),
+	})
+
+	return true
+}
+
+// DeclineSelectedInvitation forgets the selected invitation for the session,
+// the inviter is not notified. It returns false when no invitation is
+// selected.
+func (v *tabbedGroupsView) DeclineSelectedInvitation() bool {
+	inv := v.SelectedInvitation()
+	if inv == nil {
+		return false
+	}
+
+	v.lock.Lock()
+	v.declinedInvitations[string(inv.groupPK)] = true
+	v.lock.Unlock()
+
+	v.removeInvitation(inv.groupPK)
+	inv.from.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(fmt.Sprintf("invitation to %s declined", inv.label())),
+	})
+
+	return true
+}
+
+// groupInviteContactCommand sends an invitation to the current group to a
+// contact.
+func groupInviteContactCommand(ctx context.Context, v *groupView, cmd string) error {
+	if v.g.GroupType != protocoltypes.GroupTypeMultiMember {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("only multi-member groups can be shared"))
+	}
+
+	if cmd == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /group invite <contact name>"))
+	}
+
+	contactGroupPK, err := v.v.resolveContactGroup(cmd)
+	if err != nil {
+		return err
+	}
+
+	v.muAggregates.Lock()
+	groupName := v.profile.Profile().Topic
+	v.muAggregates.Unlock()
+
+	res, err := v.v.messenger.ShareableBertyGroup(ctx, &messengertypes.ShareableBertyGroup_Request{
+		GroupPK:   v.g.PublicKey,
+		GroupName: groupName,
+	})
+	if err != nil {
+		return err
+	}
+
+	payload, err := proto.Marshal(&messengertypes.AppMessage_GroupInvitation{
+		Link: res.WebURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := v.v.messenger.Interact(ctx, &messengertypes.Interact_Request{
+		Type:                  messengertypes.AppMessage_TypeGroupInvitation,
+		Payload:               payload,
+		ConversationPublicKey: base64.RawURLEncoding.EncodeToString(contactGroupPK),
+	}); err != nil {
+		return err
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(fmt.Sprintf("invitation sent to %s", cmd)),
+	})
+
+	return nil
+}
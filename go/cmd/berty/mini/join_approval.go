@@ -0,0 +1,125 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// joinConversation returns the conversation of the current group, only the
+// multi-member groups have an approval mode.
+func joinConversation(v *groupView) (string, error) {
+	if v.g.GroupType != protocoltypes.GroupTypeMultiMember {
+		return "", errcode.ErrInvalidInput.Wrap(fmt.Errorf("only multi-member groups have an approval mode"))
+	}
+
+	return base64.RawURLEncoding.EncodeToString(v.g.PublicKey), nil
+}
+
+// groupApprovalCommand switches the current group to the approval mode, or
+// shows whether it is in it.
+func groupApprovalCommand(ctx context.Context, v *groupView, cmd string) error {
+	conversationPK, err := joinConversation(v)
+	if err != nil {
+		return err
+	}
+
+	var text string
+	switch strings.TrimSpace(cmd) {
+	case "on":
+		if _, err := v.v.messenger.JoinApprovalSet(ctx, &messengertypes.JoinApprovalSet_Request{ConversationPublicKey: conversationPK, Enabled: true}); err != nil {
+			return err
+		}
+		text = "approval mode enabled, the new members wait for an admin"
+	case "off":
+		if _, err := v.v.messenger.JoinApprovalSet(ctx, &messengertypes.JoinApprovalSet_Request{ConversationPublicKey: conversationPK}); err != nil {
+			return err
+		}
+		text = "approval mode disabled, anyone with an invite can join"
+	case "":
+		state, err := v.v.messenger.JoinState(ctx, &messengertypes.JoinState_Request{ConversationPublicKey: conversationPK})
+		if err != nil {
+			return err
+		}
+		requests, err := v.v.messenger.JoinRequests(ctx, &messengertypes.JoinRequests_Request{ConversationPublicKey: conversationPK})
+		if err != nil {
+			return err
+		}
+		text = fmt.Sprintf("you are %s in this group, %d join request(s), see /group requests", strings.ToLower(state.State.String()), len(requests.Requests))
+	default:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /group approval [on|off]"))
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(text),
+	})
+
+	return nil
+}
+
+// groupRequestsCommand lists the join requests of the current group.
+func groupRequestsCommand(ctx context.Context, v *groupView, cmd string) error {
+	conversationPK, err := joinConversation(v)
+	if err != nil {
+		return err
+	}
+
+	reply, err := v.v.messenger.JoinRequests(ctx, &messengertypes.JoinRequests_Request{ConversationPublicKey: conversationPK})
+	if err != nil {
+		return err
+	}
+
+	requests := reply.GetRequests()
+	if len(requests) == 0 {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("no join requests"),
+		})
+		return nil
+	}
+
+	for _, r := range requests {
+		name := r.DisplayName
+		if name == "" {
+			name = "(unknown)"
+		}
+
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(fmt.Sprintf("%s %s: %s", r.MemberPublicKey, name, strings.ToLower(r.State.String()))),
+		})
+	}
+
+	return nil
+}
+
+// groupDecideCommand approves or denies a join request of the current group.
+func groupDecideCommand(approved bool) func(ctx context.Context, v *groupView, cmd string) error {
+	return func(ctx context.Context, v *groupView, cmd string) error {
+		conversationPK, err := joinConversation(v)
+		if err != nil {
+			return err
+		}
+
+		memberPK := strings.TrimSpace(cmd)
+		if memberPK == "" {
+			if approved {
+				return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /group approve <member pk>"))
+			}
+			return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /group deny <member pk>"))
+		}
+
+		if approved {
+			_, err = v.v.messenger.JoinApprove(ctx, &messengertypes.JoinApprove_Request{ConversationPublicKey: conversationPK, MemberPublicKey: memberPK})
+		} else {
+			_, err = v.v.messenger.JoinDeny(ctx, &messengertypes.JoinDeny_Request{ConversationPublicKey: conversationPK, MemberPublicKey: memberPK})
+		}
+		return err
+	}
+}
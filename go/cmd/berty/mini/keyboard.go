@@ -1,6 +1,8 @@
 package mini
 
 import (
+	"fmt"
+
 	"github.com/gdamore/tcell"
 	"github.com/rivo/tview"
 )
@@ -23,13 +25,24 @@ func keyboardCommands() []*keyboardCommand {
 		{
 			shortcuts: []keyboardShortcut{
 				{key: tcell.KeyCtrlC},
-				{key: tcell.KeyEsc},
 			},
 			help: "Quit the app",
 			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
 				app.Stop()
 			},
 		},
+		{
+			shortcuts: []keyboardShortcut{
+				{key: tcell.KeyEsc},
+			},
+			help: "Decline the selected invitation, or quit the app",
+			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				if tabbedView.DeclineSelectedInvitation() {
+					return
+				}
+				app.Stop()
+			},
+		},
 		{
 			shortcuts: []keyboardShortcut{
 				{key: tcell.KeyHome},
@@ -66,9 +79,52 @@ func keyboardCommands() []*keyboardCommand {
 				tabbedView.GetActiveViewGroup().ScrollToOffset(+10)
 			},
 		},
+		{
+			shortcuts: []keyboardShortcut{
+				{
+					modifier: tcell.ModShift,
+					key:      tcell.KeyLeft,
+				},
+			},
+			help: "Scroll the code blocks to the left",
+			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				tabbedView.GetActiveViewGroup().messages.ScrollCode(-codeScrollStep)
+			},
+		},
+		{
+			shortcuts: []keyboardShortcut{
+				{
+					modifier: tcell.ModShift,
+					key:      tcell.KeyRight,
+				},
+			},
+			help: "Scroll the code blocks to the right, their lines are not wrapped",
+			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				tabbedView.GetActiveViewGroup().messages.ScrollCode(+codeScrollStep)
+			},
+		},
 		{
 			shortcuts: []keyboardShortcut{
 				{key: tcell.KeyCtrlP},
+			},
+			help: "Show or hide the performance panel (CPU, memory, goroutines, GC)",
+			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				tabbedView.accounts.perf.Toggle()
+			},
+		},
+		{
+			shortcuts: []keyboardShortcut{
+				{key: tcell.KeyCtrlR},
+			},
+			help: "Reveal the messages masked by the privacy mode for a few seconds, or mask them again",
+			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				if !tabbedView.accounts.privacy.ToggleReveal() {
+					tabbedView.GetActiveViewGroup().messages.AppendErr(fmt.Errorf("privacy mode is off, turn it on with /privacy on"))
+				}
+			},
+		},
+		{
+			shortcuts: []keyboardShortcut{
 				{
 					modifier: tcell.ModAlt,
 					key:      tcell.KeyUp,
@@ -100,12 +156,70 @@ func keyboardCommands() []*keyboardCommand {
 				tabbedView.NextGroup()
 			},
 		},
+		{
+			shortcuts: []keyboardShortcut{
+				{key: tcell.KeyCtrlG},
+			},
+			help: "Prompt for a date to jump to in the message list",
+			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				input.SetText("/goto ")
+			},
+		},
+		{
+			shortcuts: []keyboardShortcut{
+				{key: tcell.KeyCtrlK},
+			},
+			help: "Open a fuzzy finder over the contact and group names to jump to a conversation",
+			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				tabbedView.accounts.jump.Toggle()
+			},
+		},
+		{
+			shortcuts: []keyboardShortcut{
+				{key: tcell.KeyTab},
+			},
+			help: "Complete the contact name being typed, the contacts sharing a name are completed with an unambiguous reference",
+			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				tabbedView.completeContact(input)
+			},
+		},
+		{
+			shortcuts: []keyboardShortcut{
+				{key: tcell.KeyCtrlS},
+			},
+			help: "Suggest corrections for the misspelled words of the input, underlined once a spelling language is enabled in /settings",
+			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				tabbedView.accounts.spelling.Toggle(tabbedView.GetActiveViewGroup())
+			},
+		},
+		{
+			shortcuts: []keyboardShortcut{
+				{key: tcell.KeyCtrlE},
+			},
+			help: "Select a message with Up/Down, Enter opens its actions (copy, reply, inspect, resend)",
+			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				tabbedView.accounts.selector.Toggle()
+			},
+		},
+		{
+			shortcuts: []keyboardShortcut{
+				{key: tcell.KeyCtrlT},
+			},
+			help: "Switch to the next opened account, keeping the current draft",
+			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				tabbedView.GetActiveViewGroup().messages.AppendErr(tabbedView.accounts.Next())
+			},
+		},
 		{
 			shortcuts: []keyboardShortcut{
 				{key: tcell.KeyUp},
 			},
-			help: "Restore the previous message sent in the input field",
+			help: "Restore the previous message sent in the input field, or select the previous bookmark",
 			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				if tabbedView.BookmarksSelected() {
+					tabbedView.MoveBookmarkCursor(-1)
+					return
+				}
 				input.SetText(tabbedView.GetActiveViewGroup().inputHistory.Prev())
 			},
 		},
@@ -113,8 +227,12 @@ func keyboardCommands() []*keyboardCommand {
 			shortcuts: []keyboardShortcut{
 				{key: tcell.KeyDown},
 			},
-			help: "Restore the next message sent in the input field",
+			help: "Restore the next message sent in the input field, or select the next bookmark",
 			action: func(app *tview.Application, tabbedView *tabbedGroupsView, input *tview.InputField) {
+				if tabbedView.BookmarksSelected() {
+					tabbedView.MoveBookmarkCursor(+1)
+					return
+				}
 				input.SetText(tabbedView.GetActiveViewGroup().inputHistory.Next())
 			},
 		},
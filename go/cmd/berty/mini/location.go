@@ -0,0 +1,101 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"berty.tech/berty/v2/go/internal/messagelocation"
+	"berty.tech/berty/v2/go/pkg/appmessage"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// locateTimeout bounds the wait of the first fix of the location service.
+const locateTimeout = 30 * time.Second
+
+// locationCommand sends a location to the current group, given as
+// coordinates or looked up with the location service of the system once the
+// user consented to it.
+func locationCommand(ctx context.Context, v *groupView, cmd string) error {
+	switch args := strings.Fields(cmd); {
+	case len(args) == 0:
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /loc <lat> <lon> [label] or /loc here"))
+	case args[0] == "here":
+		return locateHereCommand(ctx, v, args[1:])
+	}
+
+	l, err := messagelocation.Parse(cmd)
+	if err != nil {
+		return err
+	}
+
+	return v.sendLocation(ctx, l)
+}
+
+func (v *groupView) sendLocation(ctx context.Context, l messagelocation.Location) error {
+	req, err := appmessage.InteractRequest(base64.RawURLEncoding.EncodeToString(v.g.PublicKey), appmessage.Location(l))
+	if err != nil {
+		return err
+	}
+
+	_, err = v.v.messenger.Interact(ctx, req)
+	return err
+}
+
+// locateHereCommand sends the location of the device, the first lookup of a
+// session is only done after the user answered the consent prompt with
+// /loc here yes.
+func locateHereCommand(ctx context.Context, v *groupView, args []string) error {
+	if !messagelocation.LocateSupported {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("no location service on this platform, use /loc <lat> <lon> [label]"))
+	}
+
+	v.v.lock.Lock()
+	if len(args) == 1 && args[0] == "yes" {
+		v.v.locationConsent = true
+	}
+	consent := v.v.locationConsent
+	v.v.lock.Unlock()
+
+	if !consent {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("share the location of this device with this group? the location service of the system will be asked for it, /loc here yes to accept until mini exits"),
+		})
+		return nil
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte("locating the device..."),
+	})
+
+	// the fix can take a while, the input stays usable meanwhile
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, locateTimeout)
+		defer cancel()
+
+		l, err := messagelocation.Locate(ctx, "berty-mini")
+		if err == nil {
+			err = v.sendLocation(ctx, l)
+		}
+		if err != nil {
+			v.messages.AppendErr(fmt.Errorf("unable to share the location: %w", err))
+		}
+	}()
+
+	return nil
+}
+
+// userMessageBody returns the text displayed for a user message, the
+// fallback of the structured ones, e.g. the map link of a location, see
+// appmessage.
+func userMessageBody(payload []byte, body string) string {
+	if m, err := appmessage.Unmarshal(payload); err == nil {
+		return m.Fallback()
+	}
+
+	return body
+}
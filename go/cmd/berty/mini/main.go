@@ -6,12 +6,14 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gdamore/tcell"
 	"github.com/gdamore/tcell/terminfo"
 	"github.com/rivo/tview"
 	"go.uber.org/zap"
 
+	"berty.tech/berty/v2/go/internal/reconnect"
 	assets "berty.tech/berty/v2/go/pkg/assets"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
@@ -28,6 +30,69 @@ type Opts struct {
 	DisplayName      string
 	LifecycleManager *lifecycle.Manager
 	NetManager       *netmanager.NetManager
+	// AccountID is the account the clients are bound to.
+	AccountID string
+	// Accounts is optional, it allows switching to other opened accounts.
+	Accounts AccountSwitcher
+	// Conn is optional, when set mini reconnects to the daemon when the
+	// connection drops.
+	Conn Conn
+	// ProfileHider is optional, it enables the /profile command.
+	ProfileHider ProfileHider
+	// PrivacySettings is optional, it enables the /settings panel.
+	PrivacySettings PrivacySettings
+	// NetworkConfig is optional, it enables the /netconf commands, the
+	// proximity transports are then also switched through NetManager.
+	NetworkConfig NetworkConfigEditor
+	// ReadMarker is optional, the groups marked as read, with /read or after
+	// MarkReadAfter, are then also marked as read in the messenger.
+	ReadMarker ReadMarker
+	// MarkReadAfter is optional, a group with unread messages is marked as
+	// read after being displayed this long, only /read marks it when zero.
+	MarkReadAfter time.Duration
+	// GroupSyncReporter is optional, with Conn it drives the sync indicators
+	// of the tab list.
+	GroupSyncReporter GroupSyncReporter
+	// ScriptsDir is optional, the Starlark scripts (*.star) it holds react to
+	// the events of the account, see scriptHost.
+	ScriptsDir string
+	// AliasesFile is optional, the aliases it defines expand to messages
+	// and commands, see loadAliases.
+	AliasesFile string
+	// BookmarksFile is optional, the messages starred with /star are then
+	// saved in it instead of only kept in memory, see bookmarkStore. It is
+	// not used by an ephemeral account.
+	BookmarksFile string
+	// SpellDictionariesDir is optional, the hunspell dictionaries it holds
+	// (<language>.dic and <language>.aff) check the spelling of the input,
+	// their languages are enabled in the /settings panel, see spellChecker.
+	SpellDictionariesDir string
+	// SpellingFile is optional, the languages enabled in the /settings panel
+	// are then saved in it instead of only kept in memory. It is not used by
+	// an ephemeral account.
+	SpellingFile string
+	// MessageTemplate customizes how messages are rendered, see
+	// DefaultMessageTemplate.
+	MessageTemplate string
+	// AwayAfter is optional, the user is marked away after this long without
+	// keyboard input, and active again on the next key, see /presence.
+	AwayAfter time.Duration
+	// PresencePublisher is optional, it shares the presence of the user with
+	// the contacts.
+	PresencePublisher PresencePublisher
+	// InactiveWhenAway switches the lifecycle manager to the inactive state
+	// while the user is away. It is only set when the node keeps receiving
+	// the notifications while inactive.
+	InactiveWhenAway bool
+	// Onboarding is set when the account was just created by RunOnboarding,
+	// its contact link is shown on startup.
+	Onboarding *Onboarding
+	// ExpiresAt is set for an ephemeral account, a banner warns that it is
+	// not saved and mini exits when it expires.
+	ExpiresAt time.Time
+	// Accessible linearizes the interface for the screen readers, see
+	// accessibility.go.
+	Accessible bool
 }
 
 var globalLogger *zap.Logger
@@ -41,36 +106,55 @@ func Main(ctx context.Context, opts *Opts) error {
 	if opts.ProtocolClient == nil {
 		return errcode.ErrMissingInput.Wrap(fmt.Errorf("missing protocol client"))
 	}
-	_, err := terminfo.LookupTerminfo(os.Getenv("TERM"))
+	messageTemplate, err := parseMessageTemplate(opts.MessageTemplate)
+	if err != nil {
+		return err
+	}
+	_, err = terminfo.LookupTerminfo(os.Getenv("TERM"))
 	if err != nil {
 		return errcode.ErrCLINoTermcaps.Wrap(err)
 	}
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	config, err := opts.ProtocolClient.ServiceGetConfiguration(ctx, &protocoltypes.ServiceGetConfiguration_Request{})
-	if err != nil {
-		return errcode.TODO.Wrap(err)
-	}
-
 	app := tview.NewApplication()
 
-	accountGroup, err := opts.ProtocolClient.GroupInfo(ctx, &protocoltypes.GroupInfo_Request{
-		GroupPK: config.AccountGroupPK,
-	})
-	if err != nil {
-		return errcode.TODO.Wrap(err)
+	input := tview.NewInputField().
+		SetFieldTextColor(tcell.ColorWhite).
+		SetFieldBackgroundColor(tcell.ColorBlack)
+
+	accounts := newAccountManager(ctx, opts, app, input, messageTemplate)
+	if accounts.scripts, err = loadScripts(accounts, opts.ScriptsDir); err != nil {
+		return err
+	}
+	if accounts.aliases, err = loadAliases(opts.AliasesFile); err != nil {
+		return err
+	}
+	bookmarksFile := opts.BookmarksFile
+	if !opts.ExpiresAt.IsZero() {
+		bookmarksFile = ""
+	}
+	if accounts.starred, err = loadBookmarks(bookmarksFile); err != nil {
+		return err
+	}
+	spellingFile := opts.SpellingFile
+	if !opts.ExpiresAt.IsZero() {
+		spellingFile = ""
+	}
+	if accounts.spell, err = loadSpellChecker(opts.SpellDictionariesDir, spellingFile); err != nil {
+		return err
+	}
+	if err := accounts.attach(opts.AccountID, opts.MessengerClient, opts.ProtocolClient); err != nil {
+		return err
 	}
 
-	if opts.Logger != nil {
-		globalLogger = opts.Logger.Named(pkAsShortID(accountGroup.Group.PublicKey))
-	} else {
-		globalLogger = zap.NewNop()
+	tabbedView := accounts.Current().view
+	if opts.Onboarding != nil {
+		go showOnboardingLink(ctx, tabbedView.accountGroupView, opts.Onboarding)
 	}
 
-	tabbedView := newTabbedGroups(ctx, accountGroup, opts.ProtocolClient, opts.MessengerClient, app, opts.DisplayName, opts.NetManager)
 	if len(opts.GroupInvitation) > 0 {
-		req := &protocoltypes.GroupMetadataList_Request{GroupPK: accountGroup.Group.PublicKey}
+		req := &protocoltypes.GroupMetadataList_Request{GroupPK: tabbedView.accountGroupView.g.PublicKey}
 		cl, err := tabbedView.protocol.GroupMetadataList(ctx, req)
 		if err != nil {
 			return errcode.ErrEventListMetadata.Wrap(err)
@@ -102,57 +186,130 @@ func Main(ctx context.Context, opts *Opts) error {
 		}
 	}
 
-	input := tview.NewInputField().
-		SetFieldTextColor(tcell.ColorWhite).
-		SetFieldBackgroundColor(tcell.ColorBlack)
+	// the misspelled words of the input are underlined once a dictionary is
+	// loaded
+	accounts.spell.start(func(language string, err error) {
+		if err != nil {
+			if current := accounts.Current(); current != nil {
+				current.view.GetActiveViewGroup().messages.AppendErr(fmt.Errorf("unable to load the %s dictionary: %w", language, err))
+			}
+			return
+		}
+
+		app.Draw()
+	})
+
+	var monitor *connectionMonitor
+	if opts.Conn != nil {
+		monitor = newConnectionMonitor(opts.Conn, app, accounts)
+	}
 
 	input.SetDoneFunc(func(key tcell.Key) {
 		if key == tcell.KeyEnter {
 			msg := input.GetText()
 			input.SetText("")
 
-			tabbedView.GetActiveViewGroup().OnSubmit(ctx, msg)
+			if monitor != nil && monitor.Buffer(msg) {
+				return
+			}
+
+			// an empty input accepts the selected invitation
+			if msg == "" && accounts.Current().view.AcceptSelectedInvitation(ctx) {
+				return
+			}
+
+			// an empty input jumps to the selected bookmark
+			if msg == "" && accounts.Current().view.OpenSelectedBookmark() {
+				return
+			}
+
+			accounts.Current().view.GetActiveViewGroup().OnSubmit(ctx, msg)
 		}
 	})
 
 	inputBox := tview.NewFlex().
 		AddItem(tview.NewTextView().SetText(">> "), 3, 0, false).
-		AddItem(input, 0, 1, true)
-
-	mainUI := tview.NewFlex().
-		AddItem(tabbedView.GetTabs(), 10, 0, false).
-		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
-			AddItem(tabbedView.GetHistory(), 0, 1, false).
-			AddItem(inputBox, 1, 1, true), 0, 1, true)
-
-	// The inactive timer is disabled for now because it will cause group subs to be suspended
-	// when going to inactive state
-	// This will prevent desktop notification when inactive but they should not happen if subs
-	// are suspended anyway
-
-	/*
-		const ShouldBecomeInactive = time.Second * 30
-		inactiveTimer := time.AfterFunc(ShouldBecomeInactive, func() {
-			opts.LifecycleManager.UpdateState(lifecycle.StateInactive)
-		})
-	*/
+		AddItem(newSpellInputField(accounts), 0, 1, true)
+
+	mainColumn := tview.NewFlex().SetDirection(tview.FlexRow)
+	if !opts.ExpiresAt.IsZero() {
+		ephemeral := newEphemeralBanner(app, opts.ExpiresAt)
+		ephemeral.attachTo(mainColumn)
+		go ephemeral.run(ctx)
+	}
+	if monitor != nil {
+		monitor.attachTo(mainColumn)
+		go monitor.run(ctx)
+
+		if opts.NetManager != nil {
+			reconnects := reconnect.New(globalLogger.Named("reconnect"))
+			reconnects.Register("daemon", monitor.reconnectNow)
+			go reconnects.Run(ctx, opts.NetManager)
+		}
+	}
+	accounts.perf.attachTo(mainColumn)
+	go accounts.perf.run(ctx)
+	go accounts.redraws.run(ctx)
+	go accounts.sync.run(ctx)
+	go accounts.drafts.run(ctx)
+	go accounts.slow.run(ctx)
+	go accounts.scripts.run(ctx)
+	accounts.jump.attachTo(mainColumn)
+	accounts.selector.attachTo(mainColumn)
+	accounts.settings.attachTo(mainColumn)
+	mainColumn.AddItem(accounts.history, 0, 1, false)
+	accounts.slow.attachTo(mainColumn)
+	accounts.spelling.attachTo(mainColumn)
+	mainColumn.AddItem(inputBox, 1, 1, true)
+
+	// the history is the only scrolling region in the accessibility mode
+	mainUI := tview.NewFlex()
+	if !opts.Accessible {
+		mainUI.AddItem(accounts.tabs, 10, 0, false)
+	}
+	mainUI.AddItem(mainColumn, 0, 1, true)
+
+	// the user is away when the keyboard is not used
+	accounts.away.start()
+	defer accounts.away.stop()
+	go accounts.away.run(ctx)
 
 	keyboardCommandsMap := buildKeyboardCommandMap()
 
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		/*
+		accounts.away.activity()
 
-			// reset timer
-			if !inactiveTimer.Stop() {
-				// AfterFunc timer should already have consume `inactiveTimer.C`
-				opts.LifecycleManager.UpdateState(lifecycle.StateActive)
+		// the keys move the message selection instead of editing the input
+		if accounts.selector.IsActive() {
+			if event = accounts.selector.HandleKey(event); event == nil {
+				return nil
 			}
-			inactiveTimer.Reset(ShouldBecomeInactive)
+		}
+
+		// the keys select the spelling suggestions
+		if accounts.spelling.IsOpen() {
+			if event = accounts.spelling.HandleKey(event); event == nil {
+				return nil
+			}
+		}
+
+		// the keys move in the settings panel
+		if accounts.settings.IsOpen() {
+			if event = accounts.settings.HandleKey(event); event == nil {
+				return nil
+			}
+		}
+
+		// the quick switcher edits its query in the input
+		if accounts.jump.IsOpen() {
+			if event = accounts.jump.HandleKey(event); event == nil {
+				return nil
+			}
+		}
 
-		*/
 		if _, ok := keyboardCommandsMap[event.Modifiers()]; ok {
 			if action, ok := keyboardCommandsMap[event.Modifiers()][event.Key()]; ok {
-				action(app, tabbedView, input)
+				action(app, accounts.Current().view, input)
 				return nil
 			}
 		}
@@ -164,5 +321,9 @@ func Main(ctx context.Context, opts *Opts) error {
 		return errcode.TODO.Wrap(err)
 	}
 
+	if current := accounts.Current(); current != nil {
+		accounts.drafts.flush(current.view)
+	}
+
 	return nil
 }
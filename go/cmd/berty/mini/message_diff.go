@@ -0,0 +1,212 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/ipfs/go-cid"
+	"github.com/rivo/tview"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// maxDiffWords bounds the quadratic word diff, longer edits are shown as a
+// whole replacement.
+const maxDiffWords = 512
+
+// messageEdit is attached to the history message of an edit, a user message
+// targeting an earlier message of the same device. Clients unaware of edits
+// show it as a new message.
+type messageEdit struct {
+	previous string
+}
+
+// editTarget is a message which can be edited.
+type editTarget struct {
+	devicePK []byte
+	body     string
+}
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffRemoved
+	diffAdded
+)
+
+type wordChange struct {
+	op   diffOp
+	word string
+}
+
+// diffWords returns the changes turning the words of a into the ones of b,
+// from their longest common subsequence.
+func diffWords(a, b []string) []wordChange {
+	if len(a) > maxDiffWords || len(b) > maxDiffWords {
+		changes := make([]wordChange, 0, len(a)+len(b))
+		for _, w := range a {
+			changes = append(changes, wordChange{diffRemoved, w})
+		}
+		for _, w := range b {
+			changes = append(changes, wordChange{diffAdded, w})
+		}
+		return changes
+	}
+
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	changes := []wordChange(nil)
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			changes = append(changes, wordChange{diffEqual, a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			changes = append(changes, wordChange{diffRemoved, a[i]})
+			i++
+		default:
+			changes = append(changes, wordChange{diffAdded, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		changes = append(changes, wordChange{diffRemoved, a[i]})
+	}
+	for ; j < len(b); j++ {
+		changes = append(changes, wordChange{diffAdded, b[j]})
+	}
+
+	return changes
+}
+
+// renderEditDiff returns the tview markup of an edit, removed words are
+// struck through in red and added ones underlined in green.
+func renderEditDiff(previous, current string) string {
+	words := []string(nil)
+	for _, c := range diffWords(strings.Fields(previous), strings.Fields(current)) {
+		switch c.op {
+		case diffEqual:
+			words = append(words, tview.Escape(c.word))
+		case diffRemoved:
+			words = append(words, fmt.Sprintf("[red]%s[-]", tview.Escape(strikethrough(c.word))))
+		case diffAdded:
+			words = append(words, fmt.Sprintf("[green::u]%s[-::-]", tview.Escape(c.word)))
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// strikethrough uses combining characters, the terminal library has no
+// strikethrough attribute.
+func strikethrough(s string) string {
+	b := strings.Builder{}
+	for _, r := range s {
+		b.WriteRune(r)
+		b.WriteRune('\u0336')
+	}
+
+	return b.String()
+}
+
+// trackEdit records a received user message and returns the edit it makes,
+// if it targets an earlier message of the same device.
+func (v *groupView) trackEdit(messageCID string, devicePK []byte, am *messengertypes.AppMessage, body string) *messageEdit {
+	v.muAggregates.Lock()
+	defer v.muAggregates.Unlock()
+
+	var edit *messageEdit
+	if target, ok := v.editTargets[am.GetTargetCID()]; ok && am.GetTargetCID() != "" && string(target.devicePK) == string(devicePK) {
+		edit = &messageEdit{previous: target.body}
+
+		// later edits still target the original message
+		v.editTargets[am.GetTargetCID()] = editTarget{devicePK: devicePK, body: body}
+	}
+
+	if messageCID != "" {
+		v.editTargets[messageCID] = editTarget{devicePK: devicePK, body: body}
+	}
+
+	return edit
+}
+
+// eventCID returns the cid of a message event as used by the messenger.
+func eventCID(evtCtx *protocoltypes.EventContext) string {
+	c, err := cid.Cast(evtCtx.GetID())
+	if err != nil {
+		return ""
+	}
+
+	return c.String()
+}
+
+func editCommand(ctx context.Context, v *groupView, cmd string) error {
+	if cmd == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /edit <text>"))
+	}
+
+	if v.lastSentCID == "" {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("no message sent in this group yet"))
+	}
+
+	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{
+		Body: cmd,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = v.v.messenger.Interact(ctx, &messengertypes.Interact_Request{
+		Type:                  messengertypes.AppMessage_TypeUserMessage,
+		Payload:               payload,
+		ConversationPublicKey: base64.RawURLEncoding.EncodeToString(v.g.PublicKey),
+		TargetCID:             v.lastSentCID,
+	})
+
+	return err
+}
+
+func diffCommand(_ context.Context, v *groupView, cmd string) error {
+	var hide bool
+	switch strings.ToLower(cmd) {
+	case "on":
+		hide = false
+	case "off":
+		hide = true
+	default:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /diff on|off"))
+	}
+
+	v.v.lock.Lock()
+	v.v.hideDiffs = hide
+	v.v.lock.Unlock()
+
+	for _, view := range v.v.groupViews() {
+		view.messages.SetHideDiffs(hide)
+	}
+
+	return nil
+}
@@ -0,0 +1,308 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// messageReplyExcerpt bounds the quoted text of a reply.
+const messageReplyExcerpt = 40
+
+// messageAction is an entry of the menu opened on a selected message.
+type messageAction struct {
+	key   rune
+	title string
+	// available hides the action for the messages it does not apply to
+	available func(v *groupView, m *historyMessage) bool
+	run       func(ctx context.Context, v *groupView, input *tview.InputField, m *historyMessage) error
+}
+
+func messageActions() []*messageAction {
+	return []*messageAction{
+		{
+			key:   'c',
+			title: "copy the text to the clipboard",
+			run: func(_ context.Context, v *groupView, _ *tview.InputField, m *historyMessage) error {
+				copyToClipboard(v, m.Text(), false)
+				return nil
+			},
+		},
+		{
+			key:   'r',
+			title: "reply, quoting the message in the input",
+			run: func(_ context.Context, _ *groupView, input *tview.InputField, m *historyMessage) error {
+				input.SetText(fmt.Sprintf("> %s: %s | ", m.Sender(), messageExcerpt(m.Text())))
+				return nil
+			},
+		},
+		{
+			key:   'i',
+			title: "inspect the message",
+			run: func(_ context.Context, v *groupView, _ *tview.InputField, m *historyMessage) error {
+				v.messages.Append(&historyMessage{
+					messageType: messageTypeMeta,
+					payload:     []byte(inspectMessage(v, m)),
+				})
+				return nil
+			},
+		},
+		{
+			key:   'b',
+			title: "star or unstar it, see the Bookmarks tab",
+			available: func(_ *groupView, m *historyMessage) bool {
+				return m.cid != ""
+			},
+			run: func(_ context.Context, v *groupView, _ *tview.InputField, m *historyMessage) error {
+				return v.toggleStar(m)
+			},
+		},
+		{
+			key:   's',
+			title: "send it again",
+			available: func(_ *groupView, m *historyMessage) bool {
+				return m.unsent > 0
+			},
+			run: func(ctx context.Context, v *groupView, _ *tview.InputField, m *historyMessage) error {
+				return resendCommand(ctx, v, strconv.Itoa(m.unsent))
+			},
+		},
+	}
+}
+
+func messageExcerpt(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > messageReplyExcerpt {
+		return string(runes[:messageReplyExcerpt-1]) + "…"
+	}
+	return text
+}
+
+func inspectMessage(v *groupView, m *historyMessage) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "message from %s, sent at %s", m.Sender(), m.receivedAt.Format(time.RFC3339))
+
+	if m.cid != "" {
+		fmt.Fprintf(b, ", cid %s", m.cid)
+		if _, ok := v.acks.Load(m.cid); ok {
+			b.WriteString(", acknowledged")
+		}
+	}
+	if m.edited != nil {
+		if v.messages.IsMasked() {
+			b.WriteString(", edited")
+		} else {
+			fmt.Fprintf(b, ", edited from %q", m.edited.previous)
+		}
+	}
+	if m.unsent > 0 {
+		fmt.Fprintf(b, ", %s not acknowledged, /resend %d", resendMarker, m.unsent)
+	}
+	fmt.Fprintf(b, ", %d bytes", len(m.payload))
+
+	return b.String()
+}
+
+// messageSelector selects a message of the active group with Up/Down, and
+// opens the menu of its actions with Enter.
+type messageSelector struct {
+	accounts *accountManager
+	view     *tview.TextView
+	layout   *tview.Flex
+
+	mu sync.Mutex
+	// group is the view whose messages are selected, nil when not selecting
+	group    *groupView
+	actions  []*messageAction
+	selected int
+}
+
+func newMessageSelector(accounts *accountManager) *messageSelector {
+	view := tview.NewTextView().SetDynamicColors(true)
+	view.SetBackgroundColor(tcell.ColorDarkSlateGray)
+
+	return &messageSelector{accounts: accounts, view: view}
+}
+
+// attachTo adds the menu, hidden until opened, to layout.
+func (s *messageSelector) attachTo(layout *tview.Flex) {
+	s.layout = layout
+	layout.AddItem(s.view, 0, 0, false)
+}
+
+// IsActive returns true while a message is selected.
+func (s *messageSelector) IsActive() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.group != nil
+}
+
+// Toggle starts selecting the messages of the active group, from the last
+// one, or stops.
+func (s *messageSelector) Toggle() {
+	if s.IsActive() {
+		s.stop()
+		return
+	}
+
+	v := s.accounts.Current().view.GetActiveViewGroup()
+	if !v.messages.SelectLast() {
+		v.messages.AppendErr(fmt.Errorf("no message to select"))
+		return
+	}
+
+	s.mu.Lock()
+	s.group = v
+	s.mu.Unlock()
+}
+
+func (s *messageSelector) stop() {
+	s.closeMenu()
+
+	s.mu.Lock()
+	v := s.group
+	s.group = nil
+	s.mu.Unlock()
+
+	if v != nil {
+		v.messages.ClearSelection()
+	}
+}
+
+// HandleKey handles all the keys while a message is selected, except
+// Ctrl+C.
+func (s *messageSelector) HandleKey(event *tcell.EventKey) *tcell.EventKey {
+	s.mu.Lock()
+	v, menuOpen := s.group, s.actions != nil
+	s.mu.Unlock()
+
+	if v == nil || event.Key() == tcell.KeyCtrlC {
+		return event
+	}
+
+	if menuOpen {
+		s.handleMenuKey(v, event)
+		return nil
+	}
+
+	switch event.Key() {
+	case tcell.KeyUp:
+		v.messages.MoveSelection(-1)
+	case tcell.KeyDown:
+		v.messages.MoveSelection(+1)
+	case tcell.KeyEnter:
+		if m := v.messages.Selected(); m != nil {
+			s.openMenu(v, m)
+		}
+	case tcell.KeyEsc, tcell.KeyCtrlE:
+		s.stop()
+	}
+
+	return nil
+}
+
+func (s *messageSelector) handleMenuKey(v *groupView, event *tcell.EventKey) {
+	switch event.Key() {
+	case tcell.KeyUp:
+		s.moveMenuSelection(-1)
+	case tcell.KeyDown:
+		s.moveMenuSelection(+1)
+	case tcell.KeyEnter:
+		s.mu.Lock()
+		action := s.actions[s.selected]
+		s.mu.Unlock()
+		s.run(v, action)
+	case tcell.KeyEsc:
+		s.closeMenu()
+	case tcell.KeyRune:
+		s.mu.Lock()
+		actions := s.actions
+		s.mu.Unlock()
+
+		for _, action := range actions {
+			if action.key == event.Rune() {
+				s.run(v, action)
+				return
+			}
+		}
+	}
+}
+
+// run runs action on the selected message, then stops selecting.
+func (s *messageSelector) run(v *groupView, action *messageAction) {
+	m := v.messages.Selected()
+	s.stop()
+	if m == nil {
+		return
+	}
+
+	v.messages.AppendErr(action.run(s.accounts.rootCtx, v, s.accounts.input, m))
+}
+
+func (s *messageSelector) openMenu(v *groupView, m *historyMessage) {
+	actions := []*messageAction(nil)
+	for _, action := range messageActions() {
+		if action.available == nil || action.available(v, m) {
+			actions = append(actions, action)
+		}
+	}
+
+	s.mu.Lock()
+	s.actions = actions
+	s.selected = 0
+	s.render(v, m)
+	s.mu.Unlock()
+
+	if s.layout != nil {
+		s.layout.ResizeItem(s.view, len(actions)+1, 0)
+	}
+}
+
+func (s *messageSelector) closeMenu() {
+	s.mu.Lock()
+	s.actions = nil
+	s.mu.Unlock()
+
+	if s.layout != nil {
+		s.layout.ResizeItem(s.view, 0, 0)
+	}
+}
+
+func (s *messageSelector) moveMenuSelection(step int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.selected = (s.selected + step + len(s.actions)) % len(s.actions)
+	if m := s.group.messages.Selected(); m != nil {
+		s.render(s.group, m)
+	}
+}
+
+// render displays the actions of m, s.mu must be held.
+func (s *messageSelector) render(v *groupView, m *historyMessage) {
+	excerpt := maskedMessageText
+	if !v.messages.IsMasked() {
+		excerpt = messageExcerpt(m.Text())
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "[::b]Message[::-] from %s: %s (Up/Down and Enter or the key of an action, Esc to go back)", m.Sender(), tview.Escape(excerpt))
+
+	for i, action := range s.actions {
+		line := fmt.Sprintf("[%c] %s", action.key, action.title)
+		line = tview.Escape(line)
+		if i == s.selected {
+			line = selectedLine(s.accounts, line)
+		}
+		fmt.Fprintf(b, "\n%s", line)
+	}
+
+	s.view.SetText(b.String())
+}
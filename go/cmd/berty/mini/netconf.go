@@ -0,0 +1,120 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"berty.tech/berty/v2/go/internal/netconf"
+	"berty.tech/berty/v2/go/pkg/accounttypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/netmanager"
+)
+
+// NetworkConfigEditor reads and edits the network configuration of the
+// account, it is implemented by netconf.Store for an in-process node.
+type NetworkConfigEditor interface {
+	NetworkConfig(ctx context.Context) (*accounttypes.NetworkConfig, error)
+	Set(ctx context.Context, key, value string) (*accounttypes.NetworkConfig, error)
+}
+
+// netconfApplier applies the network configuration to the running node
+// through its net manager. Only the proximity transports can be changed
+// without a restart: the Bluetooth state of the net manager is turned off
+// while they are all disabled, and restored once one of them is enabled.
+type netconfApplier struct {
+	mu       sync.Mutex
+	nm       *netmanager.NetManager
+	restore  netmanager.ConnectivityState
+	disabled bool
+}
+
+func newNetconfApplier(nm *netmanager.NetManager) *netconfApplier {
+	return &netconfApplier{nm: nm}
+}
+
+// apply returns true when the change of key took effect at once.
+func (a *netconfApplier) apply(key string, config *accounttypes.NetworkConfig) bool {
+	if a.nm == nil || !netconf.IsProximity(key) {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state := a.nm.GetCurrentState()
+	switch disabled := netconf.ProximityDisabled(config); {
+	case disabled && !a.disabled:
+		a.restore, a.disabled = state.Bluetooth, true
+		state.Bluetooth = netmanager.ConnectivityStateOff
+	case !disabled && a.disabled:
+		state.Bluetooth, a.disabled = a.restore, false
+	default:
+		return true
+	}
+
+	a.nm.UpdateState(state)
+	return true
+}
+
+// netconfShowCommand lists the network configuration of the account.
+func netconfShowCommand(ctx context.Context, v *groupView, cmd string) error {
+	editor := v.v.accounts.opts.NetworkConfig
+	if editor == nil {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the network configuration is only available with an in-process node"))
+	}
+
+	if strings.TrimSpace(cmd) != "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /netconf show"))
+	}
+
+	config, err := editor.NetworkConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range netconf.Settings(config) {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(fmt.Sprintf("%s = %s (%s)", s.Key, s.Value, s.Help)),
+		})
+	}
+
+	return nil
+}
+
+// netconfSetCommand changes a setting of the network configuration, e.g.
+// `/netconf set mdns off`.
+func netconfSetCommand(ctx context.Context, v *groupView, cmd string) error {
+	editor := v.v.accounts.opts.NetworkConfig
+	if editor == nil {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the network configuration is only available with an in-process node"))
+	}
+
+	key, value, ok := strings.Cut(strings.TrimSpace(cmd), " ")
+	if !ok || strings.TrimSpace(value) == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /netconf set <key> <value>, the keys are: %s", strings.Join(netconf.Keys(), ", ")))
+	}
+
+	config, err := editor.Set(ctx, key, value)
+	if err != nil {
+		return err
+	}
+
+	status := "saved for the account, applied the next time the app starts it"
+	if v.v.accounts.netconf.apply(key, config) {
+		status = "saved and applied"
+	}
+
+	for _, s := range netconf.Settings(config) {
+		if s.Key == key {
+			v.messages.Append(&historyMessage{
+				messageType: messageTypeMeta,
+				payload:     []byte(fmt.Sprintf("%s = %s, %s", s.Key, s.Value, status)),
+			})
+		}
+	}
+
+	return nil
+}
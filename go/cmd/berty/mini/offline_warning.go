@@ -0,0 +1,62 @@
+package mini
+
+import (
+	"encoding/base64"
+	"sync/atomic"
+
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+const offlineWarning = "no peer of the group is connected and no replication server stores it, the message will send when peers are available"
+
+// trackReplication records whether a replication server stores a
+// conversation, as told by the conversation updates of the event stream.
+func (v *tabbedGroupsView) trackReplication(c *messengertypes.Conversation) {
+	if len(c.GetReplicationInfo()) > 0 {
+		v.replicatedGroups.Store(c.GetPublicKey(), true)
+	}
+}
+
+func (v *tabbedGroupsView) isReplicated(groupPK string) bool {
+	_, ok := v.replicatedGroups.Load(groupPK)
+	return ok
+}
+
+// hasConnectedPeer returns true when a device of the group is connected,
+// according to the group device status events.
+func (v *groupView) hasConnectedPeer() bool {
+	v.muAggregates.Lock()
+	defer v.muAggregates.Unlock()
+
+	for _, p := range v.peers {
+		if p.connected {
+			return true
+		}
+	}
+	return false
+}
+
+// warnIfUnreachable shows a one-line warning before a message is sent to a
+// group which no one would receive now: no device of the group is connected
+// and no replication server stores it. The warning is shown once, until a
+// device of the group connects. The messages of the account group are notes
+// to self, they are never warned about.
+func (v *groupView) warnIfUnreachable() {
+	if v.g.GroupType == protocoltypes.GroupTypeAccount {
+		return
+	}
+
+	if v.hasConnectedPeer() || v.v.isReplicated(base64.RawURLEncoding.EncodeToString(v.g.PublicKey)) {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&v.offlineWarned, 0, 1) {
+		return
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(offlineWarning),
+	})
+}
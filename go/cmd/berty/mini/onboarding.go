@@ -0,0 +1,141 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/gdamore/tcell/terminfo"
+	"github.com/rivo/tview"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// OnboardingProfile is a network profile offered by the onboarding wizard.
+type OnboardingProfile struct {
+	// Preset is applied to the node, see `berty mini -preset`.
+	Preset      string
+	Name        string
+	Description string
+}
+
+// Onboarding is what was chosen in the onboarding wizard.
+type Onboarding struct {
+	DisplayName string
+	// Passphrase is optional, it encrypts the contact link shown once mini
+	// is started.
+	Passphrase string
+	Profile    OnboardingProfile
+}
+
+// RunOnboarding walks through the creation of an account, before the node
+// is started. It returns nil when the user quits.
+func RunOnboarding(defaultDisplayName string, profiles []OnboardingProfile, currentPreset string) (*Onboarding, error) {
+	if len(profiles) == 0 {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("no network profile"))
+	}
+
+	if _, err := terminfo.LookupTerminfo(os.Getenv("TERM")); err != nil {
+		return nil, errcode.ErrCLINoTermcaps.Wrap(err)
+	}
+
+	app := tview.NewApplication()
+
+	var (
+		result       *Onboarding
+		displayName  = defaultDisplayName
+		passphrase   string
+		confirmation string
+		profile      int
+	)
+
+	options := make([]string, len(profiles))
+	for i, p := range profiles {
+		options[i] = p.Name + ": " + p.Description
+		if p.Preset == currentPreset {
+			profile = i
+		}
+	}
+
+	intro := tview.NewTextView().SetDynamicColors(true).SetWordWrap(true).
+		SetText("[::b]Welcome to berty mini[::-]\n\nNo account was found, let's create one. " +
+			"The passphrase is optional, it encrypts the contact link shown once the account is created, " +
+			"share it separately from the link.")
+	errView := tview.NewTextView().SetTextColor(tcell.ColorOrangeRed)
+
+	form := tview.NewForm().
+		AddInputField("Display name", displayName, 40, nil, func(text string) { displayName = text }).
+		AddPasswordField("Link passphrase", "", 40, '*', func(text string) { passphrase = text }).
+		AddPasswordField("Confirm passphrase", "", 40, '*', func(text string) { confirmation = text }).
+		AddDropDown("Network profile", options, profile, func(_ string, index int) { profile = index })
+
+	form.AddButton("Create account", func() {
+		name := strings.TrimSpace(displayName)
+		switch {
+		case name == "":
+			errView.SetText("the display name cannot be empty")
+		case passphrase != confirmation:
+			errView.SetText("the passphrases do not match")
+		default:
+			result = &Onboarding{
+				DisplayName: name,
+				Passphrase:  passphrase,
+				Profile:     profiles[profile],
+			}
+			app.Stop()
+		}
+	})
+	form.AddButton("Quit", app.Stop)
+	form.SetCancelFunc(app.Stop)
+	form.SetBorder(true).SetTitle(" New account ")
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(intro, 5, 0, false).
+		AddItem(form, 13, 0, true).
+		AddItem(errView, 1, 0, false).
+		AddItem(nil, 0, 1, false)
+
+	if err := app.SetRoot(layout, true).SetFocus(form).Run(); err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+
+	return result, nil
+}
+
+// showOnboardingLink welcomes the user of a new account with its contact
+// link.
+func showOnboardingLink(ctx context.Context, v *groupView, onboarding *Onboarding) {
+	meta := func(text string) {
+		v.syncMessages <- &historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(text),
+		}
+	}
+
+	meta(fmt.Sprintf("welcome %s, your account was created with the %q network profile", onboarding.DisplayName, onboarding.Profile.Name))
+	if onboarding.Profile.Preset != "" {
+		meta(fmt.Sprintf("pass -preset=%s to keep this profile on the next runs", onboarding.Profile.Preset))
+	}
+
+	res, err := v.v.messenger.InstanceShareableBertyID(ctx, &messengertypes.InstanceShareableBertyID_Request{
+		DisplayName: onboarding.DisplayName,
+		Passphrase:  []byte(onboarding.Passphrase),
+	})
+	if err != nil {
+		v.messages.AppendErr(err)
+		return
+	}
+
+	if onboarding.Passphrase != "" {
+		meta("share your contact link, encrypted with your passphrase, to be added as a contact:")
+	} else {
+		meta("share your contact link to be added as a contact, /contact share qr shows it again:")
+	}
+	renderText(v, res.WebURL)
+	for _, line := range stringAsQR(res.WebURL) {
+		meta(line)
+	}
+}
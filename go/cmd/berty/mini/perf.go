@@ -0,0 +1,278 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+const (
+	perfRefreshInterval = 3 * time.Second
+	perfPanelHeight     = 4
+)
+
+// runtime/metrics names read by the panel, see `go doc runtime/metrics`.
+const (
+	perfMetricHeap       = "/memory/classes/heap/objects:bytes"
+	perfMetricTotal      = "/memory/classes/total:bytes"
+	perfMetricGoroutines = "/sched/goroutines:goroutines"
+	perfMetricGCCycles   = "/gc/cycles/total:gc-cycles"
+	perfMetricGCPauses   = "/gc/pauses:seconds"
+	perfMetricCPUTotal   = "/cpu/classes/total:cpu-seconds"
+	perfMetricCPUIdle    = "/cpu/classes/idle:cpu-seconds"
+)
+
+// perfSample is a snapshot of the runtime metrics of the process.
+type perfSample struct {
+	at         time.Time
+	heap       uint64
+	total      uint64
+	goroutines uint64
+	gcCycles   uint64
+	gcPauses   *metrics.Float64Histogram
+	cpuUsed    float64
+	openFiles  int
+}
+
+func readPerfSample() *perfSample {
+	samples := []metrics.Sample{
+		{Name: perfMetricHeap},
+		{Name: perfMetricTotal},
+		{Name: perfMetricGoroutines},
+		{Name: perfMetricGCCycles},
+		{Name: perfMetricGCPauses},
+		{Name: perfMetricCPUTotal},
+		{Name: perfMetricCPUIdle},
+	}
+	metrics.Read(samples)
+
+	s := &perfSample{at: time.Now(), openFiles: countOpenFiles()}
+	var cpuTotal, cpuIdle float64
+	for _, sample := range samples {
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			v := sample.Value.Uint64()
+			switch sample.Name {
+			case perfMetricHeap:
+				s.heap = v
+			case perfMetricTotal:
+				s.total = v
+			case perfMetricGoroutines:
+				s.goroutines = v
+			case perfMetricGCCycles:
+				s.gcCycles = v
+			}
+		case metrics.KindFloat64:
+			v := sample.Value.Float64()
+			switch sample.Name {
+			case perfMetricCPUTotal:
+				cpuTotal = v
+			case perfMetricCPUIdle:
+				cpuIdle = v
+			}
+		case metrics.KindFloat64Histogram:
+			s.gcPauses = sample.Value.Float64Histogram()
+		}
+	}
+	s.cpuUsed = cpuTotal - cpuIdle
+
+	return s
+}
+
+// countOpenFiles returns -1 where the descriptors of the process cannot be
+// listed.
+func countOpenFiles() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+// gcPausesSince returns the number of GC pauses since prev, and the upper
+// bound of the bucket of the longest one.
+func (s *perfSample) gcPausesSince(prev *perfSample) (count uint64, longest time.Duration) {
+	if s.gcPauses == nil {
+		return 0, 0
+	}
+
+	for i, n := range s.gcPauses.Counts {
+		if prev != nil && prev.gcPauses != nil && i < len(prev.gcPauses.Counts) {
+			n -= prev.gcPauses.Counts[i]
+		}
+		if n == 0 {
+			continue
+		}
+
+		count += n
+		// Buckets[i+1] is the exclusive upper bound of Counts[i]
+		if upper := s.gcPauses.Buckets[i+1]; upper < 3600 {
+			longest = time.Duration(upper * float64(time.Second))
+		}
+	}
+
+	return count, longest
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func formatSignedBytes(n int64) string {
+	if n < 0 {
+		return "-" + formatBytes(uint64(-n))
+	}
+	return "+" + formatBytes(uint64(n))
+}
+
+// formatPerf renders cur, with the rates since prev and the growth since
+// first to spot leaks, and the redraws of the histories.
+func formatPerf(first, prev, cur *perfSample, remote bool, drawn, dropped uint64) string {
+	b := &strings.Builder{}
+
+	title := "this process runs the node"
+	if remote {
+		title = "this process only, the node runs in the remote daemon"
+	}
+	fmt.Fprintf(b, "[::b]Performance[::-] (%s, refreshed every %s, Ctrl+P to close)\n", title, perfRefreshInterval)
+
+	cpu := "n/a"
+	if prev != nil {
+		if elapsed := cur.at.Sub(prev.at).Seconds(); elapsed > 0 {
+			cpu = fmt.Sprintf("%.1f%%", (cur.cpuUsed-prev.cpuUsed)/elapsed*100)
+		}
+	}
+
+	openFiles := "n/a"
+	if cur.openFiles >= 0 {
+		openFiles = fmt.Sprintf("%d", cur.openFiles)
+	}
+
+	fmt.Fprintf(b, "CPU %s   heap %s (%s)   runtime total %s   goroutines %d (%+d)   open files %s\n",
+		cpu,
+		formatBytes(cur.heap), formatSignedBytes(int64(cur.heap)-int64(first.heap)),
+		formatBytes(cur.total),
+		cur.goroutines, int64(cur.goroutines)-int64(first.goroutines),
+		openFiles,
+	)
+
+	pauses, longest := cur.gcPausesSince(prev)
+	fmt.Fprintf(b, "GC %d cycles, %d pause(s) since the last refresh", cur.gcCycles, pauses)
+	if pauses > 0 {
+		fmt.Fprintf(b, ", longest under %s", longest)
+	}
+	fmt.Fprintf(b, "   (growth since the panel was first opened at %s)\n", first.at.Format("15:04:05"))
+
+	fmt.Fprintf(b, "redraws %d, %d dropped frames (the updates of the histories are drawn at most every %s)", drawn, dropped, redrawInterval)
+
+	return b.String()
+}
+
+// perfPanel shows the runtime metrics of the process above the input, it
+// samples them only while it is visible.
+type perfPanel struct {
+	app     *tview.Application
+	view    *tview.TextView
+	layout  *tview.Flex
+	remote  bool
+	redraws *redrawThrottle
+
+	mu      sync.Mutex
+	visible bool
+	first   *perfSample
+	prev    *perfSample
+	wake    chan struct{}
+}
+
+func newPerfPanel(app *tview.Application, remote bool, redraws *redrawThrottle) *perfPanel {
+	view := tview.NewTextView().SetDynamicColors(true)
+	view.SetBackgroundColor(tcell.ColorDarkSlateGray)
+
+	return &perfPanel{
+		app:     app,
+		view:    view,
+		remote:  remote,
+		redraws: redraws,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// attachTo adds the panel, hidden until toggled, to layout.
+func (p *perfPanel) attachTo(layout *tview.Flex) {
+	p.layout = layout
+	layout.AddItem(p.view, 0, 0, false)
+}
+
+// Toggle shows or hides the panel.
+func (p *perfPanel) Toggle() {
+	p.mu.Lock()
+	p.visible = !p.visible
+	visible := p.visible
+	// the CPU usage is averaged between two refreshes, not over the time the
+	// panel was hidden
+	p.prev = nil
+	p.mu.Unlock()
+
+	size := 0
+	if visible {
+		size = perfPanelHeight
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	if p.layout != nil {
+		p.layout.ResizeItem(p.view, size, 0)
+	}
+}
+
+func (p *perfPanel) run(ctx context.Context) {
+	ticker := time.NewTicker(perfRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+
+		p.mu.Lock()
+		if !p.visible {
+			p.mu.Unlock()
+			continue
+		}
+
+		cur := readPerfSample()
+		if p.first == nil {
+			p.first = cur
+		}
+		drawn, dropped := p.redraws.Stats()
+		text := formatPerf(p.first, p.prev, cur, p.remote, drawn, dropped)
+		p.prev = cur
+		p.mu.Unlock()
+
+		p.app.QueueUpdateDraw(func() {
+			p.view.SetText(text)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package mini
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// pingCommand pings the contact of the current group, or the contact with
+// the given name.
+func pingCommand(ctx context.Context, v *groupView, cmd string) error {
+	groupPK := v.g.PublicKey
+	if cmd != "" {
+		var err error
+		if groupPK, err = v.v.resolveContactGroup(cmd); err != nil {
+			return err
+		}
+	} else if v.g.GroupType != protocoltypes.GroupTypeContact {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /ping <contact name>, or /ping in a contact group"))
+	}
+
+	contactPK, err := contactPKForGroup(ctx, v.v, groupPK)
+	if err != nil {
+		return err
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte("ping sent, waiting for a pong..."),
+	})
+
+	// the pong can take a while, do not block the input
+	go func() {
+		res, err := v.v.messenger.PingContact(ctx, &messengertypes.PingContact_Request{ContactPublicKey: base64.RawURLEncoding.EncodeToString(contactPK)})
+		if err != nil {
+			v.messages.AppendErr(fmt.Errorf("ping failed: %w", err))
+			return
+		}
+
+		devicePK, _ := base64.RawURLEncoding.DecodeString(res.DevicePublicKey)
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			sender:      devicePK,
+			payload:     []byte(fmt.Sprintf("pong in %s over %s", time.Duration(res.RoundTrip)*time.Millisecond, res.Transport)),
+		})
+	}()
+
+	return nil
+}
+
+// contactPKForGroup finds the contact of a contact group.
+func contactPKForGroup(ctx context.Context, v *tabbedGroupsView, groupPK []byte) ([]byte, error) {
+	v.lock.RLock()
+	contactPKs := make([][]byte, 0, len(v.contactStates))
+	for contactPK, state := range v.contactStates {
+		if state == protocoltypes.ContactStateAdded {
+			contactPKs = append(contactPKs, []byte(contactPK))
+		}
+	}
+	v.lock.RUnlock()
+
+	for _, contactPK := range contactPKs {
+		info, err := v.protocol.GroupInfo(ctx, &protocoltypes.GroupInfo_Request{ContactPK: contactPK})
+		if err != nil {
+			continue
+		}
+
+		if bytes.Equal(info.GetGroup().GetPublicKey(), groupPK) {
+			return contactPK, nil
+		}
+	}
+
+	return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("no accepted contact for this group"))
+}
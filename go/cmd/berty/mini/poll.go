@@ -0,0 +1,262 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"berty.tech/berty/v2/go/pkg/appmessage"
+	"berty.tech/berty/v2/go/pkg/bertymessenger"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// pollState is a poll of the group and the votes targeting it, poll is nil
+// until the poll itself is received.
+type pollState struct {
+	poll    *appmessage.Poll
+	message *historyMessage
+	ballots []pollBallot
+}
+
+// pollBallot is a received vote, the voter is resolved to its member when
+// counting, the device may not be known yet when the vote is received.
+type pollBallot struct {
+	devicePK []byte
+	sentDate int64
+	vote     appmessage.PollVote
+}
+
+// pollCommand sends a poll, e.g. /poll "Where to eat?" pizza "sushi bar",
+// -multi allows several choices and -closes <duration> closes it after the
+// duration.
+func pollCommand(ctx context.Context, v *groupView, cmd string) error {
+	usage := errcode.ErrMissingInput.Wrap(fmt.Errorf(`usage: /poll [-multi] [-closes <duration>] "<question>" <option> <option>...`))
+
+	args, err := splitQuoted(cmd)
+	if err != nil {
+		return err
+	}
+
+	poll := appmessage.Poll{}
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-multi":
+			poll.MultipleChoice = true
+			args = args[1:]
+		case "-closes":
+			if len(args) < 2 {
+				return usage
+			}
+			d, err := time.ParseDuration(args[1])
+			if err != nil || d <= 0 {
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid duration %q", args[1]))
+			}
+			poll.ClosesAt = time.Now().Add(d).UnixMilli()
+			args = args[2:]
+		default:
+			return usage
+		}
+	}
+
+	if len(args) == 0 {
+		return usage
+	}
+	poll.Question, poll.Options = args[0], args[1:]
+
+	req, err := appmessage.InteractRequest(base64.RawURLEncoding.EncodeToString(v.g.PublicKey), poll)
+	if err != nil {
+		return err
+	}
+
+	_, err = v.v.messenger.Interact(ctx, req)
+	return err
+}
+
+// voteCommand votes on the last poll of the group, the options are numbered
+// from 1 as displayed.
+func voteCommand(ctx context.Context, v *groupView, cmd string) error {
+	args := strings.Fields(cmd)
+	if len(args) == 0 {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /vote <option number>..."))
+	}
+
+	vote := appmessage.PollVote{}
+	for _, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid option number %q", arg))
+		}
+		vote.Choices = append(vote.Choices, n-1)
+	}
+
+	v.muAggregates.Lock()
+	pollCID, closesAt := v.lastPollCID, int64(0)
+	if state := v.polls[pollCID]; state != nil && state.poll != nil {
+		closesAt = state.poll.ClosesAt
+	}
+	v.muAggregates.Unlock()
+
+	if pollCID == "" {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("no poll in this group yet"))
+	}
+
+	if closesAt > 0 && time.Now().UnixMilli() >= closesAt {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the poll is closed"))
+	}
+
+	req, err := appmessage.InteractRequest(base64.RawURLEncoding.EncodeToString(v.g.PublicKey), vote)
+	if err != nil {
+		return err
+	}
+	req.TargetCID = pollCID
+
+	_, err = v.v.messenger.Interact(ctx, req)
+	return err
+}
+
+// trackPoll records the received polls and votes, the message of a poll
+// displays its results, updated with each vote. It returns true for a vote,
+// which is not an edit of the poll.
+func (v *groupView) trackPoll(messageCID string, devicePK []byte, am *messengertypes.AppMessage, m *historyMessage) bool {
+	decoded, err := appmessage.Unmarshal(am.GetPayload())
+	if err != nil {
+		return false
+	}
+
+	switch msg := decoded.(type) {
+	case appmessage.Poll:
+		if messageCID == "" {
+			return false
+		}
+
+		v.muAggregates.Lock()
+		state := v.pollState(messageCID)
+		state.poll, state.message = &msg, m
+		v.lastPollCID = messageCID
+		// the message is not displayed yet
+		m.payload = []byte(v.renderPoll(state))
+		v.muAggregates.Unlock()
+
+		if until := time.Until(time.UnixMilli(msg.ClosesAt)); msg.ClosesAt > 0 && until > 0 {
+			time.AfterFunc(until, func() { v.refreshPoll(messageCID) })
+		}
+
+		return false
+
+	case appmessage.PollVote:
+		if am.GetTargetCID() == "" {
+			return false
+		}
+
+		v.muAggregates.Lock()
+		state := v.pollState(am.GetTargetCID())
+		state.ballots = append(state.ballots, pollBallot{devicePK: devicePK, sentDate: am.GetSentDate(), vote: msg})
+		v.muAggregates.Unlock()
+
+		v.refreshPoll(am.GetTargetCID())
+
+		return true
+	}
+
+	return false
+}
+
+// refreshPoll renders again the results of a poll, e.g. when it closes.
+func (v *groupView) refreshPoll(pollCID string) {
+	v.muAggregates.Lock()
+	state := v.polls[pollCID]
+	text := ""
+	if state != nil && state.message != nil {
+		text = v.renderPoll(state)
+	}
+	v.muAggregates.Unlock()
+
+	if text != "" {
+		v.messages.SetText(state.message, text)
+	}
+}
+
+// pollState returns the state of a poll, created if needed. The aggregates
+// lock must be held.
+func (v *groupView) pollState(pollCID string) *pollState {
+	state, ok := v.polls[pollCID]
+	if !ok {
+		state = &pollState{}
+		v.polls[pollCID] = state
+	}
+
+	return state
+}
+
+// renderPoll returns the text of a poll and its results, the aggregates lock
+// must be held.
+func (v *groupView) renderPoll(state *pollState) string {
+	ballots := make([]bertymessenger.PollBallot, len(state.ballots))
+	for i, b := range state.ballots {
+		voter := string(b.devicePK)
+		if device, ok := v.devices[string(b.devicePK)]; ok {
+			voter = string(device.MemberPK)
+		}
+		ballots[i] = bertymessenger.PollBallot{Voter: voter, SentDate: b.sentDate, Vote: b.vote}
+	}
+
+	results := bertymessenger.TallyPoll(*state.poll, ballots, time.Now())
+
+	lines := []string{"poll: " + results.Poll.Question}
+	for i, option := range results.Poll.Options {
+		percent := 0
+		if results.Voters > 0 {
+			percent = results.Counts[i] * 100 / results.Voters
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s: %d (%d%%)", i+1, option, results.Counts[i], percent))
+	}
+
+	status := []string{fmt.Sprintf("%d voter(s)", results.Voters)}
+	if results.Poll.MultipleChoice {
+		status = append(status, "multiple choice")
+	}
+	switch {
+	case results.Closed:
+		status = append(status, "closed")
+	case results.Poll.ClosesAt > 0:
+		status = append(status, "closes at "+time.UnixMilli(results.Poll.ClosesAt).Format("15:04:05"))
+	}
+	lines = append(lines, strings.Join(status, ", "))
+
+	return strings.Join(lines, "\n")
+}
+
+// splitQuoted splits s on spaces, the double-quoted parts are kept whole.
+func splitQuoted(s string) ([]string, error) {
+	args := []string(nil)
+	arg, started, quoted := strings.Builder{}, false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted, started = !quoted, true
+		case unicode.IsSpace(r) && !quoted:
+			if started {
+				args = append(args, arg.String())
+				arg.Reset()
+				started = false
+			}
+		default:
+			arg.WriteRune(r)
+			started = true
+		}
+	}
+
+	if quoted {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unterminated quote"))
+	}
+	if started {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
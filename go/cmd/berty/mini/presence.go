@@ -0,0 +1,215 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/pkg/bertymessenger"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/lifecycle"
+)
+
+// PresencePublisher shares the presence of the account with its contacts,
+// it is implemented by the in-process messenger service.
+type PresencePublisher interface {
+	SetPresence(ctx context.Context, presence bertymessenger.Presence) error
+	ContactPresences() map[string]bertymessenger.ContactPresence
+}
+
+// presenceTimeout bounds the publication of a presence to the contacts.
+const presenceTimeout = 30 * time.Second
+
+// awayTimer marks the user away after Opts.AwayAfter without keyboard input,
+// or with /presence away, and active again on the next key. Being away is
+// published to the contacts and, with Opts.InactiveWhenAway, switches the
+// node to the inactive state. The changes are applied in order by run.
+type awayTimer struct {
+	accounts *accountManager
+
+	mu        sync.Mutex
+	timer     *time.Timer
+	away      bool
+	manual    bool
+	awaySince time.Time
+	wake      chan struct{}
+}
+
+func newAwayTimer(accounts *accountManager) *awayTimer {
+	return &awayTimer{
+		accounts: accounts,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// start arms the timer, the user is never marked away automatically when
+// Opts.AwayAfter is zero.
+func (t *awayTimer) start() {
+	after := t.accounts.opts.AwayAfter
+	if after <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.timer = time.AfterFunc(after, func() { t.set(true, false) })
+}
+
+func (t *awayTimer) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// activity is called on each key, it rearms the timer and ends an automatic
+// away.
+func (t *awayTimer) activity() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Reset(t.accounts.opts.AwayAfter)
+	}
+
+	if t.away && !t.manual {
+		t.away = false
+		t.notify()
+	}
+}
+
+// set marks the user away or active, a manual away lasts until /presence
+// active.
+func (t *awayTimer) set(away bool, manual bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if away && !t.away {
+		t.awaySince = time.Now()
+	}
+	t.away, t.manual = away, away && manual
+	t.notify()
+}
+
+// notify wakes run up, the lock must be held.
+func (t *awayTimer) notify() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (t *awayTimer) state() (bool, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.away, t.awaySince
+}
+
+// run publishes the changes of presence until ctx is done.
+func (t *awayTimer) run(ctx context.Context) {
+	opts := t.accounts.opts
+	published := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.wake:
+		}
+
+		away, _ := t.state()
+		if away == published {
+			continue
+		}
+		published = away
+
+		// the sync is lowered once the contacts know, and restored before
+		// telling them
+		lowerSync := opts.InactiveWhenAway && opts.LifecycleManager != nil
+		if lowerSync && !away {
+			opts.LifecycleManager.UpdateState(lifecycle.StateActive)
+		}
+
+		if opts.PresencePublisher != nil {
+			presence := bertymessenger.PresenceActive
+			if away {
+				presence = bertymessenger.PresenceAway
+			}
+
+			publishCtx, cancel := context.WithTimeout(ctx, presenceTimeout)
+			if err := opts.PresencePublisher.SetPresence(publishCtx, presence); err != nil && opts.Logger != nil {
+				opts.Logger.Warn("unable to publish the presence", zap.String("presence", string(presence)), zap.Error(err))
+			}
+			cancel()
+		}
+
+		if lowerSync && away {
+			opts.LifecycleManager.UpdateState(lifecycle.StateInactive)
+		}
+	}
+}
+
+// presenceCommand shows the presence of the user and of the contacts,
+// /presence away and /presence active change the one of the user.
+func presenceCommand(_ context.Context, v *groupView, cmd string) error {
+	away := v.v.accounts.away
+
+	switch strings.TrimSpace(cmd) {
+	case "":
+	case "away":
+		away.set(true, true)
+	case "active":
+		away.set(false, false)
+	default:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /presence [away|active]"))
+	}
+
+	lines := []string{}
+	if isAway, since := away.state(); isAway {
+		lines = append(lines, "you are away since "+since.Format("15:04:05"))
+	} else {
+		lines = append(lines, "you are active")
+	}
+
+	publisher := v.v.accounts.opts.PresencePublisher
+	if publisher == nil {
+		lines = append(lines, "the presence is only shared with the contacts with an in-process node")
+	} else {
+		contacts := []string(nil)
+
+		v.v.lock.RLock()
+		for conversationPK, p := range publisher.ContactPresences() {
+			gpk, err := base64.RawURLEncoding.DecodeString(conversationPK)
+			if err != nil {
+				continue
+			}
+
+			name, ok := v.v.contactNames[string(gpk)]
+			if !ok {
+				name = pkAsShortID(gpk)
+			}
+			contacts = append(contacts, fmt.Sprintf("%s is %s since %s", name, p.Presence, p.Since.Format("15:04:05")))
+		}
+		v.v.lock.RUnlock()
+
+		sort.Strings(contacts)
+		lines = append(lines, contacts...)
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(strings.Join(lines, "\n")),
+	})
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// privacyRevealDuration is how long Ctrl+R reveals the masked messages.
+const privacyRevealDuration = 10 * time.Second
+
+// privacyMode masks the text of the messages of all the accounts, e.g.
+// while sharing the screen, until they are revealed for a moment.
+type privacyMode struct {
+	mu       sync.Mutex
+	enabled  bool
+	revealed bool
+	timer    *time.Timer
+	// apply updates the displayed messages
+	apply func(masked bool)
+}
+
+func newPrivacyMode(apply func(masked bool)) *privacyMode {
+	return &privacyMode{apply: apply}
+}
+
+// Masked returns true when the messages must be masked.
+func (p *privacyMode) Masked() bool {
+	if p == nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.enabled && !p.revealed
+}
+
+// SetEnabled turns the privacy mode on or off.
+func (p *privacyMode) SetEnabled(enabled bool) {
+	p.mu.Lock()
+	p.enabled = enabled
+	p.hideLocked()
+	p.mu.Unlock()
+
+	p.apply(enabled)
+}
+
+// ToggleReveal reveals the messages for privacyRevealDuration, or masks them
+// again if they are revealed. It returns false when the privacy mode is off.
+func (p *privacyMode) ToggleReveal() bool {
+	p.mu.Lock()
+	if !p.enabled {
+		p.mu.Unlock()
+		return false
+	}
+
+	if p.revealed {
+		p.hideLocked()
+		p.mu.Unlock()
+		p.apply(true)
+		return true
+	}
+
+	p.revealed = true
+	var timer *time.Timer
+	timer = time.AfterFunc(privacyRevealDuration, func() {
+		p.mu.Lock()
+		// ignore the timers stopped too late
+		if p.timer != timer {
+			p.mu.Unlock()
+			return
+		}
+		p.hideLocked()
+		p.mu.Unlock()
+
+		p.apply(true)
+	})
+	p.timer = timer
+	p.mu.Unlock()
+
+	p.apply(false)
+	return true
+}
+
+func (p *privacyMode) hideLocked() {
+	p.revealed = false
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+}
+
+func privacyCommand(_ context.Context, v *groupView, cmd string) error {
+	var enabled bool
+	switch strings.ToLower(cmd) {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /privacy on|off"))
+	}
+
+	v.v.accounts.privacy.SetEnabled(enabled)
+
+	text := "privacy mode off"
+	if enabled {
+		text = fmt.Sprintf("privacy mode on, Ctrl+R reveals the messages for %s", privacyRevealDuration)
+	}
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(text),
+	})
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// ProfileHider keeps the display name of the account private, it is
+// implemented by the in-process messenger service.
+type ProfileHider interface {
+	HideProfile() bool
+	SetHideProfile(ctx context.Context, hide bool) error
+}
+
+// publishedDisplayName returns the display name sent along the contact
+// requests, it is empty while the profile is hidden.
+func (v *tabbedGroupsView) publishedDisplayName() string {
+	if hider := v.accounts.opts.ProfileHider; hider != nil && hider.HideProfile() {
+		return ""
+	}
+
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	return v.displayName
+}
+
+// profileCommand shows whether the display name is published, /profile hide
+// and /profile show change it for the account.
+func profileCommand(ctx context.Context, v *groupView, cmd string) error {
+	hider := v.v.accounts.opts.ProfileHider
+	if hider == nil {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the profile privacy is only available with an in-process node"))
+	}
+
+	switch strings.TrimSpace(cmd) {
+	case "":
+	case "hide":
+		if err := hider.SetHideProfile(ctx, true); err != nil {
+			return err
+		}
+	case "show":
+		if err := hider.SetHideProfile(ctx, false); err != nil {
+			return err
+		}
+	default:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /profile [hide|show]"))
+	}
+
+	status := "your display name is published in your contact links, contact requests and conversations"
+	if hider.HideProfile() {
+		status = "your display name is hidden, your contacts see a short public key instead"
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(status),
+	})
+
+	return nil
+}
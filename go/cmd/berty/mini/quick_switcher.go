@@ -0,0 +1,276 @@
+package mini
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// quickSwitchMaxResults bounds the conversations listed by the quick
+// switcher, the query narrows them down.
+const quickSwitchMaxResults = 8
+
+// quickSwitchEntry is a conversation the quick switcher can jump to.
+type quickSwitchEntry struct {
+	kind  string
+	label string
+	group *groupView
+}
+
+// quickSwitchEntries returns the conversations of the account, in the order
+// of the sidebar.
+func (v *tabbedGroupsView) quickSwitchEntries() []quickSwitchEntry {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	entries := []quickSwitchEntry{{kind: "account", label: "Account", group: v.accountGroupView}}
+
+	for _, cg := range v.contactGroupViews {
+		label := pkAsShortID(cg.g.PublicKey)
+		if name, ok := v.contactNames[string(cg.g.PublicKey)]; ok && name != "" {
+			label = fmt.Sprintf("%s %s", name, label)
+		}
+		entries = append(entries, quickSwitchEntry{kind: "contact", label: label, group: cg})
+	}
+
+	for _, cg := range v.multiMembersGroupViews {
+		label := pkAsShortID(cg.g.PublicKey)
+		if topic := cg.profile.Profile().Topic; topic != "" {
+			label = fmt.Sprintf("%s %s", topic, label)
+		}
+		entries = append(entries, quickSwitchEntry{kind: "group", label: label, group: cg})
+	}
+
+	return entries
+}
+
+// SelectGroup displays the conversation of vg.
+func (v *tabbedGroupsView) SelectGroup(vg *groupView) {
+	v.lock.Lock()
+	defer v.recomputeChannelList(true)
+	defer v.lock.Unlock()
+
+	v.selectedInvitation = nil
+	v.bookmarksSelected = false
+	v.selectedGroupView = vg
+	atomic.StoreInt32(&vg.hasNew, 0)
+}
+
+// fuzzyScore returns how well query matches label, case insensitively. The
+// letters of query must appear in label in the same order, consecutive
+// letters and letters starting a word score higher.
+func fuzzyScore(query, label string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	l := []rune(strings.ToLower(label))
+
+	score, qi, prev := 0, 0, -2
+	for i := 0; i < len(l) && qi < len(q); i++ {
+		if l[i] != q[qi] {
+			continue
+		}
+
+		score++
+		if i == prev+1 {
+			score += 2
+		}
+		if i == 0 || !unicode.IsLetter(l[i-1]) && !unicode.IsDigit(l[i-1]) {
+			score += 3
+		}
+		prev = i
+		qi++
+	}
+
+	if qi < len(q) {
+		return 0, false
+	}
+
+	return score, true
+}
+
+// fuzzyFilter returns the entries matching query, the best matches first.
+func fuzzyFilter(query string, entries []quickSwitchEntry) []quickSwitchEntry {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return entries
+	}
+
+	type scored struct {
+		entry quickSwitchEntry
+		score int
+	}
+
+	matches := []scored(nil)
+	for _, entry := range entries {
+		if score, ok := fuzzyScore(query, entry.label); ok {
+			matches = append(matches, scored{entry: entry, score: score})
+		}
+	}
+
+	// the sidebar order is kept between equal matches
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	filtered := make([]quickSwitchEntry, len(matches))
+	for i, m := range matches {
+		filtered[i] = m.entry
+	}
+
+	return filtered
+}
+
+// quickSwitcher lists the conversations matching the text typed in the
+// input, above it, and jumps to the selected one. The draft is restored
+// when it is closed.
+type quickSwitcher struct {
+	accounts *accountManager
+	view     *tview.TextView
+	layout   *tview.Flex
+
+	mu       sync.Mutex
+	open     bool
+	draft    string
+	matches  []quickSwitchEntry
+	selected int
+}
+
+func newQuickSwitcher(accounts *accountManager) *quickSwitcher {
+	view := tview.NewTextView().SetDynamicColors(true)
+	view.SetBackgroundColor(tcell.ColorDarkSlateGray)
+
+	return &quickSwitcher{accounts: accounts, view: view}
+}
+
+// attachTo adds the switcher, hidden until toggled, to layout.
+func (s *quickSwitcher) attachTo(layout *tview.Flex) {
+	s.layout = layout
+	layout.AddItem(s.view, 0, 0, false)
+
+	s.accounts.input.SetChangedFunc(func(text string) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.open {
+			s.refresh(text)
+		}
+	})
+}
+
+// IsOpen returns true while the switcher is displayed.
+func (s *quickSwitcher) IsOpen() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.open
+}
+
+// Toggle opens the switcher, or closes it without jumping.
+func (s *quickSwitcher) Toggle() {
+	if s.IsOpen() {
+		s.close(nil)
+		return
+	}
+
+	s.mu.Lock()
+	s.open = true
+	s.draft = s.accounts.input.GetText()
+	s.mu.Unlock()
+
+	// triggers the changed func, which lists all the conversations
+	s.accounts.input.SetText("")
+	if s.layout != nil {
+		s.layout.ResizeItem(s.view, quickSwitchMaxResults+1, 0)
+	}
+}
+
+// HandleKey handles the keys moving the selection, jumping or closing the
+// switcher, the other ones are returned to edit the query.
+func (s *quickSwitcher) HandleKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEsc:
+		s.close(nil)
+	case tcell.KeyEnter:
+		s.mu.Lock()
+		var target *groupView
+		if s.selected < len(s.matches) {
+			target = s.matches[s.selected].group
+		}
+		s.mu.Unlock()
+		s.close(target)
+	case tcell.KeyUp, tcell.KeyCtrlP:
+		s.moveSelection(-1)
+	case tcell.KeyDown, tcell.KeyCtrlN, tcell.KeyTab:
+		s.moveSelection(+1)
+	default:
+		return event
+	}
+
+	return nil
+}
+
+func (s *quickSwitcher) moveSelection(step int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.matches) == 0 {
+		return
+	}
+
+	s.selected = (s.selected + step + len(s.matches)) % len(s.matches)
+	s.render()
+}
+
+// close hides the switcher and restores the draft, then displays target if
+// it is set.
+func (s *quickSwitcher) close(target *groupView) {
+	s.mu.Lock()
+	s.open = false
+	draft := s.draft
+	s.matches = nil
+	s.mu.Unlock()
+
+	if s.layout != nil {
+		s.layout.ResizeItem(s.view, 0, 0)
+	}
+	s.accounts.input.SetText(draft)
+
+	if target != nil {
+		s.accounts.Current().view.SelectGroup(target)
+	}
+}
+
+// refresh lists the conversations matching query, s.mu must be held.
+func (s *quickSwitcher) refresh(query string) {
+	s.matches = fuzzyFilter(query, s.accounts.Current().view.quickSwitchEntries())
+	s.selected = 0
+	s.render()
+}
+
+// render displays the matches around the selected one, s.mu must be held.
+func (s *quickSwitcher) render() {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "[::b]Jump to[::-] (%d match(es), Up/Down to select, Enter to jump, Esc to cancel)", len(s.matches))
+
+	first := 0
+	if s.selected >= quickSwitchMaxResults {
+		first = s.selected - quickSwitchMaxResults + 1
+	}
+
+	for i := first; i < len(s.matches) && i < first+quickSwitchMaxResults; i++ {
+		entry := s.matches[i]
+		line := fmt.Sprintf("%-8s %s", entry.kind, tview.Escape(entry.label))
+		if s.accounts.accessible() && atomic.LoadInt32(&entry.group.hasNew) == 1 {
+			line += " (new messages)"
+		}
+		if i == s.selected {
+			line = selectedLine(s.accounts, line)
+		}
+		fmt.Fprintf(b, "\n%s", line)
+	}
+
+	s.view.SetText(b.String())
+}
@@ -0,0 +1,77 @@
+package mini
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// redrawInterval is the minimum delay between two redraws of the histories,
+// about 10 per second.
+const redrawInterval = 100 * time.Millisecond
+
+// redrawThrottle coalesces the redraws requested by the histories: a burst of
+// messages in a busy group is drawn at most once per redrawInterval instead
+// of once per message. An isolated request is drawn at once.
+type redrawThrottle struct {
+	app     *tview.Application
+	pending chan struct{}
+
+	requested uint64
+	drawn     uint64
+}
+
+func newRedrawThrottle(app *tview.Application) *redrawThrottle {
+	return &redrawThrottle{
+		app:     app,
+		pending: make(chan struct{}, 1),
+	}
+}
+
+// Request schedules a redraw, it never blocks.
+func (r *redrawThrottle) Request() {
+	atomic.AddUint64(&r.requested, 1)
+
+	select {
+	case r.pending <- struct{}{}:
+	default:
+		// a redraw is already scheduled, it will include this change
+	}
+}
+
+// Stats returns the number of redraws, and the number of requests coalesced
+// into another redraw, the dropped frames.
+func (r *redrawThrottle) Stats() (drawn, dropped uint64) {
+	drawn = atomic.LoadUint64(&r.drawn)
+	requested := atomic.LoadUint64(&r.requested)
+	if requested > drawn {
+		dropped = requested - drawn
+	}
+
+	return drawn, dropped
+}
+
+func (r *redrawThrottle) run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.pending:
+		}
+
+		atomic.AddUint64(&r.drawn, 1)
+		r.app.Draw()
+		timer.Reset(redrawInterval)
+	}
+}
@@ -0,0 +1,300 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const (
+	// unackedResendAfter is how long a sent message waits for an
+	// acknowledgement before being flagged for /resend.
+	unackedResendAfter = 2 * time.Minute
+
+	// resendMarker flags the messages which were not sent or not
+	// acknowledged.
+	resendMarker = "⚠"
+)
+
+// outboxEntry is a message sent from a group view, kept until it is
+// acknowledged by another device.
+type outboxEntry struct {
+	n    int
+	body string
+	// cid is empty when sending failed
+	cid     string
+	flagged bool
+	// message is the row displaying the message, once received back
+	message *historyMessage
+}
+
+// outbox tracks the messages sent from a group view, the flagged ones are
+// numbered for /resend.
+type outbox struct {
+	mu      sync.Mutex
+	next    int
+	entries map[int]*outboxEntry
+	byCID   map[string]*outboxEntry
+}
+
+func newOutbox() *outbox {
+	return &outbox{
+		entries: map[int]*outboxEntry{},
+		byCID:   map[string]*outboxEntry{},
+	}
+}
+
+func (o *outbox) add(body, cid string) *outboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.next++
+	entry := &outboxEntry{n: o.next, body: body, cid: cid, flagged: cid == ""}
+	o.entries[entry.n] = entry
+	if cid != "" {
+		o.byCID[cid] = entry
+	}
+
+	return entry
+}
+
+func (o *outbox) remove(entry *outboxEntry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.entries, entry.n)
+	delete(o.byCID, entry.cid)
+}
+
+// displayed links a message received back to its entry, and returns the
+// number it must be flagged with.
+func (o *outbox) displayed(cid string, m *historyMessage) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, ok := o.byCID[cid]
+	if !ok {
+		return 0
+	}
+
+	entry.message = m
+	if entry.flagged {
+		return entry.n
+	}
+	return 0
+}
+
+// acknowledged forgets the entry of cid, it is returned if it was flagged.
+func (o *outbox) acknowledged(cid string) (*outboxEntry, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, ok := o.byCID[cid]
+	if !ok {
+		return nil, false
+	}
+
+	delete(o.entries, entry.n)
+	delete(o.byCID, cid)
+
+	return entry, entry.flagged
+}
+
+// flag flags the entry n if it is still waiting for an acknowledgement.
+func (o *outbox) flag(n int) (*outboxEntry, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, ok := o.entries[n]
+	if !ok || entry.flagged {
+		return nil, false
+	}
+
+	entry.flagged = true
+	return entry, true
+}
+
+// flagged returns the flagged entry n, or the last flagged one if n is 0.
+func (o *outbox) flagged(n int) *outboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if n > 0 {
+		if entry, ok := o.entries[n]; ok && entry.flagged {
+			return entry
+		}
+		return nil
+	}
+
+	var last *outboxEntry
+	for _, entry := range o.entries {
+		if entry.flagged && (last == nil || entry.n > last.n) {
+			last = entry
+		}
+	}
+
+	return last
+}
+
+func userMessageRequest(v *groupView, body string) (*messengertypes.Interact_Request, error) {
+	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{
+		Body: body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &messengertypes.Interact_Request{
+		Type:                  messengertypes.AppMessage_TypeUserMessage,
+		Payload:               payload,
+		ConversationPublicKey: base64.RawURLEncoding.EncodeToString(v.g.PublicKey),
+	}, nil
+}
+
+// sendUserMessage sends body and tracks it until it is acknowledged, a
+// message which cannot be sent is displayed flagged for /resend. It is
+// queued while the group is rate limited, see slowMode.
+func (v *groupView) sendUserMessage(ctx context.Context, body string) error {
+	if v.slow.queueIfActive(body) {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("slow mode: message queued, it is sent once the group is not rate limited anymore"),
+		})
+		return nil
+	}
+
+	return v.deliverUserMessage(ctx, body, false)
+}
+
+// deliverUserMessage sends body, requeued is true when it was already
+// queued by the slow mode.
+func (v *groupView) deliverUserMessage(ctx context.Context, body string, requeued bool) error {
+	req, err := userMessageRequest(v, body)
+	if err != nil {
+		return err
+	}
+
+	v.warnIfUnreachable()
+
+	ret, err := v.v.messenger.Interact(ctx, req)
+	if err != nil {
+		if wait, ok := rateLimitedFor(err); ok {
+			v.rateLimited(ctx, wait, body, requeued)
+			return nil
+		}
+
+		entry := v.outbox.add(body, "")
+		entry.message = &historyMessage{
+			messageType: messageTypeMessage,
+			sender:      v.devicePK,
+			payload:     []byte(body),
+			unsent:      entry.n,
+		}
+		v.messages.Append(entry.message)
+
+		return fmt.Errorf("message not sent, /resend %d retries it: %w", entry.n, err)
+	}
+
+	v.lastSentCID = ret.CID
+	v.trackSent(body, ret.CID)
+
+	return nil
+}
+
+func (v *groupView) trackSent(body, cid string) {
+	n := v.outbox.add(body, cid).n
+	time.AfterFunc(unackedResendAfter, func() {
+		entry, ok := v.outbox.flag(n)
+		if !ok {
+			return
+		}
+
+		if entry.message != nil {
+			v.messages.SetUnsent(entry.message, entry.n)
+		}
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeError,
+			payload:     []byte(fmt.Sprintf("%s message #%d was not acknowledged after %s, /resend %d sends it again", resendMarker, entry.n, unackedResendAfter, entry.n)),
+		})
+		v.addBadge()
+	})
+}
+
+// receivedBack flags the messages of this device received back from the
+// group, if needed.
+func (v *groupView) receivedBack(cid string, m *historyMessage) {
+	m.unsent = v.outbox.displayed(cid, m)
+}
+
+// receivedAck unflags the message acknowledged by another device.
+func (v *groupView) receivedAck(cid string) {
+	if entry, flagged := v.outbox.acknowledged(cid); flagged && entry.message != nil {
+		v.messages.SetUnsent(entry.message, 0)
+	}
+}
+
+func resendCommand(ctx context.Context, v *groupView, cmd string) error {
+	n := 0
+	if cmd != "" {
+		var err error
+		if n, err = strconv.Atoi(cmd); err != nil || n <= 0 {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /resend [n]"))
+		}
+	}
+
+	entry := v.outbox.flagged(n)
+	if entry == nil {
+		if n == 0 {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("no message to resend"))
+		}
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("no message #%d to resend", n))
+	}
+
+	req, err := userMessageRequest(v, entry.body)
+	if err != nil {
+		return err
+	}
+
+	// the outbox of the node retries until the message is sent, when the
+	// node schedules messages
+	scheduled, err := v.v.messenger.ScheduleInteraction(ctx, &messengertypes.ScheduleInteraction_Request{Interaction: req, SendDate: time.Now().UnixMilli()})
+	switch {
+	case err == nil:
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(fmt.Sprintf("message #%d queued in the outbox as %s, /schedule list shows its attempts", entry.n, shortScheduledID(scheduled.GetScheduled().GetID()))),
+		})
+	case !errcode.Is(err, errcode.ErrNotImplemented) && status.Code(err) != codes.Unimplemented:
+		return err
+	default:
+		ret, err := v.v.messenger.Interact(ctx, req)
+		if err != nil {
+			return fmt.Errorf("message #%d not sent: %w", entry.n, err)
+		}
+
+		v.lastSentCID = ret.CID
+		v.trackSent(entry.body, ret.CID)
+	}
+
+	v.outbox.remove(entry)
+	if entry.message != nil {
+		if entry.cid == "" {
+			// it will be received back once sent
+			v.messages.Remove(entry.message)
+		} else {
+			v.messages.SetUnsent(entry.message, 0)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const scheduledIDLength = 8
+
+// parseSendAt accepts a delay (`90m`), a time of the day (`18:30`, tomorrow
+// if already past) or a date (`2006-01-02T15:04`).
+func parseSendAt(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return time.Time{}, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the delay must be positive"))
+		}
+		return now.Add(d), nil
+	}
+
+	if t, err := time.ParseInLocation("15:04", value, now.Location()); err == nil {
+		sendAt := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !sendAt.After(now) {
+			sendAt = sendAt.AddDate(0, 0, 1)
+		}
+		return sendAt, nil
+	}
+
+	for _, layout := range []string{"2006-01-02T15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid send date %q, expected a delay, a time or a date", value))
+}
+
+func scheduleCommand(ctx context.Context, v *groupView, cmd string) error {
+	parts := strings.SplitN(cmd, " ", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /schedule <delay|time|date> <message>"))
+	}
+
+	sendAt, err := parseSendAt(parts[0], time.Now())
+	if err != nil {
+		return err
+	}
+
+	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{
+		Body: strings.TrimSpace(parts[1]),
+	})
+	if err != nil {
+		return err
+	}
+
+	reply, err := v.v.messenger.ScheduleInteraction(ctx, &messengertypes.ScheduleInteraction_Request{
+		Interaction: &messengertypes.Interact_Request{
+			Type:                  messengertypes.AppMessage_TypeUserMessage,
+			Payload:               payload,
+			ConversationPublicKey: base64.RawURLEncoding.EncodeToString(v.g.PublicKey),
+		},
+		SendDate: sendAt.UnixMilli(),
+	})
+	if err != nil {
+		return err
+	}
+
+	m := reply.GetScheduled()
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(fmt.Sprintf("message %s scheduled for %s", shortScheduledID(m.ID), time.UnixMilli(m.SendDate).Format(time.RFC1123))),
+	})
+
+	return nil
+}
+
+func scheduleListCommand(ctx context.Context, v *groupView, _ string) error {
+	messages, err := groupScheduledMessages(ctx, v)
+	if err != nil {
+		return err
+	}
+
+	if len(messages) == 0 {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("no scheduled message in this group"),
+		})
+		return nil
+	}
+
+	for _, m := range messages {
+		line := fmt.Sprintf("%s at %s: %s", shortScheduledID(m.ID), time.UnixMilli(m.DueDate).Format(time.RFC1123), scheduledBody(m))
+		if m.LastError != "" {
+			line += fmt.Sprintf(" (%d failed attempt(s): %s)", m.Attempts, m.LastError)
+		}
+
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(line),
+		})
+	}
+
+	return nil
+}
+
+func scheduleCancelCommand(ctx context.Context, v *groupView, cmd string) error {
+	if cmd == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("usage: /schedule cancel <id>"))
+	}
+
+	messages, err := groupScheduledMessages(ctx, v)
+	if err != nil {
+		return err
+	}
+
+	// listed ids are shortened, any unambiguous prefix works
+	matches := []*messengertypes.ScheduledInteraction(nil)
+	for _, m := range messages {
+		if strings.HasPrefix(m.ID, cmd) {
+			matches = append(matches, m)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("no scheduled message %q in this group", cmd))
+	case 1:
+	default:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("%q matches %d scheduled messages", cmd, len(matches)))
+	}
+
+	if _, err := v.v.messenger.CancelScheduledInteraction(ctx, &messengertypes.CancelScheduledInteraction_Request{ID: matches[0].ID}); err != nil {
+		return err
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(fmt.Sprintf("scheduled message %s cancelled", shortScheduledID(matches[0].ID))),
+	})
+
+	return nil
+}
+
+func groupScheduledMessages(ctx context.Context, v *groupView) ([]*messengertypes.ScheduledInteraction, error) {
+	reply, err := v.v.messenger.ScheduledInteractions(ctx, &messengertypes.ScheduledInteractions_Request{
+		ConversationPublicKey: base64.RawURLEncoding.EncodeToString(v.g.PublicKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.GetInteractions(), nil
+}
+
+func scheduledBody(m *messengertypes.ScheduledInteraction) string {
+	req := m.GetInteraction()
+	if req == nil {
+		return "<invalid message>"
+	}
+
+	um := &messengertypes.AppMessage_UserMessage{}
+	if req.Type != messengertypes.AppMessage_TypeUserMessage || proto.Unmarshal(req.Payload, um) != nil {
+		return fmt.Sprintf("<%s>", req.Type)
+	}
+
+	return um.Body
+}
+
+func shortScheduledID(id string) string {
+	if len(id) > scheduledIDLength {
+		return id[:scheduledIDLength]
+	}
+	return id
+}
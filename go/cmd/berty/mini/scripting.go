@@ -0,0 +1,317 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/contactspam"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const (
+	scriptExt = ".star"
+	// scriptMaxSteps bounds the work of a hook, a script stuck in a loop is
+	// canceled instead of blocking the following events.
+	scriptMaxSteps    = 10_000_000
+	scriptQueueSize   = 256
+	scriptCallTimeout = 30 * time.Second
+)
+
+// The hooks the scripts can define.
+const (
+	hookOnMessage        = "on_message"
+	hookOnContactRequest = "on_contact_request"
+)
+
+// script is a loaded Starlark file, its globals are frozen.
+type script struct {
+	name    string
+	globals starlark.StringDict
+}
+
+type scriptEvent struct {
+	hook string
+	arg  starlark.Value
+}
+
+// scriptHost runs the Starlark scripts (*.star) of Opts.ScriptsDir, turning
+// mini into a small bot. The scripts define hooks called with the live
+// events of the account mini is attached to, one event at a time:
+//
+//	on_message(msg)          msg.group, msg.group_name, msg.cid, msg.sender, msg.text
+//	on_contact_request(req)  req.contact_id, req.name, req.suspicious
+//
+// The messages sent from this device are not passed to on_message, a bot
+// cannot answer itself. The hooks act on the account with the berty module:
+//
+//	berty.send(group, text)
+//	berty.react(group, cid, emoji)
+//	berty.accept(contact_id)
+//
+// print writes to the account group. The globals of a script are frozen
+// once it is loaded, the hooks cannot keep state across events.
+type scriptHost struct {
+	accounts *accountManager
+	logger   *zap.Logger
+	scripts  []*script
+	events   chan scriptEvent
+}
+
+// loadScripts runs the scripts of dir to collect their hooks, it returns
+// nil when dir is empty.
+func loadScripts(accounts *accountManager, dir string) (*scriptHost, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to read the scripts directory: %w", err))
+	}
+
+	h := &scriptHost{
+		accounts: accounts,
+		logger:   accounts.opts.Logger.Named("scripts"),
+		events:   make(chan scriptEvent, scriptQueueSize),
+	}
+
+	predeclared := starlark.StringDict{
+		"berty": &starlarkstruct.Module{
+			Name: "berty",
+			Members: starlark.StringDict{
+				"send":   starlark.NewBuiltin("send", h.send),
+				"react":  starlark.NewBuiltin("react", h.react),
+				"accept": starlark.NewBuiltin("accept", h.accept),
+			},
+		},
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == scriptExt {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		thread := h.newThread(name)
+		globals, err := starlark.ExecFile(thread, filepath.Join(dir, name), nil, predeclared)
+		if err != nil {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to load script %s: %w", name, err))
+		}
+
+		h.scripts = append(h.scripts, &script{name: name, globals: globals})
+		h.logger.Info("script loaded", zap.String("script", name))
+	}
+
+	return h, nil
+}
+
+// run calls the hooks with the queued events until ctx is done.
+func (h *scriptHost) run(ctx context.Context) {
+	if h == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-h.events:
+			for _, s := range h.scripts {
+				h.call(s, event)
+			}
+		}
+	}
+}
+
+func (h *scriptHost) call(s *script, event scriptEvent) {
+	hook, ok := s.globals[event.hook].(starlark.Callable)
+	if !ok {
+		return
+	}
+
+	if _, err := starlark.Call(h.newThread(s.name), hook, starlark.Tuple{event.arg}, nil); err != nil {
+		h.logger.Warn("script failed", zap.String("script", s.name), zap.String("hook", event.hook), zap.Error(err))
+		h.output(&historyMessage{
+			messageType: messageTypeError,
+			payload:     []byte(fmt.Sprintf("script %s: %s failed: %s", s.name, event.hook, err)),
+		})
+	}
+}
+
+func (h *scriptHost) newThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			h.output(&historyMessage{
+				messageType: messageTypeMeta,
+				payload:     []byte(fmt.Sprintf("script %s: %s", name, msg)),
+			})
+		},
+	}
+	thread.SetMaxExecutionSteps(scriptMaxSteps)
+
+	return thread
+}
+
+// output shows a message of the scripts in the account group.
+func (h *scriptHost) output(m *historyMessage) {
+	if current := h.accounts.Current(); current != nil && current.view.accountGroupView != nil {
+		current.view.accountGroupView.messages.Append(m)
+	}
+}
+
+func (h *scriptHost) enqueue(hook string, arg starlark.Value) {
+	if h == nil {
+		return
+	}
+
+	select {
+	case h.events <- scriptEvent{hook: hook, arg: arg}:
+	default:
+		h.logger.Warn("scripts are too slow, event dropped", zap.String("hook", hook))
+	}
+}
+
+// onMessage passes a message received in the group of v to the scripts.
+func (h *scriptHost) onMessage(v *groupView, m *historyMessage) {
+	if h == nil {
+		return
+	}
+
+	v.v.lock.RLock()
+	name := v.v.contactNames[string(v.g.PublicKey)]
+	v.v.lock.RUnlock()
+
+	h.enqueue(hookOnMessage, starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"group":      starlark.String(base64.RawURLEncoding.EncodeToString(v.g.PublicKey)),
+		"group_name": starlark.String(name),
+		"cid":        starlark.String(m.cid),
+		"sender":     starlark.String(base64.RawURLEncoding.EncodeToString(m.sender)),
+		"text":       starlark.String(m.payload),
+	}))
+}
+
+// onContactRequest passes a received contact request to the scripts, the id
+// is the one of /contact accept.
+func (h *scriptHost) onContactRequest(contactPK []byte, name string, score contactspam.Score) {
+	if h == nil {
+		return
+	}
+
+	h.enqueue(hookOnContactRequest, starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"contact_id": starlark.String(base64.StdEncoding.EncodeToString(contactPK)),
+		"name":       starlark.String(name),
+		"suspicious": starlark.Bool(score.Level == contactspam.LevelSuspicious),
+	}))
+}
+
+// groupView returns the view of a group of the current account.
+func (h *scriptHost) groupView(group string) (*groupView, error) {
+	current := h.accounts.Current()
+	if current == nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("no account"))
+	}
+
+	pk, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(group))
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	for _, view := range current.view.groupViews() {
+		if string(view.g.PublicKey) == string(pk) {
+			return view, nil
+		}
+	}
+
+	return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown group %s", group))
+}
+
+func (h *scriptHost) send(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var group, text string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "group", &group, "text", &text); err != nil {
+		return nil, err
+	}
+
+	v, err := h.groupView(group)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(h.accounts.rootCtx, scriptCallTimeout)
+	defer cancel()
+
+	if err := v.sendUserMessage(ctx, text); err != nil {
+		return nil, err
+	}
+
+	return starlark.None, nil
+}
+
+// react answers a message with an emoji, the messenger has no reactions yet
+// so it is sent as a message targeting cid.
+func (h *scriptHost) react(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var group, cid, emoji string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "group", &group, "cid", &cid, "emoji", &emoji); err != nil {
+		return nil, err
+	}
+
+	v, err := h.groupView(group)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: emoji})
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	ctx, cancel := context.WithTimeout(h.accounts.rootCtx, scriptCallTimeout)
+	defer cancel()
+
+	if _, err := v.v.messenger.Interact(ctx, &messengertypes.Interact_Request{
+		Type:                  messengertypes.AppMessage_TypeUserMessage,
+		Payload:               payload,
+		ConversationPublicKey: base64.RawURLEncoding.EncodeToString(v.g.PublicKey),
+		TargetCID:             cid,
+	}); err != nil {
+		return nil, err
+	}
+
+	return starlark.None, nil
+}
+
+func (h *scriptHost) accept(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var contactID string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "contact_id", &contactID); err != nil {
+		return nil, err
+	}
+
+	current := h.accounts.Current()
+	if current == nil || current.view.accountGroupView == nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("no account"))
+	}
+
+	ctx, cancel := context.WithTimeout(h.accounts.rootCtx, scriptCallTimeout)
+	defer cancel()
+
+	if err := contactAcceptCommand(ctx, current.view.accountGroupView, contactID); err != nil {
+		return nil, err
+	}
+
+	return starlark.None, nil
+}
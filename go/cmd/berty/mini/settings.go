@@ -0,0 +1,231 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// PrivacySettings are the privacy toggles of the account, it is implemented
+// by the in-process messenger service.
+type PrivacySettings interface {
+	ProfileHider
+	SendTypingIndicators() bool
+	SetSendTypingIndicators(ctx context.Context, send bool) error
+	SendReadReceipts() bool
+	SetSendReadReceipts(ctx context.Context, send bool) error
+}
+
+// setting is a toggle of the settings panel.
+type setting struct {
+	title string
+	get   func() bool
+	set   func(ctx context.Context, on bool) error
+}
+
+func privacySettings(s PrivacySettings) []*setting {
+	return []*setting{
+		{
+			title: "send typing indicators",
+			get:   s.SendTypingIndicators,
+			set:   s.SetSendTypingIndicators,
+		},
+		{
+			title: "send read receipts",
+			get:   s.SendReadReceipts,
+			set:   s.SetSendReadReceipts,
+		},
+		{
+			title: "publish display name",
+			get:   func() bool { return !s.HideProfile() },
+			set: func(ctx context.Context, on bool) error {
+				return s.SetHideProfile(ctx, !on)
+			},
+		},
+	}
+}
+
+// spellSettings returns a toggle per dictionary found, see spellChecker.
+func spellSettings(c *spellChecker) []*setting {
+	settings := []*setting(nil)
+	for _, language := range c.Languages() {
+		language := language
+		settings = append(settings, &setting{
+			title: "check the spelling in " + language,
+			get:   func() bool { return c.Enabled(language) },
+			set: func(_ context.Context, on bool) error {
+				return c.SetEnabled(language, on)
+			},
+		})
+	}
+
+	return settings
+}
+
+// settingsList returns the toggles of the settings panel, the privacy
+// settings need an in-process node.
+func (a *accountManager) settingsList() []*setting {
+	settings := []*setting(nil)
+	if a.opts.PrivacySettings != nil {
+		settings = append(settings, privacySettings(a.opts.PrivacySettings)...)
+	}
+	if a.spell != nil {
+		settings = append(settings, spellSettings(a.spell)...)
+	}
+
+	return settings
+}
+
+// settingsCommand opens the settings panel.
+func settingsCommand(_ context.Context, v *groupView, _ string) error {
+	if len(v.v.accounts.settingsList()) == 0 {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the settings are only available with an in-process node or with spelling dictionaries, see -mini.spell-dicts"))
+	}
+
+	v.v.accounts.settings.Open()
+	return nil
+}
+
+// settingsPanel lists the privacy settings of the account and the spelling
+// languages, Up/Down select one and Enter or Space toggles it. The changes
+// are saved and applied right away.
+type settingsPanel struct {
+	accounts *accountManager
+	view     *tview.TextView
+	layout   *tview.Flex
+	settings []*setting
+
+	mu       sync.Mutex
+	open     bool
+	selected int
+}
+
+func newSettingsPanel(accounts *accountManager) *settingsPanel {
+	view := tview.NewTextView().SetDynamicColors(true)
+	view.SetBackgroundColor(tcell.ColorDarkSlateGray)
+
+	return &settingsPanel{accounts: accounts, view: view}
+}
+
+// attachTo adds the panel, hidden until opened, to layout.
+func (p *settingsPanel) attachTo(layout *tview.Flex) {
+	p.layout = layout
+	layout.AddItem(p.view, 0, 0, false)
+}
+
+// IsOpen returns true while the panel is displayed.
+func (p *settingsPanel) IsOpen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.open
+}
+
+func (p *settingsPanel) Open() {
+	p.mu.Lock()
+	p.open = true
+	p.selected = 0
+	p.settings = p.accounts.settingsList()
+	size := len(p.settings) + 1
+	p.render()
+	p.mu.Unlock()
+
+	if p.layout != nil {
+		p.layout.ResizeItem(p.view, size, 0)
+	}
+}
+
+func (p *settingsPanel) close() {
+	p.mu.Lock()
+	p.open = false
+	p.mu.Unlock()
+
+	if p.layout != nil {
+		p.layout.ResizeItem(p.view, 0, 0)
+	}
+}
+
+// HandleKey handles all the keys while the panel is open, except Ctrl+C.
+func (p *settingsPanel) HandleKey(event *tcell.EventKey) *tcell.EventKey {
+	if !p.IsOpen() || event.Key() == tcell.KeyCtrlC {
+		return event
+	}
+
+	switch {
+	case event.Key() == tcell.KeyUp:
+		p.moveSelection(-1)
+	case event.Key() == tcell.KeyDown:
+		p.moveSelection(+1)
+	case event.Key() == tcell.KeyEnter, event.Key() == tcell.KeyRune && event.Rune() == ' ':
+		p.toggleSelected()
+	case event.Key() == tcell.KeyEsc:
+		p.close()
+	}
+
+	return nil
+}
+
+func (p *settingsPanel) moveSelection(step int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.settings) == 0 {
+		return
+	}
+
+	p.selected = (p.selected + step + len(p.settings)) % len(p.settings)
+	p.render()
+}
+
+// toggleSelected changes the selected setting, without blocking the UI
+// while the messenger applies it.
+func (p *settingsPanel) toggleSelected() {
+	p.mu.Lock()
+	if p.selected >= len(p.settings) {
+		p.mu.Unlock()
+		return
+	}
+	setting := p.settings[p.selected]
+	p.mu.Unlock()
+
+	go func() {
+		if err := setting.set(p.accounts.rootCtx, !setting.get()); err != nil {
+			if current := p.accounts.Current(); current != nil {
+				current.view.GetActiveViewGroup().messages.AppendErr(fmt.Errorf("unable to change %q: %w", setting.title, err))
+			}
+		}
+
+		p.mu.Lock()
+		p.render()
+		p.mu.Unlock()
+
+		p.accounts.app.Draw()
+	}()
+}
+
+// render displays the settings and their values, p.mu must be held.
+func (p *settingsPanel) render() {
+	b := &strings.Builder{}
+	b.WriteString("[::b]Settings[::-] (Up/Down and Enter or Space to toggle, Esc to close)")
+
+	for i, setting := range p.settings {
+		value := "off"
+		if setting.get() {
+			value = "on"
+		}
+
+		line := tview.Escape(fmt.Sprintf("[%s] %s", value, setting.title))
+		if i == p.selected {
+			line = selectedLine(p.accounts, line)
+		}
+		fmt.Fprintf(b, "\n%s", line)
+	}
+
+	p.view.SetText(b.String())
+}
@@ -0,0 +1,202 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// slowModeRefreshInterval is the interval between two updates of the
+// countdown of the status bar.
+const slowModeRefreshInterval = time.Second
+
+// rateLimitedFor returns how long to wait before sending again when err is
+// the reply of the flood protection of the daemon: ResourceExhausted with a
+// RetryInfo detail. The other ResourceExhausted errors, e.g. a message too
+// large, are not retried.
+func rateLimitedFor(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			wait := info.GetRetryDelay().AsDuration()
+			if wait < 0 {
+				wait = 0
+			}
+			return wait, true
+		}
+	}
+
+	return 0, false
+}
+
+// slowMode holds the messages of a group while its sender is rate limited,
+// they are sent in order once the window reopens.
+type slowMode struct {
+	mu    sync.Mutex
+	until time.Time
+	queue []string
+	timer *time.Timer
+}
+
+// state returns the number of queued messages and the time left before
+// they are sent, both are zero when the group is not rate limited.
+func (s *slowMode) state(now time.Time) (int, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 && !now.Before(s.until) {
+		return 0, 0
+	}
+
+	left := s.until.Sub(now)
+	if left < 0 {
+		left = 0
+	}
+	return len(s.queue), left
+}
+
+// queueIfActive queues body if the group is rate limited or messages are
+// still waiting, so that they are not sent out of order.
+func (s *slowMode) queueIfActive(body string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 && !time.Now().Before(s.until) {
+		return false
+	}
+
+	s.queue = append(s.queue, body)
+	return true
+}
+
+// next pops the first queued message, unless the window is closed again.
+func (s *slowMode) next() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 || time.Now().Before(s.until) {
+		return "", false
+	}
+
+	body := s.queue[0]
+	s.queue = s.queue[1:]
+	return body, true
+}
+
+// rateLimited queues body, first when it was already queued, and sends the
+// queue once the window reopens.
+func (v *groupView) rateLimited(ctx context.Context, wait time.Duration, body string, requeued bool) {
+	s := &v.slow
+
+	s.mu.Lock()
+	s.until = time.Now().Add(wait)
+	if requeued {
+		s.queue = append([]string{body}, s.queue...)
+	} else {
+		s.queue = append(s.queue, body)
+	}
+	queued := len(s.queue)
+	if s.timer == nil {
+		s.timer = time.AfterFunc(wait, func() { v.sendSlowQueue(ctx) })
+	} else {
+		s.timer.Reset(wait)
+	}
+	s.mu.Unlock()
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte(fmt.Sprintf("slow mode: the group is rate limited, %d message(s) queued, sending again in %s", queued, wait.Round(time.Second))),
+	})
+}
+
+// sendSlowQueue sends the queued messages until the queue is empty or the
+// group is rate limited again.
+func (v *groupView) sendSlowQueue(ctx context.Context) {
+	for ctx.Err() == nil {
+		body, ok := v.slow.next()
+		if !ok {
+			return
+		}
+
+		if err := v.deliverUserMessage(ctx, body, true); err != nil {
+			v.messages.AppendErr(err)
+		}
+	}
+}
+
+// slowModeBar is the status bar above the input, it counts down the time
+// left before the queued messages of the displayed group are sent.
+type slowModeBar struct {
+	accounts *accountManager
+	view     *tview.TextView
+	layout   *tview.Flex
+	visible  bool
+}
+
+func newSlowModeBar(accounts *accountManager) *slowModeBar {
+	view := tview.NewTextView().SetTextAlign(tview.AlignCenter)
+	view.SetTextColor(tcell.ColorBlack)
+	view.SetBackgroundColor(tcell.ColorYellow)
+
+	return &slowModeBar{accounts: accounts, view: view}
+}
+
+// attachTo adds the bar, hidden until a group is rate limited, to layout.
+func (b *slowModeBar) attachTo(layout *tview.Flex) {
+	b.layout = layout
+	layout.AddItem(b.view, 0, 0, false)
+}
+
+func (b *slowModeBar) run(ctx context.Context) {
+	ticker := time.NewTicker(slowModeRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		text := ""
+		if current := b.accounts.Current(); current != nil {
+			current.view.lock.RLock()
+			displayed := current.view.displayedGroupView
+			current.view.lock.RUnlock()
+
+			if displayed != nil {
+				if queued, left := displayed.slow.state(time.Now()); queued > 0 || left > 0 {
+					text = fmt.Sprintf("slow mode: %d message(s) queued, sending in %s", queued, left.Round(time.Second))
+				}
+			}
+		}
+
+		// the hidden bar is left as is
+		if text == "" && !b.visible {
+			continue
+		}
+		b.visible = text != ""
+
+		b.accounts.app.QueueUpdateDraw(func() {
+			b.view.SetText(text)
+			if b.layout != nil {
+				size := 0
+				if text != "" {
+					size = 1
+				}
+				b.layout.ResizeItem(b.view, size, 0)
+			}
+		})
+	}
+}
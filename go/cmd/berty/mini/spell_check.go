@@ -0,0 +1,779 @@
+package mini
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// spellMaxDistance is the largest edit distance between a misspelled
+	// word and its suggestions.
+	spellMaxDistance = 2
+
+	// spellMaxSuggestions bounds the suggestions of a misspelled word.
+	spellMaxSuggestions = 6
+)
+
+// spellAffix is a prefix or a suffix class of a hunspell .aff file.
+type spellAffix struct {
+	prefix bool
+	// cross is set when the prefixes and the suffixes of the class combine.
+	cross bool
+	rules []spellAffixRule
+}
+
+// spellAffixRule replaces strip by add at the start or the end of the stems
+// matching condition.
+type spellAffixRule struct {
+	strip     string
+	add       string
+	condition *regexp.Regexp
+}
+
+// apply returns the affixed form of stem, false when the rule does not
+// apply to it.
+func (r spellAffixRule) apply(stem string, prefix bool) (string, bool) {
+	if r.condition != nil && !r.condition.MatchString(stem) {
+		return "", false
+	}
+
+	if prefix {
+		if !strings.HasPrefix(stem, r.strip) {
+			return "", false
+		}
+		return r.add + stem[len(r.strip):], true
+	}
+
+	if !strings.HasSuffix(stem, r.strip) {
+		return "", false
+	}
+	return stem[:len(stem)-len(r.strip)] + r.add, true
+}
+
+// spellAffixes are the rules of a hunspell .aff file used to expand the
+// stems of a dictionary, the compounds and the morphology are not
+// supported.
+type spellAffixes struct {
+	// flagType is the FLAG option: empty for one character flags, long or
+	// num.
+	flagType string
+	// aliases are the flags of the AF option, the stems then refer to them
+	// by their number.
+	aliases []string
+	latin1  bool
+	classes map[string]*spellAffix
+	// skipped are the flags of the stems which are not words on their own:
+	// NEEDAFFIX, ONLYINCOMPOUND and FORBIDDENWORD.
+	skipped map[string]bool
+}
+
+// splitFlags returns the flags of a stem or of an affix.
+func (a *spellAffixes) splitFlags(flags string) []string {
+	if n, err := strconv.Atoi(flags); err == nil && len(a.aliases) > 0 {
+		if n < 1 || n > len(a.aliases) {
+			return nil
+		}
+		flags = a.aliases[n-1]
+	}
+
+	switch a.flagType {
+	case "long":
+		split := []string(nil)
+		runes := []rune(flags)
+		for i := 0; i+1 < len(runes); i += 2 {
+			split = append(split, string(runes[i:i+2]))
+		}
+		return split
+	case "num":
+		return strings.Split(flags, ",")
+	default:
+		split := []string(nil)
+		for _, r := range flags {
+			split = append(split, string(r))
+		}
+		return split
+	}
+}
+
+// decode returns line in UTF-8, the dictionaries are either in UTF-8 or in
+// ISO-8859-1.
+func (a *spellAffixes) decode(line string) string {
+	if !a.latin1 {
+		return line
+	}
+
+	b := make([]rune, len(line))
+	for i := 0; i < len(line); i++ {
+		b[i] = rune(line[i])
+	}
+	return string(b)
+}
+
+// readSpellAffixes reads the .aff file at path, a missing file has no
+// rules, the .dic file is then a plain word list.
+func readSpellAffixes(path string) (*spellAffixes, error) {
+	a := &spellAffixes{classes: map[string]*spellAffix{}, skipped: map[string]bool{}}
+
+	f, err := os.Open(path)
+	switch {
+	case os.IsNotExist(err):
+		return a, nil
+	case err != nil:
+		return nil, err
+	}
+	defer f.Close()
+
+	aliasesHeader := false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(a.decode(scanner.Text()))
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "SET":
+			switch strings.ToUpper(fields[1]) {
+			case "UTF-8":
+			case "ISO8859-1", "ISO-8859-1":
+				a.latin1 = true
+			default:
+				return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("unsupported encoding %s, only UTF-8 and ISO8859-1 are read", fields[1]))
+			}
+
+		case "FLAG":
+			if fields[1] != "UTF-8" {
+				a.flagType = fields[1]
+			}
+
+		case "AF":
+			// the first line is the number of aliases
+			if !aliasesHeader {
+				aliasesHeader = true
+				continue
+			}
+			a.aliases = append(a.aliases, fields[1])
+
+		case "NEEDAFFIX", "ONLYINCOMPOUND", "FORBIDDENWORD":
+			a.skipped[fields[1]] = true
+
+		case "PFX", "SFX":
+			if len(fields) < 4 {
+				continue
+			}
+
+			class, ok := a.classes[fields[1]]
+			if !ok {
+				// the first line of a class is its header
+				a.classes[fields[1]] = &spellAffix{prefix: fields[0] == "PFX", cross: fields[2] == "Y"}
+				continue
+			}
+
+			rule := spellAffixRule{strip: fields[2], add: fields[3]}
+			if rule.strip == "0" {
+				rule.strip = ""
+			}
+			// the continuation classes of the affixes are not applied
+			if i := strings.IndexByte(rule.add, '/'); i >= 0 {
+				rule.add = rule.add[:i]
+			}
+			if rule.add == "0" {
+				rule.add = ""
+			}
+
+			if len(fields) > 4 && fields[4] != "." {
+				expr := "(?:" + fields[4] + ")$"
+				if class.prefix {
+					expr = "^(?:" + fields[4] + ")"
+				}
+				if rule.condition, err = regexp.Compile(expr); err != nil {
+					continue
+				}
+			}
+
+			class.rules = append(class.rules, rule)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// spellDictionary is the word list of a language, the stems of its
+// hunspell .dic file expanded with the affixes of its .aff file.
+type spellDictionary struct {
+	words map[string]struct{}
+	// byLength indexes the words by their number of runes, for the
+	// suggestions.
+	byLength map[int][]string
+}
+
+// loadSpellDictionary reads the <language>.dic and <language>.aff files of
+// dir.
+func loadSpellDictionary(dir, language string) (*spellDictionary, error) {
+	affixes, err := readSpellAffixes(filepath.Join(dir, language+".aff"))
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to read the %s affixes: %w", language, err))
+	}
+
+	f, err := os.Open(filepath.Join(dir, language+".dic"))
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to read the %s dictionary: %w", language, err))
+	}
+	defer f.Close()
+
+	d := &spellDictionary{words: map[string]struct{}{}, byLength: map[int][]string{}}
+	add := func(word string) {
+		if _, ok := d.words[word]; ok || word == "" {
+			return
+		}
+		d.words[word] = struct{}{}
+		n := utf8.RuneCountInString(word)
+		d.byLength[n] = append(d.byLength[n], word)
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for first := true; scanner.Scan(); first = false {
+		fields := strings.Fields(affixes.decode(scanner.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+
+		// the first line is the number of stems
+		if _, err := strconv.Atoi(fields[0]); first && err == nil {
+			continue
+		}
+
+		stem, flags := fields[0], ""
+		if i := strings.IndexByte(stem, '/'); i > 0 {
+			stem, flags = stem[:i], stem[i+1:]
+		}
+		d.expand(affixes, stem, affixes.splitFlags(flags), add)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to read the %s dictionary: %w", language, err))
+	}
+
+	return d, nil
+}
+
+// expand adds stem and its affixed forms.
+func (d *spellDictionary) expand(affixes *spellAffixes, stem string, flags []string, add func(word string)) {
+	prefixes, suffixes := []*spellAffix(nil), []*spellAffix(nil)
+	bare := true
+	for _, flag := range flags {
+		if affixes.skipped[flag] {
+			bare = false
+		}
+		if class, ok := affixes.classes[flag]; ok {
+			if class.prefix {
+				prefixes = append(prefixes, class)
+			} else {
+				suffixes = append(suffixes, class)
+			}
+		}
+	}
+
+	if bare {
+		add(stem)
+	}
+
+	for _, prefix := range prefixes {
+		for _, rule := range prefix.rules {
+			if word, ok := rule.apply(stem, true); ok {
+				add(word)
+			}
+		}
+	}
+
+	for _, suffix := range suffixes {
+		for _, rule := range suffix.rules {
+			word, ok := rule.apply(stem, false)
+			if !ok {
+				continue
+			}
+			add(word)
+
+			if !suffix.cross {
+				continue
+			}
+			for _, prefix := range prefixes {
+				if !prefix.cross {
+					continue
+				}
+				for _, prefixRule := range prefix.rules {
+					if crossed, ok := prefixRule.apply(word, true); ok {
+						add(crossed)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (d *spellDictionary) has(word string) bool {
+	_, ok := d.words[word]
+	return ok
+}
+
+// check returns true when word is in d, the lowercase words of d are also
+// accepted capitalized or in uppercase, like hunspell does.
+func (d *spellDictionary) check(word string) bool {
+	if d.has(word) {
+		return true
+	}
+
+	lower := strings.ToLower(word)
+	switch {
+	case word == lower:
+		return false
+	case word == spellTitle(lower):
+		return d.has(lower)
+	case word == strings.ToUpper(word):
+		return d.has(lower) || d.has(spellTitle(lower))
+	}
+
+	return false
+}
+
+// spellTitle returns word with its first letter in uppercase.
+func spellTitle(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	if r == utf8.RuneError {
+		return word
+	}
+
+	return string(unicode.ToUpper(r)) + word[size:]
+}
+
+// spellDistance returns the edit distance between a and b, a transposition
+// of two letters counts as one edit, or max+1 when it is larger than max.
+func spellDistance(a, b []rune, max int) int {
+	if d := len(a) - len(b); d > max || -d > max {
+		return max + 1
+	}
+
+	prevprev := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = prev[j-1] + cost
+			if v := prev[j] + 1; v < cur[j] {
+				cur[j] = v
+			}
+			if v := cur[j-1] + 1; v < cur[j] {
+				cur[j] = v
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				if v := prevprev[j-2] + 1; v < cur[j] {
+					cur[j] = v
+				}
+			}
+
+			if cur[j] < best {
+				best = cur[j]
+			}
+		}
+
+		// every later row is at least as far
+		if best > max {
+			return max + 1
+		}
+		prevprev, prev, cur = prev, cur, prevprev
+	}
+
+	return prev[len(b)]
+}
+
+// spellWord is a word of the input, start and end are its byte offsets.
+type spellWord struct {
+	start int
+	end   int
+	word  string
+}
+
+// spellWords returns the words of text to check. The command names, the
+// links, the mentions and the code spans are skipped, so are the words
+// with digits and the single letters.
+func spellWords(text string) []spellWord {
+	words := []spellWord(nil)
+	inCode := false
+
+	inField := false
+	skipField := false
+	wordStart := -1
+
+	endWord := func(end int) {
+		if wordStart < 0 {
+			return
+		}
+
+		start := wordStart
+		wordStart = -1
+		if skipField || inCode {
+			return
+		}
+
+		word := strings.Trim(text[start:end], "'’")
+		start += strings.Index(text[start:end], word)
+		if utf8.RuneCountInString(word) < 2 || strings.IndexFunc(word, func(r rune) bool { return unicode.IsDigit(r) || r == '_' }) >= 0 {
+			return
+		}
+
+		words = append(words, spellWord{start: start, end: start + len(word), word: word})
+	}
+
+	for i, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			endWord(i)
+			inField = false
+
+		case r == '`':
+			endWord(i)
+			inCode = !inCode
+
+		default:
+			if !inField {
+				inField = true
+				field := text[i:]
+				if end := strings.IndexFunc(field, unicode.IsSpace); end >= 0 {
+					field = field[:end]
+				}
+				skipField = strings.Contains(field, "://") || strings.HasPrefix(field, "www.") ||
+					strings.HasPrefix(field, "@") || strings.HasPrefix(field, "#") ||
+					i == 0 && strings.HasPrefix(field, "/")
+			}
+
+			isWordRune := unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == '_' || r == '\'' || r == '’'
+			switch {
+			case isWordRune && wordStart < 0:
+				wordStart = i
+			case !isWordRune:
+				endWord(i)
+			}
+		}
+	}
+	endWord(len(text))
+
+	return words
+}
+
+// spellFile holds the languages enabled in the settings panel, saved in
+// the spelling file.
+type spellFile struct {
+	Languages []string `json:"languages"`
+}
+
+// spellChecker checks the words of the input with the dictionaries of the
+// enabled languages. The dictionaries are loaded in the background when
+// their language is enabled, the enabled languages are saved in a JSON
+// file when it has a path.
+type spellChecker struct {
+	dir       string
+	path      string
+	languages []string
+	// loaded is called once the dictionary of a language is loaded, or
+	// failed to load.
+	loaded func(language string, err error)
+
+	mu      sync.Mutex
+	enabled map[string]bool
+	dicts   map[string]*spellDictionary
+	loading map[string]bool
+}
+
+// loadSpellChecker lists the dictionaries of dir, <language>.dic with an
+// optional <language>.aff, and reads the languages enabled in path. The
+// enabled languages are only kept in memory when path is empty.
+func loadSpellChecker(dir, path string) (*spellChecker, error) {
+	c := &spellChecker{
+		dir:     dir,
+		path:    path,
+		enabled: map[string]bool{},
+		dicts:   map[string]*spellDictionary{},
+		loading: map[string]bool{},
+	}
+	if dir == "" {
+		return c, nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.dic"))
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+	for _, match := range matches {
+		c.languages = append(c.languages, strings.TrimSuffix(filepath.Base(match), ".dic"))
+	}
+	sort.Strings(c.languages)
+
+	if path == "" {
+		return c, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return c, nil
+	case err != nil:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to read the spelling settings: %w", err))
+	}
+
+	settings := spellFile{}
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("unable to read the spelling settings of %s: %w", path, err))
+	}
+	for _, language := range settings.Languages {
+		c.enabled[language] = true
+	}
+
+	return c, nil
+}
+
+// start loads the dictionaries of the languages enabled on startup, loaded
+// is called for each of them.
+func (c *spellChecker) start(loaded func(language string, err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loaded = loaded
+	for _, language := range c.languages {
+		if c.enabled[language] {
+			c.load(language)
+		}
+	}
+}
+
+// load reads the dictionary of language in the background, c.mu must be
+// held.
+func (c *spellChecker) load(language string) {
+	if c.dicts[language] != nil || c.loading[language] {
+		return
+	}
+	c.loading[language] = true
+
+	go func() {
+		d, err := loadSpellDictionary(c.dir, language)
+
+		c.mu.Lock()
+		delete(c.loading, language)
+		if err == nil {
+			c.dicts[language] = d
+		}
+		loaded := c.loaded
+		c.mu.Unlock()
+
+		if loaded != nil {
+			loaded(language, err)
+		}
+	}()
+}
+
+// Languages returns the languages of the dictionaries found.
+func (c *spellChecker) Languages() []string {
+	return c.languages
+}
+
+// Enabled returns true when the words are checked with the dictionary of
+// language.
+func (c *spellChecker) Enabled(language string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.enabled[language]
+}
+
+// SetEnabled enables or disables the dictionary of language and saves the
+// enabled languages.
+func (c *spellChecker) SetEnabled(language string, on bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.enabled[language] = on
+	if err := c.save(); err != nil {
+		c.enabled[language] = !on
+		return err
+	}
+
+	if on {
+		c.load(language)
+	}
+	return nil
+}
+
+// save writes the enabled languages, c.mu must be held.
+func (c *spellChecker) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	settings := spellFile{Languages: []string{}}
+	for language, on := range c.enabled {
+		if on {
+			settings.Languages = append(settings.Languages, language)
+		}
+	}
+	sort.Strings(settings.Languages)
+
+	raw, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return errcode.ErrInternal.Wrap(err)
+	}
+
+	// the previous file is kept when the write fails
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return errcode.ErrInternal.Wrap(err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return errcode.ErrInternal.Wrap(err)
+	}
+
+	return nil
+}
+
+// active returns the loaded dictionaries of the enabled languages, c.mu
+// must be held.
+func (c *spellChecker) active() []*spellDictionary {
+	dicts := []*spellDictionary(nil)
+	for _, language := range c.languages {
+		if d := c.dicts[language]; d != nil && c.enabled[language] {
+			dicts = append(dicts, d)
+		}
+	}
+
+	return dicts
+}
+
+// Active returns true when the dictionary of an enabled language is
+// loaded.
+func (c *spellChecker) Active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.active()) > 0
+}
+
+// Misspelled returns the words of text found in none of the enabled
+// dictionaries, none when no dictionary is loaded.
+func (c *spellChecker) Misspelled(text string) []spellWord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dicts := c.active()
+	if len(dicts) == 0 {
+		return nil
+	}
+
+	misspelled := []spellWord(nil)
+	for _, w := range spellWords(text) {
+		word := strings.ReplaceAll(w.word, "’", "'")
+
+		known := false
+		for _, d := range dicts {
+			if known = d.check(word); known {
+				break
+			}
+		}
+		if !known {
+			misspelled = append(misspelled, w)
+		}
+	}
+
+	return misspelled
+}
+
+// Suggest returns the words of the enabled dictionaries closest to word,
+// in the case of word.
+func (c *spellChecker) Suggest(word string) []string {
+	c.mu.Lock()
+	dicts := c.active()
+	c.mu.Unlock()
+
+	type candidate struct {
+		word     string
+		distance int
+	}
+
+	lower := strings.ToLower(strings.ReplaceAll(word, "’", "'"))
+	target := []rune(lower)
+	first, _ := utf8.DecodeRuneInString(lower)
+
+	seen := map[string]bool{}
+	candidates := []candidate(nil)
+	for _, d := range dicts {
+		for n := len(target) - spellMaxDistance; n <= len(target)+spellMaxDistance; n++ {
+			for _, known := range d.byLength[n] {
+				lowerKnown := strings.ToLower(known)
+				if seen[lowerKnown] {
+					continue
+				}
+
+				if distance := spellDistance(target, []rune(lowerKnown), spellMaxDistance); distance <= spellMaxDistance {
+					seen[lowerKnown] = true
+					candidates = append(candidates, candidate{word: known, distance: distance})
+				}
+			}
+		}
+	}
+
+	// the closest words first, then the ones starting like word
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		if aFirst, bFirst := strings.HasPrefix(strings.ToLower(a.word), string(first)), strings.HasPrefix(strings.ToLower(b.word), string(first)); aFirst != bFirst {
+			return aFirst
+		}
+		return a.word < b.word
+	})
+
+	suggestions := []string(nil)
+	for i := 0; i < len(candidates) && i < spellMaxSuggestions; i++ {
+		suggestion := candidates[i].word
+		switch {
+		case word == strings.ToUpper(word):
+			suggestion = strings.ToUpper(suggestion)
+		case word == spellTitle(strings.ToLower(word)):
+			suggestion = spellTitle(suggestion)
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	return suggestions
+}
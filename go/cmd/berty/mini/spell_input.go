@@ -0,0 +1,328 @@
+package mini
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// spellPopupMaxWords bounds the misspelled words listed by the suggestions
+// popup.
+const spellPopupMaxWords = 6
+
+// spellInputField underlines the misspelled words of the input. tview does
+// not style a part of an input field, the words are underlined on the cells
+// it drew.
+type spellInputField struct {
+	*tview.InputField
+	accounts *accountManager
+}
+
+func newSpellInputField(accounts *accountManager) *spellInputField {
+	return &spellInputField{InputField: accounts.input, accounts: accounts}
+}
+
+func (f *spellInputField) Draw(screen tcell.Screen) {
+	f.InputField.Draw(screen)
+
+	// the input holds the query of the quick switcher
+	if f.accounts.spell == nil || f.accounts.jump.IsOpen() {
+		return
+	}
+
+	text := f.GetText()
+	misspelled := f.accounts.spell.Misspelled(text)
+	if len(misspelled) == 0 {
+		return
+	}
+
+	x, y, width, height := f.GetInnerRect()
+	if height < 1 || width < 1 {
+		return
+	}
+
+	type cell struct {
+		x     int
+		mainc rune
+		combc []rune
+		style tcell.Style
+		text  string
+	}
+
+	cells := []cell(nil)
+	visible := &strings.Builder{}
+	for col := x; col < x+width; {
+		mainc, combc, style, w := screen.GetContent(col, y)
+		c := cell{x: col, mainc: mainc, combc: combc, style: style, text: string(append([]rune{mainc}, combc...))}
+		cells = append(cells, c)
+		visible.WriteString(c.text)
+
+		if w < 1 {
+			w = 1
+		}
+		col += w
+	}
+
+	// tview does not expose the scroll offset of the field either, the text
+	// is drawn from its start when it fits, otherwise the last position
+	// matching the drawn cells is used: the end of the text is displayed
+	// while typing
+	offset := 0
+	if !strings.HasPrefix(visible.String(), text) {
+		drawn := strings.TrimRight(visible.String(), " ")
+		offset = strings.LastIndex(text, drawn)
+		if offset < 0 || drawn == "" {
+			return
+		}
+	}
+
+	pos, next := offset, 0
+	for _, c := range cells {
+		if !strings.HasPrefix(text[pos:], c.text) {
+			break
+		}
+
+		for next < len(misspelled) && misspelled[next].end <= pos {
+			next++
+		}
+		if next == len(misspelled) {
+			break
+		}
+		if misspelled[next].start <= pos {
+			screen.SetContent(c.x, y, c.mainc, c.combc, c.style.Underline(true).Foreground(tcell.ColorRed))
+		}
+
+		pos += len(c.text)
+	}
+}
+
+// spellPopup lists the misspelled words of the input above it, with the
+// suggestions of the selected one, and replaces it with the selected
+// suggestion.
+type spellPopup struct {
+	accounts *accountManager
+	view     *tview.TextView
+	layout   *tview.Flex
+
+	mu       sync.Mutex
+	open     bool
+	text     string
+	words    []spellWord
+	selected int
+	// suggestions are those of the selected word, choice is the selected
+	// one.
+	suggestions []string
+	choice      int
+}
+
+func newSpellPopup(accounts *accountManager) *spellPopup {
+	view := tview.NewTextView().SetDynamicColors(true)
+	view.SetBackgroundColor(tcell.ColorDarkSlateGray)
+
+	return &spellPopup{accounts: accounts, view: view}
+}
+
+// attachTo adds the popup, hidden until toggled, to layout.
+func (p *spellPopup) attachTo(layout *tview.Flex) {
+	p.layout = layout
+	layout.AddItem(p.view, 0, 0, false)
+}
+
+// IsOpen returns true while the popup is displayed.
+func (p *spellPopup) IsOpen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.open
+}
+
+// Toggle opens the popup for the words of the input, or closes it.
+func (p *spellPopup) Toggle(v *groupView) {
+	if p.IsOpen() {
+		p.close()
+		return
+	}
+
+	switch spell := p.accounts.spell; {
+	case spell == nil || len(spell.Languages()) == 0:
+		v.messages.AppendErr(fmt.Errorf("no spelling dictionary found, see -mini.spell-dicts"))
+		return
+	case !spell.Active():
+		v.messages.AppendErr(fmt.Errorf("spell checking is off, enable a language in /settings"))
+		return
+	}
+
+	text := p.accounts.input.GetText()
+	words := p.accounts.spell.Misspelled(text)
+	if len(words) == 0 {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("spelling: no misspelled word in the input"),
+		})
+		return
+	}
+
+	p.mu.Lock()
+	p.open = true
+	p.text = text
+	p.words = words
+	p.selected = 0
+	p.selectWord()
+	size := p.size()
+	p.mu.Unlock()
+
+	if p.layout != nil {
+		p.layout.ResizeItem(p.view, size, 0)
+	}
+}
+
+// HandleKey handles the keys selecting a word or a suggestion, replacing or
+// closing, the other ones close the popup and are returned to edit the
+// input.
+func (p *spellPopup) HandleKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEsc, tcell.KeyCtrlS:
+		p.close()
+	case tcell.KeyEnter:
+		p.replace()
+	case tcell.KeyUp:
+		p.moveWord(-1)
+	case tcell.KeyDown:
+		p.moveWord(+1)
+	case tcell.KeyLeft, tcell.KeyBacktab:
+		p.moveChoice(-1)
+	case tcell.KeyRight, tcell.KeyTab:
+		p.moveChoice(+1)
+	case tcell.KeyCtrlC:
+		return event
+	default:
+		p.close()
+		return event
+	}
+
+	return nil
+}
+
+func (p *spellPopup) moveWord(step int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.selected = (p.selected + step + len(p.words)) % len(p.words)
+	p.selectWord()
+}
+
+func (p *spellPopup) moveChoice(step int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.suggestions) == 0 {
+		return
+	}
+
+	p.choice = (p.choice + step + len(p.suggestions)) % len(p.suggestions)
+	p.render()
+}
+
+// selectWord looks up the suggestions of the selected word, p.mu must be
+// held.
+func (p *spellPopup) selectWord() {
+	p.suggestions = p.accounts.spell.Suggest(p.words[p.selected].word)
+	p.choice = 0
+	p.render()
+}
+
+// replace replaces the selected word of the input with the selected
+// suggestion, the popup is closed once no misspelled word is left.
+func (p *spellPopup) replace() {
+	input := p.accounts.input
+
+	p.mu.Lock()
+	text := input.GetText()
+	if text != p.text || len(p.suggestions) == 0 {
+		p.mu.Unlock()
+		return
+	}
+
+	w := p.words[p.selected]
+	text = text[:w.start] + p.suggestions[p.choice] + text[w.end:]
+	p.text = text
+	p.words = p.accounts.spell.Misspelled(text)
+	left := len(p.words)
+	if left > 0 {
+		if p.selected >= left {
+			p.selected = left - 1
+		}
+		p.selectWord()
+	}
+	size := p.size()
+	p.mu.Unlock()
+
+	input.SetText(text)
+	if left == 0 {
+		p.close()
+	} else if p.layout != nil {
+		p.layout.ResizeItem(p.view, size, 0)
+	}
+}
+
+func (p *spellPopup) close() {
+	p.mu.Lock()
+	p.open = false
+	p.words = nil
+	p.suggestions = nil
+	p.mu.Unlock()
+
+	if p.layout != nil {
+		p.layout.ResizeItem(p.view, 0, 0)
+	}
+}
+
+// size returns the height of the popup, p.mu must be held.
+func (p *spellPopup) size() int {
+	if len(p.words) > spellPopupMaxWords {
+		return spellPopupMaxWords + 1
+	}
+	return len(p.words) + 1
+}
+
+// render displays the misspelled words around the selected one, p.mu must
+// be held.
+func (p *spellPopup) render() {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "[::b]Spelling[::-] (%d misspelled word(s), Up/Down to select a word, Left/Right a suggestion, Enter to replace, Esc to close)", len(p.words))
+
+	first := 0
+	if p.selected >= spellPopupMaxWords {
+		first = p.selected - spellPopupMaxWords + 1
+	}
+
+	for i := first; i < len(p.words) && i < first+spellPopupMaxWords; i++ {
+		line := p.words[i].word
+		if i == p.selected {
+			suggestions := make([]string, len(p.suggestions))
+			for j, suggestion := range p.suggestions {
+				if j == p.choice {
+					suggestion = "<" + suggestion + ">"
+				}
+				suggestions[j] = suggestion
+			}
+
+			if len(suggestions) == 0 {
+				line += ": no suggestion"
+			} else {
+				line += ": " + strings.Join(suggestions, " ")
+			}
+		}
+
+		line = tview.Escape(line)
+		if i == p.selected {
+			line = selectedLine(p.accounts, line)
+		}
+		fmt.Fprintf(b, "\n%s", line)
+	}
+
+	p.view.SetText(b.String())
+}
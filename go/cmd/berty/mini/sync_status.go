@@ -0,0 +1,201 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+
+	"berty.tech/berty/v2/go/internal/messagesequencer"
+)
+
+const (
+	syncPollInterval = 5 * time.Second
+	// syncStallAfter is how long a group can have pending messages, or the
+	// daemon be unreachable, before the group is considered stalled.
+	syncStallAfter = 2 * time.Minute
+)
+
+// GroupSyncReporter reports the messages of a group not replicated yet, it
+// is implemented by the in-process messenger service.
+type GroupSyncReporter interface {
+	ConversationSequenceStatus(ctx context.Context, conversationPK string) (messagesequencer.Status, error)
+}
+
+type syncState int
+
+const (
+	syncUnknown syncState = iota
+	syncSynced
+	syncReplicating
+	syncStalled
+)
+
+// indicator is displayed before the name of the group in the tab list.
+func (s syncState) indicator() string {
+	switch s {
+	case syncSynced:
+		return "✓"
+	case syncReplicating:
+		return "↻"
+	case syncStalled:
+		return "✗"
+	default:
+		return ""
+	}
+}
+
+type groupSync struct {
+	state   syncState
+	pending uint64
+	// changedAt is when the number of pending messages last changed
+	changedAt time.Time
+}
+
+// syncTracker follows the reconnections to the daemon and the messages
+// pending in each group of the current account, detected from the gaps in
+// the message counters, to decorate the tab list.
+type syncTracker struct {
+	accounts *accountManager
+
+	mu             sync.Mutex
+	groups         map[string]*groupSync
+	disconnectedAt time.Time
+}
+
+func newSyncTracker(accounts *accountManager) *syncTracker {
+	return &syncTracker{accounts: accounts, groups: map[string]*groupSync{}}
+}
+
+// enabled is false when mini has no information on the sync, the tab list
+// is then left as is.
+func (t *syncTracker) enabled() bool {
+	return t.accounts.opts.GroupSyncReporter != nil || t.accounts.opts.Conn != nil
+}
+
+// Indicator returns the sync indicator of a group, empty until it is known.
+func (t *syncTracker) Indicator(groupPK []byte) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if g, ok := t.groups[string(groupPK)]; ok {
+		return g.state.indicator()
+	}
+	return ""
+}
+
+func (t *syncTracker) run(ctx context.Context) {
+	if !t.enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(syncPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if t.poll(ctx, time.Now()) {
+			if current := t.accounts.Current(); current != nil {
+				t.accounts.app.QueueUpdateDraw(func() {
+					current.view.recomputeChannelList(false)
+				})
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll updates the state of the groups of the current account, it returns
+// true if one of them changed.
+func (t *syncTracker) poll(ctx context.Context, now time.Time) bool {
+	current := t.accounts.Current()
+	if current == nil {
+		return false
+	}
+
+	connected := true
+	if conn := t.accounts.opts.Conn; conn != nil {
+		connected = conn.GetState() == connectivity.Ready
+	}
+
+	// the views and statuses are fetched without the lock, the tab list
+	// reads the indicators with the view lock held
+	views := current.view.groupViews()
+	statuses := map[string]*messagesequencer.Status{}
+	if reporter := t.accounts.opts.GroupSyncReporter; reporter != nil && connected {
+		for _, view := range views {
+			// the groups which are not conversations, e.g. the account group,
+			// are only followed through the connection
+			status, err := reporter.ConversationSequenceStatus(ctx, base64.RawURLEncoding.EncodeToString(view.g.PublicKey))
+			if err == nil {
+				statuses[string(view.g.PublicKey)] = &status
+			}
+		}
+	}
+
+	// traced once the lock is released
+	replicated := map[*groupView]uint64{}
+	defer func() {
+		for view, pending := range replicated {
+			view.traceReplication(pending)
+		}
+	}()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case connected:
+		t.disconnectedAt = time.Time{}
+	case t.disconnectedAt.IsZero():
+		t.disconnectedAt = now
+	}
+
+	changed := false
+	for _, view := range views {
+		pk := string(view.g.PublicKey)
+		g, ok := t.groups[pk]
+		if !ok {
+			g = &groupSync{changedAt: now}
+			t.groups[pk] = g
+		}
+
+		state := syncSynced
+		switch status := statuses[pk]; {
+		case !connected:
+			state = syncReplicating
+			if now.Sub(t.disconnectedAt) >= syncStallAfter {
+				state = syncStalled
+			}
+
+		case status == nil:
+			// synced as far as the connection tells
+
+		case status.Pending != g.pending:
+			g.pending, g.changedAt = status.Pending, now
+			replicated[view] = g.pending
+			if g.pending > 0 {
+				state = syncReplicating
+			}
+
+		case status.Pending > 0:
+			state = syncReplicating
+			if now.Sub(g.changedAt) >= syncStallAfter {
+				state = syncStalled
+			}
+		}
+
+		if state != g.state {
+			g.state = state
+			changed = true
+		}
+	}
+
+	return changed
+}
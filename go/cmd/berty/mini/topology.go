@@ -0,0 +1,198 @@
+package mini
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	ma "github.com/multiformats/go-multiaddr"
+
+	"berty.tech/berty/v2/go/internal/netusage"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// devicePeer is the last known connection to a device of the group, as
+// reported by the group device status events.
+type devicePeer struct {
+	peerID       string
+	maddrs       []string
+	connected    bool
+	reconnecting bool
+}
+
+// link returns how the device is reached, the transport of its direct
+// connection or relay.
+func (p *devicePeer) link() string {
+	transport := netusage.TransportOther
+	for _, addr := range p.maddrs {
+		maddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			continue
+		}
+
+		names := []string{}
+		for _, proto := range maddr.Protocols() {
+			names = append(names, proto.Name)
+		}
+
+		// as libp2p, a direct connection is preferred to a relayed one
+		if transport = netusage.Classify(names); transport != netusage.TransportRelay {
+			break
+		}
+	}
+
+	return transport
+}
+
+// updateDevicePeer records a group device status event for the topology
+// view, event is nil when the peer left or is reconnecting.
+func (v *groupView) updateDevicePeer(peerID string, event *protocoltypes.GroupDeviceStatus_Reply_PeerConnected, reconnecting bool) {
+	v.muAggregates.Lock()
+	defer v.muAggregates.Unlock()
+
+	if event != nil {
+		v.peers[string(event.DevicePK)] = &devicePeer{
+			peerID:    peerID,
+			maddrs:    event.GetMaddrs(),
+			connected: true,
+		}
+		// warn again the next time the group is unreachable
+		atomic.StoreInt32(&v.offlineWarned, 0)
+		return
+	}
+
+	// the other events only carry the peer
+	for _, p := range v.peers {
+		if p.peerID != peerID {
+			continue
+		}
+
+		p.connected = false
+		p.reconnecting = reconnecting
+	}
+}
+
+// debugTopologyCommand renders the member devices of the current group and
+// how the node is connected to each of them, direct or relayed. It is a
+// snapshot, run it again to refresh it.
+func debugTopologyCommand(ctx context.Context, v *groupView, _ string) error {
+	// the peers of the group topic, connected to a device or not
+	onTopic := map[string]bool{}
+	groupDebug, err := v.v.protocol.DebugGroup(ctx, &protocoltypes.DebugGroup_Request{GroupPK: v.g.PublicKey})
+	if err != nil {
+		return err
+	}
+	for _, p := range groupDebug.PeerIDs {
+		onTopic[p] = true
+	}
+
+	lines := topologyLines(v, onTopic)
+	for _, line := range lines {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(line),
+		})
+	}
+
+	return nil
+}
+
+func topologyLines(v *groupView, onTopic map[string]bool) []string {
+	v.muAggregates.Lock()
+	defer v.muAggregates.Unlock()
+
+	// the devices of each member, the local ones first
+	members := map[string][]string{}
+	for devicePK, device := range v.devices {
+		members[string(device.MemberPK)] = append(members[string(device.MemberPK)], devicePK)
+	}
+	if _, ok := members[string(v.memberPK)]; !ok {
+		members[string(v.memberPK)] = []string{string(v.devicePK)}
+	}
+
+	memberPKs := make([]string, 0, len(members))
+	for memberPK, devicePKs := range members {
+		memberPKs = append(memberPKs, memberPK)
+		sort.Strings(devicePKs)
+	}
+	sort.Slice(memberPKs, func(i, j int) bool {
+		if local := string(v.memberPK); memberPKs[i] == local || memberPKs[j] == local {
+			return memberPKs[i] == local
+		}
+		return memberPKs[i] < memberPKs[j]
+	})
+
+	direct, relayed, down := 0, 0, 0
+	seen := map[string]bool{}
+	lines := []string{fmt.Sprintf("topology of %s", pkAsShortID(v.g.PublicKey))}
+	for i, memberPK := range memberPKs {
+		branch, indent := "├─", "│  "
+		if i == len(memberPKs)-1 {
+			branch, indent = "└─", "   "
+		}
+
+		title := "member " + pkAsShortID([]byte(memberPK))
+		if memberPK == string(v.memberPK) {
+			title += " (me)"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", branch, title))
+
+		devicePKs := members[memberPK]
+		for j, devicePK := range devicePKs {
+			deviceBranch := "├─"
+			if j == len(devicePKs)-1 {
+				deviceBranch = "└─"
+			}
+
+			state := "local"
+			if devicePK != string(v.devicePK) {
+				p := v.peers[devicePK]
+				switch {
+				case p == nil:
+					state = "·· never connected"
+					down++
+				case !p.connected && p.reconnecting:
+					state = fmt.Sprintf("·· reconnecting <%.15s>", p.peerID)
+					down++
+				case !p.connected:
+					state = fmt.Sprintf("·· disconnected <%.15s>", p.peerID)
+					down++
+				case p.link() == netusage.TransportRelay:
+					state = fmt.Sprintf("~~ relayed <%.15s>", p.peerID)
+					relayed++
+				default:
+					state = fmt.Sprintf("== direct %s <%.15s>", p.link(), p.peerID)
+					direct++
+				}
+
+				if p != nil {
+					seen[p.peerID] = true
+					if p.connected && !onTopic[p.peerID] {
+						state += " not on topic"
+					}
+				}
+			}
+
+			lines = append(lines, fmt.Sprintf("%s%s device %s %s", indent, deviceBranch, pkAsShortID([]byte(devicePK)), state))
+		}
+	}
+
+	// peers of the topic which are not a known device, e.g. replication
+	// servers or devices not announced yet
+	others := []string{}
+	for peerID := range onTopic {
+		if !seen[peerID] {
+			others = append(others, fmt.Sprintf("%.15s", peerID))
+		}
+	}
+	sort.Strings(others)
+	if len(others) > 0 {
+		lines = append(lines, fmt.Sprintf("other peers on topic: %s", strings.Join(others, ", ")))
+	}
+
+	lines = append(lines, fmt.Sprintf("%d direct, %d relayed, %d unreachable", direct, relayed, down))
+
+	return lines
+}
@@ -0,0 +1,60 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// traceCommand shows or hides the protocol events of the current group in
+// its history, to follow the delivery of the messages live.
+func traceCommand(_ context.Context, v *groupView, cmd string) error {
+	switch strings.ToLower(cmd) {
+	case "on":
+		atomic.StoreInt32(&v.tracing, 1)
+	case "off":
+		atomic.StoreInt32(&v.tracing, 0)
+	default:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("usage: /trace on|off"))
+	}
+
+	return nil
+}
+
+// trace appends a dim line to the history when the group is traced, it
+// does not add to the unread badge.
+func (v *groupView) trace(format string, args ...interface{}) {
+	if atomic.LoadInt32(&v.tracing) == 0 {
+		return
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeTrace,
+		payload:     []byte(fmt.Sprintf(format, args...)),
+	})
+}
+
+// traceReplication traces the progress of the replication of the group
+// stores, as reported by the message counters.
+func (v *groupView) traceReplication(pending uint64) {
+	if pending == 0 {
+		v.trace("store replicated, no message pending")
+		return
+	}
+
+	v.trace("store replicating, %d message(s) pending", pending)
+}
+
+// traceGroup traces an event of the group with the given base64 public key,
+// as encoded in the messenger events.
+func (v *tabbedGroupsView) traceGroup(groupPK string, format string, args ...interface{}) {
+	for _, view := range v.groupViews() {
+		if base64.RawURLEncoding.EncodeToString(view.g.PublicKey) == groupPK {
+			view.trace(format, args...)
+		}
+	}
+}
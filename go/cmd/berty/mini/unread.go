@@ -0,0 +1,122 @@
+package mini
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+)
+
+// ReadMarker marks the conversations as read in the messenger, it is
+// implemented by the in-process messenger service.
+type ReadMarker interface {
+	MarkConversationRead(ctx context.Context, conversationPK string) error
+}
+
+// newMessagesDivider is displayed above the first unread message of a group.
+const newMessagesDivider = "— new messages —"
+
+// unreadState tracks the messages received while a group was not displayed.
+type unreadState struct {
+	// first is the first message received since the group was read.
+	first *historyMessage
+	// divider is displayed above first while the group is displayed, it is
+	// removed when leaving the group once read.
+	divider *historyMessage
+	// readTimer marks the displayed group as read, see Opts.MarkReadAfter.
+	readTimer *time.Timer
+}
+
+// trackUnread records m as unread when it is received while the group is
+// not displayed.
+func (v *groupView) trackUnread(m *historyMessage) {
+	v.v.lock.RLock()
+	displayed := v.v.displayedGroupView == v
+	v.v.lock.RUnlock()
+
+	if displayed {
+		return
+	}
+
+	v.muUnread.Lock()
+	defer v.muUnread.Unlock()
+
+	if v.unread.first == nil {
+		v.unread.first = m
+	}
+}
+
+// onDisplayed shows the divider above the first unread message and starts
+// the timer marking the group as read.
+func (v *groupView) onDisplayed() {
+	v.muUnread.Lock()
+	defer v.muUnread.Unlock()
+
+	if v.unread.first == nil {
+		return
+	}
+
+	if v.unread.divider == nil {
+		divider := &historyMessage{messageType: messageTypeDivider, payload: []byte(newMessagesDivider)}
+		if v.messages.InsertBefore(divider, v.unread.first) {
+			v.unread.divider = divider
+		}
+	}
+
+	if after := v.v.accounts.opts.MarkReadAfter; after > 0 && v.unread.readTimer == nil {
+		v.unread.readTimer = time.AfterFunc(after, func() {
+			if err := v.markRead(v.v.ctx); err != nil {
+				v.messages.AppendErr(err)
+			}
+		})
+	}
+}
+
+// onHidden stops the read timer, the divider of a read group is removed.
+func (v *groupView) onHidden() {
+	v.muUnread.Lock()
+	defer v.muUnread.Unlock()
+
+	if v.unread.readTimer != nil {
+		v.unread.readTimer.Stop()
+		v.unread.readTimer = nil
+	}
+
+	if v.unread.first == nil && v.unread.divider != nil {
+		v.messages.Remove(v.unread.divider)
+		v.unread.divider = nil
+	}
+}
+
+// markRead forgets the unread messages of the group and resets its unread
+// counter in the messenger, when possible. The divider stays until the
+// group is left.
+func (v *groupView) markRead(ctx context.Context) error {
+	v.muUnread.Lock()
+	if v.unread.readTimer != nil {
+		v.unread.readTimer.Stop()
+		v.unread.readTimer = nil
+	}
+	v.unread.first = nil
+	v.muUnread.Unlock()
+
+	marker := v.v.accounts.opts.ReadMarker
+	if marker == nil {
+		return nil
+	}
+
+	return marker.MarkConversationRead(ctx, base64.RawURLEncoding.EncodeToString(v.g.PublicKey))
+}
+
+// readCommand marks the current group as read.
+func readCommand(ctx context.Context, v *groupView, _ string) error {
+	if err := v.markRead(ctx); err != nil {
+		return err
+	}
+
+	v.messages.Append(&historyMessage{
+		messageType: messageTypeMeta,
+		payload:     []byte("marked as read"),
+	})
+
+	return nil
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/rivo/tview"
 	"go.uber.org/zap"
 
+	"berty.tech/berty/v2/go/internal/groupprofile"
 	"berty.tech/berty/v2/go/pkg/banner"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 	"berty.tech/weshnet/pkg/logutil"
@@ -33,19 +34,46 @@ type groupView struct {
 	acks         sync.Map
 	devices      map[string]*protocoltypes.GroupMemberDeviceAdded
 	secrets      map[string]*protocoltypes.GroupDeviceChainKeyAdded
+	peers        map[string]*devicePeer
 	muAggregates sync.Mutex
 	logger       *zap.Logger
 	hasNew       int32
+	tracing      int32
 	lastSentCID  string
+	profile      *groupprofile.Tracker
+	editTargets  map[string]editTarget
+	polls        map[string]*pollState
+	lastPollCID  string
+	outbox       *outbox
+	header       *tview.TextView
+	layout       *tview.Flex
+	muUnread     sync.Mutex
+	unread       unreadState
+	slow         slowMode
+
+	// offlineWarned is set once the group was warned about, see
+	// warnIfUnreachable
+	offlineWarned int32
+
+	muHistory sync.Mutex
+	history   historyPages
 }
 
 func (v *groupView) View() tview.Primitive {
-	return v.messages.View()
+	return v.layout
 }
 
 func (v *groupView) commandParser(ctx context.Context, input string) error {
 	input = strings.TrimSpace(input)
 
+	// the aliases never have the name of a command, see loadAliases
+	if steps, ok, err := v.v.accounts.aliases.expand(input); ok {
+		if err != nil {
+			return err
+		}
+		return v.runAlias(ctx, steps)
+	}
+
 	if len(input) > 0 && input[0] == '/' {
 		for _, attrs := range commandList() {
 			if prefix := fmt.Sprintf("/%s", attrs.title); strings.HasPrefix(strings.ToLower(input), prefix) {
@@ -91,17 +119,42 @@ func (v *groupView) OnSubmit(ctx context.Context, input string) {
 }
 
 func newViewGroup(v *tabbedGroupsView, g *protocoltypes.Group, memberPK, devicePK []byte, logger *zap.Logger) *groupView {
+	messages := newHistoryMessageList(v.accounts.redraws, v.messageTemplate)
+
+	v.lock.RLock()
+	messages.options.hideDiffs = v.hideDiffs
+	v.lock.RUnlock()
+	messages.options.masked = v.accounts.privacy.Masked()
+	messages.options.accessible = v.accounts.accessible()
+	header := tview.NewTextView().SetDynamicColors(true)
+
+	// only multi-member groups have a profile
+	headerSize := 0
+	if g.GroupType == protocoltypes.GroupTypeMultiMember {
+		headerSize = 1
+		header.SetText(groupProfileHeader(groupprofile.Profile{}))
+	}
+
 	return &groupView{
-		memberPK:     memberPK,
-		devicePK:     devicePK,
-		v:            v,
-		g:            g,
-		messages:     newHistoryMessageList(v.app),
+		memberPK: memberPK,
+		devicePK: devicePK,
+		v:        v,
+		g:        g,
+		messages: messages,
+		profile:  groupprofile.NewTracker(g.GroupType),
+		header:   header,
+		layout: tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(header, headerSize, 0, false).
+			AddItem(messages.View(), 0, 1, false),
 		syncMessages: make(chan *historyMessage),
 		inputHistory: newInputHistory(),
 		logger:       logger.With(logutil.PrivateString("group", pkAsShortID(g.PublicKey))),
 		devices:      map[string]*protocoltypes.GroupMemberDeviceAdded{},
 		secrets:      map[string]*protocoltypes.GroupDeviceChainKeyAdded{},
+		peers:        map[string]*devicePeer{},
+		editTargets:  map[string]editTarget{},
+		polls:        map[string]*pollState{},
+		outbox:       newOutbox(),
 	}
 }
 
@@ -171,52 +224,12 @@ func (v *groupView) loop(ctx context.Context) {
 		}()
 	}
 
-	// list group message events
-	{
-		req := &protocoltypes.GroupMessageList_Request{GroupPK: v.g.PublicKey, UntilNow: true}
-		cl, err := v.v.protocol.GroupMessageList(ctx, req)
-		if err != nil {
-			panic(err)
-		}
-
-		for {
-			evt, err := cl.Recv()
-			if err != nil {
-				if err != io.EOF {
-					panic(err)
-				}
-				break
-			}
-			lastMessageID = evt.EventContext.ID
-
-			amp, am, err := messengertypes.UnmarshalAppMessage(evt.GetMessage())
-			if err != nil {
-				v.messages.Prepend(&historyMessage{
-					messageType: messageTypeMessage,
-					payload:     []byte(err.Error()),
-					sender:      evt.Headers.DevicePK,
-				}, time.Time{})
-				continue
-			}
-
-			switch am.GetType() {
-			case messengertypes.AppMessage_TypeAcknowledge:
-				if !bytes.Equal(evt.Headers.DevicePK, v.devicePK) {
-					continue
-				}
-				v.acks.Store(am.TargetCID, true)
-
-			case messengertypes.AppMessage_TypeUserMessage:
-				payload := amp.(*messengertypes.AppMessage_UserMessage)
-				v.messages.Prepend(&historyMessage{
-					messageType: messageTypeMessage,
-					payload:     []byte(payload.Body),
-					sender:      evt.Headers.DevicePK,
-					receivedAt:  time.Unix(0, am.GetSentDate()*1000000),
-				}, time.Time{})
-			}
-		}
+	// list the last page of the group message events, the older ones are
+	// loaded on demand, see loadOlderHistory
+	if err := v.loadHistoryPage(ctx); err != nil {
+		panic(err)
 	}
+	lastMessageID = v.historyCursor()
 
 	// list group metadata events
 	{
@@ -284,9 +297,12 @@ func (v *groupView) loop(ctx context.Context) {
 					continue
 				}
 
+				v.trace("message received: %s from device %s, cid %s", am.GetType(), pkAsShortID(evt.Headers.DevicePK), eventCID(evt.EventContext))
+
 				switch am.GetType() {
 				case messengertypes.AppMessage_TypeAcknowledge:
 					if !bytes.Equal(evt.Headers.DevicePK, v.devicePK) {
+						v.receivedAck(am.TargetCID)
 						continue
 					}
 					var payload messengertypes.AppMessage_Acknowledge
@@ -307,12 +323,37 @@ func (v *groupView) loop(ctx context.Context) {
 
 					receivedAt := time.Unix(0, am.GetSentDate()*1000000)
 
-					v.messages.Append(&historyMessage{
+					m := &historyMessage{
 						messageType: messageTypeMessage,
-						payload:     []byte(payload.Body),
+						cid:         eventCID(evt.EventContext),
+						payload:     []byte(userMessageBody(am.GetPayload(), payload.Body)),
 						sender:      evt.Headers.DevicePK,
 						receivedAt:  receivedAt,
-					})
+						starred:     v.isStarred(eventCID(evt.EventContext)),
+					}
+					if !v.trackPoll(eventCID(evt.EventContext), evt.Headers.DevicePK, &am, m) {
+						m.edited = v.trackEdit(eventCID(evt.EventContext), evt.Headers.DevicePK, &am, payload.Body)
+					}
+					if bytes.Equal(evt.Headers.DevicePK, v.devicePK) {
+						v.receivedBack(eventCID(evt.EventContext), m)
+					} else {
+						v.v.accounts.scripts.onMessage(v, m)
+					}
+					v.messages.Append(m)
+					v.addBadge()
+					if !bytes.Equal(evt.Headers.DevicePK, v.devicePK) {
+						v.trackUnread(m)
+						v.announceMessage(m)
+					}
+
+				case messengertypes.AppMessage_TypeGroupInvitation:
+					var payload messengertypes.AppMessage_GroupInvitation
+					if err := proto.Unmarshal(am.GetPayload(), &payload); err != nil {
+						v.logger.Error("failed to unmarshal GroupInvitation", zap.Error(err))
+						continue
+					}
+
+					v.receiveGroupInvitation(evt.Headers.DevicePK, &am, &payload, false)
 					v.addBadge()
 				}
 			}
@@ -343,6 +384,8 @@ func (v *groupView) loop(ctx context.Context) {
 					return
 				}
 
+				v.trace("metadata received: %s, cid %s", evt.Metadata.EventType, eventCID(evt.EventContext))
+
 				// @TODO: Log this
 				metadataEventHandler(ctx, v, evt, false, v.logger)
 			}
@@ -379,7 +422,11 @@ func (v *groupView) loop(ctx context.Context) {
 }
 
 func (v *groupView) welcomeEventDisplay() {
-	bannerLines := strings.Split(banner.OfTheDay(), "\n")
+	// the screen readers cannot read the ASCII art
+	bannerLines := []string(nil)
+	if !v.v.accounts.accessible() {
+		bannerLines = strings.Split(banner.OfTheDay(), "\n")
+	}
 	v.messages.lock.Lock()
 	for i := range bannerLines {
 		v.messages.historyScroll.InsertRow(0)
@@ -9,6 +9,7 @@ import (
 
 	"go.uber.org/zap"
 
+	"berty.tech/berty/v2/go/internal/contactspam"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 	"berty.tech/weshnet/pkg/protocoltypes"
@@ -125,18 +126,35 @@ func handlerAccountContactRequestIncomingReceived(ctx context.Context, v *groupV
 
 	name := string(casted.ContactMetadata)
 
+	// replayed requests have no reception time and don't count toward the rate
+	request := contactspam.Request{ContactPK: base64.StdEncoding.EncodeToString(casted.ContactPK), DisplayName: name}
+	if !isHistory {
+		request.ReceivedAt = time.Now()
+	}
+	score := v.v.spamScorer.Score(request)
+
+	warning := ""
+	if score.Level == contactspam.LevelSuspicious {
+		warning = fmt.Sprintf(" [%s]", score)
+	}
+
 	addToBuffer(&historyMessage{
 		messageType: messageTypeMeta,
-		payload:     []byte(fmt.Sprintf("incoming request received %s, type /contact accept %s (alt. /contact discard <id>)", name, base64.StdEncoding.EncodeToString(casted.ContactPK))),
+		payload:     []byte(fmt.Sprintf("incoming request received %s%s, type /contact accept %s (alt. /contact discard <id>)", name, warning, base64.StdEncoding.EncodeToString(casted.ContactPK))),
 		sender:      casted.DevicePK,
 	}, v, isHistory)
 
 	v.v.lock.Lock()
 	if _, hasValue := v.v.contactStates[string(casted.ContactPK)]; !hasValue || !isHistory {
 		v.v.contactStates[string(casted.ContactPK)] = protocoltypes.ContactStateReceived
+		v.v.contactRequests[string(casted.ContactPK)] = contactRequestInfo{name: name, score: score}
 	}
 	v.v.lock.Unlock()
 
+	if !isHistory {
+		v.v.accounts.scripts.onContactRequest(casted.ContactPK, name, score)
+	}
+
 	gInfo, err := v.v.protocol.GroupInfo(ctx, &protocoltypes.GroupInfo_Request{
 		ContactPK: casted.ContactPK,
 	})
@@ -321,6 +339,7 @@ func groupDeviceStatusHandler(logger *zap.Logger, v *groupView, e *protocoltypes
 		}
 
 		payload = fmt.Sprintf("device status updated: connected <%.15s> on: %s(%s)", event.GetPeerID(), activeAddr, activeTransport)
+		v.updateDevicePeer(event.GetPeerID(), event, false)
 
 	case protocoltypes.TypePeerDisconnected:
 		event := &protocoltypes.GroupDeviceStatus_Reply_PeerDisconnected{}
@@ -329,6 +348,7 @@ func groupDeviceStatusHandler(logger *zap.Logger, v *groupView, e *protocoltypes
 			return
 		}
 		payload = fmt.Sprintf("device status updated: left <%.15s>", event.GetPeerID())
+		v.updateDevicePeer(event.GetPeerID(), nil, false)
 
 	case protocoltypes.TypePeerReconnecting:
 		event := &protocoltypes.GroupDeviceStatus_Reply_PeerReconnecting{}
@@ -337,6 +357,7 @@ func groupDeviceStatusHandler(logger *zap.Logger, v *groupView, e *protocoltypes
 			return
 		}
 		payload = fmt.Sprintf("device status updated: reconnecting <%.15s>", event.GetPeerID())
+		v.updateDevicePeer(event.GetPeerID(), nil, true)
 	default:
 		logger.Warn("unknow group device status event received")
 		return
@@ -354,6 +375,8 @@ func metadataEventHandler(ctx context.Context, v *groupView, e *protocoltypes.Gr
 		payload:     []byte(fmt.Sprintf("event type: %s", e.Metadata.EventType.String())),
 	}, v, isHistory)
 
+	handleGroupProfileEvent(v, e, isHistory, logger)
+
 	actions := map[protocoltypes.EventType]func(context.Context, *groupView, *protocoltypes.GroupMetadataEvent, bool) error{
 		protocoltypes.EventTypeAccountContactBlocked:                  nil, // do it later
 		protocoltypes.EventTypeAccountContactRequestDisabled:          handlerNoop,
@@ -370,8 +393,8 @@ func metadataEventHandler(ctx context.Context, v *groupView, e *protocoltypes.Gr
 		protocoltypes.EventTypeContactAliasKeyAdded:                   handlerContactAliasKeyAdded,
 		protocoltypes.EventTypeGroupDeviceChainKeyAdded:               handlerGroupDeviceChainKeyAdded,
 		protocoltypes.EventTypeGroupMemberDeviceAdded:                 handlerGroupMemberDeviceAdded,
-		protocoltypes.EventTypeGroupMetadataPayloadSent:               nil, // do it later
-		protocoltypes.EventTypeMultiMemberGroupAdminRoleGranted:       nil, // do it later
+		protocoltypes.EventTypeGroupMetadataPayloadSent:               handlerNoop, // profile updates are handled above
+		protocoltypes.EventTypeMultiMemberGroupAdminRoleGranted:       nil,         // do it later
 		protocoltypes.EventTypeMultiMemberGroupAliasResolverAdded:     handlerMultiMemberGroupAliasResolverAdded,
 		protocoltypes.EventTypeMultiMemberGroupInitialMemberAnnounced: handlerMultiMemberGroupInitialMemberAnnounced,
 	}
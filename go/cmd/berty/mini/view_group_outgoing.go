@@ -7,12 +7,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/atotto/clipboard"
 	"github.com/gdamore/tcell"
-	"github.com/golang/protobuf/proto" // nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
 	"github.com/ipfs/go-cid"
 	"github.com/mdp/qrterminal/v3"
 	"moul.io/godev"
@@ -60,6 +59,156 @@ func commandList() []*command {
 			help:  "Lists keyboard shortcuts",
 			cmd:   cmdKeyboard,
 		},
+		{
+			title: "goto",
+			help:  "Jumps to the first message received on a given date (YYYY-MM-DD)",
+			cmd:   gotoDateCommand,
+		},
+		{
+			title: "keys",
+			help:  "Shows which devices of the group exchanged their keys with this device",
+			cmd:   keysStatusCommand,
+		},
+		{
+			title: "rekey",
+			help:  "Goes through the key exchange of the group again, for members unable to decrypt messages",
+			cmd:   rekeyCommand,
+		},
+		{
+			title: "account list",
+			help:  "Lists the opened accounts mini can switch to",
+			cmd:   accountListCommand,
+		},
+		{
+			title: "account switch",
+			help:  "Switches to another opened account, e.g. /account switch <id>",
+			cmd:   accountSwitchCommand,
+		},
+		{
+			title: "ping",
+			help:  "Measures the round trip time with the contact of the current group, or /ping <contact name>",
+			cmd:   pingCommand,
+		},
+		{
+			title: "device revoke",
+			help:  "Asks a lost device of your account to delete its account data, e.g. /device revoke <device pk>",
+			cmd:   deviceRevokeCommand,
+		},
+		{
+			title: "edit",
+			help:  "Replaces the text of your last message in the current group",
+			cmd:   editCommand,
+		},
+		{
+			title: "diff",
+			help:  "Shows or hides what edits changed, e.g. /diff on|off",
+			cmd:   diffCommand,
+		},
+		{
+			title: "privacy",
+			help:  "Masks the text of the messages until Ctrl+R reveals them, e.g. /privacy on|off",
+			cmd:   privacyCommand,
+		},
+		{
+			title: "trace",
+			help:  "Shows the protocol events of the current group in its history, e.g. /trace on|off",
+			cmd:   traceCommand,
+		},
+		{
+			title: "resend",
+			help:  "Sends again a message flagged with " + resendMarker + ", the last one or the given number, e.g. /resend 3",
+			cmd:   resendCommand,
+		},
+		{
+			title: "copy",
+			help:  "Copies the text of the last message or of the given one from the end, e.g. /copy 2, it is printed when there is no clipboard",
+			cmd:   copyCommand,
+		},
+		{
+			title: "star",
+			help:  "Stars the last message or the given one from the end, e.g. /star 2, or unstars it, the starred messages are listed in the Bookmarks tab",
+			cmd:   starCommand,
+		},
+		{
+			title: "bookmarks",
+			help:  "Lists the starred messages of all the conversations, Enter jumps to the selected one",
+			cmd:   bookmarksCommand,
+		},
+		{
+			title: "schedule list",
+			help:  "Lists the messages scheduled in the current group",
+			cmd:   scheduleListCommand,
+		},
+		{
+			title: "schedule cancel",
+			help:  "Cancels a scheduled message, e.g. /schedule cancel <id>",
+			cmd:   scheduleCancelCommand,
+		},
+		{
+			title: "loc",
+			help:  "Sends a location as a map link, e.g. /loc 48.8584 2.2945 Eiffel Tower, or the location of this device with /loc here",
+			cmd:   locationCommand,
+		},
+		{
+			title: "presence",
+			help:  "Shows whether you and your contacts are away, /presence away until /presence active, you are away automatically when the keyboard is not used",
+			cmd:   presenceCommand,
+		},
+		{
+			title: "poll",
+			help:  `Sends a poll, e.g. /poll "Where to eat?" pizza "sushi bar", -multi allows several choices and -closes 2h closes it after 2 hours`,
+			cmd:   pollCommand,
+		},
+		{
+			title: "vote",
+			help:  "Votes on the last poll of the group, e.g. /vote 2, or /vote 1 3 for a multiple choice poll",
+			cmd:   voteCommand,
+		},
+		{
+			title: "schedule",
+			help:  "Sends a message later, e.g. /schedule 90m <text>, /schedule 18:30 <text> or /schedule 2006-01-02T15:04 <text>",
+			cmd:   scheduleCommand,
+		},
+		{
+			title: "topic",
+			help:  "Shows the topic of the current group, /topic <text> changes it if you are an admin of the group",
+			cmd:   topicCommand,
+		},
+		{
+			title: "group topic",
+			help:  "Sets the topic of the current group, e.g. /group topic <text>",
+			cmd:   groupProfileCommand("topic"),
+		},
+		{
+			title: "group description",
+			help:  "Sets the description of the current group",
+			cmd:   groupProfileCommand("description"),
+		},
+		{
+			title: "group avatar",
+			help:  "Sets the avatar of the current group, e.g. /group avatar <cid>",
+			cmd:   groupProfileCommand("avatar"),
+		},
+		{
+			title: "group approval",
+			help:  "Shows or sets whether the new members of the current group wait for an admin, e.g. /group approval on",
+			cmd:   groupApprovalCommand,
+		},
+		{
+			title: "group requests",
+			help:  "Lists the join requests of the current group",
+			cmd:   groupRequestsCommand,
+		},
+		{
+			title: "group approve",
+			help:  "Approves a member waiting to join the current group, e.g. /group approve <member pk>",
+			cmd:   groupDecideCommand(true),
+		},
+		{
+			title: "group deny",
+			help:  "Denies a member waiting to join the current group, their messages are dropped",
+			cmd:   groupDecideCommand(false),
+		},
 		{
 			title: "group new",
 			help:  "Creates a new group",
@@ -75,6 +224,11 @@ func commandList() []*command {
 			help:  "Displays a invite Link for the current group",
 			cmd:   groupInviteCommand(renderText),
 		},
+		{
+			title: "group invite",
+			help:  "Sends an invitation to the current group to a contact, it shows in their Invitations list",
+			cmd:   groupInviteContactCommand,
+		},
 		{
 			title: "group join",
 			help:  "Creates joins an existing group, a group invite must be supplied",
@@ -110,6 +264,31 @@ func commandList() []*command {
 			help:  "Output a shareable contact URL",
 			cmd:   contactShareCommand(renderText),
 		},
+		{
+			title: "contacts export",
+			help:  "Exports the contact list to a CSV or JSON file, a path must be supplied",
+			cmd:   contactsExportCommand,
+		},
+		{
+			title: "contact requests",
+			help:  "Lists pending contact requests with their spam score",
+			cmd:   contactRequestsCommand,
+		},
+		{
+			title: "contact backlog",
+			help:  "Lists the contact requests deferred after too many were received, answer them with /contact accept or /contact discard",
+			cmd:   contactBacklogCommand,
+		},
+		{
+			title: "contact outgoing",
+			help:  "Lists the contact requests sent and not answered yet",
+			cmd:   contactOutgoingCommand,
+		},
+		{
+			title: "contact cancel",
+			help:  "Cancels an outgoing contact request, a contact id must be supplied",
+			cmd:   contactCancelCommand,
+		},
 		{
 			title: "contact request",
 			help:  "Sends a contact request, a shareable contact must be supplied",
@@ -120,11 +299,31 @@ func commandList() []*command {
 			help:  "Changes your display name used in contact request URLs and outgoing contact requests",
 			cmd:   setDisplayName,
 		},
+		{
+			title: "profile",
+			help:  "Shows whether your display name is published, /profile hide to keep it private (contacts see a short public key), /profile show to publish it again",
+			cmd:   profileCommand,
+		},
+		{
+			title: "settings",
+			help:  "Opens the settings: the privacy of the account (typing indicators, read receipts and display name) and the spelling languages",
+			cmd:   settingsCommand,
+		},
+		{
+			title: "read",
+			help:  "Marks the current group as read, it is also marked once displayed for -mini.mark-read-after",
+			cmd:   readCommand,
+		},
 		{
 			title: "alias send",
 			help:  "Sends own alias key to a contact",
 			cmd:   aliasSendCommand,
 		},
+		{
+			title: "alias",
+			help:  "Lists the aliases defined in the -mini.aliases-file file, e.g. brb = Be right back",
+			cmd:   aliasListCommand,
+		},
 		// {
 		// 	title: "alias prove",
 		// 	help:  "Sends an alias proof to a group",
@@ -175,6 +374,11 @@ func commandList() []*command {
 			help:  "Inspect a group store",
 			cmd:   debugInspectStoreCommand,
 		},
+		{
+			title: "debug topology",
+			help:  "Shows the member devices of the group, connected directly or through a relay",
+			cmd:   debugTopologyCommand,
+		},
 		{
 			title: "debug push",
 			help:  "Resend the last message via push",
@@ -245,6 +449,16 @@ func commandList() []*command {
 			help:  `special debug messenger command`,
 			cmd:   newDebugMessengerCommand,
 		},
+		{
+			title: "netconf show",
+			help:  "Lists the network configuration of the account",
+			cmd:   netconfShowCommand,
+		},
+		{
+			title: "netconf set",
+			help:  "Changes a setting of the network configuration of the account, e.g. /netconf set mdns off, see /netconf show for the keys",
+			cmd:   netconfSetCommand,
+		},
 		{
 			title: "netmanager get",
 			help:  `Get a netmanager state`,
@@ -409,7 +623,7 @@ func credentialVerificationInit(ctx context.Context, v *groupView, service strin
 		messageType: messageTypeMeta,
 		payload:     []byte(fmt.Sprintf("Auth URL: %s", flowDetails.URL)),
 	})
-	copyToClipboard(v, flowDetails.URL)
+	copyToClipboard(v, flowDetails.URL, true)
 
 	return nil
 }
@@ -501,7 +715,7 @@ func authInit(ctx context.Context, v *groupView, cmd string) error {
 		payload:     []byte(fmt.Sprintf("Auth URL: %s", rep.URL)),
 	})
 
-	copyToClipboard(v, rep.URL)
+	copyToClipboard(v, rep.URL, true)
 
 	if !rep.SecureURL {
 		v.messages.Append(&historyMessage{
@@ -576,6 +790,37 @@ func setDisplayName(_ context.Context, v *groupView, cmd string) error {
 	return nil
 }
 
+func gotoDateCommand(ctx context.Context, v *groupView, cmd string) error {
+	day, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(cmd), time.Local)
+	if err != nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("expected a date formatted as YYYY-MM-DD: %w", err))
+	}
+
+	// the messages of the day follow the last one received before it
+	if pages, err := v.loadHistoryUntil(ctx, day); err != nil {
+		return err
+	} else if pages > 0 {
+		v.syncMessages <- &historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(fmt.Sprintf("loaded %d page(s) of older messages", pages)),
+		}
+	}
+
+	m, ok := v.messages.JumpToDate(day)
+	if !ok {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("no message received on or after %s", day.Format("2006-01-02")))
+	}
+
+	if m.receivedAt.Format("2006-01-02") != day.Format("2006-01-02") {
+		v.syncMessages <- &historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(fmt.Sprintf("no message on %s, showing %s instead", day.Format("2006-01-02"), m.receivedAt.Format("2006-01-02"))),
+		}
+	}
+
+	return nil
+}
+
 func debugIPFSCommand(ctx context.Context, v *groupView, _ string) error {
 	config, err := v.v.protocol.ServiceGetConfiguration(ctx, &protocoltypes.ServiceGetConfiguration_Request{})
 	if err != nil {
@@ -642,6 +887,39 @@ func contactDiscardAllCommand(ctx context.Context, v *groupView, cmd string) err
 	return nil
 }
 
+func contactRequestsCommand(_ context.Context, v *groupView, _ string) error {
+	v.v.lock.RLock()
+	lines := []string(nil)
+
+	for id, contactState := range v.v.contactStates {
+		if contactState != protocoltypes.ContactStateReceived {
+			continue
+		}
+
+		info := v.v.contactRequests[id]
+		lines = append(lines, fmt.Sprintf("%s %s, score %s", base64.StdEncoding.EncodeToString([]byte(id)), info.name, info.score))
+	}
+	v.v.lock.RUnlock()
+
+	if len(lines) == 0 {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte("no pending contact requests"),
+		})
+		return nil
+	}
+
+	sort.Strings(lines)
+	for _, line := range lines {
+		v.messages.Append(&historyMessage{
+			messageType: messageTypeMeta,
+			payload:     []byte(line),
+		})
+	}
+
+	return nil
+}
+
 func contactAcceptAllCommand(ctx context.Context, v *groupView, cmd string) error {
 	v.v.lock.Lock()
 	toAdd := [][]byte(nil)
@@ -1131,9 +1409,7 @@ func groupNewCommand(ctx context.Context, v *groupView, _ string) error {
 }
 
 func contactRequestCommand(ctx context.Context, v *groupView, cmd string) error {
-	v.v.lock.Lock()
-	displayName := v.v.displayName
-	v.v.lock.Unlock()
+	displayName := v.v.publishedDisplayName()
 
 	link, err := bertylinks.UnmarshalLink(cmd, nil) // FIXME: support passing an optional passphrase to decrypt the link
 	if err != nil {
@@ -1166,24 +1442,7 @@ func newMessageCommand(ctx context.Context, v *groupView, cmd string) error {
 		return nil
 	}
 
-	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{
-		Body: cmd,
-	})
-	if err != nil {
-		return err
-	}
-	ret, err := v.v.messenger.Interact(ctx, &messengertypes.Interact_Request{
-		Type:                  messengertypes.AppMessage_TypeUserMessage,
-		Payload:               payload,
-		ConversationPublicKey: base64.RawURLEncoding.EncodeToString(v.g.PublicKey),
-	})
-	if err != nil {
-		return err
-	}
-
-	v.lastSentCID = ret.CID
-
-	return nil
+	return v.sendUserMessage(ctx, cmd)
 }
 
 func newDebugNetManagerGetCommand(ctx context.Context, v *groupView, cmd string) error {
@@ -1291,7 +1550,7 @@ func renderQR(v *groupView, url string) {
 		}
 	}
 
-	copyToClipboard(v, strings.Join(qr, "\n"))
+	copyToClipboard(v, strings.Join(qr, "\n"), true)
 }
 
 func renderText(v *groupView, url string) {
@@ -1300,25 +1559,7 @@ func renderText(v *groupView, url string) {
 		payload:     []byte(url),
 	}
 
-	copyToClipboard(v, url)
-}
-
-func copyToClipboard(v *groupView, txt string) {
-	if clipboard.Unsupported {
-		return
-	}
-
-	if err := clipboard.WriteAll(txt); err != nil {
-		v.syncMessages <- &historyMessage{
-			messageType: messageTypeError,
-			payload:     []byte(fmt.Sprintf("(Copy to clipboard failed: %v)", err)),
-		}
-	} else {
-		v.syncMessages <- &historyMessage{
-			messageType: messageTypeMeta,
-			payload:     []byte("(Copied to clipboard)"),
-		}
-	}
+	copyToClipboard(v, url, true)
 }
 
 func contactRequestsOnCommand(ctx context.Context, v *groupView, cmd string) error {
@@ -11,6 +11,7 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/rivo/tview"
 
+	"berty.tech/berty/v2/go/internal/contactspam"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 	"berty.tech/weshnet/pkg/netmanager"
 	"berty.tech/weshnet/pkg/protocoltypes"
@@ -23,6 +24,7 @@ type tabbedGroupsView struct {
 	topics                 *tview.Table
 	activeViewContainer    *tview.Flex
 	selectedGroupView      *groupView
+	displayedGroupView     *groupView
 	accountGroupView       *groupView
 	contactGroupViews      []*groupView
 	multiMembersGroupViews []*groupView
@@ -32,6 +34,30 @@ type tabbedGroupsView struct {
 	contactStates          map[string]protocoltypes.ContactState
 	contactNames           map[string]string
 	netmanager             *netmanager.NetManager
+	accounts               *accountManager
+	restored               *accountState
+	spamScorer             *contactspam.Scorer
+	contactRequests        map[string]contactRequestInfo
+	messageTemplate        *messageTemplate
+	hideDiffs              bool
+	locationConsent        bool
+	invitations            []*groupInvitation
+	selectedInvitation     *groupInvitation
+	declinedInvitations    map[string]bool
+	invitationView         *tview.TextView
+	bookmarksSelected      bool
+	bookmarksView          *tview.TextView
+	bookmarkCursor         int
+
+	// replicatedGroups holds the public keys of the conversations stored by
+	// a replication server
+	replicatedGroups sync.Map
+}
+
+// contactRequestInfo is what mini knows about a received contact request.
+type contactRequestInfo struct {
+	name  string
+	score contactspam.Score
 }
 
 func (v *tabbedGroupsView) getChannelViewGroups() []*groupView {
@@ -61,7 +87,7 @@ func groupLabelWithBadge(cg *groupView, name string) string {
 		name = pkAsShortID(cg.g.PublicKey)
 	}
 
-	return fmt.Sprintf("%s%s", badge, name)
+	return fmt.Sprintf("%s%s%s", badge, cg.v.accounts.sync.Indicator(cg.g.PublicKey), name)
 }
 
 func (v *tabbedGroupsView) getChannelLabels() []string {
@@ -71,10 +97,12 @@ func (v *tabbedGroupsView) getChannelLabels() []string {
 	if len(v.contactGroupViews) > 0 {
 		topics = append(topics, "Contacts")
 
+		// the contacts sharing a display name are told apart
+		refs := v.contactReferences()
 		for _, cg := range v.contactGroupViews {
 			name := ""
-			if displayName, ok := v.contactNames[string(cg.g.PublicKey)]; ok {
-				name = displayName
+			if ref, ok := refs[string(cg.g.PublicKey)]; ok {
+				name = ref
 			}
 
 			topics = append(topics, groupLabelWithBadge(cg, name))
@@ -96,23 +124,59 @@ func (v *tabbedGroupsView) recomputeChannelList(viewChanged bool) {
 	v.lock.Lock()
 	defer v.lock.Unlock()
 
-	groups := v.getChannelViewGroups()
+	// the last bookmark was removed
+	if v.bookmarksSelected && len(v.accounts.starred.list(v.accountKey())) == 0 {
+		v.bookmarksSelected = false
+		viewChanged = true
+	}
+
+	items := v.getSidebarItems()
 
 	v.topics.Clear()
-	for i, l := range v.getChannelLabels() {
+	for i, l := range v.getSidebarLabels() {
 		v.topics.SetCellSimple(i, 0, l)
 		cell := v.topics.GetCell(i, 0)
 
-		if groups[i] == nil {
+		if items[i].isTitle() {
 			cell.SetTextColor(tcell.ColorGray)
-		} else if v.selectedGroupView == groups[i] {
+		} else if v.isSelected(items[i]) {
 			cell.SetBackgroundColor(tcell.ColorBlue).SetTextColor(tcell.ColorWhite)
+		} else if items[i].invitation != nil {
+			cell.SetTextColor(tcell.ColorYellow)
 		}
 	}
 
+	if v.bookmarksSelected {
+		v.renderBookmarks()
+	}
+
 	if viewChanged {
+		displayed := v.selectedGroupView
 		v.activeViewContainer.Clear()
-		v.activeViewContainer.AddItem(v.selectedGroupView.View(), 0, 1, false)
+		if v.selectedInvitation != nil {
+			displayed = nil
+			v.renderInvitation(v.selectedInvitation)
+			v.activeViewContainer.AddItem(v.invitationView, 0, 1, false)
+		} else if v.bookmarksSelected {
+			displayed = nil
+			v.activeViewContainer.AddItem(v.bookmarksView, 0, 1, false)
+		} else {
+			v.activeViewContainer.AddItem(v.selectedGroupView.View(), 0, 1, false)
+		}
+
+		if displayed != v.displayedGroupView {
+			v.accounts.drafts.switchGroup(v.displayedGroupView, displayed)
+			if v.displayedGroupView != nil {
+				v.displayedGroupView.onHidden()
+			}
+			v.displayedGroupView = displayed
+			if displayed != nil {
+				displayed.onDisplayed()
+			}
+
+			// the lock is held
+			go v.announceDisplayed(displayed)
+		}
 	}
 }
 
@@ -157,7 +221,12 @@ func (v *tabbedGroupsView) AddContextGroup(ctx context.Context, g *protocoltypes
 		v.contactGroupViews = append(v.contactGroupViews, vg)
 	} else if g.GroupType == protocoltypes.GroupTypeMultiMember {
 		v.multiMembersGroupViews = append(v.multiMembersGroupViews, vg)
+
+		// the group may have been joined from another device
+		v.removeInvitation(g.PublicKey)
 	}
+
+	v.restoreGroupState(vg)
 }
 
 func (v *tabbedGroupsView) PrevGroup() {
@@ -165,24 +234,7 @@ func (v *tabbedGroupsView) PrevGroup() {
 	defer v.recomputeChannelList(true)
 	defer v.lock.Unlock()
 
-	if v.selectedGroupView == v.accountGroupView {
-		return
-	}
-
-	groups := v.getChannelViewGroups()
-	for i, item := range groups {
-		if v.selectedGroupView == item {
-			if groups[i-1] == nil {
-				v.selectedGroupView = groups[i-2]
-			} else {
-				v.selectedGroupView = groups[i-1]
-			}
-
-			atomic.StoreInt32(&v.selectedGroupView.hasNew, 0)
-
-			break
-		}
-	}
+	v.moveSelection(-1)
 }
 
 func (v *tabbedGroupsView) NextGroup() {
@@ -190,25 +242,7 @@ func (v *tabbedGroupsView) NextGroup() {
 	defer v.recomputeChannelList(true)
 	defer v.lock.Unlock()
 
-	groups := v.getChannelViewGroups()
-
-	if v.selectedGroupView == groups[len(groups)-1] {
-		return
-	}
-
-	for i, item := range groups {
-		if v.selectedGroupView == item {
-			if groups[i+1] == nil {
-				v.selectedGroupView = groups[i+2]
-			} else {
-				v.selectedGroupView = groups[i+1]
-			}
-
-			atomic.StoreInt32(&v.selectedGroupView.hasNew, 0)
-
-			break
-		}
-	}
+	v.moveSelection(+1)
 }
 
 func (v *tabbedGroupsView) GetActiveViewGroup() *groupView {
@@ -218,6 +252,16 @@ func (v *tabbedGroupsView) GetActiveViewGroup() *groupView {
 	return v.selectedGroupView
 }
 
+// groupViews returns the views of the account, contact and multi member
+// groups.
+func (v *tabbedGroupsView) groupViews() []*groupView {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	views := append([]*groupView{v.accountGroupView}, v.contactGroupViews...)
+	return append(views, v.multiMembersGroupViews...)
+}
+
 func (v *tabbedGroupsView) GetTabs() tview.Primitive {
 	return v.topics
 }
@@ -256,6 +300,13 @@ func (v *tabbedGroupsView) handleEventStream(ctx context.Context) error {
 						messageType: messageTypeMeta,
 						payload:     []byte(m),
 					})
+					v.traceGroup(evt.GroupPK, "peer <%.15s> associated to the group, device %.8s", evt.PeerID, evt.DevicePK)
+				}
+
+			case messengertypes.StreamEvent_TypeConversationUpdated:
+				var evt messengertypes.StreamEvent_ConversationUpdated
+				if merr = proto.Unmarshal(msg.GetEvent().GetPayload(), &evt); merr == nil {
+					v.trackReplication(evt.GetConversation())
 				}
 
 			case messengertypes.StreamEvent_TypePeerStatusConnected:
@@ -266,6 +317,9 @@ func (v *tabbedGroupsView) handleEventStream(ctx context.Context) error {
 						messageType: messageTypeMeta,
 						payload:     []byte(m),
 					})
+					for _, groupPK := range gm[evt.PeerID] {
+						v.traceGroup(groupPK, "peer <%.15s> connected, transport %s", evt.PeerID, evt.GetTransport())
+					}
 				}
 
 			case messengertypes.StreamEvent_TypePeerStatusDisconnected:
@@ -276,6 +330,9 @@ func (v *tabbedGroupsView) handleEventStream(ctx context.Context) error {
 						messageType: messageTypeMeta,
 						payload:     []byte(m),
 					})
+					for _, groupPK := range gm[evt.PeerID] {
+						v.traceGroup(groupPK, "peer <%.15s> disconnected", evt.PeerID)
+					}
 				}
 			}
 
@@ -293,7 +350,7 @@ func (v *tabbedGroupsView) handleEventStream(ctx context.Context) error {
 	return nil
 }
 
-func newTabbedGroups(ctx context.Context, g *protocoltypes.GroupInfo_Reply, protocol protocoltypes.ProtocolServiceClient, messenger messengertypes.MessengerServiceClient, app *tview.Application, displayName string, netmanger *netmanager.NetManager) *tabbedGroupsView {
+func newTabbedGroups(ctx context.Context, g *protocoltypes.GroupInfo_Reply, protocol protocoltypes.ProtocolServiceClient, messenger messengertypes.MessengerServiceClient, app *tview.Application, displayName string, netmanger *netmanager.NetManager, accounts *accountManager, restored *accountState, messageTemplate *messageTemplate) *tabbedGroupsView {
 	v := &tabbedGroupsView{
 		ctx:           ctx,
 		topics:        tview.NewTable(),
@@ -304,10 +361,27 @@ func newTabbedGroups(ctx context.Context, g *protocoltypes.GroupInfo_Reply, prot
 		contactNames:  map[string]string{},
 		displayName:   displayName,
 		netmanager:    netmanger,
+		accounts:      accounts,
+		restored:      restored,
+
+		spamScorer:      contactspam.NewScorer(contactspam.Config{}),
+		contactRequests: map[string]contactRequestInfo{},
+		messageTemplate: messageTemplate,
+
+		declinedInvitations: map[string]bool{},
+		invitationView:      tview.NewTextView().SetDynamicColors(true).SetWordWrap(true),
+		bookmarksView:       tview.NewTextView().SetDynamicColors(true).SetWordWrap(true),
+	}
+
+	if restored != nil {
+		for groupPK := range restored.declinedInvitations {
+			v.declinedInvitations[groupPK] = true
+		}
 	}
 
 	v.accountGroupView = newViewGroup(v, g.Group, g.MemberPK, g.DevicePK, globalLogger)
 	v.selectedGroupView = v.accountGroupView
+	v.displayedGroupView = v.accountGroupView
 	v.activeViewContainer = tview.NewFlex().
 		SetDirection(tview.FlexRow).
 		AddItem(v.selectedGroupView.View(), 0, 1, false)
@@ -316,6 +390,7 @@ func newTabbedGroups(ctx context.Context, g *protocoltypes.GroupInfo_Reply, prot
 	v.accountGroupView.welcomeEventDisplay()
 
 	v.accountGroupView.loop(ctx)
+	v.restoreGroupState(v.accountGroupView)
 
 	if err := v.handleEventStream(ctx); err != nil {
 		panic(err)
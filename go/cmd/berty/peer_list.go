@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"berty.tech/berty/v2/go/internal/peerlist"
+)
+
+func peerListCommand() *ffcli.Command {
+	var remoteAddr string
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty peer-list", flag.ExitOnError)
+		fs.StringVar(&remoteAddr, "remote", "127.0.0.1:9091", "gRPC address of the running node")
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "peer-list",
+		ShortUsage:     "berty peer-list [flags] [<add|remove> <bootstrap|relay> <multiaddr>]",
+		ShortHelp:      "show or edit the bootstrap peers and the static relays of a running node, the added peers are dialed right away and kept across restarts",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 && len(args) != 3 {
+				return flag.ErrHelp
+			}
+
+			cc, err := grpc.Dial(remoteAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				return err
+			}
+			defer cc.Close()
+
+			var result *peerlist.Result
+			switch {
+			case len(args) == 0:
+				result, err = peerlist.Get(ctx, cc)
+
+			case args[0] == "add" || args[0] == "remove":
+				kind, kindErr := peerlist.ParseKind(args[1])
+				if kindErr != nil {
+					return kindErr
+				}
+
+				if args[0] == "add" {
+					result, err = peerlist.AddPeer(ctx, cc, kind, args[2])
+				} else {
+					result, err = peerlist.RemovePeer(ctx, cc, kind, args[2])
+				}
+
+			default:
+				return flag.ErrHelp
+			}
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case result.Connected:
+				fmt.Printf("connected to %s\n", args[2])
+			case result.DialError != "":
+				fmt.Printf("added %s, but it could not be dialed: %s\n", args[2], result.DialError)
+			}
+
+			for _, addr := range result.Configured.Bootstrap {
+				fmt.Printf("bootstrap  %s (configured)\n", addr)
+			}
+			for _, addr := range result.List.Bootstrap {
+				fmt.Printf("bootstrap  %s\n", addr)
+			}
+			for _, addr := range result.Configured.Relays {
+				fmt.Printf("relay      %s (configured)\n", addr)
+			}
+			for _, addr := range result.List.Relays {
+				fmt.Printf("relay      %s\n", addr)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/sqliteds"
+	"berty.tech/berty/v2/go/pkg/bertyshortlink"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func shortLinkRelayCommand() *ffcli.Command {
+	var (
+		listener  = "127.0.0.1:8088"
+		publicURL string
+		storePath string
+		maxTTL    = bertyshortlink.DefaultMaxTTL
+	)
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty short-link-relay", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		manager.Session.Kind = "cli.short-link-relay"
+		manager.SetupLoggingFlags(fs) // also available at root level
+		fs.StringVar(&listener, "listener", listener, "http listener, usually behind a TLS reverse proxy")
+		fs.StringVar(&publicURL, "public-url", "", "base of the short URLs as reached by the clients, e.g. https://s.example.com, the -node.short-link-relay of the nodes")
+		fs.StringVar(&storePath, "store", "", "sqlite database of the registered links, they are kept in memory if empty")
+		fs.DurationVar(&maxTTL, "max-ttl", maxTTL, "longest time a link is kept")
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "short-link-relay",
+		ShortUsage:     "berty [global flags] short-link-relay [flags]",
+		ShortHelp:      "serve the short URLs of the invitation links registered by the nodes",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				return flag.ErrHelp
+			}
+
+			if publicURL == "" {
+				return errcode.ErrMissingInput.Wrap(fmt.Errorf("-public-url is required"))
+			}
+
+			logger, err := manager.GetLogger()
+			if err != nil {
+				return err
+			}
+
+			var ds datastore.Datastore = dssync.MutexWrap(datastore.NewMapDatastore())
+			if storePath != "" {
+				sqlDS, err := sqliteds.Open(ctx, storePath, sqliteds.Options{})
+				if err != nil {
+					return err
+				}
+				defer sqlDS.Close()
+				ds = sqlDS
+			}
+
+			relay, err := bertyshortlink.NewServer(ds, bertyshortlink.ServerOpts{
+				PublicURL: publicURL,
+				MaxTTL:    maxTTL,
+				Logger:    logger.Named("short-link"),
+			})
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go relay.RunPruner(ctx, time.Hour)
+
+			server := &http.Server{
+				Addr:              listener,
+				Handler:           relay,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			go func() {
+				<-ctx.Done()
+				server.Close()
+			}()
+
+			logger.Info("short link relay listening", zap.String("listener", listener), zap.String("public-url", publicURL))
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/internal/blockscrub"
+	"berty.tech/berty/v2/go/internal/datastoreutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func storeMigrateCommand() *ffcli.Command {
+	var (
+		from, to   string
+		skipVerify bool
+	)
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty store migrate", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		manager.SetupLoggingFlags(fs) // also available at root level
+		manager.SetupDatastoreFlags(fs)
+		fs.StringVar(&from, "from", accountutils.DatastoreBackendSQLite, fmt.Sprintf("backend to read the datastore from, one of %v", accountutils.DatastoreBackends))
+		fs.StringVar(&to, "to", accountutils.DatastoreBackendBadger, fmt.Sprintf("backend to copy the datastore to, one of %v", accountutils.DatastoreBackends))
+		fs.BoolVar(&skipVerify, "skip-verify", false, "do not read the copied entries back")
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "migrate",
+		ShortUsage:     "berty [global flags] store migrate [flags]",
+		ShortHelp:      "copy the root datastore of the account to another backend, the node must be stopped",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				return flag.ErrHelp
+			}
+
+			if from == to {
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the source and destination backends are both %s", from))
+			}
+
+			if manager.Datastore.InMemory {
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("an in memory datastore cannot be migrated"))
+			}
+
+			dir, err := manager.GetSharedDataDir()
+			if err != nil {
+				return err
+			}
+
+			if exists, err := accountutils.HasRootDatastore(dir, from); err != nil {
+				return err
+			} else if !exists {
+				return errcode.ErrNotFound.Wrap(fmt.Errorf("no %s datastore in %s", from, dir))
+			}
+
+			// the copy is verified against the source, not merged into an
+			// existing datastore
+			if exists, err := accountutils.HasRootDatastore(dir, to); err != nil {
+				return err
+			} else if exists {
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a %s datastore already exists in %s, remove it first", to, dir))
+			}
+
+			src, err := manager.OpenRootDatastore(from)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+
+			dst, err := manager.OpenRootDatastore(to)
+			if err != nil {
+				return err
+			}
+			defer dst.Close()
+
+			start := time.Now()
+			copied, err := datastoreutil.Migrate(ctx, src, dst, &datastoreutil.MigrateOpts{
+				SkipVerify: skipVerify,
+				Progress: func(step string, done int) {
+					fmt.Fprintf(os.Stderr, "\r%s: %d entries", step, done)
+				},
+			})
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%d entries migrated from %s to %s in %s\n", copied, from, to, time.Since(start).Round(time.Millisecond))
+			fmt.Printf("start the node with -store.backend=%s to use it, the %s datastore is kept\n", to, from)
+			return nil
+		},
+	}
+}
+
+func storeMigrateLayoutCommand() *ffcli.Command {
+	var to, root string
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty store migrate-layout", flag.ExitOnError)
+		fs.StringVar(&to, "to", accountutils.LayoutXDG, fmt.Sprintf("layout to move the data to, %s or %s", accountutils.LayoutXDG, accountutils.LayoutCustom))
+		fs.StringVar(&root, "root", "", "root directory of the custom layout")
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "migrate-layout",
+		ShortUsage:     "berty store migrate-layout [flags]",
+		ShortHelp:      "move the accounts stored in the legacy config directory to the XDG directories, the node must be stopped",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				return flag.ErrHelp
+			}
+
+			if to == accountutils.LayoutLegacy {
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the data is already stored in the %s layout", to))
+			}
+
+			legacy, err := accountutils.LegacyLayout()
+			if err != nil {
+				return err
+			}
+
+			dst, err := accountutils.ResolveLayout(to, root)
+			if err != nil {
+				return err
+			}
+
+			if err := accountutils.MigrateLegacyLayout(legacy, dst); err != nil {
+				return err
+			}
+
+			fmt.Printf("accounts moved from %s to %s, logs are now stored in %s\n", legacy.DataDir, dst.DataDir, dst.LogsDir())
+			if dst.Name == accountutils.LayoutCustom {
+				fmt.Printf("start the node with -store.dir=%s to use it\n", dst.DataDir)
+			}
+			return nil
+		},
+	}
+}
+
+func storeScrubCommand() *ffcli.Command {
+	var remoteAddr string
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty store scrub", flag.ExitOnError)
+		fs.StringVar(&remoteAddr, "remote", "127.0.0.1:9091", "gRPC address of the running node")
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "scrub",
+		ShortUsage:     "berty store scrub [flags]",
+		ShortHelp:      "verify all the IPFS blocks stored by a running node against their hashes",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				return flag.ErrHelp
+			}
+
+			cc, err := grpc.Dial(remoteAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				return err
+			}
+			defer cc.Close()
+
+			report, err := blockscrub.FullScrub(ctx, cc)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("checked    %d blocks in %s\n", report.Scrub.Checked, report.Scrub.Duration.Round(time.Millisecond))
+			fmt.Printf("corrupted  %d\n", report.Scrub.Corrupted)
+			fmt.Printf("unreadable %d\n", report.Scrub.Unreadable)
+			fmt.Printf("repaired   %d\n", report.Scrub.Repaired)
+			fmt.Printf("since the node started, %d blocks were checked and %d were damaged\n", report.Total.Checked, report.Total.Corrupted+report.Total.Unreadable)
+			for _, c := range report.Damaged {
+				fmt.Printf("damaged    %s\n", c)
+			}
+			return nil
+		},
+	}
+}
+
+func storeCommand() *ffcli.Command {
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty store [command]", flag.ExitOnError)
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "store",
+		ShortUsage:     "berty store [command]",
+		ShortHelp:      "manage the account datastore",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			return flag.ErrHelp
+		},
+		Subcommands: []*ffcli.Command{
+			storeMigrateCommand(),
+			storeMigrateLayoutCommand(),
+			storeScrubCommand(),
+		},
+	}
+}
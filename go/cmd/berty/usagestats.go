@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+
+	"berty.tech/berty/v2/go/internal/usagestats"
+)
+
+func usageStatsCommand() *ffcli.Command {
+	var outputPath string
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty usage-stats", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		manager.SetupLoggingFlags(fs) // also available at root level
+		manager.SetupDatastoreFlags(fs)
+		fs.StringVar(&outputPath, "output", "", "write the report to this path instead of stdout")
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:           "usage-stats",
+		ShortUsage:     "berty [global flags] usage-stats [flags]",
+		ShortHelp:      "export the local usage report collected with -node.usage-stats",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				return flag.ErrHelp
+			}
+
+			rootDS, err := manager.GetRootDatastore()
+			if err != nil {
+				return err
+			}
+
+			report, err := usagestats.Load(ctx, rootDS)
+			if err != nil {
+				return err
+			}
+
+			if outputPath == "" {
+				return report.WriteJSON(os.Stdout)
+			}
+
+			f, err := os.Create(outputPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			return report.WriteJSON(f)
+		},
+	}
+}
@@ -5,20 +5,33 @@ import (
 	"flag"
 	"fmt"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 
+	"berty.tech/berty/v2/go/internal/versionrpc"
 	"berty.tech/berty/v2/go/pkg/bertyversion"
 )
 
 func versionCommand() *ffcli.Command {
+	var remoteAddr string
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty version", flag.ExitOnError)
+		fs.StringVar(&remoteAddr, "remote", "", "also print the version and the features of the daemon listening on this address")
+		return fs, nil
+	}
+
 	return &ffcli.Command{
-		Name:       "version",
-		ShortUsage: "berty version",
-		ShortHelp:  "print software version",
-		Options:    ffSubcommandOptions(),
-		UsageFunc:  usageFunc,
-		Exec: func(_ context.Context, args []string) error {
+		Name:           "version",
+		ShortUsage:     "berty version [flags]",
+		ShortHelp:      "print software version",
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
 			if len(args) > 0 {
 				return flag.ErrHelp
 			}
@@ -27,6 +40,42 @@ func versionCommand() *ffcli.Command {
 				fmt.Printf("vcs      https://github.com/berty/berty/commits/%s\n", bertyversion.VcsRef)
 			}
 			fmt.Printf("go       %s\n", runtime.Version())
+
+			if remoteAddr == "" {
+				return nil
+			}
+
+			cc, err := grpc.Dial(remoteAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				return err
+			}
+			defer cc.Close()
+
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			info, err := versionrpc.Get(ctx, cc)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("\ndaemon   %s\n", info.Version)
+			if info.VcsRef != "n/a" {
+				fmt.Printf("vcs      https://github.com/berty/berty/commits/%s\n", info.VcsRef)
+			}
+			fmt.Printf("go       %s %s/%s\n", info.GoVersion, info.OS, info.Arch)
+			fmt.Printf("features %s\n", strings.Join(info.Features, ", "))
+			fmt.Printf("clients  %s or newer\n", info.MinClientVersion)
+			for i, stage := range info.Startup {
+				label := ""
+				if i == 0 {
+					label = "startup"
+				}
+				fmt.Printf("%-8s %-14s %s\n", label, stage.Name, stage.Duration.Round(time.Millisecond))
+			}
+			if err := versionrpc.Check(info, bertyversion.Version); err != nil {
+				fmt.Printf("warning  %s\n", err)
+			}
 			return nil
 		},
 	}
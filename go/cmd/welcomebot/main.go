@@ -24,6 +24,7 @@ import (
 	"moul.io/u"
 	"moul.io/zapconfig"
 
+	"berty.tech/berty/v2/go/pkg/appmessage"
 	"berty.tech/berty/v2/go/pkg/bertylinks"
 	"berty.tech/berty/v2/go/pkg/bertyversion"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
@@ -573,15 +574,11 @@ Just type 'yes' to let me know you copy that.`
 
 func (bot *Bot) interactUserMessage(ctx context.Context, body string, conversationPK string) error {
 	time.Sleep(3 * time.Second)
-	userMessage, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: body})
+	req, err := appmessage.InteractRequest(conversationPK, appmessage.Text{Body: body})
 	if err != nil {
 		return fmt.Errorf("marshal user message failed: %w", err)
 	}
-	_, err = bot.client.Interact(ctx, &messengertypes.Interact_Request{
-		Type:                  messengertypes.AppMessage_TypeUserMessage,
-		Payload:               userMessage,
-		ConversationPublicKey: conversationPK,
-	})
+	_, err = bot.client.Interact(ctx, req)
 	if err != nil {
 		return fmt.Errorf("interact user message failed: %w", err)
 	}
@@ -204,6 +204,7 @@ func NewBridge(config *BridgeConfig) (*Bridge, error) {
 			BleDriver:             b.bleDriver,
 			NBDriver:              b.nbDriver,
 			Keystore:              config.keystoreDriver,
+			BundleNewAccounts:     config.BundleNewAccounts,
 		}
 
 		var err error
@@ -16,6 +16,7 @@ type BridgeConfig struct {
 	CLIArgs            []string `json:"cliArgs"`
 	AppRootDirPath     string   `json:"appRootDir"`
 	SharedRootDirPath  string   `json:"sharedRootDir"`
+	BundleNewAccounts  bool     `json:"bundleNewAccounts"`
 }
 
 func NewBridgeConfig() *BridgeConfig {
@@ -35,6 +36,7 @@ func (c *BridgeConfig) SetKeystoreDriver(d NativeKeystoreDriver)        { c.keys
 func (c *BridgeConfig) SetConnectivityDriver(d IConnectivityDriver)     { c.connectivityDriver = d }
 func (c *BridgeConfig) SetAppRootDir(rootdir string)                    { c.AppRootDirPath = rootdir }
 func (c *BridgeConfig) SetSharedRootDir(rootdir string)                 { c.SharedRootDirPath = rootdir }
+func (c *BridgeConfig) SetBundleNewAccounts(bundle bool)                { c.BundleNewAccounts = bundle }
 func (c *BridgeConfig) AppendCLIArg(arg string)                         { c.CLIArgs = append(c.CLIArgs, arg) }
 func (c *BridgeConfig) SetPreferredLanguages(preferred string) {
 	c.languages = strings.Split(preferred, ",")
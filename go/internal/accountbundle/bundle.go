@@ -0,0 +1,515 @@
+// Package accountbundle stores the directories of an account in a single
+// encrypted file, to back up or sync an account as one file.
+//
+// A bundle is a tar archive of the directories, encrypted by chunks with
+// AES-GCM. The chunk counter and a final flag are part of the nonce, so a
+// reordered or truncated bundle fails to open. The account metadata is
+// encrypted apart in the header, to list the accounts without unpacking
+// them.
+//
+// The databases need real files: the bundle is unpacked into the account
+// directories while the account is open, and sealed again when it is
+// closed.
+package accountbundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Extension is the file extension of the bundles.
+const Extension = ".bundle"
+
+// UnpackingSuffix is appended to the directories being unpacked, they are
+// renamed once the bundle is verified.
+const UnpackingSuffix = ".unpacking"
+
+const (
+	magic     = "BRTYBDL1"
+	saltSize  = 32
+	keySize   = 32
+	chunkSize = 64 * 1024
+
+	// maxMetadataSize bounds the header, a larger one is a corrupted bundle.
+	maxMetadataSize = 1 << 20
+)
+
+// Dir is a directory stored in a bundle under Name.
+type Dir struct {
+	Name string
+	Path string
+}
+
+// Seal archives dirs into the bundle at bundlePath, encrypted with key,
+// replacing any previous bundle only once the new one is complete.
+func Seal(bundlePath string, key []byte, metadata []byte, dirs []Dir) (err error) {
+	if len(key) == 0 {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("a key is required to seal a bundle"))
+	}
+	if len(metadata) > maxMetadataSize {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("metadata too large: %d bytes", len(metadata)))
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := crand.Read(salt); err != nil {
+		return errcode.ErrCryptoRandomGeneration.Wrap(err)
+	}
+
+	metadataAEAD, archiveAEAD, err := deriveAEADs(key, salt)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := bundlePath + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+
+	sealedMetadata := metadataAEAD.Seal(nil, make([]byte, metadataAEAD.NonceSize()), metadata, []byte(magic))
+	header := make([]byte, 0, len(magic)+saltSize+4)
+	header = append(header, magic...)
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(sealedMetadata)))
+	if _, err := w.Write(header); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+	if _, err := w.Write(sealedMetadata); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	cw := &chunkWriter{w: w, aead: archiveAEAD}
+	tw := tar.NewWriter(cw)
+	for _, dir := range dirs {
+		if err := archiveDir(tw, dir); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+	if err := f.Sync(); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+	if err := f.Close(); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	if err := os.Rename(tmpPath, bundlePath); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	return nil
+}
+
+// ReadMetadata returns the metadata of the bundle at bundlePath without
+// reading the archive.
+func ReadMetadata(bundlePath string, key []byte) ([]byte, error) {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+	defer f.Close()
+
+	metadata, _, err := readHeader(bufio.NewReader(f), key)
+	return metadata, err
+}
+
+// Open unpacks the bundle at bundlePath into dirs, matched by name. The
+// directories must not exist yet, they are only created once the whole
+// bundle is verified.
+func Open(bundlePath string, key []byte, dirs []Dir) (err error) {
+	targets := map[string]string{}
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir.Path); err == nil {
+			return errcode.ErrBertyAccountAlreadyExists.Wrap(fmt.Errorf("%s already exists", dir.Path))
+		} else if !os.IsNotExist(err) {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+		targets[dir.Name] = dir.Path + UnpackingSuffix
+	}
+
+	defer func() {
+		for _, tmpPath := range targets {
+			_ = os.RemoveAll(tmpPath)
+		}
+	}()
+
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	_, archiveAEAD, err := readHeader(r, key)
+	if err != nil {
+		return err
+	}
+
+	for _, tmpPath := range targets {
+		if err := os.RemoveAll(tmpPath); err != nil {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+		if err := os.MkdirAll(tmpPath, 0o700); err != nil {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+	}
+
+	cr := &chunkReader{r: r, aead: archiveAEAD}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errcode.ErrCryptoDecrypt.Wrap(err)
+		}
+
+		if err := extractEntry(tr, hdr, targets); err != nil {
+			return err
+		}
+	}
+
+	// the archive may end before the last chunk, read it to check that the
+	// bundle was not truncated
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return errcode.ErrCryptoDecrypt.Wrap(err)
+	}
+
+	for _, dir := range dirs {
+		if err := os.Rename(targets[dir.Name], dir.Path); err != nil {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func deriveAEADs(key, salt []byte) (metadata cipher.AEAD, archive cipher.AEAD, err error) {
+	newAEAD := func(info string) (cipher.AEAD, error) {
+		derived := make([]byte, keySize)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, []byte(info)), derived); err != nil {
+			return nil, errcode.ErrCryptoKeyDerivation.Wrap(err)
+		}
+
+		block, err := aes.NewCipher(derived)
+		if err != nil {
+			return nil, errcode.ErrCryptoCipherInit.Wrap(err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errcode.ErrCryptoCipherInit.Wrap(err)
+		}
+
+		return aead, nil
+	}
+
+	if metadata, err = newAEAD("berty account bundle metadata"); err != nil {
+		return nil, nil, err
+	}
+	if archive, err = newAEAD("berty account bundle archive"); err != nil {
+		return nil, nil, err
+	}
+
+	return metadata, archive, nil
+}
+
+func readHeader(r io.Reader, key []byte) (metadata []byte, archive cipher.AEAD, err error) {
+	if len(key) == 0 {
+		return nil, nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a key is required to open a bundle"))
+	}
+
+	header := make([]byte, len(magic)+saltSize+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("unable to read bundle header: %w", err))
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("not an account bundle"))
+	}
+
+	salt := header[len(magic) : len(magic)+saltSize]
+	metadataAEAD, archiveAEAD, err := deriveAEADs(key, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[len(magic)+saltSize:])
+	if size > maxMetadataSize+uint32(metadataAEAD.Overhead()) {
+		return nil, nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("invalid metadata size: %d bytes", size))
+	}
+
+	sealedMetadata := make([]byte, size)
+	if _, err := io.ReadFull(r, sealedMetadata); err != nil {
+		return nil, nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("unable to read bundle metadata: %w", err))
+	}
+
+	metadata, err = metadataAEAD.Open(nil, make([]byte, metadataAEAD.NonceSize()), sealedMetadata, []byte(magic))
+	if err != nil {
+		return nil, nil, errcode.ErrCryptoDecrypt.Wrap(fmt.Errorf("unable to decrypt bundle metadata: %w", err))
+	}
+
+	return metadata, archiveAEAD, nil
+}
+
+func archiveDir(tw *tar.Writer, dir Dir) error {
+	err := filepath.WalkDir(dir.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir.Path, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(dir.Name, filepath.ToSlash(rel))
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			if rel == "." {
+				return nil
+			}
+			return tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     name + "/",
+				Mode:     int64(info.Mode().Perm()),
+				ModTime:  info.ModTime(),
+			})
+
+		case info.Mode().IsRegular():
+			if err := tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     name,
+				Mode:     int64(info.Mode().Perm()),
+				Size:     info.Size(),
+				ModTime:  info.ModTime(),
+			}); err != nil {
+				return err
+			}
+
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			_, err = io.CopyN(tw, f, info.Size())
+			return err
+
+		default:
+			// losing a file silently would corrupt the account
+			return fmt.Errorf("unsupported file type for %s: %s", p, info.Mode().Type())
+		}
+	})
+	if err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	return nil
+}
+
+func extractEntry(tr *tar.Reader, hdr *tar.Header, targets map[string]string) error {
+	name := path.Clean(hdr.Name)
+	dirName, rel, _ := strings.Cut(name, "/")
+	root, ok := targets[dirName]
+	if !ok || rel == "" || !fs.ValidPath(rel) {
+		return errcode.ErrDeserialization.Wrap(fmt.Errorf("invalid bundle entry %q", hdr.Name))
+	}
+
+	target := filepath.Join(root, filepath.FromSlash(rel))
+	mode := fs.FileMode(hdr.Mode).Perm() & 0o700
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, mode|0o700); err != nil {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode|0o600)
+		if err != nil {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+
+		if _, err := io.Copy(f, tr); err != nil {
+			_ = f.Close()
+			return errcode.ErrCryptoDecrypt.Wrap(err)
+		}
+
+		if err := f.Close(); err != nil {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+
+	default:
+		return errcode.ErrDeserialization.Wrap(fmt.Errorf("unsupported bundle entry type for %q", hdr.Name))
+	}
+
+	return nil
+}
+
+// chunkNonce numbers the chunks and flags the last one, so chunks cannot be
+// reordered, dropped or truncated without failing the authentication.
+func chunkNonce(size int, counter uint64, last bool) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce, counter)
+	if last {
+		nonce[size-1] = 1
+	}
+	return nonce
+}
+
+// chunkWriter encrypts what is written to it by chunks of chunkSize bytes,
+// each one prefixed with its encrypted size.
+type chunkWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := chunkSize - len(c.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		c.buf = append(c.buf, p[:n]...)
+		p = p[n:]
+		written += n
+
+		// keep a full chunk buffered, it may be the last one
+		if len(c.buf) == chunkSize && len(p) > 0 {
+			if err := c.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (c *chunkWriter) flush(last bool) error {
+	sealed := c.aead.Seal(nil, chunkNonce(c.aead.NonceSize(), c.counter, last), c.buf, nil)
+	c.counter++
+	c.buf = c.buf[:0]
+
+	if err := binary.Write(c.w, binary.BigEndian, uint32(len(sealed))); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+	if _, err := c.w.Write(sealed); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	return nil
+}
+
+// Close writes the last chunk, possibly empty.
+func (c *chunkWriter) Close() error {
+	return c.flush(true)
+}
+
+// chunkReader decrypts the chunks written by a chunkWriter, it fails if the
+// stream ends before the last chunk.
+type chunkReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+	done    bool
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *chunkReader) next() error {
+	var size uint32
+	if err := binary.Read(c.r, binary.BigEndian, &size); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("unable to read chunk: %w", err)
+	}
+	if size > chunkSize+uint32(c.aead.Overhead()) {
+		return fmt.Errorf("invalid chunk size: %d bytes", size)
+	}
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(c.r, sealed); err != nil {
+		return fmt.Errorf("unable to read chunk: %w", err)
+	}
+
+	// a chunk is either the last one or not, try both
+	for _, last := range []bool{false, true} {
+		plain, err := c.aead.Open(nil, chunkNonce(c.aead.NonceSize(), c.counter, last), sealed, nil)
+		if err != nil {
+			continue
+		}
+
+		c.counter++
+		c.buf = plain
+		c.done = last
+		if last {
+			if n, _ := c.r.Read(make([]byte, 1)); n != 0 {
+				return fmt.Errorf("unexpected data after the last chunk")
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unable to decrypt chunk %d", c.counter)
+}
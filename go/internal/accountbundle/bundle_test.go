@@ -0,0 +1,94 @@
+package accountbundle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	root := t.TempDir()
+	key := bytes.Repeat([]byte{42}, 32)
+
+	appDir := filepath.Join(root, "app")
+	sharedDir := filepath.Join(root, "shared")
+	large := bytes.Repeat([]byte("berty"), chunkSize)
+	require.NoError(t, os.MkdirAll(filepath.Join(appDir, "ipfs", "empty"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(appDir, "ipfs", "blocks"), large, 0o600))
+	require.NoError(t, os.MkdirAll(sharedDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(sharedDir, "datastore.sqlite"), []byte("meta"), 0o600))
+
+	dirs := []Dir{{Name: "app", Path: appDir}, {Name: "shared", Path: sharedDir}}
+	bundlePath := filepath.Join(root, "account"+Extension)
+	require.NoError(t, Seal(bundlePath, key, []byte("metadata"), dirs))
+
+	metadata, err := ReadMetadata(bundlePath, key)
+	require.NoError(t, err)
+	require.Equal(t, []byte("metadata"), metadata)
+
+	_, err = ReadMetadata(bundlePath, bytes.Repeat([]byte{1}, 32))
+	require.Error(t, err)
+
+	// the directories must be removed first
+	require.Error(t, Open(bundlePath, key, dirs))
+
+	require.NoError(t, os.RemoveAll(appDir))
+	require.NoError(t, os.RemoveAll(sharedDir))
+	require.NoError(t, Open(bundlePath, key, dirs))
+
+	content, err := os.ReadFile(filepath.Join(appDir, "ipfs", "blocks"))
+	require.NoError(t, err)
+	require.Equal(t, large, content)
+	content, err = os.ReadFile(filepath.Join(sharedDir, "datastore.sqlite"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("meta"), content)
+	info, err := os.Stat(filepath.Join(appDir, "ipfs", "empty"))
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+}
+
+func TestOpenTampered(t *testing.T) {
+	root := t.TempDir()
+	key := bytes.Repeat([]byte{42}, 32)
+
+	dir := filepath.Join(root, "account")
+	require.NoError(t, os.MkdirAll(dir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data"), bytes.Repeat([]byte{7}, chunkSize*3), 0o600))
+
+	dirs := []Dir{{Name: "account", Path: dir}}
+	bundlePath := filepath.Join(root, "account"+Extension)
+	require.NoError(t, Seal(bundlePath, key, nil, dirs))
+	require.NoError(t, os.RemoveAll(dir))
+
+	raw, err := os.ReadFile(bundlePath)
+	require.NoError(t, err)
+
+	// truncated at the start of the last chunk
+	offset := len(magic) + saltSize + 4 + 16
+	lastChunk := offset
+	for offset < len(raw) {
+		lastChunk = offset
+		offset += 4 + int(binary.BigEndian.Uint32(raw[offset:]))
+	}
+	require.NoError(t, os.WriteFile(bundlePath, raw[:lastChunk], 0o600))
+	require.Error(t, Open(bundlePath, key, dirs))
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+
+	// flipped byte
+	tampered := append([]byte(nil), raw...)
+	tampered[len(tampered)-10] ^= 1
+	require.NoError(t, os.WriteFile(bundlePath, tampered, 0o600))
+	require.Error(t, Open(bundlePath, key, dirs))
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(dir + UnpackingSuffix)
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, os.WriteFile(bundlePath, raw, 0o600))
+	require.NoError(t, Open(bundlePath, key, dirs))
+}
@@ -0,0 +1,430 @@
+// Package accountfsck checks the integrity of the data of an account: its
+// metadata, the push key of the device, the SQLite databases, the files left
+// by interrupted operations, the content of its root datastore and its
+// locks. The data is never modified, e.g. a broken messenger db is rebuilt
+// with `berty account rebuild-db`.
+package accountfsck
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/accountbundle"
+	"berty.tech/berty/v2/go/internal/accountlock"
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/pkg/accounttypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Status is the result of a check, the status of a report is the worst of
+// its checks.
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusSkipped Status = "skipped"
+	StatusWarning Status = "warning"
+	StatusError   Status = "error"
+)
+
+// severity orders the statuses, from the best to the worst.
+func (s Status) severity() int {
+	switch s {
+	case StatusOK:
+		return 0
+	case StatusSkipped:
+		return 1
+	case StatusWarning:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// The names of the checks, in the order they are run.
+const (
+	CheckLock          = "lock"
+	CheckMetadata      = "metadata"
+	CheckDatastoreKeys = "datastore-keys"
+	CheckPushKey       = "push-key"
+	CheckMessengerDB   = "messenger-db"
+	CheckRootDatastore = "root-datastore"
+	CheckOrphanFiles   = "orphan-files"
+)
+
+// Check is the result of a single check.
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// LockStatus tells whether the account is open.
+type LockStatus struct {
+	// Holder is the process which opened the account, it is nil if none.
+	Holder *accountlock.Holder `json:"holder,omitempty"`
+	// StoreLocked is true when a running node holds the store directory.
+	StoreLocked bool `json:"store_locked"`
+}
+
+// Report is the result of the checks of an account, it is meant to be
+// printed as JSON for the scripts.
+type Report struct {
+	AccountID string  `json:"account_id"`
+	Dir       string  `json:"dir"`
+	Status    Status  `json:"status"`
+	Checks    []Check `json:"checks"`
+	// OrphanFiles are the files left by interrupted operations, they can be
+	// removed once the account is closed.
+	OrphanFiles []string `json:"orphan_files"`
+	// DatastoreKeys counts the keys of the root datastore by top-level
+	// namespace.
+	DatastoreKeys map[string]int `json:"datastore_keys"`
+	Lock          LockStatus     `json:"lock"`
+}
+
+func (r *Report) add(name string, status Status, detail string) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: status, Detail: detail})
+	if status.severity() > r.Status.severity() {
+		r.Status = status
+	}
+}
+
+// Get returns the check named name, or nil if it was not run.
+func (r *Report) Get(name string) *Check {
+	for i := range r.Checks {
+		if r.Checks[i].Name == name {
+			return &r.Checks[i]
+		}
+	}
+	return nil
+}
+
+// Options are the account to check and the secrets of its storage, the
+// keys and salts are nil when the account is not encrypted.
+type Options struct {
+	AccountID string
+	// Dir is the directory of the account.
+	Dir string
+	// PushKeyPath is the push key of the device, the check is skipped when
+	// it is empty.
+	PushKeyPath       string
+	StorageKey        []byte
+	RootDatastoreSalt []byte
+	MessengerDBSalt   []byte
+	Logger            *zap.Logger
+}
+
+// Run checks the account described by opts. It only fails when the account
+// can't be checked at all, the failed checks are reported. The account may
+// be open while it is checked, the report then tells which process holds
+// it and the databases are read as they were last committed.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+
+	switch info, err := os.Stat(opts.Dir); {
+	case opts.Dir == "" || opts.Dir == accountutils.InMemoryDir:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("only the accounts stored on disk can be checked"))
+	case os.IsNotExist(err):
+		return nil, errcode.ErrBertyAccountDataNotFound
+	case err != nil:
+		return nil, errcode.ErrBertyAccountFSError.Wrap(err)
+	case !info.IsDir():
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("%s is not an account directory", opts.Dir))
+	}
+
+	r := &Report{
+		AccountID:     opts.AccountID,
+		Dir:           opts.Dir,
+		Status:        StatusOK,
+		OrphanFiles:   []string{},
+		DatastoreKeys: map[string]int{},
+	}
+
+	checkLock(r, opts)
+
+	backend, err := rootDatastoreBackend(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	checkRootDatastoreContent(ctx, r, opts, backend)
+
+	checkPushKey(r, opts)
+	checkDatabase(r, CheckMessengerDB, filepath.Join(opts.Dir, accountutils.MessengerDatabaseFilename), opts.StorageKey, opts.MessengerDBSalt, opts.Logger)
+	checkRootDatastoreDB(r, opts, backend)
+	checkOrphanFiles(r, opts)
+
+	return r, nil
+}
+
+func checkLock(r *Report, opts Options) {
+	holder, err := accountlock.ReadHolder(opts.Dir)
+	if err != nil {
+		r.add(CheckLock, StatusError, err.Error())
+		return
+	}
+	r.Lock.Holder = holder
+
+	if r.Lock.StoreLocked, err = accountlock.IsDirLocked(opts.Dir); err != nil {
+		r.add(CheckLock, StatusError, err.Error())
+		return
+	}
+
+	switch {
+	case holder != nil:
+		r.add(CheckLock, StatusWarning, fmt.Sprintf("the account is open by %s", holder))
+	case r.Lock.StoreLocked:
+		r.add(CheckLock, StatusWarning, "the store directory is used by a running node")
+	default:
+		r.add(CheckLock, StatusOK, "the account is closed")
+	}
+}
+
+// rootDatastoreBackend returns the backend of the root datastore of the
+// account, or an empty string if it has none.
+func rootDatastoreBackend(dir string) (string, error) {
+	for _, backend := range accountutils.DatastoreBackends {
+		exists, err := accountutils.HasRootDatastore(dir, backend)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return backend, nil
+		}
+	}
+
+	return "", nil
+}
+
+// checkRootDatastoreContent parses the metadata of the account and counts
+// the keys of its root datastore.
+func checkRootDatastoreContent(ctx context.Context, r *Report, opts Options, backend string) {
+	if backend == "" {
+		r.add(CheckMetadata, StatusError, "the account has no root datastore")
+		r.add(CheckDatastoreKeys, StatusSkipped, "the account has no root datastore")
+		return
+	}
+
+	ds, err := accountutils.GetRootDatastoreForBackend(opts.Dir, backend, opts.StorageKey, opts.RootDatastoreSalt, opts.Logger)
+	if err != nil {
+		r.add(CheckMetadata, StatusError, fmt.Sprintf("unable to open the root datastore: %s", err))
+		r.add(CheckDatastoreKeys, StatusSkipped, "the root datastore can't be opened")
+		return
+	}
+	defer ds.Close()
+
+	checkMetadata(ctx, r, ds)
+
+	counts, err := countKeys(ctx, ds)
+	if err != nil {
+		r.add(CheckDatastoreKeys, StatusError, err.Error())
+		return
+	}
+
+	total := 0
+	for namespace, count := range counts {
+		r.DatastoreKeys[namespace] = count
+		total += count
+	}
+	r.add(CheckDatastoreKeys, StatusOK, fmt.Sprintf("%d keys in %d namespaces, %s backend", total, len(counts), backend))
+}
+
+func checkMetadata(ctx context.Context, r *Report, ds datastore.Datastore) {
+	raw, err := ds.Get(ctx, datastore.NewKey(accountutils.AccountMetafileName))
+	switch {
+	case err == datastore.ErrNotFound:
+		r.add(CheckMetadata, StatusError, "the account has no metadata")
+		return
+	case err != nil:
+		r.add(CheckMetadata, StatusError, fmt.Sprintf("unable to read the metadata: %s", err))
+		return
+	}
+
+	meta := &accounttypes.AccountMetadata{}
+	if err := proto.Unmarshal(raw, meta); err != nil {
+		r.add(CheckMetadata, StatusError, fmt.Sprintf("unable to parse the metadata: %s", err))
+		return
+	}
+
+	r.add(CheckMetadata, StatusOK, fmt.Sprintf("%d bytes, account %q", len(raw), meta.GetName()))
+}
+
+// countKeys counts the keys of ds by top-level namespace, the keys at the
+// root are counted under their own name.
+func countKeys(ctx context.Context, ds datastore.Datastore) (map[string]int, error) {
+	res, err := ds.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	defer res.Close()
+
+	counts := map[string]int{}
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return nil, errcode.ErrDBRead.Wrap(entry.Error)
+		}
+
+		if namespaces := datastore.RawKey(entry.Key).List(); len(namespaces) > 0 {
+			counts["/"+namespaces[0]]++
+		}
+	}
+
+	return counts, nil
+}
+
+func checkPushKey(r *Report, opts Options) {
+	if opts.PushKeyPath == "" {
+		r.add(CheckPushKey, StatusSkipped, "no push key path")
+		return
+	}
+
+	key, err := accountutils.NewFilePushKeystore(opts.PushKeyPath).GetPushKey()
+	switch {
+	case errcode.Is(err, errcode.ErrNotFound):
+		r.add(CheckPushKey, StatusWarning, "no push key, it is created when the push notifications are enabled")
+	case err != nil:
+		r.add(CheckPushKey, StatusError, err.Error())
+	default:
+		r.add(CheckPushKey, StatusOK, fmt.Sprintf("%d+%d bytes, version %d", len(key.PublicKey), len(key.SecretKey), key.Version))
+	}
+}
+
+func checkRootDatastoreDB(r *Report, opts Options, backend string) {
+	switch {
+	case backend == "":
+		r.add(CheckRootDatastore, StatusError, "the account has no root datastore")
+		return
+	case backend != accountutils.DatastoreBackendSQLite:
+		r.add(CheckRootDatastore, StatusSkipped, fmt.Sprintf("the %s backend is not a SQLite db", backend))
+		return
+	}
+
+	checkDatabase(r, CheckRootDatastore, filepath.Join(opts.Dir, accountutils.RootDatastoreFilename), opts.StorageKey, opts.RootDatastoreSalt, opts.Logger)
+}
+
+// maxIntegrityErrors is the number of problems of a db listed in a report,
+// integrity_check lists up to 100 of them.
+const maxIntegrityErrors = 5
+
+// checkDatabase runs the SQLite integrity check of the db at dbPath, in
+// read-only mode.
+func checkDatabase(r *Report, name string, dbPath string, key []byte, salt []byte, logger *zap.Logger) {
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		r.add(name, StatusError, fmt.Sprintf("%s is missing", filepath.Base(dbPath)))
+		return
+	} else if err != nil {
+		r.add(name, StatusError, err.Error())
+		return
+	}
+
+	problems, err := integrityCheck(dbPath, key, salt, logger)
+	switch {
+	case err != nil:
+		r.add(name, StatusError, err.Error())
+	case len(problems) == 1 && problems[0] == "ok":
+		r.add(name, StatusOK, "integrity check passed")
+	default:
+		listed := problems
+		if len(listed) > maxIntegrityErrors {
+			listed = listed[:maxIntegrityErrors]
+		}
+		r.add(name, StatusError, fmt.Sprintf("%d integrity problems: %s", len(problems), strings.Join(listed, "; ")))
+	}
+}
+
+func integrityCheck(dbPath string, key []byte, salt []byte, logger *zap.Logger) ([]string, error) {
+	db, cleanup, err := accountutils.GetGormDBForPathReadOnly(dbPath, key, salt, logger)
+	if err != nil {
+		return nil, errcode.ErrDBOpen.Wrap(err)
+	}
+	defer cleanup()
+
+	rows, err := db.Raw("PRAGMA integrity_check").Rows()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	defer rows.Close()
+
+	problems := []string{}
+	for rows.Next() {
+		var problem string
+		if err := rows.Scan(&problem); err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+		problems = append(problems, problem)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return problems, nil
+}
+
+// sqliteSidecarSuffixes are the files SQLite keeps next to a db.
+var sqliteSidecarSuffixes = []string{"-wal", "-shm", "-journal"}
+
+// leftoverSuffixes are the files left by interrupted operations: the
+// rebuild of the messenger db and the files written aside.
+var leftoverSuffixes = []string{accountutils.MessengerDBBackupSuffix, ".tmp"}
+
+// checkOrphanFiles lists the files of the account left by interrupted
+// operations: the SQLite files without their db, the backups of a rebuild
+// and the unpacking directory of a bundle. The other files are unknown to
+// this version rather than orphans, they are left out.
+func checkOrphanFiles(r *Report, opts Options) {
+	entries, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		r.add(CheckOrphanFiles, StatusError, errcode.ErrBertyAccountFSError.Wrap(err).Error())
+		return
+	}
+
+	names := map[string]bool{}
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		orphan := false
+		for _, suffix := range leftoverSuffixes {
+			orphan = orphan || strings.HasSuffix(name, suffix)
+		}
+		for _, suffix := range sqliteSidecarSuffixes {
+			if db := strings.TrimSuffix(name, suffix); db != name && !names[db] {
+				orphan = true
+			}
+		}
+
+		if orphan {
+			r.OrphanFiles = append(r.OrphanFiles, filepath.Join(opts.Dir, name))
+		}
+	}
+
+	if unpacking := filepath.Clean(opts.Dir) + accountbundle.UnpackingSuffix; pathExists(unpacking) {
+		r.OrphanFiles = append(r.OrphanFiles, unpacking)
+	}
+
+	sort.Strings(r.OrphanFiles)
+	if len(r.OrphanFiles) > 0 {
+		r.add(CheckOrphanFiles, StatusWarning, fmt.Sprintf("%d files left by interrupted operations", len(r.OrphanFiles)))
+		return
+	}
+
+	r.add(CheckOrphanFiles, StatusOK, "no orphan file")
+}
+
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,96 @@
+package accountfsck
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/accountlock"
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/pkg/accounttypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func createAccount(t *testing.T, ctx context.Context, dir string) {
+	t.Helper()
+
+	ds, err := accountutils.GetRootDatastoreForPath(dir, nil, nil, zap.NewNop())
+	require.NoError(t, err)
+	meta, err := proto.Marshal(&accounttypes.AccountMetadata{Name: "alice"})
+	require.NoError(t, err)
+	require.NoError(t, ds.Put(ctx, datastore.NewKey(accountutils.AccountMetafileName), meta))
+	require.NoError(t, ds.Put(ctx, datastore.NewKey("/ipfs/a"), []byte("a")))
+	require.NoError(t, ds.Put(ctx, datastore.NewKey("/ipfs/b"), []byte("b")))
+	require.NoError(t, ds.Close())
+
+	db, cleanup, err := accountutils.GetMessengerDBForPath(dir, nil, nil, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("CREATE TABLE interactions (cid TEXT)").Error)
+	cleanup()
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	dir := filepath.Join(root, "0")
+	pushKeyPath := filepath.Join(root, accountutils.DefaultPushKeyFilename)
+
+	_, err := Run(ctx, Options{Dir: dir})
+	require.True(t, errcode.Is(err, errcode.ErrBertyAccountDataNotFound))
+
+	createAccount(t, ctx, dir)
+	_, _, err = accountutils.GetDevicePushKeyForPath(pushKeyPath, true)
+	require.NoError(t, err)
+
+	r, err := Run(ctx, Options{AccountID: "0", Dir: dir, PushKeyPath: pushKeyPath})
+	require.NoError(t, err)
+	require.Equal(t, StatusOK, r.Status, "%+v", r.Checks)
+	for _, name := range []string{CheckLock, CheckMetadata, CheckDatastoreKeys, CheckPushKey, CheckMessengerDB, CheckRootDatastore, CheckOrphanFiles} {
+		require.NotNil(t, r.Get(name), name)
+	}
+	require.Contains(t, r.Get(CheckMetadata).Detail, "alice")
+	require.Equal(t, 2, r.DatastoreKeys["/ipfs"])
+	require.Equal(t, 1, r.DatastoreKeys["/"+accountutils.AccountMetafileName])
+	require.Empty(t, r.OrphanFiles)
+
+	// the leftovers of interrupted operations
+	backup := filepath.Join(dir, accountutils.MessengerDatabaseFilename+accountutils.MessengerDBBackupSuffix)
+	wal := filepath.Join(dir, "ipfs.sqlite-wal")
+	require.NoError(t, os.WriteFile(backup, nil, 0o600))
+	require.NoError(t, os.WriteFile(wal, nil, 0o600))
+
+	// a truncated push key and an open account
+	require.NoError(t, os.WriteFile(pushKeyPath, []byte("short"), 0o600))
+	lock, err := accountlock.LockDir(dir)
+	require.NoError(t, err)
+	defer lock.Unlock()
+
+	r, err = Run(ctx, Options{AccountID: "0", Dir: dir, PushKeyPath: pushKeyPath})
+	require.NoError(t, err)
+	require.Equal(t, StatusError, r.Status)
+	require.Equal(t, StatusError, r.Get(CheckPushKey).Status)
+	require.Equal(t, StatusWarning, r.Get(CheckLock).Status)
+	require.True(t, r.Lock.StoreLocked)
+	require.Equal(t, []string{backup, wal}, r.OrphanFiles)
+	require.Equal(t, StatusOK, r.Get(CheckMessengerDB).Status)
+}
+
+func TestRunMissingDatabases(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	r, err := Run(ctx, Options{Dir: dir})
+	require.NoError(t, err)
+	require.Equal(t, StatusError, r.Status)
+	require.Equal(t, StatusError, r.Get(CheckMetadata).Status)
+	require.Equal(t, StatusSkipped, r.Get(CheckDatastoreKeys).Status)
+	require.Equal(t, StatusSkipped, r.Get(CheckPushKey).Status)
+	require.Equal(t, StatusError, r.Get(CheckMessengerDB).Status)
+	require.Equal(t, StatusError, r.Get(CheckRootDatastore).Status)
+}
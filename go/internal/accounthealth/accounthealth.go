@@ -0,0 +1,143 @@
+// Package accounthealth keeps why an account last failed to be listed or
+// opened, in a file next to the account data rather than in it, as the data
+// itself can be the cause. The record is removed by the next successful
+// opening of the account.
+package accounthealth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/accounttypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Extension is appended to the directory of an account to name its record.
+const Extension = ".last-error.json"
+
+// The stages an account fails at. The opening also fails at the steps of its
+// progress, e.g. "migrate", and at the stages of initutil.InitConcurrently,
+// which have the same names as the ones below.
+const (
+	// StageKeystore is the read of the storage key of the account.
+	StageKeystore = "keystore"
+	// StageMetadata is the read of the metadata listed for the account.
+	StageMetadata = "metadata"
+	// StageLock is the lock preventing two processes from opening the
+	// account.
+	StageLock = "lock"
+	// StageUnseal is the unpacking of a bundled account.
+	StageUnseal = "unseal"
+	// StageMigrate is the migration of the account data to the current
+	// version.
+	StageMigrate = "migrate"
+
+	StageRootDatastore = "root-datastore"
+	StageIPFS          = "ipfs"
+	StageOrbitDB       = "orbitdb"
+	StageMessengerDB   = "messenger-db"
+)
+
+// Record is the last error of an account.
+type Record struct {
+	Stage    string          `json:"stage"`
+	Code     errcode.ErrCode `json:"code"`
+	CodeName string          `json:"code_name,omitempty"`
+	Error    string          `json:"error"`
+	At       time.Time       `json:"at"`
+	// Failures counts the consecutive failures at the same stage.
+	Failures int `json:"failures"`
+}
+
+// ToProto returns r as listed by the account services, it is nil if r is nil.
+func (r *Record) ToProto() *accounttypes.AccountFailure {
+	if r == nil {
+		return nil
+	}
+
+	return &accounttypes.AccountFailure{
+		Stage:    r.Stage,
+		Code:     int32(r.Code),
+		CodeName: r.CodeName,
+		Error:    r.Error,
+		At:       r.At.UnixMilli(),
+		Failures: int64(r.Failures),
+	}
+}
+
+// RecordFromProto returns the record of failure, it is nil if failure is nil.
+func RecordFromProto(failure *accounttypes.AccountFailure) *Record {
+	if failure == nil {
+		return nil
+	}
+
+	return &Record{
+		Stage:    failure.Stage,
+		Code:     errcode.ErrCode(failure.Code),
+		CodeName: failure.CodeName,
+		Error:    failure.Error,
+		At:       time.UnixMilli(failure.At),
+		Failures: int(failure.Failures),
+	}
+}
+
+// Load returns the record stored at path, or nil if the account has none.
+func Load(path string) (*Record, error) {
+	raw, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	r := &Record{}
+	if err := json.Unmarshal(raw, r); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("invalid account error record: %w", err))
+	}
+
+	return r, nil
+}
+
+// Save stores the failure of an account at stage, it returns the new record.
+func Save(path string, stage string, failure error, now time.Time) (*Record, error) {
+	// an unreadable record is replaced
+	previous, _ := Load(path)
+
+	code := errcode.Code(failure)
+	r := &Record{
+		Stage:    stage,
+		Code:     code,
+		Error:    failure.Error(),
+		At:       now.UTC(),
+		Failures: 1,
+	}
+	if code != -1 {
+		r.CodeName = code.String()
+	}
+	if previous != nil && previous.Stage == stage {
+		r.Failures = previous.Failures + 1
+	}
+
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		return nil, errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	return r, nil
+}
+
+// Clear removes the record stored at path, if any.
+func Clear(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	return nil
+}
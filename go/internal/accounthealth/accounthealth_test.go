@@ -0,0 +1,125 @@
+package accounthealth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestSaveLoadClear(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0"+Extension)
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	r, err := Load(path)
+	require.NoError(t, err)
+	require.Nil(t, r)
+
+	_, err = Save(path, StageMessengerDB, errcode.ErrDBOpen.Wrap(fmt.Errorf("database disk image is malformed")), now)
+	require.NoError(t, err)
+
+	r, err = Load(path)
+	require.NoError(t, err)
+	require.Equal(t, StageMessengerDB, r.Stage)
+	require.Equal(t, errcode.ErrDBOpen, r.Code)
+	require.Equal(t, errcode.ErrDBOpen.String(), r.CodeName)
+	require.Contains(t, r.Error, "malformed")
+	require.True(t, now.Equal(r.At))
+	require.Equal(t, 1, r.Failures)
+
+	// the failures are counted per stage
+	r, err = Save(path, StageMessengerDB, fmt.Errorf("still malformed"), now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 2, r.Failures)
+	require.Equal(t, errcode.ErrCode(-1), r.Code)
+	require.Empty(t, r.CodeName)
+
+	r, err = Save(path, StageLock, errcode.ErrBertyAccountAlreadyOpened, now)
+	require.NoError(t, err)
+	require.Equal(t, 1, r.Failures)
+
+	require.NoError(t, Clear(path))
+	r, err = Load(path)
+	require.NoError(t, err)
+	require.Nil(t, r)
+
+	// clearing twice is fine
+	require.NoError(t, Clear(path))
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = Load(path)
+	require.True(t, errcode.Is(err, errcode.ErrDeserialization))
+}
+
+func TestRemediations(t *testing.T) {
+	require.Nil(t, Remediations(nil))
+
+	actions := func(r *Record) []string {
+		names := []string{}
+		for _, remediation := range Remediations(r) {
+			names = append(names, remediation.Action)
+		}
+		return names
+	}
+
+	require.Equal(t, []string{ActionRetry, ActionCloseOtherInstance, ActionReport}, actions(&Record{Stage: StageLock, Failures: 1}))
+	require.Equal(t, []string{ActionRebuildMessengerDB, ActionReport}, actions(&Record{Stage: StageMessengerDB, Failures: 3}))
+	require.Equal(t, []string{ActionUpdateApp, ActionReport}, actions(&Record{Stage: StageMigrate, Failures: 2}))
+	require.Equal(t, []string{ActionRestoreBackup, ActionReport}, actions(&Record{Stage: StageKeystore, Failures: 2}))
+	require.Equal(t, []string{ActionCheckStorage, ActionReport}, actions(&Record{Stage: StageMessengerDB, Error: "write: no space left on device", Failures: 2}))
+	require.Equal(t, []string{ActionRetry, ActionReport}, actions(&Record{Stage: StageIPFS, Failures: 1}))
+}
+
+type testReporter map[string]*Record
+
+func (r testReporter) AccountHealth(_ context.Context, accountID string) (*Health, error) {
+	if accountID == "unknown" {
+		return nil, errcode.ErrBertyAccountDataNotFound
+	}
+	return &Health{AccountID: accountID, LastError: r[accountID], Remediations: Remediations(r[accountID])}, nil
+}
+
+func TestRPC(t *testing.T) {
+	ctx := context.Background()
+
+	l := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	Register(server, testReporter{"1": {Stage: StageMessengerDB, Code: errcode.ErrDBOpen, Failures: 2}})
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.Dial("buf",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	health, err := Get(ctx, cc, "0")
+	require.NoError(t, err)
+	require.Equal(t, "0", health.AccountID)
+	require.Nil(t, health.LastError)
+	require.Empty(t, health.Remediations)
+
+	health, err = Get(ctx, cc, "1")
+	require.NoError(t, err)
+	require.Equal(t, StageMessengerDB, health.LastError.Stage)
+	require.Equal(t, errcode.ErrDBOpen, health.LastError.Code)
+	require.Equal(t, ActionRebuildMessengerDB, health.Remediations[0].Action)
+
+	_, err = Get(ctx, cc, "unknown")
+	require.Error(t, err)
+
+	_, err = Get(ctx, cc, "")
+	require.Error(t, err)
+}
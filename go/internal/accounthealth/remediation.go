@@ -0,0 +1,81 @@
+package accounthealth
+
+import (
+	"strings"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// The actions of the remediations, the clients map them to a button or a
+// command.
+const (
+	// ActionRetry is opening the account again, the failure may be transient.
+	ActionRetry = "retry"
+	// ActionCloseOtherInstance is closing the other process using the
+	// account.
+	ActionCloseOtherInstance = "close-other-instance"
+	// ActionRebuildMessengerDB is the RebuildMessengerDB RPC, the messenger
+	// database is rebuilt from the protocol data.
+	ActionRebuildMessengerDB = "rebuild-messenger-db"
+	// ActionUpdateApp is installing a version able to migrate the account.
+	ActionUpdateApp = "update-app"
+	// ActionCheckStorage is checking the permissions and the free space of
+	// the storage.
+	ActionCheckStorage = "check-storage"
+	// ActionRestoreBackup is importing a backup or an export of the account.
+	ActionRestoreBackup = "restore-backup"
+	// ActionReport is reporting the issue with the logs.
+	ActionReport = "report"
+)
+
+// Remediation is an action which may fix an account.
+type Remediation struct {
+	Action      string
+	Description string
+}
+
+// Remediations returns the actions which may fix the account failing with r,
+// the most likely first. It returns nil if r is nil.
+func Remediations(r *Record) []Remediation {
+	if r == nil {
+		return nil
+	}
+
+	remediations := []Remediation{}
+	add := func(action, description string) {
+		remediations = append(remediations, Remediation{Action: action, Description: description})
+	}
+
+	switch {
+	case r.Stage == StageLock:
+		add(ActionCloseOtherInstance, "the account is used by another process, close it and retry")
+	case r.Code == errcode.ErrBertyAccountFSError || isStorageError(r.Error):
+		add(ActionCheckStorage, "the account files can't be written, check the permissions and the free space of the storage")
+	case r.Stage == StageMigrate:
+		add(ActionUpdateApp, "the account data can't be migrated, update the app and retry")
+	case r.Stage == StageMessengerDB:
+		add(ActionRebuildMessengerDB, "the messenger database is broken, rebuild it from the protocol data")
+	case r.Stage == StageKeystore, r.Stage == StageMetadata, r.Stage == StageUnseal,
+		r.Code == errcode.ErrCryptoDecrypt, r.Code == errcode.ErrDeserialization:
+		add(ActionRestoreBackup, "the account data is unreadable, import a backup or an export of the account")
+	}
+
+	// a failure seen once may be transient
+	if r.Failures < 2 {
+		remediations = append([]Remediation{{Action: ActionRetry, Description: "open the account again"}}, remediations...)
+	}
+
+	add(ActionReport, "report the issue with the logs of the failed opening")
+
+	return remediations
+}
+
+func isStorageError(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, hint := range []string{"no space left", "permission denied", "read-only file system", "disk full"} {
+		if strings.Contains(msg, hint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package accounthealth
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"berty.tech/berty/v2/go/pkg/accounttypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Health is the last error of an account and how to fix it, LastError is nil
+// if the last opening of the account succeeded.
+type Health struct {
+	AccountID    string
+	LastError    *Record
+	Remediations []Remediation
+}
+
+// Reporter is implemented by the account service.
+type Reporter interface {
+	AccountHealth(ctx context.Context, accountID string) (*Health, error)
+}
+
+// Get returns the health of accountID from the account service served by cc.
+func Get(ctx context.Context, cc grpc.ClientConnInterface, accountID string) (*Health, error) {
+	reply, err := accounttypes.NewAccountHealthServiceClient(cc).AccountHealth(ctx, &accounttypes.AccountHealth_Request{AccountID: accountID})
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("the daemon has no account health service: %w", err))
+		}
+		return nil, err
+	}
+
+	health := &Health{
+		AccountID: reply.AccountID,
+		LastError: RecordFromProto(reply.LastError),
+	}
+	for _, remediation := range reply.Remediations {
+		health.Remediations = append(health.Remediations, Remediation{Action: remediation.Action, Description: remediation.Description})
+	}
+
+	return health, nil
+}
+
+// Register adds the health service of r to server.
+func Register(server *grpc.Server, r Reporter) {
+	accounttypes.RegisterAccountHealthServiceServer(server, &healthServer{reporter: r})
+}
+
+type healthServer struct {
+	accounttypes.UnimplementedAccountHealthServiceServer
+
+	reporter Reporter
+}
+
+func (s *healthServer) AccountHealth(ctx context.Context, req *accounttypes.AccountHealth_Request) (*accounttypes.AccountHealth_Reply, error) {
+	if req.AccountID == "" {
+		return nil, errcode.ErrBertyAccountNoIDSpecified
+	}
+
+	health, err := s.reporter.AccountHealth(ctx, req.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &accounttypes.AccountHealth_Reply{
+		AccountID: health.AccountID,
+		LastError: health.LastError.ToProto(),
+	}
+	for _, remediation := range health.Remediations {
+		reply.Remediations = append(reply.Remediations, &accounttypes.AccountRemediation{Action: remediation.Action, Description: remediation.Description})
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,137 @@
+// Package accountlock prevents several processes from opening the same
+// account. The account service opening an account holds a flock on a lock
+// file next to its directory until the account is closed, the system releases
+// it when the process exits so it can't be left stale. Independently of it, a
+// running node holds a flock on its store directory, see LockDir.
+package accountlock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofrs/flock"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Extension is appended to the account directory to get its lock file.
+const Extension = ".lock"
+
+// Holder describes the process holding a lock. It is written in the lock
+// file for the errors and the account listings only, the lock itself is the
+// flock.
+type Holder struct {
+	PID      int       `json:"pid,omitempty"`
+	Hostname string    `json:"hostname,omitempty"`
+	Since    time.Time `json:"since,omitempty"`
+}
+
+func (h *Holder) String() string {
+	if h.PID == 0 {
+		return "another process"
+	}
+
+	return fmt.Sprintf("process %d on %s since %s", h.PID, h.Hostname, h.Since.Local().Format(time.RFC3339))
+}
+
+// Lock is held by the process until Release is called.
+type Lock struct {
+	flock *flock.Flock
+}
+
+// Path returns the path of the lock file of the account directory dir.
+func Path(dir string) string {
+	return filepath.Clean(dir) + Extension
+}
+
+// Acquire locks the account directory dir. It fails with
+// ErrBertyAccountAlreadyOpened when another process holds the lock.
+func Acquire(dir string) (*Lock, error) {
+	path := Path(dir)
+
+	l := flock.New(path)
+	locked, err := l.TryLock()
+	if err != nil {
+		return nil, errcode.ErrBertyAccountFSError.Wrap(fmt.Errorf("unable to lock %s: %w", dir, err))
+	}
+	if !locked {
+		return nil, errcode.ErrBertyAccountAlreadyOpened.Wrap(fmt.Errorf("account locked by %s, see %s", readHolder(path), path))
+	}
+
+	// as for LockDir, the holder is only written for the errors, a locked
+	// file can't be written on windows
+	hostname, _ := os.Hostname()
+	if raw, err := json.Marshal(&Holder{PID: os.Getpid(), Hostname: hostname, Since: time.Now()}); err == nil {
+		_ = os.WriteFile(path, raw, 0o600)
+	}
+
+	return &Lock{flock: l}, nil
+}
+
+// ReadHolder returns the process holding the lock of the account directory
+// dir, it is nil if the account is not locked.
+func ReadHolder(dir string) (*Holder, error) {
+	path := Path(dir)
+
+	locked, err := isLocked(path)
+	if err != nil || !locked {
+		return nil, err
+	}
+
+	return readHolder(path), nil
+}
+
+// readHolder returns the holder written in the lock file at path, it is
+// empty when the file can't be read.
+func readHolder(path string) *Holder {
+	holder := &Holder{}
+	if raw, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(raw, holder)
+	}
+
+	return holder
+}
+
+// isLocked returns true if a process holds the flock of the file at path. A
+// shared lock is taken for the time of the check, it only conflicts with a
+// concurrent locking.
+func isLocked(path string) (bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	l := flock.New(path)
+	locked, err := l.TryRLock()
+	if err != nil {
+		return false, errcode.ErrBertyAccountFSError.Wrap(fmt.Errorf("unable to check the lock %s: %w", path, err))
+	}
+	if !locked {
+		return true, nil
+	}
+
+	if err := l.Unlock(); err != nil {
+		return false, errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	return false, nil
+}
+
+// Release releases the lock. The file is left next to the account
+// directory, removing it would let another process lock a new file while a
+// third one still holds the removed one.
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+
+	if err := l.flock.Unlock(); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	return nil
+}
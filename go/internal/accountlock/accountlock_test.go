@@ -0,0 +1,138 @@
+package accountlock
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestAcquire(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "account")
+
+	lock, err := Acquire(dir)
+	require.NoError(t, err)
+
+	holder, err := ReadHolder(dir)
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	require.Equal(t, os.Getpid(), holder.PID)
+
+	// flock is held per open file, this process can't lock it twice
+	_, err = Acquire(dir)
+	require.True(t, errcode.Is(err, errcode.ErrBertyAccountAlreadyOpened))
+	require.Contains(t, err.Error(), fmt.Sprintf("process %d", os.Getpid()))
+
+	require.NoError(t, lock.Release())
+
+	holder, err = ReadHolder(dir)
+	require.NoError(t, err)
+	require.Nil(t, holder)
+
+	lock, err = Acquire(dir)
+	require.NoError(t, err)
+	require.NoError(t, lock.Release())
+}
+
+func TestAcquireLeftFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "account")
+
+	// the content of a lock file is not checked, only its flock
+	for name, content := range map[string]string{
+		"corrupted": "{",
+		"holder":    mustMarshal(t, &Holder{PID: 1, Hostname: "other", Since: time.Now()}),
+	} {
+		require.NoError(t, os.WriteFile(Path(dir), []byte(content), 0o600))
+
+		holder, err := ReadHolder(dir)
+		require.NoError(t, err)
+		require.Nil(t, holder, name)
+
+		lock, err := Acquire(dir)
+		require.NoError(t, err, name)
+		require.NoError(t, lock.Release())
+	}
+}
+
+// TestAcquireOtherProcess locks an account from a child process, the lock is
+// released by the system when it is killed.
+func TestAcquireOtherProcess(t *testing.T) {
+	if dir := os.Getenv("ACCOUNTLOCK_TEST_DIR"); dir != "" {
+		if _, err := Acquire(dir); err != nil {
+			os.Exit(1)
+		}
+		fmt.Println("locked")
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+
+	dir := filepath.Join(t.TempDir(), "account")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestAcquireOtherProcess$")
+	cmd.Env = append(os.Environ(), "ACCOUNTLOCK_TEST_DIR="+dir)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	defer func() { _ = cmd.Process.Kill() }()
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "locked\n", line)
+
+	holder, err := ReadHolder(dir)
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	require.Equal(t, cmd.Process.Pid, holder.PID)
+
+	_, err = Acquire(dir)
+	require.True(t, errcode.Is(err, errcode.ErrBertyAccountAlreadyOpened))
+
+	require.NoError(t, cmd.Process.Kill())
+	_ = cmd.Wait()
+
+	lock, err := Acquire(dir)
+	require.NoError(t, err)
+	require.NoError(t, lock.Release())
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	raw, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(raw)
+}
+
+func TestLockDir(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := LockDir(dir)
+	require.NoError(t, err)
+
+	// flock is held per open file, the same process can't lock it twice
+	_, err = LockDir(dir)
+	require.True(t, errcode.Is(err, errcode.ErrBertyAccountAlreadyOpened))
+	require.Contains(t, err.Error(), fmt.Sprintf("process %d", os.Getpid()))
+
+	locked, err := IsDirLocked(dir)
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	require.NoError(t, lock.Unlock())
+
+	locked, err = IsDirLocked(dir)
+	require.NoError(t, err)
+	require.False(t, locked)
+
+	lock, err = LockDir(dir)
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+}
@@ -0,0 +1,70 @@
+package accountlock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/flock"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// DirLockFilename is the file locked in the store directory of a running
+// node.
+const DirLockFilename = "store.lock"
+
+// DirLock is an exclusive flock on a store directory, it is released by the
+// system when the process exits.
+type DirLock struct {
+	flock *flock.Flock
+}
+
+// LockDir locks the store directory dir, it fails with
+// ErrBertyAccountAlreadyOpened when another process locked it.
+func LockDir(dir string) (*DirLock, error) {
+	path := filepath.Join(dir, DirLockFilename)
+
+	l := flock.New(path)
+	locked, err := l.TryLock()
+	if err != nil {
+		return nil, errcode.ErrBertyAccountFSError.Wrap(fmt.Errorf("unable to lock %s: %w", dir, err))
+	}
+	if !locked {
+		holder := "another process"
+		if raw, err := os.ReadFile(path); err == nil {
+			if pid, err := strconv.Atoi(strings.TrimSpace(string(raw))); err == nil {
+				holder = fmt.Sprintf("process %d", pid)
+			}
+		}
+
+		return nil, errcode.ErrBertyAccountAlreadyOpened.Wrap(fmt.Errorf("%s is used by %s, a single node can run on a store directory", dir, holder))
+	}
+
+	// the pid is only written for the error above, the lock is not tied to
+	// the content of the file, and a locked file can't be written on windows
+	_ = os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600)
+
+	return &DirLock{flock: l}, nil
+}
+
+// IsDirLocked returns true if a running node holds the lock of the store
+// directory dir.
+func IsDirLocked(dir string) (bool, error) {
+	return isLocked(filepath.Join(dir, DirLockFilename))
+}
+
+// Unlock releases the lock, the file is left in the directory.
+func (l *DirLock) Unlock() error {
+	if l == nil {
+		return nil
+	}
+
+	if err := l.flock.Unlock(); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	return nil
+}
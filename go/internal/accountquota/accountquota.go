@@ -0,0 +1,283 @@
+// Package accountquota enforces a disk quota on an account: when the account
+// grows over its quota, the pruners free space one after the other, e.g. the
+// old attachments, then the old blocks, then the old messages, and the writes
+// are refused while the account stays over the quota. The level changes are
+// reported so that the users are warned before the writes are refused.
+package accountquota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// DefaultWarnRatio is the share of the quota the users are warned at.
+	DefaultWarnRatio = 0.9
+
+	// DefaultCheckInterval is the time between two checks of the size of
+	// the account.
+	DefaultCheckInterval = 10 * time.Minute
+
+	// maxPruneRounds bounds the calls of a pruner in a check, as the size on
+	// disk may not decrease, e.g. before a database is compacted.
+	maxPruneRounds = 100
+)
+
+// Level is how close an account is to its quota.
+type Level int
+
+const (
+	LevelOK Level = iota
+	// LevelWarning is reached at the warn ratio of the quota.
+	LevelWarning
+	// LevelExceeded is reached when the pruners could not bring the account
+	// back under its quota, the writes are refused.
+	LevelExceeded
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelOK:
+		return "ok"
+	case LevelWarning:
+		return "warning"
+	case LevelExceeded:
+		return "exceeded"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// Status is the result of a check.
+type Status struct {
+	Size  int64 `json:"size"`
+	Limit int64 `json:"limit"`
+	Level Level `json:"level"`
+	// Pruned are the names of the pruners run by the check.
+	Pruned    []string  `json:"pruned,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// SizeFunc returns the size of the account on disk, in bytes.
+type SizeFunc func() (int64, error)
+
+// PruneFunc frees some space, it returns false once there is nothing left
+// for it to free.
+type PruneFunc func(ctx context.Context) (more bool, err error)
+
+// Pruner is a step of the eviction.
+type Pruner struct {
+	Name  string
+	Prune PruneFunc
+}
+
+// Opts configures an Enforcer.
+type Opts struct {
+	Logger *zap.Logger
+
+	// Limit is the quota, in bytes.
+	Limit int64
+
+	// WarnRatio is the share of Limit the level becomes LevelWarning at,
+	// DefaultWarnRatio when zero.
+	WarnRatio float64
+
+	// Size measures the account.
+	Size SizeFunc
+
+	// Pruners free space in order when the account is over its quota, the
+	// next one is only run when the previous ones did not free enough.
+	Pruners []Pruner
+
+	// OnChange is called when the level of a check differs from the level
+	// of the previous one.
+	OnChange func(previous, current Status)
+}
+
+// Enforcer checks the size of an account and prunes it.
+type Enforcer struct {
+	logger   *zap.Logger
+	limit    int64
+	warnAt   int64
+	size     SizeFunc
+	pruners  []Pruner
+	onChange func(previous, current Status)
+	muCheck  sync.Mutex
+	muStatus sync.RWMutex
+	status   Status
+}
+
+func New(opts Opts) (*Enforcer, error) {
+	if opts.Limit <= 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the quota must be positive, got %d", opts.Limit))
+	}
+
+	if opts.Size == nil {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a size function is required"))
+	}
+
+	if opts.WarnRatio == 0 {
+		opts.WarnRatio = DefaultWarnRatio
+	}
+	if opts.WarnRatio < 0 || opts.WarnRatio > 1 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the warn ratio must be between 0 and 1, got %g", opts.WarnRatio))
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+
+	return &Enforcer{
+		logger:   opts.Logger,
+		limit:    opts.Limit,
+		warnAt:   int64(float64(opts.Limit) * opts.WarnRatio),
+		size:     opts.Size,
+		pruners:  opts.Pruners,
+		onChange: opts.OnChange,
+		status:   Status{Limit: opts.Limit},
+	}, nil
+}
+
+// Limit returns the quota, in bytes.
+func (e *Enforcer) Limit() int64 {
+	return e.limit
+}
+
+// Status returns the result of the last check.
+func (e *Enforcer) Status() Status {
+	e.muStatus.RLock()
+	defer e.muStatus.RUnlock()
+
+	return e.status
+}
+
+// Allow returns an error while the account is over its quota, the writes
+// must be refused. A nil enforcer allows everything.
+func (e *Enforcer) Allow() error {
+	if e == nil {
+		return nil
+	}
+
+	status := e.Status()
+	if status.Level != LevelExceeded {
+		return nil
+	}
+
+	return errcode.ErrDBWrite.Wrap(fmt.Errorf("the account uses %d bytes, over its quota of %d bytes", status.Size, status.Limit))
+}
+
+// Check measures the account, prunes it when it is over its quota, and
+// updates the level.
+func (e *Enforcer) Check(ctx context.Context) (Status, error) {
+	e.muCheck.Lock()
+	defer e.muCheck.Unlock()
+
+	size, err := e.size()
+	if err != nil {
+		return e.Status(), err
+	}
+
+	pruned := []string(nil)
+	for _, p := range e.pruners {
+		if size <= e.limit {
+			break
+		}
+
+		ran := false
+		for round := 0; round < maxPruneRounds && size > e.limit; round++ {
+			more, err := p.Prune(ctx)
+			if err != nil {
+				e.logger.Warn("unable to prune the account", zap.String("pruner", p.Name), zap.Error(err))
+				break
+			}
+			ran = true
+
+			if size, err = e.size(); err != nil {
+				return e.Status(), err
+			}
+
+			if !more {
+				break
+			}
+		}
+
+		if ran {
+			pruned = append(pruned, p.Name)
+			e.logger.Info("account pruned", zap.String("pruner", p.Name), zap.Int64("size", size), zap.Int64("limit", e.limit))
+		}
+	}
+
+	current := Status{Size: size, Limit: e.limit, Level: e.level(size), Pruned: pruned, CheckedAt: time.Now()}
+
+	e.muStatus.Lock()
+	previous := e.status
+	e.status = current
+	e.muStatus.Unlock()
+
+	if current.Level != previous.Level && e.onChange != nil {
+		e.onChange(previous, current)
+	}
+
+	return current, nil
+}
+
+func (e *Enforcer) level(size int64) Level {
+	switch {
+	case size > e.limit:
+		return LevelExceeded
+	case size >= e.warnAt:
+		return LevelWarning
+	default:
+		return LevelOK
+	}
+}
+
+// DirSize returns the total size of the files under the directories, a
+// directory given twice, or nested in another one, is counted once.
+func DirSize(dirs ...string) (int64, error) {
+	seen := map[string]bool{}
+	total := int64(0)
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				// e.g. a temporary file of a database
+				return nil
+			case err != nil:
+				return err
+			}
+
+			if d.IsDir() {
+				if seen[path] {
+					return filepath.SkipDir
+				}
+				seen[path] = true
+				return nil
+			}
+
+			info, err := d.Info()
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				return nil
+			case err != nil:
+				return err
+			}
+			total += info.Size()
+			return nil
+		})
+		if err != nil {
+			return 0, errcode.ErrInternal.Wrap(err)
+		}
+	}
+
+	return total, nil
+}
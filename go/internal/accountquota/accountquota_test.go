@@ -0,0 +1,107 @@
+package accountquota
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestEnforcer(t *testing.T) {
+	ctx := context.Background()
+
+	size := int64(50)
+	attachments, messages := int64(30), int64(40)
+	changes := []Level(nil)
+	e, err := New(Opts{
+		Limit: 100,
+		Size:  func() (int64, error) { return size, nil },
+		Pruners: []Pruner{
+			{Name: "attachments", Prune: func(context.Context) (bool, error) {
+				freed := attachments
+				if freed > 10 {
+					freed = 10
+				}
+				attachments -= freed
+				size -= freed
+				return attachments > 0, nil
+			}},
+			{Name: "messages", Prune: func(context.Context) (bool, error) {
+				size -= messages
+				messages = 0
+				return false, nil
+			}},
+		},
+		OnChange: func(_, current Status) { changes = append(changes, current.Level) },
+	})
+	require.NoError(t, err)
+
+	status, err := e.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, LevelOK, status.Level)
+	require.Empty(t, status.Pruned)
+	require.Nil(t, changes)
+
+	size = 95
+	status, err = e.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, LevelWarning, status.Level)
+	require.NoError(t, e.Allow())
+
+	// the attachments are pruned first, the messages are kept
+	size = 115
+	status, err = e.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"attachments"}, status.Pruned)
+	require.Equal(t, int64(95), status.Size)
+	require.Equal(t, int64(10), attachments)
+	require.Equal(t, int64(40), messages)
+
+	size = 160
+	status, err = e.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"attachments", "messages"}, status.Pruned)
+	require.Equal(t, int64(110), status.Size)
+	require.Equal(t, LevelExceeded, status.Level)
+	require.True(t, errcode.Is(e.Allow(), errcode.ErrDBWrite))
+
+	size = 20
+	status, err = e.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, LevelOK, status.Level)
+	require.NoError(t, e.Allow())
+
+	require.Equal(t, []Level{LevelWarning, LevelExceeded, LevelOK}, changes)
+
+	require.NoError(t, (*Enforcer)(nil).Allow())
+}
+
+func TestNew(t *testing.T) {
+	size := func() (int64, error) { return 0, nil }
+
+	_, err := New(Opts{Limit: 0, Size: size})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+	_, err = New(Opts{Limit: 1})
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+	_, err = New(Opts{Limit: 1, Size: size, WarnRatio: 2})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
+
+func TestDirSize(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a"), make([]byte, 10), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b"), make([]byte, 5), 0o600))
+
+	size, err := DirSize(dir, filepath.Join(dir, "sub"), dir)
+	require.NoError(t, err)
+	require.Equal(t, int64(15), size)
+
+	size, err = DirSize(filepath.Join(dir, "sub"), dir)
+	require.NoError(t, err)
+	require.Equal(t, int64(15), size)
+}
@@ -0,0 +1,189 @@
+package accountsession
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"berty.tech/berty/v2/go/internal/accounthealth"
+	"berty.tech/berty/v2/go/internal/accountlock"
+	"berty.tech/berty/v2/go/pkg/accounttypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// OpenAccount asks the account service served by cc to open accountID with
+// the daemon args, the returned lease must be renewed before it expires.
+func OpenAccount(ctx context.Context, cc grpc.ClientConnInterface, accountID string, args []string) (*Lease, error) {
+	reply, err := accounttypes.NewAccountSessionServiceClient(cc).OpenAccount(ctx, &accounttypes.SessionOpenAccount_Request{AccountID: accountID, Args: args})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return leaseFromProto(reply.Lease)
+}
+
+// RenewLease extends the lease leaseID.
+func RenewLease(ctx context.Context, cc grpc.ClientConnInterface, leaseID string) (*Lease, error) {
+	reply, err := accounttypes.NewAccountSessionServiceClient(cc).RenewLease(ctx, &accounttypes.SessionRenewLease_Request{LeaseID: leaseID})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return leaseFromProto(reply.Lease)
+}
+
+// CloseAccount closes the account leased by leaseID.
+func CloseAccount(ctx context.Context, cc grpc.ClientConnInterface, leaseID string) error {
+	_, err := accounttypes.NewAccountSessionServiceClient(cc).CloseAccount(ctx, &accounttypes.SessionCloseAccount_Request{LeaseID: leaseID})
+	return rpcError(err)
+}
+
+// ListAccounts returns the accounts of the account service served by cc.
+func ListAccounts(ctx context.Context, cc grpc.ClientConnInterface) ([]*Account, error) {
+	reply, err := accounttypes.NewAccountSessionServiceClient(cc).ListAccounts(ctx, &accounttypes.SessionListAccounts_Request{})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	accounts := make([]*Account, len(reply.Accounts))
+	for i, account := range reply.Accounts {
+		accounts[i] = accountFromProto(account)
+	}
+
+	return accounts, nil
+}
+
+func rpcError(err error) error {
+	if status.Code(err) == codes.Unimplemented {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the daemon has no account session service: %w", err))
+	}
+	return err
+}
+
+// Register adds the session service of m to server.
+func Register(server *grpc.Server, m *Manager) {
+	accounttypes.RegisterAccountSessionServiceServer(server, &sessionServer{manager: m})
+}
+
+type sessionServer struct {
+	accounttypes.UnimplementedAccountSessionServiceServer
+
+	manager *Manager
+}
+
+func (s *sessionServer) OpenAccount(ctx context.Context, req *accounttypes.SessionOpenAccount_Request) (*accounttypes.SessionOpenAccount_Reply, error) {
+	if req.AccountID == "" {
+		return nil, errcode.ErrBertyAccountNoIDSpecified
+	}
+
+	lease, err := s.manager.Open(ctx, req.AccountID, req.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accounttypes.SessionOpenAccount_Reply{Lease: lease.toProto()}, nil
+}
+
+func (s *sessionServer) RenewLease(ctx context.Context, req *accounttypes.SessionRenewLease_Request) (*accounttypes.SessionRenewLease_Reply, error) {
+	lease, err := s.manager.Renew(ctx, req.LeaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accounttypes.SessionRenewLease_Reply{Lease: lease.toProto()}, nil
+}
+
+func (s *sessionServer) CloseAccount(ctx context.Context, req *accounttypes.SessionCloseAccount_Request) (*accounttypes.SessionCloseAccount_Reply, error) {
+	if err := s.manager.Close(ctx, req.LeaseID); err != nil {
+		return nil, err
+	}
+
+	return &accounttypes.SessionCloseAccount_Reply{}, nil
+}
+
+func (s *sessionServer) ListAccounts(ctx context.Context, _ *accounttypes.SessionListAccounts_Request) (*accounttypes.SessionListAccounts_Reply, error) {
+	accounts, err := s.manager.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &accounttypes.SessionListAccounts_Reply{}
+	for _, account := range accounts {
+		reply.Accounts = append(reply.Accounts, account.toProto())
+	}
+
+	return reply, nil
+}
+
+func (l *Lease) toProto() *accounttypes.AccountLease {
+	return &accounttypes.AccountLease{
+		LeaseID:   l.ID,
+		AccountID: l.AccountID,
+		ExpiresAt: l.ExpiresAt.UnixMilli(),
+	}
+}
+
+func leaseFromProto(lease *accounttypes.AccountLease) (*Lease, error) {
+	if lease == nil {
+		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("the daemon returned no lease"))
+	}
+
+	return &Lease{
+		ID:        lease.LeaseID,
+		AccountID: lease.AccountID,
+		ExpiresAt: time.UnixMilli(lease.ExpiresAt),
+	}, nil
+}
+
+func (a *Account) toProto() *accounttypes.SessionAccount {
+	account := &accounttypes.SessionAccount{
+		AccountID:  a.AccountID,
+		Name:       a.Name,
+		LastOpened: a.LastOpened,
+		Error:      a.Error,
+		Opened:     a.Opened,
+		LastError:  a.LastError.ToProto(),
+	}
+
+	if a.LeaseExpiresAt != nil {
+		account.LeaseExpiresAt = a.LeaseExpiresAt.UnixMilli()
+	}
+
+	if a.LockedBy != nil {
+		account.LockedBy = &accounttypes.AccountLockHolder{
+			PID:      int64(a.LockedBy.PID),
+			Hostname: a.LockedBy.Hostname,
+			Since:    a.LockedBy.Since.UnixMilli(),
+		}
+	}
+
+	return account
+}
+
+func accountFromProto(account *accounttypes.SessionAccount) *Account {
+	a := &Account{
+		AccountID:  account.AccountID,
+		Name:       account.Name,
+		LastOpened: account.LastOpened,
+		Error:      account.Error,
+		Opened:     account.Opened,
+		LastError:  accounthealth.RecordFromProto(account.LastError),
+	}
+
+	if account.LeaseExpiresAt != 0 {
+		expiresAt := time.UnixMilli(account.LeaseExpiresAt)
+		a.LeaseExpiresAt = &expiresAt
+	}
+
+	if account.LockedBy != nil {
+		a.LockedBy = &accountlock.Holder{
+			PID:      int(account.LockedBy.PID),
+			Hostname: account.LockedBy.Hostname,
+			Since:    time.UnixMilli(account.LockedBy.Since),
+		}
+	}
+
+	return a
+}
@@ -0,0 +1,241 @@
+// Package accountsession hands out leases on the account opened by the
+// account service. The client opening an account gets a lease which it must
+// renew, the account is closed when the lease expires, e.g. when the client
+// crashed, so that another client or another process can open it.
+package accountsession
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/accounthealth"
+	"berty.tech/berty/v2/go/internal/accountlock"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/logutil"
+)
+
+// DefaultLeaseTTL is the time a lease is valid without being renewed.
+const DefaultLeaseTTL = time.Minute
+
+// Lease is held by the client which opened an account.
+type Lease struct {
+	ID        string
+	AccountID string
+	ExpiresAt time.Time
+}
+
+// Account is an account of the service.
+type Account struct {
+	AccountID  string
+	Name       string
+	LastOpened int64
+	Error      string
+	// Opened is true when the service opened the account.
+	Opened bool
+	// LeaseExpiresAt is set when the account is opened under a lease.
+	LeaseExpiresAt *time.Time
+	// LockedBy is set when another process opened the account.
+	LockedBy *accountlock.Holder
+	// LastError is set when the last opening of the account failed.
+	LastError *accounthealth.Record
+}
+
+// Accounts is the account service, it opens a single account at a time.
+type Accounts interface {
+	OpenAccount(ctx context.Context, accountID string, args []string) error
+	CloseAccount(ctx context.Context) error
+	// OpenedAccount returns the ID of the opened account, or an empty
+	// string.
+	OpenedAccount(ctx context.Context) (string, error)
+	ListAccounts(ctx context.Context) ([]*Account, error)
+}
+
+type Opts struct {
+	// LeaseTTL defaults to DefaultLeaseTTL.
+	LeaseTTL time.Duration
+	Logger   *zap.Logger
+}
+
+// Manager hands out the leases, the account opened without it by the
+// account service is not leased.
+type Manager struct {
+	accounts Accounts
+	ttl      time.Duration
+	logger   *zap.Logger
+
+	mu     sync.Mutex
+	lease  *Lease
+	expiry *time.Timer
+}
+
+func New(accounts Accounts, opts Opts) *Manager {
+	if opts.LeaseTTL <= 0 {
+		opts.LeaseTTL = DefaultLeaseTTL
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+
+	return &Manager{accounts: accounts, ttl: opts.LeaseTTL, logger: opts.Logger}
+}
+
+// Open opens accountID and returns its lease. It fails with
+// ErrBertyAccountAlreadyOpened while another lease is valid, an expired one
+// is closed first.
+func (m *Manager) Open(ctx context.Context, accountID string, args []string) (*Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lease != nil {
+		if time.Now().Before(m.lease.ExpiresAt) {
+			return nil, errcode.ErrBertyAccountAlreadyOpened.Wrap(fmt.Errorf("account leased until %s", m.lease.ExpiresAt.Local().Format(time.RFC3339)))
+		}
+
+		if err := m.closeLocked(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.accounts.OpenAccount(ctx, accountID, args); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, errcode.ErrCryptoRandomGeneration.Wrap(err)
+	}
+
+	m.lease = &Lease{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		AccountID: accountID,
+		ExpiresAt: time.Now().Add(m.ttl),
+	}
+	m.expiry = time.AfterFunc(m.ttl, m.expire)
+
+	lease := *m.lease
+	return &lease, nil
+}
+
+// Renew extends the lease leaseID.
+func (m *Manager) Renew(ctx context.Context, leaseID string) (*Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkLocked(ctx, leaseID); err != nil {
+		return nil, err
+	}
+
+	m.lease.ExpiresAt = time.Now().Add(m.ttl)
+	m.expiry.Reset(m.ttl)
+
+	lease := *m.lease
+	return &lease, nil
+}
+
+// Close closes the account leased by leaseID.
+func (m *Manager) Close(ctx context.Context, leaseID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkLocked(ctx, leaseID); err != nil {
+		return err
+	}
+
+	return m.closeLocked(ctx)
+}
+
+// List returns the accounts of the service.
+func (m *Manager) List(ctx context.Context) ([]*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	accounts, err := m.accounts.ListAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, account := range accounts {
+		if m.lease != nil && m.lease.AccountID == account.AccountID && account.Opened {
+			expiresAt := m.lease.ExpiresAt
+			account.LeaseExpiresAt = &expiresAt
+		}
+	}
+
+	return accounts, nil
+}
+
+// Stop stops the expiry of the current lease, the account stays opened.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.expiry != nil {
+		m.expiry.Stop()
+	}
+	m.lease = nil
+}
+
+// checkLocked returns an error if leaseID is not the valid lease of the
+// opened account.
+func (m *Manager) checkLocked(ctx context.Context, leaseID string) error {
+	if m.lease == nil || m.lease.ID != leaseID {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown lease"))
+	}
+
+	if !time.Now().Before(m.lease.ExpiresAt) {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("lease expired"))
+	}
+
+	// the account may have been closed by the account service directly
+	opened, err := m.accounts.OpenedAccount(ctx)
+	if err != nil {
+		return err
+	}
+	if opened != m.lease.AccountID {
+		m.expiry.Stop()
+		m.lease = nil
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("leased account closed"))
+	}
+
+	return nil
+}
+
+func (m *Manager) closeLocked(ctx context.Context) error {
+	m.expiry.Stop()
+
+	opened, err := m.accounts.OpenedAccount(ctx)
+	if err != nil {
+		return err
+	}
+
+	// not closed if it was closed and opened again outside of the lease
+	if opened == m.lease.AccountID {
+		if err := m.accounts.CloseAccount(ctx); err != nil {
+			return err
+		}
+	}
+
+	m.lease = nil
+	return nil
+}
+
+// expire closes the leased account if its lease was not renewed.
+func (m *Manager) expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lease == nil || time.Now().Before(m.lease.ExpiresAt) {
+		return
+	}
+
+	m.logger.Warn("account lease expired, closing the account", logutil.PrivateString("account-id", m.lease.AccountID))
+	if err := m.closeLocked(context.Background()); err != nil {
+		m.logger.Error("unable to close the account of the expired lease", zap.Error(err))
+	}
+}
@@ -0,0 +1,170 @@
+package accountsession
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// fakeAccounts opens a single account at a time, as the account service.
+type fakeAccounts struct {
+	mu     sync.Mutex
+	opened string
+	closed int
+}
+
+func (a *fakeAccounts) OpenAccount(_ context.Context, accountID string, _ []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.opened != "" {
+		return errcode.ErrBertyAccountAlreadyOpened
+	}
+	a.opened = accountID
+	return nil
+}
+
+func (a *fakeAccounts) CloseAccount(context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.opened = ""
+	a.closed++
+	return nil
+}
+
+func (a *fakeAccounts) OpenedAccount(context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.opened, nil
+}
+
+func (a *fakeAccounts) ListAccounts(context.Context) ([]*Account, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	accounts := []*Account{}
+	for _, id := range []string{"0", "1"} {
+		accounts = append(accounts, &Account{AccountID: id, Opened: id == a.opened})
+	}
+	return accounts, nil
+}
+
+func (a *fakeAccounts) closedCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.closed
+}
+
+func TestManagerLease(t *testing.T) {
+	ctx := context.Background()
+	accounts := &fakeAccounts{}
+	m := New(accounts, Opts{LeaseTTL: time.Hour})
+	t.Cleanup(m.Stop)
+
+	lease, err := m.Open(ctx, "0", nil)
+	require.NoError(t, err)
+	require.Equal(t, "0", lease.AccountID)
+	require.NotEmpty(t, lease.ID)
+
+	// refused while the lease is valid
+	_, err = m.Open(ctx, "1", nil)
+	require.True(t, errcode.Is(err, errcode.ErrBertyAccountAlreadyOpened))
+
+	renewed, err := m.Renew(ctx, lease.ID)
+	require.NoError(t, err)
+	require.False(t, renewed.ExpiresAt.Before(lease.ExpiresAt))
+
+	_, err = m.Renew(ctx, "unknown")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+	require.True(t, errcode.Is(m.Close(ctx, "unknown"), errcode.ErrNotFound))
+
+	list, err := m.List(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, list[0].LeaseExpiresAt)
+	require.Nil(t, list[1].LeaseExpiresAt)
+
+	require.NoError(t, m.Close(ctx, lease.ID))
+	require.Equal(t, 1, accounts.closedCount())
+	_, err = m.Renew(ctx, lease.ID)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	// the account closed outside of the lease drops it
+	lease, err = m.Open(ctx, "1", nil)
+	require.NoError(t, err)
+	require.NoError(t, accounts.CloseAccount(ctx))
+	_, err = m.Renew(ctx, lease.ID)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	_, err = m.Open(ctx, "0", nil)
+	require.NoError(t, err)
+}
+
+func TestManagerLeaseExpiry(t *testing.T) {
+	ctx := context.Background()
+	accounts := &fakeAccounts{}
+	m := New(accounts, Opts{LeaseTTL: 50 * time.Millisecond})
+	t.Cleanup(m.Stop)
+
+	lease, err := m.Open(ctx, "0", nil)
+	require.NoError(t, err)
+
+	// closed once the lease is no longer renewed
+	require.Eventually(t, func() bool { return accounts.closedCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	_, err = m.Renew(ctx, lease.ID)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	lease, err = m.Open(ctx, "1", nil)
+	require.NoError(t, err)
+	require.Equal(t, "1", lease.AccountID)
+}
+
+func TestManagerRPC(t *testing.T) {
+	ctx := context.Background()
+	m := New(&fakeAccounts{}, Opts{LeaseTTL: time.Hour})
+	t.Cleanup(m.Stop)
+
+	l := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	Register(server, m)
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.Dial("buf",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	lease, err := OpenAccount(ctx, cc, "0", []string{"-node.listeners="})
+	require.NoError(t, err)
+	require.Equal(t, "0", lease.AccountID)
+
+	_, err = OpenAccount(ctx, cc, "1", nil)
+	require.Error(t, err)
+
+	_, err = RenewLease(ctx, cc, lease.ID)
+	require.NoError(t, err)
+
+	accounts, err := ListAccounts(ctx, cc)
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	require.True(t, accounts[0].Opened)
+	require.NotNil(t, accounts[0].LeaseExpiresAt)
+
+	require.NoError(t, CloseAccount(ctx, cc, lease.ID))
+	require.Error(t, CloseAccount(ctx, cc, lease.ID))
+}
@@ -0,0 +1,119 @@
+package accountutils
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/go-datastore"
+	badger "github.com/ipfs/go-ds-badger2"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/sqliteds"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// The backends storing the root datastore of an account.
+const (
+	DatastoreBackendSQLite = "sqlite"
+	DatastoreBackendBadger = "badger"
+)
+
+// DatastoreBackends lists the supported backends, the first one is the
+// default.
+var DatastoreBackends = []string{DatastoreBackendSQLite, DatastoreBackendBadger}
+
+// rootDatastoreTable is the table of the sqlite root datastore.
+const rootDatastoreTable = "blocks"
+
+// badgerIndexCacheSize is required by badger to encrypt its tables.
+const badgerIndexCacheSize = 64 << 20
+
+// GetRootDatastoreForBackend opens the root datastore of an account stored
+// in dir by backend. The badger datastore is encrypted with a key derived
+// from the storage key and salt.
+func GetRootDatastoreForBackend(dir string, backend string, key []byte, salt []byte, logger *zap.Logger) (datastore.Batching, error) {
+	switch backend {
+	case "", DatastoreBackendSQLite:
+		return getSQLiteRootDatastore(dir, key, salt)
+	case DatastoreBackendBadger:
+		return getBadgerRootDatastore(dir, key, salt)
+	default:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown datastore backend %q, supported backends are %v", backend, DatastoreBackends))
+	}
+}
+
+// getSQLiteRootDatastore opens the root datastore with sqliteds, in the
+// table and with the salt of the datastores created by
+// GetRootDatastoreForPath, which remain readable.
+func getSQLiteRootDatastore(dir string, key []byte, salt []byte) (datastore.Batching, error) {
+	if dir == InMemoryDir {
+		return datastore.NewMapDatastore(), nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+
+	ds, err := sqliteds.Open(context.Background(), filepath.Join(dir, RootDatastoreFilename), sqliteds.Options{
+		Table: rootDatastoreTable,
+		Key:   key,
+		Salt:  salt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+func getBadgerRootDatastore(dir string, key []byte, salt []byte) (datastore.Batching, error) {
+	if dir == InMemoryDir {
+		return datastore.NewMapDatastore(), nil
+	}
+
+	dbPath := filepath.Join(dir, "datastore.badger")
+	if err := os.MkdirAll(dbPath, 0o700); err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+
+	opts := badger.DefaultOptions
+	if len(key) > 0 {
+		derived := sha256.Sum256(append(append([]byte{}, key...), salt...))
+		opts.EncryptionKey = derived[:]
+		opts.IndexCacheSize = badgerIndexCacheSize
+	}
+
+	ds, err := badger.NewDatastore(dbPath, &opts)
+	if err != nil {
+		return nil, errcode.ErrDBOpen.Wrap(err)
+	}
+
+	return ds, nil
+}
+
+// HasRootDatastore returns true if the root datastore of backend was
+// created in dir.
+func HasRootDatastore(dir string, backend string) (bool, error) {
+	var name string
+	switch backend {
+	case "", DatastoreBackendSQLite:
+		name = RootDatastoreFilename
+	case DatastoreBackendBadger:
+		name = "datastore.badger"
+	default:
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown datastore backend %q, supported backends are %v", backend, DatastoreBackends))
+	}
+
+	_, err := os.Stat(filepath.Join(dir, name))
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, errcode.TODO.Wrap(err)
+	}
+}
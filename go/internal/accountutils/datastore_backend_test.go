@@ -0,0 +1,54 @@
+package accountutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/sqliteds"
+)
+
+func TestGetRootDatastoreForBackendSQLite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	salt := []byte("0123456789abcdef")
+
+	found, err := HasRootDatastore(dir, DatastoreBackendSQLite)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	ds, err := GetRootDatastoreForBackend(dir, DatastoreBackendSQLite, key, salt, zap.NewNop())
+	require.NoError(t, err)
+	require.IsType(t, &sqliteds.Datastore{}, ds)
+	require.NoError(t, ds.Put(ctx, datastore.NewKey("/account"), []byte("value")))
+	require.NoError(t, ds.Close())
+
+	found, err = HasRootDatastore(dir, DatastoreBackendSQLite)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	ds, err = GetRootDatastoreForBackend(dir, DatastoreBackendSQLite, key, salt, zap.NewNop())
+	require.NoError(t, err)
+	value, err := ds.Get(ctx, datastore.NewKey("/account"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), value)
+	require.NoError(t, ds.Close())
+
+	// the datastores created before sqliteds remain readable
+	legacy := t.TempDir()
+	ds, err = GetRootDatastoreForPath(legacy, key, salt, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, ds.Put(ctx, datastore.NewKey("/legacy"), []byte("value")))
+	require.NoError(t, ds.Close())
+
+	ds, err = GetRootDatastoreForBackend(legacy, DatastoreBackendSQLite, key, salt, zap.NewNop())
+	require.NoError(t, err)
+	defer ds.Close()
+	value, err = ds.Get(ctx, datastore.NewKey("/legacy"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), value)
+}
@@ -0,0 +1,296 @@
+package accountutils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/shibukawa/configdir"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// The layouts of the account storage.
+const (
+	// LayoutXDG stores the data in XDG_DATA_HOME and the logs in
+	// XDG_STATE_HOME, or in their platform equivalents.
+	LayoutXDG = "xdg"
+	// LayoutLegacy stores everything in the user config directory, as the
+	// previous versions did.
+	LayoutLegacy = "legacy"
+	// LayoutCustom stores everything in a root directory chosen by the user.
+	LayoutCustom = "custom"
+)
+
+const (
+	layoutVendorName = "berty-tech"
+	layoutAppName    = "berty"
+	layoutLogsDir    = "logs"
+)
+
+// Layout is where the data and the state, e.g. the logs, of the accounts
+// are stored. The default account of the CLI is stored at the root of
+// DataDir, the other ones in its accounts directory, see GetAccountDir.
+type Layout struct {
+	Name     string
+	DataDir  string
+	StateDir string
+}
+
+// LogsDir returns the directory of the log files.
+func (l Layout) LogsDir() string {
+	return filepath.Join(l.StateDir, layoutLogsDir)
+}
+
+// AccountDir returns the directory of an account.
+func (l Layout) AccountDir(accountID string) string {
+	return GetAccountDir(l.DataDir, accountID)
+}
+
+// CustomLayout stores the data and the state in root.
+func CustomLayout(root string) Layout {
+	return Layout{Name: LayoutCustom, DataDir: root, StateDir: root}
+}
+
+// XDGLayout resolves the XDG base directories of the user, relative paths
+// in the environment are ignored as required by the specification.
+func XDGLayout() (Layout, error) {
+	return xdgLayout(runtime.GOOS)
+}
+
+func xdgLayout(goos string) (Layout, error) {
+	dataHome, err := xdgBaseDir("XDG_DATA_HOME", goos, userDataHome)
+	if err != nil {
+		return Layout{}, err
+	}
+
+	stateHome, err := xdgBaseDir("XDG_STATE_HOME", goos, userStateHome)
+	if err != nil {
+		return Layout{}, err
+	}
+
+	return Layout{
+		Name:     LayoutXDG,
+		DataDir:  filepath.Join(dataHome, layoutVendorName, layoutAppName),
+		StateDir: filepath.Join(stateHome, layoutVendorName, layoutAppName),
+	}, nil
+}
+
+// LegacyLayout is the config directory used before the XDG layout.
+func LegacyLayout() (Layout, error) {
+	folders := configdir.New(layoutVendorName, layoutAppName).QueryFolders(configdir.Global)
+	if len(folders) == 0 {
+		return Layout{}, errcode.ErrNotFound.Wrap(fmt.Errorf("no user config directory"))
+	}
+
+	return Layout{Name: LayoutLegacy, DataDir: folders[0].Path, StateDir: folders[0].Path}, nil
+}
+
+// ResolveLayout returns the layout named name, root is required by the
+// custom layout. An empty name resolves the default layout: the XDG one,
+// unless the legacy directory still holds the data, see
+// MigrateLegacyLayout.
+func ResolveLayout(name string, root string) (Layout, error) {
+	switch name {
+	case LayoutXDG:
+		return XDGLayout()
+	case LayoutLegacy:
+		return LegacyLayout()
+	case LayoutCustom:
+		if root == "" {
+			return Layout{}, errcode.ErrMissingInput.Wrap(fmt.Errorf("the custom layout requires a root directory"))
+		}
+		return CustomLayout(root), nil
+	case "":
+	default:
+		return Layout{}, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown storage layout %q, supported layouts are %v", name, []string{LayoutXDG, LayoutLegacy, LayoutCustom}))
+	}
+
+	xdg, err := XDGLayout()
+	if err != nil {
+		return Layout{}, err
+	}
+
+	legacy, err := LegacyLayout()
+	if err != nil {
+		return xdg, nil
+	}
+
+	return defaultLayout(xdg, legacy), nil
+}
+
+// defaultLayout returns legacy while it holds the data and xdg does not.
+func defaultLayout(xdg, legacy Layout) Layout {
+	if hasEntries(legacy.DataDir) && !hasEntries(xdg.DataDir) {
+		return legacy
+	}
+
+	return xdg
+}
+
+// MigrateLegacyLayout moves the data of the legacy layout to dst, and its
+// logs to the state directory of dst. The node must be stopped. dst must not
+// hold data yet, the directories are never merged.
+func MigrateLegacyLayout(legacy Layout, dst Layout) error {
+	if filepath.Clean(legacy.DataDir) == filepath.Clean(dst.DataDir) {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the data is already stored in %s", dst.DataDir))
+	}
+
+	if !hasEntries(legacy.DataDir) {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("no data to migrate in %s", legacy.DataDir))
+	}
+
+	if hasEntries(dst.DataDir) {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("%s already holds data, remove it first", dst.DataDir))
+	}
+
+	if err := moveDir(legacy.DataDir, dst.DataDir); err != nil {
+		return err
+	}
+
+	// the legacy logs were stored along the data
+	logsDir := filepath.Join(dst.DataDir, layoutLogsDir)
+	if filepath.Clean(dst.StateDir) == filepath.Clean(dst.DataDir) || !hasEntries(logsDir) {
+		return nil
+	}
+
+	if hasEntries(dst.LogsDir()) {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the data was moved, but %s already holds logs, the previous ones are kept in %s", dst.LogsDir(), logsDir))
+	}
+
+	return moveDir(logsDir, dst.LogsDir())
+}
+
+func xdgBaseDir(env string, goos string, fallback func(goos, home string) string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errcode.ErrNotFound.Wrap(err)
+	}
+
+	return fallback(goos, home), nil
+}
+
+func userDataHome(goos, home string) string {
+	switch goos {
+	case "windows":
+		if dir := os.Getenv("LocalAppData"); dir != "" {
+			return dir
+		}
+		return filepath.Join(home, "AppData", "Local")
+	case "darwin", "ios":
+		return filepath.Join(home, "Library", "Application Support")
+	default:
+		return filepath.Join(home, ".local", "share")
+	}
+}
+
+func userStateHome(goos, home string) string {
+	switch goos {
+	case "windows":
+		return userDataHome(goos, home)
+	case "darwin", "ios":
+		return filepath.Join(home, "Library", "Logs")
+	default:
+		return filepath.Join(home, ".local", "state")
+	}
+}
+
+// hasEntries returns true if dir exists and is not empty.
+func hasEntries(dir string) bool {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	_, err = f.Readdirnames(1)
+	return err == nil
+}
+
+// moveDir renames src to dst, or copies it when they are on different
+// devices.
+func moveDir(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return errcode.TODO.Wrap(err)
+	}
+
+	// an empty destination is replaced
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return errcode.TODO.Wrap(err)
+	}
+
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if err := copyDir(src, dst); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(src); err != nil {
+		return errcode.TODO.Wrap(fmt.Errorf("%s was copied to %s but cannot be removed: %w", src, dst, err))
+	}
+
+	return nil
+}
+
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errcode.TODO.Wrap(err)
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return errcode.TODO.Wrap(err)
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(target, info.Mode().Perm()|0o700); err != nil {
+				return errcode.TODO.Wrap(err)
+			}
+			return nil
+		case !info.Mode().IsRegular():
+			return errcode.ErrNotImplemented.Wrap(fmt.Errorf("cannot copy %s, not a regular file", path))
+		}
+
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errcode.TODO.Wrap(err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return errcode.TODO.Wrap(err)
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return errcode.TODO.Wrap(err)
+	}
+
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return errcode.TODO.Wrap(err)
+	}
+
+	if err := out.Close(); err != nil {
+		return errcode.TODO.Wrap(err)
+	}
+
+	return nil
+}
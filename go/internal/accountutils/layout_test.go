@@ -0,0 +1,237 @@
+package accountutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestXDGLayout(t *testing.T) {
+	home := t.TempDir()
+
+	for _, tc := range []struct {
+		name      string
+		goos      string
+		env       map[string]string
+		dataHome  string
+		stateHome string
+	}{
+		{
+			name:      "linux",
+			goos:      "linux",
+			dataHome:  filepath.Join(home, ".local", "share"),
+			stateHome: filepath.Join(home, ".local", "state"),
+		},
+		{
+			name:      "linux with the xdg variables",
+			goos:      "linux",
+			env:       map[string]string{"XDG_DATA_HOME": "/data", "XDG_STATE_HOME": "/state"},
+			dataHome:  "/data",
+			stateHome: "/state",
+		},
+		{
+			name:      "relative xdg variables are ignored",
+			goos:      "linux",
+			env:       map[string]string{"XDG_DATA_HOME": "data", "XDG_STATE_HOME": "state"},
+			dataHome:  filepath.Join(home, ".local", "share"),
+			stateHome: filepath.Join(home, ".local", "state"),
+		},
+		{
+			name:      "freebsd",
+			goos:      "freebsd",
+			dataHome:  filepath.Join(home, ".local", "share"),
+			stateHome: filepath.Join(home, ".local", "state"),
+		},
+		{
+			name:      "macos",
+			goos:      "darwin",
+			dataHome:  filepath.Join(home, "Library", "Application Support"),
+			stateHome: filepath.Join(home, "Library", "Logs"),
+		},
+		{
+			name:      "ios",
+			goos:      "ios",
+			dataHome:  filepath.Join(home, "Library", "Application Support"),
+			stateHome: filepath.Join(home, "Library", "Logs"),
+		},
+		{
+			name:      "macos with the xdg variables",
+			goos:      "darwin",
+			env:       map[string]string{"XDG_DATA_HOME": "/data"},
+			dataHome:  "/data",
+			stateHome: filepath.Join(home, "Library", "Logs"),
+		},
+		{
+			name:      "windows",
+			goos:      "windows",
+			dataHome:  filepath.Join(home, "AppData", "Local"),
+			stateHome: filepath.Join(home, "AppData", "Local"),
+		},
+		{
+			name:      "windows with LocalAppData",
+			goos:      "windows",
+			env:       map[string]string{"LocalAppData": "/appdata"},
+			dataHome:  "/appdata",
+			stateHome: "/appdata",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("HOME", home)
+			for _, name := range []string{"XDG_DATA_HOME", "XDG_STATE_HOME", "LocalAppData"} {
+				t.Setenv(name, tc.env[name])
+			}
+
+			layout, err := xdgLayout(tc.goos)
+			require.NoError(t, err)
+			require.Equal(t, Layout{
+				Name:     LayoutXDG,
+				DataDir:  filepath.Join(tc.dataHome, "berty-tech", "berty"),
+				StateDir: filepath.Join(tc.stateHome, "berty-tech", "berty"),
+			}, layout)
+			require.Equal(t, filepath.Join(tc.stateHome, "berty-tech", "berty", "logs"), layout.LogsDir())
+		})
+	}
+}
+
+func TestResolveLayout(t *testing.T) {
+	root := t.TempDir()
+
+	layout, err := ResolveLayout(LayoutCustom, root)
+	require.NoError(t, err)
+	require.Equal(t, Layout{Name: LayoutCustom, DataDir: root, StateDir: root}, layout)
+
+	_, err = ResolveLayout(LayoutCustom, "")
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+
+	_, err = ResolveLayout("unknown", root)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
+
+func TestDefaultLayout(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		legacyData bool
+		xdgData    bool
+		expected   string
+	}{
+		{name: "new install", expected: LayoutXDG},
+		{name: "legacy data", legacyData: true, expected: LayoutLegacy},
+		{name: "migrated data", xdgData: true, expected: LayoutXDG},
+		{name: "data in both", legacyData: true, xdgData: true, expected: LayoutXDG},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			xdg := Layout{Name: LayoutXDG, DataDir: filepath.Join(root, "xdg"), StateDir: filepath.Join(root, "state")}
+			legacy := Layout{Name: LayoutLegacy, DataDir: filepath.Join(root, "legacy"), StateDir: filepath.Join(root, "legacy")}
+
+			if tc.legacyData {
+				writeTestFile(t, filepath.Join(legacy.DataDir, "account", "data"), "legacy")
+			}
+			if tc.xdgData {
+				writeTestFile(t, filepath.Join(xdg.DataDir, "account", "data"), "xdg")
+			}
+
+			require.Equal(t, tc.expected, defaultLayout(xdg, legacy).Name)
+		})
+	}
+}
+
+func TestMigrateLegacyLayout(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		setup func(t *testing.T, legacy, dst Layout)
+		err   errcode.ErrCode
+	}{
+		{
+			name: "empty destination",
+			setup: func(t *testing.T, legacy, dst Layout) {
+				require.NoError(t, os.MkdirAll(dst.DataDir, 0o700))
+			},
+		},
+		{
+			name: "missing destination",
+		},
+		{
+			name: "destination with data",
+			setup: func(t *testing.T, legacy, dst Layout) {
+				writeTestFile(t, filepath.Join(dst.DataDir, "other"), "other")
+			},
+			err: errcode.ErrInvalidInput,
+		},
+		{
+			name: "no legacy data",
+			setup: func(t *testing.T, legacy, dst Layout) {
+				require.NoError(t, os.RemoveAll(legacy.DataDir))
+			},
+			err: errcode.ErrNotFound,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			legacy := Layout{Name: LayoutLegacy, DataDir: filepath.Join(root, "legacy"), StateDir: filepath.Join(root, "legacy")}
+			dst := Layout{Name: LayoutXDG, DataDir: filepath.Join(root, "data"), StateDir: filepath.Join(root, "state")}
+
+			writeTestFile(t, filepath.Join(legacy.DataDir, "account", "data"), "account")
+			writeTestFile(t, filepath.Join(legacy.DataDir, "logs", "berty.log"), "log")
+			if tc.setup != nil {
+				tc.setup(t, legacy, dst)
+			}
+
+			err := MigrateLegacyLayout(legacy, dst)
+			if tc.err != errcode.Undefined {
+				require.True(t, errcode.Is(err, tc.err), err)
+
+				// the directories are never merged
+				if hasEntries(legacy.DataDir) {
+					requireTestFile(t, filepath.Join(legacy.DataDir, "account", "data"), "account")
+				}
+				require.NoFileExists(t, filepath.Join(dst.DataDir, "account", "data"))
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoDirExists(t, legacy.DataDir)
+			requireTestFile(t, filepath.Join(dst.DataDir, "account", "data"), "account")
+			requireTestFile(t, filepath.Join(dst.LogsDir(), "berty.log"), "log")
+			require.NoDirExists(t, filepath.Join(dst.DataDir, "logs"))
+		})
+	}
+
+	// the data is moved but the logs are kept along it when the state
+	// directory already holds logs
+	root := t.TempDir()
+	legacy := Layout{Name: LayoutLegacy, DataDir: filepath.Join(root, "legacy"), StateDir: filepath.Join(root, "legacy")}
+	dst := Layout{Name: LayoutXDG, DataDir: filepath.Join(root, "data"), StateDir: filepath.Join(root, "state")}
+	writeTestFile(t, filepath.Join(legacy.DataDir, "account", "data"), "account")
+	writeTestFile(t, filepath.Join(legacy.DataDir, "logs", "berty.log"), "log")
+	writeTestFile(t, filepath.Join(dst.LogsDir(), "berty.log"), "other log")
+
+	err := MigrateLegacyLayout(legacy, dst)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+	requireTestFile(t, filepath.Join(dst.DataDir, "account", "data"), "account")
+	requireTestFile(t, filepath.Join(dst.DataDir, "logs", "berty.log"), "log")
+	requireTestFile(t, filepath.Join(dst.LogsDir(), "berty.log"), "other log")
+
+	// the data cannot be migrated onto itself
+	err = MigrateLegacyLayout(dst, dst)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func requireTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, content, string(raw))
+}
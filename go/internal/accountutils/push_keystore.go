@@ -0,0 +1,265 @@
+package accountutils
+
+import (
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/cryptoutil"
+)
+
+const (
+	// PushKeyVersion is the version of the push keys created by this build,
+	// the keys created before the metadata were added have the version 0.
+	PushKeyVersion = 1
+
+	// PushKeyName is the name of the push key in a NativeKeystore.
+	PushKeyName = "push/device"
+
+	pushKeyMetaSuffix = ".meta"
+)
+
+// PushKey is the key pair of the device the push notifications are
+// encrypted for.
+type PushKey struct {
+	PublicKey *[cryptoutil.KeySize]byte
+	SecretKey *[cryptoutil.KeySize]byte
+	CreatedAt time.Time
+	Version   int
+}
+
+// PushKeyMeta is the metadata of a push key.
+type PushKeyMeta struct {
+	CreatedAt time.Time `json:"created_at"`
+	Version   int       `json:"version"`
+}
+
+// PushKeystore stores the push key of the device, it is implemented by a
+// file, the native keystore of the OS and the memory.
+type PushKeystore interface {
+	// GetPushKey returns the push key, it fails with ErrNotFound when there
+	// is none.
+	GetPushKey() (*PushKey, error)
+	// PutPushKey stores the push key, replacing the previous one.
+	PutPushKey(key *PushKey) error
+}
+
+// NewPushKey generates a push key.
+func NewPushKey() (*PushKey, error) {
+	pk, sk, err := box.GenerateKey(crand.Reader)
+	if err != nil {
+		return nil, errcode.ErrCryptoKeyGeneration.Wrap(err)
+	}
+
+	return &PushKey{PublicKey: pk, SecretKey: sk, CreatedAt: time.Now(), Version: PushKeyVersion}, nil
+}
+
+var pushKeyMutex = sync.Mutex{}
+
+// GetOrCreatePushKey returns the push key of ks, one is generated and stored
+// when there is none.
+func GetOrCreatePushKey(ks PushKeystore) (*PushKey, error) {
+	pushKeyMutex.Lock()
+	defer pushKeyMutex.Unlock()
+
+	key, err := ks.GetPushKey()
+	if !errcode.Is(err, errcode.ErrNotFound) {
+		return key, err
+	}
+
+	if key, err = NewPushKey(); err != nil {
+		return nil, err
+	}
+
+	if err := ks.PutPushKey(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// marshalPushKey returns the raw format of the keys, the public key followed
+// by the secret key.
+func marshalPushKey(key *PushKey) ([]byte, error) {
+	if key == nil || key.PublicKey == nil || key.SecretKey == nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a push key pair is required"))
+	}
+
+	raw := make([]byte, 0, cryptoutil.KeySize*2)
+	raw = append(raw, key.PublicKey[:]...)
+	return append(raw, key.SecretKey[:]...), nil
+}
+
+func unmarshalPushKey(raw []byte, meta PushKeyMeta) (*PushKey, error) {
+	if len(raw) != cryptoutil.KeySize*2 {
+		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("invalid push key size, expected %d bytes, got %d", cryptoutil.KeySize*2, len(raw)))
+	}
+
+	pk, sk := [cryptoutil.KeySize]byte{}, [cryptoutil.KeySize]byte{}
+	copy(pk[:], raw[:cryptoutil.KeySize])
+	copy(sk[:], raw[cryptoutil.KeySize:])
+
+	return &PushKey{PublicKey: &pk, SecretKey: &sk, CreatedAt: meta.CreatedAt, Version: meta.Version}, nil
+}
+
+// FilePushKeystore stores the push key in a file, in the raw format read by
+// the previous versions, and its metadata in a JSON file next to it.
+type FilePushKeystore struct {
+	path string
+}
+
+var _ PushKeystore = (*FilePushKeystore)(nil)
+
+func NewFilePushKeystore(filePath string) *FilePushKeystore {
+	return &FilePushKeystore{path: filePath}
+}
+
+func (ks *FilePushKeystore) GetPushKey() (*PushKey, error) {
+	raw, err := os.ReadFile(ks.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("no push key at %q", ks.path))
+	} else if err != nil {
+		return nil, errcode.ErrKeystoreGet.Wrap(err)
+	}
+
+	// the keys created before the metadata are dated by their file
+	meta := PushKeyMeta{}
+	switch data, err := os.ReadFile(ks.path + pushKeyMetaSuffix); {
+	case err == nil:
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		if info, err := os.Stat(ks.path); err == nil {
+			meta.CreatedAt = info.ModTime()
+		}
+	default:
+		return nil, errcode.ErrKeystoreGet.Wrap(err)
+	}
+
+	return unmarshalPushKey(raw, meta)
+}
+
+func (ks *FilePushKeystore) PutPushKey(key *PushKey) error {
+	raw, err := marshalPushKey(key)
+	if err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(PushKeyMeta{CreatedAt: key.CreatedAt, Version: key.Version})
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := os.MkdirAll(path.Dir(ks.path), 0o700); err != nil {
+		return errcode.ErrKeystorePut.Wrap(err)
+	}
+
+	if err := os.WriteFile(ks.path, raw, 0o600); err != nil {
+		return errcode.ErrKeystorePut.Wrap(err)
+	}
+
+	if err := os.WriteFile(ks.path+pushKeyMetaSuffix, meta, 0o600); err != nil {
+		return errcode.ErrKeystorePut.Wrap(err)
+	}
+
+	return nil
+}
+
+// NativePushKeystore stores the push key in a NativeKeystore, e.g. the
+// keychain of the OS given by the bridge.
+type NativePushKeystore struct {
+	ks NativeKeystore
+}
+
+var _ PushKeystore = (*NativePushKeystore)(nil)
+
+func NewNativePushKeystore(ks NativeKeystore) *NativePushKeystore {
+	return &NativePushKeystore{ks: ks}
+}
+
+type nativePushKey struct {
+	PushKeyMeta
+	Key []byte `json:"key"`
+}
+
+func (ks *NativePushKeystore) GetPushKey() (*PushKey, error) {
+	// the native keystores do not tell the missing keys apart from the
+	// other failures
+	data, err := ks.ks.Get(PushKeyName)
+	if err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	stored := nativePushKey{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return unmarshalPushKey(stored.Key, stored.PushKeyMeta)
+}
+
+func (ks *NativePushKeystore) PutPushKey(key *PushKey) error {
+	raw, err := marshalPushKey(key)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(nativePushKey{PushKeyMeta: PushKeyMeta{CreatedAt: key.CreatedAt, Version: key.Version}, Key: raw})
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := ks.ks.Put(PushKeyName, data); err != nil {
+		return errcode.ErrKeystorePut.Wrap(err)
+	}
+
+	return nil
+}
+
+// MemPushKeystore keeps the push key in memory, e.g. for the in-memory
+// accounts and the tests.
+type MemPushKeystore struct {
+	mu  sync.Mutex
+	key *PushKey
+}
+
+var _ PushKeystore = (*MemPushKeystore)(nil)
+
+func NewMemPushKeystore() *MemPushKeystore {
+	return &MemPushKeystore{}
+}
+
+func (ks *MemPushKeystore) GetPushKey() (*PushKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if ks.key == nil {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("no push key"))
+	}
+
+	key := *ks.key
+	return &key, nil
+}
+
+func (ks *MemPushKeystore) PutPushKey(key *PushKey) error {
+	if _, err := marshalPushKey(key); err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	stored := *key
+	ks.key = &stored
+	return nil
+}
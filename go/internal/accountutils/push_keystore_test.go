@@ -0,0 +1,70 @@
+package accountutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func testPushKeystore(t *testing.T, ks PushKeystore) {
+	t.Helper()
+
+	_, err := ks.GetPushKey()
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	created, err := GetOrCreatePushKey(ks)
+	require.NoError(t, err)
+	require.Equal(t, PushKeyVersion, created.Version)
+	require.False(t, created.CreatedAt.IsZero())
+
+	key, err := GetOrCreatePushKey(ks)
+	require.NoError(t, err)
+	require.Equal(t, created.PublicKey, key.PublicKey)
+	require.Equal(t, created.SecretKey, key.SecretKey)
+	require.True(t, created.CreatedAt.Equal(key.CreatedAt))
+
+	require.True(t, errcode.Is(ks.PutPushKey(&PushKey{}), errcode.ErrInvalidInput))
+}
+
+func TestFilePushKeystore(t *testing.T) {
+	dir := t.TempDir()
+	testPushKeystore(t, NewFilePushKeystore(filepath.Join(dir, "keys", DefaultPushKeyFilename)))
+
+	// the keys written by the previous versions have no metadata
+	legacy := filepath.Join(dir, "legacy.key")
+	key, err := NewPushKey()
+	require.NoError(t, err)
+	raw, err := marshalPushKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(legacy, raw, 0o600))
+
+	pk, sk, err := GetDevicePushKeyForPath(legacy, false)
+	require.NoError(t, err)
+	require.Equal(t, key.PublicKey, pk)
+	require.Equal(t, key.SecretKey, sk)
+
+	read, err := NewFilePushKeystore(legacy).GetPushKey()
+	require.NoError(t, err)
+	require.Equal(t, 0, read.Version)
+	require.False(t, read.CreatedAt.IsZero())
+
+	// a truncated file is not mistaken for a missing key
+	require.NoError(t, os.WriteFile(legacy, raw[:10], 0o600))
+	_, _, err = GetDevicePushKeyForPath(legacy, true)
+	require.True(t, errcode.Is(err, errcode.ErrDeserialization))
+
+	_, _, err = GetDevicePushKeyForPath(filepath.Join(dir, "missing.key"), false)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+}
+
+func TestNativePushKeystore(t *testing.T) {
+	testPushKeystore(t, NewNativePushKeystore(NewMemNativeKeystore()))
+}
+
+func TestMemPushKeystore(t *testing.T) {
+	testPushKeystore(t, NewMemPushKeystore())
+}
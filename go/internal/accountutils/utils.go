@@ -5,6 +5,7 @@ import (
 	crand "crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -15,10 +16,12 @@ import (
 	"github.com/ipfs/go-datastore"
 	sync_ds "github.com/ipfs/go-datastore/sync"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/nacl/box"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"moul.io/zapgorm2"
 
+	"berty.tech/berty/v2/go/internal/accountbundle"
+	"berty.tech/berty/v2/go/internal/accounthealth"
 	sqlite "berty.tech/berty/v2/go/internal/gorm-sqlcipher"
 	"berty.tech/berty/v2/go/pkg/accounttypes"
 	"berty.tech/berty/v2/go/pkg/errcode"
@@ -30,59 +33,48 @@ import (
 const (
 	InMemoryDir                      = ":memory:"
 	DefaultPushKeyFilename           = "push.key"
+	DefaultBundleKeyFilename         = "bundle.key"
 	AccountMetafileName              = "account_meta"
 	AccountNetConfFileName           = "account_net_conf"
+	RootDatastoreFilename            = "datastore.sqlite"
 	MessengerDatabaseFilename        = "messenger.sqlite"
 	ReplicationDatabaseFilename      = "replication.sqlite"
 	DirectoryServiceDatabaseFilename = "directoryservice.sqlite"
 	StorageKeyName                   = "storage"
 	StorageKeySize                   = 32
 	StorageSaltSize                  = 16
+
+	// MessengerDBBackupSuffix is appended to the files of the previous
+	// messenger db while it is rebuilt.
+	MessengerDBBackupSuffix = ".rebuild-backup"
 )
 
+// GetDevicePushKeyForPath returns the push key stored at filePath, see
+// FilePushKeystore. It fails with ErrNotFound when there is none and
+// createIfMissing is false.
 func GetDevicePushKeyForPath(filePath string, createIfMissing bool) (pk *[cryptoutil.KeySize]byte, sk *[cryptoutil.KeySize]byte, err error) {
-	contents, err := os.ReadFile(filePath)
-	if os.IsNotExist(err) && createIfMissing {
-		if err := os.MkdirAll(path.Dir(filePath), 0o700); err != nil {
-			return nil, nil, errcode.ErrInternal.Wrap(err)
-		}
-
-		pk, sk, err = box.GenerateKey(crand.Reader)
-		if err != nil {
-			return nil, nil, errcode.ErrCryptoKeyGeneration.Wrap(err)
-		}
-
-		contents = make([]byte, cryptoutil.KeySize*2)
-		for i := 0; i < cryptoutil.KeySize; i++ {
-			contents[i] = pk[i]
-			contents[i+cryptoutil.KeySize] = sk[i]
-		}
+	ks := NewFilePushKeystore(filePath)
 
-		if _, err := os.Create(filePath); err != nil {
-			return nil, nil, errcode.ErrInternal.Wrap(err)
-		}
-
-		if err := os.WriteFile(filePath, contents, 0o600); err != nil {
-			return nil, nil, errcode.ErrInternal.Wrap(err)
-		}
-
-		return pk, sk, nil
-	} else if err != nil {
-		return nil, nil, errcode.ErrPushUnableToDecrypt.Wrap(fmt.Errorf("unable to get device push key"))
+	var key *PushKey
+	if createIfMissing {
+		key, err = GetOrCreatePushKey(ks)
+	} else {
+		key, err = ks.GetPushKey()
 	}
-
-	pkVal := [cryptoutil.KeySize]byte{}
-	skVal := [cryptoutil.KeySize]byte{}
-
-	for i := 0; i < cryptoutil.KeySize; i++ {
-		pkVal[i] = contents[i]
-		skVal[i] = contents[i+cryptoutil.KeySize]
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return &pkVal, &skVal, nil
+	return key.PublicKey, key.SecretKey, nil
 }
 
 func ListAccounts(ctx context.Context, rootDir string, ks NativeKeystore, logger *zap.Logger) ([]*accounttypes.AccountMetadata, error) {
+	return ListAccountsWithErrors(ctx, rootDir, ks, logger, nil)
+}
+
+// ListAccountsWithErrors is ListAccounts calling onError, if not nil, with
+// the stage of accounthealth at which a broken account failed.
+func ListAccountsWithErrors(ctx context.Context, rootDir string, ks NativeKeystore, logger *zap.Logger, onError func(accountID string, stage string, err error)) ([]*accounttypes.AccountMetadata, error) {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
@@ -100,10 +92,20 @@ func ListAccounts(ctx context.Context, rootDir string, ks NativeKeystore, logger
 		return nil, errcode.ErrBertyAccountFSError.Wrap(err)
 	}
 
+	if onError == nil {
+		onError = func(string, string, error) {}
+	}
+
 	var accounts []*accounttypes.AccountMetadata
 
 	for _, subitem := range subitems {
 		if !subitem.IsDir() {
+			accounts = append(accounts, listBundledAccount(ctx, rootDir, subitem.Name(), ks, logger, onError)...)
+			continue
+		}
+
+		// left by an interrupted unpacking, see accountbundle.Open
+		if strings.HasSuffix(subitem.Name(), accountbundle.UnpackingSuffix) {
 			continue
 		}
 
@@ -111,6 +113,7 @@ func ListAccounts(ctx context.Context, rootDir string, ks NativeKeystore, logger
 		if ks != nil {
 			var err error
 			if storageKey, err = GetOrCreateStorageKeyForAccount(ks, subitem.Name()); err != nil {
+				onError(subitem.Name(), accounthealth.StageKeystore, err)
 				accounts = append(accounts, &accounttypes.AccountMetadata{Error: err.Error(), AccountID: subitem.Name()})
 				continue
 			}
@@ -120,6 +123,7 @@ func ListAccounts(ctx context.Context, rootDir string, ks NativeKeystore, logger
 		if ks != nil {
 			var err error
 			if storageSalt, err = GetOrCreateRootDatastoreSaltForAccount(ks, subitem.Name()); err != nil {
+				onError(subitem.Name(), accounthealth.StageKeystore, err)
 				accounts = append(accounts, &accounttypes.AccountMetadata{Error: err.Error(), AccountID: subitem.Name()})
 				continue
 			}
@@ -127,6 +131,7 @@ func ListAccounts(ctx context.Context, rootDir string, ks NativeKeystore, logger
 
 		account, err := GetAccountMetaForName(ctx, rootDir, subitem.Name(), storageKey, storageSalt, logger)
 		if err != nil {
+			onError(subitem.Name(), accounthealth.StageMetadata, err)
 			accounts = append(accounts, &accounttypes.AccountMetadata{Error: err.Error(), AccountID: subitem.Name()})
 		} else {
 			accounts = append(accounts, account)
@@ -168,6 +173,106 @@ func GetAccountMetaForName(ctx context.Context, rootDir string, accountID string
 	return meta, nil
 }
 
+// listBundledAccount returns the metadata of the account stored in the bundle
+// file name, if it is not unpacked.
+func listBundledAccount(ctx context.Context, rootDir string, name string, ks NativeKeystore, logger *zap.Logger, onError func(accountID string, stage string, err error)) []*accounttypes.AccountMetadata {
+	accountID := strings.TrimSuffix(name, accountbundle.Extension)
+	if accountID == name {
+		return nil
+	}
+
+	// an unpacked account is listed from its directory
+	if _, err := os.Stat(GetAccountDir(rootDir, accountID)); err == nil {
+		return nil
+	}
+
+	bundleKey, err := GetBundleKeyForAccount(rootDir, ks, accountID)
+	if err != nil {
+		onError(accountID, accounthealth.StageKeystore, err)
+		return []*accounttypes.AccountMetadata{{Error: err.Error(), AccountID: accountID}}
+	}
+
+	account, err := GetAccountMetaFromBundle(ctx, rootDir, accountID, bundleKey)
+	if err != nil {
+		logger.Warn("unable to read bundled account metadata", zap.Error(err), logutil.PrivateString("account-id", accountID))
+		onError(accountID, accounthealth.StageMetadata, err)
+		return []*accounttypes.AccountMetadata{{Error: err.Error(), AccountID: accountID}}
+	}
+
+	return []*accounttypes.AccountMetadata{account}
+}
+
+// GetAccountMetaFromBundle reads the metadata of an account stored as a
+// bundle file, without unpacking it.
+func GetAccountMetaFromBundle(ctx context.Context, rootDir string, accountID string, bundleKey []byte) (*accounttypes.AccountMetadata, error) {
+	metaBytes, err := accountbundle.ReadMetadata(GetAccountBundlePath(rootDir, accountID), bundleKey)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &accounttypes.AccountMetadata{}
+	if err := proto.Unmarshal(metaBytes, meta); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("unable to unmarshal account metadata: %w", err))
+	}
+
+	meta.AccountID = accountID
+
+	return meta, nil
+}
+
+// GetBundleKeyForAccount returns the key encrypting the bundle of an account:
+// its storage key when a native keystore is available, or else a key stored
+// on the device next to the accounts.
+func GetBundleKeyForAccount(rootDir string, ks NativeKeystore, accountID string) ([]byte, error) {
+	if ks != nil {
+		return GetOrCreateStorageKeyForAccount(ks, accountID)
+	}
+
+	return GetOrCreateBundleKeyForPath(filepath.Join(rootDir, DefaultBundleKeyFilename))
+}
+
+func GetOrCreateBundleKeyForPath(filePath string) ([]byte, error) {
+	key, err := os.ReadFile(filePath)
+	switch {
+	case err == nil:
+		if len(key) != StorageKeySize {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("bad bundle key, expected %d bytes, got %d", StorageKeySize, len(key)))
+		}
+		return key, nil
+
+	case os.IsNotExist(err):
+		key = make([]byte, StorageKeySize)
+		if _, err := crand.Read(key); err != nil {
+			return nil, errcode.ErrCryptoKeyGeneration.Wrap(err)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o700); err != nil {
+			return nil, errcode.ErrInternal.Wrap(err)
+		}
+
+		// O_EXCL: another process may be creating it too
+		f, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if os.IsExist(err) {
+			return GetOrCreateBundleKeyForPath(filePath)
+		} else if err != nil {
+			return nil, errcode.ErrInternal.Wrap(err)
+		}
+
+		if _, err := f.Write(key); err != nil {
+			_ = f.Close()
+			return nil, errcode.ErrInternal.Wrap(err)
+		}
+		if err := f.Close(); err != nil {
+			return nil, errcode.ErrInternal.Wrap(err)
+		}
+
+		return key, nil
+
+	default:
+		return nil, errcode.ErrInternal.Wrap(err)
+	}
+}
+
 func GetAccountsDir(rootDir string) string {
 	if rootDir == InMemoryDir {
 		return rootDir
@@ -182,6 +287,18 @@ func GetAccountDir(rootDir, accountID string) string {
 	return filepath.Join(GetAccountsDir(rootDir), accountID)
 }
 
+// GetAccountBundlePath returns the path of the bundle file of an account
+// stored as a single file, see accountbundle.
+func GetAccountBundlePath(rootDir, accountID string) string {
+	return GetAccountDir(rootDir, accountID) + accountbundle.Extension
+}
+
+// GetAccountLastErrorPath returns the path of the last error record of an
+// account, see accounthealth.
+func GetAccountLastErrorPath(rootDir, accountID string) string {
+	return GetAccountDir(rootDir, accountID) + accounthealth.Extension
+}
+
 func CreateDataDir(dir string) error {
 	switch {
 	case dir == "":
@@ -254,9 +371,9 @@ func GetRootDatastoreForPath(dir string, key []byte, salt []byte, logger *zap.Lo
 			return nil, errcode.TODO.Wrap(err)
 		}
 
-		dbPath := filepath.Join(dir, "datastore.sqlite")
+		dbPath := filepath.Join(dir, RootDatastoreFilename)
 		sqldsOpts := encrepo.SQLCipherDatastoreOptions{JournalMode: "WAL", PlaintextHeader: len(salt) != 0, Salt: salt}
-		ds, err = encrepo.NewSQLCipherDatastore("sqlite3", dbPath, "blocks", key, sqldsOpts)
+		ds, err = encrepo.NewSQLCipherDatastore("sqlite3", dbPath, rootDatastoreTable, key, sqldsOpts)
 		if err != nil {
 			return nil, errcode.TODO.Wrap(err)
 		}
@@ -275,10 +392,44 @@ func GetMessengerDBForPath(dir string, key []byte, salt []byte, logger *zap.Logg
 	return GetGormDBForPath(dir, key, salt, logger)
 }
 
+// GetMessengerDBForPathReadOnly opens the messenger db of an account in
+// read-only mode, for tools inspecting the account while its node holds the
+// writer. The db must be in WAL mode, readers see the last committed
+// transactions and do not block the writer.
+func GetMessengerDBForPathReadOnly(dir string, key []byte, salt []byte, logger *zap.Logger) (*gorm.DB, func(), error) {
+	if dir == InMemoryDir {
+		return nil, nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an in memory db cannot be opened read-only"))
+	}
+
+	return GetGormDBForPathReadOnly(path.Join(dir, MessengerDatabaseFilename), key, salt, logger)
+}
+
 func GetReplicationDBForPath(dir string, logger *zap.Logger) (*gorm.DB, func(), error) {
 	return getServiceDBForPath(dir, ReplicationDatabaseFilename, logger)
 }
 
+// GetReplicationDBForPostgres opens the replication db in the Postgres
+// database at dsn, it can be shared by the servers of a replication cluster.
+func GetReplicationDBForPostgres(dsn string, logger *zap.Logger) (*gorm.DB, func(), error) {
+	cfg := &gorm.Config{
+		Logger:                                   zapgorm2.New(logger.Named("gorm")),
+		DisableForeignKeyConstraintWhenMigrating: true,
+	}
+	db, err := gorm.Open(postgres.Open(dsn), cfg)
+	if err != nil {
+		return nil, nil, errcode.ErrDBOpen.Wrap(err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to gorm underlying db: %w", err)
+	}
+
+	return db, func() {
+		_ = sqlDB.Close()
+	}, nil
+}
+
 func GetDirectoryServiceDBForPath(dir string, logger *zap.Logger) (*gorm.DB, func(), error) {
 	return getServiceDBForPath(dir, DirectoryServiceDatabaseFilename, logger)
 }
@@ -296,7 +447,21 @@ const (
 	keyLength  = 32
 )
 
+// readOnlyMaxOpenConns allows concurrent queries on read-only dbs, WAL
+// readers do not block each other.
+const readOnlyMaxOpenConns = 4
+
 func GetGormDBForPath(dbPath string, key []byte, salt []byte, logger *zap.Logger) (*gorm.DB, func(), error) {
+	return getGormDBForPath(dbPath, key, salt, logger, false)
+}
+
+// GetGormDBForPathReadOnly opens an existing db with the read-only flag and
+// the query_only pragma, the file is never created nor written.
+func GetGormDBForPathReadOnly(dbPath string, key []byte, salt []byte, logger *zap.Logger) (*gorm.DB, func(), error) {
+	return getGormDBForPath(dbPath, key, salt, logger, true)
+}
+
+func getGormDBForPath(dbPath string, key []byte, salt []byte, logger *zap.Logger, readOnly bool) (*gorm.DB, func(), error) {
 	var sqliteConn string
 	if dbPath == InMemoryDir {
 		sqliteConn = fmt.Sprintf("file:memdb%d?mode=memory&cache=shared", time.Now().UnixNano())
@@ -305,6 +470,29 @@ func GetGormDBForPath(dbPath string, key []byte, salt []byte, logger *zap.Logger
 		args := []string{
 			"_journal_mode=WAL",
 		}
+		if readOnly {
+			if _, err := os.Stat(dbPath); err != nil {
+				return nil, nil, errcode.ErrDBRead.Wrap(err)
+			}
+
+			absPath, err := filepath.Abs(dbPath)
+			if err != nil {
+				return nil, nil, errcode.ErrInvalidInput.Wrap(err)
+			}
+
+			// the read-only mode is only available with URI filenames, the
+			// journal mode is the one set by the writer
+			uriPath := filepath.ToSlash(absPath)
+			if !strings.HasPrefix(uriPath, "/") {
+				// windows drive letters
+				uriPath = "/" + uriPath
+			}
+			sqliteConn = (&url.URL{Scheme: "file", Path: uriPath}).String()
+			args = []string{
+				"mode=ro",
+				"_query_only=1",
+			}
+		}
 		if len(key) != 0 {
 			if len(key) != keyLength {
 				return nil, nil, errcode.TODO.Wrap(fmt.Errorf("bad key, expected %d bytes, got %d", keyLength, len(key)))
@@ -336,7 +524,11 @@ func GetGormDBForPath(dbPath string, key []byte, salt []byte, logger *zap.Logger
 		return nil, nil, fmt.Errorf("unable to gorm underlying db: %w", err)
 	}
 
-	sqlDB.SetMaxOpenConns(1)
+	if readOnly {
+		sqlDB.SetMaxOpenConns(readOnlyMaxOpenConns)
+	} else {
+		sqlDB.SetMaxOpenConns(1)
+	}
 
 	return db, func() {
 		_ = sqlDB.Close()
@@ -0,0 +1,160 @@
+// Package addressbook defines a portable record of the contacts and
+// conversations of an account, written as JSON to be imported again, or as
+// vCards for other address book applications.
+package addressbook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Version is the version of the JSON format written by WriteJSON.
+const Version = 1
+
+// Book is the exported address book of an account.
+type Book struct {
+	Version       int             `json:"version"`
+	ExportedAt    time.Time       `json:"exported_at"`
+	Contacts      []*Contact      `json:"contacts"`
+	Conversations []*Conversation `json:"conversations"`
+}
+
+// Contact is a contact of the account. Link is the shareable link of the
+// contact, empty if its rendezvous seed is unknown.
+type Contact struct {
+	PublicKey             string    `json:"public_key"`
+	DisplayName           string    `json:"display_name,omitempty"`
+	State                 string    `json:"state"`
+	ConversationPublicKey string    `json:"conversation_public_key,omitempty"`
+	Link                  string    `json:"link,omitempty"`
+	CreatedDate           time.Time `json:"created_date"`
+	// Verified is true when the chain keys of the contact conversation were
+	// exchanged with every device of the contact.
+	Verified bool `json:"verified,omitempty"`
+}
+
+// Conversation is a conversation of the account. Link is only set for multi
+// member conversations, which can be joined again.
+type Conversation struct {
+	PublicKey   string `json:"public_key"`
+	DisplayName string `json:"display_name,omitempty"`
+	Type        string `json:"type"`
+	Link        string `json:"link,omitempty"`
+}
+
+// WriteJSON writes book as indented JSON.
+func WriteJSON(w io.Writer, book *Book) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(book); err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+	return nil
+}
+
+// ReadJSON reads a book written by WriteJSON.
+func ReadJSON(r io.Reader) (*Book, error) {
+	book := &Book{}
+	if err := json.NewDecoder(r).Decode(book); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if book.Version > Version {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("address book version %d is not supported, expected at most %d", book.Version, Version))
+	}
+
+	return book, nil
+}
+
+// WriteVCard writes the contacts as vCards 4.0 (RFC 6350), and the multi
+// member conversations as group vCards. vCards cannot be imported again,
+// WriteJSON must be used for that.
+func WriteVCard(w io.Writer, book *Book) error {
+	vw := &vcardWriter{w: w}
+
+	for _, c := range book.Contacts {
+		vw.line("BEGIN", "VCARD")
+		vw.line("VERSION", "4.0")
+		vw.line("UID", "urn:berty:"+c.PublicKey)
+		vw.line("FN", escapeVCard(displayNameOr(c.DisplayName, c.PublicKey)))
+		if c.Link != "" {
+			vw.line("URL", c.Link)
+		}
+		vw.line("X-BERTY-STATE", escapeVCard(c.State))
+		if c.Verified {
+			vw.line("X-BERTY-VERIFIED", "TRUE")
+		}
+		if c.ConversationPublicKey != "" {
+			vw.line("X-BERTY-CONVERSATION", c.ConversationPublicKey)
+		}
+		vw.line("END", "VCARD")
+	}
+
+	for _, c := range book.Conversations {
+		if c.Link == "" {
+			continue
+		}
+
+		vw.line("BEGIN", "VCARD")
+		vw.line("VERSION", "4.0")
+		vw.line("KIND", "group")
+		vw.line("UID", "urn:berty:"+c.PublicKey)
+		vw.line("FN", escapeVCard(displayNameOr(c.DisplayName, c.PublicKey)))
+		vw.line("URL", c.Link)
+		vw.line("END", "VCARD")
+	}
+
+	if vw.err != nil {
+		return errcode.ErrSerialization.Wrap(vw.err)
+	}
+	return nil
+}
+
+func displayNameOr(name, fallback string) string {
+	if name != "" {
+		return name
+	}
+	return fallback
+}
+
+// vcardLineLength is the maximum length in octets of a vCard line, longer
+// lines are folded.
+const vcardLineLength = 75
+
+type vcardWriter struct {
+	w   io.Writer
+	err error
+}
+
+// line writes a content line, folded without splitting UTF-8 sequences.
+func (vw *vcardWriter) line(name, value string) {
+	if vw.err != nil {
+		return
+	}
+
+	b := &strings.Builder{}
+	length := 0
+	for _, r := range name + ":" + value {
+		size := len(string(r))
+		if length+size > vcardLineLength {
+			b.WriteString("\r\n ")
+			length = 1
+		}
+		b.WriteRune(r)
+		length += size
+	}
+	b.WriteString("\r\n")
+
+	_, vw.err = io.WriteString(vw.w, b.String())
+}
+
+var vcardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeVCard(value string) string {
+	return vcardEscaper.Replace(value)
+}
@@ -0,0 +1,73 @@
+package addressbook
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testBook() *Book {
+	return &Book{
+		Version:    Version,
+		ExportedAt: time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC),
+		Contacts: []*Contact{
+			{
+				PublicKey:             "contact-pk",
+				DisplayName:           "Alice; Bob, \\ and\nCarol",
+				State:                 "Accepted",
+				ConversationPublicKey: "conversation-pk",
+				Link:                  "https://berty.tech/id#" + strings.Repeat("é", 60),
+				Verified:              true,
+			},
+			{PublicKey: "no-name-pk", State: "IncomingRequest"},
+		},
+		Conversations: []*Conversation{
+			{PublicKey: "group-pk", DisplayName: "group", Type: "MultiMemberType", Link: "https://berty.tech/group#x"},
+			{PublicKey: "conversation-pk", Type: "ContactType"},
+		},
+	}
+}
+
+func TestJSON(t *testing.T) {
+	book := testBook()
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteJSON(buf, book))
+
+	read, err := ReadJSON(buf)
+	require.NoError(t, err)
+	require.Equal(t, book, read)
+
+	_, err = ReadJSON(strings.NewReader(`{"version": 42}`))
+	require.Error(t, err)
+}
+
+func TestProto(t *testing.T) {
+	book := testBook()
+	require.Equal(t, book, FromProto(book.ToProto()))
+}
+
+func TestVCard(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteVCard(buf, testBook()))
+	out := buf.String()
+
+	require.Equal(t, 3, strings.Count(out, "BEGIN:VCARD\r\n"))
+	require.Contains(t, out, "UID:urn:berty:contact-pk\r\n")
+	require.Contains(t, out, `FN:Alice\; Bob\, \\ and\nCarol`+"\r\n")
+	require.Contains(t, out, "FN:no-name-pk\r\n")
+	require.Contains(t, out, "X-BERTY-CONVERSATION:conversation-pk\r\n")
+	require.Equal(t, 1, strings.Count(out, "X-BERTY-VERIFIED:TRUE\r\n"))
+	require.Contains(t, out, "KIND:group\r\nUID:urn:berty:group-pk\r\n")
+	require.NotContains(t, out, "urn:berty:conversation-pk")
+
+	for _, line := range strings.Split(out, "\r\n") {
+		require.LessOrEqual(t, len(line), vcardLineLength)
+	}
+
+	// unfolding gives back the link
+	require.Contains(t, strings.ReplaceAll(out, "\r\n ", ""), "URL:https://berty.tech/id#"+strings.Repeat("é", 60)+"\r\n")
+}
@@ -0,0 +1,72 @@
+package addressbook
+
+import (
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// ToProto returns the book as sent by the AddressBookExport RPC.
+func (b *Book) ToProto() *messengertypes.AddressBook {
+	book := &messengertypes.AddressBook{
+		ExportedAt:    b.ExportedAt.UnixMilli(),
+		Contacts:      make([]*messengertypes.AddressBook_Contact, len(b.Contacts)),
+		Conversations: make([]*messengertypes.AddressBook_Conversation, len(b.Conversations)),
+	}
+
+	for i, c := range b.Contacts {
+		book.Contacts[i] = &messengertypes.AddressBook_Contact{
+			PublicKey:             c.PublicKey,
+			DisplayName:           c.DisplayName,
+			State:                 c.State,
+			ConversationPublicKey: c.ConversationPublicKey,
+			Link:                  c.Link,
+			CreatedDate:           c.CreatedDate.UnixMilli(),
+			Verified:              c.Verified,
+		}
+	}
+
+	for i, c := range b.Conversations {
+		book.Conversations[i] = &messengertypes.AddressBook_Conversation{
+			PublicKey:   c.PublicKey,
+			DisplayName: c.DisplayName,
+			Type:        c.Type,
+			Link:        c.Link,
+		}
+	}
+
+	return book
+}
+
+// FromProto returns the book sent by the AddressBookExport RPC.
+func FromProto(book *messengertypes.AddressBook) *Book {
+	b := &Book{
+		Version:       Version,
+		ExportedAt:    time.UnixMilli(book.GetExportedAt()).UTC(),
+		Contacts:      make([]*Contact, len(book.GetContacts())),
+		Conversations: make([]*Conversation, len(book.GetConversations())),
+	}
+
+	for i, c := range book.GetContacts() {
+		b.Contacts[i] = &Contact{
+			PublicKey:             c.PublicKey,
+			DisplayName:           c.DisplayName,
+			State:                 c.State,
+			ConversationPublicKey: c.ConversationPublicKey,
+			Link:                  c.Link,
+			CreatedDate:           time.UnixMilli(c.CreatedDate).UTC(),
+			Verified:              c.Verified,
+		}
+	}
+
+	for i, c := range book.GetConversations() {
+		b.Conversations[i] = &Conversation{
+			PublicKey:   c.PublicKey,
+			DisplayName: c.DisplayName,
+			Type:        c.Type,
+			Link:        c.Link,
+		}
+	}
+
+	return b
+}
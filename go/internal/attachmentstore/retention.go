@@ -0,0 +1,301 @@
+package attachmentstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// RetentionDatastoreKey is the key of the account retention configuration in
+// the root datastore.
+const RetentionDatastoreKey = "attachment_retention_config"
+
+var retentionKey = datastore.NewKey("retention")
+
+type RetentionMode string
+
+const (
+	// RetentionForever keeps the sent attachments until their interactions
+	// are deleted, it is the default.
+	RetentionForever RetentionMode = "forever"
+	// RetentionDays keeps them for a number of days after they are sent.
+	RetentionDays RetentionMode = "days"
+	// RetentionUntilAcked keeps them until every other member of the
+	// conversation acknowledged the interaction.
+	RetentionUntilAcked RetentionMode = "until-acked"
+)
+
+// Retention is the policy deciding how long a sent attachment is kept
+// locally, the zero value is RetentionForever.
+type Retention struct {
+	Mode RetentionMode `json:"mode,omitempty"`
+	// Days is the number of days to keep the attachment with RetentionDays.
+	Days int `json:"days,omitempty"`
+}
+
+// ParseRetention reads a policy written as `forever`, `until-acked` or a
+// number of days, e.g. `30d`.
+func ParseRetention(value string) (Retention, error) {
+	switch value = strings.TrimSpace(value); value {
+	case "", string(RetentionForever):
+		return Retention{Mode: RetentionForever}, nil
+	case string(RetentionUntilAcked):
+		return Retention{Mode: RetentionUntilAcked}, nil
+	}
+
+	days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+	if err != nil || !strings.HasSuffix(value, "d") {
+		return Retention{}, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid retention %q, expected forever, until-acked or a number of days, e.g. 30d", value))
+	}
+
+	r := Retention{Mode: RetentionDays, Days: days}
+	return r, r.Validate()
+}
+
+func (r Retention) Validate() error {
+	switch r.Mode {
+	case "", RetentionForever, RetentionUntilAcked:
+		return nil
+	case RetentionDays:
+		if r.Days <= 0 {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the number of days must be positive, got %d", r.Days))
+		}
+		return nil
+	default:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown retention mode %q", r.Mode))
+	}
+}
+
+func (r Retention) String() string {
+	switch r.Mode {
+	case "":
+		return string(RetentionForever)
+	case RetentionDays:
+		return fmt.Sprintf("%dd", r.Days)
+	default:
+		return string(r.Mode)
+	}
+}
+
+func (r Retention) forever() bool {
+	return r.Mode == "" || r.Mode == RetentionForever
+}
+
+// RetentionConfig is the per-account configuration.
+type RetentionConfig struct {
+	// Default applies to the attachments sent without a policy of their
+	// own.
+	Default Retention `json:"default,omitempty"`
+}
+
+// LoadRetentionConfig reads the account configuration, a default one is
+// returned if none was saved.
+func LoadRetentionConfig(ctx context.Context, ds datastore.Datastore) (RetentionConfig, error) {
+	var config RetentionConfig
+
+	data, err := ds.Get(ctx, datastore.NewKey(RetentionDatastoreKey))
+	switch err {
+	case nil:
+	case datastore.ErrNotFound:
+		return config, nil
+	default:
+		return config, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return config, nil
+}
+
+// SaveRetentionConfig persists the account configuration.
+func SaveRetentionConfig(ctx context.Context, ds datastore.Datastore, config RetentionConfig) error {
+	if err := config.Default.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := ds.Put(ctx, datastore.NewKey(RetentionDatastoreKey), data); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// retentionRecord is stored under `/retention/<interaction>` for the sent
+// attachments which are not kept forever.
+type retentionRecord struct {
+	Retention Retention `json:"retention"`
+	SentAt    time.Time `json:"sent_at"`
+	// Acked are the members which acknowledged the interaction.
+	Acked []string `json:"acked,omitempty"`
+}
+
+// SetRetention applies r to the attachments referenced by a sent
+// interaction.
+func (s *Store) SetRetention(ctx context.Context, interactionCID string, r Retention, sentAt time.Time) error {
+	if interactionCID == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.forever() {
+		if err := s.ds.Delete(ctx, retentionKey.ChildString(interactionCID)); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+		return nil
+	}
+
+	return s.putRetention(ctx, interactionCID, &retentionRecord{Retention: r, SentAt: sentAt})
+}
+
+// Acknowledge records that a member acknowledged the interaction, for the
+// attachments kept until every recipient did.
+func (s *Store) Acknowledge(ctx context.Context, interactionCID string, memberPK string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.getRetention(ctx, interactionCID)
+	if err != nil || record == nil || record.Retention.Mode != RetentionUntilAcked {
+		return err
+	}
+
+	for _, acked := range record.Acked {
+		if acked == memberPK {
+			return nil
+		}
+	}
+
+	record.Acked = append(record.Acked, memberPK)
+	return s.putRetention(ctx, interactionCID, record)
+}
+
+// RecipientsFunc returns the members an interaction was sent to, the
+// account excluded. An errcode.ErrNotFound error means the interaction is
+// unknown yet, its attachments are kept.
+type RecipientsFunc func(interactionCID string) ([]string, error)
+
+// Enforce releases the references of the sent interactions whose retention
+// is over, as Release, and returns the removed blobs.
+func (s *Store) Enforce(ctx context.Context, now time.Time, recipients RecipientsFunc) ([]cid.Cid, error) {
+	expired, err := s.expired(ctx, now, recipients)
+	if err != nil || len(expired) == 0 {
+		return nil, err
+	}
+
+	return s.Release(ctx, expired...)
+}
+
+func (s *Store) expired(ctx context.Context, now time.Time, recipients RecipientsFunc) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.listKeys(ctx, retentionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := []string(nil)
+	for _, key := range keys {
+		interactionCID := key.Name()
+		record, err := s.getRetention(ctx, interactionCID)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			continue
+		}
+
+		switch record.Retention.Mode {
+		case RetentionDays:
+			if now.Before(record.SentAt.AddDate(0, 0, record.Retention.Days)) {
+				continue
+			}
+
+		case RetentionUntilAcked:
+			members, err := recipients(interactionCID)
+			switch {
+			case errcode.Is(err, errcode.ErrNotFound):
+				continue
+			case err != nil:
+				return nil, err
+			}
+
+			if len(members) == 0 || !ackedByAll(record.Acked, members) {
+				continue
+			}
+
+		default:
+			continue
+		}
+
+		expired = append(expired, interactionCID)
+	}
+
+	return expired, nil
+}
+
+func ackedByAll(acked []string, members []string) bool {
+	set := make(map[string]struct{}, len(acked))
+	for _, pk := range acked {
+		set[pk] = struct{}{}
+	}
+
+	for _, pk := range members {
+		if _, ok := set[pk]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Store) getRetention(ctx context.Context, interactionCID string) (*retentionRecord, error) {
+	data, err := s.ds.Get(ctx, retentionKey.ChildString(interactionCID))
+	switch err {
+	case nil:
+	case datastore.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	record := &retentionRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return record, nil
+}
+
+func (s *Store) putRetention(ctx context.Context, interactionCID string, record *retentionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := s.ds.Put(ctx, retentionKey.ChildString(interactionCID), data); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,345 @@
+// Package attachmentstore stores the attachments of an account once, keyed
+// by their content hash, whatever the number of conversations they are sent
+// to. Each blob is reference counted by the interactions using it and is
+// removed once the last of them is pruned.
+package attachmentstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/multiformats/go-multicodec"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Namespace is the key prefix used in the account root datastore.
+const Namespace = "attachments"
+
+var (
+	blobsKey        = datastore.NewKey("blobs")
+	refsKey         = datastore.NewKey("refs")
+	interactionsKey = datastore.NewKey("interactions")
+
+	cidBuilder = cid.V1Builder{Codec: cid.Raw, MhType: uint64(multicodec.Sha2_256)}
+)
+
+// Store is a content-addressed attachment store.
+//
+// Blobs are stored under `/blobs/<cid>`, each reference is indexed both as
+// `/refs/<cid>/<interaction>` and `/interactions/<interaction>/<cid>` so
+// references can be counted and released from both sides. The retention of
+// the sent interactions is stored under `/retention/<interaction>`.
+type Store struct {
+	ds datastore.Batching
+	mu sync.Mutex
+}
+
+func New(ds datastore.Batching) *Store {
+	return &Store{ds: namespace.Wrap(ds, datastore.NewKey(Namespace))}
+}
+
+// ContentID returns the identifier data is stored under.
+func ContentID(data []byte) (cid.Cid, error) {
+	c, err := cidBuilder.Sum(data)
+	if err != nil {
+		return cid.Undef, errcode.ErrSerialization.Wrap(err)
+	}
+
+	return c, nil
+}
+
+// Put stores data, unless an identical blob is already stored, and
+// references it from the given interaction.
+func (s *Store) Put(ctx context.Context, interactionCID string, data []byte) (cid.Cid, error) {
+	c, err := ContentID(data)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	has, err := s.ds.Has(ctx, blobKey(c))
+	if err != nil {
+		return cid.Undef, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if !has {
+		if err := s.ds.Put(ctx, blobKey(c), data); err != nil {
+			return cid.Undef, errcode.ErrDBWrite.Wrap(err)
+		}
+	}
+
+	if err := s.addRef(ctx, interactionCID, c); err != nil {
+		return cid.Undef, err
+	}
+
+	return c, nil
+}
+
+// AddRef references an already stored blob from the given interaction, it
+// is used to forward an attachment without reading it back.
+func (s *Store) AddRef(ctx context.Context, interactionCID string, c cid.Cid) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	has, err := s.ds.Has(ctx, blobKey(c))
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	if !has {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown attachment %s", c))
+	}
+
+	return s.addRef(ctx, interactionCID, c)
+}
+
+func (s *Store) addRef(ctx context.Context, interactionCID string, c cid.Cid) error {
+	if interactionCID == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	b, err := s.ds.Batch(ctx)
+	if err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	if err := b.Put(ctx, refKey(c, interactionCID), nil); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	if err := b.Put(ctx, interactionKey(interactionCID, c), nil); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	if err := b.Commit(ctx); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// Get returns the content of a stored blob.
+func (s *Store) Get(ctx context.Context, c cid.Cid) ([]byte, error) {
+	data, err := s.ds.Get(ctx, blobKey(c))
+	switch err {
+	case nil:
+		return data, nil
+	case datastore.ErrNotFound:
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown attachment %s", c))
+	default:
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+}
+
+// List returns the blobs referenced by an interaction.
+func (s *Store) List(ctx context.Context, interactionCID string) ([]cid.Cid, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.listKeys(ctx, interactionsKey.ChildString(interactionCID))
+	if err != nil {
+		return nil, err
+	}
+
+	cids := make([]cid.Cid, 0, len(keys))
+	for _, key := range keys {
+		c, err := cid.Decode(key.Name())
+		if err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+		cids = append(cids, c)
+	}
+
+	return cids, nil
+}
+
+// Interactions returns the interactions referencing at least one blob.
+func (s *Store) Interactions(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.listKeys(ctx, interactionsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]struct{}{}
+	interactions := []string(nil)
+	for _, key := range keys {
+		// the keys are `/interactions/<interaction>/<cid>`
+		interactionCID := key.Parent().Name()
+		if _, ok := seen[interactionCID]; ok {
+			continue
+		}
+		seen[interactionCID] = struct{}{}
+		interactions = append(interactions, interactionCID)
+	}
+
+	return interactions, nil
+}
+
+// RefCount returns the number of interactions referencing a blob.
+func (s *Store) RefCount(ctx context.Context, c cid.Cid) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.listKeys(ctx, refsKey.ChildString(c.String()))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(keys), nil
+}
+
+// Release drops the references held by the given interactions, typically
+// when they are pruned, along with their retention, and removes the blobs
+// no longer referenced. The removed blobs are returned.
+func (s *Store) Release(ctx context.Context, interactionCIDs ...string) ([]cid.Cid, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	released := map[cid.Cid]struct{}{}
+	b, err := s.ds.Batch(ctx)
+	if err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	for _, interactionCID := range interactionCIDs {
+		if err := b.Delete(ctx, retentionKey.ChildString(interactionCID)); err != nil {
+			return nil, errcode.ErrDBWrite.Wrap(err)
+		}
+
+		keys, err := s.listKeys(ctx, interactionsKey.ChildString(interactionCID))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			c, err := cid.Decode(key.Name())
+			if err != nil {
+				return nil, errcode.ErrDeserialization.Wrap(err)
+			}
+
+			if err := b.Delete(ctx, key); err != nil {
+				return nil, errcode.ErrDBWrite.Wrap(err)
+			}
+
+			if err := b.Delete(ctx, refKey(c, interactionCID)); err != nil {
+				return nil, errcode.ErrDBWrite.Wrap(err)
+			}
+
+			released[c] = struct{}{}
+		}
+	}
+
+	if err := b.Commit(ctx); err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	removed := []cid.Cid(nil)
+	for c := range released {
+		refs, err := s.listKeys(ctx, refsKey.ChildString(c.String()))
+		if err != nil {
+			return removed, err
+		}
+
+		if len(refs) > 0 {
+			continue
+		}
+
+		if err := s.ds.Delete(ctx, blobKey(c)); err != nil {
+			return removed, errcode.ErrDBWrite.Wrap(err)
+		}
+
+		removed = append(removed, c)
+	}
+
+	return removed, nil
+}
+
+// Usage is the storage used by the attachments of a set of interactions.
+type Usage struct {
+	// Attachments is the number of distinct blobs referenced.
+	Attachments uint64 `json:"attachments"`
+	// Size is the size of these blobs, in bytes, a blob referenced by
+	// several interactions is counted once.
+	Size uint64 `json:"size"`
+}
+
+// Usage returns the storage used by the blobs referenced by the given
+// interactions.
+func (s *Store) Usage(ctx context.Context, interactionCIDs ...string) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := Usage{}
+	seen := map[cid.Cid]struct{}{}
+	for _, interactionCID := range interactionCIDs {
+		keys, err := s.listKeys(ctx, interactionsKey.ChildString(interactionCID))
+		if err != nil {
+			return usage, err
+		}
+
+		for _, key := range keys {
+			c, err := cid.Decode(key.Name())
+			if err != nil {
+				return usage, errcode.ErrDeserialization.Wrap(err)
+			}
+
+			if _, ok := seen[c]; ok {
+				continue
+			}
+			seen[c] = struct{}{}
+
+			size, err := s.ds.GetSize(ctx, blobKey(c))
+			if err != nil {
+				return usage, errcode.ErrDBRead.Wrap(err)
+			}
+
+			usage.Attachments++
+			usage.Size += uint64(size)
+		}
+	}
+
+	return usage, nil
+}
+
+func (s *Store) listKeys(ctx context.Context, prefix datastore.Key) ([]datastore.Key, error) {
+	results, err := s.ds.Query(ctx, query.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	defer results.Close()
+
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	keys := make([]datastore.Key, len(entries))
+	for i, entry := range entries {
+		keys[i] = datastore.NewKey(entry.Key)
+	}
+
+	return keys, nil
+}
+
+func blobKey(c cid.Cid) datastore.Key {
+	return blobsKey.ChildString(c.String())
+}
+
+func refKey(c cid.Cid, interactionCID string) datastore.Key {
+	return refsKey.ChildString(c.String()).ChildString(interactionCID)
+}
+
+func interactionKey(interactionCID string, c cid.Cid) datastore.Key {
+	return interactionsKey.ChildString(interactionCID).ChildString(c.String())
+}
@@ -0,0 +1,277 @@
+package attachmentstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestStoreDeduplication(t *testing.T) {
+	ctx := context.Background()
+	store := New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	data := []byte("the same picture sent to two groups")
+	c1, err := store.Put(ctx, "interaction-1", data)
+	require.NoError(t, err)
+	c2, err := store.Put(ctx, "interaction-2", data)
+	require.NoError(t, err)
+	require.Equal(t, c1, c2)
+
+	other, err := store.Put(ctx, "interaction-2", []byte("another file"))
+	require.NoError(t, err)
+	require.NotEqual(t, c1, other)
+
+	listed, err := store.List(ctx, "interaction-2")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []cid.Cid{c1, other}, listed)
+
+	count, err := store.RefCount(ctx, c1)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// forward without re-reading the content
+	require.NoError(t, store.AddRef(ctx, "interaction-3", c1))
+
+	// pruning one message keeps the blob
+	removed, err := store.Release(ctx, "interaction-1")
+	require.NoError(t, err)
+	require.Empty(t, removed)
+
+	stored, err := store.Get(ctx, c1)
+	require.NoError(t, err)
+	require.Equal(t, data, stored)
+
+	// pruning the last messages removes it
+	removed, err = store.Release(ctx, "interaction-2", "interaction-3")
+	require.NoError(t, err)
+	require.ElementsMatch(t, removed, []cid.Cid{c1, other})
+
+	_, err = store.Get(ctx, c1)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	require.True(t, errcode.Is(store.AddRef(ctx, "interaction-4", c1), errcode.ErrNotFound))
+}
+
+func TestStoreUsage(t *testing.T) {
+	ctx := context.Background()
+	store := New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	picture := []byte("a picture")
+	_, err := store.Put(ctx, "interaction-1", picture)
+	require.NoError(t, err)
+	_, err = store.Put(ctx, "interaction-2", picture)
+	require.NoError(t, err)
+	_, err = store.Put(ctx, "interaction-2", []byte("a video"))
+	require.NoError(t, err)
+
+	// the picture is counted once
+	usage, err := store.Usage(ctx, "interaction-1", "interaction-2", "interaction-3")
+	require.NoError(t, err)
+	require.Equal(t, Usage{Attachments: 2, Size: uint64(len("a picture") + len("a video"))}, usage)
+
+	usage, err = store.Usage(ctx, "interaction-3")
+	require.NoError(t, err)
+	require.Zero(t, usage)
+}
+
+func TestStoreInteractions(t *testing.T) {
+	ctx := context.Background()
+	store := New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	interactions, err := store.Interactions(ctx)
+	require.NoError(t, err)
+	require.Empty(t, interactions)
+
+	_, err = store.Put(ctx, "interaction-1", []byte("a picture"))
+	require.NoError(t, err)
+	_, err = store.Put(ctx, "interaction-2", []byte("a picture"))
+	require.NoError(t, err)
+	_, err = store.Put(ctx, "interaction-2", []byte("a video"))
+	require.NoError(t, err)
+
+	interactions, err = store.Interactions(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"interaction-1", "interaction-2"}, interactions)
+
+	_, err = store.Release(ctx, "interaction-1")
+	require.NoError(t, err)
+
+	interactions, err = store.Interactions(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"interaction-2"}, interactions)
+}
+
+func TestStoreResumableUpload(t *testing.T) {
+	ctx := context.Background()
+	store := New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	data := []byte("a large video, uploaded in several chunks")
+	expected, err := ContentID(data)
+	require.NoError(t, err)
+
+	offset, err := store.WriteChunk(ctx, "upload-1", 0, data[:10])
+	require.NoError(t, err)
+	require.Equal(t, int64(10), offset)
+
+	// the connection dropped, the client asks where to resume from
+	offset, err = store.UploadOffset(ctx, "upload-1")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), offset)
+
+	// a chunk sent twice is rejected
+	_, err = store.WriteChunk(ctx, "upload-1", 0, data[:10])
+	require.True(t, errcode.Is(err, errcode.ErrInvalidRange))
+
+	offset, err = store.WriteChunk(ctx, "upload-1", offset, data[10:])
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), offset)
+
+	c, err := store.CompleteUpload(ctx, "upload-1", expected, "interaction-1")
+	require.NoError(t, err)
+	require.Equal(t, expected, c)
+
+	count, err := store.RefCount(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	offset, err = store.UploadOffset(ctx, "upload-1")
+	require.NoError(t, err)
+	require.Zero(t, offset)
+
+	// download
+	size, err := store.Size(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), size)
+
+	chunk, err := store.ReadAt(ctx, c, 10, 5)
+	require.NoError(t, err)
+	require.Equal(t, data[10:15], chunk)
+
+	chunk, err = store.ReadAt(ctx, c, size, 5)
+	require.NoError(t, err)
+	require.Empty(t, chunk)
+
+	require.NoError(t, Verify(c, data))
+	require.True(t, errcode.Is(Verify(c, data[1:]), errcode.ErrInvalidInput))
+}
+
+func TestStoreUploadChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	store := New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	expected, err := ContentID([]byte("the original"))
+	require.NoError(t, err)
+
+	_, err = store.WriteChunk(ctx, "upload-1", 0, []byte("a corrupted copy"))
+	require.NoError(t, err)
+
+	_, err = store.CompleteUpload(ctx, "upload-1", expected, "")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	// the upload must be started again
+	offset, err := store.UploadOffset(ctx, "upload-1")
+	require.NoError(t, err)
+	require.Zero(t, offset)
+
+	_, err = store.CompleteUpload(ctx, "upload-1", cid.Undef, "")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	_, err = store.UploadOffset(ctx, "")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
+
+func TestStoreRetention(t *testing.T) {
+	ctx := context.Background()
+	store := New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+	sentAt := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	forever, err := store.Put(ctx, "interaction-1", []byte("kept forever"))
+	require.NoError(t, err)
+	require.NoError(t, store.SetRetention(ctx, "interaction-1", Retention{}, sentAt))
+
+	week, err := store.Put(ctx, "interaction-2", []byte("kept a week"))
+	require.NoError(t, err)
+	require.NoError(t, store.SetRetention(ctx, "interaction-2", Retention{Mode: RetentionDays, Days: 7}, sentAt))
+
+	acked, err := store.Put(ctx, "interaction-3", []byte("kept until acked"))
+	require.NoError(t, err)
+	require.NoError(t, store.SetRetention(ctx, "interaction-3", Retention{Mode: RetentionUntilAcked}, sentAt))
+
+	// not sent yet
+	_, err = store.Put(ctx, "interaction-4", []byte("kept until acked"))
+	require.NoError(t, err)
+	require.NoError(t, store.SetRetention(ctx, "interaction-4", Retention{Mode: RetentionUntilAcked}, sentAt))
+
+	recipients := func(interactionCID string) ([]string, error) {
+		if interactionCID == "interaction-4" {
+			return nil, errcode.ErrNotFound
+		}
+		return []string{"alice", "bob"}, nil
+	}
+
+	require.NoError(t, store.Acknowledge(ctx, "interaction-3", "alice"))
+	require.NoError(t, store.Acknowledge(ctx, "interaction-3", "alice"))
+	require.NoError(t, store.Acknowledge(ctx, "interaction-1", "alice"))
+
+	removed, err := store.Enforce(ctx, sentAt.Add(6*24*time.Hour), recipients)
+	require.NoError(t, err)
+	require.Empty(t, removed)
+
+	removed, err = store.Enforce(ctx, sentAt.Add(7*24*time.Hour), recipients)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{week}, removed)
+
+	require.NoError(t, store.Acknowledge(ctx, "interaction-3", "bob"))
+	removed, err = store.Enforce(ctx, sentAt.Add(7*24*time.Hour), recipients)
+	require.NoError(t, err)
+	// the blob is still referenced by interaction-4
+	require.Empty(t, removed)
+
+	listed, err := store.List(ctx, "interaction-3")
+	require.NoError(t, err)
+	require.Empty(t, listed)
+
+	count, err := store.RefCount(ctx, acked)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	_, err = store.Get(ctx, forever)
+	require.NoError(t, err)
+
+	// deleting the interaction drops its retention
+	_, err = store.Release(ctx, "interaction-4")
+	require.NoError(t, err)
+	expired, err := store.expired(ctx, sentAt.Add(365*24*time.Hour), recipients)
+	require.NoError(t, err)
+	require.Empty(t, expired)
+
+	require.True(t, errcode.Is(store.SetRetention(ctx, "interaction-5", Retention{Mode: RetentionDays}, sentAt), errcode.ErrInvalidInput))
+}
+
+func TestParseRetention(t *testing.T) {
+	for value, expected := range map[string]Retention{
+		"":            {Mode: RetentionForever},
+		"forever":     {Mode: RetentionForever},
+		"until-acked": {Mode: RetentionUntilAcked},
+		"30d":         {Mode: RetentionDays, Days: 30},
+	} {
+		r, err := ParseRetention(value)
+		require.NoError(t, err, value)
+		require.Equal(t, expected, r, value)
+	}
+
+	for _, value := range []string{"30", "d", "0d", "-1d", "never"} {
+		_, err := ParseRetention(value)
+		require.True(t, errcode.Is(err, errcode.ErrInvalidInput), value)
+	}
+
+	require.Equal(t, "30d", Retention{Mode: RetentionDays, Days: 30}.String())
+	require.Equal(t, "forever", Retention{}.String())
+}
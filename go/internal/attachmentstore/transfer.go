@@ -0,0 +1,249 @@
+package attachmentstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// MaxChunkSize bounds the size of an uploaded or downloaded chunk.
+const MaxChunkSize = 1 << 20
+
+var uploadsKey = datastore.NewKey("uploads")
+
+// Verify returns an error if data is not the content identified by c, e.g.
+// once a download is complete.
+func Verify(c cid.Cid, data []byte) error {
+	actual, err := ContentID(data)
+	if err != nil {
+		return err
+	}
+
+	if !actual.Equals(c) {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("checksum mismatch, expected %s got %s", c, actual))
+	}
+
+	return nil
+}
+
+// UploadOffset returns the number of bytes received for an upload, where it
+// must be resumed from. It is zero for an unknown upload.
+func (s *Store) UploadOffset(ctx context.Context, uploadID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.uploadOffset(ctx, uploadID)
+}
+
+func (s *Store) uploadOffset(ctx context.Context, uploadID string) (int64, error) {
+	chunks, err := s.uploadChunks(ctx, uploadID, false)
+	if err != nil {
+		return 0, err
+	}
+
+	offset := int64(0)
+	for _, chunk := range chunks {
+		size := chunk.Size
+		if size < 0 {
+			// not listed by every datastore
+			if size, err = s.ds.GetSize(ctx, datastore.NewKey(chunk.Key)); err != nil {
+				return 0, errcode.ErrDBRead.Wrap(err)
+			}
+		}
+		offset += int64(size)
+	}
+
+	return offset, nil
+}
+
+// WriteChunk appends data to an upload, offset must be the number of bytes
+// already received for it. The chunks are kept until the upload is
+// completed or aborted, so that it survives a connection drop. The new
+// offset is returned.
+func (s *Store) WriteChunk(ctx context.Context, uploadID string, offset int64, data []byte) (int64, error) {
+	if len(data) > MaxChunkSize {
+		return 0, errcode.ErrInvalidInput.Wrap(fmt.Errorf("chunk of %d bytes, the maximum is %d", len(data), MaxChunkSize))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.uploadOffset(ctx, uploadID)
+	if err != nil {
+		return 0, err
+	}
+
+	if offset != current {
+		return current, errcode.ErrInvalidRange.Wrap(fmt.Errorf("chunk at offset %d, the upload must be resumed from %d", offset, current))
+	}
+
+	if len(data) == 0 {
+		return current, nil
+	}
+
+	if err := s.ds.Put(ctx, uploadChunkKey(uploadID, offset), data); err != nil {
+		return current, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return current + int64(len(data)), nil
+}
+
+// CompleteUpload stores the content received for an upload, once checked
+// against expected if it is defined, and drops its chunks. The blob is
+// referenced from interactionCID if set, otherwise it must be referenced
+// with AddRef once sent.
+func (s *Store) CompleteUpload(ctx context.Context, uploadID string, expected cid.Cid, interactionCID string) (cid.Cid, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chunks, err := s.uploadChunks(ctx, uploadID, true)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	if len(chunks) == 0 {
+		return cid.Undef, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown upload %s", uploadID))
+	}
+
+	buf := bytes.Buffer{}
+	for _, chunk := range chunks {
+		buf.Write(chunk.Value)
+	}
+	data := buf.Bytes()
+
+	c, err := ContentID(data)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	if expected.Defined() && !expected.Equals(c) {
+		// the content is corrupted, resuming cannot fix it
+		if err := s.abortUpload(ctx, chunks); err != nil {
+			return cid.Undef, err
+		}
+		return cid.Undef, errcode.ErrInvalidInput.Wrap(fmt.Errorf("checksum mismatch, expected %s got %s", expected, c))
+	}
+
+	if err := s.ds.Put(ctx, blobKey(c), data); err != nil {
+		return cid.Undef, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	if interactionCID != "" {
+		if err := s.addRef(ctx, interactionCID, c); err != nil {
+			return cid.Undef, err
+		}
+	}
+
+	if err := s.abortUpload(ctx, chunks); err != nil {
+		return cid.Undef, err
+	}
+
+	return c, nil
+}
+
+// AbortUpload drops the chunks received for an upload.
+func (s *Store) AbortUpload(ctx context.Context, uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chunks, err := s.uploadChunks(ctx, uploadID, false)
+	if err != nil {
+		return err
+	}
+
+	return s.abortUpload(ctx, chunks)
+}
+
+func (s *Store) abortUpload(ctx context.Context, chunks []query.Entry) error {
+	b, err := s.ds.Batch(ctx)
+	if err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	for _, chunk := range chunks {
+		if err := b.Delete(ctx, datastore.NewKey(chunk.Key)); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+	}
+
+	if err := b.Commit(ctx); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// uploadChunks returns the chunks of an upload ordered by offset, with
+// their content if withValues is set.
+func (s *Store) uploadChunks(ctx context.Context, uploadID string, withValues bool) ([]query.Entry, error) {
+	if uploadID == "" || strings.Contains(uploadID, "/") {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid upload id %q", uploadID))
+	}
+
+	results, err := s.ds.Query(ctx, query.Query{
+		Prefix:       uploadsKey.ChildString(uploadID).String(),
+		KeysOnly:     !withValues,
+		ReturnsSizes: true,
+		Orders:       []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	defer results.Close()
+
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return entries, nil
+}
+
+// Size returns the size of a stored blob.
+func (s *Store) Size(ctx context.Context, c cid.Cid) (int64, error) {
+	size, err := s.ds.GetSize(ctx, blobKey(c))
+	switch err {
+	case nil:
+		return int64(size), nil
+	case datastore.ErrNotFound:
+		return 0, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown attachment %s", c))
+	default:
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+}
+
+// ReadAt returns up to length bytes of a stored blob from offset, it is
+// empty at the end of the blob.
+func (s *Store) ReadAt(ctx context.Context, c cid.Cid, offset int64, length int) ([]byte, error) {
+	if offset < 0 || length <= 0 || length > MaxChunkSize {
+		return nil, errcode.ErrInvalidRange.Wrap(fmt.Errorf("invalid range of %d bytes at %d", length, offset))
+	}
+
+	data, err := s.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > int64(len(data)) {
+		return nil, errcode.ErrInvalidRange.Wrap(fmt.Errorf("offset %d past the end of the %d bytes attachment", offset, len(data)))
+	}
+
+	end := offset + int64(length)
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+
+	return data[offset:end], nil
+}
+
+// uploadChunkKey orders the chunks of an upload by offset.
+func uploadChunkKey(uploadID string, offset int64) datastore.Key {
+	return uploadsKey.ChildString(uploadID).ChildString(fmt.Sprintf("%020d", offset))
+}
@@ -0,0 +1,311 @@
+// Package auditlog records the security-relevant events of an account in an
+// append-only local log.
+//
+// Entries are stored in the account datastore and chained with a hash of the
+// previous entry, so that a removed or modified entry is detected by Verify.
+// Nothing recorded by this package ever leaves the device.
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	EventAccountOpened   = "account_opened"
+	EventDeviceLinked    = "device_linked"
+	EventDeviceRevoked   = "device_revoked"
+	EventContactAccepted = "contact_accepted"
+	EventKeyRotated      = "key_rotated"
+	EventBackupExported  = "backup_exported"
+
+	// The key escrow of a conversation, see keyescrow.
+	EventKeyEscrowEnabled  = "key_escrow_enabled"
+	EventKeyEscrowDisabled = "key_escrow_disabled"
+	EventKeyEscrowExported = "key_escrow_exported"
+
+	// The migration of a group to another account, see groupmigration.
+	EventGroupExported = "group_exported"
+	EventGroupImported = "group_imported"
+
+	// DatastorePrefix is the datastore namespace of the entries.
+	DatastorePrefix = "/audit_log"
+)
+
+// Entry is a recorded event. Hash covers the other fields, including the
+// hash of the previous entry.
+type Entry struct {
+	Seq      uint64            `json:"seq"`
+	Time     time.Time         `json:"time"`
+	Event    string            `json:"event"`
+	Details  map[string]string `json:"details,omitempty"`
+	PrevHash string            `json:"prevHash,omitempty"`
+	Hash     string            `json:"hash"`
+}
+
+func (e *Entry) computeHash() (string, error) {
+	unhashed := *e
+	unhashed.Hash = ""
+
+	raw, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", errcode.ErrSerialization.Wrap(err)
+	}
+
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func entryKey(seq uint64) datastore.Key {
+	// zero padded for the entries to be listed in order
+	return datastore.NewKey(DatastorePrefix).ChildString(fmt.Sprintf("%020d", seq))
+}
+
+// Log appends entries to the audit log of an account. A nil Log is valid and
+// discards everything.
+type Log struct {
+	ds       datastore.Datastore
+	mu       sync.Mutex
+	lastSeq  uint64
+	lastHash string
+}
+
+// Open resumes the log stored in ds after its last entry.
+func Open(ctx context.Context, ds datastore.Datastore) (*Log, error) {
+	if ds == nil {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("missing datastore"))
+	}
+
+	l := &Log{ds: ds}
+
+	res, err := ds.Query(ctx, query.Query{
+		Prefix: DatastorePrefix,
+		Orders: []query.Order{query.OrderByKeyDescending{}},
+		Limit:  1,
+	})
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, errcode.ErrDBRead.Wrap(r.Error)
+		}
+
+		entry := &Entry{}
+		if err := json.Unmarshal(r.Value, entry); err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+		l.lastSeq, l.lastHash = entry.Seq, entry.Hash
+	}
+
+	return l, nil
+}
+
+// Append records event with its optional details.
+func (l *Log) Append(ctx context.Context, event string, details map[string]string) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := &Entry{
+		Seq:      l.lastSeq + 1,
+		Time:     time.Now().UTC(),
+		Event:    event,
+		Details:  details,
+		PrevHash: l.lastHash,
+	}
+
+	hash, err := entry.computeHash()
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := l.ds.Put(ctx, entryKey(entry.Seq), raw); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	l.lastSeq, l.lastHash = entry.Seq, entry.Hash
+	return nil
+}
+
+// List returns the entries of the log selected by filter, see List.
+func (l *Log) List(ctx context.Context, filter Filter) ([]*Entry, error) {
+	if l == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("no audit log"))
+	}
+
+	return List(ctx, l.ds, filter)
+}
+
+// Verify checks the chaining of the entries of the log, see Verify.
+func (l *Log) Verify(ctx context.Context) error {
+	if l == nil {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("no audit log"))
+	}
+
+	return Verify(ctx, l.ds)
+}
+
+// Filter selects entries, its zero value selects all of them.
+type Filter struct {
+	// Event selects a single kind of event if set.
+	Event string
+	Since time.Time
+	Until time.Time
+	// Limit keeps the last entries if positive.
+	Limit int
+}
+
+func (f *Filter) match(e *Entry) bool {
+	switch {
+	case f.Event != "" && e.Event != f.Event:
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// List returns the entries of the log stored in ds selected by filter, in
+// the order they were appended.
+func List(ctx context.Context, ds datastore.Datastore, filter Filter) ([]*Entry, error) {
+	entries := []*Entry{}
+	err := walk(ctx, ds, func(e *Entry) error {
+		if filter.match(e) {
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+
+	return entries, nil
+}
+
+// Verify checks that the entries of the log stored in ds are chained, the
+// error names the first modified or missing entry. Removing the last entries
+// cannot be detected.
+func Verify(ctx context.Context, ds datastore.Datastore) error {
+	var prev *Entry
+	return walk(ctx, ds, func(e *Entry) error {
+		hash, err := e.computeHash()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case hash != e.Hash:
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("audit log entry %d was modified", e.Seq))
+		case prev == nil && e.Seq != 1, prev != nil && e.Seq != prev.Seq+1:
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("audit log entries before %d are missing", e.Seq))
+		case prev != nil && e.PrevHash != prev.Hash:
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("audit log entry %d does not follow entry %d", e.Seq, prev.Seq))
+		}
+
+		prev = e
+		return nil
+	})
+}
+
+func walk(ctx context.Context, ds datastore.Datastore, fn func(e *Entry) error) error {
+	if ds == nil {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("missing datastore"))
+	}
+
+	res, err := ds.Query(ctx, query.Query{
+		Prefix: DatastorePrefix,
+		Orders: []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return errcode.ErrDBRead.Wrap(r.Error)
+		}
+
+		entry := &Entry{}
+		if err := json.Unmarshal(r.Value, entry); err != nil {
+			return errcode.ErrDeserialization.Wrap(err)
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteJSON writes a human readable JSON export of entries to w.
+func WriteJSON(w io.Writer, entries []*Entry) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(entries); err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+	return nil
+}
+
+// WriteText writes entries as one line each, for terminals.
+func WriteText(w io.Writer, entries []*Entry) error {
+	buf := &bytes.Buffer{}
+	for _, e := range entries {
+		buf.WriteString(strconv.FormatUint(e.Seq, 10))
+		buf.WriteString("\t")
+		buf.WriteString(e.Time.Local().Format(time.RFC3339))
+		buf.WriteString("\t")
+		buf.WriteString(e.Event)
+		for _, k := range sortedKeys(e.Details) {
+			fmt.Fprintf(buf, " %s=%s", k, e.Details[k])
+		}
+		buf.WriteString("\n")
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,83 @@
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendList(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.NewMapDatastore()
+
+	var nilLog *Log
+	require.NoError(t, nilLog.Append(ctx, EventAccountOpened, nil))
+
+	l, err := Open(ctx, ds)
+	require.NoError(t, err)
+	require.NoError(t, l.Append(ctx, EventAccountOpened, nil))
+	require.NoError(t, l.Append(ctx, EventContactAccepted, map[string]string{"contact": "pk"}))
+
+	// the log is resumed after its last entry
+	l, err = Open(ctx, ds)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, l.Append(ctx, EventKeyRotated, nil))
+	}
+
+	entries, err := List(ctx, ds, Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 12)
+	for i, e := range entries {
+		require.Equal(t, uint64(i+1), e.Seq)
+	}
+	require.Equal(t, "pk", entries[1].Details["contact"])
+	require.NoError(t, Verify(ctx, ds))
+
+	entries, err = List(ctx, ds, Filter{Event: EventKeyRotated, Limit: 3})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, uint64(12), entries[2].Seq)
+
+	entries, err = List(ctx, ds, Filter{Since: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteText(buf, entries[:0]))
+	require.Empty(t, buf.String())
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.NewMapDatastore()
+
+	l, err := Open(ctx, ds)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Append(ctx, EventDeviceLinked, map[string]string{"device": "pk"}))
+	}
+	require.NoError(t, Verify(ctx, ds))
+
+	// modified entry
+	raw, err := ds.Get(ctx, entryKey(2))
+	require.NoError(t, err)
+	entry := &Entry{}
+	require.NoError(t, json.Unmarshal(raw, entry))
+	entry.Details["device"] = "other"
+	tampered, err := json.Marshal(entry)
+	require.NoError(t, err)
+	require.NoError(t, ds.Put(ctx, entryKey(2), tampered))
+	require.Error(t, Verify(ctx, ds))
+
+	// removed entry
+	require.NoError(t, ds.Put(ctx, entryKey(2), raw))
+	require.NoError(t, Verify(ctx, ds))
+	require.NoError(t, ds.Delete(ctx, entryKey(2)))
+	require.Error(t, Verify(ctx, ds))
+}
@@ -0,0 +1,353 @@
+// Package blockscrub verifies the blocks stored by the IPFS node against
+// their multihashes, to detect the corruption of the datastore before the
+// damaged blocks are served to the peers or fail a replication.
+package blockscrub
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	DefaultInterval     = time.Hour
+	DefaultSampleSize   = 100
+	DefaultFetchTimeout = time.Minute
+)
+
+// Blockstore is the subset of the IPFS blockstore used by the scrubber, it
+// must not verify the hashes itself on read.
+type Blockstore interface {
+	AllKeysChan(ctx context.Context) (<-chan cid.Cid, error)
+	Get(ctx context.Context, c cid.Cid) (blocks.Block, error)
+	Put(ctx context.Context, b blocks.Block) error
+	DeleteBlock(ctx context.Context, c cid.Cid) error
+}
+
+// Fetcher gets a block from the peers, e.g. bitswap.
+type Fetcher interface {
+	GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error)
+}
+
+type Opts struct {
+	Logger *zap.Logger
+	// Interval is the delay between two sampling rounds.
+	Interval time.Duration
+	// SampleSize is the number of blocks verified by a sampling round.
+	SampleSize int
+	// Fetcher is optional, the damaged blocks are fetched again from the
+	// peers when it is set, otherwise they are only flagged.
+	Fetcher      Fetcher
+	FetchTimeout time.Duration
+}
+
+func (opts *Opts) applyDefaults() {
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.SampleSize <= 0 {
+		opts.SampleSize = DefaultSampleSize
+	}
+	if opts.FetchTimeout <= 0 {
+		opts.FetchTimeout = DefaultFetchTimeout
+	}
+}
+
+// Stats are the results of one or several scrubs.
+type Stats struct {
+	Checked uint64
+	// Corrupted blocks have a content not matching their multihash.
+	Corrupted uint64
+	// Unreadable blocks are listed by the blockstore but cannot be read.
+	Unreadable uint64
+	// Repaired blocks were damaged and fetched again from the peers.
+	Repaired uint64
+	Duration time.Duration
+}
+
+func (s *Stats) add(other Stats) {
+	s.Checked += other.Checked
+	s.Corrupted += other.Corrupted
+	s.Unreadable += other.Unreadable
+	s.Repaired += other.Repaired
+	s.Duration += other.Duration
+}
+
+// Scrubber verifies a sample of the blocks periodically, see Run, and all of
+// them on demand, see FullScrub.
+type Scrubber struct {
+	bs   Blockstore
+	opts Opts
+
+	// scrubMu serializes the scrubs
+	scrubMu sync.Mutex
+
+	mu      sync.Mutex
+	total   Stats
+	damaged map[cid.Cid]struct{}
+}
+
+func New(bs Blockstore, opts Opts) *Scrubber {
+	opts.applyDefaults()
+
+	return &Scrubber{
+		bs:      bs,
+		opts:    opts,
+		damaged: map[cid.Cid]struct{}{},
+	}
+}
+
+// Run verifies a sample of the blocks every interval until ctx is done.
+func (s *Scrubber) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats, err := s.Sample(ctx, s.opts.SampleSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.opts.Logger.Warn("unable to scrub the blockstore", zap.Error(err))
+			}
+			continue
+		}
+
+		s.log("blockstore sample scrubbed", stats)
+	}
+}
+
+// Sample verifies n blocks picked at random.
+func (s *Scrubber) Sample(ctx context.Context, n int) (Stats, error) {
+	s.scrubMu.Lock()
+	defer s.scrubMu.Unlock()
+
+	keys, err := s.keys(ctx, n)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return s.scrub(ctx, keys), nil
+}
+
+// FullScrub verifies all the blocks, it can take a while on a large
+// blockstore.
+func (s *Scrubber) FullScrub(ctx context.Context) (Stats, error) {
+	s.scrubMu.Lock()
+	defer s.scrubMu.Unlock()
+
+	keys, err := s.keys(ctx, 0)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := s.scrub(ctx, keys)
+	if err := ctx.Err(); err != nil {
+		return stats, errcode.ErrInternal.Wrap(fmt.Errorf("the scrub was interrupted after %d blocks: %w", stats.Checked, err))
+	}
+
+	s.log("blockstore fully scrubbed", stats)
+
+	return stats, nil
+}
+
+// Total returns the stats of all the scrubs since the scrubber was created.
+func (s *Scrubber) Total() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.total
+}
+
+// Damaged returns the blocks found corrupted or unreadable and not repaired
+// since, sorted.
+func (s *Scrubber) Damaged() []cid.Cid {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	damaged := make([]cid.Cid, 0, len(s.damaged))
+	for c := range s.damaged {
+		damaged = append(damaged, c)
+	}
+	sort.Slice(damaged, func(i, j int) bool { return damaged[i].KeyString() < damaged[j].KeyString() })
+
+	return damaged
+}
+
+// keys lists all the blocks when n is 0, otherwise n of them picked at
+// random.
+func (s *Scrubber) keys(ctx context.Context, n int) ([]cid.Cid, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch, err := s.bs.AllKeysChan(ctx)
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	keys := []cid.Cid{}
+	seen := 0
+	for c := range ch {
+		seen++
+		switch {
+		case n <= 0 || len(keys) < n:
+			keys = append(keys, c)
+		default:
+			// reservoir sampling, each block has the same chance to be picked
+			if i := rand.Intn(seen); i < n { // nolint:gosec // the sample does not need to be unpredictable
+				keys[i] = c
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return keys, nil
+}
+
+func (s *Scrubber) scrub(ctx context.Context, keys []cid.Cid) Stats {
+	start := time.Now()
+	stats := Stats{}
+
+	for _, c := range keys {
+		if ctx.Err() != nil {
+			break
+		}
+
+		blk, err := s.bs.Get(ctx, c)
+		if ipld.IsNotFound(err) {
+			// removed since it was listed
+			continue
+		}
+
+		if err != nil {
+			stats.Checked++
+			stats.Unreadable++
+			s.opts.Logger.Error("unable to read a block", zap.Stringer("cid", c), zap.Error(err))
+		} else {
+			valid, err := verify(c, blk.RawData())
+			if err != nil {
+				s.opts.Logger.Debug("unable to verify a block", zap.Stringer("cid", c), zap.Error(err))
+				continue
+			}
+
+			stats.Checked++
+			if valid {
+				s.setDamaged(c, false)
+				continue
+			}
+
+			stats.Corrupted++
+			s.opts.Logger.Error("corrupted block, its content does not match its hash", zap.Stringer("cid", c))
+		}
+
+		if s.repair(ctx, c) {
+			stats.Repaired++
+			s.setDamaged(c, false)
+		} else {
+			s.setDamaged(c, true)
+		}
+	}
+
+	stats.Duration = time.Since(start)
+
+	s.mu.Lock()
+	s.total.add(stats)
+	s.mu.Unlock()
+
+	return stats
+}
+
+// repair replaces a damaged block by the one of a peer, it returns false if
+// there is no fetcher or if no valid block was received.
+func (s *Scrubber) repair(ctx context.Context, c cid.Cid) bool {
+	if s.opts.Fetcher == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.opts.FetchTimeout)
+	defer cancel()
+
+	// the blockstore ignores the blocks it already has
+	if err := s.bs.DeleteBlock(ctx, c); err != nil {
+		s.opts.Logger.Error("unable to remove a damaged block", zap.Stringer("cid", c), zap.Error(err))
+		return false
+	}
+
+	blk, err := s.opts.Fetcher.GetBlock(ctx, c)
+	if err != nil {
+		s.opts.Logger.Warn("unable to fetch a damaged block from the peers", zap.Stringer("cid", c), zap.Error(err))
+		return false
+	}
+
+	if valid, err := verify(c, blk.RawData()); err != nil || !valid {
+		s.opts.Logger.Warn("the block fetched from the peers is corrupted too", zap.Stringer("cid", c))
+		return false
+	}
+
+	if err := s.bs.Put(ctx, blk); err != nil {
+		s.opts.Logger.Error("unable to store a repaired block", zap.Stringer("cid", c), zap.Error(err))
+		return false
+	}
+
+	s.opts.Logger.Info("damaged block fetched again from the peers", zap.Stringer("cid", c))
+
+	return true
+}
+
+func (s *Scrubber) setDamaged(c cid.Cid, damaged bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if damaged {
+		s.damaged[c] = struct{}{}
+	} else {
+		delete(s.damaged, c)
+	}
+}
+
+func (s *Scrubber) log(msg string, stats Stats) {
+	fields := []zap.Field{
+		zap.Uint64("checked", stats.Checked),
+		zap.Uint64("corrupted", stats.Corrupted),
+		zap.Uint64("unreadable", stats.Unreadable),
+		zap.Uint64("repaired", stats.Repaired),
+		zap.Duration("duration", stats.Duration),
+	}
+
+	if stats.Corrupted+stats.Unreadable > stats.Repaired {
+		s.opts.Logger.Warn(msg, fields...)
+	} else {
+		s.opts.Logger.Debug(msg, fields...)
+	}
+}
+
+// verify returns true if data matches the multihash of c, it fails if the
+// hash function is not supported.
+func verify(c cid.Cid, data []byte) (bool, error) {
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return false, errcode.ErrNotImplemented.Wrap(err)
+	}
+
+	return sum.Equals(c), nil
+}
@@ -0,0 +1,208 @@
+package blockscrub
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// memBlockstore stores the raw data of the blocks, without verifying them.
+type memBlockstore struct {
+	mu   sync.Mutex
+	data map[cid.Cid][]byte
+}
+
+func newMemBlockstore() *memBlockstore {
+	return &memBlockstore{data: map[cid.Cid][]byte{}}
+}
+
+func (bs *memBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	bs.mu.Lock()
+	keys := make([]cid.Cid, 0, len(bs.data))
+	for c := range bs.data {
+		keys = append(keys, c)
+	}
+	bs.mu.Unlock()
+
+	ch := make(chan cid.Cid, len(keys))
+	for _, c := range keys {
+		ch <- c
+	}
+	close(ch)
+
+	return ch, nil
+}
+
+func (bs *memBlockstore) Get(_ context.Context, c cid.Cid) (blocks.Block, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	data, ok := bs.data[c]
+	if !ok {
+		return nil, ipld.ErrNotFound{Cid: c}
+	}
+
+	return blocks.NewBlockWithCid(data, c)
+}
+
+func (bs *memBlockstore) Put(_ context.Context, b blocks.Block) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if _, ok := bs.data[b.Cid()]; !ok {
+		bs.data[b.Cid()] = b.RawData()
+	}
+	return nil
+}
+
+func (bs *memBlockstore) DeleteBlock(_ context.Context, c cid.Cid) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	delete(bs.data, c)
+	return nil
+}
+
+func (bs *memBlockstore) corrupt(c cid.Cid) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	bs.data[c] = append([]byte("corrupted "), bs.data[c]...)
+}
+
+type fetcherFunc func(ctx context.Context, c cid.Cid) (blocks.Block, error)
+
+func (f fetcherFunc) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return f(ctx, c)
+}
+
+func fill(t *testing.T, bs *memBlockstore, n int) []blocks.Block {
+	t.Helper()
+
+	blks := []blocks.Block{}
+	for i := 0; i < n; i++ {
+		blk := blocks.NewBlock([]byte(fmt.Sprintf("block %d", i)))
+		require.NoError(t, bs.Put(context.Background(), blk))
+		blks = append(blks, blk)
+	}
+
+	return blks
+}
+
+func TestFullScrub(t *testing.T) {
+	ctx := context.Background()
+	bs := newMemBlockstore()
+	blks := fill(t, bs, 10)
+	bs.corrupt(blks[3].Cid())
+
+	s := New(bs, Opts{})
+
+	stats, err := s.FullScrub(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), stats.Checked)
+	require.Equal(t, uint64(1), stats.Corrupted)
+	require.Zero(t, stats.Repaired)
+	require.Equal(t, []cid.Cid{blks[3].Cid()}, s.Damaged())
+
+	// without a fetcher the damaged block is kept
+	_, err = bs.Get(ctx, blks[3].Cid())
+	require.NoError(t, err)
+}
+
+func TestFullScrubRepair(t *testing.T) {
+	ctx := context.Background()
+	bs := newMemBlockstore()
+	blks := fill(t, bs, 10)
+	bs.corrupt(blks[3].Cid())
+	bs.corrupt(blks[5].Cid())
+
+	fetcher := fetcherFunc(func(_ context.Context, c cid.Cid) (blocks.Block, error) {
+		if c.Equals(blks[5].Cid()) {
+			return nil, fmt.Errorf("no provider")
+		}
+		return blks[3], nil
+	})
+
+	s := New(bs, Opts{Fetcher: fetcher})
+
+	stats, err := s.FullScrub(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), stats.Corrupted)
+	require.Equal(t, uint64(1), stats.Repaired)
+	require.Equal(t, []cid.Cid{blks[5].Cid()}, s.Damaged())
+
+	blk, err := bs.Get(ctx, blks[3].Cid())
+	require.NoError(t, err)
+	require.Equal(t, blks[3].RawData(), blk.RawData())
+}
+
+func TestSample(t *testing.T) {
+	bs := newMemBlockstore()
+	fill(t, bs, 50)
+
+	s := New(bs, Opts{})
+
+	stats, err := s.Sample(context.Background(), 20)
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), stats.Checked)
+	require.Zero(t, stats.Corrupted)
+
+	_, err = s.Sample(context.Background(), 20)
+	require.NoError(t, err)
+	require.Equal(t, uint64(40), s.Total().Checked)
+}
+
+func TestFullScrubRPC(t *testing.T) {
+	ctx := context.Background()
+	bs := newMemBlockstore()
+	blks := fill(t, bs, 5)
+	bs.corrupt(blks[0].Cid())
+
+	l := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	Register(server, New(bs, Opts{}))
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.Dial("buf",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	report, err := FullScrub(ctx, cc)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), report.Scrub.Checked)
+	require.Equal(t, uint64(1), report.Total.Corrupted)
+	require.Equal(t, []string{blks[0].Cid().String()}, report.Damaged)
+}
+
+func TestFullScrubRPCUnimplemented(t *testing.T) {
+	l := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.Dial("buf",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	_, err = FullScrub(context.Background(), cc)
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+}
@@ -0,0 +1,65 @@
+package blockscrub
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"berty.tech/berty/v2/go/pkg/blockscrubtypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// FullScrub asks the node served by cc to verify all its blocks, the call
+// lasts until the scrub is done.
+func FullScrub(ctx context.Context, cc grpc.ClientConnInterface) (*blockscrubtypes.FullScrub_Reply, error) {
+	reply, err := blockscrubtypes.NewBlockScrubServiceClient(cc).FullScrub(ctx, &blockscrubtypes.FullScrub_Request{})
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("the node has no blockstore scrubber: %w", err))
+		}
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+// Register adds the scrub service of s to server.
+func Register(server *grpc.Server, s *Scrubber) {
+	blockscrubtypes.RegisterBlockScrubServiceServer(server, &scrubServer{scrubber: s})
+}
+
+type scrubServer struct {
+	blockscrubtypes.UnimplementedBlockScrubServiceServer
+
+	scrubber *Scrubber
+}
+
+func (s *scrubServer) FullScrub(ctx context.Context, _ *blockscrubtypes.FullScrub_Request) (*blockscrubtypes.FullScrub_Reply, error) {
+	stats, err := s.scrubber.FullScrub(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &blockscrubtypes.FullScrub_Reply{
+		Scrub: stats.toProto(),
+		Total: s.scrubber.Total().toProto(),
+	}
+	for _, c := range s.scrubber.Damaged() {
+		reply.Damaged = append(reply.Damaged, c.String())
+	}
+
+	return reply, nil
+}
+
+func (s Stats) toProto() blockscrubtypes.ScrubStats {
+	return blockscrubtypes.ScrubStats{
+		Checked:    s.Checked,
+		Corrupted:  s.Corrupted,
+		Unreadable: s.Unreadable,
+		Repaired:   s.Repaired,
+		Duration:   s.Duration,
+	}
+}
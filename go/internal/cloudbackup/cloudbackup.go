@@ -0,0 +1,142 @@
+// Package cloudbackup uploads encrypted snapshots of the account export to a
+// remote storage, and lists and downloads them back for a restore.
+//
+// A snapshot is a directory of the target holding the export cut in chunks,
+// each one sealed with a key derived from the backup passphrase, and a
+// manifest written last: a directory without manifest is an upload which
+// did not complete, it is resumed by the next backup.
+package cloudbackup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// ConfigDatastoreKey is the key of the account backup configuration in the
+// root datastore.
+const ConfigDatastoreKey = "cloud_backup_config"
+
+// DefaultChunkSize is the size of the plain chunks of a snapshot, small
+// enough for the upload limits of the usual WebDAV servers.
+const DefaultChunkSize = 8 << 20
+
+// Target is a remote storage receiving the snapshots, paths are relative to
+// its root and slash separated.
+type Target interface {
+	// Size returns the size of a file, errcode.ErrNotFound if it does not
+	// exist.
+	Size(ctx context.Context, path string) (int64, error)
+
+	// Put creates or replaces a file.
+	Put(ctx context.Context, path string, data []byte) error
+
+	// Get opens a file, errcode.ErrNotFound if it does not exist.
+	Get(ctx context.Context, path string) (io.ReadCloser, error)
+
+	// List returns the names of the directories found in dir.
+	List(ctx context.Context, dir string) ([]string, error)
+
+	// MakeDir creates a directory, it succeeds if it already exists.
+	MakeDir(ctx context.Context, dir string) error
+
+	// Remove deletes a file or a directory with its content.
+	Remove(ctx context.Context, path string) error
+}
+
+// Config is the per-account configuration, it is stored with the account
+// datastore as the credentials of the other services.
+type Config struct {
+	// URL is the WebDAV collection receiving the snapshots, e.g.
+	// https://cloud.example.com/remote.php/dav/files/alice/berty.
+	URL      string `json:"url,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// Passphrase encrypts the snapshots, it is required to restore them on
+	// another device.
+	Passphrase string `json:"passphrase,omitempty"`
+
+	// Interval is the time between two scheduled backups, they are
+	// disabled when zero.
+	Interval time.Duration `json:"interval,omitempty"`
+
+	// Keep is the number of snapshots kept on the remote, the older ones
+	// are removed after a backup, every one is kept when zero.
+	Keep int `json:"keep,omitempty"`
+}
+
+// Enabled returns true when the scheduled backups are configured.
+func (c Config) Enabled() bool {
+	return c.URL != "" && c.Interval > 0
+}
+
+func (c Config) Validate() error {
+	if c.URL == "" {
+		return nil
+	}
+
+	if c.Passphrase == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("a backup passphrase is required"))
+	}
+
+	if c.Interval < 0 || c.Keep < 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the backup interval and the number of kept snapshots cannot be negative"))
+	}
+
+	return nil
+}
+
+// Target returns the WebDAV target of the configuration.
+func (c Config) Target() (Target, error) {
+	if c.URL == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("no backup url configured"))
+	}
+
+	return NewWebDAV(c.URL, c.Username, c.Password, nil)
+}
+
+// LoadConfig reads the account configuration, an empty one is returned if
+// none was saved.
+func LoadConfig(ctx context.Context, ds datastore.Datastore) (Config, error) {
+	var config Config
+
+	data, err := ds.Get(ctx, datastore.NewKey(ConfigDatastoreKey))
+	switch err {
+	case nil:
+	case datastore.ErrNotFound:
+		return config, nil
+	default:
+		return config, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return config, nil
+}
+
+// SaveConfig persists the account configuration.
+func SaveConfig(ctx context.Context, ds datastore.Datastore, config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := ds.Put(ctx, datastore.NewKey(ConfigDatastoreKey), data); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
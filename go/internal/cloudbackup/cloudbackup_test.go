@@ -0,0 +1,164 @@
+package cloudbackup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func newTestWebDAV(t *testing.T) *WebDAV {
+	t.Helper()
+
+	server := httptest.NewServer(&webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	})
+	t.Cleanup(server.Close)
+
+	target, err := NewWebDAV(server.URL+"/backups", "", "", server.Client())
+	require.NoError(t, err)
+	require.NoError(t, target.MakeDir(context.Background(), ""))
+
+	return target
+}
+
+// failingTarget fails the uploads after a number of them.
+type failingTarget struct {
+	Target
+	puts, failAfter int
+}
+
+func (f *failingTarget) Put(ctx context.Context, name string, data []byte) error {
+	if f.failAfter >= 0 && f.puts >= f.failAfter {
+		return errcode.ErrStreamWrite.Wrap(fmt.Errorf("connection lost"))
+	}
+	f.puts++
+	return f.Target.Put(ctx, name, data)
+}
+
+func writeExport(data []byte) func(f *os.File) error {
+	return func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	target := newTestWebDAV(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	export := bytes.Repeat([]byte("berty export "), 100)
+
+	flaky := &failingTarget{Target: target, failAfter: 2}
+	client := New(flaky, "passphrase", ds, t.TempDir())
+	client.chunkSize = 256
+
+	due, err := client.Due(ctx, time.Now(), 0)
+	require.NoError(t, err)
+	require.True(t, due)
+
+	// the upload is interrupted after two chunks
+	_, err = client.Backup(ctx, writeExport(export))
+	require.Error(t, err)
+
+	snapshots, err := List(ctx, target)
+	require.NoError(t, err)
+	require.Empty(t, snapshots)
+
+	// the next backup resumes it, without exporting again
+	flaky.failAfter, flaky.puts = -1, 0
+	snapshot, err := client.Backup(ctx, func(*os.File) error {
+		return fmt.Errorf("unexpected export")
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(export)), snapshot.Size)
+	require.Equal(t, 6, snapshot.Chunks)
+	// the four missing chunks and the manifest
+	require.Equal(t, 5, flaky.puts)
+
+	snapshots, err = List(ctx, target)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	require.Equal(t, snapshot.ID, snapshots[0].ID)
+
+	restored := &bytes.Buffer{}
+	_, err = Restore(ctx, target, "passphrase", snapshot.ID, restored)
+	require.NoError(t, err)
+	require.Equal(t, export, restored.Bytes())
+
+	_, err = Restore(ctx, target, "wrong", snapshot.ID, &bytes.Buffer{})
+	require.True(t, errcode.Is(err, errcode.ErrCryptoDecrypt))
+
+	_, err = Restore(ctx, target, "passphrase", "../other", &bytes.Buffer{})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	_, err = Restore(ctx, target, "passphrase", "unknown", &bytes.Buffer{})
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	last, err := client.LastBackup(ctx)
+	require.NoError(t, err)
+	require.True(t, last.Equal(snapshot.CreatedAt))
+}
+
+func TestBackupDue(t *testing.T) {
+	ctx := context.Background()
+	target := newTestWebDAV(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	mock := clock.NewMock()
+	mock.Set(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+	client := New(target, "passphrase", ds, t.TempDir())
+	client.SetClock(mock)
+
+	snapshot, err := client.Backup(ctx, writeExport([]byte("export")))
+	require.NoError(t, err)
+	require.True(t, snapshot.CreatedAt.Equal(mock.Now()))
+
+	mock.Add(59 * time.Minute)
+	due, err := client.Due(ctx, mock.Now(), time.Hour)
+	require.NoError(t, err)
+	require.False(t, due)
+
+	mock.Add(time.Minute)
+	due, err = client.Due(ctx, mock.Now(), time.Hour)
+	require.NoError(t, err)
+	require.True(t, due)
+}
+
+func TestBackupPrune(t *testing.T) {
+	ctx := context.Background()
+	target := newTestWebDAV(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	client := New(target, "passphrase", ds, t.TempDir())
+	client.chunkSize = 64
+
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		snapshot, err := client.Backup(ctx, writeExport([]byte(fmt.Sprintf("export %d", i))))
+		require.NoError(t, err)
+		ids = append(ids, snapshot.ID)
+	}
+
+	// a partial upload which will not be resumed
+	require.NoError(t, target.MakeDir(ctx, "stale"))
+
+	require.NoError(t, client.Prune(ctx, 2))
+
+	names, err := target.List(ctx, "")
+	require.NoError(t, err)
+	require.ElementsMatch(t, ids[1:], names)
+}
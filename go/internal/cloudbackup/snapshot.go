@@ -0,0 +1,498 @@
+package cloudbackup
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	"golang.org/x/crypto/scrypt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	snapshotVersion = 1
+	manifestName    = "manifest.json"
+	saltSize        = 16
+
+	pendingDatastoreKey    = "cloud_backup_pending"
+	lastBackupDatastoreKey = "cloud_backup_last"
+)
+
+// Snapshot is the manifest of a complete snapshot.
+type Snapshot struct {
+	Version   int       `json:"version"`
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Size is the size of the plain export.
+	Size      int64  `json:"size"`
+	ChunkSize int    `json:"chunk_size"`
+	Chunks    int    `json:"chunks"`
+	Salt      []byte `json:"salt"`
+}
+
+// pendingUpload is the snapshot being uploaded, its export is kept locally
+// until the manifest is written.
+type pendingUpload struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Salt      []byte    `json:"salt"`
+}
+
+// Client uploads the snapshots of an account.
+type Client struct {
+	target     Target
+	passphrase string
+	ds         datastore.Datastore
+	dir        string
+	chunkSize  int
+	clock      clock.Clock
+}
+
+// New returns a client uploading to target, the progress of the uploads is
+// kept in ds and the export being uploaded in dir.
+func New(target Target, passphrase string, ds datastore.Datastore, dir string) *Client {
+	return &Client{
+		target:     target,
+		passphrase: passphrase,
+		ds:         ds,
+		dir:        dir,
+		chunkSize:  DefaultChunkSize,
+		clock:      clock.New(),
+	}
+}
+
+// SetClock replaces the clock dating the snapshots, e.g. with a mock in
+// tests.
+func (c *Client) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// Due returns true when the last backup is older than interval, or when an
+// upload was interrupted.
+func (c *Client) Due(ctx context.Context, now time.Time, interval time.Duration) (bool, error) {
+	if pending, err := c.loadPending(ctx); err != nil || pending != nil {
+		return pending != nil, err
+	}
+
+	last, err := c.LastBackup(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return !now.Before(last.Add(interval)), nil
+}
+
+// LastBackup returns the time of the last complete backup, zero if there is
+// none.
+func (c *Client) LastBackup(ctx context.Context) (time.Time, error) {
+	data, err := c.ds.Get(ctx, datastore.NewKey(lastBackupDatastoreKey))
+	switch err {
+	case nil:
+	case datastore.ErrNotFound:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, errcode.ErrDBRead.Wrap(err)
+	}
+
+	last := time.Time{}
+	if err := last.UnmarshalText(data); err != nil {
+		return time.Time{}, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return last, nil
+}
+
+// Backup uploads a new snapshot of the data written by export, or resumes
+// the interrupted upload of the previous one, skipping the chunks already on
+// the target.
+func (c *Client) Backup(ctx context.Context, export func(f *os.File) error) (*Snapshot, error) {
+	pending, err := c.loadPending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if pending != nil {
+		if _, err := os.Stat(c.pendingPath(pending.ID)); err != nil {
+			// the export was lost, the partial snapshot is pruned later
+			pending = nil
+		}
+	}
+
+	if pending == nil {
+		if pending, err = c.exportPending(ctx, export); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(c.pendingPath(pending.ID))
+	if err != nil {
+		return nil, errcode.ErrInternal.Wrap(err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, errcode.ErrInternal.Wrap(err)
+	}
+
+	snapshot := &Snapshot{
+		Version:   snapshotVersion,
+		ID:        pending.ID,
+		CreatedAt: pending.CreatedAt,
+		Size:      stat.Size(),
+		ChunkSize: c.chunkSize,
+		Chunks:    int((stat.Size() + int64(c.chunkSize) - 1) / int64(c.chunkSize)),
+		Salt:      pending.Salt,
+	}
+
+	if err := c.upload(ctx, snapshot, f); err != nil {
+		return nil, err
+	}
+
+	if err := c.ds.Delete(ctx, datastore.NewKey(pendingDatastoreKey)); err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	f.Close()
+	if err := os.Remove(c.pendingPath(pending.ID)); err != nil {
+		return nil, errcode.ErrInternal.Wrap(err)
+	}
+
+	last, err := snapshot.CreatedAt.MarshalText()
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := c.ds.Put(ctx, datastore.NewKey(lastBackupDatastoreKey), last); err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return snapshot, nil
+}
+
+// exportPending writes a new export next to the datastore and records it as
+// the pending upload.
+func (c *Client) exportPending(ctx context.Context, export func(f *os.File) error) (*pendingUpload, error) {
+	pending := &pendingUpload{CreatedAt: c.clock.Now().UTC(), Salt: make([]byte, saltSize)}
+	if _, err := crand.Read(pending.Salt); err != nil {
+		return nil, errcode.ErrCryptoRandomGeneration.Wrap(err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := crand.Read(suffix); err != nil {
+		return nil, errcode.ErrCryptoRandomGeneration.Wrap(err)
+	}
+	pending.ID = pending.CreatedAt.Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return nil, errcode.ErrInternal.Wrap(err)
+	}
+
+	f, err := os.OpenFile(c.pendingPath(pending.ID), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, errcode.ErrInternal.Wrap(err)
+	}
+
+	err = export(f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = errcode.ErrInternal.Wrap(closeErr)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := c.ds.Put(ctx, datastore.NewKey(pendingDatastoreKey), data); err != nil {
+		os.Remove(f.Name())
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return pending, nil
+}
+
+func (c *Client) loadPending(ctx context.Context) (*pendingUpload, error) {
+	data, err := c.ds.Get(ctx, datastore.NewKey(pendingDatastoreKey))
+	switch err {
+	case nil:
+	case datastore.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	pending := &pendingUpload{}
+	if err := json.Unmarshal(data, pending); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return pending, nil
+}
+
+func (c *Client) pendingPath(id string) string {
+	return filepath.Join(c.dir, "cloud-backup-"+id)
+}
+
+// upload sends the chunks missing on the target, then the manifest.
+func (c *Client) upload(ctx context.Context, snapshot *Snapshot, f *os.File) error {
+	aead, err := snapshotAEAD(c.passphrase, snapshot.Salt)
+	if err != nil {
+		return err
+	}
+
+	if err := c.target.MakeDir(ctx, snapshot.ID); err != nil {
+		return err
+	}
+
+	plain := make([]byte, snapshot.ChunkSize)
+	for i := 0; i < snapshot.Chunks; i++ {
+		n, err := f.ReadAt(plain, int64(i)*int64(snapshot.ChunkSize))
+		if err != nil && err != io.EOF {
+			return errcode.ErrInternal.Wrap(err)
+		}
+
+		// the encryption is deterministic, a chunk of the expected size
+		// was sent by an interrupted upload
+		name := chunkPath(snapshot.ID, i)
+		size, err := c.target.Size(ctx, name)
+		switch {
+		case err == nil && size == int64(n+aead.Overhead()):
+			continue
+		case err != nil && !errcode.Is(err, errcode.ErrNotFound):
+			return err
+		}
+
+		sealed := aead.Seal(nil, chunkNonce(aead, i), plain[:n], chunkAD(snapshot, i))
+		if err := c.target.Put(ctx, name, sealed); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := json.Marshal(snapshot)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	return c.target.Put(ctx, snapshot.ID+"/"+manifestName, manifest)
+}
+
+// Prune removes the snapshots after the keep most recent ones, and the
+// partial uploads which will not be resumed.
+func (c *Client) Prune(ctx context.Context, keep int) error {
+	pending, err := c.loadPending(ctx)
+	if err != nil {
+		return err
+	}
+
+	names, err := c.target.List(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	snapshots := []*Snapshot(nil)
+	for _, name := range names {
+		snapshot, err := readManifest(ctx, c.target, name)
+		switch {
+		case err == nil:
+			snapshots = append(snapshots, snapshot)
+		case errcode.Is(err, errcode.ErrNotFound):
+			if pending != nil && pending.ID == name {
+				continue
+			}
+			if err := c.target.Remove(ctx, name+"/"); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+
+	if keep <= 0 || len(snapshots) <= keep {
+		return nil
+	}
+
+	sortSnapshots(snapshots)
+	for _, snapshot := range snapshots[keep:] {
+		if err := c.target.Remove(ctx, snapshot.ID+"/"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// List returns the complete snapshots of the target of the client.
+func (c *Client) List(ctx context.Context) ([]*Snapshot, error) {
+	return List(ctx, c.target)
+}
+
+// Restore writes the export of a snapshot of the target of the client to w.
+func (c *Client) Restore(ctx context.Context, id string, w io.Writer) (*Snapshot, error) {
+	return Restore(ctx, c.target, c.passphrase, id, w)
+}
+
+// List returns the complete snapshots of target, the most recent first.
+func List(ctx context.Context, target Target) ([]*Snapshot, error) {
+	names, err := target.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []*Snapshot{}
+	for _, name := range names {
+		snapshot, err := readManifest(ctx, target, name)
+		switch {
+		case err == nil:
+			snapshots = append(snapshots, snapshot)
+		case errcode.Is(err, errcode.ErrNotFound):
+			// partial upload, or another directory
+		default:
+			return nil, err
+		}
+	}
+
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+// Restore writes the export of a snapshot to w, the passphrase is checked
+// with the first chunk.
+func Restore(ctx context.Context, target Target, passphrase string, id string, w io.Writer) (*Snapshot, error) {
+	if id == "" || strings.ContainsAny(id, "/\\") || id == "." || id == ".." {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid snapshot id %q", id))
+	}
+
+	snapshot, err := readManifest(ctx, target, id)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := snapshotAEAD(passphrase, snapshot.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	written := int64(0)
+	for i := 0; i < snapshot.Chunks; i++ {
+		r, err := target.Get(ctx, chunkPath(snapshot.ID, i))
+		if err != nil {
+			return nil, err
+		}
+
+		sealed, err := io.ReadAll(io.LimitReader(r, int64(snapshot.ChunkSize+aead.Overhead()+1)))
+		r.Close()
+		if err != nil {
+			return nil, errcode.ErrStreamRead.Wrap(err)
+		}
+
+		plain, err := aead.Open(nil, chunkNonce(aead, i), sealed, chunkAD(snapshot, i))
+		if err != nil {
+			if i == 0 {
+				return nil, errcode.ErrCryptoDecrypt.Wrap(fmt.Errorf("wrong passphrase or corrupted snapshot: %w", err))
+			}
+			return nil, errcode.ErrCryptoDecrypt.Wrap(fmt.Errorf("corrupted chunk %d: %w", i, err))
+		}
+
+		if _, err := w.Write(plain); err != nil {
+			return nil, errcode.ErrInternal.Wrap(err)
+		}
+		written += int64(len(plain))
+	}
+
+	if written != snapshot.Size {
+		return nil, errcode.ErrCryptoDecrypt.Wrap(fmt.Errorf("truncated snapshot, %d bytes restored out of %d", written, snapshot.Size))
+	}
+
+	return snapshot, nil
+}
+
+func readManifest(ctx context.Context, target Target, id string) (*Snapshot, error) {
+	r, err := target.Get(ctx, id+"/"+manifestName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	snapshot := &Snapshot{}
+	if err := json.NewDecoder(r).Decode(snapshot); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	switch {
+	case snapshot.Version != snapshotVersion:
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("unsupported snapshot version %d", snapshot.Version))
+	case snapshot.ID != id || snapshot.ChunkSize <= 0 || snapshot.Chunks < 0 || len(snapshot.Salt) != saltSize:
+		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("invalid manifest of snapshot %q", id))
+	}
+
+	return snapshot, nil
+}
+
+func sortSnapshots(snapshots []*Snapshot) {
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+}
+
+func chunkPath(id string, i int) string {
+	return fmt.Sprintf("%s/chunk-%06d", id, i)
+}
+
+// snapshotAEAD derives the key of a snapshot from the passphrase, each
+// snapshot has its own salt so the chunk nonces are never reused.
+func snapshotAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a backup passphrase is required"))
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, errcode.ErrCryptoKeyDerivation.Wrap(err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errcode.ErrCryptoCipherInit.Wrap(err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errcode.ErrCryptoCipherInit.Wrap(err)
+	}
+
+	return aead, nil
+}
+
+func chunkNonce(aead cipher.AEAD, i int) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], uint64(i))
+	return nonce
+}
+
+// chunkAD binds a chunk to its snapshot and position, the last chunk is
+// flagged so that a truncated snapshot is detected.
+func chunkAD(snapshot *Snapshot, i int) []byte {
+	last := byte(0)
+	if i == snapshot.Chunks-1 {
+		last = 1
+	}
+	return append([]byte(snapshot.ID), byte(i>>24), byte(i>>16), byte(i>>8), byte(i), last)
+}
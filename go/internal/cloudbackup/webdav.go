@@ -0,0 +1,212 @@
+package cloudbackup
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// WebDAV is a Target storing the snapshots in a WebDAV collection, e.g. a
+// Nextcloud folder.
+type WebDAV struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+}
+
+var _ Target = (*WebDAV)(nil)
+
+// NewWebDAV returns the target of the collection at rawURL, which must
+// exist. http.DefaultClient is used when client is nil.
+func NewWebDAV(rawURL, username, password string, client *http.Client) (*WebDAV, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid backup url: %w", err))
+	}
+
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unsupported backup url scheme %q", base.Scheme))
+	}
+
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &WebDAV{base: base, username: username, password: password, client: client}, nil
+}
+
+func (w *WebDAV) Size(ctx context.Context, name string) (int64, error) {
+	resp, err := w.do(ctx, http.MethodHead, name, nil, nil)
+	if err != nil {
+		return 0, errcode.ErrStreamRead.Wrap(err)
+	}
+	resp.Body.Close()
+
+	if err := checkStatus(resp, errcode.ErrStreamRead); err != nil {
+		return 0, err
+	}
+
+	return resp.ContentLength, nil
+}
+
+func (w *WebDAV) Put(ctx context.Context, name string, data []byte) error {
+	resp, err := w.do(ctx, http.MethodPut, name, bytes.NewReader(data), nil)
+	if err != nil {
+		return errcode.ErrStreamWrite.Wrap(err)
+	}
+	resp.Body.Close()
+
+	return checkStatus(resp, errcode.ErrStreamWrite)
+}
+
+func (w *WebDAV) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := w.do(ctx, http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, errcode.ErrStreamRead.Wrap(err)
+	}
+
+	if err := checkStatus(resp, errcode.ErrStreamRead); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+const propfindResourceType = `<?xml version="1.0" encoding="utf-8"?><d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/></d:prop></d:propfind>`
+
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Collection *struct{} `xml:"DAV: prop>resourcetype>collection"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+func (w *WebDAV) List(ctx context.Context, dir string) ([]string, error) {
+	dir = strings.TrimSuffix(dir, "/") + "/"
+
+	resp, err := w.do(ctx, "PROPFIND", dir, strings.NewReader(propfindResourceType), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return nil, errcode.ErrStreamRead.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, errcode.ErrStreamRead); err != nil {
+		return nil, err
+	}
+
+	ms := davMultistatus{}
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	self := strings.TrimSuffix(w.resolve(dir).Path, "/")
+	names := []string(nil)
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+
+		// the collection itself is listed first
+		p := strings.TrimSuffix(href.Path, "/")
+		if p == self {
+			continue
+		}
+
+		for _, ps := range r.Propstat {
+			if ps.Collection != nil {
+				names = append(names, path.Base(p))
+				break
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func (w *WebDAV) MakeDir(ctx context.Context, dir string) error {
+	resp, err := w.do(ctx, "MKCOL", strings.TrimSuffix(dir, "/")+"/", nil, nil)
+	if err != nil {
+		return errcode.ErrStreamWrite.Wrap(err)
+	}
+	resp.Body.Close()
+
+	// an existing collection is reported as not allowed
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		return nil
+	}
+
+	return checkStatus(resp, errcode.ErrStreamWrite)
+}
+
+func (w *WebDAV) Remove(ctx context.Context, name string) error {
+	resp, err := w.do(ctx, http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return errcode.ErrStreamWrite.Wrap(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return checkStatus(resp, errcode.ErrStreamWrite)
+}
+
+// resolve returns the url of a path relative to the collection.
+func (w *WebDAV) resolve(name string) *url.URL {
+	u := *w.base
+	u.Path = path.Join(w.base.Path, name)
+	if strings.HasSuffix(name, "/") {
+		u.Path += "/"
+	}
+	u.RawPath = ""
+	return &u
+}
+
+func (w *WebDAV) do(ctx context.Context, method, name string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, w.resolve(name).String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.username != "" || w.password != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	return w.client.Do(req)
+}
+
+func checkStatus(resp *http.Response, code errcode.ErrCode) error {
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("%s %s: %s", resp.Request.Method, resp.Request.URL.Redacted(), resp.Status))
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return code.Wrap(fmt.Errorf("%s %s: %s", resp.Request.Method, resp.Request.URL.Redacted(), resp.Status))
+	default:
+		return nil
+	}
+}
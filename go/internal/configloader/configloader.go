@@ -0,0 +1,298 @@
+// Package configloader loads the settings of the commands from, by order of
+// precedence, the command line flags, the environment variables and a config
+// file in the plain, YAML or TOML format.
+//
+// The flags are the only definition of the settings, the environment
+// variables and the keys of the config files are named after them: the
+// -node.display-name flag is set by BERTY_NODE_DISPLAY_NAME, by a
+// `node.display-name alice` line of a plain file, by `display-name: alice`
+// under `node:` in a YAML file, or by `display-name = "alice"` in the
+// `[node]` table of a TOML file.
+package configloader
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peterbourgon/ff/v3"
+	"github.com/peterbourgon/ff/v3/fftoml"
+	"gopkg.in/yaml.v3"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// EnvPrefix prefixes the environment variables of the berty commands.
+	EnvPrefix = "BERTY"
+
+	// ConfigFlag is the flag holding the path of the config file.
+	ConfigFlag = "config"
+
+	// Redacted replaces the value of the sensitive settings, see Sensitive.
+	Redacted = "<redacted>"
+)
+
+// Format is the format of a config file.
+type Format string
+
+const (
+	// FormatPlain has a `name value` pair per line.
+	FormatPlain Format = "plain"
+	FormatYAML  Format = "yaml"
+	FormatTOML  Format = "toml"
+)
+
+// Source is where the value of a setting comes from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Setting is the effective value of a flag.
+type Setting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source Source `json:"source"`
+}
+
+// Options returns the ff options of the commands, the environment variables
+// are prefixed with envPrefix and the config file is given by ConfigFlag.
+func Options(envPrefix string) []ff.Option {
+	return []ff.Option{
+		ff.WithEnvVarPrefix(envPrefix),
+		ff.WithConfigFileFlag(ConfigFlag),
+		ff.WithConfigFileParser(Parser),
+	}
+}
+
+var (
+	tomlKeyPattern  = regexp.MustCompile(`^("[^"]*"|'[^']*'|[A-Za-z0-9_.-]+)\s*=`)
+	yamlKeyPattern  = regexp.MustCompile(`^("[^"]*"|'[^']*'|[A-Za-z0-9_.-]+)\s*:(\s|$)`)
+	envNameReplacer = strings.NewReplacer("-", "_", ".", "_", "/", "_")
+)
+
+// DetectFormat returns the format of a config file from its first line which
+// is neither empty nor a comment.
+func DetectFormat(data []byte) Format {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case line == "---" || strings.HasPrefix(line, "- ") || yamlKeyPattern.MatchString(line):
+			return FormatYAML
+		case strings.HasPrefix(line, "[") || tomlKeyPattern.MatchString(line):
+			return FormatTOML
+		default:
+			return FormatPlain
+		}
+	}
+
+	return FormatPlain
+}
+
+// Parser is the ff.ConfigFileParser of the three formats, see DetectFormat.
+func Parser(r io.Reader, set func(name, value string) error) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	switch DetectFormat(data) {
+	case FormatYAML:
+		return parseYAML(data, set)
+	case FormatTOML:
+		return fftoml.Parser(bytes.NewReader(data), set)
+	default:
+		return ff.PlainParser(bytes.NewReader(data), set)
+	}
+}
+
+func parseYAML(data []byte, set func(name, value string) error) error {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid YAML config: %w", err))
+	}
+
+	return setFlattened("", values, set)
+}
+
+// setFlattened sets the values of the nested maps with their path joined by
+// dots, the items of a list set the same flag in order.
+func setFlattened(name string, value interface{}, set func(name, value string) error) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child := key
+			if name != "" {
+				child = name + "." + key
+			}
+			if err := setFlattened(child, v[key], set); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(map[string]interface{}); ok {
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("%q: a list can only hold values", name))
+			}
+			if err := setFlattened(name, item, set); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case nil:
+		return set(name, "")
+	case string:
+		return set(name, v)
+	case float64:
+		return set(name, strconv.FormatFloat(v, 'f', -1, 64))
+	case time.Time:
+		return set(name, v.Format(time.RFC3339))
+	default:
+		return set(name, fmt.Sprint(v))
+	}
+}
+
+// EnvName returns the environment variable setting a flag.
+func EnvName(envPrefix, flagName string) string {
+	return envPrefix + "_" + envNameReplacer.Replace(strings.ToUpper(flagName))
+}
+
+// CommandLineFlags returns the names of the flags set by args.
+func CommandLineFlags(args []string) map[string]bool {
+	names := map[string]bool{}
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			continue
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if i := strings.Index(name, "="); i >= 0 {
+			name = name[:i]
+		}
+		names[name] = true
+	}
+
+	return names
+}
+
+// Effective parses fs from args, the environment and the config file as the
+// commands do, and returns the value of every flag with its source, sorted
+// by name. The values of the sensitive flags are redacted.
+func Effective(fs *flag.FlagSet, args []string, envPrefix string) ([]Setting, error) {
+	if err := ff.Parse(fs, args, Options(envPrefix)...); err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	fromFile := map[string]bool{}
+	if f := fs.Lookup(ConfigFlag); f != nil && f.Value.String() != "" {
+		file, err := os.Open(f.Value.String())
+		if err != nil {
+			return nil, errcode.ErrInvalidInput.Wrap(err)
+		}
+		defer file.Close()
+
+		if err := Parser(file, func(name, _ string) error {
+			fromFile[name] = true
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	fromArgs := CommandLineFlags(args)
+	settings := []Setting{}
+	fs.VisitAll(func(f *flag.Flag) {
+		setting := Setting{Name: f.Name, Value: f.Value.String(), Source: SourceDefault}
+		switch {
+		case fromArgs[f.Name]:
+			setting.Source = SourceFlag
+		case os.Getenv(EnvName(envPrefix, f.Name)) != "":
+			setting.Source = SourceEnv
+		case fromFile[f.Name]:
+			setting.Source = SourceFile
+		}
+
+		if setting.Value != "" && Sensitive(f.Name) {
+			setting.Value = Redacted
+		}
+
+		settings = append(settings, setting)
+	})
+
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+
+	return settings, nil
+}
+
+// UnknownEnv returns the environment variables with the prefix which set no
+// flag of fs, e.g. because of a typo, sorted.
+func UnknownEnv(fs *flag.FlagSet, envPrefix string) []string {
+	known := map[string]bool{}
+	fs.VisitAll(func(f *flag.Flag) {
+		known[EnvName(envPrefix, f.Name)] = true
+	})
+
+	unknown := []string{}
+	for _, env := range os.Environ() {
+		name := strings.SplitN(env, "=", 2)[0]
+		if strings.HasPrefix(name, envPrefix+"_") && !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+// sensitiveWords are the words of the flag names holding a secret, e.g. a
+// password or a private key.
+var sensitiveWords = map[string]bool{
+	"b64":        true,
+	"dsn":        true,
+	"passphrase": true,
+	"password":   true,
+	"secret":     true,
+	"sk":         true,
+	"token":      true,
+}
+
+// Sensitive returns true for the flags holding a secret, their value is not
+// printed.
+func Sensitive(flagName string) bool {
+	for _, word := range strings.FieldsFunc(flagName, func(r rune) bool { return r == '.' || r == '-' || r == '_' }) {
+		if sensitiveWords[strings.ToLower(word)] {
+			return true
+		}
+	}
+
+	return false
+}
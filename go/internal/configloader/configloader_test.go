@@ -0,0 +1,127 @@
+package configloader
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectFormat(t *testing.T) {
+	cases := map[string]Format{
+		"":                                     FormatPlain,
+		"# comment\nnode.display-name alice\n": FormatPlain,
+		"log.filters\n":                        FormatPlain,
+		"---\nnode:\n  display-name: alice\n":  FormatYAML,
+		"node.display-name: alice\n":           FormatYAML,
+		"node:\n":                              FormatYAML,
+		"[node]\ndisplay-name = \"alice\"\n":   FormatTOML,
+		"# comment\nlog.filters = \"info\"\n":  FormatTOML,
+	}
+
+	for data, expected := range cases {
+		require.Equal(t, expected, DetectFormat([]byte(data)), data)
+	}
+}
+
+func parse(t *testing.T, data string) (map[string][]string, error) {
+	t.Helper()
+
+	values := map[string][]string{}
+	err := Parser(strings.NewReader(data), func(name, value string) error {
+		values[name] = append(values[name], value)
+		return nil
+	})
+
+	return values, err
+}
+
+func TestParser(t *testing.T) {
+	expected := map[string][]string{
+		"node.display-name":      {"alice"},
+		"node.no-notif":          {"true"},
+		"p2p.rdvp":               {"a", "b"},
+		"p2p.rdvp-max-backoff":   {"1m"},
+		"p2p.high-water":         {"200"},
+		"node.contact-threshold": {"0.5"},
+	}
+
+	values, err := parse(t, `
+# a YAML config
+node:
+  display-name: alice
+  no-notif: true
+  contact-threshold: 0.5
+p2p:
+  rdvp: [a, b]
+  rdvp-max-backoff: 1m
+  high-water: 200
+`)
+	require.NoError(t, err)
+	require.Equal(t, expected, values)
+
+	values, err = parse(t, `
+# a TOML config
+[node]
+display-name = "alice" # inline comment
+no-notif = true
+contact-threshold = 0.5
+
+[p2p]
+rdvp = ["a", 'b']
+rdvp-max-backoff = "1m"
+high-water = 2_00
+`)
+	require.NoError(t, err)
+	require.Equal(t, expected, values)
+
+	values, err = parse(t, "node.display-name alice\nnode.no-notif\n")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{"node.display-name": {"alice"}, "node.no-notif": {"true"}}, values)
+
+	for _, invalid := range []string{
+		"[[node]]\ndisplay-name = \"alice\"\n",
+		"[node]\ndisplay-name = alice\n",
+		"node:\n  - display-name: alice\n",
+	} {
+		_, err := parse(t, invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestEffective(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("node:\n  display-name: alice\n  listeners: /ip4/0.0.0.0/tcp/9091\n"), 0o600))
+	t.Setenv("BERTYTEST_NODE_LISTENERS", "/ip4/127.0.0.1/tcp/9091")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String(ConfigFlag, "", "")
+	fs.String("node.display-name", "", "")
+	fs.String("node.listeners", "", "")
+	fs.String("log.filters", "info", "")
+	fs.String("node.secret", "", "")
+
+	settings, err := Effective(fs, []string{"-config", config, "-node.secret=hunter2"}, "BERTYTEST")
+	require.NoError(t, err)
+	require.Equal(t, []Setting{
+		{Name: "config", Value: config, Source: SourceFlag},
+		{Name: "log.filters", Value: "info", Source: SourceDefault},
+		{Name: "node.display-name", Value: "alice", Source: SourceFile},
+		{Name: "node.listeners", Value: "/ip4/127.0.0.1/tcp/9091", Source: SourceEnv},
+		{Name: "node.secret", Value: Redacted, Source: SourceFlag},
+	}, settings)
+
+	t.Setenv("BERTYTEST_NODE_DISPLAYNAME", "bob")
+	require.Equal(t, []string{"BERTYTEST_NODE_DISPLAYNAME"}, UnknownEnv(fs, "BERTYTEST"))
+}
+
+func TestSensitive(t *testing.T) {
+	require.True(t, Sensitive("p2p.rdvp-secret"))
+	require.True(t, Sensitive("node.account-sk"))
+	require.True(t, Sensitive("cluster.postgres-dsn"))
+	require.False(t, Sensitive("node.display-name"))
+	require.False(t, Sensitive("p2p.tinder-discover"))
+}
@@ -0,0 +1,199 @@
+// Package configreload re-reads the configuration of a running daemon.
+//
+// Only the config file and the environment are read again, values given on
+// the command line always win. Settings with a registered ApplyFunc are
+// changed in place, the other changes are reported as requiring a restart, as
+// the values an ApplyFunc rejects with ErrRestartRequired.
+package configreload
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/peterbourgon/ff/v3"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/configloader"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// ConfigFlag is the flag holding the path of the config file.
+const ConfigFlag = configloader.ConfigFlag
+
+// ApplyFunc changes a setting of the running daemon, value is the string
+// form of the flag.
+type ApplyFunc func(value string) error
+
+// ErrRestartRequired is wrapped by the errors of an ApplyFunc for the values
+// which can only be applied when the daemon starts.
+var ErrRestartRequired = errors.New("restart required")
+
+// Change is a setting whose value differs from the running one.
+type Change struct {
+	Name     string `json:"name"`
+	Previous string `json:"previous"`
+	Value    string `json:"value"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Name, c.Previous, c.Value)
+}
+
+// Report is the result of a reload.
+type Report struct {
+	// Applied are the changes made without restarting.
+	Applied []Change `json:"applied,omitempty"`
+	// RestartRequired are the changes ignored until the next start, they are
+	// reported again by every reload. Error explains why for the reloadable
+	// settings.
+	RestartRequired []Change `json:"restartRequired,omitempty"`
+	// Failed are the changes which could not be applied.
+	Failed []Change `json:"failed,omitempty"`
+}
+
+// Opts configures a Reloader.
+type Opts struct {
+	Logger *zap.Logger
+
+	// FlagSet is the parsed flag set of the running daemon.
+	FlagSet *flag.FlagSet
+
+	// NewFlagSet returns a flag set defining the same flags as FlagSet,
+	// bound to throwaway values.
+	NewFlagSet func() *flag.FlagSet
+
+	// Args are the command line arguments, the flags they set are never
+	// reloaded.
+	Args []string
+
+	// Options are the ff options used to parse FlagSet.
+	Options []ff.Option
+}
+
+// Reloader compares the configuration on disk with the running one.
+type Reloader struct {
+	logger     *zap.Logger
+	fs         *flag.FlagSet
+	newFlagSet func() *flag.FlagSet
+	options    []ff.Option
+	pinned     map[string]bool
+
+	mu       sync.Mutex
+	current  map[string]string
+	appliers map[string]ApplyFunc
+}
+
+func New(opts Opts) (*Reloader, error) {
+	if opts.FlagSet == nil || opts.NewFlagSet == nil {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a flag set is required"))
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+
+	r := &Reloader{
+		logger:     opts.Logger,
+		fs:         opts.FlagSet,
+		newFlagSet: opts.NewFlagSet,
+		options:    opts.Options,
+		pinned:     commandLineFlags(opts.Args),
+		current:    map[string]string{},
+		appliers:   map[string]ApplyFunc{},
+	}
+
+	opts.FlagSet.VisitAll(func(f *flag.Flag) {
+		r.current[f.Name] = f.Value.String()
+	})
+
+	return r, nil
+}
+
+// Register marks a setting as reloadable, apply is called with its new value.
+func (r *Reloader) Register(name string, apply ApplyFunc) {
+	r.mu.Lock()
+	r.appliers[name] = apply
+	r.mu.Unlock()
+}
+
+// Reload reads the config file and the environment again and applies the
+// changed settings which can be changed without a restart.
+func (r *Reloader) Reload() (*Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fs := r.newFlagSet()
+	options := append([]ff.Option{}, r.options...)
+	if f := r.fs.Lookup(ConfigFlag); f != nil && f.Value.String() != "" {
+		options = append(options, ff.WithConfigFile(f.Value.String()))
+	}
+
+	if err := ff.Parse(fs, nil, options...); err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to read the configuration: %w", err))
+	}
+
+	// settings removed from the config file keep their running value, the
+	// defaults of fs do not match the ones computed at startup
+	changes := []Change(nil)
+	fs.Visit(func(f *flag.Flag) {
+		previous, known := r.current[f.Name]
+		if !known || r.pinned[f.Name] || f.Name == ConfigFlag {
+			return
+		}
+
+		if value := f.Value.String(); value != previous {
+			changes = append(changes, Change{Name: f.Name, Previous: previous, Value: value})
+		}
+	})
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+
+	report := &Report{}
+	for _, c := range changes {
+		apply, ok := r.appliers[c.Name]
+		if !ok {
+			r.logger.Warn("setting changed, restart required", zap.String("name", c.Name), zap.String("previous", c.Previous), zap.String("value", c.Value))
+			report.RestartRequired = append(report.RestartRequired, c)
+			continue
+		}
+
+		err := apply(c.Value)
+		if errors.Is(err, ErrRestartRequired) {
+			r.logger.Warn("setting changed, restart required", zap.String("name", c.Name), zap.String("previous", c.Previous), zap.String("value", c.Value), zap.Error(err))
+			c.Error = err.Error()
+			report.RestartRequired = append(report.RestartRequired, c)
+			continue
+		}
+		if err != nil {
+			r.logger.Error("unable to apply setting", zap.String("name", c.Name), zap.String("value", c.Value), zap.Error(err))
+			c.Error = err.Error()
+			report.Failed = append(report.Failed, c)
+			continue
+		}
+
+		// keep the live flag set in sync, for the help and later reloads
+		if live := r.fs.Lookup(c.Name); live != nil {
+			_ = live.Value.Set(c.Value)
+		}
+
+		r.current[c.Name] = c.Value
+		r.logger.Info("setting reloaded", zap.String("name", c.Name), zap.String("previous", c.Previous), zap.String("value", c.Value))
+		report.Applied = append(report.Applied, c)
+	}
+
+	r.logger.Info("configuration reloaded",
+		zap.Int("applied", len(report.Applied)),
+		zap.Int("restart-required", len(report.RestartRequired)),
+		zap.Int("failed", len(report.Failed)),
+	)
+
+	return report, nil
+}
+
+// commandLineFlags returns the names of the flags set by args.
+func commandLineFlags(args []string) map[string]bool {
+	return configloader.CommandLineFlags(args)
+}
@@ -0,0 +1,149 @@
+package configreload
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peterbourgon/ff/v3"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func testFlagSet(level, listener, name *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String(ConfigFlag, "", "")
+	fs.StringVar(level, "log.level", "debug", "")
+	fs.StringVar(listener, "metrics.listener", "", "")
+	fs.StringVar(name, "node.display-name", "anon", "")
+	return fs
+}
+
+func TestReload(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(config, []byte("log.level info\nnode.display-name alice\n"), 0o600))
+
+	var level, listener, name string
+	fs := testFlagSet(&level, &listener, &name)
+	args := []string{"-config", config, "--node.display-name=bob"}
+	options := []ff.Option{ff.WithConfigFileFlag(ConfigFlag), ff.WithConfigFileParser(ff.PlainParser)}
+	require.NoError(t, ff.Parse(fs, args, options...))
+	require.Equal(t, "info", level)
+	require.Equal(t, "bob", name)
+
+	r, err := New(Opts{
+		FlagSet: fs,
+		NewFlagSet: func() *flag.FlagSet {
+			var level, listener, name string
+			return testFlagSet(&level, &listener, &name)
+		},
+		Args:    args,
+		Options: options,
+	})
+	require.NoError(t, err)
+
+	applied := []string(nil)
+	r.Register("log.level", func(value string) error {
+		applied = append(applied, value)
+		return nil
+	})
+
+	// nothing changed
+	report, err := r.Reload()
+	require.NoError(t, err)
+	require.Empty(t, report.Applied)
+	require.Empty(t, report.RestartRequired)
+
+	// the display name is pinned by the command line
+	require.NoError(t, os.WriteFile(config, []byte("log.level warn\nmetrics.listener :8080\nnode.display-name carol\n"), 0o600))
+	report, err = r.Reload()
+	require.NoError(t, err)
+	require.Equal(t, []Change{{Name: "log.level", Previous: "info", Value: "warn"}}, report.Applied)
+	require.Equal(t, []Change{{Name: "metrics.listener", Previous: "", Value: ":8080"}}, report.RestartRequired)
+	require.Equal(t, []string{"warn"}, applied)
+	require.Equal(t, "warn", level)
+	require.Equal(t, "", listener)
+	require.Equal(t, "bob", name)
+
+	// restart-required changes are reported until the restart
+	report, err = r.Reload()
+	require.NoError(t, err)
+	require.Empty(t, report.Applied)
+	require.Len(t, report.RestartRequired, 1)
+
+	r.Register("metrics.listener", func(value string) error {
+		return fmt.Errorf("nope")
+	})
+	report, err = r.Reload()
+	require.NoError(t, err)
+	require.Len(t, report.Failed, 1)
+	require.Equal(t, "nope", report.Failed[0].Error)
+
+	// some values of a reloadable setting need a restart
+	r.Register("metrics.listener", func(value string) error {
+		return fmt.Errorf("listener %s: %w", value, ErrRestartRequired)
+	})
+	report, err = r.Reload()
+	require.NoError(t, err)
+	require.Empty(t, report.Failed)
+	require.Equal(t, []Change{{Name: "metrics.listener", Previous: "", Value: ":8080", Error: "listener :8080: restart required"}}, report.RestartRequired)
+
+	require.NoError(t, os.WriteFile(config, []byte("unknown.flag 1\n"), 0o600))
+	_, err = r.Reload()
+	require.Error(t, err)
+}
+
+func TestCommandLineFlags(t *testing.T) {
+	names := commandLineFlags([]string{"-a", "1", "--b=2", "-c=3", "value", "-", "--", "-d"})
+	require.Equal(t, map[string]bool{"a": true, "b": true, "c": true}, names)
+}
+
+func testConn(t *testing.T, register func(*grpc.Server)) *grpc.ClientConn {
+	l := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	register(server)
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.Dial("buf",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	return cc
+}
+
+func TestRPC(t *testing.T) {
+	ctx := context.Background()
+
+	expected := &Report{
+		Applied:         []Change{{Name: "log.level", Previous: "info", Value: "warn"}},
+		RestartRequired: []Change{{Name: "preset", Previous: "", Value: "volatile", Error: "restart required"}},
+	}
+	reloadErr := error(nil)
+	cc := testConn(t, func(server *grpc.Server) {
+		Register(server, func() (*Report, error) { return expected, reloadErr })
+	})
+
+	report, err := Reload(ctx, cc)
+	require.NoError(t, err)
+	require.Equal(t, expected, report)
+
+	reloadErr = errcode.ErrNotImplemented
+	_, err = Reload(ctx, cc)
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+
+	// the daemon has no reload service
+	_, err = Reload(ctx, testConn(t, func(*grpc.Server) {}))
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+}
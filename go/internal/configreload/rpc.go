@@ -0,0 +1,75 @@
+package configreload
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"berty.tech/berty/v2/go/pkg/configreloadtypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// ReloadFunc reloads the configuration of the daemon, e.g.
+// initutil.Manager.ReloadConfig.
+type ReloadFunc func() (*Report, error)
+
+// Reload asks the daemon served by cc to reload its configuration.
+func Reload(ctx context.Context, cc grpc.ClientConnInterface) (*Report, error) {
+	reply, err := configreloadtypes.NewConfigReloadServiceClient(cc).Reload(ctx, &configreloadtypes.Reload_Request{})
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("the daemon has no config reload service: %w", err))
+		}
+		return nil, err
+	}
+
+	return &Report{
+		Applied:         changesFromProto(reply.Applied),
+		RestartRequired: changesFromProto(reply.RestartRequired),
+		Failed:          changesFromProto(reply.Failed),
+	}, nil
+}
+
+// Register adds the reload service to server, reload is called by each
+// request.
+func Register(server *grpc.Server, reload ReloadFunc) {
+	configreloadtypes.RegisterConfigReloadServiceServer(server, &reloadServer{reload: reload})
+}
+
+type reloadServer struct {
+	configreloadtypes.UnimplementedConfigReloadServiceServer
+
+	reload ReloadFunc
+}
+
+func (s *reloadServer) Reload(context.Context, *configreloadtypes.Reload_Request) (*configreloadtypes.Reload_Reply, error) {
+	report, err := s.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return &configreloadtypes.Reload_Reply{
+		Applied:         changesToProto(report.Applied),
+		RestartRequired: changesToProto(report.RestartRequired),
+		Failed:          changesToProto(report.Failed),
+	}, nil
+}
+
+func changesToProto(changes []Change) []configreloadtypes.Change {
+	ret := []configreloadtypes.Change(nil)
+	for _, c := range changes {
+		ret = append(ret, configreloadtypes.Change{Name: c.Name, Previous: c.Previous, Value: c.Value, Error: c.Error})
+	}
+	return ret
+}
+
+func changesFromProto(changes []configreloadtypes.Change) []Change {
+	ret := []Change(nil)
+	for _, c := range changes {
+		ret = append(ret, Change{Name: c.Name, Previous: c.Previous, Value: c.Value, Error: c.Error})
+	}
+	return ret
+}
@@ -0,0 +1,116 @@
+// Package contactnames tells apart the contacts sharing a display name: they
+// are listed with a reference made of the name and of the shortest prefix of
+// their public key telling them apart, e.g. `Alice#Yk3o9p`, and the
+// references, the names and the public keys resolve to the contacts.
+package contactnames
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// Separator separates the name and the public key prefix of a reference.
+	Separator = "#"
+
+	// MinPrefixLen is the length of the shortest public key prefix of a
+	// reference.
+	MinPrefixLen = 6
+)
+
+// Entry is a contact, ID is its public key in the encoding the references
+// are made with.
+type Entry struct {
+	ID   string
+	Name string
+}
+
+// sameName compares the display names case insensitively, Alice and alice are
+// ambiguous to the user.
+func sameName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// References returns the reference of each entry by ID: its name when no
+// other entry has the same one, its name and the prefix of its ID otherwise.
+// The entries without a name are referenced by `#prefix`.
+func References(entries []Entry) map[string]string {
+	refs := make(map[string]string, len(entries))
+
+	byName := map[string][]Entry{}
+	for _, e := range entries {
+		key := strings.ToLower(strings.TrimSpace(e.Name))
+		byName[key] = append(byName[key], e)
+	}
+
+	for name, homonyms := range byName {
+		if name != "" && len(homonyms) == 1 {
+			refs[homonyms[0].ID] = homonyms[0].Name
+			continue
+		}
+
+		for _, e := range homonyms {
+			refs[e.ID] = strings.TrimSpace(e.Name) + Separator + uniquePrefix(e.ID, homonyms)
+		}
+	}
+
+	return refs
+}
+
+// uniquePrefix returns the shortest prefix of id, of at least MinPrefixLen,
+// which is not a prefix of the other ids of homonyms.
+func uniquePrefix(id string, homonyms []Entry) string {
+	n := MinPrefixLen
+	for _, other := range homonyms {
+		if other.ID == id {
+			continue
+		}
+		for n < len(id) && strings.HasPrefix(other.ID, id[:n]) {
+			n++
+		}
+	}
+
+	if n > len(id) {
+		n = len(id)
+	}
+
+	return id[:n]
+}
+
+// Resolve returns the entries matching query, sorted by ID: the entry whose
+// ID is query, or the entries named query, or the entries matching a
+// `name#prefix` reference. Several entries are returned for an ambiguous
+// query, none when no entry matches.
+func Resolve(entries []Entry, query string) []Entry {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil
+	}
+
+	for _, e := range entries {
+		if e.ID == query {
+			return []Entry{e}
+		}
+	}
+
+	matches := []Entry{}
+	for _, e := range entries {
+		if sameName(e.Name, query) {
+			matches = append(matches, e)
+		}
+	}
+
+	// a name may contain the separator, e.g. "Bob #2"
+	if i := strings.LastIndex(query, Separator); len(matches) == 0 && i >= 0 {
+		name, prefix := query[:i], query[i+len(Separator):]
+		for _, e := range entries {
+			if prefix != "" && sameName(e.Name, name) && strings.HasPrefix(e.ID, prefix) {
+				matches = append(matches, e)
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	return matches
+}
@@ -0,0 +1,50 @@
+package contactnames
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferences(t *testing.T) {
+	entries := []Entry{
+		{ID: "Yk3o9pAAAA", Name: "Alice"},
+		{ID: "Yk3o9pBBBB", Name: "alice"},
+		{ID: "Qw8e2rCCCC", Name: "Bob"},
+		{ID: "Zx1c5vDDDD", Name: ""},
+	}
+
+	require.Equal(t, map[string]string{
+		"Yk3o9pAAAA": "Alice#Yk3o9pA",
+		"Yk3o9pBBBB": "alice#Yk3o9pB",
+		"Qw8e2rCCCC": "Bob",
+		"Zx1c5vDDDD": "#Zx1c5v",
+	}, References(entries))
+
+	// every reference resolves to its entry
+	for id, ref := range References(entries) {
+		matches := Resolve(entries, ref)
+		require.Len(t, matches, 1, ref)
+		require.Equal(t, id, matches[0].ID, ref)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	entries := []Entry{
+		{ID: "Yk3o9pBBBB", Name: "Alice"},
+		{ID: "Yk3o9pAAAA", Name: "Alice"},
+		{ID: "Qw8e2rCCCC", Name: "Bob #2"},
+	}
+
+	matches := Resolve(entries, "alice")
+	require.Len(t, matches, 2)
+	require.Equal(t, "Yk3o9pAAAA", matches[0].ID)
+
+	require.Equal(t, []Entry{entries[1]}, Resolve(entries, "Alice#Yk3o9pA"))
+	require.Equal(t, []Entry{entries[0]}, Resolve(entries, "Yk3o9pBBBB"))
+	require.Equal(t, []Entry{entries[2]}, Resolve(entries, "Bob #2"))
+	require.Len(t, Resolve(entries, "Alice#Yk3o"), 2)
+	require.Empty(t, Resolve(entries, "Alice#"))
+	require.Empty(t, Resolve(entries, "Carol"))
+	require.Empty(t, Resolve(entries, ""))
+}
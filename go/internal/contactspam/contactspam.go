@@ -0,0 +1,231 @@
+// Package contactspam scores incoming contact requests with a few local
+// heuristics, so suspicious requests can be flagged and, above a threshold
+// configured per account, discarded automatically.
+package contactspam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+	"unicode"
+
+	datastore "github.com/ipfs/go-datastore"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// DatastoreKey is the key of the account configuration in the root
+	// datastore.
+	DatastoreKey = "contact_spam_config"
+
+	// SuspiciousThreshold is the score from which a request is suspicious.
+	SuspiciousThreshold = 0.5
+
+	// RateWindow and RateLimit define the number of requests from unknown
+	// contacts considered normal in a sliding window.
+	RateWindow = time.Hour
+	RateLimit  = 5
+
+	maxDisplayNameLength = 64
+)
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.|berty://|\b[a-z0-9-]+\.(com|net|org|io|me|tech|xyz|ru|cn)\b)`)
+
+type Level int32
+
+const (
+	LevelNormal Level = iota
+	LevelSuspicious
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelNormal:
+		return "normal"
+	case LevelSuspicious:
+		return "suspicious"
+	default:
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+}
+
+// Request is an incoming contact request from an unknown contact.
+type Request struct {
+	ContactPK   string
+	DisplayName string
+	// ReceivedAt is left empty for requests replayed from history, they are
+	// not accounted in the request rate.
+	ReceivedAt time.Time
+}
+
+// Score is the result of the heuristics, Value is between 0 and 1.
+type Score struct {
+	ContactPK string   `json:"contact_pk"`
+	Value     float64  `json:"value"`
+	Level     Level    `json:"level"`
+	Reasons   []string `json:"reasons,omitempty"`
+}
+
+func (s Score) String() string {
+	if len(s.Reasons) == 0 {
+		return fmt.Sprintf("%s (%.2f)", s.Level, s.Value)
+	}
+
+	return fmt.Sprintf("%s (%.2f): %v", s.Level, s.Value, s.Reasons)
+}
+
+// Config is the per-account configuration.
+type Config struct {
+	// RejectThreshold is the score from which requests are discarded
+	// automatically, 0 disables the auto-rejection.
+	RejectThreshold float64 `json:"reject_threshold,omitempty"`
+}
+
+func (c Config) Validate() error {
+	if c.RejectThreshold < 0 || c.RejectThreshold > 1 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("reject threshold must be between 0 and 1, got %v", c.RejectThreshold))
+	}
+
+	return nil
+}
+
+// Scorer keeps track of the recent requests needed by the rate heuristic.
+type Scorer struct {
+	mu     sync.Mutex
+	config Config
+	recent []time.Time
+}
+
+func NewScorer(config Config) *Scorer {
+	return &Scorer{config: config}
+}
+
+func (s *Scorer) Config() Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.config
+}
+
+func (s *Scorer) SetConfig(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.config = config
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Score rates the given request and records it for the rate heuristic.
+func (s *Scorer) Score(req Request) Score {
+	score := Score{ContactPK: req.ContactPK}
+	add := func(value float64, reason string) {
+		score.Value += value
+		score.Reasons = append(score.Reasons, reason)
+	}
+
+	if n := s.recordRequest(req.ReceivedAt); n > RateLimit {
+		add(0.5, fmt.Sprintf("%d requests in the last %s", n, RateWindow))
+	}
+
+	switch {
+	case req.DisplayName == "":
+		add(0.2, "no display name")
+	case linkPattern.MatchString(req.DisplayName):
+		add(0.4, "link in display name")
+	}
+
+	if len(req.DisplayName) > maxDisplayNameLength {
+		add(0.2, "display name too long")
+	}
+
+	for _, r := range req.DisplayName {
+		if !unicode.IsPrint(r) {
+			add(0.2, "unprintable characters in display name")
+			break
+		}
+	}
+
+	if score.Value > 1 {
+		score.Value = 1
+	}
+
+	if score.Value >= SuspiciousThreshold {
+		score.Level = LevelSuspicious
+	}
+
+	return score
+}
+
+// ShouldReject returns true if the score reaches the configured threshold.
+func (s *Scorer) ShouldReject(score Score) bool {
+	threshold := s.Config().RejectThreshold
+	return threshold > 0 && score.Value >= threshold
+}
+
+// recordRequest returns the number of requests in the window, including
+// the given one.
+func (s *Scorer) recordRequest(at time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if at.IsZero() {
+		return 0
+	}
+
+	kept := s.recent[:0]
+	for _, t := range s.recent {
+		if at.Sub(t) < RateWindow {
+			kept = append(kept, t)
+		}
+	}
+	s.recent = append(kept, at)
+
+	return len(s.recent)
+}
+
+// LoadConfig reads the account configuration, a default one is returned if
+// none was saved.
+func LoadConfig(ctx context.Context, ds datastore.Datastore) (Config, error) {
+	var config Config
+
+	data, err := ds.Get(ctx, datastore.NewKey(DatastoreKey))
+	switch err {
+	case nil:
+	case datastore.ErrNotFound:
+		return config, nil
+	default:
+		return config, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return config, nil
+}
+
+// SaveConfig persists the account configuration.
+func SaveConfig(ctx context.Context, ds datastore.Datastore, config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := ds.Put(ctx, datastore.NewKey(DatastoreKey), data); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
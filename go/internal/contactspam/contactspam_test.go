@@ -0,0 +1,66 @@
+package contactspam
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScore(t *testing.T) {
+	scorer := NewScorer(Config{})
+
+	score := scorer.Score(Request{DisplayName: "alice"})
+	require.Equal(t, LevelNormal, score.Level)
+	require.Zero(t, score.Value)
+
+	score = scorer.Score(Request{DisplayName: "cheap pills at www.example.com"})
+	require.Equal(t, LevelNormal, score.Level)
+	require.Equal(t, []string{"link in display name"}, score.Reasons)
+
+	score = scorer.Score(Request{DisplayName: ""})
+	require.Equal(t, []string{"no display name"}, score.Reasons)
+}
+
+func TestScoreRate(t *testing.T) {
+	scorer := NewScorer(Config{RejectThreshold: 0.9})
+	start := time.Now()
+
+	for i := 0; i < RateLimit; i++ {
+		score := scorer.Score(Request{DisplayName: fmt.Sprintf("bot%d", i), ReceivedAt: start.Add(time.Duration(i) * time.Minute)})
+		require.Equal(t, LevelNormal, score.Level)
+	}
+
+	// burst of requests
+	score := scorer.Score(Request{DisplayName: "visit https://spam.example", ReceivedAt: start.Add(10 * time.Minute)})
+	require.Equal(t, LevelSuspicious, score.Level)
+	require.Len(t, score.Reasons, 2)
+	require.True(t, scorer.ShouldReject(score))
+
+	// replayed requests are not accounted
+	score = scorer.Score(Request{DisplayName: "carol"})
+	require.Equal(t, LevelNormal, score.Level)
+
+	// old requests leave the window
+	score = scorer.Score(Request{DisplayName: "dave", ReceivedAt: start.Add(2 * RateWindow)})
+	require.Equal(t, LevelNormal, score.Level)
+}
+
+func TestConfigPersistence(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.NewMapDatastore()
+
+	config, err := LoadConfig(ctx, ds)
+	require.NoError(t, err)
+	require.Zero(t, config.RejectThreshold)
+
+	require.Error(t, SaveConfig(ctx, ds, Config{RejectThreshold: 2}))
+	require.NoError(t, SaveConfig(ctx, ds, Config{RejectThreshold: 0.8}))
+
+	config, err = LoadConfig(ctx, ds)
+	require.NoError(t, err)
+	require.Equal(t, 0.8, config.RejectThreshold)
+}
@@ -0,0 +1,200 @@
+// Package contactthrottle limits the incoming contact requests processed in
+// each rendezvous epoch, the rotation period of the public rendezvous point of
+// the account, so that a flood of requests does not flood the user. The
+// requests over the limit are deferred to a backlog the user reviews later.
+package contactthrottle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// Namespace is the key prefix used in the account root datastore.
+	Namespace = "contact-throttle"
+
+	// DefaultLimit is the number of requests processed in an epoch before
+	// the next ones are deferred.
+	DefaultLimit = 20
+)
+
+// Deferred is a contact request received over the limit of its epoch.
+type Deferred struct {
+	ContactPK   string    `json:"contact_public_key"`
+	DisplayName string    `json:"display_name,omitempty"`
+	ReceivedAt  time.Time `json:"received_at"`
+	// Epoch is the index of the rendezvous epoch the request was received
+	// in, see Throttle.Epoch.
+	Epoch int64 `json:"epoch"`
+}
+
+// Throttle counts the requests of the current epoch in memory, the count
+// starts over when the node restarts. The deferred requests are stored under
+// `/<contact public key>`.
+type Throttle struct {
+	ds    datastore.Datastore
+	clock clock.Clock
+	epoch time.Duration
+
+	mu      sync.Mutex
+	limit   int
+	current int64
+	count   int
+}
+
+// New returns a throttle processing limit requests per epoch, 0 disables the
+// limit. The epochs are counted from the Unix epoch, as the rotations of the
+// rendezvous points.
+func New(ds datastore.Datastore, limit int, epoch time.Duration) (*Throttle, error) {
+	if limit < 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the limit of contact requests cannot be negative, got %d", limit))
+	}
+	if epoch <= 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the rendezvous epoch must be positive, got %s", epoch))
+	}
+
+	return &Throttle{
+		ds:    namespace.Wrap(ds, datastore.NewKey(Namespace)),
+		clock: clock.New(),
+		limit: limit,
+		epoch: epoch,
+	}, nil
+}
+
+// SetClock replaces the clock of the epochs, e.g. with a mock in tests.
+func (t *Throttle) SetClock(c clock.Clock) {
+	t.clock = c
+}
+
+// Limit returns the number of requests processed per epoch, 0 when there is
+// no limit.
+func (t *Throttle) Limit() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.limit
+}
+
+// SetLimit changes the number of requests processed per epoch, the requests
+// of the current epoch already counted are kept.
+func (t *Throttle) SetLimit(limit int) error {
+	if limit < 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the limit of contact requests cannot be negative, got %d", limit))
+	}
+
+	t.mu.Lock()
+	t.limit = limit
+	t.mu.Unlock()
+
+	return nil
+}
+
+// Epoch returns the index of the current epoch.
+func (t *Throttle) Epoch() int64 {
+	return t.clock.Now().UnixNano() / int64(t.epoch)
+}
+
+// Admit counts a request in the current epoch, the requests over the limit
+// are deferred. throttled is true for the first request deferred in an epoch,
+// when the throttling activates.
+func (t *Throttle) Admit(ctx context.Context, contactPK string, displayName string) (admitted bool, throttled bool, err error) {
+	if contactPK == "" {
+		return false, false, errcode.ErrMissingInput.Wrap(fmt.Errorf("a contact is required"))
+	}
+
+	epoch := t.Epoch()
+
+	t.mu.Lock()
+	if epoch != t.current {
+		t.current, t.count = epoch, 0
+	}
+	t.count++
+	count, limit := t.count, t.limit
+	t.mu.Unlock()
+
+	if limit == 0 || count <= limit {
+		return true, false, nil
+	}
+
+	raw, err := json.Marshal(&Deferred{
+		ContactPK:   contactPK,
+		DisplayName: displayName,
+		ReceivedAt:  t.clock.Now(),
+		Epoch:       epoch,
+	})
+	if err != nil {
+		return false, false, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := t.ds.Put(ctx, datastore.NewKey(contactPK), raw); err != nil {
+		return false, false, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return false, count == limit+1, nil
+}
+
+// Backlog returns the deferred requests, the oldest first.
+func (t *Throttle) Backlog(ctx context.Context) ([]*Deferred, error) {
+	results, err := t.ds.Query(ctx, query.Query{})
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	defer results.Close()
+
+	backlog := []*Deferred{}
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, errcode.ErrDBRead.Wrap(result.Error)
+		}
+
+		d := &Deferred{}
+		if err := json.Unmarshal(result.Value, d); err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+		backlog = append(backlog, d)
+	}
+
+	sort.SliceStable(backlog, func(i, j int) bool {
+		return backlog[i].ReceivedAt.Before(backlog[j].ReceivedAt)
+	})
+
+	return backlog, nil
+}
+
+// Remove takes a request out of the backlog once reviewed, it fails with
+// ErrNotFound when the request is not deferred.
+func (t *Throttle) Remove(ctx context.Context, contactPK string) (*Deferred, error) {
+	if contactPK == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a contact is required"))
+	}
+
+	key := datastore.NewKey(contactPK)
+	raw, err := t.ds.Get(ctx, key)
+	if err == datastore.ErrNotFound {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("no deferred request from contact %q", contactPK))
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	d := &Deferred{}
+	if err := json.Unmarshal(raw, d); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if err := t.ds.Delete(ctx, key); err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,95 @@
+package contactthrottle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestThrottle(t *testing.T) {
+	ctx := context.Background()
+	mock := clock.NewMock()
+	mock.Set(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC))
+	th, err := New(ds_sync.MutexWrap(datastore.NewMapDatastore()), 2, time.Hour)
+	require.NoError(t, err)
+	th.SetClock(mock)
+
+	for _, contact := range []string{"alice", "bob"} {
+		admitted, throttled, err := th.Admit(ctx, contact, "")
+		require.NoError(t, err)
+		require.True(t, admitted)
+		require.False(t, throttled)
+	}
+
+	// the throttling activates on the first request over the limit
+	mock.Add(time.Minute)
+	admitted, throttled, err := th.Admit(ctx, "carol", "Carol")
+	require.NoError(t, err)
+	require.False(t, admitted)
+	require.True(t, throttled)
+
+	mock.Add(time.Minute)
+	admitted, throttled, err = th.Admit(ctx, "dave", "Dave")
+	require.NoError(t, err)
+	require.False(t, admitted)
+	require.False(t, throttled)
+
+	backlog, err := th.Backlog(ctx)
+	require.NoError(t, err)
+	require.Len(t, backlog, 2)
+	require.Equal(t, "carol", backlog[0].ContactPK)
+	require.Equal(t, "Carol", backlog[0].DisplayName)
+	require.Equal(t, th.Epoch(), backlog[0].Epoch)
+	require.Equal(t, "dave", backlog[1].ContactPK)
+
+	// the count starts over in the next epoch
+	mock.Add(time.Hour)
+	admitted, _, err = th.Admit(ctx, "erin", "")
+	require.NoError(t, err)
+	require.True(t, admitted)
+
+	d, err := th.Remove(ctx, "carol")
+	require.NoError(t, err)
+	require.Equal(t, "carol", d.ContactPK)
+
+	_, err = th.Remove(ctx, "carol")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	backlog, err = th.Backlog(ctx)
+	require.NoError(t, err)
+	require.Len(t, backlog, 1)
+
+	// a new limit applies to the requests of the current epoch
+	require.NoError(t, th.SetLimit(1))
+	require.Equal(t, 1, th.Limit())
+	admitted, throttled, err = th.Admit(ctx, "frank", "")
+	require.NoError(t, err)
+	require.False(t, admitted)
+	require.True(t, throttled)
+
+	require.True(t, errcode.Is(th.SetLimit(-1), errcode.ErrInvalidInput))
+}
+
+func TestNoLimit(t *testing.T) {
+	ctx := context.Background()
+	th, err := New(datastore.NewMapDatastore(), 0, time.Hour)
+	require.NoError(t, err)
+
+	for i := 0; i < DefaultLimit*2; i++ {
+		admitted, _, err := th.Admit(ctx, "alice", "")
+		require.NoError(t, err)
+		require.True(t, admitted)
+	}
+
+	_, err = New(datastore.NewMapDatastore(), -1, time.Hour)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+	_, err = New(datastore.NewMapDatastore(), 1, 0)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
@@ -0,0 +1,137 @@
+package datastoreutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// DefaultMigrateBatchSize is the number of entries written at once.
+const DefaultMigrateBatchSize = 1000
+
+type MigrateOpts struct {
+	// BatchSize is DefaultMigrateBatchSize when zero.
+	BatchSize int
+	// Progress is called after each batch with the number of entries copied,
+	// then during the verification with the number of entries checked.
+	Progress func(step string, done int)
+	// SkipVerify does not read the copied entries back.
+	SkipVerify bool
+}
+
+// Migrate copies all the entries of src to dst, streaming them to keep the
+// memory usage low, then checks that dst holds the same entries. The number
+// of entries copied is returned. dst should be empty, its other entries are
+// kept.
+func Migrate(ctx context.Context, src ds.Datastore, dst ds.Batching, opts *MigrateOpts) (int, error) {
+	if opts == nil {
+		opts = &MigrateOpts{}
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultMigrateBatchSize
+	}
+	progress := opts.Progress
+	if progress == nil {
+		progress = func(string, int) {}
+	}
+
+	results, err := src.Query(ctx, query.Query{})
+	if err != nil {
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+	defer results.Close()
+
+	copied, pending := 0, 0
+	batch, err := dst.Batch(ctx)
+	if err != nil {
+		return 0, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	for result := range results.Next() {
+		if result.Error != nil {
+			return copied, errcode.ErrDBRead.Wrap(result.Error)
+		}
+
+		if err := batch.Put(ctx, ds.NewKey(result.Key), result.Value); err != nil {
+			return copied, errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if pending++; pending < batchSize {
+			continue
+		}
+
+		if err := batch.Commit(ctx); err != nil {
+			return copied, errcode.ErrDBWrite.Wrap(err)
+		}
+		copied += pending
+		pending = 0
+		progress("copy", copied)
+
+		if batch, err = dst.Batch(ctx); err != nil {
+			return copied, errcode.ErrDBWrite.Wrap(err)
+		}
+	}
+
+	if err := batch.Commit(ctx); err != nil {
+		return copied, errcode.ErrDBWrite.Wrap(err)
+	}
+	copied += pending
+	progress("copy", copied)
+
+	if err := dst.Sync(ctx, ds.NewKey("/")); err != nil {
+		return copied, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	if opts.SkipVerify {
+		return copied, nil
+	}
+
+	checked, err := verifyMigration(ctx, src, dst, batchSize, progress)
+	if err != nil {
+		return copied, err
+	}
+
+	if checked != copied {
+		return copied, errcode.ErrDBRead.Wrap(fmt.Errorf("%d entries copied but %d read back, the source changed during the migration", copied, checked))
+	}
+
+	return copied, nil
+}
+
+// verifyMigration checks that every entry of src is stored as is in dst.
+func verifyMigration(ctx context.Context, src ds.Datastore, dst ds.Datastore, batchSize int, progress func(string, int)) (int, error) {
+	results, err := src.Query(ctx, query.Query{})
+	if err != nil {
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+	defer results.Close()
+
+	checked := 0
+	for result := range results.Next() {
+		if result.Error != nil {
+			return checked, errcode.ErrDBRead.Wrap(result.Error)
+		}
+
+		value, err := dst.Get(ctx, ds.NewKey(result.Key))
+		if err != nil {
+			return checked, errcode.ErrDBRead.Wrap(fmt.Errorf("entry %s not copied: %w", result.Key, err))
+		}
+
+		if !bytes.Equal(value, result.Value) {
+			return checked, errcode.ErrDBRead.Wrap(fmt.Errorf("entry %s differs from the source", result.Key))
+		}
+
+		if checked++; checked%batchSize == 0 {
+			progress("verify", checked)
+		}
+	}
+	progress("verify", checked)
+
+	return checked, nil
+}
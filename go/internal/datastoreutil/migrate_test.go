@@ -0,0 +1,61 @@
+package datastoreutil
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	src := ds_sync.MutexWrap(ds.NewMapDatastore())
+	for i := 0; i < 25; i++ {
+		require.NoError(t, src.Put(ctx, ds.NewKey(fmt.Sprintf("/ns/key-%d", i)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+
+	dst := ds_sync.MutexWrap(ds.NewMapDatastore())
+	steps := map[string]int{}
+	copied, err := Migrate(ctx, src, dst, &MigrateOpts{
+		BatchSize: 10,
+		Progress:  func(step string, done int) { steps[step] = done },
+	})
+	require.NoError(t, err)
+	require.Equal(t, 25, copied)
+	require.Equal(t, map[string]int{"copy": 25, "verify": 25}, steps)
+
+	value, err := dst.Get(ctx, ds.NewKey("/ns/key-12"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value-12"), value)
+}
+
+// corruptingDatastore alters the values written to it.
+type corruptingDatastore struct {
+	ds.Batching
+}
+
+func (c *corruptingDatastore) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	value, err := c.Batching.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return append(value, '!'), nil
+}
+
+func TestMigrateVerify(t *testing.T) {
+	ctx := context.Background()
+
+	src := ds_sync.MutexWrap(ds.NewMapDatastore())
+	require.NoError(t, src.Put(ctx, ds.NewKey("/key"), []byte("value")))
+
+	dst := &corruptingDatastore{Batching: ds_sync.MutexWrap(ds.NewMapDatastore())}
+	_, err := Migrate(ctx, src, dst, nil)
+	require.Error(t, err)
+
+	_, err = Migrate(ctx, src, dst, &MigrateOpts{SkipVerify: true})
+	require.NoError(t, err)
+}
@@ -0,0 +1,160 @@
+// Package deliverystatus tells apart the steps of the delivery of the
+// messages sent by the account: a message is sent once it is in the log of
+// its conversation, stored once a replication server of the conversation
+// acknowledged it, it then reaches the recipients while the sender is
+// offline, and delivered once a device of a recipient acknowledged it.
+//
+// The acknowledgements of the replication servers are kept in memory, the
+// servers are asked again after a restart.
+package deliverystatus
+
+import (
+	"fmt"
+	"sync"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// State is a step of the delivery of a message.
+type State int
+
+const (
+	// StateUnknown is the state of the interactions which are not messages
+	// of the account.
+	StateUnknown State = iota
+	StateSent
+	StateStored
+	StateDelivered
+)
+
+var stateNames = map[State]string{
+	StateUnknown:   "unknown",
+	StateSent:      "sent",
+	StateStored:    "stored",
+	StateDelivered: "delivered",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Symbol returns the mark shown next to a message in the given state.
+func (s State) Symbol() string {
+	switch s {
+	case StateSent:
+		return "✓"
+	case StateStored:
+		return "☁"
+	case StateDelivered:
+		return "✓✓"
+	default:
+		return ""
+	}
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *State) UnmarshalText(text []byte) error {
+	for state, name := range stateNames {
+		if name == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return errcode.ErrDeserialization.Wrap(fmt.Errorf("unknown delivery state %q", text))
+}
+
+// Of returns the state of an interaction, stored tells whether a replication
+// server acknowledged it.
+func Of(i *messengertypes.Interaction, stored bool) State {
+	switch {
+	case !i.GetIsMine() || i.GetType() != messengertypes.AppMessage_TypeUserMessage:
+		return StateUnknown
+	case i.GetAcknowledged():
+		return StateDelivered
+	case stored:
+		return StateStored
+	default:
+		return StateSent
+	}
+}
+
+// Tracker records the messages acknowledged by the replication servers, by
+// conversation.
+type Tracker struct {
+	mu     sync.Mutex
+	stored map[string]map[string]struct{}
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{stored: make(map[string]map[string]struct{})}
+}
+
+// MarkStored records the messages of a conversation acknowledged by a
+// replication server, it returns the ones which were not acknowledged
+// before.
+func (t *Tracker) MarkStored(conversationPK string, cids []string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stored, ok := t.stored[conversationPK]
+	if !ok {
+		stored = make(map[string]struct{})
+		t.stored[conversationPK] = stored
+	}
+
+	added := []string{}
+	for _, cid := range cids {
+		if _, ok := stored[cid]; !ok {
+			stored[cid] = struct{}{}
+			added = append(added, cid)
+		}
+	}
+
+	return added
+}
+
+// IsStored returns true when a replication server acknowledged a message of
+// a conversation, it is false for nil trackers.
+func (t *Tracker) IsStored(conversationPK, cid string) bool {
+	if t == nil {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.stored[conversationPK][cid]
+	return ok
+}
+
+// Retain forgets the messages of a conversation which are not in cids, e.g.
+// the ones delivered since they were stored.
+func (t *Tracker) Retain(conversationPK string, cids []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stored, ok := t.stored[conversationPK]
+	if !ok {
+		return
+	}
+
+	keep := make(map[string]struct{}, len(cids))
+	for _, cid := range cids {
+		if _, ok := stored[cid]; ok {
+			keep[cid] = struct{}{}
+		}
+	}
+
+	if len(keep) == 0 {
+		delete(t.stored, conversationPK)
+		return
+	}
+	t.stored[conversationPK] = keep
+}
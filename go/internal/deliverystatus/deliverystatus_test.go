@@ -0,0 +1,59 @@
+package deliverystatus
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestOf(t *testing.T) {
+	message := &messengertypes.Interaction{Type: messengertypes.AppMessage_TypeUserMessage, IsMine: true}
+	require.Equal(t, StateSent, Of(message, false))
+	require.Equal(t, StateStored, Of(message, true))
+
+	message.Acknowledged = true
+	require.Equal(t, StateDelivered, Of(message, true))
+
+	received := &messengertypes.Interaction{Type: messengertypes.AppMessage_TypeUserMessage}
+	require.Equal(t, StateUnknown, Of(received, true))
+
+	reaction := &messengertypes.Interaction{Type: messengertypes.AppMessage_TypeUserReaction, IsMine: true}
+	require.Equal(t, StateUnknown, Of(reaction, false))
+}
+
+func TestStateJSON(t *testing.T) {
+	raw, err := json.Marshal(map[string]State{"cid": StateStored})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"cid": "stored"}`, string(raw))
+
+	states := map[string]State{}
+	require.NoError(t, json.Unmarshal(raw, &states))
+	require.Equal(t, StateStored, states["cid"])
+
+	require.Error(t, json.Unmarshal([]byte(`{"cid": "lost"}`), &states))
+	require.Equal(t, "☁", StateStored.Symbol())
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker()
+
+	require.Equal(t, []string{"a", "b"}, tracker.MarkStored("conv", []string{"a", "b"}))
+	require.Equal(t, []string{"c"}, tracker.MarkStored("conv", []string{"b", "c"}))
+	require.True(t, tracker.IsStored("conv", "a"))
+	require.False(t, tracker.IsStored("other", "a"))
+
+	// b was delivered meanwhile
+	tracker.Retain("conv", []string{"a", "c", "d"})
+	require.True(t, tracker.IsStored("conv", "a"))
+	require.False(t, tracker.IsStored("conv", "b"))
+	require.False(t, tracker.IsStored("conv", "d"))
+
+	tracker.Retain("conv", nil)
+	require.False(t, tracker.IsStored("conv", "a"))
+
+	var none *Tracker
+	require.False(t, none.IsStored("conv", "a"))
+}
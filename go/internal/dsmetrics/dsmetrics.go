@@ -0,0 +1,165 @@
+// Package dsmetrics instruments a datastore with prometheus metrics: the
+// number of operations and their latency, by operation and by namespace,
+// e.g. the blocks of the IPFS node or the orbitdb logs.
+//
+// The namespace of a key is its first component, the keys without a
+// namespace are counted in RootNamespace. The latency of a query does not
+// include the iteration of its results.
+package dsmetrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RootNamespace is the namespace of the keys at the root of the datastore.
+const RootNamespace = "root"
+
+const (
+	opGet     = "get"
+	opHas     = "has"
+	opGetSize = "get_size"
+	opQuery   = "query"
+	opPut     = "put"
+	opDelete  = "delete"
+	opCommit  = "commit"
+)
+
+// Datastore records the operations on the datastore it wraps, it is a
+// prometheus collector.
+type Datastore struct {
+	datastore.Batching
+
+	operations *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+}
+
+var (
+	_ datastore.Batching   = (*Datastore)(nil)
+	_ prometheus.Collector = (*Datastore)(nil)
+)
+
+// Wrap returns ds recording its operations.
+func Wrap(ds datastore.Batching) *Datastore {
+	return &Datastore{
+		Batching: ds,
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "berty_datastore_operations_total",
+			Help: "Operations on the root datastore by key namespace, the batched writes are counted when committed.",
+		}, []string{"namespace", "operation"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "berty_datastore_operation_duration_seconds",
+			Help:    "Latency of the operations on the root datastore by key namespace.",
+			Buckets: prometheus.ExponentialBuckets(0.00005, 4, 10),
+		}, []string{"namespace", "operation"}),
+	}
+}
+
+// Namespace returns the namespace of key the operations on it are recorded
+// with.
+func Namespace(key string) string {
+	key = strings.TrimPrefix(key, "/")
+
+	i := strings.IndexByte(key, '/')
+	if i <= 0 {
+		return RootNamespace
+	}
+
+	return key[:i]
+}
+
+func (d *Datastore) observe(namespace, op string, start time.Time) {
+	d.operations.WithLabelValues(namespace, op).Inc()
+	d.latency.WithLabelValues(namespace, op).Observe(time.Since(start).Seconds())
+}
+
+func (d *Datastore) Get(ctx context.Context, key datastore.Key) ([]byte, error) {
+	defer d.observe(Namespace(key.String()), opGet, time.Now())
+	return d.Batching.Get(ctx, key)
+}
+
+func (d *Datastore) Has(ctx context.Context, key datastore.Key) (bool, error) {
+	defer d.observe(Namespace(key.String()), opHas, time.Now())
+	return d.Batching.Has(ctx, key)
+}
+
+func (d *Datastore) GetSize(ctx context.Context, key datastore.Key) (int, error) {
+	defer d.observe(Namespace(key.String()), opGetSize, time.Now())
+	return d.Batching.GetSize(ctx, key)
+}
+
+func (d *Datastore) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	// a query on the whole datastore has no namespace either
+	defer d.observe(Namespace(q.Prefix+"/"), opQuery, time.Now())
+	return d.Batching.Query(ctx, q)
+}
+
+func (d *Datastore) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	defer d.observe(Namespace(key.String()), opPut, time.Now())
+	return d.Batching.Put(ctx, key, value)
+}
+
+func (d *Datastore) Delete(ctx context.Context, key datastore.Key) error {
+	defer d.observe(Namespace(key.String()), opDelete, time.Now())
+	return d.Batching.Delete(ctx, key)
+}
+
+func (d *Datastore) Batch(ctx context.Context) (datastore.Batch, error) {
+	b, err := d.Batching.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &batch{Batch: b, ds: d, ops: make(map[[2]string]int)}, nil
+}
+
+func (d *Datastore) Describe(ch chan<- *prometheus.Desc) {
+	d.operations.Describe(ch)
+	d.latency.Describe(ch)
+}
+
+func (d *Datastore) Collect(ch chan<- prometheus.Metric) {
+	d.operations.Collect(ch)
+	d.latency.Collect(ch)
+}
+
+// batch counts the writes of a batch, they are recorded once committed.
+type batch struct {
+	datastore.Batch
+
+	ds  *Datastore
+	ops map[[2]string]int
+}
+
+func (b *batch) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	b.ops[[2]string{Namespace(key.String()), opPut}]++
+	return b.Batch.Put(ctx, key, value)
+}
+
+func (b *batch) Delete(ctx context.Context, key datastore.Key) error {
+	b.ops[[2]string{Namespace(key.String()), opDelete}]++
+	return b.Batch.Delete(ctx, key)
+}
+
+func (b *batch) Commit(ctx context.Context) error {
+	start := time.Now()
+	err := b.Batch.Commit(ctx)
+	elapsed := time.Since(start).Seconds()
+
+	namespaces := make(map[string]struct{})
+	for op, count := range b.ops {
+		b.ds.operations.WithLabelValues(op[0], op[1]).Add(float64(count))
+		namespaces[op[0]] = struct{}{}
+	}
+	for namespace := range namespaces {
+		b.ds.latency.WithLabelValues(namespace, opCommit).Observe(elapsed)
+	}
+	b.ops = make(map[[2]string]int)
+
+	return err
+}
@@ -0,0 +1,94 @@
+package dsmetrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespace(t *testing.T) {
+	for key, expected := range map[string]string{
+		"/blocks/CIQ":         "blocks",
+		"/orbitdb/log/head":   "orbitdb",
+		"/keys":               RootNamespace,
+		"/":                   RootNamespace,
+		"":                    RootNamespace,
+		"ipfs/blocks/CIQ/abc": "ipfs",
+	} {
+		require.Equal(t, expected, Namespace(key), key)
+	}
+}
+
+func TestDatastore(t *testing.T) {
+	ctx := context.Background()
+	ds := Wrap(dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	require.NoError(t, ds.Put(ctx, datastore.NewKey("/blocks/a"), []byte("a")))
+	require.NoError(t, ds.Put(ctx, datastore.NewKey("/blocks/b"), []byte("b")))
+	require.NoError(t, ds.Put(ctx, datastore.NewKey("/orbitdb/a"), []byte("a")))
+
+	value, err := ds.Get(ctx, datastore.NewKey("/blocks/a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("a"), value)
+
+	_, err = ds.Get(ctx, datastore.NewKey("/keys/missing"))
+	require.ErrorIs(t, err, datastore.ErrNotFound)
+
+	results, err := ds.Query(ctx, query.Query{Prefix: "/blocks"})
+	require.NoError(t, err)
+	entries, err := results.Rest()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	b, err := ds.Batch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, b.Put(ctx, datastore.NewKey("/orbitdb/b"), []byte("b")))
+	require.NoError(t, b.Delete(ctx, datastore.NewKey("/blocks/a")))
+
+	// the batched writes are counted once committed
+	require.Equal(t, 1.0, testutil.ToFloat64(ds.operations.WithLabelValues("orbitdb", opPut)))
+	require.NoError(t, b.Commit(ctx))
+
+	has, err := ds.Has(ctx, datastore.NewKey("/blocks/a"))
+	require.NoError(t, err)
+	require.False(t, has)
+
+	for labels, expected := range map[[2]string]float64{
+		{"blocks", opPut}:    2,
+		{"blocks", opGet}:    1,
+		{"blocks", opQuery}:  1,
+		{"blocks", opDelete}: 1,
+		{"blocks", opHas}:    1,
+		{"orbitdb", opPut}:   2,
+		{"keys", opGet}:      1,
+	} {
+		require.Equal(t, expected, testutil.ToFloat64(ds.operations.WithLabelValues(labels[0], labels[1])), labels)
+	}
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(ds))
+
+	count, err := testutil.GatherAndCount(registry, "berty_datastore_operations_total", "berty_datastore_operation_duration_seconds")
+	require.NoError(t, err)
+	// the latency of the commits is recorded for blocks and orbitdb
+	require.Equal(t, 7+8, count)
+
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP berty_datastore_operations_total Operations on the root datastore by key namespace, the batched writes are counted when committed.
+# TYPE berty_datastore_operations_total counter
+berty_datastore_operations_total{namespace="blocks",operation="delete"} 1
+berty_datastore_operations_total{namespace="blocks",operation="get"} 1
+berty_datastore_operations_total{namespace="blocks",operation="has"} 1
+berty_datastore_operations_total{namespace="blocks",operation="put"} 2
+berty_datastore_operations_total{namespace="blocks",operation="query"} 1
+berty_datastore_operations_total{namespace="keys",operation="get"} 1
+berty_datastore_operations_total{namespace="orbitdb",operation="put"} 2
+`), "berty_datastore_operations_total"))
+}
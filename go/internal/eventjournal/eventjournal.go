@@ -0,0 +1,434 @@
+// Package eventjournal keeps a rolling journal of the protocol events of an
+// account: the groups joined and left, the devices added to the groups, the
+// key rotations and the contact events.
+//
+// Each event gets a sequence number. A client that stored the last one it
+// processed replays the journal from it after a downtime, and rebuilds its
+// state in the order the node saw the events. The metadata logs are replayed
+// from their start at every subscription, the events are recorded once by
+// ID.
+package eventjournal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// Kind is the kind of a journal event.
+type Kind string
+
+const (
+	KindGroupJoined       Kind = "group_joined"
+	KindGroupLeft         Kind = "group_left"
+	KindMemberDeviceAdded Kind = "member_device_added"
+	KindChainKeyAdded     Kind = "chain_key_added"
+	KindContactEnqueued   Kind = "contact_request_enqueued"
+	KindContactSent       Kind = "contact_request_sent"
+	KindContactReceived   Kind = "contact_request_received"
+	KindContactAccepted   Kind = "contact_request_accepted"
+	KindContactDiscarded  Kind = "contact_request_discarded"
+	KindContactBlocked    Kind = "contact_blocked"
+	KindContactUnblocked  Kind = "contact_unblocked"
+
+	// KindKeyRotated is recorded by the node itself when it goes through
+	// the key exchange of a group again, the chain keys sent to the members
+	// follow as KindChainKeyAdded.
+	KindKeyRotated Kind = "key_rotated"
+)
+
+const (
+	// DefaultMaxEntries is the number of events kept by a journal, the
+	// oldest ones are pruned.
+	DefaultMaxEntries = 10000
+
+	// DefaultReplayLimit is the number of events returned by Replay when its
+	// limit is zero, MaxReplayLimit bounds it.
+	DefaultReplayLimit = 500
+	MaxReplayLimit     = 5000
+
+	// DatastorePrefix is the datastore namespace of the journal.
+	DatastorePrefix = "/event_journal"
+)
+
+var (
+	entriesPrefix = datastore.NewKey(DatastorePrefix).ChildString("entries")
+	// the IDs of the recorded events outlive their pruned entries, the
+	// replayed metadata logs would record them again otherwise
+	idsPrefix = datastore.NewKey(DatastorePrefix).ChildString("ids")
+)
+
+// Entry is a recorded event.
+type Entry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Kind Kind      `json:"kind"`
+	// GroupPK is the group of the event, base64 encoded.
+	GroupPK string `json:"groupPK,omitempty"`
+	// EventID is the ID of the metadata event, base64 encoded. It is empty
+	// for the events of the node itself.
+	EventID string `json:"eventID,omitempty"`
+	// Details are the public keys referenced by the event, base64 encoded,
+	// e.g. "member" and "device" for KindMemberDeviceAdded.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+func entryKey(seq uint64) datastore.Key {
+	// zero padded for the entries to be listed in order
+	return entriesPrefix.ChildString(fmt.Sprintf("%020d", seq))
+}
+
+func idKey(eventID string) datastore.Key {
+	return idsPrefix.ChildString(eventID)
+}
+
+type unmarshaler interface {
+	Unmarshal([]byte) error
+}
+
+// decoders are the journaled metadata events, details returns the public
+// keys of the decoded event.
+var decoders = map[protocoltypes.EventType]struct {
+	kind    Kind
+	new     func() unmarshaler
+	details func(ev unmarshaler) map[string][]byte
+}{
+	protocoltypes.EventTypeAccountGroupJoined: {
+		KindGroupJoined,
+		func() unmarshaler { return &protocoltypes.AccountGroupJoined{} },
+		func(ev unmarshaler) map[string][]byte {
+			return map[string][]byte{"group": ev.(*protocoltypes.AccountGroupJoined).GetGroup().GetPublicKey()}
+		},
+	},
+	protocoltypes.EventTypeAccountGroupLeft: {
+		KindGroupLeft,
+		func() unmarshaler { return &protocoltypes.AccountGroupLeft{} },
+		func(ev unmarshaler) map[string][]byte {
+			return map[string][]byte{"group": ev.(*protocoltypes.AccountGroupLeft).GetGroupPK()}
+		},
+	},
+	protocoltypes.EventTypeGroupMemberDeviceAdded: {
+		KindMemberDeviceAdded,
+		func() unmarshaler { return &protocoltypes.GroupMemberDeviceAdded{} },
+		func(ev unmarshaler) map[string][]byte {
+			e := ev.(*protocoltypes.GroupMemberDeviceAdded)
+			return map[string][]byte{"member": e.GetMemberPK(), "device": e.GetDevicePK()}
+		},
+	},
+	protocoltypes.EventTypeGroupDeviceChainKeyAdded: {
+		KindChainKeyAdded,
+		func() unmarshaler { return &protocoltypes.GroupDeviceChainKeyAdded{} },
+		func(ev unmarshaler) map[string][]byte {
+			e := ev.(*protocoltypes.GroupDeviceChainKeyAdded)
+			return map[string][]byte{"device": e.GetDevicePK(), "destMember": e.GetDestMemberPK()}
+		},
+	},
+	protocoltypes.EventTypeAccountContactRequestOutgoingEnqueued: {
+		KindContactEnqueued,
+		func() unmarshaler { return &protocoltypes.AccountContactRequestOutgoingEnqueued{} },
+		func(ev unmarshaler) map[string][]byte {
+			return map[string][]byte{"contact": ev.(*protocoltypes.AccountContactRequestOutgoingEnqueued).GetContact().GetPK()}
+		},
+	},
+	protocoltypes.EventTypeAccountContactRequestOutgoingSent: {
+		KindContactSent,
+		func() unmarshaler { return &protocoltypes.AccountContactRequestOutgoingSent{} },
+		func(ev unmarshaler) map[string][]byte {
+			return map[string][]byte{"contact": ev.(*protocoltypes.AccountContactRequestOutgoingSent).GetContactPK()}
+		},
+	},
+	protocoltypes.EventTypeAccountContactRequestIncomingReceived: {
+		KindContactReceived,
+		func() unmarshaler { return &protocoltypes.AccountContactRequestIncomingReceived{} },
+		func(ev unmarshaler) map[string][]byte {
+			return map[string][]byte{"contact": ev.(*protocoltypes.AccountContactRequestIncomingReceived).GetContactPK()}
+		},
+	},
+	protocoltypes.EventTypeAccountContactRequestIncomingAccepted: {
+		KindContactAccepted,
+		func() unmarshaler { return &protocoltypes.AccountContactRequestIncomingAccepted{} },
+		func(ev unmarshaler) map[string][]byte {
+			return map[string][]byte{"contact": ev.(*protocoltypes.AccountContactRequestIncomingAccepted).GetContactPK()}
+		},
+	},
+	protocoltypes.EventTypeAccountContactRequestIncomingDiscarded: {
+		KindContactDiscarded,
+		func() unmarshaler { return &protocoltypes.AccountContactRequestIncomingDiscarded{} },
+		func(ev unmarshaler) map[string][]byte {
+			return map[string][]byte{"contact": ev.(*protocoltypes.AccountContactRequestIncomingDiscarded).GetContactPK()}
+		},
+	},
+	protocoltypes.EventTypeAccountContactBlocked: {
+		KindContactBlocked,
+		func() unmarshaler { return &protocoltypes.AccountContactBlocked{} },
+		func(ev unmarshaler) map[string][]byte {
+			return map[string][]byte{"contact": ev.(*protocoltypes.AccountContactBlocked).GetContactPK()}
+		},
+	},
+	protocoltypes.EventTypeAccountContactUnblocked: {
+		KindContactUnblocked,
+		func() unmarshaler { return &protocoltypes.AccountContactUnblocked{} },
+		func(ev unmarshaler) map[string][]byte {
+			return map[string][]byte{"contact": ev.(*protocoltypes.AccountContactUnblocked).GetContactPK()}
+		},
+	},
+}
+
+// FromMetadataEvent returns the entry of gme, without sequence number nor
+// time. It returns nil when the kind of event is not journaled.
+func FromMetadataEvent(gme *protocoltypes.GroupMetadataEvent) (*Entry, error) {
+	eventType := gme.GetMetadata().GetEventType()
+	decoder, ok := decoders[eventType]
+	if !ok {
+		return nil, nil
+	}
+
+	ev := decoder.new()
+	if err := ev.Unmarshal(gme.GetEvent()); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("unable to decode %s: %w", eventType, err))
+	}
+
+	entry := &Entry{
+		Kind:    decoder.kind,
+		GroupPK: messengerutil.B64EncodeBytes(gme.GetEventContext().GetGroupPK()),
+		EventID: messengerutil.B64EncodeBytes(gme.GetEventContext().GetID()),
+		Details: map[string]string{},
+	}
+	for name, pk := range decoder.details(ev) {
+		if len(pk) != 0 {
+			entry.Details[name] = messengerutil.B64EncodeBytes(pk)
+		}
+	}
+
+	return entry, nil
+}
+
+// Journal records the events of an account. A nil Journal is valid and
+// records nothing.
+type Journal struct {
+	ds         datastore.Datastore
+	maxEntries int
+
+	mu sync.Mutex
+	// first and last are the sequence numbers of the kept entries, first is
+	// last+1 when the journal is empty
+	first, last uint64
+}
+
+// Open resumes the journal stored in ds after its last entry, it keeps
+// maxEntries events, DefaultMaxEntries when zero.
+func Open(ctx context.Context, ds datastore.Datastore, maxEntries int) (*Journal, error) {
+	if ds == nil {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("missing datastore"))
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+
+	j := &Journal{ds: ds, maxEntries: maxEntries}
+
+	first, err := j.edge(ctx, query.OrderByKey{})
+	if err != nil {
+		return nil, err
+	}
+	last, err := j.edge(ctx, query.OrderByKeyDescending{})
+	if err != nil {
+		return nil, err
+	}
+
+	if first == nil || last == nil {
+		j.first = 1
+	} else {
+		j.first, j.last = first.Seq, last.Seq
+	}
+
+	return j, nil
+}
+
+// edge returns the first entry in order, nil when there is none.
+func (j *Journal) edge(ctx context.Context, order query.Order) (*Entry, error) {
+	entries, err := j.query(ctx, query.Query{
+		Prefix: entriesPrefix.String(),
+		Orders: []query.Order{order},
+		Limit:  1,
+	})
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	return entries[0], nil
+}
+
+func (j *Journal) query(ctx context.Context, q query.Query) ([]*Entry, error) {
+	res, err := j.ds.Query(ctx, q)
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	defer res.Close()
+
+	entries := []*Entry{}
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, errcode.ErrDBRead.Wrap(r.Error)
+		}
+
+		entry := &Entry{}
+		if err := json.Unmarshal(r.Value, entry); err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Record appends the entry of gme, see FromMetadataEvent. It returns nil
+// when the event is not journaled or was already recorded.
+func (j *Journal) Record(ctx context.Context, gme *protocoltypes.GroupMetadataEvent) (*Entry, error) {
+	if j == nil {
+		return nil, nil
+	}
+
+	entry, err := FromMetadataEvent(gme)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	return j.Append(ctx, entry)
+}
+
+// Append records entry with the next sequence number, and the current time
+// if it has none. It returns nil when an entry with the same EventID was
+// already recorded.
+func (j *Journal) Append(ctx context.Context, entry *Entry) (*Entry, error) {
+	if j == nil {
+		return nil, nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entry.EventID != "" {
+		switch _, err := j.ds.Get(ctx, idKey(entry.EventID)); err {
+		case nil:
+			return nil, nil
+		case datastore.ErrNotFound:
+		default:
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+	}
+
+	recorded := *entry
+	recorded.Seq = j.last + 1
+	if recorded.Time.IsZero() {
+		recorded.Time = time.Now().UTC()
+	}
+
+	raw, err := json.Marshal(&recorded)
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := j.ds.Put(ctx, entryKey(recorded.Seq), raw); err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+	if recorded.EventID != "" {
+		if err := j.ds.Put(ctx, idKey(recorded.EventID), nil); err != nil {
+			return nil, errcode.ErrDBWrite.Wrap(err)
+		}
+	}
+	j.last = recorded.Seq
+
+	if err := j.prune(ctx); err != nil {
+		return nil, err
+	}
+
+	return &recorded, nil
+}
+
+// prune removes the oldest entries over maxEntries, it must be called with
+// the lock held.
+func (j *Journal) prune(ctx context.Context) error {
+	for j.last-j.first+1 > uint64(j.maxEntries) {
+		if err := j.ds.Delete(ctx, entryKey(j.first)); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+		j.first++
+	}
+
+	return nil
+}
+
+// Page is a range of the journal.
+type Page struct {
+	Events []*Entry `json:"events"`
+	// First is the sequence number of the oldest event kept, a client that
+	// processed the events before it can still replay the journal.
+	First uint64 `json:"first"`
+	// Last is the sequence number of the last event recorded, the journal
+	// has more events to replay when it is after the last of Events.
+	Last uint64 `json:"last"`
+	// Pruned is true when events after the replayed sequence number were
+	// pruned, Events is empty. The client has to rebuild its state from the
+	// messenger, then replay the journal from Last.
+	Pruned bool `json:"pruned,omitempty"`
+}
+
+// Replay returns the events recorded after the sequence number since, at
+// most limit of them, from the first one kept when since is zero.
+func (j *Journal) Replay(ctx context.Context, since uint64, limit int) (*Page, error) {
+	if j == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("no event journal"))
+	}
+
+	switch {
+	case limit <= 0:
+		limit = DefaultReplayLimit
+	case limit > MaxReplayLimit:
+		limit = MaxReplayLimit
+	}
+
+	j.mu.Lock()
+	first, last := j.first, j.last
+	j.mu.Unlock()
+
+	page := &Page{Events: []*Entry{}, First: first, Last: last}
+	switch {
+	case since > last:
+		return nil, errcode.ErrInvalidRange.Wrap(fmt.Errorf("event %d was not recorded, the last one is %d", since, last))
+	case since != 0 && since+1 < first:
+		page.Pruned = true
+		return page, nil
+	case since == 0:
+		since = first - 1
+	case since == last:
+		return page, nil
+	}
+
+	entries, err := j.query(ctx, query.Query{
+		Prefix: entriesPrefix.String(),
+		Orders: []query.Order{query.OrderByKey{}},
+		Offset: int(since + 1 - first),
+		Limit:  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the entries pruned meanwhile shifted the offset
+	if len(entries) != 0 && entries[0].Seq != since+1 {
+		return j.Replay(ctx, since, limit)
+	}
+
+	page.Events = entries
+	return page, nil
+}
@@ -0,0 +1,156 @@
+package eventjournal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+func testEvent(t *testing.T, id string, eventType protocoltypes.EventType, event interface{ Marshal() ([]byte, error) }) *protocoltypes.GroupMetadataEvent {
+	t.Helper()
+
+	payload, err := event.Marshal()
+	require.NoError(t, err)
+
+	return &protocoltypes.GroupMetadataEvent{
+		EventContext: &protocoltypes.EventContext{ID: []byte(id), GroupPK: []byte("group")},
+		Metadata:     &protocoltypes.GroupMetadata{EventType: eventType},
+		Event:        payload,
+	}
+}
+
+func TestFromMetadataEvent(t *testing.T) {
+	entry, err := FromMetadataEvent(testEvent(t, "a", protocoltypes.EventTypeGroupMemberDeviceAdded, &protocoltypes.GroupMemberDeviceAdded{MemberPK: []byte("member"), DevicePK: []byte("device")}))
+	require.NoError(t, err)
+	require.Equal(t, KindMemberDeviceAdded, entry.Kind)
+	require.Equal(t, messengerutil.B64EncodeBytes([]byte("group")), entry.GroupPK)
+	require.Equal(t, messengerutil.B64EncodeBytes([]byte("a")), entry.EventID)
+	require.Equal(t, map[string]string{
+		"member": messengerutil.B64EncodeBytes([]byte("member")),
+		"device": messengerutil.B64EncodeBytes([]byte("device")),
+	}, entry.Details)
+
+	// not journaled
+	entry, err = FromMetadataEvent(testEvent(t, "b", protocoltypes.EventTypeGroupMetadataPayloadSent, &protocoltypes.GroupMetadataPayloadSent{}))
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	_, err = FromMetadataEvent(&protocoltypes.GroupMetadataEvent{
+		Metadata: &protocoltypes.GroupMetadata{EventType: protocoltypes.EventTypeAccountContactBlocked},
+		Event:    []byte("invalid"),
+	})
+	require.True(t, errcode.Is(err, errcode.ErrDeserialization))
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.NewMapDatastore()
+
+	var nilJournal *Journal
+	entry, err := nilJournal.Append(ctx, &Entry{Kind: KindKeyRotated})
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	j, err := Open(ctx, ds, 0)
+	require.NoError(t, err)
+
+	page, err := j.Replay(ctx, 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, page.Events)
+	require.Equal(t, uint64(0), page.Last)
+
+	joined := testEvent(t, "joined", protocoltypes.EventTypeAccountGroupJoined, &protocoltypes.AccountGroupJoined{Group: &protocoltypes.Group{PublicKey: []byte("group")}})
+	entry, err = j.Record(ctx, joined)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), entry.Seq)
+	require.False(t, entry.Time.IsZero())
+
+	// the replayed metadata logs are recorded once
+	entry, err = j.Record(ctx, joined)
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	_, err = j.Append(ctx, &Entry{Kind: KindKeyRotated, GroupPK: "group"})
+	require.NoError(t, err)
+	_, err = j.Record(ctx, testEvent(t, "sent", protocoltypes.EventTypeAccountContactRequestOutgoingSent, &protocoltypes.AccountContactRequestOutgoingSent{ContactPK: []byte("contact")}))
+	require.NoError(t, err)
+
+	// the journal is resumed after its last entry
+	j, err = Open(ctx, ds, 0)
+	require.NoError(t, err)
+	entry, err = j.Record(ctx, joined)
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	page, err = j.Replay(ctx, 1, 0)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 2)
+	require.Equal(t, KindKeyRotated, page.Events[0].Kind)
+	require.Equal(t, KindContactSent, page.Events[1].Kind)
+	require.Equal(t, uint64(2), page.Events[0].Seq)
+	require.Equal(t, uint64(3), page.Last)
+
+	page, err = j.Replay(ctx, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	require.Equal(t, KindGroupJoined, page.Events[0].Kind)
+
+	page, err = j.Replay(ctx, 3, 0)
+	require.NoError(t, err)
+	require.Empty(t, page.Events)
+
+	_, err = j.Replay(ctx, 4, 0)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidRange))
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.NewMapDatastore()
+
+	j, err := Open(ctx, ds, 3)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err := j.Append(ctx, &Entry{Kind: KindKeyRotated, EventID: string(rune('a' + i))})
+		require.NoError(t, err)
+	}
+
+	page, err := j.Replay(ctx, 0, 0)
+	require.NoError(t, err)
+	require.False(t, page.Pruned)
+	require.Equal(t, uint64(3), page.First)
+	require.Equal(t, uint64(5), page.Last)
+	require.Len(t, page.Events, 3)
+	require.Equal(t, uint64(3), page.Events[0].Seq)
+
+	page, err = j.Replay(ctx, 2, 0)
+	require.NoError(t, err)
+	require.False(t, page.Pruned)
+	require.Len(t, page.Events, 3)
+
+	// the client missed the pruned events
+	page, err = j.Replay(ctx, 1, 0)
+	require.NoError(t, err)
+	require.True(t, page.Pruned)
+	require.Empty(t, page.Events)
+	require.Equal(t, uint64(5), page.Last)
+
+	// a pruned event is not recorded again
+	entry, err := j.Append(ctx, &Entry{Kind: KindKeyRotated, EventID: "a"})
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	// the bounds are resumed
+	j, err = Open(ctx, ds, 3)
+	require.NoError(t, err)
+	page, err = j.Replay(ctx, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), page.First)
+	require.Equal(t, uint64(5), page.Last)
+}
@@ -0,0 +1,209 @@
+// Package groupkeys reports the state of the chain keys exchanged between the
+// devices of a group, to diagnose members unable to decrypt messages.
+//
+// Each device sends its chain key to every member of the group, a message of
+// a device can only be decrypted by the members it sent its chain key to.
+package groupkeys
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	weshnet_errcode "berty.tech/weshnet/pkg/errcode"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// DeviceStatus is the key exchange state between the local device and
+// another device of the group.
+type DeviceStatus struct {
+	MemberPK []byte
+	DevicePK []byte
+	// Self is true for the other devices of the local member.
+	Self bool
+	// KeySent is true when the local device sent its chain key to the member
+	// of this device, which can then decrypt the local messages.
+	KeySent bool
+	// KeyReceived is true when this device sent its chain key to the local
+	// member, whose devices can then decrypt its messages.
+	KeyReceived bool
+}
+
+// Healthy returns true when the chain keys were exchanged both ways.
+func (d *DeviceStatus) Healthy() bool {
+	return d.KeySent && d.KeyReceived
+}
+
+// Report is the key exchange state of a group, seen by the local device.
+type Report struct {
+	GroupPK []byte
+	// Devices are the other devices of the group, ordered by member.
+	Devices []*DeviceStatus
+}
+
+// Unhealthy returns the devices missing a chain key in either direction.
+func (r *Report) Unhealthy() []*DeviceStatus {
+	unhealthy := []*DeviceStatus(nil)
+	for _, d := range r.Devices {
+		if !d.Healthy() {
+			unhealthy = append(unhealthy, d)
+		}
+	}
+
+	return unhealthy
+}
+
+// KeysExchanged returns true if the report lists a device of another member
+// and no device is missing a key, e.g. for a contact group.
+func (r *Report) KeysExchanged() bool {
+	otherMember := false
+	for _, d := range r.Devices {
+		if !d.Self {
+			otherMember = true
+		}
+	}
+
+	return otherMember && len(r.Unhealthy()) == 0
+}
+
+// Tracker builds a Report from the metadata events of a group.
+type Tracker struct {
+	groupPK  []byte
+	memberPK []byte
+	devicePK []byte
+
+	devices map[string]*protocoltypes.GroupMemberDeviceAdded
+	// member keys the local device sent its chain key to
+	sentTo map[string]bool
+	// device keys which sent their chain key to the local member
+	receivedFrom map[string]bool
+}
+
+// NewTracker returns a Tracker for the given group and local identity.
+func NewTracker(groupPK, memberPK, devicePK []byte) *Tracker {
+	return &Tracker{
+		groupPK:      groupPK,
+		memberPK:     memberPK,
+		devicePK:     devicePK,
+		devices:      map[string]*protocoltypes.GroupMemberDeviceAdded{},
+		sentTo:       map[string]bool{},
+		receivedFrom: map[string]bool{},
+	}
+}
+
+// HandleEvent accounts a metadata event of the group, events unrelated to
+// devices and chain keys are ignored.
+func (t *Tracker) HandleEvent(evt *protocoltypes.GroupMetadataEvent) error {
+	if evt.Metadata == nil {
+		return nil
+	}
+
+	switch evt.Metadata.EventType {
+	case protocoltypes.EventTypeGroupMemberDeviceAdded:
+		casted := &protocoltypes.GroupMemberDeviceAdded{}
+		if err := casted.Unmarshal(evt.Event); err != nil {
+			return errcode.ErrDeserialization.Wrap(err)
+		}
+
+		t.devices[string(casted.DevicePK)] = casted
+
+	case protocoltypes.EventTypeGroupDeviceChainKeyAdded:
+		casted := &protocoltypes.GroupDeviceChainKeyAdded{}
+		if err := casted.Unmarshal(evt.Event); err != nil {
+			return errcode.ErrDeserialization.Wrap(err)
+		}
+
+		if bytes.Equal(casted.DevicePK, t.devicePK) {
+			t.sentTo[string(casted.DestMemberPK)] = true
+		}
+
+		if bytes.Equal(casted.DestMemberPK, t.memberPK) {
+			t.receivedFrom[string(casted.DevicePK)] = true
+		}
+	}
+
+	return nil
+}
+
+// Report returns the state of the events handled so far.
+func (t *Tracker) Report() *Report {
+	report := &Report{GroupPK: t.groupPK}
+
+	for devicePK, device := range t.devices {
+		if devicePK == string(t.devicePK) {
+			continue
+		}
+
+		report.Devices = append(report.Devices, &DeviceStatus{
+			MemberPK:    device.MemberPK,
+			DevicePK:    device.DevicePK,
+			Self:        bytes.Equal(device.MemberPK, t.memberPK),
+			KeySent:     t.sentTo[string(device.MemberPK)],
+			KeyReceived: t.receivedFrom[devicePK],
+		})
+	}
+
+	sort.Slice(report.Devices, func(i, j int) bool {
+		if c := bytes.Compare(report.Devices[i].MemberPK, report.Devices[j].MemberPK); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(report.Devices[i].DevicePK, report.Devices[j].DevicePK) < 0
+	})
+
+	return report
+}
+
+// Status replays the metadata log of a group and reports its key exchange
+// state.
+func Status(ctx context.Context, client protocoltypes.ProtocolServiceClient, groupPK []byte) (*Report, error) {
+	info, err := client.GroupInfo(ctx, &protocoltypes.GroupInfo_Request{GroupPK: groupPK})
+	if err != nil {
+		return nil, weshnet_errcode.ErrGroupInfo.Wrap(err)
+	}
+
+	cl, err := client.GroupMetadataList(ctx, &protocoltypes.GroupMetadataList_Request{GroupPK: groupPK, UntilNow: true})
+	if err != nil {
+		return nil, errcode.ErrEventListMetadata.Wrap(err)
+	}
+
+	tracker := NewTracker(groupPK, info.MemberPK, info.DevicePK)
+	for {
+		evt, err := cl.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errcode.ErrEventListMetadata.Wrap(err)
+		}
+
+		if err := tracker.HandleEvent(evt); err != nil {
+			return nil, err
+		}
+	}
+
+	return tracker.Report(), nil
+}
+
+// Rekey closes and reopens the group so the local device goes through the
+// key exchange again and sends its chain key to the members missing it.
+//
+// The protocol has no chain key rotation, the current chain key is sent
+// again. Deactivating the group ends the streams opened on it, callers have
+// to subscribe again.
+func Rekey(ctx context.Context, client protocoltypes.ProtocolServiceClient, groupPK []byte) error {
+	if len(groupPK) == 0 {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("missing group pk"))
+	}
+
+	if _, err := client.DeactivateGroup(ctx, &protocoltypes.DeactivateGroup_Request{GroupPK: groupPK}); err != nil {
+		return weshnet_errcode.ErrGroupDeactivate.Wrap(err)
+	}
+
+	if _, err := client.ActivateGroup(ctx, &protocoltypes.ActivateGroup_Request{GroupPK: groupPK}); err != nil {
+		return weshnet_errcode.ErrGroupActivate.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package groupkeys
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+func testEvent(t *testing.T, eventType protocoltypes.EventType, event interface{ Marshal() ([]byte, error) }) *protocoltypes.GroupMetadataEvent {
+	t.Helper()
+
+	payload, err := event.Marshal()
+	require.NoError(t, err)
+
+	return &protocoltypes.GroupMetadataEvent{
+		Metadata: &protocoltypes.GroupMetadata{EventType: eventType},
+		Event:    payload,
+	}
+}
+
+func TestTracker(t *testing.T) {
+	var (
+		groupPK   = []byte("group")
+		member    = []byte("member-a")
+		device    = []byte("device-a1")
+		ownDevice = []byte("device-a2")
+		peer      = []byte("member-b")
+		peerDev   = []byte("device-b1")
+	)
+
+	tracker := NewTracker(groupPK, member, device)
+	events := []*protocoltypes.GroupMetadataEvent{
+		testEvent(t, protocoltypes.EventTypeGroupMemberDeviceAdded, &protocoltypes.GroupMemberDeviceAdded{MemberPK: member, DevicePK: device}),
+		testEvent(t, protocoltypes.EventTypeGroupMemberDeviceAdded, &protocoltypes.GroupMemberDeviceAdded{MemberPK: member, DevicePK: ownDevice}),
+		testEvent(t, protocoltypes.EventTypeGroupMemberDeviceAdded, &protocoltypes.GroupMemberDeviceAdded{MemberPK: peer, DevicePK: peerDev}),
+		// local device key sent to both members
+		testEvent(t, protocoltypes.EventTypeGroupDeviceChainKeyAdded, &protocoltypes.GroupDeviceChainKeyAdded{DevicePK: device, DestMemberPK: member}),
+		testEvent(t, protocoltypes.EventTypeGroupDeviceChainKeyAdded, &protocoltypes.GroupDeviceChainKeyAdded{DevicePK: device, DestMemberPK: peer}),
+		// only the other local device sent its key back
+		testEvent(t, protocoltypes.EventTypeGroupDeviceChainKeyAdded, &protocoltypes.GroupDeviceChainKeyAdded{DevicePK: ownDevice, DestMemberPK: member}),
+		// unrelated event
+		testEvent(t, protocoltypes.EventTypeGroupMetadataPayloadSent, &protocoltypes.GroupMetadataPayloadSent{DevicePK: peerDev}),
+	}
+
+	for _, evt := range events {
+		require.NoError(t, tracker.HandleEvent(evt))
+	}
+
+	report := tracker.Report()
+	require.Equal(t, groupPK, report.GroupPK)
+	require.Len(t, report.Devices, 2)
+
+	require.Equal(t, ownDevice, report.Devices[0].DevicePK)
+	require.True(t, report.Devices[0].Self)
+	require.True(t, report.Devices[0].Healthy())
+
+	require.Equal(t, peerDev, report.Devices[1].DevicePK)
+	require.False(t, report.Devices[1].Self)
+	require.True(t, report.Devices[1].KeySent)
+	require.False(t, report.Devices[1].KeyReceived)
+
+	unhealthy := report.Unhealthy()
+	require.Len(t, unhealthy, 1)
+	require.Equal(t, peerDev, unhealthy[0].DevicePK)
+	require.False(t, report.KeysExchanged())
+
+	require.NoError(t, tracker.HandleEvent(testEvent(t, protocoltypes.EventTypeGroupDeviceChainKeyAdded, &protocoltypes.GroupDeviceChainKeyAdded{DevicePK: peerDev, DestMemberPK: member})))
+	require.True(t, tracker.Report().KeysExchanged())
+
+	// without the other member, the keys were only exchanged with the local ones
+	require.False(t, (&Report{Devices: report.Devices[:1]}).KeysExchanged())
+
+	require.Error(t, tracker.HandleEvent(&protocoltypes.GroupMetadataEvent{
+		Metadata: &protocoltypes.GroupMetadata{EventType: protocoltypes.EventTypeGroupDeviceChainKeyAdded},
+		Event:    []byte("invalid"),
+	}))
+}
@@ -0,0 +1,149 @@
+// Package groupmigration moves a multi-member group to another account, e.g.
+// after the rotation of an identity. The group cannot change hands, its
+// members are bound to their accounts, so the group is re-created: a bundle
+// exported from the previous account holds its definition, its members and
+// its text history, and importing it creates a new group with the same name,
+// the history shown as imported messages, and invites back the members who
+// are contacts of the new account. The previous account can also post the
+// invitation to the new group in the previous one, for all its members.
+//
+// The bundles are not encrypted, they hold the history of the group and
+// must be kept as private as the account.
+package groupmigration
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// Version is the version of the bundles written by Write.
+	Version = 1
+
+	// MaxMessages bounds the history of a bundle, the oldest messages are
+	// not exported.
+	MaxMessages = 10000
+
+	// magic starts the bundle files.
+	magic = "berty-group-migration-v1\n"
+)
+
+// Group is the definition of the migrated group.
+type Group struct {
+	// PublicKey is the public key of the previous group.
+	PublicKey   string `json:"public_key"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// Member is a member of the previous group.
+type Member struct {
+	PublicKey   string `json:"public_key"`
+	DisplayName string `json:"display_name,omitempty"`
+	// ContactPublicKey is the account of the member, when it is the only
+	// contact of the exporting account with its display name, the members
+	// of a group are not linked to their accounts otherwise. The new group
+	// is shared in the conversation with this contact.
+	ContactPublicKey string `json:"contact_public_key,omitempty"`
+}
+
+// Message is a text message of the previous group.
+type Message struct {
+	CID             string    `json:"cid"`
+	MemberPublicKey string    `json:"member_public_key"`
+	DisplayName     string    `json:"display_name,omitempty"`
+	SentAt          time.Time `json:"sent_at"`
+	Body            string    `json:"body"`
+}
+
+// Bundle is the content of a migration file.
+type Bundle struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Group      Group     `json:"group"`
+	// Exporter is the member of the exporting account in the previous group.
+	Exporter string    `json:"exporter"`
+	Members  []Member  `json:"members"`
+	Messages []Message `json:"messages"`
+}
+
+// Validate checks the fields needed to import b.
+func (b *Bundle) Validate() error {
+	switch {
+	case b.Version > Version:
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("group migration version %d is not supported", b.Version))
+	case b.Version <= 0:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("group migration without a version"))
+	case b.Group.PublicKey == "":
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("group migration without a group"))
+	case len(b.Messages) > MaxMessages:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("group migration with %d messages, at most %d are imported", len(b.Messages), MaxMessages))
+	}
+
+	for _, m := range b.Messages {
+		if m.CID == "" || m.MemberPublicKey == "" {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("group migration message without a cid or a sender"))
+		}
+	}
+
+	return nil
+}
+
+// Invitees returns the contact public keys of the members to invite in the
+// new group, the members without a contact are shared the invitation link
+// by hand.
+func (b *Bundle) Invitees() []string {
+	seen := map[string]bool{}
+	invitees := []string(nil)
+	for _, m := range b.Members {
+		if m.ContactPublicKey == "" || m.PublicKey == b.Exporter || seen[m.ContactPublicKey] {
+			continue
+		}
+
+		seen[m.ContactPublicKey] = true
+		invitees = append(invitees, m.ContactPublicKey)
+	}
+
+	return invitees
+}
+
+// Write writes b to w.
+func Write(w io.Writer, b *Bundle) error {
+	raw, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if _, err := io.WriteString(w, magic); err != nil {
+		return errcode.ErrStreamWrite.Wrap(err)
+	}
+	if _, err := w.Write(raw); err != nil {
+		return errcode.ErrStreamWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// Read reads a bundle written by Write and validates it.
+func Read(r io.Reader) (*Bundle, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil || header != magic {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("not a group migration file"))
+	}
+
+	b := &Bundle{}
+	if err := json.NewDecoder(br).Decode(b); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
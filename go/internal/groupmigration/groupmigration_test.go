@@ -0,0 +1,81 @@
+package groupmigration
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func testBundle() *Bundle {
+	sentAt := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	return &Bundle{
+		Version:    Version,
+		ExportedAt: sentAt.Add(time.Hour),
+		Group:      Group{PublicKey: "group", DisplayName: "Team"},
+		Exporter:   "alice",
+		Members: []Member{
+			{PublicKey: "alice", DisplayName: "Alice", ContactPublicKey: "alice-account"},
+			{PublicKey: "bob", DisplayName: "Bob", ContactPublicKey: "bob-account"},
+			{PublicKey: "bob-2", DisplayName: "Bob", ContactPublicKey: "bob-account"},
+			{PublicKey: "carol", DisplayName: "Carol"},
+		},
+		Messages: []Message{
+			{CID: "cid1", MemberPublicKey: "alice", DisplayName: "Alice", SentAt: sentAt, Body: "hello"},
+			{CID: "cid2", MemberPublicKey: "carol", SentAt: sentAt.Add(time.Minute), Body: "hi"},
+		},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	b := testBundle()
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, Write(buf, b))
+
+	read, err := Read(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, b, read)
+
+	_, err = Read(strings.NewReader("{}"))
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	_, err = Read(strings.NewReader(magic + "{"))
+	require.True(t, errcode.Is(err, errcode.ErrDeserialization))
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, testBundle().Validate())
+
+	b := testBundle()
+	b.Version = Version + 1
+	require.True(t, errcode.Is(b.Validate(), errcode.ErrNotImplemented))
+
+	b = testBundle()
+	b.Version = 0
+	require.True(t, errcode.Is(b.Validate(), errcode.ErrInvalidInput))
+
+	b = testBundle()
+	b.Group.PublicKey = ""
+	require.True(t, errcode.Is(b.Validate(), errcode.ErrInvalidInput))
+
+	b = testBundle()
+	b.Messages[1].MemberPublicKey = ""
+	require.True(t, errcode.Is(b.Validate(), errcode.ErrInvalidInput))
+
+	b = testBundle()
+	b.Messages = make([]Message, MaxMessages+1)
+	require.True(t, errcode.Is(b.Validate(), errcode.ErrInvalidInput))
+}
+
+func TestInvitees(t *testing.T) {
+	// the exporter and the members without a contact are not invited, the
+	// contacts with several members are invited once
+	require.Equal(t, []string{"bob-account"}, testBundle().Invitees())
+	require.Empty(t, (&Bundle{}).Invitees())
+}
@@ -0,0 +1,265 @@
+// Package groupprofile adds a topic, a description and an avatar to
+// multi-member groups.
+//
+// Updates are sent as SetGroupInfo app metadata, in its topic, description
+// and avatar_cid fields. Clients unaware of them keep handling the display
+// name and skip the other fields.
+package groupprofile
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/benbjohnson/clock"
+	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
+	"github.com/golang/protobuf/proto"
+	"github.com/ipfs/go-cid"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/messengerutil"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+const (
+	MaxTopicLength       = 256
+	MaxDescriptionLength = 4096
+)
+
+// Profile is the custom metadata of a group.
+type Profile struct {
+	Topic       string
+	Description string
+	AvatarCID   string
+}
+
+// Update changes the fields which are set, an empty string clears a field.
+type Update struct {
+	Topic       *string
+	Description *string
+	AvatarCID   *string
+}
+
+// IsEmpty returns true when the update changes nothing.
+func (u Update) IsEmpty() bool {
+	return u.Topic == nil && u.Description == nil && u.AvatarCID == nil
+}
+
+// Validate checks the length of the fields and the avatar CID.
+func (u Update) Validate() error {
+	if u.IsEmpty() {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("empty group profile update"))
+	}
+
+	if u.Topic != nil && utf8.RuneCountInString(*u.Topic) > MaxTopicLength {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("topic is longer than %d characters", MaxTopicLength))
+	}
+
+	if u.Description != nil && utf8.RuneCountInString(*u.Description) > MaxDescriptionLength {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("description is longer than %d characters", MaxDescriptionLength))
+	}
+
+	if u.AvatarCID != nil && *u.AvatarCID != "" {
+		if _, err := cid.Decode(*u.AvatarCID); err != nil {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid avatar cid: %w", err))
+		}
+	}
+
+	return nil
+}
+
+// Apply returns the profile with the update applied.
+func (p Profile) Apply(u Update) Profile {
+	if u.Topic != nil {
+		p.Topic = *u.Topic
+	}
+	if u.Description != nil {
+		p.Description = *u.Description
+	}
+	if u.AvatarCID != nil {
+		p.AvatarCID = *u.AvatarCID
+	}
+
+	return p
+}
+
+// MarshalPayload returns the SetGroupInfo payload carrying the update.
+func MarshalPayload(u Update) ([]byte, error) {
+	if err := u.Validate(); err != nil {
+		return nil, err
+	}
+
+	payload, err := proto.Marshal(&messengertypes.AppMessage_SetGroupInfo{
+		Topic:       toField(u.Topic),
+		Description: toField(u.Description),
+		AvatarCID:   toField(u.AvatarCID),
+	})
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	return payload, nil
+}
+
+// UnmarshalPayload extracts the update from a SetGroupInfo payload, ok is
+// false when the payload has no profile field.
+func UnmarshalPayload(payload []byte) (u Update, ok bool, err error) {
+	info := messengertypes.AppMessage_SetGroupInfo{}
+	if err := proto.Unmarshal(payload, &info); err != nil {
+		return Update{}, false, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	u = Update{
+		Topic:       fromField(info.Topic),
+		Description: fromField(info.Description),
+		AvatarCID:   fromField(info.AvatarCID),
+	}
+	if u.IsEmpty() {
+		return Update{}, false, nil
+	}
+
+	if err := u.Validate(); err != nil {
+		return Update{}, false, err
+	}
+
+	return u, true, nil
+}
+
+func toField(value *string) *messengertypes.AppMessage_SetGroupInfo_ProfileField {
+	if value == nil {
+		return nil
+	}
+
+	return &messengertypes.AppMessage_SetGroupInfo_ProfileField{Value: *value}
+}
+
+func fromField(field *messengertypes.AppMessage_SetGroupInfo_ProfileField) *string {
+	if field == nil {
+		return nil
+	}
+
+	value := field.Value
+	return &value
+}
+
+// Send publishes the update on the group metadata log, dated by clk.
+func Send(ctx context.Context, client protocoltypes.ProtocolServiceClient, clk clock.Clock, groupPK []byte, u Update) error {
+	payload, err := MarshalPayload(u)
+	if err != nil {
+		return err
+	}
+
+	am, err := proto.Marshal(&messengertypes.AppMessage{
+		Type:     messengertypes.AppMessage_TypeSetGroupInfo,
+		Payload:  payload,
+		SentDate: messengerutil.TimestampMs(clk.Now()),
+	})
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if _, err := client.AppMetadataSend(ctx, &protocoltypes.AppMetadataSend_Request{GroupPK: groupPK, Payload: am}); err != nil {
+		return errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	return nil
+}
+
+// Tracker follows the profile of a group from its metadata events, only the
+// updates of the group admins (the creator and the members granted the admin
+// role) are applied to multi-member groups.
+type Tracker struct {
+	multiMember bool
+	admins      map[string]bool
+	// device key to member key
+	members map[string][]byte
+	profile Profile
+}
+
+// NewTracker returns a Tracker for a group of the given type.
+func NewTracker(groupType protocoltypes.GroupType) *Tracker {
+	return &Tracker{
+		multiMember: groupType == protocoltypes.GroupTypeMultiMember,
+		admins:      map[string]bool{},
+		members:     map[string][]byte{},
+	}
+}
+
+// Profile returns the current profile.
+func (t *Tracker) Profile() Profile {
+	return t.profile
+}
+
+// HandleEvent accounts a metadata event, changed is true when the profile
+// was updated.
+func (t *Tracker) HandleEvent(evt *protocoltypes.GroupMetadataEvent) (changed bool, err error) {
+	if evt.Metadata == nil {
+		return false, nil
+	}
+
+	switch evt.Metadata.EventType {
+	case protocoltypes.EventTypeGroupMemberDeviceAdded:
+		casted := &protocoltypes.GroupMemberDeviceAdded{}
+		if err := casted.Unmarshal(evt.Event); err != nil {
+			return false, errcode.ErrDeserialization.Wrap(err)
+		}
+		t.members[string(casted.DevicePK)] = casted.MemberPK
+
+	case protocoltypes.EventTypeMultiMemberGroupInitialMemberAnnounced:
+		casted := &protocoltypes.MultiMemberGroupInitialMemberAnnounced{}
+		if err := casted.Unmarshal(evt.Event); err != nil {
+			return false, errcode.ErrDeserialization.Wrap(err)
+		}
+		t.admins[string(casted.MemberPK)] = true
+
+	case protocoltypes.EventTypeMultiMemberGroupAdminRoleGranted:
+		casted := &protocoltypes.MultiMemberGroupAdminRoleGranted{}
+		if err := casted.Unmarshal(evt.Event); err != nil {
+			return false, errcode.ErrDeserialization.Wrap(err)
+		}
+
+		// only an admin can grant the role
+		if t.isAdminDevice(casted.DevicePK) {
+			t.admins[string(casted.GranteeMemberPK)] = true
+		}
+
+	case protocoltypes.EventTypeGroupMetadataPayloadSent:
+		casted := &protocoltypes.GroupMetadataPayloadSent{}
+		if err := casted.Unmarshal(evt.Event); err != nil {
+			return false, errcode.ErrDeserialization.Wrap(err)
+		}
+
+		am := messengertypes.AppMessage{}
+		if err := proto.Unmarshal(casted.Message, &am); err != nil || am.Type != messengertypes.AppMessage_TypeSetGroupInfo {
+			return false, nil
+		}
+
+		update, ok, err := UnmarshalPayload(am.Payload)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		if t.multiMember && !t.isAdminDevice(casted.DevicePK) {
+			return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("group profile updated by a non-admin member"))
+		}
+
+		previous := t.profile
+		t.profile = t.profile.Apply(update)
+
+		return previous != t.profile, nil
+	}
+
+	return false, nil
+}
+
+// CanUpdate returns true if the updates of the member memberPK are applied,
+// any member can update the profile of a group which is not multi-member.
+func (t *Tracker) CanUpdate(memberPK []byte) bool {
+	return !t.multiMember || t.admins[string(memberPK)]
+}
+
+func (t *Tracker) isAdminDevice(devicePK []byte) bool {
+	memberPK, ok := t.members[string(devicePK)]
+	return ok && t.admins[string(memberPK)]
+}
@@ -0,0 +1,162 @@
+package groupprofile
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"google.golang.org/grpc"
+	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+const testCID = "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestPayloadRoundTrip(t *testing.T) {
+	update := Update{Topic: stringPtr("weekly sync"), AvatarCID: stringPtr(testCID)}
+
+	payload, err := MarshalPayload(update)
+	require.NoError(t, err)
+
+	info := messengertypes.AppMessage_SetGroupInfo{}
+	require.NoError(t, proto.Unmarshal(payload, &info))
+	require.Equal(t, "weekly sync", info.GetTopic().GetValue())
+	require.Nil(t, info.Description)
+	require.Equal(t, testCID, info.GetAvatarCID().GetValue())
+
+	decoded, ok, err := UnmarshalPayload(payload)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, update, decoded)
+
+	// a plain SetGroupInfo has no profile
+	payload, err = proto.Marshal(&messengertypes.AppMessage_SetGroupInfo{DisplayName: "group"})
+	require.NoError(t, err)
+
+	_, ok, err = UnmarshalPayload(payload)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestValidate(t *testing.T) {
+	require.Error(t, Update{}.Validate())
+	require.Error(t, Update{Topic: stringPtr(strings.Repeat("a", MaxTopicLength+1))}.Validate())
+	require.Error(t, Update{AvatarCID: stringPtr("not a cid")}.Validate())
+
+	// clearing a field is allowed
+	require.NoError(t, Update{AvatarCID: stringPtr("")}.Validate())
+
+	_, _, err := UnmarshalPayload([]byte{0x1a, 0x10})
+	require.Error(t, err)
+}
+
+func testEvent(t *testing.T, eventType protocoltypes.EventType, event interface{ Marshal() ([]byte, error) }) *protocoltypes.GroupMetadataEvent {
+	t.Helper()
+
+	payload, err := event.Marshal()
+	require.NoError(t, err)
+
+	return &protocoltypes.GroupMetadataEvent{
+		Metadata: &protocoltypes.GroupMetadata{EventType: eventType},
+		Event:    payload,
+	}
+}
+
+func testUpdateEvent(t *testing.T, devicePK []byte, u Update) *protocoltypes.GroupMetadataEvent {
+	t.Helper()
+
+	payload, err := MarshalPayload(u)
+	require.NoError(t, err)
+
+	am, err := proto.Marshal(&messengertypes.AppMessage{Type: messengertypes.AppMessage_TypeSetGroupInfo, Payload: payload})
+	require.NoError(t, err)
+
+	return testEvent(t, protocoltypes.EventTypeGroupMetadataPayloadSent, &protocoltypes.GroupMetadataPayloadSent{DevicePK: devicePK, Message: am})
+}
+
+func TestTrackerPermissions(t *testing.T) {
+	var (
+		admin     = []byte("member-admin")
+		adminDev  = []byte("device-admin")
+		member    = []byte("member")
+		memberDev = []byte("device-member")
+	)
+
+	tracker := NewTracker(protocoltypes.GroupTypeMultiMember)
+	for _, evt := range []*protocoltypes.GroupMetadataEvent{
+		testEvent(t, protocoltypes.EventTypeGroupMemberDeviceAdded, &protocoltypes.GroupMemberDeviceAdded{MemberPK: admin, DevicePK: adminDev}),
+		testEvent(t, protocoltypes.EventTypeMultiMemberGroupInitialMemberAnnounced, &protocoltypes.MultiMemberGroupInitialMemberAnnounced{MemberPK: admin}),
+		testEvent(t, protocoltypes.EventTypeGroupMemberDeviceAdded, &protocoltypes.GroupMemberDeviceAdded{MemberPK: member, DevicePK: memberDev}),
+	} {
+		changed, err := tracker.HandleEvent(evt)
+		require.NoError(t, err)
+		require.False(t, changed)
+	}
+
+	require.True(t, tracker.CanUpdate(admin))
+	require.False(t, tracker.CanUpdate(member))
+
+	changed, err := tracker.HandleEvent(testUpdateEvent(t, adminDev, Update{Topic: stringPtr("topic")}))
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// non-admin updates are rejected
+	changed, err = tracker.HandleEvent(testUpdateEvent(t, memberDev, Update{Topic: stringPtr("hijacked")}))
+	require.Error(t, err)
+	require.False(t, changed)
+	require.Equal(t, Profile{Topic: "topic"}, tracker.Profile())
+
+	// until the member is granted the admin role
+	_, err = tracker.HandleEvent(testEvent(t, protocoltypes.EventTypeMultiMemberGroupAdminRoleGranted, &protocoltypes.MultiMemberGroupAdminRoleGranted{DevicePK: adminDev, GranteeMemberPK: member}))
+	require.NoError(t, err)
+
+	require.True(t, tracker.CanUpdate(member))
+
+	changed, err = tracker.HandleEvent(testUpdateEvent(t, memberDev, Update{Description: stringPtr("about")}))
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, Profile{Topic: "topic", Description: "about"}, tracker.Profile())
+}
+
+type sendRecorder struct {
+	protocoltypes.ProtocolServiceClient
+	requests []*protocoltypes.AppMetadataSend_Request
+}
+
+func (r *sendRecorder) AppMetadataSend(_ context.Context, req *protocoltypes.AppMetadataSend_Request, _ ...grpc.CallOption) (*protocoltypes.AppMetadataSend_Reply, error) {
+	r.requests = append(r.requests, req)
+	return &protocoltypes.AppMetadataSend_Reply{}, nil
+}
+
+func TestSend(t *testing.T) {
+	mock := clock.NewMock()
+	mock.Set(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC))
+	client := &sendRecorder{}
+
+	require.NoError(t, Send(context.Background(), client, mock, []byte("group"), Update{Topic: stringPtr("topic")}))
+	require.Len(t, client.requests, 1)
+	require.Equal(t, []byte("group"), client.requests[0].GroupPK)
+
+	am := messengertypes.AppMessage{}
+	require.NoError(t, proto.Unmarshal(client.requests[0].Payload, &am))
+	require.Equal(t, messengertypes.AppMessage_TypeSetGroupInfo, am.Type)
+	require.Equal(t, mock.Now().UnixMilli(), am.SentDate)
+
+	update, ok, err := UnmarshalPayload(am.Payload)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Update{Topic: stringPtr("topic")}, update)
+
+	require.Error(t, Send(context.Background(), client, mock, []byte("group"), Update{}))
+	require.Len(t, client.requests, 1)
+}
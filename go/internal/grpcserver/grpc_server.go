@@ -31,6 +31,8 @@ type GRPCOpts struct {
 	Listeners                string
 	ServiceID                string
 	KeepExistingGlobalLogger bool
+	// ServerOptions are appended to the default server options.
+	ServerOptions []grpc.ServerOption
 }
 
 func InitGRPCServer(workers *run.Group, opts *GRPCOpts) (*grpc.Server, *grpcgw.ServeMux, []grpcutil.Listener, error) {
@@ -95,6 +97,7 @@ func InitGRPCServer(workers *run.Group, opts *GRPCOpts) (*grpc.Server, *grpcgw.S
 		),
 	}
 
+	grpcOpts = append(grpcOpts, opts.ServerOptions...)
 	grpcServer := grpc.NewServer(grpcOpts...)
 	grpcGatewayMux := grpcgw.NewServeMux()
 
@@ -0,0 +1,73 @@
+package initutil
+
+import (
+	"fmt"
+
+	datastore "github.com/ipfs/go-datastore"
+
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/internal/cloudbackup"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/tempdir"
+)
+
+// cloudBackupDisabled is the -node.cloud-backup-url value removing the saved
+// configuration.
+const cloudBackupDisabled = "none"
+
+// getCloudBackup saves the cloud backup flags in the account configuration
+// and returns the client of the configured target, nil when there is none.
+func (m *Manager) getCloudBackup(rootDS datastore.Datastore) (*cloudbackup.Client, cloudbackup.Config, error) {
+	config, err := cloudbackup.LoadConfig(m.getContext(), rootDS)
+	if err != nil {
+		return nil, config, errcode.TODO.Wrap(err)
+	}
+
+	changed := false
+	switch url := m.Node.Messenger.CloudBackupURL; url {
+	case "":
+	case cloudBackupDisabled:
+		config, changed = cloudbackup.Config{}, true
+	default:
+		config.URL = url
+		config.Username = m.Node.Messenger.CloudBackupUsername
+		config.Password = m.Node.Messenger.CloudBackupPassword
+		config.Passphrase = m.Node.Messenger.CloudBackupPassphrase
+		changed = true
+	}
+
+	if interval := m.Node.Messenger.CloudBackupInterval; interval >= 0 {
+		config.Interval, changed = interval, true
+	}
+
+	if keep := m.Node.Messenger.CloudBackupKeep; keep >= 0 {
+		config.Keep, changed = keep, true
+	}
+
+	if changed {
+		if err := cloudbackup.SaveConfig(m.getContext(), rootDS, config); err != nil {
+			return nil, config, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid -node.cloud-backup flags: %w", err))
+		}
+	}
+
+	if config.URL == "" {
+		return nil, config, nil
+	}
+
+	target, err := config.Target()
+	if err != nil {
+		return nil, config, err
+	}
+
+	// the export being uploaded is kept with the account, to resume the
+	// upload after a restart
+	dir, err := m.getAppDataDir()
+	if err != nil {
+		return nil, config, errcode.TODO.Wrap(err)
+	}
+	if dir == accountutils.InMemoryDir {
+		dir = tempdir.TempDir()
+	}
+
+	return cloudbackup.New(target, config.Passphrase, rootDS, dir), config, nil
+}
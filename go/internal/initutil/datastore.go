@@ -2,11 +2,15 @@ package initutil
 
 import (
 	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
 
 	datastore "github.com/ipfs/go-datastore"
 	"go.uber.org/zap"
 
 	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/internal/dsmetrics"
 	"berty.tech/berty/v2/go/pkg/errcode"
 )
 
@@ -15,11 +19,52 @@ func (m *Manager) SetupDatastoreFlags(fs *flag.FlagSet) {
 	if dir == "" {
 		dir = m.Datastore.defaultDir
 	}
-	fs.StringVar(&m.Datastore.AppDir, "store.dir", dir, "root datastore directory")
+	fs.StringVar(&m.Datastore.AppDir, "store.dir", dir, "root datastore directory, in XDG_DATA_HOME by default (see `berty store migrate-layout`), the logs are stored in it when it is set")
 
 	fs.StringVar(&m.Datastore.SharedDir, "store.shared-dir", "", "shared root datastore directory")
 
 	fs.BoolVar(&m.Datastore.InMemory, "store.inmem", m.Datastore.InMemory, "disable datastore persistence")
+
+	fs.DurationVar(&m.Datastore.Ephemeral, "store.ephemeral", m.Datastore.Ephemeral, "throwaway account for this long, e.g. 2h: it is kept in memory, the logs are not written to disk, and the node stops and discards it when it expires")
+
+	backend := m.Datastore.Backend
+	if backend == "" {
+		backend = accountutils.DatastoreBackendSQLite
+	}
+	fs.StringVar(&m.Datastore.Backend, "store.backend", backend, fmt.Sprintf("root datastore backend, one of %v, see `berty store migrate`", accountutils.DatastoreBackends))
+}
+
+// stateDir is where the logs are stored: the state directory of the
+// default layout, or the -store.dir when it is set.
+func (m *Manager) stateDir() string {
+	if m.Datastore.defaultStateDir != "" && m.Datastore.AppDir == m.Datastore.defaultDir {
+		return m.Datastore.defaultStateDir
+	}
+
+	return m.Datastore.AppDir
+}
+
+// HasAccountData returns true when the messenger db of the account was
+// created by a previous run, without creating the datastore directories.
+func (m *Manager) HasAccountData() (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.applyDefaults()
+
+	if m.Datastore.InMemory || m.Datastore.SharedDir == accountutils.InMemoryDir {
+		return false, nil
+	}
+
+	_, err := os.Stat(filepath.Join(m.Datastore.SharedDir, accountutils.MessengerDatabaseFilename))
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, errcode.ErrInternal.Wrap(err)
+	}
 }
 
 func (m *Manager) GetAppDataDir() (string, error) {
@@ -99,6 +144,47 @@ func (m *Manager) getRootDatastore() (datastore.Batching, error) {
 		return m.Datastore.rootDS, nil
 	}
 
+	rootDS, err := m.openRootDatastore(m.Datastore.Backend)
+	if err != nil {
+		return nil, err
+	}
+
+	// the operations are recorded by namespace for the metrics endpoint
+	if m.Metrics.Listener != "" {
+		registry, err := m.getMetricsRegistry()
+		if err != nil {
+			rootDS.Close()
+			return nil, err
+		}
+
+		instrumented := dsmetrics.Wrap(rootDS)
+		if err := registry.Register(instrumented); err != nil {
+			rootDS.Close()
+			return nil, err
+		}
+		rootDS = instrumented
+	}
+	m.Datastore.rootDS = rootDS
+
+	return m.Datastore.rootDS, nil
+}
+
+// OpenRootDatastore opens the root datastore of the account stored by
+// backend, whatever the -store.backend flag, e.g. to migrate it to another
+// backend. It must be closed by the caller.
+func (m *Manager) OpenRootDatastore(backend string) (datastore.Batching, error) {
+	defer m.prepareForGetter()()
+
+	m.applyDefaults()
+
+	return m.openRootDatastore(backend)
+}
+
+func (m *Manager) openRootDatastore(backend string) (datastore.Batching, error) {
+	if err := m.lockStoreDirs(); err != nil {
+		return nil, err
+	}
+
 	dir, err := m.getSharedDataDir()
 	if err != nil {
 		return nil, errcode.TODO.Wrap(err)
@@ -114,11 +200,12 @@ func (m *Manager) getRootDatastore() (datastore.Batching, error) {
 		return nil, errcode.ErrKeystoreGet.Wrap(err)
 	}
 
-	if m.Datastore.rootDS, err = accountutils.GetRootDatastoreForPath(dir, storageKey, storageSalt, m.initLogger); err != nil {
+	rootDS, err := accountutils.GetRootDatastoreForBackend(dir, backend, storageKey, storageSalt, m.initLogger)
+	if err != nil {
 		return nil, err
 	}
 
-	m.initLogger.Debug("datastore", zap.Bool("in-memory", dir == accountutils.InMemoryDir))
+	m.initLogger.Debug("datastore", zap.Bool("in-memory", dir == accountutils.InMemoryDir), zap.String("backend", backend))
 
-	return m.Datastore.rootDS, nil
+	return rootDS, nil
 }
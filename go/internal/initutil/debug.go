@@ -0,0 +1,191 @@
+package initutil
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	runtimepprof "runtime/pprof"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/logutil"
+)
+
+const (
+	// DefaultCPUProfileDuration is the duration of the profiles captured by
+	// CaptureCPUProfile when none is given.
+	DefaultCPUProfileDuration = 30 * time.Second
+
+	maxCPUProfileDuration = 10 * time.Minute
+	profilesDirName       = "profiles"
+	captureProfileHandler = "/debug/capture/cpu"
+)
+
+func (m *Manager) SetupDebugFlags(fs *flag.FlagSet) {
+	fs.StringVar(&m.Debug.PprofListener, "debug.pprof-listen", "", "address of the net/http/pprof and runtime/trace endpoints, disabled if empty, the host defaults to localhost (e.g. :6060)")
+}
+
+// pprofListenAddr binds addr to localhost when it has no host, the endpoints
+// expose the memory of the process.
+func pprofListenAddr(addr string) (string, error) {
+	if _, err := strconv.Atoi(addr); err == nil {
+		addr = ":" + addr
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid pprof listener %q: %w", addr, err))
+	}
+
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// startDebugListener serves the pprof endpoints if -debug.pprof-listen is
+// set, once per manager.
+func (m *Manager) startDebugListener() error {
+	if m.Debug.PprofListener == "" || m.Debug.started {
+		return nil
+	}
+
+	logger, err := m.getLogger()
+	if err != nil {
+		return err
+	}
+
+	addr, err := pprofListenAddr(m.Debug.PprofListener)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to listen on %s: %w", addr, err))
+	}
+
+	if tcpAddr, ok := l.Addr().(*net.TCPAddr); ok && !tcpAddr.IP.IsLoopback() {
+		logger.Warn("pprof endpoints reachable from the network, they expose the memory of the process",
+			logutil.PrivateString("listener", l.Addr().String()))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc(captureProfileHandler, m.handleCaptureCPUProfile)
+
+	logger.Info("pprof listener",
+		zap.String("handler", "/debug/pprof/"),
+		logutil.PrivateString("listener", l.Addr().String()))
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second * 5,
+	}
+
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			logger.Info("unable to serve pprof",
+				logutil.PrivateString("listener", l.Addr().String()),
+				zap.Error(err))
+		}
+	}()
+
+	ctx := m.getContext()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	m.Debug.started = true
+	return nil
+}
+
+// handleCaptureCPUProfile captures a CPU profile to the account directory,
+// for the `seconds` query parameter or DefaultCPUProfileDuration, and
+// replies with its path.
+func (m *Manager) handleCaptureCPUProfile(w http.ResponseWriter, r *http.Request) {
+	duration := time.Duration(0)
+	if seconds := r.URL.Query().Get("seconds"); seconds != "" {
+		n, err := strconv.Atoi(seconds)
+		if err != nil {
+			http.Error(w, "invalid seconds: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		duration = time.Duration(n) * time.Second
+	}
+
+	path, err := m.CaptureCPUProfile(duration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintln(w, path)
+}
+
+// CaptureCPUProfile records a CPU profile of the process for duration, or
+// DefaultCPUProfileDuration if zero, into the profiles directory of the
+// account and returns its path. Only one profile can be captured at a time.
+func (m *Manager) CaptureCPUProfile(duration time.Duration) (string, error) {
+	if duration == 0 {
+		duration = DefaultCPUProfileDuration
+	}
+	if duration < 0 || duration > maxCPUProfileDuration {
+		return "", errcode.ErrInvalidRange.Wrap(fmt.Errorf("the duration must be between 0 and %s", maxCPUProfileDuration))
+	}
+
+	// the lock is only held to get the directory, not while profiling
+	m.mutex.Lock()
+	appDir, err := m.getAppDataDir()
+	ctx := m.getContext()
+	m.mutex.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if appDir == accountutils.InMemoryDir {
+		return "", errcode.ErrNotImplemented.Wrap(fmt.Errorf("no account directory to store the profile in"))
+	}
+
+	dir := filepath.Join(appDir, profilesDirName)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", errcode.ErrInternal.Wrap(err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("cpu-%s.pprof", time.Now().UTC().Format("20060102T150405Z")))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", errcode.ErrInternal.Wrap(err)
+	}
+
+	if err := runtimepprof.StartCPUProfile(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", errcode.ErrInternal.Wrap(fmt.Errorf("unable to start the CPU profile, another one may be running: %w", err))
+	}
+
+	select {
+	case <-time.After(duration):
+	case <-ctx.Done():
+	}
+
+	runtimepprof.StopCPUProfile()
+	if err := f.Close(); err != nil {
+		return "", errcode.ErrInternal.Wrap(err)
+	}
+
+	return path, nil
+}
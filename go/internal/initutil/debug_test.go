@@ -0,0 +1,23 @@
+package initutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPprofListenAddr(t *testing.T) {
+	for input, expected := range map[string]string{
+		"6060":         "127.0.0.1:6060",
+		":6060":        "127.0.0.1:6060",
+		"0.0.0.0:6060": "0.0.0.0:6060",
+		"[::1]:6060":   "[::1]:6060",
+	} {
+		addr, err := pprofListenAddr(input)
+		require.NoError(t, err, input)
+		require.Equal(t, expected, addr, input)
+	}
+
+	_, err := pprofListenAddr("localhost")
+	require.Error(t, err)
+}
@@ -0,0 +1,32 @@
+package initutil
+
+import (
+	"time"
+)
+
+// EphemeralExpiry returns when the ephemeral account expires, or a zero time
+// if the account is not ephemeral, see -store.ephemeral.
+func (m *Manager) EphemeralExpiry() time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.applyEphemeral()
+
+	return m.Datastore.expiresAt
+}
+
+// applyEphemeral keeps an ephemeral account in memory without log file, and
+// cancels the context of the manager, stopping the node, when it expires.
+// The expiry is counted from the first call.
+func (m *Manager) applyEphemeral() {
+	if m.Datastore.Ephemeral <= 0 || !m.Datastore.expiresAt.IsZero() {
+		return
+	}
+
+	m.Datastore.InMemory = true
+	m.Logging.FilePath = ""
+	m.Datastore.expiresAt = time.Now().Add(m.Datastore.Ephemeral)
+
+	m.getContext()
+	time.AfterFunc(m.Datastore.Ephemeral, m.ctxCancel)
+}
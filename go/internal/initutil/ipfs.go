@@ -38,6 +38,8 @@ import (
 	"berty.tech/berty/v2/go/internal/datastoreutil"
 	"berty.tech/berty/v2/go/internal/encryptedrepo"
 	"berty.tech/berty/v2/go/internal/mdns"
+	"berty.tech/berty/v2/go/internal/netusage"
+	"berty.tech/berty/v2/go/internal/peerlist"
 	"berty.tech/berty/v2/go/pkg/config"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	ipfswebui "berty.tech/ipfs-webui-packed"
@@ -251,7 +253,11 @@ func (m *Manager) getLocalIPFS() (ipfsutil.ExtendedCoreAPI, *ipfs_core.IpfsNode,
 		h := mnode.PeerHost()
 		mdnslogger := logger.Named("mdns")
 
-		dh := mdns.DiscoveryHandler(ctx, mdnslogger, h)
+		// the handler is stopped with the service, see stopMDNS
+		var mdnsCtx context.Context
+		mdnsCtx, m.Node.Protocol.mdnsCancel = context.WithCancel(ctx)
+
+		dh := mdns.DiscoveryHandler(mdnsCtx, mdnslogger, h)
 		m.Node.Protocol.mdnsService = mdns.NewMdnsService(mdnslogger, h, mdns.MDNSServiceName, dh)
 
 		go func() {
@@ -260,7 +266,7 @@ func (m *Manager) getLocalIPFS() (ipfsutil.ExtendedCoreAPI, *ipfs_core.IpfsNode,
 				NetManager: m.Node.Protocol.NetManager,
 				Service:    m.Node.Protocol.mdnsService,
 			}
-			mdns.NetworkManagerHandler(ctx, mdnsNetworkManagerConfig)
+			mdns.NetworkManagerHandler(mdnsCtx, mdnsNetworkManagerConfig)
 		}()
 	}
 
@@ -354,6 +360,21 @@ func (m *Manager) getLocalIPFS() (ipfsutil.ExtendedCoreAPI, *ipfs_core.IpfsNode,
 		return nil, nil, errcode.ErrIPFSInit.Wrap(err)
 	}
 
+	// the routing table is stale after a change of network
+	if routing := m.Node.Protocol.ipfsNode.Routing; routing != nil {
+		m.getReconnectScheduler(logger).Register("dht-bootstrap", func(ctx context.Context) {
+			if err := routing.Bootstrap(ctx); err != nil {
+				logger.Warn("unable to bootstrap the routing", zap.Error(err))
+			}
+		})
+	}
+
+	// account the traffic by transport and by group
+	if reporter := m.Node.Protocol.ipfsNode.Reporter; reporter != nil {
+		m.Node.Protocol.netUsage = netusage.New(netusage.NewLibp2pSource(reporter, m.Node.Protocol.ipfsNode.PeerHost))
+		go m.Node.Protocol.netUsage.Run(m.getContext(), netusage.DefaultPollInterval)
+	}
+
 	// register metrics
 	if m.Metrics.Listener != "" {
 		registry, err := m.getMetricsRegistry()
@@ -365,6 +386,12 @@ func (m *Manager) getLocalIPFS() (ipfsutil.ExtendedCoreAPI, *ipfs_core.IpfsNode,
 		if err != nil {
 			return nil, nil, errcode.ErrIPFSInit.Wrap(err)
 		}
+
+		if m.Node.Protocol.netUsage != nil {
+			if err := registry.Register(m.Node.Protocol.netUsage); err != nil {
+				return nil, nil, errcode.ErrIPFSInit.Wrap(err)
+			}
+		}
 	}
 
 	logger.Debug("local PeerID", logutil.PrivateString("PeerID", m.Node.Protocol.ipfsNode.Identity.String()))
@@ -372,6 +399,21 @@ func (m *Manager) getLocalIPFS() (ipfsutil.ExtendedCoreAPI, *ipfs_core.IpfsNode,
 	return m.Node.Protocol.ipfsAPI, m.Node.Protocol.ipfsNode, nil
 }
 
+// stopMDNS stops the local discovery of the running node, e.g. when the
+// anonymity preset is reloaded.
+func (m *Manager) stopMDNS() {
+	if m.Node.Protocol.mdnsService != nil {
+		m.Node.Protocol.mdnsCancel()
+		m.Node.Protocol.mdnsService.Close()
+		m.Node.Protocol.mdnsService = nil
+	}
+
+	if m.Node.Protocol.MDNS.Enable && m.Node.Protocol.MDNS.DriverLocker != nil {
+		m.Node.Protocol.MDNS.DriverLocker.Unlock()
+	}
+	m.Node.Protocol.MDNS.Enable = false
+}
+
 func (m *Manager) setupIPFSRepo(ctx context.Context) (*ipfs_mobile.RepoMobile, error) {
 	var err error
 	var repo ipfs_repo.Repo
@@ -482,6 +524,17 @@ func (m *Manager) setupIPFSConfig(cfg *ipfs_cfg.Config) ([]libp2p.Option, error)
 	cfg.Addresses.Swarm = m.getSwarmAddrs()
 	cfg.Bootstrap = m.getBootstrapAddrs()
 
+	// the peers added at runtime, see peerlist
+	peerListStore, err := m.getPeerListStore()
+	if err != nil {
+		return nil, errcode.ErrIPFSSetupConfig.Wrap(err)
+	}
+	peerList, err := peerListStore.Get(ctx)
+	if err != nil {
+		return nil, errcode.ErrIPFSSetupConfig.Wrap(err)
+	}
+	cfg.Bootstrap = append(cfg.Bootstrap, peerList.Bootstrap...)
+
 	if m.Node.Protocol.IPFSAPIListeners != "" {
 		cfg.Addresses.API = strings.Split(m.Node.Protocol.IPFSAPIListeners, ",")
 	}
@@ -614,6 +667,13 @@ func (m *Manager) setupIPFSConfig(cfg *ipfs_cfg.Config) ([]libp2p.Option, error)
 	for _, p := range rdvpeers {
 		cfg.Peering.Peers = append(cfg.Peering.Peers, *p)
 	}
+
+	// keep the relays added at runtime connected, as when they are added
+	for _, addr := range peerList.Relays {
+		if _, info, err := peerlist.ParseAddr(addr); err == nil {
+			cfg.Peering.Peers = append(cfg.Peering.Peers, *info)
+		}
+	}
 	// disable main ipfs pubsub
 	cfg.Pubsub.Enabled = ipfs_cfg.False
 
@@ -783,11 +843,28 @@ func (m *Manager) getRdvpMaddrs() ([]*peer.AddrInfo, error) {
 }
 
 func (m *Manager) getStaticRelays() ([]*peer.AddrInfo, error) {
+	addrs := m.getStaticRelayAddrs()
+
+	// the relays added at runtime, see peerlist
+	stored, err := m.getPeerListStore()
+	if err != nil {
+		return nil, err
+	}
+	list, err := stored.Get(m.getContext())
+	if err != nil {
+		return nil, err
+	}
+	addrs = append(addrs, list.Relays...)
+
+	return ipfsutil.ParseAndResolveMaddrs(m.getContext(), m.initLogger, addrs)
+}
+
+func (m *Manager) getStaticRelayAddrs() []string {
 	m.applyDefaults()
 
 	defaultMaddrs := config.Config.P2P.StaticRelays
 
-	var addrs []string
+	addrs := []string{}
 	for _, v := range strings.Split(m.Node.Protocol.StaticRelays, ",") {
 		switch v {
 		case KeywordDefault:
@@ -799,7 +876,50 @@ func (m *Manager) getStaticRelays() ([]*peer.AddrInfo, error) {
 		}
 	}
 
-	return ipfsutil.ParseAndResolveMaddrs(m.getContext(), m.initLogger, addrs)
+	return addrs
+}
+
+// getPeerListStore returns the bootstrap peers and the relays added to the
+// account at runtime.
+func (m *Manager) getPeerListStore() (*peerlist.Store, error) {
+	if m.Node.Protocol.peerList != nil {
+		return m.Node.Protocol.peerList, nil
+	}
+
+	rootDS, err := m.getRootDatastore()
+	if err != nil {
+		return nil, err
+	}
+
+	m.Node.Protocol.peerList = peerlist.New(rootDS)
+	return m.Node.Protocol.peerList, nil
+}
+
+// getPeerListManager returns the manager of the peer list service, the
+// local IPFS node must be started.
+func (m *Manager) getPeerListManager(logger *zap.Logger) (*peerlist.Manager, error) {
+	store, err := m.getPeerListStore()
+	if err != nil {
+		return nil, err
+	}
+
+	configured := peerlist.Configured{Bootstrap: m.getBootstrapAddrs(), Relays: m.getStaticRelayAddrs()}
+	if configured.Bootstrap == nil {
+		configured.Bootstrap = []string{}
+	}
+
+	// the changes are applied at the next start without network
+	if m.Node.Protocol.DisableIPFSNetwork {
+		return peerlist.NewManager(store, nil, nil, configured, logger.Named("peerlist")), nil
+	}
+
+	node := m.Node.Protocol.ipfsNode
+	var peering peerlist.Peering
+	if node.Peering != nil {
+		peering = node.Peering
+	}
+
+	return peerlist.NewManager(store, node.PeerHost, peering, configured, logger.Named("peerlist")), nil
 }
 
 func (m *Manager) getBootstrapAddrs() []string {
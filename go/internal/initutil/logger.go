@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"moul.io/zapring"
 
 	"berty.tech/berty/v2/go/pkg/errcode"
@@ -17,15 +18,16 @@ const DefaultLoggingFilters = "info+:bty*,-*.grpc,error+:*"
 
 func (m *Manager) SetupLoggingFlags(fs *flag.FlagSet) {
 	if m.Logging.FilePath == "" && m.Session.Kind != "" {
-		m.Logging.FilePath = "<store-dir>/logs"
+		m.Logging.FilePath = "<state-dir>/logs"
 	}
 	fs.BoolVar(&m.Logging.Native, "log.native", false, "enable native logger (android & darwin only)")
 	fs.StringVar(&m.Logging.StderrFilters, "log.filters", m.Logging.StderrFilters, "stderr zapfilter configuration")
 	fs.StringVar(&m.Logging.StderrFormat, "log.format", m.Logging.StderrFormat, "stderr logging format. can be: json, console, color, light-console, light-color")
-	fs.StringVar(&m.Logging.FilePath, "log.file", m.Logging.FilePath, "log file path (pattern)")
+	fs.StringVar(&m.Logging.FilePath, "log.file", m.Logging.FilePath, "log file path (pattern), <store-dir> is the -store.dir and <state-dir> the state directory of the storage layout")
 	fs.StringVar(&m.Logging.FileFilters, "log.file-filters", m.Logging.FileFilters, "file zapfilter configuration")
 	fs.UintVar(&m.Logging.RingSize, "log.ring-size", m.Logging.RingSize, `ring buffer size in MB`)
 	fs.StringVar(&m.Logging.RingFilters, "log.ring-filters", m.Logging.RingFilters, "ring zapfilter configuration")
+	fs.StringVar(&m.Logging.Level, "log.level", m.Logging.Level, "minimum level of every logging stream, on top of the filters, can be: debug, info, warn, error (reloadable)")
 	fs.StringVar(&m.Logging.TyberAutoAttach, "log.tyber-auto-attach", m.Logging.TyberAutoAttach, "tyber host addresses to be automatically attached to")
 
 	m.longHelp = append(m.longHelp, [2]string{
@@ -63,6 +65,9 @@ func (m *Manager) getLogger() (*zap.Logger, error) {
 		return m.Logging.zapLogger, nil
 	}
 
+	// an ephemeral account writes no log file
+	m.applyEphemeral()
+
 	m.Logging.StderrFilters = strings.ReplaceAll(m.Logging.StderrFilters, KeywordDefault, DefaultLoggingFilters)
 	m.Logging.FileFilters = strings.ReplaceAll(m.Logging.FileFilters, KeywordDefault, DefaultLoggingFilters)
 
@@ -76,6 +81,7 @@ func (m *Manager) getLogger() (*zap.Logger, error) {
 	}
 	if m.Logging.FilePath != "" && m.Logging.FileFilters != "" {
 		m.Logging.FilePath = strings.ReplaceAll(m.Logging.FilePath, "<store-dir>", m.Datastore.AppDir)
+		m.Logging.FilePath = strings.ReplaceAll(m.Logging.FilePath, "<state-dir>", m.stateDir())
 		streams = append(streams, logutil.NewFileStream(m.Logging.FileFilters, "json", m.Logging.FilePath, m.Session.Kind))
 	}
 	if m.Logging.Native && (runtime.GOOS == "darwin" || runtime.GOOS == "android") {
@@ -83,10 +89,19 @@ func (m *Manager) getLogger() (*zap.Logger, error) {
 		streams = append(streams, logutil.NewCustomStream(m.Logging.StderrFilters, nativeLogger))
 	}
 
+	level := zap.NewAtomicLevel()
+	if err := level.UnmarshalText([]byte(m.Logging.Level)); err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid log level: %w", err))
+	}
+	m.Logging.level = &level
+
 	logger, loggerCleanup, err := logutil.NewLogger(streams...)
 	if err != nil {
 		return nil, errcode.TODO.Wrap(err)
 	}
+	logger = logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return levelCore{Core: core, level: level}
+	}))
 	m.Logging.zapLogger = logger
 	m.Logging.cleanup = func() {
 		loggerCleanup()
@@ -96,3 +111,25 @@ func (m *Manager) getLogger() (*zap.Logger, error) {
 
 	return m.Logging.zapLogger, nil
 }
+
+// levelCore drops the entries below a level which can be changed while the
+// logger is used.
+type levelCore struct {
+	zapcore.Core
+	level zap.AtomicLevel
+}
+
+func (c levelCore) Enabled(lvl zapcore.Level) bool {
+	return c.level.Enabled(lvl) && c.Core.Enabled(lvl)
+}
+
+func (c levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c levelCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(entry.Level) {
+		return ce
+	}
+	return c.Core.Check(entry, ce)
+}
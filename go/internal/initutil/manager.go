@@ -5,6 +5,9 @@ import (
 	"flag"
 	"fmt"
 	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"text/tabwriter"
@@ -17,17 +20,26 @@ import (
 	p2p_mdns "github.com/libp2p/go-libp2p/p2p/discovery/mdns"
 	"github.com/oklog/run"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/shibukawa/configdir"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"gorm.io/gorm"
 	"moul.io/progress"
 	"moul.io/zapring"
 
+	"berty.tech/berty/v2/go/internal/accountlock"
 	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/internal/blockscrub"
+	"berty.tech/berty/v2/go/internal/configreload"
+	"berty.tech/berty/v2/go/internal/contactspam"
+	"berty.tech/berty/v2/go/internal/contactthrottle"
 	berty_grpcutil "berty.tech/berty/v2/go/internal/grpcutil"
+	"berty.tech/berty/v2/go/internal/matrixbridge"
 	"berty.tech/berty/v2/go/internal/mdns"
+	"berty.tech/berty/v2/go/internal/netusage"
 	"berty.tech/berty/v2/go/internal/notification"
+	"berty.tech/berty/v2/go/internal/peerlist"
+	"berty.tech/berty/v2/go/internal/reconnect"
+	"berty.tech/berty/v2/go/internal/usagestats"
 	"berty.tech/berty/v2/go/pkg/bertymessenger"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
@@ -75,26 +87,39 @@ type Manager struct {
 		RingFilters          string `json:"RingFilters,omitempty"`
 		RingSize             uint   `json:"RingSize,omitempty"`
 		TyberAutoAttach      string `json:"TyberAutoAttach,omitempty"`
+		Level                string `json:"Level,omitempty"`
 
 		zapLogger *zap.Logger
 		cleanup   func()
 		ring      *zapring.Core
+		level     *zap.AtomicLevel
 	} `json:"Logging,omitempty"`
 	Metrics struct {
 		Listener string `json:"Listener,omitempty"`
 		Pedantic bool   `json:"Pedantic,omitempty"`
 
 		registerer prometheus.Registerer
+		server     *http.Server
 	} `json:"Metrics,omitempty"`
+	Debug struct {
+		PprofListener string `json:"PprofListener,omitempty"`
+
+		started bool
+	} `json:"Debug,omitempty"`
 	Datastore struct {
-		AppDir    string `json:"AppDir,omitempty"`
-		SharedDir string `json:"SharedDir,omitempty"`
-		InMemory  bool   `json:"InMemory,omitempty"`
-
-		defaultDir string
-		appDir     string
-		sharedDir  string
-		rootDS     datastore.Batching
+		AppDir    string        `json:"AppDir,omitempty"`
+		SharedDir string        `json:"SharedDir,omitempty"`
+		InMemory  bool          `json:"InMemory,omitempty"`
+		Ephemeral time.Duration `json:"Ephemeral,omitempty"`
+		Backend   string        `json:"Backend,omitempty"`
+
+		expiresAt       time.Time
+		defaultDir      string
+		defaultStateDir string
+		appDir          string
+		sharedDir       string
+		rootDS          datastore.Batching
+		locks           []*accountlock.DirLock
 	} `json:"Datastore,omitempty"`
 	Node struct {
 		Preset   string `json:"preset"`
@@ -140,6 +165,9 @@ type Manager struct {
 			PushPlatformToken      string        `json:"PushPlatformToken,omitempty"`
 			DevicePushKeyPath      string        `json:"DevicePushKeyPath,omitempty"`
 			RendezvousRotationBase time.Duration `json:"RendezvousRotationBase,omitempty"`
+			BlockScrubInterval     time.Duration `json:"BlockScrubInterval,omitempty"`
+			BlockScrubSample       int           `json:"BlockScrubSample,omitempty"`
+			BlockScrubRefetch      bool          `json:"BlockScrubRefetch,omitempty"`
 			NetManager             *netmanager.NetManager
 
 			// internal
@@ -153,6 +181,7 @@ type Manager struct {
 			ipfsNode          *core.IpfsNode
 			ipfsAPI           ipfsutil.ExtendedCoreAPI
 			mdnsService       p2p_mdns.Service
+			mdnsCancel        context.CancelFunc
 			localdisc         *tinder.LocalDiscovery
 			discAdaptater     *tinder.DiscoveryAdaptater
 			emitterclient     rendezvous.SyncClient
@@ -166,6 +195,10 @@ type Manager struct {
 			ipfsWebUICleanup  func()
 			orbitDB           *weshnet.WeshOrbitDB
 			rotationInterval  *rendezvous.RotationInterval
+			blockScrubber     *blockscrub.Scrubber
+			peerList          *peerlist.Store
+			netUsage          *netusage.Counter
+			reconnect         *reconnect.Scheduler
 		}
 		Messenger struct {
 			DisableGroupMonitor  bool   `json:"DisableGroupMonitor,omitempty"`
@@ -174,6 +207,30 @@ type Manager struct {
 			RebuildSqlite        bool   `json:"RebuildSqlite,omitempty"`
 			MessengerSqliteOpts  string `json:"MessengerSqliteOpts,omitempty"`
 			ExportPathToRestore  string `json:"ExportPathToRestore,omitempty"`
+			UsageStats           bool   `json:"UsageStats,omitempty"`
+			InactiveSync         string `json:"InactiveSync,omitempty"`
+
+			ContactRequestsRejectThreshold float64 `json:"ContactRequestsRejectThreshold,omitempty"`
+			ContactRequestsPerEpoch        int     `json:"ContactRequestsPerEpoch,omitempty"`
+			HideProfile                    string  `json:"HideProfile,omitempty"`
+			PushPayload                    string  `json:"PushPayload,omitempty"`
+			AttachmentRetention            string  `json:"AttachmentRetention,omitempty"`
+
+			CloudBackupURL        string        `json:"CloudBackupURL,omitempty"`
+			CloudBackupUsername   string        `json:"CloudBackupUsername,omitempty"`
+			CloudBackupPassword   string        `json:"CloudBackupPassword,omitempty"`
+			CloudBackupPassphrase string        `json:"CloudBackupPassphrase,omitempty"`
+			CloudBackupInterval   time.Duration `json:"CloudBackupInterval,omitempty"`
+			CloudBackupKeep       int           `json:"CloudBackupKeep,omitempty"`
+			ShortLinkRelay        string        `json:"ShortLinkRelay,omitempty"`
+
+			InactivePollInterval time.Duration `json:"InactivePollInterval,omitempty"`
+
+			MaxMessageSize        int `json:"MaxMessageSize,omitempty"`
+			MaxChunkedMessageSize int `json:"MaxChunkedMessageSize,omitempty"`
+
+			Quota                 int64         `json:"Quota,omitempty"`
+			QuotaMessageRetention time.Duration `json:"QuotaMessageRetention,omitempty"`
 
 			// internal
 			protocolClient      weshnet.ServiceClient
@@ -185,10 +242,28 @@ type Manager struct {
 			dbCleanup           func()
 			requiredByClient    bool
 			localDBState        *messengertypes.LocalDatabaseState
+			usageStats          *usagestats.Collector
+			contactSpam         *contactspam.Scorer
+			contactThrottle     *contactthrottle.Throttle
+			onDeviceRevoked     func()
+			replayLogs          bool
+			onReplayProgress    func(done, total int)
+		}
+		MatrixBridge struct {
+			Homeserver string `json:"Homeserver,omitempty"`
+			ServerName string `json:"ServerName,omitempty"`
+			ASToken    string `json:"ASToken,omitempty"`
+			HSToken    string `json:"HSToken,omitempty"`
+			Listener   string `json:"Listener,omitempty"`
+
+			bridge *matrixbridge.Bridge
 		}
 		Replication struct {
-			db        *gorm.DB
-			dbCleanup func()
+			// PostgresDSN replaces the local replication db by a Postgres
+			// one, shared by the servers of a cluster.
+			PostgresDSN string `json:"PostgresDSN,omitempty"`
+			db          *gorm.DB
+			dbCleanup   func()
 		}
 		DirectoryService struct {
 			db        *gorm.DB
@@ -220,6 +295,13 @@ type Manager struct {
 	longHelp       [][2]string
 	nativeKeystore accountutils.NativeKeystore
 	accountID      string
+	reloader       *configreload.Reloader
+	muStages       sync.Mutex
+	stages         []*InitStage
+	failedStage    string
+	defaultsOnce   sync.Once
+	presetOnce     sync.Once
+	presetErr      error
 }
 
 type ManagerOpts struct {
@@ -264,6 +346,7 @@ func New(opts *ManagerOpts) (*Manager, error) {
 	m.Logging.StderrFormat = "color"
 	m.Logging.RingSize = 10 // 10MB ring buffer
 	m.Logging.TyberAutoAttach = ""
+	m.Logging.Level = "debug"
 
 	// generate SessionID using uuidv4 to identify each run
 	m.Session.ID = tyber.NewSessionID()
@@ -273,34 +356,43 @@ func New(opts *ManagerOpts) (*Manager, error) {
 
 	// storage path
 	if !opts.DoNotSetDefaultDir {
-		storagePath := configdir.New("berty-tech", "berty")
-		storageDirs := storagePath.QueryFolders(configdir.Global)
-		if len(storageDirs) == 0 {
+		// XDG directories, or the legacy config directory until it is
+		// migrated, see `berty store migrate-layout`
+		layout, err := accountutils.ResolveLayout("", "")
+		if err != nil {
 			m.ctxCancel()
-			return nil, fmt.Errorf("no storage path found")
+			return nil, fmt.Errorf("no storage path found: %w", err)
 		}
-		if err := storageDirs[0].CreateParentDir(""); err != nil {
+		if err := os.MkdirAll(filepath.Dir(layout.DataDir), 0o700); err != nil {
 			m.ctxCancel()
 			return nil, errcode.TODO.Wrap(err)
 		}
-		m.Datastore.defaultDir = storageDirs[0].Path
+		m.Datastore.defaultDir = layout.DataDir
+		m.Datastore.defaultStateDir = layout.StateDir
 	}
 
 	return &m, nil
 }
 
+// applyDefaults completes the settings once they are parsed, it is called by
+// the getters and only runs once, the getters may run concurrently, see
+// InitConcurrently.
 func (m *Manager) applyDefaults() {
-	if m.initLogger == nil {
-		if m.Logging.zapLogger != nil {
-			m.initLogger = m.Logging.zapLogger.Named("init")
-		} else {
-			m.initLogger = zap.NewNop()
+	m.defaultsOnce.Do(func() {
+		if m.initLogger == nil {
+			if m.Logging.zapLogger != nil {
+				m.initLogger = m.Logging.zapLogger.Named("init")
+			} else {
+				m.initLogger = zap.NewNop()
+			}
 		}
-	}
 
-	if m.Datastore.SharedDir == "" {
-		m.Datastore.SharedDir = m.Datastore.AppDir
-	}
+		if m.Datastore.SharedDir == "" {
+			m.Datastore.SharedDir = m.Datastore.AppDir
+		}
+
+		m.applyEphemeral()
+	})
 }
 
 func (m *Manager) GetContext() context.Context {
@@ -346,6 +438,7 @@ func (m *Manager) Close(prog *progress.Progress) error {
 	prog.AddStep("stop-grpc-server")
 	prog.AddStep("close-messenger-server")
 	prog.AddStep("close-messenger-protocol-client")
+	prog.AddStep("save-usage-stats")
 	prog.AddStep("cleanup-messenger-db")
 	prog.AddStep("cleanup-replication-db")
 	prog.AddStep("cleanup-directory-service-db")
@@ -354,6 +447,7 @@ func (m *Manager) Close(prog *progress.Progress) error {
 	prog.AddStep("close-mdns-service")
 	prog.AddStep("close-ipfs-node")
 	prog.AddStep("close-datastore")
+	prog.AddStep("unlock-store-dirs")
 	prog.AddStep("close-ring")
 	prog.AddStep("cleanup-logging")
 	prog.AddStep("finish")
@@ -396,6 +490,13 @@ func (m *Manager) Close(prog *progress.Progress) error {
 		m.Node.Messenger.protocolClient.Close()
 	}
 
+	prog.Get("save-usage-stats").SetAsCurrent()
+	if m.Node.Messenger.usageStats != nil {
+		if err := m.Node.Messenger.usageStats.Save(context.Background()); err != nil && m.initLogger != nil {
+			m.initLogger.Warn("unable to save usage stats", zap.Error(err))
+		}
+	}
+
 	prog.Get("cleanup-messenger-db").SetAsCurrent()
 	if m.Node.Messenger.dbCleanup != nil {
 		m.Node.Messenger.dbCleanup()
@@ -448,6 +549,9 @@ func (m *Manager) Close(prog *progress.Progress) error {
 		m.Datastore.rootDS.Close()
 	}
 
+	prog.Get("unlock-store-dirs").SetAsCurrent()
+	m.unlockStoreDirs()
+
 	prog.Get("cleanup-logging").SetAsCurrent()
 	if m.Logging.cleanup != nil {
 		m.Logging.cleanup()
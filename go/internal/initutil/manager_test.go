@@ -20,6 +20,7 @@ import (
 	"moul.io/u"
 
 	"berty.tech/berty/v2/go/internal/initutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/weshnet/pkg/protocoltypes"
 )
 
@@ -288,6 +289,106 @@ func TestLocalProtocolServerLeak(t *testing.T) {
 	require.NotNil(t, server)
 }
 
+func TestInitConcurrently(t *testing.T) {
+	manager, err := initutil.New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, manager)
+	defer manager.Close(nil)
+
+	// on disk, for the stages to run concurrently
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	manager.SetupLoggingFlags(fs)
+	manager.SetupLocalMessengerServerFlags(fs)
+	manager.SetupEmptyGRPCListenersFlags(fs)
+	err = fs.Parse([]string{"-store.dir=" + t.TempDir(), "-p2p.disable-ipfs-network", "-log.filters=", "-log.ring-filters="})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	events := map[string][]bool{}
+	err = manager.InitConcurrently(func(stage string, done bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		events[stage] = append(events[stage], done)
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	for _, e := range events {
+		require.Equal(t, []bool{false, true}, e)
+	}
+
+	names := []string{}
+	for _, stage := range manager.InitStages() {
+		names = append(names, stage.Name)
+	}
+	require.ElementsMatch(t, []string{initutil.InitStageRootDatastore, initutil.InitStageIPFS, initutil.InitStageOrbitDB, initutil.InitStageMessengerDB}, names)
+
+	// the components are cached
+	_, err = manager.GetMessengerDB()
+	require.NoError(t, err)
+	require.Len(t, manager.InitStages(), 4)
+}
+
+func TestStoreDirLocked(t *testing.T) {
+	dir := t.TempDir()
+
+	newManager := func() *initutil.Manager {
+		manager, err := initutil.New(nil)
+		require.NoError(t, err)
+		fs := flag.NewFlagSet("test", flag.ExitOnError)
+		manager.SetupLoggingFlags(fs)
+		manager.SetupDatastoreFlags(fs)
+		require.NoError(t, fs.Parse([]string{"-store.dir=" + dir, "-log.filters=", "-log.ring-filters="}))
+		return manager
+	}
+
+	man1 := newManager()
+	_, err := man1.GetRootDatastore()
+	require.NoError(t, err)
+
+	// a second node on the same store fails fast
+	man2 := newManager()
+	defer man2.Close(nil)
+	_, err = man2.GetRootDatastore()
+	require.True(t, errcode.Is(err, errcode.ErrBertyAccountAlreadyOpened))
+
+	// the store is released on close
+	require.NoError(t, man1.Close(nil))
+	_, err = man2.GetRootDatastore()
+	require.NoError(t, err)
+}
+
+func TestEphemeralAccount(t *testing.T) {
+	dir := t.TempDir()
+
+	manager, err := initutil.New(nil)
+	require.NoError(t, err)
+	defer manager.Close(nil)
+
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	manager.SetupLoggingFlags(fs)
+	manager.SetupDatastoreFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-store.dir=" + dir, "-store.ephemeral=200ms", "-log.filters=", "-log.ring-filters="}))
+
+	expiresAt := manager.EphemeralExpiry()
+	require.False(t, expiresAt.IsZero())
+	require.Equal(t, expiresAt, manager.EphemeralExpiry())
+
+	// nothing is written to the store directory
+	_, err = manager.GetRootDatastore()
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// the node stops when the account expires
+	select {
+	case <-manager.GetContext().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the manager was not stopped when the ephemeral account expired")
+	}
+}
+
 func TestCloseOnUninited(t *testing.T) {
 	defer verifyRunningLeakDetection(t)
 
@@ -0,0 +1,213 @@
+package initutil
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	datastore "github.com/ipfs/go-datastore"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"berty.tech/berty/v2/go/internal/attachmentstore"
+	"berty.tech/berty/v2/go/internal/matrixbridge"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/logutil"
+)
+
+// matrixBridgeRetryDelay is the time between two subscriptions to the
+// messenger events when the stream fails.
+const matrixBridgeRetryDelay = 5 * time.Second
+
+func (m *Manager) SetupMatrixBridgeFlags(fs *flag.FlagSet) {
+	fs.StringVar(&m.Node.MatrixBridge.Homeserver, "matrix.homeserver", "", "client-server API URL of the Matrix homeserver to relay the linked groups to (see `berty matrix-bridge`), the bridge is disabled if empty")
+	fs.StringVar(&m.Node.MatrixBridge.ServerName, "matrix.server-name", "", "domain of the Matrix users, as in @user:domain")
+	fs.StringVar(&m.Node.MatrixBridge.ASToken, "matrix.as-token", "", "as_token of the application service registration")
+	fs.StringVar(&m.Node.MatrixBridge.HSToken, "matrix.hs-token", "", "hs_token of the application service registration")
+	fs.StringVar(&m.Node.MatrixBridge.Listener, "matrix.listener", "127.0.0.1:29330", "address the homeserver pushes the room events to, the url of the application service registration")
+}
+
+// startMatrixBridge relays the linked groups to Matrix if -matrix.homeserver
+// is set, the messenger server must be initialized.
+func (m *Manager) startMatrixBridge(logger *zap.Logger, rootDS datastore.Datastore, attachments *attachmentstore.Store, grpcServer *grpc.Server) error {
+	if m.Node.MatrixBridge.Homeserver == "" || m.Node.MatrixBridge.bridge != nil {
+		return nil
+	}
+
+	logger = logger.Named("matrix")
+
+	client, err := m.getMessengerClient()
+	if err != nil {
+		return errcode.TODO.Wrap(err)
+	}
+
+	config := matrixbridge.Config{
+		HomeserverURL: m.Node.MatrixBridge.Homeserver,
+		ServerName:    m.Node.MatrixBridge.ServerName,
+		ASToken:       m.Node.MatrixBridge.ASToken,
+		HSToken:       m.Node.MatrixBridge.HSToken,
+	}
+	bridge, err := matrixbridge.New(m.getContext(), config, &bridgeMessenger{client: client}, matrixbridge.Opts{
+		Datastore:   rootDS,
+		Attachments: attachments,
+		Logger:      logger,
+	})
+	if err != nil {
+		return errcode.TODO.Wrap(fmt.Errorf("unable to init matrix bridge: %w", err))
+	}
+
+	l, err := net.Listen("tcp", m.Node.MatrixBridge.Listener)
+	if err != nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to listen on %s: %w", m.Node.MatrixBridge.Listener, err))
+	}
+
+	logger.Info("matrix bridge listener",
+		zap.String("homeserver", config.HomeserverURL),
+		logutil.PrivateString("listener", l.Addr().String()))
+
+	server := &http.Server{
+		Handler:           bridge,
+		ReadHeaderTimeout: time.Second * 5,
+	}
+
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			logger.Info("unable to serve the matrix bridge",
+				logutil.PrivateString("listener", l.Addr().String()),
+				zap.Error(err))
+		}
+	}()
+
+	ctx := m.getContext()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	go func() {
+		for {
+			err := relayMessagesToMatrix(ctx, client, bridge, logger)
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("matrix bridge event stream failed, retrying", zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(matrixBridgeRetryDelay):
+			}
+		}
+	}()
+
+	matrixbridge.Register(grpcServer, bridge)
+
+	m.Node.MatrixBridge.bridge = bridge
+	m.initLogger.Debug("matrix bridge initialized and cached")
+	return nil
+}
+
+// relayMessagesToMatrix hands the user messages of the account to the
+// bridge until the event stream fails, the bridge ignores the groups not
+// linked.
+func relayMessagesToMatrix(ctx context.Context, client messengertypes.MessengerServiceClient, bridge *matrixbridge.Bridge, logger *zap.Logger) error {
+	account, err := client.AccountGet(ctx, &messengertypes.AccountGet_Request{})
+	if err != nil {
+		return err
+	}
+
+	s, err := client.EventStream(ctx, &messengertypes.EventStream_Request{})
+	if err != nil {
+		return err
+	}
+
+	// the messages replayed on subscription are not relayed, the ones
+	// received while the bridge was stopped are lost for Matrix
+	replaying := true
+	for {
+		evt, err := s.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch evt.GetEvent().GetType() {
+		case messengertypes.StreamEvent_TypeListEnded:
+			replaying = false
+			continue
+		case messengertypes.StreamEvent_TypeInteractionUpdated:
+			if replaying {
+				continue
+			}
+		default:
+			continue
+		}
+
+		payload, err := evt.GetEvent().UnmarshalPayload()
+		if err != nil {
+			return err
+		}
+
+		i := payload.(*messengertypes.StreamEvent_InteractionUpdated).GetInteraction()
+		if i.GetType() != messengertypes.AppMessage_TypeUserMessage {
+			continue
+		}
+
+		msg, err := i.UnmarshalPayload()
+		if err != nil {
+			logger.Warn("invalid user message", zap.String("cid", i.GetCID()), zap.Error(err))
+			continue
+		}
+
+		// the senders are keyed by member, or by device when the member is
+		// unknown, as in the Matrix exports
+		senderPK, senderName := i.GetMemberPublicKey(), i.GetMember().GetDisplayName()
+		switch {
+		case i.GetIsMine():
+			senderPK, senderName = account.GetAccount().GetPublicKey(), account.GetAccount().GetDisplayName()
+		case senderPK == "":
+			senderPK = i.GetDevicePublicKey()
+		}
+
+		err = bridge.HandleMessage(ctx, &matrixbridge.Message{
+			GroupPK:    i.GetConversationPublicKey(),
+			CID:        i.GetCID(),
+			SenderPK:   senderPK,
+			SenderName: senderName,
+			IsMine:     i.GetIsMine(),
+			SentAt:     time.UnixMilli(i.GetSentDate()),
+			Body:       msg.(*messengertypes.AppMessage_UserMessage).GetBody(),
+		})
+		if err != nil {
+			logger.Error("unable to relay a message to Matrix", zap.String("cid", i.GetCID()), zap.Error(err))
+		}
+	}
+}
+
+// bridgeMessenger sends the messages relayed from Matrix with the messenger
+// client.
+type bridgeMessenger struct {
+	client messengertypes.MessengerServiceClient
+}
+
+func (b *bridgeMessenger) SendMessage(ctx context.Context, groupPK, body string) (string, error) {
+	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: body})
+	if err != nil {
+		return "", errcode.ErrSerialization.Wrap(err)
+	}
+
+	reply, err := b.client.Interact(ctx, &messengertypes.Interact_Request{
+		Type:                  messengertypes.AppMessage_TypeUserMessage,
+		Payload:               payload,
+		ConversationPublicKey: groupPK,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return reply.GetCID(), nil
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 
+	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/weshnet/pkg/logutil"
 )
 
@@ -58,15 +59,25 @@ func (m *Manager) getMetricsRegistry() (prometheus.Registerer, error) {
 
 	m.Metrics.registerer = registry
 
-	laddr, err := multiaddr.NewMultiaddr(m.Metrics.Listener)
+	if err := m.serveMetrics(logger, registry, m.Metrics.Listener); err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// serveMetrics serves the metrics of registry on listener until the manager
+// is closed or the listener is reloaded.
+func (m *Manager) serveMetrics(logger *zap.Logger, registry *prometheus.Registry, listener string) error {
+	laddr, err := multiaddr.NewMultiaddr(listener)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse multiaddr: %w", err)
+		return fmt.Errorf("unable to parse multiaddr: %w", err)
 	}
 
 	mux := http.NewServeMux()
 	l, err := manet.Listen(laddr)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	handerfor := promhttp.HandlerFor(
@@ -83,6 +94,7 @@ func (m *Manager) getMetricsRegistry() (prometheus.Registerer, error) {
 		Handler:           mux,
 		ReadHeaderTimeout: time.Second * 5,
 	}
+	m.Metrics.server = server
 
 	go func() {
 		if err := server.Serve(manet.NetListener(l)); err != nil {
@@ -98,5 +110,45 @@ func (m *Manager) getMetricsRegistry() (prometheus.Registerer, error) {
 		server.Close()
 	}()
 
-	return registry, nil
+	return nil
+}
+
+// reloadMetricsListener serves the metrics on the new listener, an empty one
+// stops serving them. The registry stays the one created when the metrics
+// were first used, -metrics.pedantic only applies on the next start.
+func (m *Manager) reloadMetricsListener(value string) error {
+	// the flag is read as usual when the metrics are first used
+	if m.Metrics.registerer == nil {
+		return nil
+	}
+
+	if value != "" {
+		if _, err := multiaddr.NewMultiaddr(value); err != nil {
+			return errcode.ErrInvalidInput.Wrap(err)
+		}
+	}
+
+	if m.Metrics.server != nil {
+		if err := m.Metrics.server.Close(); err != nil {
+			return errcode.ErrInternal.Wrap(err)
+		}
+		m.Metrics.server = nil
+	}
+
+	if value == "" {
+		return nil
+	}
+
+	// the default registry is used when the node started without listener
+	registry, ok := m.Metrics.registerer.(*prometheus.Registry)
+	if !ok {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the metrics registry cannot be served"))
+	}
+
+	logger, err := m.getLogger()
+	if err != nil {
+		return err
+	}
+
+	return m.serveMetrics(logger, registry, value)
 }
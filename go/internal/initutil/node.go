@@ -1,23 +1,51 @@
 package initutil
 
 import (
+	"context"
+	"crypto/ed25519"
 	"encoding/base64"
 	"flag"
 	"fmt"
 	"os"
 	"os/user"
+	"strconv"
 	"strings"
+	"time"
 
 	grpcgw "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/ipfs/kubo/core/corerepo"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"gorm.io/gorm"
 
+	"berty.tech/berty/v2/go/internal/accountquota"
 	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/internal/attachmentstore"
+	"berty.tech/berty/v2/go/internal/auditlog"
+	"berty.tech/berty/v2/go/internal/blockscrub"
+	"berty.tech/berty/v2/go/internal/configreload"
+	"berty.tech/berty/v2/go/internal/contactspam"
+	"berty.tech/berty/v2/go/internal/contactthrottle"
+	"berty.tech/berty/v2/go/internal/deliverystatus"
+	"berty.tech/berty/v2/go/internal/eventjournal"
 	"berty.tech/berty/v2/go/internal/grpcserver"
 	berty_grpcutil "berty.tech/berty/v2/go/internal/grpcutil"
+	"berty.tech/berty/v2/go/internal/joinapproval"
+	"berty.tech/berty/v2/go/internal/keyescrow"
+	"berty.tech/berty/v2/go/internal/messagedrafts"
+	"berty.tech/berty/v2/go/internal/messagereactions"
+	"berty.tech/berty/v2/go/internal/messagescheduler"
+	"berty.tech/berty/v2/go/internal/messagesequencer"
+	"berty.tech/berty/v2/go/internal/namecontexts"
+	"berty.tech/berty/v2/go/internal/peerlist"
+	"berty.tech/berty/v2/go/internal/profileprivacy"
+	"berty.tech/berty/v2/go/internal/replicationlag"
+	"berty.tech/berty/v2/go/internal/revokeddevices"
+	"berty.tech/berty/v2/go/internal/usagestats"
+	"berty.tech/berty/v2/go/internal/versionrpc"
 	"berty.tech/berty/v2/go/pkg/bertymessenger"
+	"berty.tech/berty/v2/go/pkg/bertyshortlink"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 	"berty.tech/berty/v2/go/pkg/pushtypes"
@@ -27,6 +55,7 @@ import (
 	"berty.tech/weshnet/pkg/lifecycle"
 	"berty.tech/weshnet/pkg/logutil"
 	"berty.tech/weshnet/pkg/protocoltypes"
+	"berty.tech/weshnet/pkg/rendezvous"
 	"berty.tech/weshnet/pkg/secretstore"
 )
 
@@ -52,6 +81,9 @@ func (m *Manager) SetupLocalProtocolServerFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&m.Node.ServiceInsecureMode, FlagNameAllowInsecureService, false, "use insecure connection on services")
 	m.SetupDatastoreFlags(fs)
 	m.SetupLocalIPFSFlags(fs)
+	fs.DurationVar(&m.Node.Protocol.BlockScrubInterval, "store.scrub-interval", blockscrub.DefaultInterval, "delay between two verifications of a sample of the stored IPFS blocks, 0 disables them (see `berty store scrub`)")
+	fs.IntVar(&m.Node.Protocol.BlockScrubSample, "store.scrub-sample", blockscrub.DefaultSampleSize, "number of IPFS blocks verified every -store.scrub-interval")
+	fs.BoolVar(&m.Node.Protocol.BlockScrubRefetch, "store.scrub-refetch", false, "fetch the corrupted IPFS blocks again from the peers")
 	// p2p.remote-ipfs
 }
 
@@ -105,10 +137,42 @@ func (m *Manager) SetupLocalMessengerServerFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&m.Node.Messenger.RebuildSqlite, "node.rebuild-db", false, "reconstruct messenger DB from OrbitDB logs")
 	fs.BoolVar(&m.Node.Messenger.DisableGroupMonitor, "node.disable-group-monitor", false, "disable group monitoring")
 	fs.StringVar(&m.Node.Messenger.DisplayName, "node.display-name", safeDefaultDisplayName(), "display name")
+	fs.Float64Var(&m.Node.Messenger.ContactRequestsRejectThreshold, "node.contact-requests-reject-threshold", -1, "discard incoming contact requests with a spam score of at least this value (0-1, 0 disables), saved for the account, negative keeps the saved value")
+	fs.IntVar(&m.Node.Messenger.ContactRequestsPerEpoch, "node.contact-requests-per-epoch", contactthrottle.DefaultLimit, "incoming contact requests processed per rendezvous epoch (see -node.rdv-rotation), the next ones are deferred to a backlog without notification, 0 disables the limit")
+	fs.StringVar(&m.Node.Messenger.AttachmentRetention, "node.attachment-retention", "", "how long the sent attachments are kept locally: `forever`, a number of days, e.g. 30d, or until-acked by every recipient, saved for the account, empty keeps the saved value")
+	fs.StringVar(&m.Node.Messenger.CloudBackupURL, "node.cloud-backup-url", "", "WebDAV collection receiving encrypted snapshots of the account, e.g. a Nextcloud folder, saved for the account, empty keeps the saved value, `none` disables the backups")
+	fs.StringVar(&m.Node.Messenger.CloudBackupUsername, "node.cloud-backup-username", "", "user of the WebDAV backup collection, saved with -node.cloud-backup-url")
+	fs.StringVar(&m.Node.Messenger.CloudBackupPassword, "node.cloud-backup-password", "", "password of the WebDAV backup collection, e.g. a Nextcloud app password, saved with -node.cloud-backup-url")
+	fs.StringVar(&m.Node.Messenger.CloudBackupPassphrase, "node.cloud-backup-passphrase", "", "passphrase encrypting the snapshots, required to restore them, saved with -node.cloud-backup-url")
+	fs.DurationVar(&m.Node.Messenger.CloudBackupInterval, "node.cloud-backup-interval", -1, "time between two snapshots of the account, 0 only lists and restores them, saved for the account, negative keeps the saved value")
+	fs.IntVar(&m.Node.Messenger.CloudBackupKeep, "node.cloud-backup-keep", -1, "number of snapshots kept on the remote, 0 keeps every one, saved for the account, negative keeps the saved value")
+	fs.StringVar(&m.Node.Messenger.ShortLinkRelay, "node.short-link-relay", "", "base URL of a link-shortening relay (see `berty short-link-relay`) registering the invitation links for short URLs, and resolving them")
+	fs.StringVar(&m.Node.Messenger.HideProfile, "node.hide-profile", "", "`true` to never publish the display name of the account, contacts then see a short public key, saved for the account, empty keeps the saved value")
+	fs.StringVar(&m.Node.Messenger.PushPayload, "node.push-payload", "", "what the pushes of the account carry, `full` previews, `sender` only shows who sent the message, `none` sends content-free pushes, saved for the account, empty keeps the saved value")
+	if m.Node.Messenger.InactiveSync == "" {
+		m.Node.Messenger.InactiveSync = string(bertymessenger.InactiveSyncSuspend)
+	}
+	fs.StringVar(&m.Node.Messenger.InactiveSync, "node.inactive-sync", m.Node.Messenger.InactiveSync, "groups synced while the app is inactive: `suspend` all of them, `light` to keep the account and contact groups for notifications, or `poll` to sync them periodically when there are no push notifications")
+	fs.DurationVar(&m.Node.Messenger.InactivePollInterval, "node.inactive-poll-interval", bertymessenger.DefaultPollInterval, "time between two syncs of the account and contact groups while inactive, with -node.inactive-sync=poll")
+	fs.IntVar(&m.Node.Messenger.MaxMessageSize, "node.max-message-size", bertymessenger.DefaultMaxMessageSize, "size in bytes of the largest app message sent at once, the larger ones are sent in chunks")
+	fs.IntVar(&m.Node.Messenger.MaxChunkedMessageSize, "node.max-chunked-message-size", bertymessenger.DefaultMaxChunkedMessageSize, "size in bytes of the largest app message sent or received in chunks")
+	fs.Int64Var(&m.Node.Messenger.Quota, "node.quota", 0, "size in bytes of the account on disk, over it the oldest attachments, IPFS blocks and messages are pruned, then the new messages are refused, 0 disables the quota")
+	fs.DurationVar(&m.Node.Messenger.QuotaMessageRetention, "node.quota-message-retention", bertymessenger.DefaultMessageRetention, "age under which the messages and their attachments are never pruned by -node.quota")
+	fs.BoolVar(&m.Node.Messenger.UsageStats, "node.usage-stats", false, "aggregate usage statistics locally, they are never uploaded (see `berty usage-stats`)")
 	// node.db-opts // see https://github.com/mattn/go-sqlite3#connection-string
 }
 
+// applyPreset changes the settings of the preset, it only runs once, as
+// applyDefaults.
 func (m *Manager) applyPreset() error {
+	m.presetOnce.Do(func() {
+		m.presetErr = m.applyPresetSettings()
+	})
+
+	return m.presetErr
+}
+
+func (m *Manager) applyPresetSettings() error {
 	switch m.Node.Preset {
 	case "":
 		// noop
@@ -147,7 +211,7 @@ func (m *Manager) getPushSecretKey() (*[cryptoutil.KeySize]byte, error) {
 
 		_, pushKey, err = accountutils.GetDevicePushKeyForPath(m.Node.Protocol.DevicePushKeyPath, true)
 		if err != nil {
-			return nil, errcode.ErrInternal.Wrap(err)
+			return nil, err
 		}
 	}
 
@@ -164,6 +228,10 @@ func (m *Manager) getLocalProtocolServer() (weshnet.Service, error) {
 		return nil, errcode.TODO.Wrap(err)
 	}
 
+	if err := m.startDebugListener(); err != nil {
+		return nil, err
+	}
+
 	rootDS, err := m.getRootDatastore()
 	if err != nil {
 		return nil, errcode.TODO.Wrap(err)
@@ -179,6 +247,19 @@ func (m *Manager) getLocalProtocolServer() (weshnet.Service, error) {
 		return nil, errcode.TODO.Wrap(err)
 	}
 
+	// verifies the stored blocks in the background and on demand
+	blockscrub.Register(grpcServer, m.getBlockScrubber(logger))
+
+	// edits the bootstrap peers and the relays of the account at runtime
+	peerList, err := m.getPeerListManager(logger)
+	if err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+	peerlist.Register(grpcServer, peerList)
+
+	// reloads the configuration as SIGHUP does, see SetupConfigReload
+	configreload.Register(grpcServer, m.ReloadConfig)
+
 	odb, err := m.getOrbitDB()
 	if err != nil {
 		return nil, errcode.TODO.Wrap(err)
@@ -229,6 +310,29 @@ func (m *Manager) getLocalProtocolServer() (weshnet.Service, error) {
 	return m.Node.Protocol.server, nil
 }
 
+func (m *Manager) getBlockScrubber(logger *zap.Logger) *blockscrub.Scrubber {
+	if m.Node.Protocol.blockScrubber != nil {
+		return m.Node.Protocol.blockScrubber
+	}
+
+	opts := blockscrub.Opts{
+		Logger:     logger.Named("scrub"),
+		Interval:   m.Node.Protocol.BlockScrubInterval,
+		SampleSize: m.Node.Protocol.BlockScrubSample,
+	}
+	if m.Node.Protocol.BlockScrubRefetch && !m.Node.Protocol.DisableIPFSNetwork {
+		opts.Fetcher = m.Node.Protocol.ipfsNode.Exchange
+	}
+
+	m.Node.Protocol.blockScrubber = blockscrub.New(m.Node.Protocol.ipfsNode.Blockstore, opts)
+	if m.Node.Protocol.BlockScrubInterval > 0 {
+		go m.Node.Protocol.blockScrubber.Run(m.getContext())
+	}
+
+	m.initLogger.Debug("block scrubber initialized and cached")
+	return m.Node.Protocol.blockScrubber
+}
+
 func (m *Manager) GetGRPCClientConn() (*grpc.ClientConn, error) {
 	defer m.prepareForGetter()()
 
@@ -436,6 +540,9 @@ func (m *Manager) getGRPCServer() (*grpc.Server, *grpcgw.ServeMux, error) {
 		return nil, nil, err
 	}
 
+	// lets the remote clients check they are compatible with this node
+	versionrpc.RegisterWithStartup(grpcServer, m.InitStages)
+
 	m.initLogger.Debug("gRPC server initialized and cached")
 	m.Node.GRPC.server = grpcServer
 	m.Node.GRPC.gatewayMux = grpcGatewayMux
@@ -466,6 +573,10 @@ func (m *Manager) getMessengerDB() (*gorm.DB, error) {
 		return nil, errcode.TODO.Wrap(err)
 	}
 
+	if err := m.lockStoreDirs(); err != nil {
+		return nil, err
+	}
+
 	dir, err := m.getSharedDataDir()
 	if err != nil {
 		return nil, errcode.TODO.Wrap(err)
@@ -489,6 +600,36 @@ func (m *Manager) getMessengerDB() (*gorm.DB, error) {
 	return m.Node.Messenger.db, nil
 }
 
+// GetMessengerDBReadOnly opens a read-only connection to the messenger db of
+// the account, which can be used while another process runs its node. The
+// connection is not shared, the caller must close it with the returned
+// cleanup function.
+func (m *Manager) GetMessengerDBReadOnly() (*gorm.DB, func(), error) {
+	defer m.prepareForGetter()()
+
+	logger, err := m.getLogger()
+	if err != nil {
+		return nil, nil, errcode.TODO.Wrap(err)
+	}
+
+	dir, err := m.getSharedDataDir()
+	if err != nil {
+		return nil, nil, errcode.TODO.Wrap(err)
+	}
+
+	key, err := m.GetAccountStorageKey()
+	if err != nil {
+		return nil, nil, errcode.TODO.Wrap(err)
+	}
+
+	salt, err := m.GetAccountMessengerDBSalt()
+	if err != nil {
+		return nil, nil, errcode.TODO.Wrap(err)
+	}
+
+	return accountutils.GetMessengerDBForPathReadOnly(dir, key, salt, logger)
+}
+
 func (m *Manager) GetReplicationDB() (*gorm.DB, error) {
 	defer m.prepareForGetter()()
 
@@ -496,7 +637,14 @@ func (m *Manager) GetReplicationDB() (*gorm.DB, error) {
 }
 
 func (m *Manager) getReplicationDB() (*gorm.DB, error) {
-	return m.getServiceDB(&m.Node.Replication.db, &m.Node.Replication.dbCleanup, accountutils.GetReplicationDBForPath)
+	opener := accountutils.GetReplicationDBForPath
+	if dsn := m.Node.Replication.PostgresDSN; dsn != "" {
+		opener = func(_ string, logger *zap.Logger) (*gorm.DB, func(), error) {
+			return accountutils.GetReplicationDBForPostgres(dsn, logger)
+		}
+	}
+
+	return m.getServiceDB(&m.Node.Replication.db, &m.Node.Replication.dbCleanup, opener)
 }
 
 func (m *Manager) GetDirectoryServiceDB() (*gorm.DB, error) {
@@ -535,6 +683,49 @@ func (m *Manager) getServiceDB(dbPtr **gorm.DB, cleanupPtr *func(), dbOpenerFunc
 	return *dbPtr, nil
 }
 
+// getAccountQuota returns the quota of the account on disk, see -node.quota.
+func (m *Manager) getAccountQuota() (bertymessenger.AccountQuota, error) {
+	quota := bertymessenger.AccountQuota{
+		Limit:            m.Node.Messenger.Quota,
+		MessageRetention: m.Node.Messenger.QuotaMessageRetention,
+	}
+
+	switch {
+	case quota.Limit == 0:
+		return quota, nil
+	case quota.Limit < 0:
+		return quota, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid -node.quota: negative size %d", quota.Limit))
+	case m.Datastore.InMemory:
+		return quota, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid -node.quota: an in-memory account has no size on disk"))
+	}
+
+	appDir, err := m.getAppDataDir()
+	if err != nil {
+		return quota, errcode.TODO.Wrap(err)
+	}
+
+	sharedDir, err := m.getSharedDataDir()
+	if err != nil {
+		return quota, errcode.TODO.Wrap(err)
+	}
+
+	quota.Size = func() (int64, error) {
+		return accountquota.DirSize(appDir, sharedDir)
+	}
+
+	// the blocks can only be collected on a local node
+	if node := m.Node.Protocol.ipfsNode; node != nil {
+		quota.PruneBlocks = func(ctx context.Context) (bool, error) {
+			if err := corerepo.GarbageCollect(node, ctx); err != nil {
+				return false, errcode.ErrInternal.Wrap(err)
+			}
+			return false, nil
+		}
+	}
+
+	return quota, nil
+}
+
 func (m *Manager) restoreMessengerDataFromExport() error {
 	if m.Node.Messenger.ExportPathToRestore == "" {
 		return nil
@@ -573,6 +764,28 @@ func (m *Manager) restoreMessengerDataFromExport() error {
 	return nil
 }
 
+// SetDeviceRevokedHandler sets the function called when another device of
+// the account revoked this one, it must be called before the messenger server
+// is started.
+func (m *Manager) SetDeviceRevokedHandler(handler func()) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.Node.Messenger.onDeviceRevoked = handler
+}
+
+// SetMessengerDBReplay makes the messenger server materialize its db again
+// from the group logs when it starts, progress is optional, it is called
+// after each replayed group. It must be called before the messenger server
+// is started.
+func (m *Manager) SetMessengerDBReplay(progress func(done, total int)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.Node.Messenger.replayLogs = true
+	m.Node.Messenger.onReplayProgress = progress
+}
+
 func (m *Manager) GetLocalMessengerServer() (messengertypes.MessengerServiceServer, error) {
 	defer m.prepareForGetter()()
 
@@ -652,25 +865,211 @@ func (m *Manager) getLocalMessengerServer() (messengertypes.MessengerServiceServ
 		}
 	}
 
+	rootDS, err := m.getRootDatastore()
+	if err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+
+	// usage stats, opt-in only
+	if m.Node.Messenger.UsageStats {
+		m.Node.Messenger.usageStats, err = usagestats.New(m.getContext(), rootDS)
+		if err != nil {
+			return nil, errcode.TODO.Wrap(fmt.Errorf("unable to init usage stats: %w", err))
+		}
+
+		go m.Node.Messenger.usageStats.Run(m.getContext(), time.Minute)
+	}
+
+	// audit log of the security-relevant events, always recorded locally
+	auditLog, err := auditlog.Open(m.getContext(), rootDS)
+	if err != nil {
+		return nil, errcode.TODO.Wrap(fmt.Errorf("unable to open audit log: %w", err))
+	}
+
+	// protocol events replayed by the stateless clients and the bridges
+	eventJournal, err := eventjournal.Open(m.getContext(), rootDS, eventjournal.DefaultMaxEntries)
+	if err != nil {
+		return nil, errcode.TODO.Wrap(fmt.Errorf("unable to open event journal: %w", err))
+	}
+
+	// contact requests spam scoring, configured per account
+	spamConfig, err := contactspam.LoadConfig(m.getContext(), rootDS)
+	if err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+
+	if threshold := m.Node.Messenger.ContactRequestsRejectThreshold; threshold >= 0 {
+		spamConfig.RejectThreshold = threshold
+		if err := contactspam.SaveConfig(m.getContext(), rootDS, spamConfig); err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+	}
+
+	m.Node.Messenger.contactSpam = contactspam.NewScorer(spamConfig)
+
+	// contact requests over the limit of a rendezvous epoch are deferred
+	rotationBase, err := m.GetRendezvousRotationBase()
+	if err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+	if rotationBase == 0 {
+		rotationBase = rendezvous.DefaultRotationInterval
+	}
+
+	contactThrottle, err := contactthrottle.New(rootDS, m.Node.Messenger.ContactRequestsPerEpoch, rotationBase)
+	if err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+	m.Node.Messenger.contactThrottle = contactThrottle
+
+	// display name publication, configured per account
+	privacyConfig, err := profileprivacy.LoadConfig(m.getContext(), rootDS)
+	if err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+
+	if value := m.Node.Messenger.HideProfile; value != "" {
+		if privacyConfig.HideProfile, err = strconv.ParseBool(value); err != nil {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid -node.hide-profile: %w", err))
+		}
+		if err := profileprivacy.SaveConfig(m.getContext(), rootDS, privacyConfig); err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+	}
+
+	// content of the pushes, configured per account and applied once the
+	// messenger shares the push token again
+	pushPayload := pushtypes.PayloadFull
+	if value := m.Node.Messenger.PushPayload; value != "" {
+		if pushPayload, err = pushtypes.ParsePayloadLevel(value); err != nil {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid -node.push-payload: %w", err))
+		}
+	}
+
+	// display names by context, configured per account
+	nameContextsConfig, err := namecontexts.LoadConfig(m.getContext(), rootDS)
+	if err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+
+	// retention of the sent attachments, configured per account
+	retentionConfig, err := attachmentstore.LoadRetentionConfig(m.getContext(), rootDS)
+	if err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+
+	if value := m.Node.Messenger.AttachmentRetention; value != "" {
+		if retentionConfig.Default, err = attachmentstore.ParseRetention(value); err != nil {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid -node.attachment-retention: %w", err))
+		}
+		if err := attachmentstore.SaveRetentionConfig(m.getContext(), rootDS, retentionConfig); err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+	}
+
+	// encrypted snapshots of the account, configured per account
+	cloudBackup, cloudBackupConfig, err := m.getCloudBackup(rootDS)
+	if err != nil {
+		return nil, err
+	}
+
+	// short invitation links, signed by a key of the account
+	var (
+		shortLinkRelay *bertyshortlink.Client
+		shortLinkKey   ed25519.PrivateKey
+	)
+	if m.Node.Messenger.ShortLinkRelay != "" {
+		if shortLinkRelay, err = bertyshortlink.NewClient(m.Node.Messenger.ShortLinkRelay, nil); err != nil {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid -node.short-link-relay: %w", err))
+		}
+		if shortLinkKey, err = bertyshortlink.LoadOrCreateKey(m.getContext(), rootDS); err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+	}
+
+	// replication lag by group, for the metrics endpoint
+	var replicationLag *replicationlag.Recorder
+	if m.Metrics.Listener != "" {
+		registry, err := m.getMetricsRegistry()
+		if err != nil {
+			return nil, err
+		}
+
+		replicationLag = replicationlag.New()
+		if err := registry.Register(replicationLag); err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+	}
+
+	accountQuota, err := m.getAccountQuota()
+	if err != nil {
+		return nil, err
+	}
+
+	// shared with the matrix bridge
+	attachments := attachmentstore.New(rootDS)
+
 	// messenger server
 	opts := bertymessenger.Opts{
-		EnableGroupMonitor:  !m.Node.Messenger.DisableGroupMonitor,
-		DB:                  db,
-		Logger:              logger,
-		NotificationManager: notifmanager,
-		LifeCycleManager:    lcmanager,
-		StateBackup:         m.Node.Messenger.localDBState,
-		Ring:                m.Logging.ring,
-		PushKey:             pushKey,
-		PlatformPushToken:   pushPlatformToken,
-		LogFilePath:         currentLogfilePath,
-		GRPCInsecureMode:    m.Node.ServiceInsecureMode,
+		EnableGroupMonitor:    !m.Node.Messenger.DisableGroupMonitor,
+		DB:                    db,
+		Logger:                logger,
+		NotificationManager:   notifmanager,
+		LifeCycleManager:      lcmanager,
+		StateBackup:           m.Node.Messenger.localDBState,
+		Ring:                  m.Logging.ring,
+		PushKey:               pushKey,
+		PlatformPushToken:     pushPlatformToken,
+		LogFilePath:           currentLogfilePath,
+		GRPCInsecureMode:      m.Node.ServiceInsecureMode,
+		UsageStats:            m.Node.Messenger.usageStats,
+		AttachmentStore:       attachments,
+		AttachmentRetention:   retentionConfig.Default,
+		ContactSpamScorer:     m.Node.Messenger.contactSpam,
+		ContactThrottle:       contactThrottle,
+		ProfilePrivacy:        profileprivacy.NewSettings(rootDS, privacyConfig),
+		DisplayNameContexts:   namecontexts.New(rootDS, nameContextsConfig),
+		DeliveryStatus:        deliverystatus.NewTracker(),
+		Reconnect:             m.getReconnectScheduler(logger),
+		MessageScheduler:      messagescheduler.New(rootDS, logger.Named("scheduler")),
+		MessageDrafts:         messagedrafts.New(rootDS),
+		MessageReactions:      messagereactions.New(rootDS),
+		RevokedDevices:        revokeddevices.New(rootDS),
+		JoinApproval:          joinapproval.New(rootDS),
+		KeyEscrow:             keyescrow.New(rootDS),
+		CloudBackup:           cloudBackup,
+		CloudBackupInterval:   cloudBackupConfig.Interval,
+		CloudBackupKeep:       cloudBackupConfig.Keep,
+		ShortLinkRelay:        shortLinkRelay,
+		ShortLinkKey:          shortLinkKey,
+		NetworkUsage:          m.Node.Protocol.netUsage,
+		MessageSequencer:      messagesequencer.New(rootDS),
+		ReplicationLag:        replicationLag,
+		AccountQuota:          accountQuota,
+		AuditLog:              auditLog,
+		EventJournal:          eventJournal,
+		CaptureCPUProfile:     m.CaptureCPUProfile,
+		InactiveSync:          bertymessenger.InactiveSync(m.Node.Messenger.InactiveSync),
+		PollInterval:          m.Node.Messenger.InactivePollInterval,
+		MaxMessageSize:        m.Node.Messenger.MaxMessageSize,
+		MaxChunkedMessageSize: m.Node.Messenger.MaxChunkedMessageSize,
+		OnDeviceRevoked:       m.Node.Messenger.onDeviceRevoked,
+		ReplayLogs:            m.Node.Messenger.replayLogs,
+		OnReplayProgress:      m.Node.Messenger.onReplayProgress,
 	}
 	messengerServer, err := bertymessenger.New(protocolClient, &opts)
 	if err != nil {
 		return nil, errcode.TODO.Wrap(fmt.Errorf("unable to init messenger server: %w", err))
 	}
 
+	if m.Node.Messenger.PushPayload != "" {
+		if settings, ok := messengerServer.(bertymessenger.PrivacySettings); ok {
+			if err := settings.SetPushPayload(m.getContext(), pushPayload); err != nil {
+				return nil, errcode.TODO.Wrap(err)
+			}
+		}
+	}
+
 	// register grpc service
 	messengertypes.RegisterMessengerServiceServer(grpcServer, messengerServer)
 	if err := messengertypes.RegisterMessengerServiceHandlerServer(m.getContext(), gatewayMux, messengerServer); err != nil {
@@ -688,6 +1087,12 @@ func (m *Manager) getLocalMessengerServer() (messengertypes.MessengerServiceServ
 
 	m.Node.Messenger.lcmanager = lcmanager
 	m.Node.Messenger.server = messengerServer
+
+	// relays the linked groups to a Matrix homeserver, when configured
+	if err := m.startMatrixBridge(logger, rootDS, attachments, grpcServer); err != nil {
+		return nil, err
+	}
+
 	m.initLogger.Debug("messenger server initialized and cached")
 	return m.Node.Messenger.server, nil
 }
@@ -0,0 +1,175 @@
+package initutil
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/versiontypes"
+)
+
+// The stages of InitConcurrently.
+const (
+	InitStageRootDatastore = "root-datastore"
+	InitStageIPFS          = "ipfs"
+	InitStageOrbitDB       = "orbitdb"
+	InitStageMessengerDB   = "messenger-db"
+)
+
+// InitStage is a stage of the initialization of the node, they are reported
+// by the version service.
+type InitStage = versiontypes.Stage
+
+// InitConcurrently initializes the components of the node which do not
+// depend on each other at the same time: the messenger db is opened while
+// the root datastore, the IPFS node and orbitdb start one after the other.
+// On slow disks the open of the account then lasts as long as the slowest
+// chain instead of the sum of all the stages. onStage is optional, it is
+// called when a stage starts and when it is done, possibly concurrently.
+func (m *Manager) InitConcurrently(onStage func(stage string, done bool)) error {
+	defer m.prepareForGetter()()
+
+	if onStage == nil {
+		onStage = func(string, bool) {}
+	}
+
+	// shared by both chains, they are initialized first for the chains to
+	// only read them
+	m.applyDefaults()
+	if err := m.applyPreset(); err != nil {
+		return errcode.ErrIPFSInit.Wrap(err)
+	}
+	if _, err := m.getLogger(); err != nil {
+		return errcode.TODO.Wrap(err)
+	}
+	if _, err := m.getSharedDataDir(); err != nil {
+		return errcode.TODO.Wrap(err)
+	}
+	if err := m.lockStoreDirs(); err != nil {
+		return err
+	}
+	if _, err := m.GetAccountStorageKey(); err != nil {
+		return errcode.ErrKeystoreGet.Wrap(err)
+	}
+	if _, err := m.GetAccountRootDatastoreSalt(); err != nil {
+		return errcode.ErrKeystoreGet.Wrap(err)
+	}
+	if _, err := m.GetAccountMessengerDBSalt(); err != nil {
+		return errcode.ErrKeystoreGet.Wrap(err)
+	}
+
+	stage := func(name string, init func() error) error {
+		onStage(name, false)
+		start := time.Now()
+		err := init()
+		m.addInitStage(name, time.Since(start))
+		onStage(name, true)
+		return err
+	}
+
+	var (
+		wg                        sync.WaitGroup
+		protocolErr, messengerErr error
+		// the last stage started by the protocol chain
+		protocolStage string
+	)
+
+	// an in-memory node has no disk to wait for
+	run := func(chain func()) {
+		if m.Datastore.InMemory {
+			chain()
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			chain()
+		}()
+	}
+
+	run(func() {
+		protocolStage = InitStageRootDatastore
+		protocolErr = stage(InitStageRootDatastore, func() error {
+			_, err := m.getRootDatastore()
+			return err
+		})
+		if protocolErr != nil {
+			return
+		}
+
+		protocolStage = InitStageIPFS
+		protocolErr = stage(InitStageIPFS, func() error {
+			_, _, err := m.getLocalIPFS()
+			return err
+		})
+		if protocolErr != nil {
+			return
+		}
+
+		protocolStage = InitStageOrbitDB
+		protocolErr = stage(InitStageOrbitDB, func() error {
+			_, err := m.getOrbitDB()
+			return err
+		})
+	})
+	run(func() {
+		messengerErr = stage(InitStageMessengerDB, func() error {
+			_, err := m.getMessengerDB()
+			return err
+		})
+	})
+	wg.Wait()
+
+	if protocolErr != nil {
+		m.setFailedInitStage(protocolStage)
+		return protocolErr
+	}
+	if messengerErr != nil {
+		m.setFailedInitStage(InitStageMessengerDB)
+		return messengerErr
+	}
+
+	fields := []zap.Field{}
+	for _, s := range m.InitStages() {
+		fields = append(fields, zap.Duration(s.Name, s.Duration))
+	}
+	m.initLogger.Info("node components initialized", fields...)
+
+	return nil
+}
+
+func (m *Manager) addInitStage(name string, duration time.Duration) {
+	m.muStages.Lock()
+	defer m.muStages.Unlock()
+
+	m.stages = append(m.stages, &InitStage{Name: name, Duration: duration})
+}
+
+func (m *Manager) setFailedInitStage(name string) {
+	m.muStages.Lock()
+	defer m.muStages.Unlock()
+
+	m.failedStage = name
+}
+
+// FailedInitStage returns the stage at which InitConcurrently failed, or an
+// empty string if it did not fail. When both chains fail, it is the stage of
+// the protocol chain, as the returned error.
+func (m *Manager) FailedInitStage() string {
+	m.muStages.Lock()
+	defer m.muStages.Unlock()
+
+	return m.failedStage
+}
+
+// InitStages returns the duration of the stages run by InitConcurrently, in
+// the order they were done.
+func (m *Manager) InitStages() []*InitStage {
+	m.muStages.Lock()
+	defer m.muStages.Unlock()
+
+	return append([]*InitStage(nil), m.stages...)
+}
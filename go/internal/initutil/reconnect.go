@@ -0,0 +1,23 @@
+package initutil
+
+import (
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/reconnect"
+)
+
+// getReconnectScheduler returns the scheduler of the reconnections of the
+// node, it runs them on the transitions reported by the NetManager.
+func (m *Manager) getReconnectScheduler(logger *zap.Logger) *reconnect.Scheduler {
+	if m.Node.Protocol.reconnect != nil {
+		return m.Node.Protocol.reconnect
+	}
+
+	m.Node.Protocol.reconnect = reconnect.New(logger.Named("reconnect"))
+	if m.Node.Protocol.NetManager != nil {
+		go m.Node.Protocol.reconnect.Run(m.getContext(), m.Node.Protocol.NetManager)
+	}
+
+	m.initLogger.Debug("reconnect scheduler initialized and cached")
+	return m.Node.Protocol.reconnect
+}
@@ -0,0 +1,146 @@
+package initutil
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/peterbourgon/ff/v3"
+	"go.uber.org/zap/zapcore"
+
+	"berty.tech/berty/v2/go/internal/configreload"
+	"berty.tech/berty/v2/go/internal/contactspam"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// SetupConfigReload enables ReloadConfig for fs, the parsed flag set of the
+// command. newFlagSet must define the same flags on a throwaway manager, args
+// and options are the ones fs was parsed with.
+func (m *Manager) SetupConfigReload(fs *flag.FlagSet, newFlagSet func(*Manager) *flag.FlagSet, args []string, options []ff.Option) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	logger, err := m.getLogger()
+	if err != nil {
+		return err
+	}
+
+	reloader, err := configreload.New(configreload.Opts{
+		Logger:     logger.Named("reload"),
+		FlagSet:    fs,
+		NewFlagSet: func() *flag.FlagSet { return newFlagSet(&Manager{}) },
+		Args:       args,
+		Options:    options,
+	})
+	if err != nil {
+		return err
+	}
+
+	// every other setting is read once, when the node starts
+	reloader.Register("log.level", m.reloadLogLevel)
+	reloader.Register("node.contact-requests-reject-threshold", m.reloadContactRequestsRejectThreshold)
+	reloader.Register("node.contact-requests-per-epoch", m.reloadContactRequestsPerEpoch)
+	reloader.Register("metrics.listener", m.reloadMetricsListener)
+	reloader.Register("preset", m.reloadPreset)
+
+	m.reloader = reloader
+	return nil
+}
+
+// ReloadConfig reads the config file and the environment again, applies the
+// settings which can change while the node runs and reports the other ones.
+func (m *Manager) ReloadConfig() (*configreload.Report, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.reloader == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("config reload is not enabled for this command"))
+	}
+
+	return m.reloader.Reload()
+}
+
+func (m *Manager) reloadLogLevel(value string) error {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	if m.Logging.level == nil {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the logger was not created from the flags"))
+	}
+
+	m.Logging.level.SetLevel(level)
+	return nil
+}
+
+func (m *Manager) reloadContactRequestsRejectThreshold(value string) error {
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	// negative keeps the saved value, and before the messenger starts the
+	// flag is read as usual
+	if threshold < 0 || m.Node.Messenger.contactSpam == nil {
+		return nil
+	}
+
+	config := m.Node.Messenger.contactSpam.Config()
+	config.RejectThreshold = threshold
+	if err := m.Node.Messenger.contactSpam.SetConfig(config); err != nil {
+		return err
+	}
+
+	rootDS, err := m.getRootDatastore()
+	if err != nil {
+		return err
+	}
+
+	return contactspam.SaveConfig(m.getContext(), rootDS, config)
+}
+
+func (m *Manager) reloadContactRequestsPerEpoch(value string) error {
+	limit, err := strconv.Atoi(value)
+	if err != nil {
+		return errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	// before the messenger starts the flag is read as usual
+	if m.Node.Messenger.contactThrottle == nil {
+		return nil
+	}
+
+	return m.Node.Messenger.contactThrottle.SetLimit(limit)
+}
+
+// reloadPreset applies the network profile of a preset. Only the anonymity
+// preset changes the running node, it stops the mDNS discovery: the proximity
+// transports are created with the libp2p host and the volatile preset
+// changes the storage, they need a restart.
+func (m *Manager) reloadPreset(value string) error {
+	switch value {
+	case "", PerformancePreset, AnonymityPreset, VolatilePreset:
+	default:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown preset: %q", value))
+	}
+
+	previous := m.Node.Preset
+	switch {
+	case value == VolatilePreset || previous == VolatilePreset:
+		return fmt.Errorf("the %s preset changes the storage of the node: %w", VolatilePreset, configreload.ErrRestartRequired)
+	case previous == AnonymityPreset && value != AnonymityPreset:
+		return fmt.Errorf("the proximity transports are only enabled when the node starts: %w", configreload.ErrRestartRequired)
+	case value != AnonymityPreset:
+		// the performance preset keeps the default values
+		return nil
+	}
+
+	m.stopMDNS()
+
+	if m.Node.Protocol.Ble.Enable || m.Node.Protocol.Nearby.Enable || m.Node.Protocol.MultipeerConnectivity {
+		return fmt.Errorf("mDNS stopped, the proximity transports are only disabled when the node starts: %w", configreload.ErrRestartRequired)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package initutil
+
+import (
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/accountlock"
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// lockStoreDirs locks the store directories before the databases are opened
+// for writing, so that a second node started on them fails instead of
+// corrupting their SQLite files. The read-only connections of
+// GetMessengerDBReadOnly don't need them.
+func (m *Manager) lockStoreDirs() error {
+	if m.Datastore.InMemory || m.Datastore.locks != nil {
+		return nil
+	}
+
+	appDir, err := m.getAppDataDir()
+	if err != nil {
+		return errcode.TODO.Wrap(err)
+	}
+
+	sharedDir, err := m.getSharedDataDir()
+	if err != nil {
+		return errcode.TODO.Wrap(err)
+	}
+
+	dirs := []string{appDir}
+	if sharedDir != appDir {
+		dirs = append(dirs, sharedDir)
+	}
+
+	locks := []*accountlock.DirLock{}
+	for _, dir := range dirs {
+		if dir == accountutils.InMemoryDir {
+			continue
+		}
+
+		lock, err := accountlock.LockDir(dir)
+		if err != nil {
+			for _, lock := range locks {
+				_ = lock.Unlock()
+			}
+			return err
+		}
+		locks = append(locks, lock)
+	}
+
+	m.Datastore.locks = locks
+	return nil
+}
+
+func (m *Manager) unlockStoreDirs() {
+	for _, lock := range m.Datastore.locks {
+		if err := lock.Unlock(); err != nil && m.initLogger != nil {
+			m.initLogger.Warn("unable to unlock the store directory", zap.Error(err))
+		}
+	}
+	m.Datastore.locks = nil
+}
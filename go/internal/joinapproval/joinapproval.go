@@ -0,0 +1,383 @@
+// Package joinapproval keeps the multi-member groups whose new members wait
+// for the approval of an admin, and their join requests.
+//
+// A group switches to the approval mode with a policy naming its admins and
+// the members already approved, every member joining afterwards is pending
+// until an admin approves or denies it. The policy and the decisions are
+// sent to the group as app messages, the clients which know them hold the
+// messages of the pending members and drop the ones of the denied members.
+// The invitation link still gives access to the group, the approval is
+// enforced by the clients of the members, not by the protocol.
+package joinapproval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// Namespace is the key prefix used in the account root datastore.
+const Namespace = "join-approval"
+
+// State is the membership state of a member of a group in approval mode.
+type State string
+
+const (
+	// StateApproved members are members of the group, all of them are when
+	// the group is not in approval mode.
+	StateApproved State = "approved"
+	// StatePending members joined and wait for the decision of an admin.
+	StatePending State = "pending"
+	// StateDenied members were refused by an admin.
+	StateDenied State = "denied"
+)
+
+// Policy is the approval mode of a group.
+type Policy struct {
+	GroupPK string `json:"group_public_key"`
+	// Admins are the public keys of the members deciding on the requests.
+	Admins []string `json:"admins"`
+	// Members are the public keys of the members approved when the policy
+	// was set, e.g. the members of the group before it switched to the
+	// approval mode.
+	Members   []string  `json:"members,omitempty"`
+	EnabledBy string    `json:"enabled_by"`
+	EnabledAt time.Time `json:"enabled_at"`
+}
+
+// IsAdmin returns true if the member decides on the requests.
+func (p *Policy) IsAdmin(memberPK string) bool {
+	return contains(p.Admins, memberPK)
+}
+
+// Request is a member who joined a group in approval mode.
+type Request struct {
+	GroupPK     string    `json:"group_public_key"`
+	MemberPK    string    `json:"member_public_key"`
+	DisplayName string    `json:"display_name,omitempty"`
+	State       State     `json:"state"`
+	RequestedAt time.Time `json:"requested_at"`
+	DecidedBy   string    `json:"decided_by,omitempty"`
+	DecidedAt   time.Time `json:"decided_at,omitempty"`
+}
+
+// Store stores the policies under `/<group public key>/policy` and the
+// requests under `/<group public key>/requests/<member public key>`.
+type Store struct {
+	ds    datastore.Datastore
+	clock clock.Clock
+}
+
+func New(ds datastore.Datastore) *Store {
+	return &Store{
+		ds:    namespace.Wrap(ds, datastore.NewKey(Namespace)),
+		clock: clock.New(),
+	}
+}
+
+// SetClock replaces the clock dating the policies and the requests, e.g.
+// with a mock in tests.
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+func policyKey(groupPK string) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{groupPK, "policy"})
+}
+
+func requestsKey(groupPK string) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{groupPK, "requests"})
+}
+
+func requestKey(groupPK, memberPK string) datastore.Key {
+	return requestsKey(groupPK).ChildString(memberPK)
+}
+
+// ApplyPolicy applies a policy message sent by the member sender. A group
+// switches to the approval mode with a policy naming its sender as an admin,
+// then only the admins can change it. The members approved by the previous
+// policy stay approved. It returns nil when the policy is disabled.
+func (s *Store) ApplyPolicy(ctx context.Context, groupPK, sender string, m *messengertypes.AppMessage_JoinPolicy) (*Policy, error) {
+	if groupPK == "" || sender == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a group and a sender are required"))
+	}
+
+	current, err := s.Policy(ctx, groupPK)
+	switch {
+	case errcode.Is(err, errcode.ErrNotFound):
+		if m.Disabled {
+			return nil, nil
+		}
+		if !contains(m.Admins, sender) {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the member setting the approval mode must be an admin"))
+		}
+		current = nil
+	case err != nil:
+		return nil, err
+	case !current.IsAdmin(sender):
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("only an admin can change the approval mode"))
+	}
+
+	if m.Disabled {
+		return nil, s.deleteGroup(ctx, groupPK)
+	}
+
+	if len(m.Admins) == 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the approval mode requires an admin"))
+	}
+
+	p := &Policy{
+		GroupPK:   groupPK,
+		Admins:    union(nil, m.Admins),
+		Members:   union(nil, m.Members),
+		EnabledBy: sender,
+		EnabledAt: s.clock.Now(),
+	}
+	if current != nil {
+		p.Members = union(current.Members, m.Members)
+		p.EnabledBy, p.EnabledAt = current.EnabledBy, current.EnabledAt
+	}
+
+	if err := s.put(ctx, policyKey(groupPK), p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Policy returns the policy of a group, it fails with ErrNotFound when the
+// group is not in approval mode.
+func (s *Store) Policy(ctx context.Context, groupPK string) (*Policy, error) {
+	p := &Policy{}
+	if err := s.get(ctx, policyKey(groupPK), p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// State returns the state of a member, the members who joined a group in
+// approval mode without a request yet are pending.
+func (s *Store) State(ctx context.Context, groupPK, memberPK string) (State, error) {
+	p, err := s.Policy(ctx, groupPK)
+	if errcode.Is(err, errcode.ErrNotFound) {
+		return StateApproved, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if p.IsAdmin(memberPK) || contains(p.Members, memberPK) {
+		return StateApproved, nil
+	}
+
+	r := &Request{}
+	err = s.get(ctx, requestKey(groupPK, memberPK), r)
+	if errcode.Is(err, errcode.ErrNotFound) {
+		return StatePending, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return r.State, nil
+}
+
+// AddRequest records the request of a member, it returns true if it is new.
+// The display name of a known request is updated. It returns nil for the
+// members approved by the policy or when the group is not in approval mode.
+func (s *Store) AddRequest(ctx context.Context, groupPK, memberPK, displayName string) (*Request, bool, error) {
+	if groupPK == "" || memberPK == "" {
+		return nil, false, errcode.ErrMissingInput.Wrap(fmt.Errorf("a group and a member are required"))
+	}
+
+	p, err := s.Policy(ctx, groupPK)
+	if errcode.Is(err, errcode.ErrNotFound) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if p.IsAdmin(memberPK) || contains(p.Members, memberPK) {
+		return nil, false, nil
+	}
+
+	r := &Request{}
+	err = s.get(ctx, requestKey(groupPK, memberPK), r)
+	switch {
+	case err == nil:
+		if displayName == "" || displayName == r.DisplayName {
+			return r, false, nil
+		}
+		r.DisplayName = displayName
+		return r, false, s.put(ctx, requestKey(groupPK, memberPK), r)
+
+	case errcode.Is(err, errcode.ErrNotFound):
+		r = &Request{
+			GroupPK:     groupPK,
+			MemberPK:    memberPK,
+			DisplayName: displayName,
+			State:       StatePending,
+			RequestedAt: s.clock.Now(),
+		}
+		return r, true, s.put(ctx, requestKey(groupPK, memberPK), r)
+
+	default:
+		return nil, false, err
+	}
+}
+
+// Decide records the decision of the admin on a member, a decision can be
+// changed later. It returns false when the member was already in that
+// state.
+func (s *Store) Decide(ctx context.Context, groupPK, memberPK, admin string, approved bool) (*Request, bool, error) {
+	if groupPK == "" || memberPK == "" {
+		return nil, false, errcode.ErrMissingInput.Wrap(fmt.Errorf("a group and a member are required"))
+	}
+
+	p, err := s.Policy(ctx, groupPK)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case !p.IsAdmin(admin):
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("only an admin can decide on a join request"))
+	case p.IsAdmin(memberPK) || contains(p.Members, memberPK):
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the member was approved by the policy"))
+	}
+
+	// the decision can be received before the request
+	r, _, err := s.AddRequest(ctx, groupPK, memberPK, "")
+	if err != nil {
+		return nil, false, err
+	}
+
+	state := StateDenied
+	if approved {
+		state = StateApproved
+	}
+	if r.State == state {
+		return r, false, nil
+	}
+
+	r.State, r.DecidedBy, r.DecidedAt = state, admin, s.clock.Now()
+	if err := s.put(ctx, requestKey(groupPK, memberPK), r); err != nil {
+		return nil, false, err
+	}
+
+	return r, true, nil
+}
+
+// Requests returns the requests of a group, the oldest first.
+func (s *Store) Requests(ctx context.Context, groupPK string) ([]*Request, error) {
+	results, err := s.ds.Query(ctx, query.Query{Prefix: requestsKey(groupPK).String()})
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	defer results.Close()
+
+	requests := []*Request{}
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, errcode.ErrDBRead.Wrap(result.Error)
+		}
+
+		r := &Request{}
+		if err := json.Unmarshal(result.Value, r); err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+		requests = append(requests, r)
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].RequestedAt.Equal(requests[j].RequestedAt) {
+			return requests[i].RequestedAt.Before(requests[j].RequestedAt)
+		}
+		return strings.Compare(requests[i].MemberPK, requests[j].MemberPK) < 0
+	})
+
+	return requests, nil
+}
+
+// deleteGroup removes the policy and the requests of a group.
+func (s *Store) deleteGroup(ctx context.Context, groupPK string) error {
+	results, err := s.ds.Query(ctx, query.Query{Prefix: datastore.NewKey(groupPK).String(), KeysOnly: true})
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	entries, err := results.Rest()
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	for _, e := range entries {
+		if err := s.ds.Delete(ctx, datastore.NewKey(e.Key)); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) get(ctx context.Context, key datastore.Key, v interface{}) error {
+	raw, err := s.ds.Get(ctx, key)
+	if err == datastore.ErrNotFound {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("no %s", key))
+	} else if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return nil
+}
+
+func (s *Store) put(ctx context.Context, key datastore.Key, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := s.ds.Put(ctx, key, raw); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// union returns the values of a and b without duplicates nor empty values,
+// sorted.
+func union(a, b []string) []string {
+	values := []string{}
+	for _, v := range append(append([]string{}, a...), b...) {
+		if v != "" && !contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+
+	return values
+}
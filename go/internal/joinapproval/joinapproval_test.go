@@ -0,0 +1,148 @@
+package joinapproval
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	s := New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	// open membership by default
+	_, err := s.Policy(ctx, "group")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+	state, err := s.State(ctx, "group", "bob")
+	require.NoError(t, err)
+	require.Equal(t, StateApproved, state)
+
+	// the sender must be an admin
+	_, err = s.ApplyPolicy(ctx, "group", "mallory", &messengertypes.AppMessage_JoinPolicy{Admins: []string{"alice"}})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	p, err := s.ApplyPolicy(ctx, "group", "alice", &messengertypes.AppMessage_JoinPolicy{Admins: []string{"alice"}, Members: []string{"carol", "carol"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice"}, p.Admins)
+	require.Equal(t, []string{"carol"}, p.Members)
+	require.Equal(t, "alice", p.EnabledBy)
+
+	for member, expected := range map[string]State{"alice": StateApproved, "carol": StateApproved, "bob": StatePending} {
+		state, err := s.State(ctx, "group", member)
+		require.NoError(t, err)
+		require.Equal(t, expected, state, member)
+	}
+
+	// only the admins change it, the approved members stay approved
+	_, err = s.ApplyPolicy(ctx, "group", "carol", &messengertypes.AppMessage_JoinPolicy{Admins: []string{"carol"}})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	p, err = s.ApplyPolicy(ctx, "group", "alice", &messengertypes.AppMessage_JoinPolicy{Admins: []string{"alice", "dave"}, Members: []string{"erin"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice", "dave"}, p.Admins)
+	require.Equal(t, []string{"carol", "erin"}, p.Members)
+
+	// the other groups are not affected
+	state, err = s.State(ctx, "group2", "bob")
+	require.NoError(t, err)
+	require.Equal(t, StateApproved, state)
+
+	_, _, err = s.AddRequest(ctx, "group", "bob", "Bob")
+	require.NoError(t, err)
+
+	p, err = s.ApplyPolicy(ctx, "group", "dave", &messengertypes.AppMessage_JoinPolicy{Disabled: true})
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	_, err = s.Policy(ctx, "group")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+	requests, err := s.Requests(ctx, "group")
+	require.NoError(t, err)
+	require.Empty(t, requests)
+}
+
+func TestRequests(t *testing.T) {
+	ctx := context.Background()
+	mock := clock.NewMock()
+	mock.Set(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+	s := New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+	s.SetClock(mock)
+
+	// not in approval mode
+	r, isNew, err := s.AddRequest(ctx, "group", "bob", "Bob")
+	require.NoError(t, err)
+	require.Nil(t, r)
+	require.False(t, isNew)
+
+	_, err = s.ApplyPolicy(ctx, "group", "alice", &messengertypes.AppMessage_JoinPolicy{Admins: []string{"alice"}, Members: []string{"carol"}})
+	require.NoError(t, err)
+	_, err = s.ApplyPolicy(ctx, "group2", "alice", &messengertypes.AppMessage_JoinPolicy{Admins: []string{"alice"}})
+	require.NoError(t, err)
+
+	r, isNew, err = s.AddRequest(ctx, "group", "bob", "")
+	require.NoError(t, err)
+	require.True(t, isNew)
+	require.Equal(t, StatePending, r.State)
+	require.Equal(t, mock.Now(), r.RequestedAt)
+
+	mock.Add(time.Minute)
+	r, isNew, err = s.AddRequest(ctx, "group", "bob", "Bob")
+	require.NoError(t, err)
+	require.False(t, isNew)
+	require.Equal(t, "Bob", r.DisplayName)
+
+	// approved by the policy
+	r, _, err = s.AddRequest(ctx, "group", "carol", "Carol")
+	require.NoError(t, err)
+	require.Nil(t, r)
+
+	_, _, err = s.Decide(ctx, "group", "bob", "carol", true)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+	_, _, err = s.Decide(ctx, "group", "carol", "alice", false)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	r, changed, err := s.Decide(ctx, "group", "bob", "alice", true)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, StateApproved, r.State)
+	require.Equal(t, "alice", r.DecidedBy)
+	require.Equal(t, mock.Now(), r.DecidedAt)
+
+	_, changed, err = s.Decide(ctx, "group", "bob", "alice", true)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// a decision received before the request
+	mock.Add(time.Minute)
+	r, changed, err = s.Decide(ctx, "group", "dave", "alice", false)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, StateDenied, r.State)
+
+	state, err := s.State(ctx, "group", "dave")
+	require.NoError(t, err)
+	require.Equal(t, StateDenied, state)
+
+	requests, err := s.Requests(ctx, "group")
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	require.Equal(t, "bob", requests[0].MemberPK)
+	require.Equal(t, StateApproved, requests[0].State)
+	require.Equal(t, "dave", requests[1].MemberPK)
+
+	requests, err = s.Requests(ctx, "group2")
+	require.NoError(t, err)
+	require.Empty(t, requests)
+
+	// no decision outside of the approval mode
+	_, _, err = s.Decide(ctx, "group3", "bob", "alice", true)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+}
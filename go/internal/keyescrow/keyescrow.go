@@ -0,0 +1,253 @@
+// Package keyescrow exports the key material of a conversation to an escrow
+// file, for the organizations required to archive a readable history of
+// their conversations.
+//
+// The export is opt-in: a conversation is enrolled with the public key of
+// the escrow, and the files are sealed to it, only the holder of the private
+// key can open them. The protocol does not expose the message keys derived
+// by the devices, an escrow file holds the secrets of the group and the
+// messages decrypted with their keys, identified by their CID, device and
+// counter.
+package keyescrow
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// Namespace is the key prefix used in the account root datastore.
+	Namespace = "key-escrow"
+
+	// Version is the version of the archives written by Seal.
+	Version = 1
+
+	// magic starts the escrow files.
+	magic = "berty-key-escrow-v1\n"
+)
+
+// Enrollment is the opt-in of a conversation.
+type Enrollment struct {
+	ConversationPK string `json:"conversation_public_key"`
+	// Recipient is the X25519 public key of the escrow, see EncodeKey.
+	Recipient string    `json:"recipient"`
+	EnabledAt time.Time `json:"enabled_at"`
+}
+
+// Store stores the enrollments under `/<conversation public key>`.
+type Store struct {
+	ds    datastore.Datastore
+	clock clock.Clock
+}
+
+func New(ds datastore.Datastore) *Store {
+	return &Store{
+		ds:    namespace.Wrap(ds, datastore.NewKey(Namespace)),
+		clock: clock.New(),
+	}
+}
+
+// SetClock replaces the clock dating the enrollments, e.g. with a mock in
+// tests.
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Enable enrolls a conversation, the escrow files are then sealed to
+// recipient. It replaces the recipient of an enrolled conversation.
+func (s *Store) Enable(ctx context.Context, conversationPK string, recipient *[32]byte) (*Enrollment, error) {
+	if conversationPK == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation is required"))
+	}
+
+	if recipient == nil {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("an escrow public key is required"))
+	}
+
+	enrollment := &Enrollment{ConversationPK: conversationPK, Recipient: EncodeKey(recipient), EnabledAt: s.clock.Now()}
+	raw, err := json.Marshal(enrollment)
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := s.ds.Put(ctx, datastore.NewKey(conversationPK), raw); err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return enrollment, nil
+}
+
+// Get returns the enrollment of a conversation, it fails with ErrNotFound
+// when the conversation did not opt in.
+func (s *Store) Get(ctx context.Context, conversationPK string) (*Enrollment, error) {
+	if conversationPK == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation is required"))
+	}
+
+	raw, err := s.ds.Get(ctx, datastore.NewKey(conversationPK))
+	if err == datastore.ErrNotFound {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("the key escrow is not enabled for conversation %q", conversationPK))
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	enrollment := &Enrollment{}
+	if err := json.Unmarshal(raw, enrollment); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return enrollment, nil
+}
+
+// Disable withdraws a conversation, the files already exported stay
+// readable by the escrow.
+func (s *Store) Disable(ctx context.Context, conversationPK string) error {
+	if _, err := s.Get(ctx, conversationPK); err != nil {
+		return err
+	}
+
+	if err := s.ds.Delete(ctx, datastore.NewKey(conversationPK)); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// Group is the key material of the group of a conversation.
+type Group struct {
+	PublicKey  []byte `json:"public_key"`
+	Type       string `json:"type"`
+	Secret     []byte `json:"secret"`
+	SecretSig  []byte `json:"secret_sig,omitempty"`
+	SignPub    []byte `json:"sign_pub,omitempty"`
+	LinkKey    []byte `json:"link_key,omitempty"`
+	LinkKeySig []byte `json:"link_key_sig,omitempty"`
+}
+
+// Message is a message of the group, decrypted.
+type Message struct {
+	CID      string `json:"cid"`
+	DevicePK []byte `json:"device_pk"`
+	Counter  uint64 `json:"counter"`
+	// Payload is the app message, see messengertypes.AppMessage.
+	Payload []byte `json:"payload"`
+}
+
+// Archive is the content of an escrow file.
+type Archive struct {
+	Version        int       `json:"version"`
+	ConversationPK string    `json:"conversation_public_key"`
+	ExportedAt     time.Time `json:"exported_at"`
+	Group          Group     `json:"group"`
+	Messages       []Message `json:"messages"`
+}
+
+// GenerateRecipient returns a new key pair for an escrow.
+func GenerateRecipient() (publicKey, privateKey *[32]byte, err error) {
+	publicKey, privateKey, err = box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, errcode.ErrCryptoKeyGeneration.Wrap(err)
+	}
+
+	return publicKey, privateKey, nil
+}
+
+// PublicKey returns the public key of the private key of an escrow.
+func PublicKey(privateKey *[32]byte) *[32]byte {
+	publicKey := &[32]byte{}
+	curve25519.ScalarBaseMult(publicKey, privateKey)
+
+	return publicKey
+}
+
+// EncodeKey returns the text form of a key.
+func EncodeKey(key *[32]byte) string {
+	return base64.RawURLEncoding.EncodeToString(key[:])
+}
+
+// ParseKey parses the text form of a key.
+func ParseKey(s string) (*[32]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(raw) != 32 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid escrow key, expected 32 bytes in base64url"))
+	}
+
+	key := &[32]byte{}
+	copy(key[:], raw)
+
+	return key, nil
+}
+
+// Fingerprint identifies a public key in the audit log.
+func Fingerprint(key *[32]byte) string {
+	sum := sha256.Sum256(key[:])
+	return hex.EncodeToString(sum[:8])
+}
+
+// Seal writes the archive encrypted for the escrow to w.
+func Seal(w io.Writer, a *Archive, recipient *[32]byte) error {
+	raw, err := json.Marshal(a)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	sealed, err := box.SealAnonymous(nil, raw, recipient, rand.Reader)
+	if err != nil {
+		return errcode.ErrCryptoEncrypt.Wrap(err)
+	}
+
+	if _, err := io.WriteString(w, magic); err != nil {
+		return errcode.ErrStreamWrite.Wrap(err)
+	}
+	if _, err := w.Write(sealed); err != nil {
+		return errcode.ErrStreamWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// Open reads an escrow file with the key pair of the escrow.
+func Open(r io.Reader, publicKey, privateKey *[32]byte) (*Archive, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil || header != magic {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("not an escrow file"))
+	}
+
+	sealed, err := io.ReadAll(br)
+	if err != nil {
+		return nil, errcode.ErrStreamRead.Wrap(err)
+	}
+
+	raw, ok := box.OpenAnonymous(nil, sealed, publicKey, privateKey)
+	if !ok {
+		return nil, errcode.ErrCryptoDecrypt.Wrap(fmt.Errorf("the escrow file was not sealed to this key"))
+	}
+
+	a := &Archive{}
+	if err := json.Unmarshal(raw, a); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if a.Version > Version {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("escrow file version %d is not supported", a.Version))
+	}
+
+	return a, nil
+}
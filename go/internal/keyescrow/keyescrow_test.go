@@ -0,0 +1,103 @@
+package keyescrow
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestEnableGetDisable(t *testing.T) {
+	ctx := context.Background()
+	ds := ds_sync.MutexWrap(datastore.NewMapDatastore())
+	mock := clock.NewMock()
+	mock.Set(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+	s := New(ds)
+	s.SetClock(mock)
+
+	_, err := s.Get(ctx, "conv")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	pub, _, err := GenerateRecipient()
+	require.NoError(t, err)
+
+	_, err = s.Enable(ctx, "conv", pub)
+	require.NoError(t, err)
+
+	// shared by the stores of the datastore
+	enrollment, err := New(ds).Get(ctx, "conv")
+	require.NoError(t, err)
+	require.Equal(t, "conv", enrollment.ConversationPK)
+	require.Equal(t, EncodeKey(pub), enrollment.Recipient)
+	require.True(t, mock.Now().Equal(enrollment.EnabledAt))
+
+	require.NoError(t, s.Disable(ctx, "conv"))
+	_, err = s.Get(ctx, "conv")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+	require.True(t, errcode.Is(s.Disable(ctx, "conv"), errcode.ErrNotFound))
+
+	_, err = s.Enable(ctx, "", pub)
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+	_, err = s.Enable(ctx, "conv", nil)
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+}
+
+func TestKeys(t *testing.T) {
+	pub, priv, err := GenerateRecipient()
+	require.NoError(t, err)
+	require.NotEqual(t, pub, priv)
+	require.Equal(t, pub, PublicKey(priv))
+
+	parsed, err := ParseKey(EncodeKey(pub))
+	require.NoError(t, err)
+	require.Equal(t, pub, parsed)
+
+	require.Len(t, Fingerprint(pub), 16)
+	require.Equal(t, Fingerprint(pub), Fingerprint(parsed))
+
+	for _, invalid := range []string{"", "not base64!", EncodeKey(pub)[:20]} {
+		_, err := ParseKey(invalid)
+		require.True(t, errcode.Is(err, errcode.ErrInvalidInput), invalid)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	pub, priv, err := GenerateRecipient()
+	require.NoError(t, err)
+
+	archive := &Archive{
+		Version:        Version,
+		ConversationPK: "conv",
+		ExportedAt:     time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Group:          Group{PublicKey: []byte("gpk"), Type: "GroupTypeContact", Secret: []byte("secret")},
+		Messages: []Message{
+			{CID: "cid1", DevicePK: []byte("device"), Counter: 1, Payload: []byte("hello")},
+			{CID: "cid2", DevicePK: []byte("device"), Counter: 2, Payload: []byte("world")},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, Seal(buf, archive, pub))
+	require.NotContains(t, buf.String(), "secret")
+	require.NotContains(t, buf.String(), "hello")
+
+	opened, err := Open(bytes.NewReader(buf.Bytes()), pub, priv)
+	require.NoError(t, err)
+	require.Equal(t, archive, opened)
+
+	// sealed to another escrow
+	otherPub, otherPriv, err := GenerateRecipient()
+	require.NoError(t, err)
+	_, err = Open(bytes.NewReader(buf.Bytes()), otherPub, otherPriv)
+	require.True(t, errcode.Is(err, errcode.ErrCryptoDecrypt))
+
+	_, err = Open(bytes.NewReader([]byte("not an escrow file")), pub, priv)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
@@ -0,0 +1,240 @@
+package matrixbridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// The message types relayed to Berty, the media ones are relayed as a text
+// message naming the file, with the file as attachment.
+const (
+	msgTypeText   = "m.text"
+	msgTypeNotice = "m.notice"
+	msgTypeEmote  = "m.emote"
+	msgTypeImage  = "m.image"
+	msgTypeFile   = "m.file"
+	msgTypeVideo  = "m.video"
+	msgTypeAudio  = "m.audio"
+
+	eventTypeMessage = "m.room.message"
+)
+
+// transactionPrefixes are the paths of the transactions pushed by the
+// homeserver, the second one is the legacy path.
+var transactionPrefixes = []string{"/_matrix/app/v1/transactions/", "/transactions/"}
+
+type event struct {
+	Type    string          `json:"type"`
+	EventID string          `json:"event_id"`
+	RoomID  string          `json:"room_id"`
+	Sender  string          `json:"sender"`
+	Content json.RawMessage `json:"content"`
+}
+
+type messageContent struct {
+	MsgType string     `json:"msgtype"`
+	Body    string     `json:"body"`
+	URL     string     `json:"url,omitempty"`
+	Info    *mediaInfo `json:"info,omitempty"`
+}
+
+type mediaInfo struct {
+	MimeType string `json:"mimetype,omitempty"`
+	Size     int    `json:"size,omitempty"`
+}
+
+// ServeHTTP handles the requests of the homeserver to the application
+// service, only the transactions are used, the queries for the users and
+// the rooms always reply that they do not exist.
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("access_token")
+	}
+
+	switch {
+	case token == "":
+		writeError(w, http.StatusUnauthorized, "M_UNAUTHORIZED", "missing token")
+		return
+	case token != b.config.HSToken:
+		writeError(w, http.StatusForbidden, "M_FORBIDDEN", "invalid token")
+		return
+	}
+
+	for _, prefix := range transactionPrefixes {
+		if txnID := strings.TrimPrefix(r.URL.Path, prefix); txnID != r.URL.Path && txnID != "" {
+			if r.Method != http.MethodPut {
+				writeError(w, http.StatusMethodNotAllowed, "M_UNRECOGNIZED", "expected PUT")
+				return
+			}
+
+			b.handleTransaction(w, r, txnID)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "M_NOT_FOUND", "not found")
+}
+
+func (b *Bridge) handleTransaction(w http.ResponseWriter, r *http.Request, txnID string) {
+	var txn struct {
+		Events []*event `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&txn); err != nil {
+		writeError(w, http.StatusBadRequest, "M_NOT_JSON", err.Error())
+		return
+	}
+
+	b.mu.Lock()
+	handled := b.transactions.has(txnID)
+	b.mu.Unlock()
+
+	// the homeserver retries until it gets a reply, the events of a
+	// transaction failing to be relayed are dropped
+	if !handled {
+		for _, evt := range txn.Events {
+			if err := b.handleEvent(r.Context(), evt); err != nil {
+				b.logger.Error("unable to relay a Matrix event", zap.String("event", evt.EventID), zap.String("room", evt.RoomID), zap.Error(err))
+			}
+		}
+
+		b.mu.Lock()
+		b.transactions.add(txnID)
+		b.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte("{}"))
+}
+
+// handleEvent relays a message of a linked room to its group.
+func (b *Bridge) handleEvent(ctx context.Context, evt *event) error {
+	if evt.Type != eventTypeMessage || b.isVirtualUser(evt.Sender) {
+		return nil
+	}
+
+	b.mu.Lock()
+	groupPK, ok := b.rooms[evt.RoomID]
+	b.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var content messageContent
+	if err := json.Unmarshal(evt.Content, &content); err != nil {
+		return fmt.Errorf("invalid content: %w", err)
+	}
+
+	name := b.matrixName(ctx, evt.Sender)
+
+	var (
+		body       string
+		attachment []byte
+	)
+	switch content.MsgType {
+	case msgTypeText, msgTypeNotice:
+		body = fmt.Sprintf("%s: %s", name, content.Body)
+	case msgTypeEmote:
+		body = fmt.Sprintf("* %s %s", name, content.Body)
+	case msgTypeImage, msgTypeFile, msgTypeVideo, msgTypeAudio:
+		if b.attachments == nil || content.URL == "" {
+			body = fmt.Sprintf("%s sent %s: %s", name, content.Body, content.URL)
+			break
+		}
+
+		data, err := b.matrix.download(ctx, content.URL)
+		if err != nil {
+			return err
+		}
+		body = fmt.Sprintf("%s sent %s", name, content.Body)
+		attachment = data
+	default:
+		return nil
+	}
+
+	cid, err := b.sendToBerty(ctx, groupPK, body)
+	if err != nil {
+		return err
+	}
+
+	if attachment != nil {
+		if _, err := b.attachments.Put(ctx, cid, attachment); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendToBerty sends a message relayed from Matrix, it is marked as relayed
+// so it does not come back.
+func (b *Bridge) sendToBerty(ctx context.Context, groupPK, body string) (string, error) {
+	key := sendingKey(groupPK, body)
+
+	b.mu.Lock()
+	b.sending[key]++
+	b.mu.Unlock()
+
+	cid, err := b.messenger.SendMessage(ctx, groupPK, body)
+
+	b.mu.Lock()
+	if b.sending[key]--; b.sending[key] == 0 {
+		delete(b.sending, key)
+	}
+	if err == nil {
+		b.relayed.add(cid)
+	}
+	b.mu.Unlock()
+
+	return cid, err
+}
+
+// matrixName returns the display name of a Matrix user, its ID when it has
+// none.
+func (b *Bridge) matrixName(ctx context.Context, userID string) string {
+	b.mu.Lock()
+	name, ok := b.names[userID]
+	b.mu.Unlock()
+	if ok {
+		return name
+	}
+
+	name, err := b.matrix.displayName(ctx, userID)
+	if err != nil {
+		b.logger.Debug("unable to get the display name of a Matrix user", zap.String("user", userID), zap.Error(err))
+		return userID
+	}
+	if name == "" {
+		name = userID
+	}
+
+	b.mu.Lock()
+	b.names[userID] = name
+	b.mu.Unlock()
+
+	return name
+}
+
+func mediaMsgType(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return msgTypeImage
+	case strings.HasPrefix(mimeType, "video/"):
+		return msgTypeVideo
+	case strings.HasPrefix(mimeType, "audio/"):
+		return msgTypeAudio
+	default:
+		return msgTypeFile
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&matrixError{ErrCode: code, Message: message})
+}
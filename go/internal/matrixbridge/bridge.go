@@ -0,0 +1,442 @@
+// Package matrixbridge relays the messages between Berty groups and Matrix
+// rooms. It is a Matrix application service: the homeserver pushes the
+// events of the rooms to its HTTP handler, authenticated with the hs token,
+// and the Berty messages are sent to the rooms by virtual users, one per
+// member, with the as token. The virtual users are the ones of the Matrix
+// exports, see matrixexport.UserID, so both can be used together.
+//
+// Each group is linked to a room with Link, usually through the RPC
+// service, the links are saved in the account datastore.
+package matrixbridge
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/attachmentstore"
+	"berty.tech/berty/v2/go/internal/matrixexport"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// recentSize is the number of interactions and transactions remembered to
+// relay each of them once.
+const recentSize = 4096
+
+// Config is the registration of the application service on the homeserver.
+type Config struct {
+	// HomeserverURL is the base URL of the client-server API.
+	HomeserverURL string
+	// ServerName is the domain of the Matrix users.
+	ServerName string
+	// ASToken authenticates the bridge to the homeserver.
+	ASToken string
+	// HSToken authenticates the homeserver to the bridge.
+	HSToken string
+}
+
+// Opts are the optional dependencies of the bridge.
+type Opts struct {
+	// Datastore saves the links, they are lost on restart without it.
+	Datastore datastore.Datastore
+	// Attachments relays the attachments of the messages, the Matrix media
+	// are only referenced by their URI without it.
+	Attachments *attachmentstore.Store
+	Logger      *zap.Logger
+	HTTPClient  *http.Client
+}
+
+// Messenger sends the messages relayed from Matrix to the Berty groups.
+type Messenger interface {
+	// SendMessage sends a text message to the group groupPK, it returns the
+	// cid of the interaction.
+	SendMessage(ctx context.Context, groupPK, body string) (string, error)
+}
+
+// Message is a Berty message to relay to Matrix.
+type Message struct {
+	GroupPK string
+	CID     string
+	// SenderPK is the public key of the member, or of its device when the
+	// member is unknown.
+	SenderPK   string
+	SenderName string
+	// IsMine is set for the messages sent by the account of the bridge.
+	IsMine bool
+	SentAt time.Time
+	Body   string
+}
+
+// Link is a group relayed to a room.
+type Link struct {
+	GroupPK string `json:"group_pk"`
+	RoomID  string `json:"room_id"`
+	// LinkedAt is when the link was made, the older messages of the group
+	// are not relayed.
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// Bridge relays the messages of the linked groups and rooms.
+type Bridge struct {
+	config      Config
+	messenger   Messenger
+	matrix      *client
+	ds          datastore.Datastore
+	attachments *attachmentstore.Store
+	logger      *zap.Logger
+
+	mu    sync.Mutex
+	links map[string]*Link
+	// rooms maps the rooms to the groups linked to them.
+	rooms map[string]string
+	// relayed are the interactions already relayed to Matrix or coming from
+	// it.
+	relayed *recentSet
+	// transactions are the transactions of the homeserver already handled.
+	transactions *recentSet
+	// sending counts the messages being sent to a group, by group and body,
+	// to recognize them before their cid is known.
+	sending map[string]int
+	// users are the virtual users registered, with their display name.
+	users  map[string]string
+	joined map[string]bool
+	// names caches the display names of the Matrix users.
+	names map[string]string
+}
+
+// New returns a bridge relaying to the homeserver of config, the saved links
+// are loaded from opts.Datastore.
+func New(ctx context.Context, config Config, messenger Messenger, opts Opts) (*Bridge, error) {
+	switch {
+	case config.HomeserverURL == "":
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("missing homeserver URL"))
+	case config.ServerName == "":
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("missing server name"))
+	case config.ASToken == "" || config.HSToken == "":
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("missing application service tokens"))
+	case messenger == nil:
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("missing messenger"))
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: time.Minute}
+	}
+
+	b := &Bridge{
+		config:    config,
+		messenger: messenger,
+		matrix: &client{
+			baseURL: strings.TrimSuffix(config.HomeserverURL, "/"),
+			asToken: config.ASToken,
+			http:    opts.HTTPClient,
+		},
+		ds:           opts.Datastore,
+		attachments:  opts.Attachments,
+		logger:       opts.Logger,
+		links:        map[string]*Link{},
+		rooms:        map[string]string{},
+		relayed:      newRecentSet(recentSize),
+		transactions: newRecentSet(recentSize),
+		sending:      map[string]int{},
+		users:        map[string]string{},
+		joined:       map[string]bool{},
+		names:        map[string]string{},
+	}
+
+	if b.ds != nil {
+		links, err := loadLinks(ctx, b.ds)
+		if err != nil {
+			return nil, err
+		}
+		for i := range links {
+			b.addLink(&links[i])
+		}
+	}
+
+	return b, nil
+}
+
+// Link relays the group groupPK to the room roomID from now on, replacing
+// the previous room of the group. The virtual users must be allowed to join
+// the room, they join it when relaying their first message.
+func (b *Bridge) Link(ctx context.Context, groupPK, roomID string) (*Link, error) {
+	if raw, err := base64.RawURLEncoding.DecodeString(groupPK); err != nil || len(raw) == 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid group public key %q", groupPK))
+	}
+	if !strings.HasPrefix(roomID, "!") || !strings.Contains(roomID, ":") {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid room ID %q, expected !opaque:server", roomID))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if other, ok := b.rooms[roomID]; ok && other != groupPK {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("room %s is already linked to the group %s", roomID, other))
+	}
+
+	previous := b.links[groupPK]
+	link := &Link{GroupPK: groupPK, RoomID: roomID, LinkedAt: time.Now().UTC()}
+	b.removeLink(groupPK)
+	b.addLink(link)
+
+	if err := b.saveLinks(ctx); err != nil {
+		b.removeLink(groupPK)
+		if previous != nil {
+			b.addLink(previous)
+		}
+		return nil, err
+	}
+
+	copied := *link
+	return &copied, nil
+}
+
+// Unlink stops relaying the group groupPK.
+func (b *Bridge) Unlink(ctx context.Context, groupPK string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	link, ok := b.links[groupPK]
+	if !ok {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("the group %s is not linked", groupPK))
+	}
+
+	b.removeLink(groupPK)
+	if err := b.saveLinks(ctx); err != nil {
+		b.addLink(link)
+		return err
+	}
+
+	return nil
+}
+
+// Links returns the linked groups, sorted by public key.
+func (b *Bridge) Links() []Link {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.sortedLinks()
+}
+
+// HandleMessage relays a message of a Berty group to its room, the messages
+// of the groups not linked, sent before the link, relayed from Matrix or
+// already relayed are ignored.
+func (b *Bridge) HandleMessage(ctx context.Context, m *Message) error {
+	b.mu.Lock()
+	link, ok := b.links[m.GroupPK]
+	skip := !ok || m.SentAt.Before(link.LinkedAt) || b.relayed.has(m.CID)
+	if !skip && m.IsMine && b.sending[sendingKey(m.GroupPK, m.Body)] > 0 {
+		// sent by the bridge, its cid is not known yet
+		b.relayed.add(m.CID)
+		skip = true
+	}
+	if !skip {
+		b.relayed.add(m.CID)
+	}
+	b.mu.Unlock()
+
+	if skip {
+		return nil
+	}
+
+	if err := b.relayToMatrix(ctx, link.RoomID, m); err != nil {
+		// relayed again on the next update of the interaction
+		b.mu.Lock()
+		b.relayed.remove(m.CID)
+		b.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bridge) relayToMatrix(ctx context.Context, roomID string, m *Message) error {
+	userID, err := b.ensureUser(ctx, m.SenderPK, m.SenderName, roomID)
+	if err != nil {
+		return err
+	}
+
+	if m.Body != "" {
+		content := &messageContent{MsgType: msgTypeText, Body: m.Body}
+		if err := b.matrix.send(ctx, roomID, userID, "berty-"+m.CID, content); err != nil {
+			return err
+		}
+	}
+
+	if b.attachments == nil {
+		return nil
+	}
+
+	cids, err := b.attachments.List(ctx, m.CID)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range cids {
+		data, err := b.attachments.Get(ctx, c)
+		if err != nil {
+			return err
+		}
+
+		mimeType := http.DetectContentType(data)
+		uri, err := b.matrix.upload(ctx, userID, c.String(), mimeType, data)
+		if err != nil {
+			return err
+		}
+
+		content := &messageContent{
+			MsgType: mediaMsgType(mimeType),
+			Body:    c.String(),
+			URL:     uri,
+			Info:    &mediaInfo{MimeType: mimeType, Size: len(data)},
+		}
+		if err := b.matrix.send(ctx, roomID, userID, fmt.Sprintf("berty-%s-%d", m.CID, i), content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureUser registers the virtual user of the sender publicKey, updates its
+// display name and joins it to the room.
+func (b *Bridge) ensureUser(ctx context.Context, publicKey, name, roomID string) (string, error) {
+	userID, err := matrixexport.UserID(publicKey, b.config.ServerName)
+	if err != nil {
+		return "", err
+	}
+
+	b.mu.Lock()
+	currentName, registered := b.users[userID]
+	joined := b.joined[roomID+" "+userID]
+	b.mu.Unlock()
+
+	if !registered {
+		if err := b.matrix.register(ctx, localpart(userID)); err != nil {
+			return "", err
+		}
+	}
+
+	if name != "" && name != currentName {
+		if err := b.matrix.setDisplayName(ctx, userID, name); err != nil {
+			return "", err
+		}
+		currentName = name
+	}
+
+	b.mu.Lock()
+	b.users[userID] = currentName
+	b.mu.Unlock()
+
+	if !joined {
+		if err := b.matrix.join(ctx, roomID, userID); err != nil {
+			return "", err
+		}
+
+		b.mu.Lock()
+		b.joined[roomID+" "+userID] = true
+		b.mu.Unlock()
+	}
+
+	return userID, nil
+}
+
+// isVirtualUser returns true for the users of the bridge, their events are
+// not relayed back to Berty.
+func (b *Bridge) isVirtualUser(userID string) bool {
+	return strings.HasPrefix(userID, "@"+matrixexport.UserPrefix) && strings.HasSuffix(userID, ":"+b.config.ServerName)
+}
+
+// addLink and removeLink require b.mu.
+func (b *Bridge) addLink(link *Link) {
+	b.links[link.GroupPK] = link
+	b.rooms[link.RoomID] = link.GroupPK
+}
+
+func (b *Bridge) removeLink(groupPK string) {
+	if link, ok := b.links[groupPK]; ok {
+		delete(b.rooms, link.RoomID)
+		delete(b.links, groupPK)
+	}
+}
+
+// saveLinks requires b.mu.
+func (b *Bridge) saveLinks(ctx context.Context) error {
+	if b.ds == nil {
+		return nil
+	}
+	return saveLinks(ctx, b.ds, b.sortedLinks())
+}
+
+func (b *Bridge) sortedLinks() []Link {
+	links := make([]Link, 0, len(b.links))
+	for _, link := range b.links {
+		links = append(links, *link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].GroupPK < links[j].GroupPK })
+	return links
+}
+
+func sendingKey(groupPK, body string) string {
+	return groupPK + " " + body
+}
+
+func localpart(userID string) string {
+	localpart, _, _ := strings.Cut(strings.TrimPrefix(userID, "@"), ":")
+	return localpart
+}
+
+// recentSet remembers the last keys added to it.
+type recentSet struct {
+	keys  map[string]struct{}
+	order []string
+	size  int
+}
+
+func newRecentSet(size int) *recentSet {
+	return &recentSet{keys: map[string]struct{}{}, size: size}
+}
+
+func (s *recentSet) has(key string) bool {
+	_, ok := s.keys[key]
+	return ok
+}
+
+func (s *recentSet) add(key string) {
+	if s.has(key) {
+		return
+	}
+
+	if len(s.order) == s.size {
+		delete(s.keys, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	s.keys[key] = struct{}{}
+	s.order = append(s.order, key)
+}
+
+func (s *recentSet) remove(key string) {
+	if !s.has(key) {
+		return
+	}
+
+	delete(s.keys, key)
+	for i, k := range s.order {
+		if k == key {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
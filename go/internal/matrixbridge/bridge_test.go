@@ -0,0 +1,292 @@
+package matrixbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"berty.tech/berty/v2/go/internal/attachmentstore"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const testRoom = "!room:example.org"
+
+var (
+	testGroupPK  = base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	testMemberPK = base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+)
+
+type homeserverRequest struct {
+	Method string
+	Path   string
+	UserID string
+	Body   map[string]interface{}
+}
+
+// fakeHomeserver records the requests of the bridge.
+type fakeHomeserver struct {
+	mu       sync.Mutex
+	requests []homeserverRequest
+	media    []byte
+}
+
+func (h *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := homeserverRequest{Method: r.Method, Path: r.URL.Path, UserID: r.URL.Query().Get("user_id")}
+	if r.Header.Get("Content-Type") == "application/json" {
+		_ = json.NewDecoder(r.Body).Decode(&req.Body)
+	} else if r.Body != nil {
+		data, _ := io.ReadAll(r.Body)
+		req.Body = map[string]interface{}{"size": len(data)}
+	}
+
+	h.mu.Lock()
+	h.requests = append(h.requests, req)
+	h.mu.Unlock()
+
+	switch {
+	case r.Header.Get("Authorization") != "Bearer as-token":
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errcode":"M_FORBIDDEN"}`))
+	case strings.HasSuffix(r.URL.Path, "/displayname") && r.Method == http.MethodGet:
+		_, _ = w.Write([]byte(`{"displayname":"Alice"}`))
+	case strings.HasPrefix(r.URL.Path, "/_matrix/media/v3/upload"):
+		_, _ = w.Write([]byte(`{"content_uri":"mxc://example.org/uploaded"}`))
+	case strings.HasPrefix(r.URL.Path, "/_matrix/client/v1/media/download/"):
+		_, _ = w.Write(h.media)
+	default:
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+func (h *fakeHomeserver) sent() []homeserverRequest {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sent := []homeserverRequest(nil)
+	for _, req := range h.requests {
+		if strings.Contains(req.Path, "/send/") {
+			sent = append(sent, req)
+		}
+	}
+	return sent
+}
+
+// fakeMessenger records the messages sent to Berty.
+type fakeMessenger struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (m *fakeMessenger) SendMessage(_ context.Context, groupPK, body string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, body)
+	return fmt.Sprintf("cid-%d", len(m.sent)), nil
+}
+
+func newTestBridge(t *testing.T, opts Opts) (*Bridge, *fakeHomeserver, *fakeMessenger) {
+	t.Helper()
+
+	hs := &fakeHomeserver{}
+	server := httptest.NewServer(hs)
+	t.Cleanup(server.Close)
+
+	messenger := &fakeMessenger{}
+	config := Config{HomeserverURL: server.URL, ServerName: "example.org", ASToken: "as-token", HSToken: "hs-token"}
+	b, err := New(context.Background(), config, messenger, opts)
+	require.NoError(t, err)
+
+	return b, hs, messenger
+}
+
+func pushTransaction(t *testing.T, b *Bridge, txnID string, events ...map[string]interface{}) {
+	t.Helper()
+
+	raw, err := json.Marshal(map[string]interface{}{"events": events})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPut, "/_matrix/app/v1/transactions/"+txnID, bytes.NewReader(raw))
+	req.Header.Set("Authorization", "Bearer hs-token")
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func matrixMessage(sender, msgType, body string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "m.room.message",
+		"event_id": "$" + body,
+		"room_id":  testRoom,
+		"sender":   sender,
+		"content":  map[string]interface{}{"msgtype": msgType, "body": body},
+	}
+}
+
+func TestBridgeRelay(t *testing.T) {
+	ctx := context.Background()
+	b, hs, messenger := newTestBridge(t, Opts{})
+
+	_, err := b.Link(ctx, testGroupPK, testRoom)
+	require.NoError(t, err)
+
+	// Berty to Matrix, by the virtual user of the member
+	msg := &Message{GroupPK: testGroupPK, CID: "bafy1", SenderPK: testMemberPK, SenderName: "Bob", SentAt: time.Now(), Body: "hello"}
+	require.NoError(t, b.HandleMessage(ctx, msg))
+	// updates of the same interaction are not relayed again
+	require.NoError(t, b.HandleMessage(ctx, msg))
+	// neither are the messages sent before the link
+	require.NoError(t, b.HandleMessage(ctx, &Message{GroupPK: testGroupPK, CID: "bafy0", SenderPK: testMemberPK, SentAt: time.Now().Add(-time.Hour), Body: "old"}))
+
+	sent := hs.sent()
+	require.Len(t, sent, 1)
+	require.Equal(t, "/_matrix/client/v3/rooms/"+testRoom+"/send/m.room.message/berty-bafy1", sent[0].Path)
+	require.Equal(t, "hello", sent[0].Body["body"])
+	userID := sent[0].UserID
+	require.True(t, strings.HasPrefix(userID, "@berty_0202"))
+	require.True(t, b.isVirtualUser(userID))
+
+	paths := []string{}
+	for _, req := range hs.requests {
+		paths = append(paths, req.Method+" "+req.Path)
+	}
+	require.Contains(t, paths, "POST /_matrix/client/v3/register")
+	require.Contains(t, paths, "PUT /_matrix/client/v3/profile/"+userID+"/displayname")
+	require.Contains(t, paths, "POST /_matrix/client/v3/rooms/"+testRoom+"/join")
+
+	// Matrix to Berty, prefixed with the display name of the sender, the
+	// messages of the virtual users are not relayed back
+	pushTransaction(t, b, "txn1",
+		matrixMessage("@alice:example.org", "m.text", "hi"),
+		matrixMessage(userID, "m.text", "echo"),
+	)
+	// a retried transaction is ignored
+	pushTransaction(t, b, "txn1", matrixMessage("@alice:example.org", "m.text", "hi"))
+	require.Equal(t, []string{"Alice: hi"}, messenger.sent)
+
+	// the message relayed from Matrix is not sent back to it
+	require.NoError(t, b.HandleMessage(ctx, &Message{GroupPK: testGroupPK, CID: "cid-1", IsMine: true, SentAt: time.Now(), Body: "Alice: hi"}))
+	require.Len(t, hs.sent(), 1)
+
+	// nothing is relayed once unlinked
+	require.NoError(t, b.Unlink(ctx, testGroupPK))
+	pushTransaction(t, b, "txn2", matrixMessage("@alice:example.org", "m.text", "still there?"))
+	require.Len(t, messenger.sent, 1)
+	require.True(t, errcode.Is(b.Unlink(ctx, testGroupPK), errcode.ErrNotFound))
+}
+
+func TestBridgeAttachments(t *testing.T) {
+	ctx := context.Background()
+	attachments := attachmentstore.New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+	b, hs, messenger := newTestBridge(t, Opts{Attachments: attachments})
+
+	_, err := b.Link(ctx, testGroupPK, testRoom)
+	require.NoError(t, err)
+
+	// the attachments of a Berty message are uploaded
+	picture := []byte("\x89PNG\r\n\x1a\n a picture")
+	_, err = attachments.Put(ctx, "bafy1", picture)
+	require.NoError(t, err)
+	require.NoError(t, b.HandleMessage(ctx, &Message{GroupPK: testGroupPK, CID: "bafy1", SenderPK: testMemberPK, SentAt: time.Now()}))
+
+	sent := hs.sent()
+	require.Len(t, sent, 1)
+	require.Equal(t, "m.image", sent[0].Body["msgtype"])
+	require.Equal(t, "mxc://example.org/uploaded", sent[0].Body["url"])
+
+	// the Matrix media are stored as attachments of the relayed message
+	hs.media = []byte("a report")
+	event := matrixMessage("@alice:example.org", "m.file", "report.txt")
+	event["content"].(map[string]interface{})["url"] = "mxc://example.org/report"
+	pushTransaction(t, b, "txn1", event)
+	require.Equal(t, []string{"Alice sent report.txt"}, messenger.sent)
+
+	cids, err := attachments.List(ctx, "cid-1")
+	require.NoError(t, err)
+	require.Len(t, cids, 1)
+	data, err := attachments.Get(ctx, cids[0])
+	require.NoError(t, err)
+	require.Equal(t, hs.media, data)
+}
+
+func TestBridgeAuthentication(t *testing.T) {
+	b, _, _ := newTestBridge(t, Opts{})
+
+	for token, expected := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusForbidden, "hs-token": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPut, "/_matrix/app/v1/transactions/1?access_token="+token, strings.NewReader(`{"events":[]}`))
+		rec := httptest.NewRecorder()
+		b.ServeHTTP(rec, req)
+		require.Equal(t, expected, rec.Code, "token %q", token)
+	}
+}
+
+func TestBridgeLinksSaved(t *testing.T) {
+	ctx := context.Background()
+	ds := ds_sync.MutexWrap(datastore.NewMapDatastore())
+	b, _, _ := newTestBridge(t, Opts{Datastore: ds})
+
+	_, err := b.Link(ctx, testGroupPK, testRoom)
+	require.NoError(t, err)
+
+	// a room is linked to a single group
+	_, err = b.Link(ctx, testMemberPK, testRoom)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+	_, err = b.Link(ctx, testMemberPK, "#alias:example.org")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	restarted, err := New(ctx, b.config, &fakeMessenger{}, Opts{Datastore: ds})
+	require.NoError(t, err)
+	require.Equal(t, b.Links(), restarted.Links())
+	require.Len(t, restarted.Links(), 1)
+}
+
+func TestBridgeRPC(t *testing.T) {
+	ctx := context.Background()
+	b, _, _ := newTestBridge(t, Opts{})
+
+	l := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	Register(server, b)
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.Dial("buf",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	link, err := LinkRoom(ctx, cc, testGroupPK, testRoom)
+	require.NoError(t, err)
+	require.Equal(t, testRoom, link.RoomID)
+
+	links, err := ListLinks(ctx, cc)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	require.Equal(t, testGroupPK, links[0].GroupPK)
+
+	require.NoError(t, UnlinkRoom(ctx, cc, testGroupPK))
+	require.Error(t, UnlinkRoom(ctx, cc, testGroupPK))
+
+	links, err = ListLinks(ctx, cc)
+	require.NoError(t, err)
+	require.Empty(t, links)
+}
@@ -0,0 +1,196 @@
+package matrixbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// maxMediaSize bounds the media downloaded from the homeserver.
+const maxMediaSize = 32 << 20
+
+// matrixError is an error reply of the homeserver.
+type matrixError struct {
+	Status  int    `json:"-"`
+	ErrCode string `json:"errcode"`
+	Message string `json:"error"`
+}
+
+func (e *matrixError) Error() string {
+	return fmt.Sprintf("matrix: %d %s: %s", e.Status, e.ErrCode, e.Message)
+}
+
+// client calls the client-server API of the homeserver as the application
+// service, the requests made for a virtual user set its user_id.
+type client struct {
+	baseURL string
+	asToken string
+	http    *http.Client
+}
+
+// register creates the virtual user localpart, it is not an error if it
+// already exists.
+func (c *client) register(ctx context.Context, localpart string) error {
+	req := map[string]string{"type": "m.login.application_service", "username": localpart}
+	err := c.do(ctx, http.MethodPost, "/_matrix/client/v3/register", "", req, nil)
+
+	var merr *matrixError
+	if errors.As(err, &merr) && merr.ErrCode == "M_USER_IN_USE" {
+		return nil
+	}
+	return err
+}
+
+func (c *client) setDisplayName(ctx context.Context, userID, name string) error {
+	path := "/_matrix/client/v3/profile/" + url.PathEscape(userID) + "/displayname"
+	return c.do(ctx, http.MethodPut, path, userID, map[string]string{"displayname": name}, nil)
+}
+
+func (c *client) displayName(ctx context.Context, userID string) (string, error) {
+	reply := struct {
+		DisplayName string `json:"displayname"`
+	}{}
+	path := "/_matrix/client/v3/profile/" + url.PathEscape(userID) + "/displayname"
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &reply); err != nil {
+		return "", err
+	}
+	return reply.DisplayName, nil
+}
+
+func (c *client) join(ctx context.Context, roomID, userID string) error {
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) + "/join"
+	return c.do(ctx, http.MethodPost, path, userID, struct{}{}, nil)
+}
+
+// send sends a message event, retrying with the same txnID does not send it
+// twice.
+func (c *client) send(ctx context.Context, roomID, userID, txnID string, content *messageContent) error {
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) + "/send/m.room.message/" + url.PathEscape(txnID)
+	return c.do(ctx, http.MethodPut, path, userID, content, nil)
+}
+
+// upload stores data in the media repository, it returns its mxc URI.
+func (c *client) upload(ctx context.Context, userID, filename, contentType string, data []byte) (string, error) {
+	query := url.Values{"filename": {filename}}
+	if userID != "" {
+		query.Set("user_id", userID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/_matrix/media/v3/upload?"+query.Encode(), bytes.NewReader(data))
+	if err != nil {
+		return "", errcode.ErrInvalidInput.Wrap(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	reply := struct {
+		ContentURI string `json:"content_uri"`
+	}{}
+	if err := c.roundTrip(req, &reply); err != nil {
+		return "", err
+	}
+	return reply.ContentURI, nil
+}
+
+// download returns the content of the media mxcURI.
+func (c *client) download(ctx context.Context, mxcURI string) ([]byte, error) {
+	serverName, mediaID, ok := strings.Cut(strings.TrimPrefix(mxcURI, "mxc://"), "/")
+	if !strings.HasPrefix(mxcURI, "mxc://") || !ok || serverName == "" || mediaID == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid media URI %q", mxcURI))
+	}
+
+	path := "/_matrix/client/v1/media/download/" + url.PathEscape(serverName) + "/" + url.PathEscape(mediaID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	res, err := c.http.Do(c.authorize(req))
+	if err != nil {
+		return nil, errcode.ErrInternal.Wrap(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errcode.ErrInternal.Wrap(replyError(res))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxMediaSize+1))
+	if err != nil {
+		return nil, errcode.ErrInternal.Wrap(err)
+	}
+	if len(data) > maxMediaSize {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("media %s larger than %d bytes", mxcURI, maxMediaSize))
+	}
+
+	return data, nil
+}
+
+// do sends body as JSON and decodes the reply in reply when not nil,
+// userID is the virtual user the request is made for, empty for the
+// application service itself.
+func (c *client) do(ctx context.Context, method, path, userID string, body, reply interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return errcode.ErrSerialization.Wrap(err)
+		}
+		payload = bytes.NewReader(raw)
+	}
+
+	target := c.baseURL + path
+	if userID != "" {
+		target += "?" + url.Values{"user_id": {userID}}.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, payload)
+	if err != nil {
+		return errcode.ErrInvalidInput.Wrap(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.roundTrip(req, reply)
+}
+
+func (c *client) roundTrip(req *http.Request, reply interface{}) error {
+	res, err := c.http.Do(c.authorize(req))
+	if err != nil {
+		return errcode.ErrInternal.Wrap(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errcode.ErrInternal.Wrap(replyError(res))
+	}
+
+	if reply == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(reply); err != nil {
+		return errcode.ErrDeserialization.Wrap(err)
+	}
+	return nil
+}
+
+func (c *client) authorize(req *http.Request) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+c.asToken)
+	return req
+}
+
+func replyError(res *http.Response) error {
+	merr := &matrixError{Status: res.StatusCode}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(merr); err != nil {
+		merr.Message = http.StatusText(res.StatusCode)
+	}
+	return merr
+}
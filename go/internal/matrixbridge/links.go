@@ -0,0 +1,45 @@
+package matrixbridge
+
+import (
+	"context"
+	"encoding/json"
+
+	datastore "github.com/ipfs/go-datastore"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// DatastoreKey is the key of the links in the root datastore of the
+// account.
+const DatastoreKey = "matrix_bridge_links"
+
+func loadLinks(ctx context.Context, ds datastore.Datastore) ([]Link, error) {
+	data, err := ds.Get(ctx, datastore.NewKey(DatastoreKey))
+	switch err {
+	case nil:
+	case datastore.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	var links []Link
+	if err := json.Unmarshal(data, &links); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return links, nil
+}
+
+func saveLinks(ctx context.Context, ds datastore.Datastore, links []Link) error {
+	data, err := json.Marshal(links)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := ds.Put(ctx, datastore.NewKey(DatastoreKey), data); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
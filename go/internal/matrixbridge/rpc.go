@@ -0,0 +1,119 @@
+package matrixbridge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/matrixbridgetypes"
+)
+
+// LinkRoom asks the node served by cc to relay the group groupPK to the
+// room roomID.
+func LinkRoom(ctx context.Context, cc grpc.ClientConnInterface, groupPK, roomID string) (*Link, error) {
+	reply, err := matrixbridgetypes.NewMatrixBridgeServiceClient(cc).Link(ctx, &matrixbridgetypes.Link_Request{GroupPK: groupPK, RoomID: roomID})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	if reply.Link == nil {
+		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("the node returned no link"))
+	}
+
+	link := linkFromProto(reply.Link)
+	return &link, nil
+}
+
+// UnlinkRoom asks the node served by cc to stop relaying the group groupPK.
+func UnlinkRoom(ctx context.Context, cc grpc.ClientConnInterface, groupPK string) error {
+	_, err := matrixbridgetypes.NewMatrixBridgeServiceClient(cc).Unlink(ctx, &matrixbridgetypes.Unlink_Request{GroupPK: groupPK})
+	return rpcError(err)
+}
+
+// ListLinks returns the groups relayed by the node served by cc.
+func ListLinks(ctx context.Context, cc grpc.ClientConnInterface) ([]Link, error) {
+	reply, err := matrixbridgetypes.NewMatrixBridgeServiceClient(cc).ListLinks(ctx, &matrixbridgetypes.ListLinks_Request{})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+
+	links := []Link{}
+	for _, link := range reply.Links {
+		links = append(links, linkFromProto(link))
+	}
+
+	return links, nil
+}
+
+func rpcError(err error) error {
+	if status.Code(err) == codes.Unimplemented {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the node has no Matrix bridge: %w", err))
+	}
+	return err
+}
+
+// Register adds the bridge service of b to server.
+func Register(server *grpc.Server, b *Bridge) {
+	matrixbridgetypes.RegisterMatrixBridgeServiceServer(server, &bridgeServer{bridge: b})
+}
+
+type bridgeServer struct {
+	matrixbridgetypes.UnimplementedMatrixBridgeServiceServer
+
+	bridge *Bridge
+}
+
+func (s *bridgeServer) Link(ctx context.Context, req *matrixbridgetypes.Link_Request) (*matrixbridgetypes.Link_Reply, error) {
+	if req.GroupPK == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a group public key is required"))
+	}
+
+	link, err := s.bridge.Link(ctx, req.GroupPK, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &matrixbridgetypes.Link_Reply{Link: link.toProto()}, nil
+}
+
+func (s *bridgeServer) Unlink(ctx context.Context, req *matrixbridgetypes.Unlink_Request) (*matrixbridgetypes.Unlink_Reply, error) {
+	if req.GroupPK == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a group public key is required"))
+	}
+
+	if err := s.bridge.Unlink(ctx, req.GroupPK); err != nil {
+		return nil, err
+	}
+
+	return &matrixbridgetypes.Unlink_Reply{}, nil
+}
+
+func (s *bridgeServer) ListLinks(context.Context, *matrixbridgetypes.ListLinks_Request) (*matrixbridgetypes.ListLinks_Reply, error) {
+	reply := &matrixbridgetypes.ListLinks_Reply{}
+	for _, link := range s.bridge.Links() {
+		reply.Links = append(reply.Links, link.toProto())
+	}
+
+	return reply, nil
+}
+
+func (l *Link) toProto() *matrixbridgetypes.RoomLink {
+	return &matrixbridgetypes.RoomLink{
+		GroupPK:  l.GroupPK,
+		RoomID:   l.RoomID,
+		LinkedAt: l.LinkedAt.UnixMilli(),
+	}
+}
+
+func linkFromProto(link *matrixbridgetypes.RoomLink) Link {
+	return Link{
+		GroupPK:  link.GroupPK,
+		RoomID:   link.RoomID,
+		LinkedAt: time.UnixMilli(link.LinkedAt),
+	}
+}
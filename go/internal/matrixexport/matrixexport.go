@@ -0,0 +1,224 @@
+// Package matrixexport writes the history of a conversation as Matrix room
+// events, in the JSON layout of the room exports of Matrix clients, for the
+// users migrating or bridging their conversations to Matrix. The senders are
+// mapped to Matrix user IDs derived from their public keys, the mapping is
+// written to its own file to be adjusted before importing the events.
+package matrixexport
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// DefaultServerName is the homeserver of the Matrix IDs when none is given.
+const DefaultServerName = "localhost"
+
+// UserPrefix starts the localpart of the Matrix users mapped to Berty
+// senders.
+const UserPrefix = "berty_"
+
+// The event types and message types written by Export.
+const (
+	EventTypeMember  = "m.room.member"
+	EventTypeMessage = "m.room.message"
+
+	MsgTypeText = "m.text"
+
+	membershipJoin = "join"
+	relationEdit   = "m.replace"
+)
+
+// Export is the history of a conversation as Matrix events.
+type Export struct {
+	RoomID     string    `json:"room_id"`
+	RoomName   string    `json:"room_name,omitempty"`
+	ExportDate time.Time `json:"export_date"`
+	// Messages are the events of the room, the membership of each sender
+	// precedes its first message.
+	Messages []*Event `json:"messages"`
+
+	// Senders maps the public keys of the senders to their Matrix user, it
+	// is written by WriteSenders.
+	Senders map[string]*Sender `json:"-"`
+
+	serverName string
+	joined     map[string]bool
+}
+
+// Event is a Matrix room event.
+type Event struct {
+	Type           string       `json:"type"`
+	EventID        string       `json:"event_id"`
+	RoomID         string       `json:"room_id"`
+	Sender         string       `json:"sender"`
+	OriginServerTS int64        `json:"origin_server_ts"`
+	StateKey       *string      `json:"state_key,omitempty"`
+	Content        EventContent `json:"content"`
+}
+
+// EventContent is the content of the member and message events.
+type EventContent struct {
+	Membership  string `json:"membership,omitempty"`
+	DisplayName string `json:"displayname,omitempty"`
+
+	MsgType    string          `json:"msgtype,omitempty"`
+	Body       string          `json:"body,omitempty"`
+	NewContent *EventContent   `json:"m.new_content,omitempty"`
+	RelatesTo  *EventRelatesTo `json:"m.relates_to,omitempty"`
+}
+
+// EventRelatesTo links an edit to the event it replaces.
+type EventRelatesTo struct {
+	RelType string `json:"rel_type"`
+	EventID string `json:"event_id"`
+}
+
+// Sender is the Matrix user of a sender.
+type Sender struct {
+	UserID      string `json:"user_id"`
+	DisplayName string `json:"display_name,omitempty"`
+	// Me is set for the account which exported the conversation.
+	Me bool `json:"me,omitempty"`
+}
+
+// New returns an empty export of the conversation conversationPK, on the
+// homeserver serverName, DefaultServerName when empty.
+func New(conversationPK, roomName, serverName string) (*Export, error) {
+	if serverName == "" {
+		serverName = DefaultServerName
+	}
+
+	localpart, err := localpartForKey(conversationPK)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{
+		RoomID:     fmt.Sprintf("!%s:%s", localpart, serverName),
+		RoomName:   roomName,
+		ExportDate: time.Now().UTC(),
+		Messages:   []*Event{},
+		Senders:    map[string]*Sender{},
+		serverName: serverName,
+		joined:     map[string]bool{},
+	}, nil
+}
+
+// AddSender maps the sender publicKey to a Matrix user, the first mapping of
+// a key is kept.
+func (e *Export) AddSender(publicKey, displayName string, me bool) error {
+	if _, ok := e.Senders[publicKey]; ok {
+		return nil
+	}
+
+	userID, err := UserID(publicKey, e.serverName)
+	if err != nil {
+		return err
+	}
+
+	e.Senders[publicKey] = &Sender{
+		UserID:      userID,
+		DisplayName: displayName,
+		Me:          me,
+	}
+
+	return nil
+}
+
+// AddMessage appends a text message of the sender publicKey, added with
+// AddSender. replaces is the cid of the message edited by this one, if any.
+func (e *Export) AddMessage(cid, publicKey string, sentAt time.Time, body, replaces string) error {
+	sender, ok := e.Senders[publicKey]
+	if !ok {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown sender %s", publicKey))
+	}
+
+	if !e.joined[publicKey] {
+		e.joined[publicKey] = true
+
+		stateKey := sender.UserID
+		e.Messages = append(e.Messages, &Event{
+			Type:           EventTypeMember,
+			EventID:        eventID(cid + "-join"),
+			RoomID:         e.RoomID,
+			Sender:         sender.UserID,
+			OriginServerTS: sentAt.UnixMilli(),
+			StateKey:       &stateKey,
+			Content:        EventContent{Membership: membershipJoin, DisplayName: sender.DisplayName},
+		})
+	}
+
+	content := EventContent{MsgType: MsgTypeText, Body: body}
+	if replaces != "" {
+		// the clients without edits display the body
+		content = EventContent{
+			MsgType:    MsgTypeText,
+			Body:       "* " + body,
+			NewContent: &EventContent{MsgType: MsgTypeText, Body: body},
+			RelatesTo:  &EventRelatesTo{RelType: relationEdit, EventID: eventID(replaces)},
+		}
+	}
+
+	e.Messages = append(e.Messages, &Event{
+		Type:           EventTypeMessage,
+		EventID:        eventID(cid),
+		RoomID:         e.RoomID,
+		Sender:         sender.UserID,
+		OriginServerTS: sentAt.UnixMilli(),
+		Content:        content,
+	})
+
+	return nil
+}
+
+// WriteEvents writes the export as indented JSON.
+func WriteEvents(w io.Writer, e *Export) error {
+	return writeJSON(w, e)
+}
+
+// WriteSenders writes the mapping of the senders as indented JSON, keyed by
+// public key.
+func WriteSenders(w io.Writer, e *Export) error {
+	return writeJSON(w, e.Senders)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+	return nil
+}
+
+// UserID returns the Matrix user of the sender publicKey on the homeserver
+// serverName, the same key is always mapped to the same user.
+func UserID(publicKey, serverName string) (string, error) {
+	localpart, err := localpartForKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("@%s%s:%s", UserPrefix, localpart, serverName), nil
+}
+
+// localpartForKey returns the hex encoding of a public key, the base64 one
+// has upper case letters, which the Matrix IDs do not allow.
+func localpartForKey(publicKey string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(publicKey)
+	if err != nil || len(raw) == 0 {
+		return "", errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid public key %q", publicKey))
+	}
+
+	return hex.EncodeToString(raw), nil
+}
+
+func eventID(cid string) string {
+	return "$" + cid
+}
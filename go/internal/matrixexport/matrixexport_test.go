@@ -0,0 +1,82 @@
+package matrixexport
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestExport(t *testing.T) {
+	// base64url of 0x0102, 0xfffe and 0x0101
+	const (
+		conversationPK = "AQI"
+		mePK           = "__4"
+		contactPK      = "AQE"
+	)
+
+	e, err := New(conversationPK, "alice", "example.org")
+	require.NoError(t, err)
+	require.Equal(t, "!0102:example.org", e.RoomID)
+
+	require.NoError(t, e.AddSender(mePK, "bob", true))
+	require.NoError(t, e.AddSender(contactPK, "alice", false))
+	require.NoError(t, e.AddSender(contactPK, "ignored", false))
+	require.Equal(t, &Sender{UserID: "@berty_0101:example.org", DisplayName: "alice"}, e.Senders[contactPK])
+
+	sentAt := time.UnixMilli(1000)
+	require.NoError(t, e.AddMessage("cid1", contactPK, sentAt, "hello", ""))
+	require.NoError(t, e.AddMessage("cid2", mePK, sentAt.Add(time.Second), "hi", ""))
+	require.NoError(t, e.AddMessage("cid3", mePK, sentAt.Add(2*time.Second), "hi!", "cid2"))
+
+	err = e.AddMessage("cid4", "AQM", sentAt, "unknown", "")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	// a membership precedes the first message of each sender
+	require.Len(t, e.Messages, 5)
+	require.Equal(t, EventTypeMember, e.Messages[0].Type)
+	require.Equal(t, "@berty_0101:example.org", *e.Messages[0].StateKey)
+	require.Equal(t, "alice", e.Messages[0].Content.DisplayName)
+	require.Equal(t, EventTypeMessage, e.Messages[1].Type)
+	require.Equal(t, "$cid1", e.Messages[1].EventID)
+	require.Equal(t, int64(1000), e.Messages[1].OriginServerTS)
+	require.Equal(t, EventTypeMember, e.Messages[2].Type)
+	require.Equal(t, "@berty_fffe:example.org", e.Messages[2].Sender)
+
+	edit := e.Messages[4]
+	require.Equal(t, "* hi!", edit.Content.Body)
+	require.Equal(t, "hi!", edit.Content.NewContent.Body)
+	require.Equal(t, &EventRelatesTo{RelType: "m.replace", EventID: "$cid2"}, edit.Content.RelatesTo)
+
+	events := &bytes.Buffer{}
+	require.NoError(t, WriteEvents(events, e))
+
+	decoded := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(events.Bytes(), &decoded))
+	require.Equal(t, "!0102:example.org", decoded["room_id"])
+	require.NotContains(t, decoded, "Senders")
+	message := decoded["messages"].([]interface{})[1].(map[string]interface{})
+	require.Equal(t, map[string]interface{}{"msgtype": "m.text", "body": "hello"}, message["content"])
+	require.NotContains(t, message, "state_key")
+
+	senders := map[string]*Sender{}
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteSenders(buf, e))
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &senders))
+	require.Equal(t, e.Senders, senders)
+}
+
+func TestInvalidKeys(t *testing.T) {
+	_, err := New("not base64!", "", "")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	e, err := New("AQI", "", "")
+	require.NoError(t, err)
+	require.Equal(t, "!0102:"+DefaultServerName, e.RoomID)
+
+	require.True(t, errcode.Is(e.AddSender("", "", false), errcode.ErrInvalidInput))
+}
@@ -0,0 +1,104 @@
+// Package messagedrafts keeps the text being composed in each conversation
+// in the account datastore, so that the clients of a daemon share their
+// drafts.
+package messagedrafts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Namespace is the key prefix used in the account root datastore.
+const Namespace = "message-drafts"
+
+// Draft is the unsent text of a conversation.
+type Draft struct {
+	ConversationPK string    `json:"conversation_public_key"`
+	Text           string    `json:"text"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Store stores the drafts under `/<conversation public key>`, a
+// conversation has a single draft.
+type Store struct {
+	ds    datastore.Datastore
+	clock clock.Clock
+}
+
+func New(ds datastore.Datastore) *Store {
+	return &Store{
+		ds:    namespace.Wrap(ds, datastore.NewKey(Namespace)),
+		clock: clock.New(),
+	}
+}
+
+// SetClock replaces the clock dating the drafts, e.g. with a mock in tests.
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Save replaces the draft of a conversation, an empty text deletes it.
+func (s *Store) Save(ctx context.Context, conversationPK string, text string) (*Draft, error) {
+	if conversationPK == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation is required"))
+	}
+
+	draft := &Draft{ConversationPK: conversationPK, Text: text, UpdatedAt: s.clock.Now()}
+	if text == "" {
+		return draft, s.Delete(ctx, conversationPK)
+	}
+
+	raw, err := json.Marshal(draft)
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := s.ds.Put(ctx, datastore.NewKey(conversationPK), raw); err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return draft, nil
+}
+
+// Get returns the draft of a conversation, it fails with ErrNotFound when
+// there is none.
+func (s *Store) Get(ctx context.Context, conversationPK string) (*Draft, error) {
+	if conversationPK == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation is required"))
+	}
+
+	raw, err := s.ds.Get(ctx, datastore.NewKey(conversationPK))
+	if err == datastore.ErrNotFound {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("no draft for conversation %q", conversationPK))
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	draft := &Draft{}
+	if err := json.Unmarshal(raw, draft); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return draft, nil
+}
+
+// Delete removes the draft of a conversation, if any.
+func (s *Store) Delete(ctx context.Context, conversationPK string) error {
+	if conversationPK == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation is required"))
+	}
+
+	if err := s.ds.Delete(ctx, datastore.NewKey(conversationPK)); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
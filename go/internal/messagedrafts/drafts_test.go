@@ -0,0 +1,69 @@
+package messagedrafts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestSaveGetDelete(t *testing.T) {
+	ctx := context.Background()
+	ds := ds_sync.MutexWrap(datastore.NewMapDatastore())
+	s := New(ds)
+
+	_, err := s.Get(ctx, "conv")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	_, err = s.Save(ctx, "conv", "hello")
+	require.NoError(t, err)
+	_, err = s.Save(ctx, "conv", "hello world")
+	require.NoError(t, err)
+
+	// shared by the stores of the datastore
+	draft, err := New(ds).Get(ctx, "conv")
+	require.NoError(t, err)
+	require.Equal(t, "conv", draft.ConversationPK)
+	require.Equal(t, "hello world", draft.Text)
+	require.False(t, draft.UpdatedAt.IsZero())
+
+	// an empty text deletes the draft
+	_, err = s.Save(ctx, "conv", "")
+	require.NoError(t, err)
+	_, err = s.Get(ctx, "conv")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	_, err = s.Save(ctx, "conv", "again")
+	require.NoError(t, err)
+	require.NoError(t, s.Delete(ctx, "conv"))
+	require.NoError(t, s.Delete(ctx, "conv"))
+	_, err = s.Get(ctx, "conv")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	_, err = s.Save(ctx, "", "text")
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+}
+
+func TestSaveWithMockClock(t *testing.T) {
+	ctx := context.Background()
+	mock := clock.NewMock()
+	mock.Set(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+	s := New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+	s.SetClock(mock)
+
+	_, err := s.Save(ctx, "conv", "hello")
+	require.NoError(t, err)
+	mock.Add(time.Minute)
+	_, err = s.Save(ctx, "conv", "hello world")
+	require.NoError(t, err)
+
+	draft, err := s.Get(ctx, "conv")
+	require.NoError(t, err)
+	require.True(t, draft.UpdatedAt.Equal(time.Date(2023, 1, 2, 3, 5, 5, 0, time.UTC)))
+}
@@ -0,0 +1,108 @@
+//go:build linux && !android
+// +build linux,!android
+
+package messagelocation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	geoclueService       = "org.freedesktop.GeoClue2"
+	geoclueManagerPath   = "/org/freedesktop/GeoClue2/Manager"
+	geoclueClient        = geoclueService + ".Client"
+	geoclueLocation      = geoclueService + ".Location"
+	geoclueAccuracyExact = uint32(8)
+)
+
+// LocateSupported is true when Locate can query the location service of the
+// system, geoclue on linux.
+const LocateSupported = true
+
+// Locate asks geoclue for the current location of the device, through the
+// system D-Bus. desktopID is the name of the application, geoclue may ask the
+// user to allow it.
+func Locate(ctx context.Context, desktopID string) (Location, error) {
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		return Location{}, errcode.ErrNotImplemented.Wrap(fmt.Errorf("no system bus for geoclue: %w", err))
+	}
+	defer conn.Close()
+
+	var clientPath dbus.ObjectPath
+	manager := conn.Object(geoclueService, geoclueManagerPath)
+	if err := manager.CallWithContext(ctx, geoclueService+".Manager.GetClient", 0).Store(&clientPath); err != nil {
+		return Location{}, errcode.ErrNotImplemented.Wrap(fmt.Errorf("geoclue is not available: %w", err))
+	}
+
+	client := conn.Object(geoclueService, clientPath)
+	if err := client.SetProperty(geoclueClient+".DesktopId", dbus.MakeVariant(desktopID)); err != nil {
+		return Location{}, errcode.ErrInternal.Wrap(err)
+	}
+	if err := client.SetProperty(geoclueClient+".RequestedAccuracyLevel", dbus.MakeVariant(geoclueAccuracyExact)); err != nil {
+		return Location{}, errcode.ErrInternal.Wrap(err)
+	}
+
+	signals := make(chan *dbus.Signal, 1)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+	if err := conn.AddMatchSignalContext(ctx,
+		dbus.WithMatchObjectPath(clientPath),
+		dbus.WithMatchInterface(geoclueClient),
+		dbus.WithMatchMember("LocationUpdated"),
+	); err != nil {
+		return Location{}, errcode.ErrInternal.Wrap(err)
+	}
+
+	if err := client.CallWithContext(ctx, geoclueClient+".Start", 0).Err; err != nil {
+		return Location{}, errcode.ErrInternal.Wrap(fmt.Errorf("geoclue refused to locate the device: %w", err))
+	}
+	defer client.Call(geoclueClient+".Stop", 0)
+
+	// the signal carries the previous and the new location objects
+	var locationPath dbus.ObjectPath
+	for locationPath == "" {
+		select {
+		case <-ctx.Done():
+			return Location{}, errcode.ErrInternal.Wrap(fmt.Errorf("geoclue did not locate the device: %w", ctx.Err()))
+		case sig := <-signals:
+			if sig.Path != clientPath || len(sig.Body) != 2 {
+				continue
+			}
+			locationPath, _ = sig.Body[1].(dbus.ObjectPath)
+		}
+	}
+
+	location := conn.Object(geoclueService, locationPath)
+	l := Location{}
+	for _, prop := range []struct {
+		name  string
+		value *float64
+	}{
+		{"Latitude", &l.Latitude},
+		{"Longitude", &l.Longitude},
+	} {
+		v, err := location.GetProperty(geoclueLocation + "." + prop.name)
+		if err != nil {
+			return Location{}, errcode.ErrInternal.Wrap(err)
+		}
+		if err := v.Store(prop.value); err != nil {
+			return Location{}, errcode.ErrDeserialization.Wrap(err)
+		}
+	}
+
+	if v, err := location.GetProperty(geoclueLocation + ".Description"); err == nil {
+		_ = v.Store(&l.Label)
+	}
+
+	if err := l.Validate(); err != nil {
+		return Location{}, err
+	}
+
+	return l, nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux || android
+// +build !linux android
+
+package messagelocation
+
+import (
+	"context"
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// LocateSupported is true when Locate can query the location service of the
+// system, geoclue on linux.
+const LocateSupported = false
+
+// Locate is only implemented with geoclue, CoreLocation needs cgo and an
+// application bundle declaring the usage of the location.
+func Locate(context.Context, string) (Location, error) {
+	return Location{}, errcode.ErrNotImplemented.Wrap(fmt.Errorf("no location service on this platform, give the coordinates"))
+}
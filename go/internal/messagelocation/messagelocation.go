@@ -0,0 +1,152 @@
+// Package messagelocation sends a geographic location as a user message.
+//
+// The coordinates are sent in the location field of the UserMessage, its
+// body is a map link. Clients unaware of the field display the link. It is
+// the encoding of the locations of appmessage.
+package messagelocation
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
+	"github.com/golang/protobuf/proto"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const MaxLabelLength = 256
+
+// Location is a point on the WGS 84 ellipsoid, as reported by GPS.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	Label     string
+}
+
+// Validate checks the range of the coordinates and the length of the label.
+func (l Location) Validate() error {
+	if math.IsNaN(l.Latitude) || l.Latitude < -90 || l.Latitude > 90 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("latitude must be between -90 and 90"))
+	}
+
+	if math.IsNaN(l.Longitude) || l.Longitude < -180 || l.Longitude > 180 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("longitude must be between -180 and 180"))
+	}
+
+	if utf8.RuneCountInString(l.Label) > MaxLabelLength {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("label is longer than %d characters", MaxLabelLength))
+	}
+
+	return nil
+}
+
+// Parse reads "<lat> <lon> [label]", the coordinates in decimal degrees
+// can also be separated by a comma, as copied from most maps.
+func Parse(s string) (Location, error) {
+	fields := strings.Fields(s)
+	if len(fields) > 0 && strings.Contains(fields[0], ",") {
+		lat, lon, _ := strings.Cut(fields[0], ",")
+		fields = append([]string{lat, lon}, fields[1:]...)
+		if lon == "" {
+			fields = append(fields[:1], fields[2:]...)
+		}
+	}
+	if len(fields) < 2 {
+		return Location{}, errcode.ErrMissingInput.Wrap(fmt.Errorf("expected <lat> <lon> [label]"))
+	}
+
+	l := Location{Label: strings.Join(fields[2:], " ")}
+
+	var err error
+	if l.Latitude, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return Location{}, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid latitude %q", fields[0]))
+	}
+	if l.Longitude, err = strconv.ParseFloat(fields[1], 64); err != nil {
+		return Location{}, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid longitude %q", fields[1]))
+	}
+
+	if err := l.Validate(); err != nil {
+		return Location{}, err
+	}
+
+	return l, nil
+}
+
+// MapLink returns the OpenStreetMap URL of the location, with a marker.
+func MapLink(l Location) string {
+	lat := strconv.FormatFloat(l.Latitude, 'f', 6, 64)
+	lon := strconv.FormatFloat(l.Longitude, 'f', 6, 64)
+
+	return fmt.Sprintf("https://www.openstreetmap.org/?mlat=%s&mlon=%s#map=16/%s/%s", lat, lon, lat, lon)
+}
+
+// Text returns the single line displaying the location, it is the body of
+// the sent message.
+func Text(l Location) string {
+	if l.Label == "" {
+		return "location: " + MapLink(l)
+	}
+
+	return fmt.Sprintf("location: %s %s", strings.Join(strings.Fields(l.Label), " "), MapLink(l))
+}
+
+// ToProto returns the location field of the UserMessage.
+func ToProto(l Location) *messengertypes.AppMessage_UserMessage_Location {
+	return &messengertypes.AppMessage_UserMessage_Location{
+		Latitude:  l.Latitude,
+		Longitude: l.Longitude,
+		Label:     l.Label,
+	}
+}
+
+// FromProto returns the location of the location field of a UserMessage.
+func FromProto(pl *messengertypes.AppMessage_UserMessage_Location) (Location, error) {
+	l := Location{
+		Latitude:  pl.GetLatitude(),
+		Longitude: pl.GetLongitude(),
+		Label:     pl.GetLabel(),
+	}
+	if err := l.Validate(); err != nil {
+		return Location{}, err
+	}
+
+	return l, nil
+}
+
+// MarshalPayload returns the UserMessage payload carrying the location.
+func MarshalPayload(l Location) ([]byte, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+
+	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: Text(l), Location: ToProto(l)})
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	return payload, nil
+}
+
+// UnmarshalPayload extracts the location from a UserMessage payload, ok is
+// false when the message is not a location.
+func UnmarshalPayload(payload []byte) (l Location, ok bool, err error) {
+	um := messengertypes.AppMessage_UserMessage{}
+	if err := proto.Unmarshal(payload, &um); err != nil {
+		return Location{}, false, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if um.Location == nil {
+		return Location{}, false, nil
+	}
+
+	if l, err = FromProto(um.Location); err != nil {
+		return Location{}, false, err
+	}
+
+	return l, true, nil
+}
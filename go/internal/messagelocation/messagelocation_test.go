@@ -0,0 +1,91 @@
+package messagelocation
+
+import (
+	"strings"
+	"testing"
+
+	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		expected Location
+	}{
+		{"48.8584 2.2945", Location{Latitude: 48.8584, Longitude: 2.2945}},
+		{"48.8584 2.2945 Eiffel  Tower", Location{Latitude: 48.8584, Longitude: 2.2945, Label: "Eiffel Tower"}},
+		{"48.8584,2.2945 Eiffel Tower", Location{Latitude: 48.8584, Longitude: 2.2945, Label: "Eiffel Tower"}},
+		{"48.8584, 2.2945", Location{Latitude: 48.8584, Longitude: 2.2945}},
+		{"-33.8568 151.2153 Sydney, Australia", Location{Latitude: -33.8568, Longitude: 151.2153, Label: "Sydney, Australia"}},
+	} {
+		l, err := Parse(tc.in)
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.expected, l, tc.in)
+	}
+
+	for _, in := range []string{"", "48.8584", "48.8584,"} {
+		_, err := Parse(in)
+		require.True(t, errcode.Is(err, errcode.ErrMissingInput), in)
+	}
+
+	for _, in := range []string{"north 2.2945", "48.8584 east", "91 0", "0 -181", "NaN 0"} {
+		_, err := Parse(in)
+		require.True(t, errcode.Is(err, errcode.ErrInvalidInput), in)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	l := Location{Latitude: 48.8584, Longitude: 2.2945, Label: "Eiffel Tower"}
+
+	payload, err := MarshalPayload(l)
+	require.NoError(t, err)
+
+	// clients unaware of the location display the link
+	um := &messengertypes.AppMessage_UserMessage{}
+	require.NoError(t, proto.Unmarshal(payload, um))
+	require.Equal(t, "location: Eiffel Tower https://www.openstreetmap.org/?mlat=48.858400&mlon=2.294500#map=16/48.858400/2.294500", um.Body)
+	require.Equal(t, 48.8584, um.GetLocation().GetLatitude())
+	require.Equal(t, 2.2945, um.GetLocation().GetLongitude())
+	require.Equal(t, "Eiffel Tower", um.GetLocation().GetLabel())
+
+	decoded, ok, err := UnmarshalPayload(payload)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, l, decoded)
+
+	// a plain message is not a location
+	plain, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: "hello"})
+	require.NoError(t, err)
+	_, ok, err = UnmarshalPayload(plain)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, ok, err = UnmarshalPayload(payload[:len(payload)-3])
+	require.Error(t, err)
+	require.False(t, ok)
+
+	// the received coordinates are validated
+	invalid, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Location: &messengertypes.AppMessage_UserMessage_Location{Latitude: 100}})
+	require.NoError(t, err)
+	_, ok, err = UnmarshalPayload(invalid)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+	require.False(t, ok)
+
+	_, err = MarshalPayload(Location{Latitude: 100})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	_, err = MarshalPayload(Location{Label: strings.Repeat("a", MaxLabelLength+1)})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
+
+func TestText(t *testing.T) {
+	require.Equal(t, "location: https://www.openstreetmap.org/?mlat=-33.856800&mlon=151.215300#map=16/-33.856800/151.215300",
+		Text(Location{Latitude: -33.8568, Longitude: 151.2153}))
+	require.Equal(t, "location: Sydney Opera House https://www.openstreetmap.org/?mlat=-33.856800&mlon=151.215300#map=16/-33.856800/151.215300",
+		Text(Location{Latitude: -33.8568, Longitude: 151.2153, Label: "Sydney\nOpera House"}))
+}
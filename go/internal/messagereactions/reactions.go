@@ -0,0 +1,158 @@
+// Package messagereactions keeps the reactions of the members of the groups
+// to their messages in the account datastore, and counts them per message so
+// that the clients do not have to replay every reaction.
+package messagereactions
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// Namespace is the key prefix used in the account root datastore.
+	Namespace = "message-reactions"
+
+	// MaxEmojiLength bounds the size of a reaction, in bytes.
+	MaxEmojiLength = 32
+)
+
+// Reaction is the last reaction of a member to a message with an emoji.
+type Reaction struct {
+	MemberPK string `json:"member_public_key"`
+	Emoji    string `json:"emoji"`
+	// Removed is true when the member took its reaction back
+	Removed bool `json:"removed,omitempty"`
+	// SentDate is the sent date of the reaction, in ms, the latest reaction
+	// of a member wins
+	SentDate int64 `json:"sent_date"`
+}
+
+// Count is the number of members who reacted to a message with an emoji.
+type Count struct {
+	Emoji string
+	// Reactors are the members who reacted, sorted
+	Reactors []string
+}
+
+// Store stores the reactions under
+// `/<conversation public key>/<message cid>/<member public key>/<emoji>`,
+// the emoji is base64 encoded.
+type Store struct {
+	ds datastore.Datastore
+	mu sync.Mutex
+}
+
+func New(ds datastore.Datastore) *Store {
+	return &Store{
+		ds: namespace.Wrap(ds, datastore.NewKey(Namespace)),
+	}
+}
+
+func messageKey(conversationPK, cid string) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{conversationPK, cid})
+}
+
+// Add records the reaction of a member to a message, it is ignored if the
+// member reacted later with the same emoji. It returns whether the reaction
+// was recorded.
+func (s *Store) Add(ctx context.Context, conversationPK, cid string, reaction *Reaction) (bool, error) {
+	switch {
+	case conversationPK == "" || cid == "" || reaction.MemberPK == "" || reaction.Emoji == "":
+		return false, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation, a message, a member and an emoji are required"))
+	case len(reaction.Emoji) > MaxEmojiLength:
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the emoji can't be longer than %d bytes", MaxEmojiLength))
+	case strings.Contains(conversationPK+cid+reaction.MemberPK, "/"):
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid key"))
+	}
+
+	key := messageKey(conversationPK, cid).ChildString(reaction.MemberPK).ChildString(base64.RawURLEncoding.EncodeToString([]byte(reaction.Emoji)))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the messages of a group are not received in order
+	raw, err := s.ds.Get(ctx, key)
+	switch {
+	case err == nil:
+		last := Reaction{}
+		if err := json.Unmarshal(raw, &last); err != nil {
+			return false, errcode.ErrDeserialization.Wrap(err)
+		}
+		if last.SentDate > reaction.SentDate {
+			return false, nil
+		}
+	case err != datastore.ErrNotFound:
+		return false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	raw, err = json.Marshal(reaction)
+	if err != nil {
+		return false, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := s.ds.Put(ctx, key, raw); err != nil {
+		return false, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return true, nil
+}
+
+// Counts returns the reactions to a message per emoji, the most used first.
+func (s *Store) Counts(ctx context.Context, conversationPK, cid string) ([]*Count, error) {
+	if conversationPK == "" || cid == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation and a message are required"))
+	}
+
+	res, err := s.ds.Query(ctx, query.Query{Prefix: messageKey(conversationPK, cid).String()})
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	defer res.Close()
+
+	counts := map[string]*Count{}
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, errcode.ErrDBRead.Wrap(r.Error)
+		}
+
+		reaction := Reaction{}
+		if err := json.Unmarshal(r.Value, &reaction); err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+		if reaction.Removed {
+			continue
+		}
+
+		count, ok := counts[reaction.Emoji]
+		if !ok {
+			count = &Count{Emoji: reaction.Emoji}
+			counts[reaction.Emoji] = count
+		}
+		count.Reactors = append(count.Reactors, reaction.MemberPK)
+	}
+
+	ret := make([]*Count, 0, len(counts))
+	for _, count := range counts {
+		sort.Strings(count.Reactors)
+		ret = append(ret, count)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if len(ret[i].Reactors) != len(ret[j].Reactors) {
+			return len(ret[i].Reactors) > len(ret[j].Reactors)
+		}
+		return ret[i].Emoji < ret[j].Emoji
+	})
+
+	return ret, nil
+}
@@ -0,0 +1,67 @@
+package messagereactions
+
+import (
+	"context"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestAddCounts(t *testing.T) {
+	ctx := context.Background()
+	s := New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	counts, err := s.Counts(ctx, "conv", "cid1")
+	require.NoError(t, err)
+	require.Empty(t, counts)
+
+	for _, r := range []*Reaction{
+		{MemberPK: "m1", Emoji: "👍", SentDate: 1},
+		{MemberPK: "m2", Emoji: "👍", SentDate: 1},
+		{MemberPK: "m2", Emoji: "🎉", SentDate: 2},
+		{MemberPK: "m3", Emoji: "🎉", SentDate: 3},
+	} {
+		added, err := s.Add(ctx, "conv", "cid1", r)
+		require.NoError(t, err)
+		require.True(t, added)
+	}
+
+	// other messages
+	_, err = s.Add(ctx, "conv", "cid2", &Reaction{MemberPK: "m1", Emoji: "❤️", SentDate: 1})
+	require.NoError(t, err)
+	_, err = s.Add(ctx, "conv", "cid10", &Reaction{MemberPK: "m1", Emoji: "❤️", SentDate: 1})
+	require.NoError(t, err)
+
+	counts, err = s.Counts(ctx, "conv", "cid1")
+	require.NoError(t, err)
+	require.Len(t, counts, 2)
+	require.Equal(t, "🎉", counts[0].Emoji)
+	require.Equal(t, []string{"m2", "m3"}, counts[0].Reactors)
+	require.Equal(t, "👍", counts[1].Emoji)
+	require.Equal(t, []string{"m1", "m2"}, counts[1].Reactors)
+
+	// the latest reaction of a member wins, whatever the order they are
+	// received in
+	added, err := s.Add(ctx, "conv", "cid1", &Reaction{MemberPK: "m3", Emoji: "🎉", Removed: true, SentDate: 5})
+	require.NoError(t, err)
+	require.True(t, added)
+	added, err = s.Add(ctx, "conv", "cid1", &Reaction{MemberPK: "m3", Emoji: "🎉", SentDate: 4})
+	require.NoError(t, err)
+	require.False(t, added)
+
+	counts, err = s.Counts(ctx, "conv", "cid1")
+	require.NoError(t, err)
+	require.Len(t, counts, 2)
+	require.Equal(t, "👍", counts[0].Emoji)
+	require.Equal(t, "🎉", counts[1].Emoji)
+	require.Equal(t, []string{"m2"}, counts[1].Reactors)
+
+	_, err = s.Add(ctx, "conv", "cid1", &Reaction{MemberPK: "m1", SentDate: 1})
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+	_, err = s.Add(ctx, "conv", "cid/1", &Reaction{MemberPK: "m1", Emoji: "👍", SentDate: 1})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
@@ -0,0 +1,352 @@
+// Package messagescheduler keeps the messages to send later in the account
+// datastore and dispatches them once they are due. Messages which were due
+// while the node was stopped are sent as soon as the scheduler runs again.
+package messagescheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/gofrs/uuid"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Namespace is the key prefix used in the account root datastore.
+const Namespace = "scheduled-messages"
+
+const (
+	retryMinDelay = 10 * time.Second
+	retryMaxDelay = time.Hour
+)
+
+// Message is a message waiting to be sent.
+type Message struct {
+	ID      string    `json:"id"`
+	GroupPK string    `json:"group_pk"`
+	Payload []byte    `json:"payload"`
+	SendAt  time.Time `json:"send_at"`
+
+	// Attempts counts the failed dispatches, the next one happens at
+	// RetryAt.
+	Attempts  int       `json:"attempts,omitempty"`
+	RetryAt   time.Time `json:"retry_at,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// DueAt returns when the message will be dispatched.
+func (m Message) DueAt() time.Time {
+	if m.RetryAt.After(m.SendAt) {
+		return m.RetryAt
+	}
+	return m.SendAt
+}
+
+// SendFunc sends a due message.
+type SendFunc func(ctx context.Context, m Message) error
+
+// Scheduler stores the scheduled messages under `/<id>`.
+type Scheduler struct {
+	ds     datastore.Datastore
+	logger *zap.Logger
+	clock  clock.Clock
+	wake   chan struct{}
+	mu     sync.Mutex
+}
+
+func New(ds datastore.Datastore, logger *zap.Logger) *Scheduler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &Scheduler{
+		ds:     namespace.Wrap(ds, datastore.NewKey(Namespace)),
+		logger: logger,
+		clock:  clock.New(),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// SetClock replaces the clock of the due dates and of the retries, e.g. with
+// a mock in tests. It must be called before Run.
+func (s *Scheduler) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Schedule stores a message to send at sendAt, a date in the past sends it
+// right away.
+func (s *Scheduler) Schedule(ctx context.Context, groupPK string, payload []byte, sendAt time.Time) (Message, error) {
+	if groupPK == "" {
+		return Message{}, errcode.ErrMissingInput.Wrap(fmt.Errorf("a group is required"))
+	}
+
+	if sendAt.IsZero() {
+		return Message{}, errcode.ErrMissingInput.Wrap(fmt.Errorf("a send date is required"))
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return Message{}, errcode.ErrCryptoRandomGeneration.Wrap(err)
+	}
+
+	m := Message{ID: id.String(), GroupPK: groupPK, Payload: payload, SendAt: sendAt}
+
+	s.mu.Lock()
+	err = s.put(ctx, m)
+	s.mu.Unlock()
+	if err != nil {
+		return Message{}, err
+	}
+
+	s.notify()
+
+	return m, nil
+}
+
+// List returns the pending messages, by due date.
+func (s *Scheduler) List(ctx context.Context) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list(ctx)
+}
+
+// Cancel removes a pending message, messages being sent cannot be cancelled
+// anymore.
+func (s *Scheduler) Cancel(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := datastore.NewKey(id)
+	has, err := s.ds.Has(ctx, key)
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	if !has {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown scheduled message %q", id))
+	}
+
+	if err := s.ds.Delete(ctx, key); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	s.notify()
+
+	return nil
+}
+
+// RetryNow dispatches the messages waiting for a retry without waiting for
+// their backoff, e.g. once the network is back. Their attempts are kept.
+func (s *Scheduler) RetryNow(ctx context.Context) error {
+	s.mu.Lock()
+	messages, err := s.list(ctx)
+	if err == nil {
+		now := s.clock.Now()
+		for _, m := range messages {
+			if m.Attempts == 0 || !m.RetryAt.After(now) {
+				continue
+			}
+
+			m.RetryAt = now
+			if err = s.put(ctx, m); err != nil {
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.notify()
+
+	return nil
+}
+
+// Run dispatches the messages when they are due until ctx is done.
+//
+// A message is removed from the store before being sent and stored again
+// when the dispatch fails, so a crash in between drops it instead of sending
+// it twice.
+func (s *Scheduler) Run(ctx context.Context, send SendFunc) {
+	for {
+		next, err := s.dispatchDue(ctx, send)
+		if err != nil {
+			s.logger.Error("unable to dispatch scheduled messages", zap.Error(err))
+			next = s.clock.Now().Add(retryMinDelay)
+		}
+
+		var timer *clock.Timer
+		var timerC <-chan time.Time
+		if !next.IsZero() {
+			timer = s.clock.Timer(s.clock.Until(next))
+			timerC = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-s.wake:
+		case <-timerC:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// dispatchDue sends the due messages and returns the due date of the next
+// one, zero when none is left.
+func (s *Scheduler) dispatchDue(ctx context.Context, send SendFunc) (time.Time, error) {
+	messages, err := s.List(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next := time.Time{}
+	for _, m := range messages {
+		if ctx.Err() != nil {
+			return time.Time{}, nil
+		}
+
+		if due := m.DueAt(); due.After(s.clock.Now()) {
+			if next.IsZero() || due.Before(next) {
+				next = due
+			}
+			continue
+		}
+
+		claimed, err := s.claim(ctx, m.ID)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if !claimed {
+			// cancelled in the meantime
+			continue
+		}
+
+		if err := send(ctx, m); err != nil {
+			m = s.failed(m, err)
+			s.logger.Warn("unable to send scheduled message", zap.String("id", m.ID), zap.Int("attempts", m.Attempts), zap.Error(err))
+
+			s.mu.Lock()
+			err = s.put(ctx, m)
+			s.mu.Unlock()
+			if err != nil {
+				return time.Time{}, err
+			}
+
+			if next.IsZero() || m.RetryAt.Before(next) {
+				next = m.RetryAt
+			}
+			continue
+		}
+
+		s.logger.Debug("scheduled message sent", zap.String("id", m.ID))
+	}
+
+	return next, nil
+}
+
+func (s *Scheduler) failed(m Message, err error) Message {
+	m.Attempts++
+	m.LastError = err.Error()
+
+	delay := retryMaxDelay
+	if m.Attempts < 16 {
+		if d := retryMinDelay << (m.Attempts - 1); d < retryMaxDelay {
+			delay = d
+		}
+	}
+	m.RetryAt = s.clock.Now().Add(delay)
+
+	return m
+}
+
+// claim removes a message before its dispatch, it returns false when the
+// message is not stored anymore.
+func (s *Scheduler) claim(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := datastore.NewKey(id)
+	has, err := s.ds.Has(ctx, key)
+	if err != nil {
+		return false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if !has {
+		return false, nil
+	}
+
+	if err := s.ds.Delete(ctx, key); err != nil {
+		return false, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return true, nil
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) put(ctx context.Context, m Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := s.ds.Put(ctx, datastore.NewKey(m.ID), data); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+func (s *Scheduler) list(ctx context.Context) ([]Message, error) {
+	results, err := s.ds.Query(ctx, query.Query{})
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	defer results.Close()
+
+	messages := []Message(nil)
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, errcode.ErrDBRead.Wrap(result.Error)
+		}
+
+		var m Message
+		if err := json.Unmarshal(result.Value, &m); err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+		messages = append(messages, m)
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		if di, dj := messages[i].DueAt(), messages[j].DueAt(); !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return messages[i].ID < messages[j].ID
+	})
+
+	return messages, nil
+}
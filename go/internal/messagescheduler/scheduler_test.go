@@ -0,0 +1,184 @@
+package messagescheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+type testSender struct {
+	mu   sync.Mutex
+	sent []Message
+	fail bool
+}
+
+func (ts *testSender) send(_ context.Context, m Message) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.fail {
+		return fmt.Errorf("offline")
+	}
+
+	ts.sent = append(ts.sent, m)
+	return nil
+}
+
+func (ts *testSender) count() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return len(ts.sent)
+}
+
+func TestScheduleListCancel(t *testing.T) {
+	ctx := context.Background()
+	s := New(ds_sync.MutexWrap(datastore.NewMapDatastore()), nil)
+
+	now := time.Now()
+	later, err := s.Schedule(ctx, "group", []byte("later"), now.Add(time.Hour))
+	require.NoError(t, err)
+	sooner, err := s.Schedule(ctx, "group", []byte("sooner"), now.Add(time.Minute))
+	require.NoError(t, err)
+
+	messages, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	require.Equal(t, sooner.ID, messages[0].ID)
+	require.Equal(t, later.ID, messages[1].ID)
+
+	require.NoError(t, s.Cancel(ctx, later.ID))
+	require.True(t, errcode.Is(s.Cancel(ctx, later.ID), errcode.ErrNotFound))
+
+	messages, err = s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	_, err = s.Schedule(ctx, "", nil, now)
+	require.Error(t, err)
+}
+
+func TestRunDispatchesMissedMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := ds_sync.MutexWrap(datastore.NewMapDatastore())
+
+	// scheduled before a restart
+	missed, err := New(ds, nil).Schedule(ctx, "group", []byte("missed"), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	s := New(ds, nil)
+	sender := &testSender{}
+	go s.Run(ctx, sender.send)
+
+	require.Eventually(t, func() bool { return sender.count() == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, missed.ID, sender.sent[0].ID)
+
+	_, err = s.Schedule(ctx, "group", []byte("soon"), time.Now().Add(50*time.Millisecond))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return sender.count() == 2 }, time.Second, 10*time.Millisecond)
+
+	messages, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, messages)
+}
+
+func TestRunRetriesFailedMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := clock.NewMock()
+	now := mock.Now()
+	s := New(ds_sync.MutexWrap(datastore.NewMapDatastore()), nil)
+	s.SetClock(mock)
+
+	m, err := s.Schedule(ctx, "group", []byte("msg"), now)
+	require.NoError(t, err)
+
+	sender := &testSender{fail: true}
+	next, err := s.dispatchDue(ctx, sender.send)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(retryMinDelay), next)
+
+	messages, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, m.ID, messages[0].ID)
+	require.Equal(t, 1, messages[0].Attempts)
+	require.Equal(t, "offline", messages[0].LastError)
+
+	// not due before the retry delay
+	sender.fail = false
+	_, err = s.dispatchDue(ctx, sender.send)
+	require.NoError(t, err)
+	require.Equal(t, 0, sender.count())
+
+	mock.Add(retryMinDelay)
+	next, err = s.dispatchDue(ctx, sender.send)
+	require.NoError(t, err)
+	require.True(t, next.IsZero())
+	require.Equal(t, 1, sender.count())
+}
+
+func TestRetryNow(t *testing.T) {
+	ctx := context.Background()
+
+	mock := clock.NewMock()
+	now := mock.Now()
+	s := New(ds_sync.MutexWrap(datastore.NewMapDatastore()), nil)
+	s.SetClock(mock)
+
+	_, err := s.Schedule(ctx, "group", []byte("failed"), now)
+	require.NoError(t, err)
+	later, err := s.Schedule(ctx, "group", []byte("later"), now.Add(time.Hour))
+	require.NoError(t, err)
+
+	sender := &testSender{fail: true}
+	_, err = s.dispatchDue(ctx, sender.send)
+	require.NoError(t, err)
+
+	// the failed message is due again, the one scheduled later is not
+	require.NoError(t, s.RetryNow(ctx))
+	sender.fail = false
+	next, err := s.dispatchDue(ctx, sender.send)
+	require.NoError(t, err)
+	require.Equal(t, 1, sender.count())
+	require.Equal(t, []byte("failed"), sender.sent[0].Payload)
+	require.Equal(t, 1, sender.sent[0].Attempts)
+	require.True(t, later.SendAt.Equal(next))
+}
+
+func TestRunWithMockClock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := clock.NewMock()
+	s := New(ds_sync.MutexWrap(datastore.NewMapDatastore()), nil)
+	s.SetClock(mock)
+
+	_, err := s.Schedule(ctx, "group", []byte("tomorrow"), mock.Now().Add(24*time.Hour))
+	require.NoError(t, err)
+
+	sender := &testSender{}
+	go s.Run(ctx, sender.send)
+
+	// nothing is sent before the clock reaches the due date
+	mock.Add(23 * time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 0, sender.count())
+
+	require.Eventually(t, func() bool {
+		mock.Add(time.Minute)
+		return sender.count() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,229 @@
+// Package messagesequencer tracks the message counters of the devices of a
+// group to detect the messages which are not replicated yet, and to order
+// late arrivals consistently with their counter.
+//
+// Each device numbers its messages in a group, a missing counter between two
+// received ones is a message still pending. Counters before the first one
+// received are unknown: the device may have sent them before we joined.
+package messagesequencer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Namespace is the key prefix used in the account root datastore.
+const Namespace = "message-sequences"
+
+// maxSpans bounds the state of a device, the oldest gaps are forgotten past
+// it.
+const maxSpans = 256
+
+// span is a range of consecutive counters received from a device, with the
+// ordering dates of its first and last messages.
+type span struct {
+	From     uint64 `json:"from"`
+	To       uint64 `json:"to"`
+	FromDate int64  `json:"from_date"`
+	ToDate   int64  `json:"to_date"`
+}
+
+type deviceSequence struct {
+	Spans []span `json:"spans"`
+}
+
+func (d *deviceSequence) pending() uint64 {
+	pending := uint64(0)
+	for i := 1; i < len(d.Spans); i++ {
+		pending += d.Spans[i].From - d.Spans[i-1].To - 1
+	}
+	return pending
+}
+
+// observe records counter and returns the date to order its message with,
+// ok is false for a counter already received.
+func (d *deviceSequence) observe(counter uint64, sentDate int64) (date int64, ok bool) {
+	// index of the first span ending at or after counter
+	i := sort.Search(len(d.Spans), func(i int) bool { return d.Spans[i].To >= counter })
+	if i < len(d.Spans) && d.Spans[i].From <= counter {
+		return sentDate, false
+	}
+
+	// a message is never ordered before an earlier counter of its device, or
+	// after a later one, whatever the clock of the device said
+	date = sentDate
+	if i > 0 && date < d.Spans[i-1].ToDate {
+		date = d.Spans[i-1].ToDate
+	}
+	if i < len(d.Spans) && date > d.Spans[i].FromDate {
+		date = d.Spans[i].FromDate
+	}
+
+	extendsPrev := i > 0 && d.Spans[i-1].To+1 == counter
+	extendsNext := i < len(d.Spans) && d.Spans[i].From == counter+1
+
+	switch {
+	case extendsPrev && extendsNext:
+		d.Spans[i-1].To, d.Spans[i-1].ToDate = d.Spans[i].To, d.Spans[i].ToDate
+		d.Spans = append(d.Spans[:i], d.Spans[i+1:]...)
+	case extendsPrev:
+		d.Spans[i-1].To, d.Spans[i-1].ToDate = counter, date
+	case extendsNext:
+		d.Spans[i].From, d.Spans[i].FromDate = counter, date
+	default:
+		d.Spans = append(d.Spans, span{})
+		copy(d.Spans[i+1:], d.Spans[i:])
+		d.Spans[i] = span{From: counter, To: counter, FromDate: date, ToDate: date}
+	}
+
+	if len(d.Spans) > maxSpans {
+		d.Spans[1].From, d.Spans[1].FromDate = d.Spans[0].From, d.Spans[0].FromDate
+		d.Spans = d.Spans[1:]
+	}
+
+	return date, true
+}
+
+// DeviceStatus is the sequence of the messages received from a device.
+type DeviceStatus struct {
+	DevicePK string `json:"device_pk"`
+	// First and Last are the lowest and highest counters received.
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+	// Pending is the number of messages between First and Last not
+	// received yet.
+	Pending uint64 `json:"pending"`
+}
+
+// Status is the sequence of the messages of a group.
+type Status struct {
+	GroupPK string `json:"group_pk"`
+	// Pending is the number of messages sent in the group and not received
+	// yet, for all the devices.
+	Pending uint64         `json:"pending"`
+	Devices []DeviceStatus `json:"devices,omitempty"`
+}
+
+// Sequencer stores the sequence of each device under `/<group>/<device>`.
+// A nil Sequencer is valid and keeps the dates unchanged.
+type Sequencer struct {
+	ds      datastore.Datastore
+	mu      sync.Mutex
+	devices map[string]*deviceSequence
+}
+
+func New(ds datastore.Datastore) *Sequencer {
+	return &Sequencer{
+		ds:      namespace.Wrap(ds, datastore.NewKey(Namespace)),
+		devices: map[string]*deviceSequence{},
+	}
+}
+
+func sequenceKey(groupPK, devicePK string) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{groupPK, devicePK})
+}
+
+// Observe records the counter of a message of devicePK in groupPK, and
+// returns the date to order the message with: sentDate, moved between the
+// dates of the surrounding counters if the clock of the device disagrees.
+func (s *Sequencer) Observe(ctx context.Context, groupPK, devicePK string, counter uint64, sentDate int64) (int64, error) {
+	if s == nil {
+		return sentDate, nil
+	}
+
+	if groupPK == "" || devicePK == "" {
+		return sentDate, errcode.ErrMissingInput.Wrap(fmt.Errorf("a group and a device are required"))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sequenceKey(groupPK, devicePK)
+	seq, ok := s.devices[key.String()]
+	if !ok {
+		seq = &deviceSequence{}
+		raw, err := s.ds.Get(ctx, key)
+		switch err {
+		case nil:
+			if err := json.Unmarshal(raw, seq); err != nil {
+				return sentDate, errcode.ErrDeserialization.Wrap(err)
+			}
+		case datastore.ErrNotFound:
+		default:
+			return sentDate, errcode.ErrDBRead.Wrap(err)
+		}
+		s.devices[key.String()] = seq
+	}
+
+	date, changed := seq.observe(counter, sentDate)
+	if !changed {
+		return date, nil
+	}
+
+	raw, err := json.Marshal(seq)
+	if err != nil {
+		return date, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := s.ds.Put(ctx, key, raw); err != nil {
+		return date, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return date, nil
+}
+
+// Status returns the sequences of the devices of a group.
+func (s *Sequencer) Status(ctx context.Context, groupPK string) (Status, error) {
+	status := Status{GroupPK: groupPK}
+	if s == nil {
+		return status, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := datastore.NewKey(groupPK)
+	results, err := s.ds.Query(ctx, query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return status, errcode.ErrDBRead.Wrap(err)
+	}
+	defer results.Close()
+
+	for res := range results.Next() {
+		if res.Error != nil {
+			return status, errcode.ErrDBRead.Wrap(res.Error)
+		}
+
+		seq := deviceSequence{}
+		if err := json.Unmarshal(res.Value, &seq); err != nil {
+			return status, errcode.ErrDeserialization.Wrap(err)
+		}
+
+		if len(seq.Spans) == 0 {
+			continue
+		}
+
+		device := DeviceStatus{
+			DevicePK: strings.TrimPrefix(res.Key, prefix.String()+"/"),
+			First:    seq.Spans[0].From,
+			Last:     seq.Spans[len(seq.Spans)-1].To,
+			Pending:  seq.pending(),
+		}
+		status.Pending += device.Pending
+		status.Devices = append(status.Devices, device)
+	}
+
+	sort.Slice(status.Devices, func(i, j int) bool { return status.Devices[i].DevicePK < status.Devices[j].DevicePK })
+
+	return status, nil
+}
@@ -0,0 +1,88 @@
+package messagesequencer
+
+import (
+	"context"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequencerGaps(t *testing.T) {
+	ctx := context.Background()
+	ds := ds_sync.MutexWrap(datastore.NewMapDatastore())
+	s := New(ds)
+
+	for _, counter := range []uint64{3, 4, 7, 10} {
+		_, err := s.Observe(ctx, "group", "alice", counter, int64(counter*100))
+		require.NoError(t, err)
+	}
+	_, err := s.Observe(ctx, "group", "bob", 1, 100)
+	require.NoError(t, err)
+	_, err = s.Observe(ctx, "other", "alice", 1, 100)
+	require.NoError(t, err)
+
+	status, err := s.Status(ctx, "group")
+	require.NoError(t, err)
+	require.Equal(t, Status{
+		GroupPK: "group",
+		Pending: 4,
+		Devices: []DeviceStatus{
+			{DevicePK: "alice", First: 3, Last: 10, Pending: 4},
+			{DevicePK: "bob", First: 1, Last: 1},
+		},
+	}, status)
+
+	// late arrivals fill the gaps, duplicates are ignored
+	for _, counter := range []uint64{5, 6, 6, 8} {
+		_, err := s.Observe(ctx, "group", "alice", counter, int64(counter*100))
+		require.NoError(t, err)
+	}
+
+	// the state survives a restart
+	status, err = New(ds).Status(ctx, "group")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), status.Pending)
+	require.Equal(t, DeviceStatus{DevicePK: "alice", First: 3, Last: 10, Pending: 1}, status.Devices[0])
+}
+
+func TestSequencerOrdering(t *testing.T) {
+	ctx := context.Background()
+	s := New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	observe := func(counter uint64, sentDate int64) int64 {
+		date, err := s.Observe(ctx, "group", "alice", counter, sentDate)
+		require.NoError(t, err)
+		return date
+	}
+
+	require.Equal(t, int64(1000), observe(1, 1000))
+	require.Equal(t, int64(5000), observe(5, 5000))
+
+	// the clock of the device went back, the message stays after counter 1
+	require.Equal(t, int64(1000), observe(2, 500))
+	// and before counter 5
+	require.Equal(t, int64(5000), observe(4, 9000))
+	require.Equal(t, int64(3000), observe(3, 3000))
+
+	// later messages follow the last one
+	require.Equal(t, int64(5000), observe(6, 4000))
+	require.Equal(t, int64(7000), observe(7, 7000))
+
+	var nilSequencer *Sequencer
+	date, err := nilSequencer.Observe(ctx, "group", "alice", 1, 42)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), date)
+}
+
+func TestSequencerMaxSpans(t *testing.T) {
+	seq := deviceSequence{}
+	for i := uint64(0); i <= maxSpans; i++ {
+		seq.observe(i*2, int64(i))
+	}
+
+	require.Len(t, seq.Spans, maxSpans)
+	require.Equal(t, uint64(0), seq.Spans[0].From)
+	require.Equal(t, uint64(maxSpans-1), seq.pending())
+}
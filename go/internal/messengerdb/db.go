@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	ipfscid "github.com/ipfs/go-cid"
 	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
 	"go.uber.org/multierr"
@@ -32,6 +33,14 @@ type DBWrapper struct {
 	inTx         bool
 	postaction   func(d *DBWrapper) error
 	muPostaction sync.Mutex
+	hooks        *dbHooks
+	clock        clock.Clock
+}
+
+// dbHooks are shared by a wrapper and the ones derived from it.
+type dbHooks struct {
+	interactionsDeleted     func(cids []string)
+	interactionAcknowledged func(cid string, memberPK string)
 }
 
 func noopReplayer(_ *DBWrapper) error { return nil }
@@ -95,9 +104,36 @@ func NewDBWrapper(db *gorm.DB, log *zap.Logger) *DBWrapper {
 		disableFTS: !fts5Enabled,
 		ctx:        context.TODO(),
 		inTx:       false,
+		hooks:      &dbHooks{},
+		clock:      clock.New(),
 	}
 }
 
+// SetClock replaces the clock dating the records created by the db, e.g.
+// with a mock in tests. The wrappers derived afterwards share it.
+func (d *DBWrapper) SetClock(c clock.Clock) {
+	d.clock = c
+}
+
+// Now returns the current time of the clock of the db, for the records
+// dated by its callers.
+func (d *DBWrapper) Now() time.Time {
+	return d.clock.Now()
+}
+
+// OnInteractionsDeleted registers a function called with the CIDs of the
+// interactions removed from the db, once the deletion is committed.
+func (d *DBWrapper) OnInteractionsDeleted(f func(cids []string)) {
+	d.hooks.interactionsDeleted = f
+}
+
+// OnInteractionAcknowledged registers a function called with the CID of an
+// interaction and the member acknowledging it, for each acknowledgement
+// received and not only the first one, once it is committed.
+func (d *DBWrapper) OnInteractionAcknowledged(f func(cid string, memberPK string)) {
+	d.hooks.interactionAcknowledged = f
+}
+
 func (d *DBWrapper) DisableFTS() *DBWrapper {
 	return &DBWrapper{
 		db:         d.db,
@@ -105,6 +141,8 @@ func (d *DBWrapper) DisableFTS() *DBWrapper {
 		disableFTS: true,
 		ctx:        d.ctx,
 		inTx:       d.inTx,
+		hooks:      d.hooks,
+		clock:      d.clock,
 	}
 }
 
@@ -225,7 +263,7 @@ func (d *DBWrapper) TX(ctx context.Context, txFunc func(*DBWrapper) error) (err
 	var txwrapper *DBWrapper
 	// Use this to propagate scope, ie. opened account
 	if err := d.db.Transaction(func(tx *gorm.DB) error {
-		txwrapper = &DBWrapper{ctx: ctx, db: tx, log: d.log, disableFTS: d.disableFTS, inTx: true}
+		txwrapper = &DBWrapper{ctx: ctx, db: tx, log: d.log, disableFTS: d.disableFTS, inTx: true, hooks: d.hooks, clock: d.clock}
 		if err := txFunc(txwrapper); err != nil {
 			return err
 		}
@@ -257,7 +295,7 @@ func (d *DBWrapper) AddConversationForContact(groupPK, ownMemberPK, ownDevicePK,
 		Type:                 messengertypes.Conversation_ContactType,
 		DisplayName:          "", // empty on account conversations
 		Link:                 "", // empty on account conversations
-		CreatedDate:          messengerutil.TimestampMs(time.Now()),
+		CreatedDate:          messengerutil.TimestampMs(d.clock.Now()),
 		LocalDevicePublicKey: ownDevicePK,
 		LocalMemberPublicKey: ownMemberPK,
 	}
@@ -311,7 +349,7 @@ func (d *DBWrapper) AddConversation(groupPK, ownMemberPK, ownDevicePK string) (*
 	conversation := &messengertypes.Conversation{
 		PublicKey:            groupPK,
 		Type:                 messengertypes.Conversation_MultiMemberType,
-		CreatedDate:          messengerutil.TimestampMs(time.Now()),
+		CreatedDate:          messengerutil.TimestampMs(d.clock.Now()),
 		LocalDevicePublicKey: ownDevicePK,
 		LocalMemberPublicKey: ownMemberPK,
 	}
@@ -615,7 +653,26 @@ func (d *DBWrapper) GetAllInteractions() ([]*messengertypes.Interaction, error)
 	return interactions, d.db.Preload(clause.Associations).Find(&interactions).Error
 }
 
+// filterSystemEvents selects the system events among the interactions of
+// query.
+func filterSystemEvents(query *gorm.DB, f messengertypes.SystemEvents_Filter) *gorm.DB {
+	switch f {
+	case messengertypes.SystemEvents_Excluded:
+		return query.Where("interactions.type <> ?", messengertypes.AppMessage_TypeSystemEvent)
+	case messengertypes.SystemEvents_Only:
+		return query.Where("interactions.type = ?", messengertypes.AppMessage_TypeSystemEvent)
+	default:
+		return query
+	}
+}
+
 func (d *DBWrapper) GetPaginatedInteractions(opts *messengertypes.PaginatedInteractionsOptions) ([]*messengertypes.Interaction, error) {
+	return d.GetFilteredPaginatedInteractions(opts, messengertypes.SystemEvents_Included)
+}
+
+// GetFilteredPaginatedInteractions is GetPaginatedInteractions with a filter
+// on the system events.
+func (d *DBWrapper) GetFilteredPaginatedInteractions(opts *messengertypes.PaginatedInteractionsOptions, systemEvents messengertypes.SystemEvents_Filter) ([]*messengertypes.Interaction, error) {
 	if opts == nil {
 		opts = &messengertypes.PaginatedInteractionsOptions{}
 	}
@@ -667,7 +724,7 @@ func (d *DBWrapper) GetPaginatedInteractions(opts *messengertypes.PaginatedInter
 			}
 		}
 
-		query = query.Limit(int(opts.Amount))
+		query = filterSystemEvents(query, systemEvents).Limit(int(opts.Amount))
 
 		if err := query.
 			Order(order).
@@ -694,6 +751,132 @@ func (d *DBWrapper) GetPaginatedInteractions(opts *messengertypes.PaginatedInter
 	return interactions, nil
 }
 
+// GetInteractionsAfter returns up to amount interactions of the conversation
+// stored after the one with the cid cursor, in the order they were stored,
+// late messages included. An empty cursor starts from the first interaction.
+func (d *DBWrapper) GetInteractionsAfter(conversationPK, cursor string, amount int, systemEvents messengertypes.SystemEvents_Filter) ([]*messengertypes.Interaction, error) {
+	if conversationPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	if amount <= 0 {
+		amount = 5
+	}
+
+	// the rowid follows the insertion order, unlike the sent date
+	after := int64(0)
+	if cursor != "" {
+		var rowids []int64
+		if err := d.db.
+			Model(&messengertypes.Interaction{}).
+			Where(&messengertypes.Interaction{CID: cursor, ConversationPublicKey: conversationPK}).
+			Pluck("rowid", &rowids).
+			Error; err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+
+		if len(rowids) == 0 {
+			return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown interaction %s in the conversation", cursor))
+		}
+		after = rowids[0]
+	}
+
+	interactions := []*messengertypes.Interaction(nil)
+	if err := filterSystemEvents(d.db, systemEvents).
+		Preload(clause.Associations).
+		Where(&messengertypes.Interaction{ConversationPublicKey: conversationPK}).
+		Where("interactions.rowid > ?", after).
+		Order("interactions.rowid").
+		Limit(amount).
+		Find(&interactions).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(fmt.Errorf("unable to fetch interactions: %w", err))
+	}
+
+	return interactions, nil
+}
+
+// ConversationStats summarizes the interactions stored for a conversation.
+type ConversationStats struct {
+	// Interactions counts all the stored interactions, Messages only the
+	// user messages.
+	Interactions uint64 `json:"interactions"`
+	Messages     uint64 `json:"messages"`
+	// PayloadSize is the size of the payloads of the interactions, in bytes.
+	PayloadSize uint64 `json:"payload_size"`
+	// FirstMessageDate and LastMessageDate are the sent dates of the oldest
+	// and the newest user messages, in milliseconds, 0 without messages.
+	FirstMessageDate int64 `json:"first_message_date,omitempty"`
+	LastMessageDate  int64 `json:"last_message_date,omitempty"`
+	// MemberMessages counts the user messages by member public key.
+	MemberMessages map[string]uint64 `json:"member_messages,omitempty"`
+}
+
+func (d *DBWrapper) GetConversationStats(conversationPK string) (*ConversationStats, error) {
+	if conversationPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	totals := struct {
+		Count uint64
+		Size  uint64
+	}{}
+	if err := d.db.Model(&messengertypes.Interaction{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(LENGTH(payload)), 0) AS size").
+		Where("conversation_public_key = ?", conversationPK).
+		Scan(&totals).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	members := []struct {
+		MemberPublicKey string
+		Count           uint64
+		First           int64
+		Last            int64
+	}(nil)
+	if err := d.db.Model(&messengertypes.Interaction{}).
+		Select("member_public_key, COUNT(*) AS count, MIN(sent_date) AS first, MAX(sent_date) AS last").
+		Where("conversation_public_key = ? AND type = ?", conversationPK, messengertypes.AppMessage_TypeUserMessage).
+		Group("member_public_key").
+		Scan(&members).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	stats := &ConversationStats{
+		Interactions:   totals.Count,
+		PayloadSize:    totals.Size,
+		MemberMessages: map[string]uint64{},
+	}
+	for _, member := range members {
+		stats.Messages += member.Count
+		stats.MemberMessages[member.MemberPublicKey] = member.Count
+
+		if stats.FirstMessageDate == 0 || member.First < stats.FirstMessageDate {
+			stats.FirstMessageDate = member.First
+		}
+		if member.Last > stats.LastMessageDate {
+			stats.LastMessageDate = member.Last
+		}
+	}
+
+	return stats, nil
+}
+
+func (d *DBWrapper) GetInteractionCIDsForConversation(conversationPK string) ([]string, error) {
+	if conversationPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	var cids []string
+	if err := d.db.Model(&messengertypes.Interaction{}).
+		Where("conversation_public_key = ?", conversationPK).
+		Pluck("cid", &cids).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return cids, nil
+}
+
 func (d *DBWrapper) GetInteractionByCID(cid string) (*messengertypes.Interaction, error) {
 	if cid == "" {
 		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
@@ -719,7 +902,7 @@ func (d *DBWrapper) AddContactRequestOutgoingEnqueued(contactPK, displayName, co
 		PublicKey:             contactPK,
 		DisplayName:           displayName,
 		State:                 messengertypes.Contact_OutgoingRequestEnqueued,
-		CreatedDate:           messengerutil.TimestampMs(time.Now()),
+		CreatedDate:           messengerutil.TimestampMs(d.clock.Now()),
 		ConversationPublicKey: convPK,
 	}
 
@@ -745,7 +928,7 @@ func (d *DBWrapper) AddContactRequestOutgoingSent(contactPK string) (*messengert
 			State:     messengertypes.Contact_OutgoingRequestEnqueued,
 		}).
 		Updates(&messengertypes.Contact{
-			SentDate: messengerutil.TimestampMs(time.Now()),
+			SentDate: messengerutil.TimestampMs(d.clock.Now()),
 			State:    messengertypes.Contact_OutgoingRequestSent,
 		}); res.Error != nil {
 		return nil, res.Error
@@ -778,7 +961,7 @@ func (d *DBWrapper) AddContactRequestIncomingReceived(contactPK, displayName, gr
 		DisplayName:           displayName,
 		PublicKey:             contactPK,
 		State:                 messengertypes.Contact_IncomingRequest,
-		CreatedDate:           messengerutil.TimestampMs(time.Now()),
+		CreatedDate:           messengerutil.TimestampMs(d.clock.Now()),
 		ConversationPublicKey: groupPk,
 	}
 	if err := d.db.
@@ -825,6 +1008,36 @@ func (d *DBWrapper) AddContactRequestIncomingAccepted(contactPK, groupPK string)
 	return contact, nil
 }
 
+// DeleteOutgoingContactRequest removes a contact whose request was not
+// answered yet, with its conversation. It returns the deleted contact.
+func (d *DBWrapper) DeleteOutgoingContactRequest(contactPK string) (*messengertypes.Contact, error) {
+	if contactPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	contact, err := d.GetContactByPK(contactPK)
+	if err != nil {
+		return nil, err
+	}
+
+	if contact.State != messengertypes.Contact_OutgoingRequestEnqueued && contact.State != messengertypes.Contact_OutgoingRequestSent {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("no outgoing contact request for %s", contactPK))
+	}
+
+	if err := d.db.Delete(&messengertypes.Contact{}, &messengertypes.Contact{PublicKey: contactPK}).Error; err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	if contact.ConversationPublicKey != "" {
+		if err := d.db.Delete(&messengertypes.Conversation{}, &messengertypes.Conversation{PublicKey: contact.ConversationPublicKey}).Error; err != nil {
+			return nil, errcode.ErrDBWrite.Wrap(err)
+		}
+	}
+
+	d.logStep("Removed contact request from db", tyber.WithJSONDetail("Contact", contact))
+	return contact, nil
+}
+
 func (d *DBWrapper) MarkInteractionAsAcknowledged(cid string) (*messengertypes.Interaction, error) {
 	if cid == "" {
 		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
@@ -859,6 +1072,26 @@ func (d *DBWrapper) MarkInteractionAsAcknowledged(cid string) (*messengertypes.I
 	return finalInte, nil
 }
 
+// InteractionAcknowledgedBy runs the hook registered with
+// OnInteractionAcknowledged, MarkInteractionAsAcknowledged only records the
+// first acknowledgement.
+func (d *DBWrapper) InteractionAcknowledgedBy(cid string, memberPK string) error {
+	if d.hooks == nil || d.hooks.interactionAcknowledged == nil || memberPK == "" {
+		return nil
+	}
+
+	hook := d.hooks.interactionAcknowledged
+	if d.inTx {
+		return d.PostAction(func(*DBWrapper) error {
+			hook(cid, memberPK)
+			return nil
+		})
+	}
+
+	hook(cid, memberPK)
+	return nil
+}
+
 func (d *DBWrapper) GetAcknowledgementsCIDsForInteraction(cid string) ([]string, error) {
 	if cid == "" {
 		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
@@ -876,6 +1109,91 @@ func (d *DBWrapper) GetAcknowledgementsCIDsForInteraction(cid string) ([]string,
 	return cids, nil
 }
 
+// GetUserMessagesTargeting returns the user messages of a conversation
+// targeting an interaction, e.g. the votes of a poll, by sent date.
+func (d *DBWrapper) GetUserMessagesTargeting(conversationPK, cid string) ([]*messengertypes.Interaction, error) {
+	if conversationPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	if cid == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	interactions := []*messengertypes.Interaction(nil)
+	if err := d.db.
+		Where(&messengertypes.Interaction{
+			Type:                  messengertypes.AppMessage_TypeUserMessage,
+			ConversationPublicKey: conversationPK,
+			TargetCID:             cid,
+		}).
+		Order("sent_date, rowid").
+		Find(&interactions).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return interactions, nil
+}
+
+// GetOldestUserMessages returns up to limit user messages sent before the
+// given date, in milliseconds, the oldest first.
+func (d *DBWrapper) GetOldestUserMessages(before int64, limit int) ([]*messengertypes.Interaction, error) {
+	if limit <= 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the limit must be positive, got %d", limit))
+	}
+
+	interactions := []*messengertypes.Interaction(nil)
+	if err := d.db.
+		Where("type = ? AND sent_date < ?", messengertypes.AppMessage_TypeUserMessage, before).
+		Order("sent_date, cid").
+		Limit(limit).
+		Find(&interactions).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return interactions, nil
+}
+
+// GetUnacknowledgedUserMessages returns up to limit user messages of the
+// account in a conversation which no other member acknowledged yet, the
+// latest first.
+func (d *DBWrapper) GetUnacknowledgedUserMessages(conversationPK string, limit int) ([]*messengertypes.Interaction, error) {
+	if conversationPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+	if limit <= 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the limit must be positive, got %d", limit))
+	}
+
+	interactions := []*messengertypes.Interaction(nil)
+	if err := d.db.
+		Where("conversation_public_key = ? AND type = ? AND is_mine = ? AND acknowledged = ?", conversationPK, messengertypes.AppMessage_TypeUserMessage, true, false).
+		Order("sent_date DESC, cid").
+		Limit(limit).
+		Find(&interactions).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return interactions, nil
+}
+
+// Vacuum rebuilds the database file, giving back to the file system the
+// space freed by the deleted rows.
+func (d *DBWrapper) Vacuum() error {
+	if d.inTx {
+		return errcode.ErrDBWrite.Wrap(fmt.Errorf("unable to vacuum the database within a transaction"))
+	}
+
+	if err := d.db.Exec("VACUUM").Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
 func (d *DBWrapper) DeleteInteractions(cids []string) error {
 	if len(cids) == 0 {
 		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a list of cids is required"))
@@ -887,6 +1205,19 @@ func (d *DBWrapper) DeleteInteractions(cids []string) error {
 	}
 
 	d.logStep(fmt.Sprintf("Removed %d interactions from db", db.RowsAffected), tyber.WithJSONDetail("CIDs", cids))
+
+	if d.hooks != nil && d.hooks.interactionsDeleted != nil {
+		hook := d.hooks.interactionsDeleted
+		if d.inTx {
+			return d.PostAction(func(*DBWrapper) error {
+				hook(cids)
+				return nil
+			})
+		}
+
+		hook(cids)
+	}
+
 	return nil
 }
 
@@ -1063,6 +1394,44 @@ func (d *DBWrapper) AddInteraction(rawInte messengertypes.Interaction) (*messeng
 	return i, isNew, nil
 }
 
+// AddSystemEvent stores the interaction of a system event, it returns false
+// if the event was already stored.
+func (d *DBWrapper) AddSystemEvent(conversationPK string, event *messengertypes.SystemEvent, sentDate int64) (*messengertypes.Interaction, bool, error) {
+	if conversationPK == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	if event == nil || event.MemberPublicKey == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a member public key is required"))
+	}
+
+	payload, err := event.Marshal()
+	if err != nil {
+		return nil, false, err
+	}
+
+	member, err := d.GetMemberByPK(event.MemberPublicKey, conversationPK)
+	isMine := err == nil && member.GetIsMe()
+
+	i, isNew, err := d.AddInteraction(messengertypes.Interaction{
+		CID:                   messengertypes.SystemEventCID(conversationPK, event),
+		Type:                  messengertypes.AppMessage_TypeSystemEvent,
+		MemberPublicKey:       event.MemberPublicKey,
+		DevicePublicKey:       event.DevicePublicKey,
+		ConversationPublicKey: conversationPK,
+		Payload:               payload,
+		IsMine:                isMine,
+		SentDate:              sentDate,
+		// nothing to acknowledge, it is not sent
+		Acknowledged: true,
+	})
+	if err != nil {
+		return nil, false, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return i, isNew, nil
+}
+
 func (d *DBWrapper) AttributeBacklogInteractions(devicePK, groupPK, memberPK string) ([]*messengertypes.Interaction, error) {
 	if devicePK == "" {
 		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("missing device public key"))
@@ -1237,6 +1606,35 @@ func (d *DBWrapper) SetConversationIsOpenStatus(conversationPK string, status bo
 	return conversation, true, err
 }
 
+// MarkConversationAsRead resets the unread counter of a conversation, it
+// returns false when it had no unread interactions.
+func (d *DBWrapper) MarkConversationAsRead(conversationPK string) (*messengertypes.Conversation, bool, error) {
+	if conversationPK == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	conversation, err := d.GetConversationByPK(conversationPK)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if conversation.UnreadCount == 0 {
+		return conversation, false, nil
+	}
+
+	if err := d.db.
+		Model(&messengertypes.Conversation{}).
+		Where(&messengertypes.Conversation{PublicKey: conversationPK}).
+		Update("unread_count", 0).
+		Error; err != nil {
+		return nil, false, err
+	}
+	conversation.UnreadCount = 0
+
+	d.logStep("Marked conversation as read in db", tyber.WithJSONDetail("Conversation", conversation))
+	return conversation, true, nil
+}
+
 func (d *DBWrapper) IsConversationOpened(conversationPK string) (bool, error) {
 	if conversationPK == "" {
 		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
@@ -1434,6 +1832,17 @@ func (d *DBWrapper) SaveConversationReplicationInfo(c messengertypes.Conversatio
 	return nil
 }
 
+// GetConversationsReplicationInfo returns the replication servers of all the
+// conversations.
+func (d *DBWrapper) GetConversationsReplicationInfo() ([]*messengertypes.ConversationReplicationInfo, error) {
+	infos := []*messengertypes.ConversationReplicationInfo(nil)
+	if err := d.db.Order("conversation_public_key, cid").Find(&infos).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return infos, nil
+}
+
 func (d *DBWrapper) InteractionIndexText(interactionCID string, text string) error {
 	if d.disableFTS {
 		d.log.Info("full text search is not enabled")
@@ -1710,14 +2119,14 @@ func (d *DBWrapper) GetMuteStatusForConversation(key string) (accountMuted bool,
 		return false, false, errcode.ErrDBRead.Wrap(err)
 	}
 
-	accountMuted = mutedUntil > time.Now().UnixNano()/1000
+	accountMuted = mutedUntil > d.clock.Now().UnixNano()/1000
 
 	err = d.db.Model(&messengertypes.Conversation{}).Where("public_key = ?", key).Pluck("muted_until", &mutedUntil).Error
 	if err != nil {
 		return false, false, errcode.ErrDBRead.Wrap(err)
 	}
 
-	conversationMuted = mutedUntil > time.Now().UnixNano()/1000
+	conversationMuted = mutedUntil > d.clock.Now().UnixNano()/1000
 
 	return accountMuted, conversationMuted, nil
 }
@@ -1796,7 +2205,7 @@ func (d *DBWrapper) SaveAccountVerifiedCredential(ev *protocoltypes.AccountVerif
 }
 
 func (d *DBWrapper) GetVerifiedCredentials(identifier string, issuer string) ([]*messengertypes.AccountVerifiedCredential, error) {
-	now := time.Now()
+	now := d.clock.Now()
 
 	result := []*messengertypes.AccountVerifiedCredential(nil)
 	qs := d.db.Model(&messengertypes.AccountVerifiedCredential{})
@@ -2038,7 +2447,8 @@ func (d *DBWrapper) SavePushServer(accountPK string, message *messengertypes.App
 	return nil
 }
 
-// SavePushMemberToken saves the push member token in the database for the given ConversationPK.
+// SavePushMemberToken saves the push member token in the database for the given ConversationPK,
+// it replaces the previous tokens of the device for the same push server.
 func (d *DBWrapper) SavePushMemberToken(tokenID, conversationPK string, message *messengertypes.AppMessage_PushSetMemberToken) error {
 	if tokenID == "" {
 		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("missing tokenID"))
@@ -2086,6 +2496,18 @@ func (d *DBWrapper) SavePushMemberToken(tokenID, conversationPK string, message
 		return errcode.ErrDBWrite.Wrap(err)
 	}
 
+	// a device shares its token again when it mutes or unmutes the
+	// conversation, the new token replaces the previous ones for the same
+	// server
+	if res.RowsAffected > 0 {
+		if err := d.db.
+			Where("conversation_public_key = ? AND device_pk = ? AND server_key = ? AND token_id != ?", conversationPK, message.MemberToken.DevicePK, message.MemberToken.Server.Key, tokenID).
+			Delete(&messengertypes.PushMemberToken{}).
+			Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+	}
+
 	d.logStep("Added push member token to db", tyber.WithJSONDetail("conversationPublicKey", conversationPK), tyber.WithJSONDetail("pushMemberToken", message.MemberToken))
 	return nil
 }
@@ -7,11 +7,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 	"golang.org/x/net/context"
 	"gorm.io/gorm"
 
+	"berty.tech/berty/v2/go/internal/accountutils"
 	sqlite "berty.tech/berty/v2/go/internal/gorm-sqlcipher"
 	"berty.tech/berty/v2/go/internal/messengerutil"
 	"berty.tech/berty/v2/go/pkg/errcode"
@@ -331,6 +334,66 @@ func Test_dbWrapper_addContactRequestOutgoingSent(t *testing.T) {
 	require.Error(t, err)
 }
 
+func Test_dbWrapper_clock(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	mock := clock.NewMock()
+	mock.Set(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+	db.SetClock(mock)
+
+	contact, err := db.AddContactRequestOutgoingEnqueued("contactPK1", "displayName1", "convPK1")
+	require.NoError(t, err)
+	require.Equal(t, messengerutil.TimestampMs(mock.Now()), contact.CreatedDate)
+
+	// shared by the wrappers of the transactions
+	mock.Add(time.Minute)
+	require.NoError(t, db.TX(context.Background(), func(tx *DBWrapper) error {
+		contact, err = tx.AddContactRequestOutgoingSent("contactPK1")
+		return err
+	}))
+	require.Equal(t, messengerutil.TimestampMs(mock.Now()), contact.SentDate)
+}
+
+func Test_dbWrapper_deleteOutgoingContactRequest(t *testing.T) {
+	var (
+		contactPK      = "contactPK1"
+		displayName    = "displayName1"
+		convPK         = "convPK1"
+		db, _, dispose = GetInMemoryTestDB(t)
+	)
+
+	defer dispose()
+
+	_, err := db.DeleteOutgoingContactRequest("")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	_, err = db.AddContactRequestIncomingReceived("contactPK2", displayName, "convPK2")
+	require.NoError(t, err)
+
+	_, err = db.DeleteOutgoingContactRequest("contactPK2")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	_, err = db.AddContactRequestOutgoingEnqueued(contactPK, displayName, convPK)
+	require.NoError(t, err)
+
+	_, err = db.AddConversationForContact(convPK, "ownMemberPK", "ownDevicePK", contactPK)
+	require.NoError(t, err)
+
+	contact, err := db.DeleteOutgoingContactRequest(contactPK)
+	require.NoError(t, err)
+	require.Equal(t, convPK, contact.ConversationPublicKey)
+
+	_, err = db.GetContactByPK(contactPK)
+	require.Error(t, err)
+
+	_, err = db.GetConversationByPK(convPK)
+	require.Error(t, err)
+
+	_, err = db.GetContactByPK("contactPK2")
+	require.NoError(t, err)
+}
+
 func Test_dbWrapper_addConversationForContact(t *testing.T) {
 	db, _, dispose := GetInMemoryTestDB(t)
 	defer dispose()
@@ -678,6 +741,89 @@ func Test_dbWrapper_deleteInteractions(t *testing.T) {
 	require.Equal(t, "Qm0004", interaction.CID)
 }
 
+func Test_dbWrapper_getOldestUserMessages(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.GetOldestUserMessages(1000, 0)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0001", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 300})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0002", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 100})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0003", Type: messengertypes.AppMessage_TypeSetUserInfo, SentDate: 50})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0004", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 200})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0005", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 2000})
+
+	interactions, err := db.GetOldestUserMessages(1000, 2)
+	require.NoError(t, err)
+	require.Len(t, interactions, 2)
+	require.Equal(t, "Qm0002", interactions[0].CID)
+	require.Equal(t, "Qm0004", interactions[1].CID)
+
+	interactions, err = db.GetOldestUserMessages(1000, 10)
+	require.NoError(t, err)
+	require.Len(t, interactions, 3)
+
+	require.NoError(t, db.DeleteInteractions([]string{"Qm0001", "Qm0002", "Qm0004"}))
+	require.NoError(t, db.Vacuum())
+
+	interactions, err = db.GetOldestUserMessages(1000, 10)
+	require.NoError(t, err)
+	require.Empty(t, interactions)
+}
+
+func Test_dbWrapper_getUnacknowledgedUserMessages(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.GetUnacknowledgedUserMessages("conv", 0)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0001", ConversationPublicKey: "conv", Type: messengertypes.AppMessage_TypeUserMessage, IsMine: true, SentDate: 100})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0002", ConversationPublicKey: "conv", Type: messengertypes.AppMessage_TypeUserMessage, IsMine: true, SentDate: 200, Acknowledged: true})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0003", ConversationPublicKey: "conv", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 300})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0004", ConversationPublicKey: "conv", Type: messengertypes.AppMessage_TypeUserReaction, IsMine: true, SentDate: 400})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0005", ConversationPublicKey: "other", Type: messengertypes.AppMessage_TypeUserMessage, IsMine: true, SentDate: 500})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0006", ConversationPublicKey: "conv", Type: messengertypes.AppMessage_TypeUserMessage, IsMine: true, SentDate: 600})
+
+	interactions, err := db.GetUnacknowledgedUserMessages("conv", 10)
+	require.NoError(t, err)
+	require.Len(t, interactions, 2)
+	require.Equal(t, "Qm0006", interactions[0].CID)
+	require.Equal(t, "Qm0001", interactions[1].CID)
+
+	interactions, err = db.GetUnacknowledgedUserMessages("conv", 1)
+	require.NoError(t, err)
+	require.Len(t, interactions, 1)
+	require.Equal(t, "Qm0006", interactions[0].CID)
+}
+
+func Test_dbWrapper_OnInteractionsDeleted(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	var deleted []string
+	db.OnInteractionsDeleted(func(cids []string) { deleted = append(deleted, cids...) })
+
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0001"})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0002"})
+
+	require.NoError(t, db.DeleteInteractions([]string{"Qm0001"}))
+	require.Equal(t, []string{"Qm0001"}, deleted)
+
+	// only called once the transaction is committed
+	err := db.TX(context.Background(), func(tx *DBWrapper) error {
+		if err := tx.DeleteInteractions([]string{"Qm0002"}); err != nil {
+			return err
+		}
+
+		require.Equal(t, []string{"Qm0001"}, deleted)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Qm0001", "Qm0002"}, deleted)
+}
+
 func Test_dbWrapper_GetAccount(t *testing.T) {
 	refAccount := &messengertypes.Account{
 		PublicKey: "pk1",
@@ -806,6 +952,33 @@ func Test_dbWrapper_GetAccount(t *testing.T) {
 	require.Equal(t, "srv_ds_1", acc.DirectoryServiceRecords[0].ServerAddr)
 }
 
+func Test_dbWrapper_getUserMessagesTargeting(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.GetUserMessagesTargeting("", "QmTarget")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	_, err = db.GetUserMessagesTargeting("conv1", "")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0001", Type: messengertypes.AppMessage_TypeUserMessage, ConversationPublicKey: "conv1", TargetCID: "QmTarget", SentDate: 2})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0002", Type: messengertypes.AppMessage_TypeUserMessage, ConversationPublicKey: "conv1", TargetCID: "QmTarget", SentDate: 1})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0003", Type: messengertypes.AppMessage_TypeAcknowledge, ConversationPublicKey: "conv1", TargetCID: "QmTarget"})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0004", Type: messengertypes.AppMessage_TypeUserMessage, ConversationPublicKey: "conv2", TargetCID: "QmTarget"})
+	db.db.Create(&messengertypes.Interaction{CID: "Qm0005", Type: messengertypes.AppMessage_TypeUserMessage, ConversationPublicKey: "conv1", TargetCID: "QmOtherTarget"})
+
+	interactions, err := db.GetUserMessagesTargeting("conv1", "QmTarget")
+	require.NoError(t, err)
+	require.Len(t, interactions, 2)
+	require.Equal(t, "Qm0002", interactions[0].CID)
+	require.Equal(t, "Qm0001", interactions[1].CID)
+
+	interactions, err = db.GetUserMessagesTargeting("conv1", "QmXX")
+	require.NoError(t, err)
+	require.Empty(t, interactions)
+}
+
 func Test_dbWrapper_getAcknowledgementsCIDsForInteraction(t *testing.T) {
 	db, _, dispose := GetInMemoryTestDB(t)
 	defer dispose()
@@ -853,6 +1026,40 @@ func Test_dbWrapper_getAllContacts(t *testing.T) {
 	require.Len(t, contacts, 3)
 }
 
+func Test_dbWrapper_readOnly(t *testing.T) {
+	dir := t.TempDir()
+	key := []byte(strings.Repeat("k", 32))
+	salt := []byte(strings.Repeat("s", 16))
+
+	writerDB, writerCleanup, err := accountutils.GetMessengerDBForPath(dir, key, salt, zap.NewNop())
+	require.NoError(t, err)
+	defer writerCleanup()
+
+	writer := NewDBWrapper(writerDB, zap.NewNop())
+	require.NoError(t, writer.InitDB(func(d *DBWrapper) error { return nil }))
+	require.NoError(t, writer.db.Create(&messengertypes.Contact{PublicKey: "pk1"}).Error)
+
+	readerDB, readerCleanup, err := accountutils.GetMessengerDBForPathReadOnly(dir, key, salt, zap.NewNop())
+	require.NoError(t, err)
+	defer readerCleanup()
+
+	reader := NewDBWrapper(readerDB, zap.NewNop())
+	contacts, err := reader.GetAllContacts()
+	require.NoError(t, err)
+	require.Len(t, contacts, 1)
+
+	// the writer is not blocked by the reader, which sees its commits
+	require.NoError(t, writer.db.Create(&messengertypes.Contact{PublicKey: "pk2"}).Error)
+	contacts, err = reader.GetAllContacts()
+	require.NoError(t, err)
+	require.Len(t, contacts, 2)
+
+	require.Error(t, reader.db.Create(&messengertypes.Contact{PublicKey: "pk3"}).Error)
+
+	_, _, err = accountutils.GetMessengerDBForPathReadOnly(t.TempDir(), key, salt, zap.NewNop())
+	require.Error(t, err)
+}
+
 func Test_dbWrapper_getAllConversations(t *testing.T) {
 	db, _, dispose := GetInMemoryTestDB(t)
 	defer dispose()
@@ -1355,6 +1562,37 @@ func Test_dbWrapper_markInteractionAsAcknowledged(t *testing.T) {
 	require.Nil(t, interaction)
 }
 
+func Test_dbWrapper_markConversationAsRead(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	conv, updated, err := db.MarkConversationAsRead("")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+	require.False(t, updated)
+	require.Nil(t, conv)
+
+	_, _, err = db.MarkConversationAsRead("conv_xxx")
+	require.Error(t, err)
+
+	db.db.Create(&messengertypes.Conversation{PublicKey: "conv1"})
+	db.db.Create(&messengertypes.Conversation{PublicKey: "conv2", UnreadCount: 1000})
+
+	conv, updated, err = db.MarkConversationAsRead("conv1")
+	require.NoError(t, err)
+	require.False(t, updated)
+	require.Equal(t, "conv1", conv.PublicKey)
+
+	conv, updated, err = db.MarkConversationAsRead("conv2")
+	require.NoError(t, err)
+	require.True(t, updated)
+	require.Equal(t, int32(0), conv.UnreadCount)
+
+	c := &messengertypes.Conversation{}
+	db.db.Model(&messengertypes.Conversation{}).Where(&messengertypes.Conversation{PublicKey: "conv2"}).First(&c)
+	require.Equal(t, int32(0), c.UnreadCount)
+	require.False(t, c.IsOpen)
+}
+
 func Test_dbWrapper_setConversationIsOpenStatus(t *testing.T) {
 	db, _, dispose := GetInMemoryTestDB(t)
 	defer dispose()
@@ -1577,6 +1815,141 @@ func Test_dbWrapper_getLatestInteractionPerConversation(t *testing.T) {
 	require.Len(t, interactions, 0)
 }
 
+func Test_dbWrapper_getInteractionsAfter(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	for _, pk := range []string{"c1", "c2"} {
+		require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: pk}).Error)
+	}
+
+	// i3 arrives late, with the oldest sent date
+	for i, sentDate := range []int64{100, 200, 300, 50, 400} {
+		for _, pk := range []string{"c1", "c2"} {
+			err := db.db.Create(&messengertypes.Interaction{
+				CID:                   fmt.Sprintf("%s_i%d", pk, i),
+				ConversationPublicKey: pk,
+				SentDate:              sentDate,
+			}).Error
+			require.NoError(t, err)
+		}
+	}
+
+	interactions, err := db.GetInteractionsAfter("c1", "", 3, messengertypes.SystemEvents_Included)
+	require.NoError(t, err)
+	require.Len(t, interactions, 3)
+	require.Equal(t, "c1_i0", interactions[0].CID)
+	require.Equal(t, "c1_i2", interactions[2].CID)
+
+	interactions, err = db.GetInteractionsAfter("c1", "c1_i2", 10, messengertypes.SystemEvents_Included)
+	require.NoError(t, err)
+	require.Len(t, interactions, 2)
+	require.Equal(t, "c1_i3", interactions[0].CID)
+	require.Equal(t, "c1_i4", interactions[1].CID)
+
+	interactions, err = db.GetInteractionsAfter("c1", "c1_i4", 10, messengertypes.SystemEvents_Included)
+	require.NoError(t, err)
+	require.Len(t, interactions, 0)
+
+	_, err = db.GetInteractionsAfter("c1", "c2_i2", 10, messengertypes.SystemEvents_Included)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	_, err = db.GetInteractionsAfter("", "", 10, messengertypes.SystemEvents_Included)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
+
+func Test_dbWrapper_addSystemEvent(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "c1", Type: messengertypes.Conversation_MultiMemberType}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Interaction{CID: "c1_i0", ConversationPublicKey: "c1", SentDate: 100}).Error)
+
+	_, _, err := db.AddSystemEvent("", &messengertypes.SystemEvent{Kind: messengertypes.SystemEvent_MemberJoined, MemberPublicKey: "m1"}, 200)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	_, _, err = db.AddSystemEvent("c1", &messengertypes.SystemEvent{Kind: messengertypes.SystemEvent_MemberJoined}, 200)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	event := &messengertypes.SystemEvent{Kind: messengertypes.SystemEvent_MemberJoined, MemberPublicKey: "m1", DevicePublicKey: "d1", DisplayName: "Alice"}
+	i, isNew, err := db.AddSystemEvent("c1", event, 200)
+	require.NoError(t, err)
+	require.True(t, isNew)
+	require.True(t, i.IsSystemEvent())
+
+	payload, err := i.UnmarshalPayload()
+	require.NoError(t, err)
+	require.Equal(t, "Alice joined", payload.(*messengertypes.SystemEvent).Text())
+
+	// replayed
+	_, isNew, err = db.AddSystemEvent("c1", event, 300)
+	require.NoError(t, err)
+	require.False(t, isNew)
+
+	interactions, err := db.GetFilteredPaginatedInteractions(&messengertypes.PaginatedInteractionsOptions{ConversationPK: "c1", Amount: 5}, messengertypes.SystemEvents_Included)
+	require.NoError(t, err)
+	require.Len(t, interactions, 2)
+
+	interactions, err = db.GetFilteredPaginatedInteractions(&messengertypes.PaginatedInteractionsOptions{ConversationPK: "c1", Amount: 5}, messengertypes.SystemEvents_Excluded)
+	require.NoError(t, err)
+	require.Len(t, interactions, 1)
+	require.Equal(t, "c1_i0", interactions[0].CID)
+
+	interactions, err = db.GetInteractionsAfter("c1", "", 5, messengertypes.SystemEvents_Only)
+	require.NoError(t, err)
+	require.Len(t, interactions, 1)
+	require.Equal(t, i.CID, interactions[0].CID)
+
+	// the imported messages of a member are stored once per source
+	for _, source := range []string{"s1", "s2", "s1"} {
+		_, _, err = db.AddSystemEvent("c1", &messengertypes.SystemEvent{Kind: messengertypes.SystemEvent_MessageImported, MemberPublicKey: "m2", SourceCID: source, Body: "hello"}, 50)
+		require.NoError(t, err)
+	}
+
+	interactions, err = db.GetInteractionsAfter("c1", "", 5, messengertypes.SystemEvents_Only)
+	require.NoError(t, err)
+	require.Len(t, interactions, 3)
+}
+
+func Test_dbWrapper_getConversationStats(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.GetConversationStats("")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	stats, err := db.GetConversationStats("c1")
+	require.NoError(t, err)
+	require.Zero(t, stats.Interactions)
+	require.Zero(t, stats.FirstMessageDate)
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "c1"}).Error)
+	for _, i := range []*messengertypes.Interaction{
+		{CID: "i1", ConversationPublicKey: "c1", Type: messengertypes.AppMessage_TypeUserMessage, MemberPublicKey: "m1", SentDate: 200, Payload: []byte("hello")},
+		{CID: "i2", ConversationPublicKey: "c1", Type: messengertypes.AppMessage_TypeUserMessage, MemberPublicKey: "m2", SentDate: 100, Payload: []byte("hi")},
+		{CID: "i3", ConversationPublicKey: "c1", Type: messengertypes.AppMessage_TypeUserMessage, MemberPublicKey: "m1", SentDate: 300, Payload: []byte("bye")},
+		{CID: "i4", ConversationPublicKey: "c1", Type: messengertypes.AppMessage_TypeAcknowledge, MemberPublicKey: "m2", SentDate: 400, Payload: []byte("a")},
+		{CID: "i5", ConversationPublicKey: "c2", Type: messengertypes.AppMessage_TypeUserMessage, MemberPublicKey: "m1", SentDate: 500, Payload: []byte("other")},
+	} {
+		require.NoError(t, db.db.Create(i).Error)
+	}
+
+	stats, err = db.GetConversationStats("c1")
+	require.NoError(t, err)
+	require.Equal(t, &ConversationStats{
+		Interactions:     4,
+		Messages:         3,
+		PayloadSize:      uint64(len("hello") + len("hi") + len("bye") + len("a")),
+		FirstMessageDate: 100,
+		LastMessageDate:  300,
+		MemberMessages:   map[string]uint64{"m1": 2, "m2": 1},
+	}, stats)
+
+	cids, err := db.GetInteractionCIDsForConversation("c1")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"i1", "i2", "i3", "i4"}, cids)
+}
+
 func Test_dbWrapper_getLatestInteractionAndMediaPerConversation_sorting(t *testing.T) {
 	db, _, dispose := GetInMemoryTestDB(t)
 	defer dispose()
@@ -2821,6 +3194,27 @@ func Test_dbWrapper_SavePushMemberToken(t *testing.T) {
 	require.Equal(t, server2Addr, conv.PushMemberTokens[1].ServerAddr)
 	require.Equal(t, server2Key, conv.PushMemberTokens[1].ServerKey)
 	require.Equal(t, token2, conv.PushMemberTokens[1].Token)
+
+	// a token shared again by the device for a server replaces the previous one
+	token3 := []byte("token3")
+	tokenID3 := messengerutil.MakeSharedPushIdentifier(server1Key, token3)
+
+	err = db.SavePushMemberToken(tokenID3, conversationPK, &messengertypes.AppMessage_PushSetMemberToken{
+		MemberToken: &messengertypes.PushMemberTokenUpdate{
+			DevicePK: devicePK,
+			Server:   &messengertypes.PushServer{Addr: server1Addr, Key: server1Key},
+			Token:    token3,
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = db.GetPushMemberToken(tokenID1)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	tokens, err = db.GetPushMemberTokens(conversationPK, devicePK)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	require.ElementsMatch(t, []string{tokenID2, tokenID3}, []string{tokens[0].TokenID, tokens[1].TokenID})
 }
 
 func Test_dbWrapper_SaveServiceToken(t *testing.T) {
@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
-	"time"
 
 	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
 	"github.com/gogo/protobuf/proto"
@@ -533,6 +532,15 @@ func (h *EventHandler) accountContactRequestIncomingReceived(gme *protocoltypes.
 		return err
 	}
 
+	if contact != nil && !h.replay {
+		notify, err := h.postHandlerActions.ContactRequestReceived(contact)
+		if err != nil {
+			h.logger.Warn("failed to handle contact request", zap.Error(err))
+		} else if !notify {
+			return nil
+		}
+	}
+
 	err = h.dispatcher.Notify(
 		mt.StreamEvent_Notified_TypeContactRequestReceived,
 		"Contact request received",
@@ -698,7 +706,7 @@ func (h *EventHandler) groupMemberDeviceAdded(gme *protocoltypes.GroupMetadataEv
 	gpk := messengerutil.B64EncodeBytes(gpkb)
 
 	// Check if the event is emitted by the current user
-	ownMemberPK, _, err := h.metaFetcher.OwnMemberAndDevicePKForConversation(h.ctx, gme.EventContext.GroupPK)
+	ownMemberPK, ownDevicePK, err := h.metaFetcher.OwnMemberAndDevicePKForConversation(h.ctx, gme.EventContext.GroupPK)
 	if err != nil {
 		return weshnet_errcode.ErrGroupInfo.Wrap(err)
 	}
@@ -706,11 +714,13 @@ func (h *EventHandler) groupMemberDeviceAdded(gme *protocoltypes.GroupMetadataEv
 	isMe := bytes.Equal(ownMemberPK, mpkb)
 
 	// Register device if not already known
+	deviceIsNew := false
 	if _, err := h.db.GetDeviceByPK(dpk); errors.Is(err, errcode.ErrNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
 		device, err := h.db.AddDevice(dpk, mpk)
 		if err != nil {
 			return err
 		}
+		deviceIsNew = true
 
 		err = h.dispatcher.StreamEvent(mt.StreamEvent_TypeDeviceUpdated, &mt.StreamEvent_DeviceUpdated{Device: device}, true)
 		if err != nil {
@@ -718,6 +728,15 @@ func (h *EventHandler) groupMemberDeviceAdded(gme *protocoltypes.GroupMetadataEv
 		}
 	}
 
+	// Another device of the account joined the account group
+	if isMe && !h.replay && !bytes.Equal(ownDevicePK, dpkb) {
+		if acc, err := h.db.GetAccount(); err == nil && acc.GetPublicKey() == gpk {
+			if err := h.postHandlerActions.DeviceLinked(&mt.Device{PublicKey: dpk, MemberPublicKey: mpk}); err != nil {
+				h.logger.Error("error while running device linked post actions", zap.Error(err))
+			}
+		}
+	}
+
 	// Check whether a contact request has been accepted (a device from the contact has been added to the group)
 	if contact, err := h.db.GetContactByPK(mpk); err == nil && contact.GetState() == mt.Contact_OutgoingRequestSent {
 		if err := h.contactRequestAccepted(contact, mpkb); err != nil {
@@ -791,9 +810,52 @@ func (h *EventHandler) groupMemberDeviceAdded(gme *protocoltypes.GroupMetadataEv
 		{Name: "IsNew", Description: strconv.FormatBool(isNew)},
 	})...)
 
+	if deviceIsNew {
+		if err := h.addMembershipSystemEvent(member, dpk); err != nil {
+			h.logger.Error("unable to add the membership system event", zap.Error(err))
+		}
+	}
+
 	return nil
 }
 
+// addMembershipSystemEvent stores and streams the system event of a new device
+// in a multi-member group, the first device of a member is the member joining.
+func (h *EventHandler) addMembershipSystemEvent(member *mt.Member, dpk string) error {
+	conv, err := h.db.GetConversationByPK(member.GetConversationPublicKey())
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	if conv.GetType() != mt.Conversation_MultiMemberType {
+		return nil
+	}
+
+	devices, err := h.db.GetDevicesForMember(member.GetConversationPublicKey(), member.GetPublicKey())
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	event := &mt.SystemEvent{
+		Kind:            mt.SystemEvent_DeviceAdded,
+		MemberPublicKey: member.GetPublicKey(),
+		DevicePublicKey: dpk,
+		DisplayName:     member.GetDisplayName(),
+	}
+	if len(devices) <= 1 {
+		event.Kind = mt.SystemEvent_MemberJoined
+	}
+
+	// the metadata events have no date, the event is dated when it is
+	// first handled
+	i, isNew, err := h.db.AddSystemEvent(conv.GetPublicKey(), event, messengerutil.TimestampMs(h.db.Now()))
+	if err != nil || !isNew {
+		return err
+	}
+
+	return messengerutil.StreamInteraction(h.dispatcher, h.db, i.GetCID(), true)
+}
+
 func (h *EventHandler) handleAppMessageAcknowledge(tx *messengerdb.DBWrapper, i *mt.Interaction, _ proto.Message) (*mt.Interaction, bool, error) {
 	target, err := tx.MarkInteractionAsAcknowledged(i.TargetCID)
 	switch {
@@ -812,6 +874,10 @@ func (h *EventHandler) handleAppMessageAcknowledge(tx *messengerdb.DBWrapper, i
 	default:
 		h.logger.Debug(messengerutil.TyberEventAcknowledgeReceived, tyber.FormatEventLogFields(h.ctx, []tyber.Detail{{Name: "TargetCID", Description: i.TargetCID}})...)
 
+		if err := tx.InteractionAcknowledgedBy(i.TargetCID, i.MemberPublicKey); err != nil {
+			return nil, false, err
+		}
+
 		if target != nil {
 			if err := messengerutil.StreamInteraction(h.dispatcher, tx, target.CID, false); err != nil {
 				h.logger.Error("error while sending stream event", logutil.PrivateString("public-key", i.ConversationPublicKey), logutil.PrivateString("cid", i.CID), zap.Error(err))
@@ -1088,7 +1154,7 @@ func (h *EventHandler) dispatchVisibleInteraction(i *mt.Interaction) error {
 		newUnread := !h.replay && !i.IsMine && !opened
 
 		// db update
-		if err := tx.UpdateConversationReadState(i.ConversationPublicKey, newUnread, time.Now()); err != nil {
+		if err := tx.UpdateConversationReadState(i.ConversationPublicKey, newUnread, tx.Now()); err != nil {
 			return err
 		}
 
@@ -0,0 +1,210 @@
+// Package msgchunk splits the app messages too large for a single group
+// message into chunks, and reassembles them on the receiving side.
+//
+// Every chunk carries the identifier of the message, its position, the
+// number of chunks and the SHA-256 digest of the whole payload, which is
+// checked once all the chunks are received. The reassembly is kept in
+// memory, the chunks of a message interrupted by a restart are dropped when
+// they expire.
+package msgchunk
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const (
+	// IDSize is the size of the random identifier of a chunked message.
+	IDSize = 16
+
+	// DefaultTTL is how long the chunks of an incomplete message are kept.
+	DefaultTTL = 24 * time.Hour
+)
+
+// Overhead is the maximum size taken by the fields of a marshaled chunk
+// besides its data.
+const Overhead = (2 + IDSize) + 2*(1+5) + (2 + sha256.Size) + (1 + 10)
+
+// Chunk is a part of a chunked message, it is the payload of the app
+// messages of type TypeChunk.
+type Chunk = messengertypes.AppMessage_Chunk
+
+// Unmarshal decodes and validates a chunk.
+func Unmarshal(raw []byte) (*Chunk, error) {
+	c := &Chunk{}
+	if err := c.Unmarshal(raw); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	switch {
+	case len(c.ID) != IDSize:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid chunked message id"))
+	case len(c.Digest) != sha256.Size:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid chunked message digest"))
+	case c.Count < 2 || c.Index >= c.Count:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid chunk %d of %d", c.Index, c.Count))
+	}
+
+	return c, nil
+}
+
+// Split splits payload into chunks of at most size bytes of data, with a
+// new random identifier.
+func Split(payload []byte, size int) ([]*Chunk, error) {
+	if size <= 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid chunk size %d", size))
+	}
+
+	count := (len(payload) + size - 1) / size
+	if count < 2 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a payload of %d bytes fits in a single chunk", len(payload)))
+	}
+
+	id := make([]byte, IDSize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, errcode.ErrCryptoRandomGeneration.Wrap(err)
+	}
+
+	digest := sha256.Sum256(payload)
+
+	chunks := make([]*Chunk, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		chunks = append(chunks, &Chunk{
+			ID:     id,
+			Index:  uint32(i),
+			Count:  uint32(count),
+			Digest: digest[:],
+			Data:   payload[i*size : end],
+		})
+	}
+
+	return chunks, nil
+}
+
+type pending struct {
+	count    uint32
+	digest   []byte
+	data     [][]byte
+	received uint32
+	size     int
+	last     interface{}
+	expires  time.Time
+}
+
+// Reassembler reassembles the chunked messages of the senders.
+type Reassembler struct {
+	maxSize int
+	ttl     time.Duration
+	clock   clock.Clock
+
+	mu      sync.Mutex
+	pending map[string]*pending
+}
+
+// NewReassembler returns a reassembler of messages of at most maxSize bytes,
+// whose chunks are all received within ttl.
+func NewReassembler(maxSize int, ttl time.Duration) *Reassembler {
+	return &Reassembler{
+		maxSize: maxSize,
+		ttl:     ttl,
+		clock:   clock.New(),
+		pending: make(map[string]*pending),
+	}
+}
+
+// SetClock replaces the clock expiring the incomplete messages, e.g. with a
+// mock in tests.
+func (r *Reassembler) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Add adds a chunk sent by sender, e.g. a device of a group. It returns the
+// payload once all the chunks of the message are received, with the value
+// given with its last chunk, and nil otherwise. The chunks received again
+// are ignored.
+func (r *Reassembler) Add(sender string, c *Chunk, value interface{}) ([]byte, interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	for key, p := range r.pending {
+		if now.After(p.expires) {
+			delete(r.pending, key)
+		}
+	}
+
+	key := sender + "/" + string(c.ID)
+	p, ok := r.pending[key]
+	if !ok {
+		// the chunks hold at least a byte each
+		if r.maxSize > 0 && int64(c.Count) > int64(r.maxSize) {
+			return nil, nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("chunked message of %d chunks over the limit of %d bytes", c.Count, r.maxSize))
+		}
+
+		p = &pending{
+			count:   c.Count,
+			digest:  c.Digest,
+			data:    make([][]byte, c.Count),
+			expires: now.Add(r.ttl),
+		}
+		r.pending[key] = p
+	}
+
+	if c.Count != p.count || !bytes.Equal(c.Digest, p.digest) || c.Index >= p.count {
+		delete(r.pending, key)
+		return nil, nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("chunk %d of %d does not match its message", c.Index, c.Count))
+	}
+
+	if p.data[c.Index] != nil {
+		return nil, nil, nil
+	}
+
+	p.size += len(c.Data)
+	if r.maxSize > 0 && p.size > r.maxSize {
+		delete(r.pending, key)
+		return nil, nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("chunked message over the limit of %d bytes", r.maxSize))
+	}
+
+	p.data[c.Index] = c.Data
+	if p.data[c.Index] == nil {
+		p.data[c.Index] = []byte{}
+	}
+	p.received++
+	if c.Index == p.count-1 {
+		p.last = value
+	}
+
+	if p.received < p.count {
+		return nil, nil, nil
+	}
+	delete(r.pending, key)
+
+	payload := bytes.Join(p.data, nil)
+	if digest := sha256.Sum256(payload); !bytes.Equal(digest[:], p.digest) {
+		return nil, nil, errcode.ErrCryptoSignatureVerification.Wrap(fmt.Errorf("the digest of the chunked message does not match its content"))
+	}
+
+	return payload, p.last, nil
+}
+
+// Pending returns the number of incomplete messages.
+func (r *Reassembler) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.pending)
+}
@@ -0,0 +1,134 @@
+package msgchunk
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func testPayload(t *testing.T, size int) []byte {
+	t.Helper()
+
+	payload := make([]byte, size)
+	_, err := rand.Read(payload)
+	require.NoError(t, err)
+
+	return payload
+}
+
+func TestSplitMarshal(t *testing.T) {
+	payload := testPayload(t, 2500)
+
+	chunks, err := Split(payload, 1000)
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+	require.Len(t, chunks[2].Data, 500)
+
+	for _, c := range chunks {
+		raw, err := c.Marshal()
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(raw), Overhead+len(c.Data))
+
+		decoded, err := Unmarshal(raw)
+		require.NoError(t, err)
+		require.Equal(t, c, decoded)
+	}
+
+	_, err = Split(payload, len(payload))
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	_, err = Unmarshal([]byte("not a chunk"))
+	require.Error(t, err)
+
+	invalid := *chunks[0]
+	invalid.Index = invalid.Count
+	raw, err := invalid.Marshal()
+	require.NoError(t, err)
+	_, err = Unmarshal(raw)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
+
+func TestReassembler(t *testing.T) {
+	payload := testPayload(t, 2500)
+	chunks, err := Split(payload, 1000)
+	require.NoError(t, err)
+
+	r := NewReassembler(10000, DefaultTTL)
+
+	// out of order, with a chunk received twice
+	for _, i := range []int{2, 0, 2} {
+		out, _, err := r.Add("device", chunks[i], i)
+		require.NoError(t, err)
+		require.Nil(t, out)
+	}
+	require.Equal(t, 1, r.Pending())
+
+	// the chunks of another sender are not mixed up
+	out, _, err := r.Add("other", chunks[1], 1)
+	require.NoError(t, err)
+	require.Nil(t, out)
+
+	out, last, err := r.Add("device", chunks[1], 1)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(payload, out))
+	require.Equal(t, 2, last)
+	require.Equal(t, 1, r.Pending())
+}
+
+func TestReassemblerIntegrity(t *testing.T) {
+	payload := testPayload(t, 2000)
+	chunks, err := Split(payload, 1000)
+	require.NoError(t, err)
+
+	r := NewReassembler(10000, DefaultTTL)
+
+	tampered := *chunks[1]
+	tampered.Data = testPayload(t, 1000)
+
+	_, _, err = r.Add("device", chunks[0], nil)
+	require.NoError(t, err)
+	_, _, err = r.Add("device", &tampered, nil)
+	require.True(t, errcode.Is(err, errcode.ErrCryptoSignatureVerification))
+	require.Zero(t, r.Pending())
+
+	// a chunk of another message with the same id
+	other := *chunks[1]
+	other.Count = 3
+	_, _, err = r.Add("device", chunks[0], nil)
+	require.NoError(t, err)
+	_, _, err = r.Add("device", &other, nil)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	// over the size limit
+	small := NewReassembler(1500, DefaultTTL)
+	_, _, err = small.Add("device", chunks[0], nil)
+	require.NoError(t, err)
+	_, _, err = small.Add("device", chunks[1], nil)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
+
+func TestReassemblerExpiry(t *testing.T) {
+	chunks, err := Split(testPayload(t, 2000), 1000)
+	require.NoError(t, err)
+
+	mock := clock.NewMock()
+	r := NewReassembler(10000, time.Hour)
+	r.SetClock(mock)
+
+	_, _, err = r.Add("device", chunks[0], nil)
+	require.NoError(t, err)
+
+	mock.Add(2 * time.Hour)
+
+	// the first chunk expired, the message is incomplete again
+	out, _, err := r.Add("device", chunks[1], nil)
+	require.NoError(t, err)
+	require.Nil(t, out)
+	require.Equal(t, 1, r.Pending())
+}
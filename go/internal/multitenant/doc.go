@@ -0,0 +1,3 @@
+// Package multitenant lets a single gRPC server host several opened accounts
+// at once, routing each call to the account named in the request metadata.
+package multitenant
@@ -0,0 +1,236 @@
+package multitenant
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"berty.tech/berty/v2/go/internal/grpcutil"
+	"berty.tech/berty/v2/go/internal/versionrpc"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/logutil"
+)
+
+// AccountIDMetadataKey is the gRPC metadata key used to select the account
+// a call is made on behalf of.
+const AccountIDMetadataKey = "berty-account-id"
+
+// Feature is advertised by the version service of a multi-tenant daemon.
+const Feature = "multitenant"
+
+// WithAccountID returns an outgoing context targeting the given account.
+func WithAccountID(ctx context.Context, accountID string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, AccountIDMetadataKey, accountID)
+}
+
+// AccountIDFromContext returns the account targeted by an incoming call.
+func AccountIDFromContext(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	values := md.Get(AccountIDMetadataKey)
+	if len(values) == 0 || values[0] == "" {
+		return "", false
+	}
+
+	return values[0], true
+}
+
+// NewAccountConn returns a client connection binding every call made
+// through cc to the given account.
+func NewAccountConn(cc grpc.ClientConnInterface, accountID string) grpc.ClientConnInterface {
+	return &accountConn{cc: cc, accountID: accountID}
+}
+
+type accountConn struct {
+	cc        grpc.ClientConnInterface
+	accountID string
+}
+
+func (c *accountConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	return c.cc.Invoke(WithAccountID(ctx, c.accountID), method, args, reply, opts...)
+}
+
+func (c *accountConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.cc.NewStream(WithAccountID(ctx, c.accountID), desc, method, opts...)
+}
+
+// Router forwards gRPC calls to the client connection of the targeted
+// account. Messages are passed through without being decoded, so any
+// service exposed by an account is reachable through the router.
+type Router struct {
+	logger  *zap.Logger
+	codec   *grpcutil.LazyCodec
+	muConns sync.RWMutex
+	conns   map[string]*grpc.ClientConn
+}
+
+func NewRouter(logger *zap.Logger) *Router {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &Router{
+		logger: logger,
+		codec:  grpcutil.NewLazyCodec(),
+		conns:  make(map[string]*grpc.ClientConn),
+	}
+}
+
+// Register makes the given account reachable through the router, replacing
+// any connection previously registered for it.
+func (r *Router) Register(accountID string, cc *grpc.ClientConn) {
+	r.muConns.Lock()
+	r.conns[accountID] = cc
+	r.muConns.Unlock()
+
+	r.logger.Info("account registered", logutil.PrivateString("account-id", accountID))
+}
+
+// Unregister removes the given account from the router, ongoing calls are
+// left untouched.
+func (r *Router) Unregister(accountID string) {
+	r.muConns.Lock()
+	delete(r.conns, accountID)
+	r.muConns.Unlock()
+
+	r.logger.Info("account unregistered", logutil.PrivateString("account-id", accountID))
+}
+
+// AccountIDs returns the sorted list of registered accounts.
+func (r *Router) AccountIDs() []string {
+	r.muConns.RLock()
+	ids := make([]string, 0, len(r.conns))
+	for id := range r.conns {
+		ids = append(ids, id)
+	}
+	r.muConns.RUnlock()
+
+	sort.Strings(ids)
+	return ids
+}
+
+// ServerOptions returns the options needed by a gRPC server to route every
+// call through the router. The server should not register any other service
+// as the messages are not decoded.
+func (r *Router) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ForceServerCodec(r.codec),
+		grpc.UnknownServiceHandler(r.handler),
+	}
+}
+
+func (r *Router) getConn(ctx context.Context) (*grpc.ClientConn, error) {
+	accountID, ok := AccountIDFromContext(ctx)
+	if !ok {
+		return nil, errcode.ErrBertyAccountNoIDSpecified.Wrap(fmt.Errorf("no `%s` found in request metadata", AccountIDMetadataKey))
+	}
+
+	r.muConns.RLock()
+	cc, ok := r.conns[accountID]
+	r.muConns.RUnlock()
+	if !ok {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("account `%s` is not opened", accountID))
+	}
+
+	return cc, nil
+}
+
+func (r *Router) handler(_ interface{}, ss grpc.ServerStream) error {
+	method, ok := grpc.MethodFromServerStream(ss)
+	if !ok {
+		return errcode.ErrInternal.Wrap(fmt.Errorf("unable to get method from stream"))
+	}
+
+	// the version is the daemon's one, whatever the account
+	if method == versionrpc.Method {
+		return versionrpc.ServeLazy(ss, versionrpc.Local(Feature))
+	}
+
+	cc, err := r.getConn(ss.Context())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ss.Context())
+	defer cancel()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = metadata.NewOutgoingContext(ctx, md.Copy())
+
+	desc := &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}
+	cs, err := grpc.NewClientStream(ctx, desc, cc, method, grpc.ForceCodec(r.codec))
+	if err != nil {
+		return err
+	}
+
+	// forward client messages to the account, a failure here cancels the
+	// whole call
+	var clientErr error
+	clientDone := make(chan struct{})
+	go func() {
+		defer close(clientDone)
+		for {
+			msg := grpcutil.NewLazyMessage()
+			if err := ss.RecvMsg(msg); err != nil {
+				if err == io.EOF {
+					_ = cs.CloseSend()
+					return
+				}
+				clientErr = err
+				cancel()
+				return
+			}
+
+			if err := cs.SendMsg(msg); err != nil {
+				if err != io.EOF { // the real error is returned by cs.RecvMsg
+					clientErr = err
+					cancel()
+				}
+				return
+			}
+		}
+	}()
+
+	// forward account messages to the client
+	header, err := cs.Header()
+	if err != nil {
+		return err
+	}
+
+	if err := ss.SendHeader(header); err != nil {
+		return err
+	}
+
+	for {
+		msg := grpcutil.NewLazyMessage()
+		if err := cs.RecvMsg(msg); err != nil {
+			ss.SetTrailer(cs.Trailer())
+			if err == io.EOF {
+				return nil
+			}
+
+			select {
+			case <-clientDone:
+				if clientErr != nil {
+					return clientErr
+				}
+			default:
+			}
+
+			return err
+		}
+
+		if err := ss.SendMsg(msg); err != nil {
+			return err
+		}
+	}
+}
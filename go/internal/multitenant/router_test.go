@@ -0,0 +1,91 @@
+package multitenant
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	"berty.tech/berty/v2/go/internal/versionrpc"
+)
+
+func serve(t *testing.T, opts []grpc.ServerOption, register func(s *grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+
+	l := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(opts...)
+	register(s)
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(s.Stop)
+
+	cc, err := grpc.Dial("buf",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	return cc
+}
+
+func newAccount(t *testing.T, status grpc_health_v1.HealthCheckResponse_ServingStatus) *grpc.ClientConn {
+	hs := health.NewServer()
+	hs.SetServingStatus("account", status)
+	return serve(t, nil, func(s *grpc.Server) { grpc_health_v1.RegisterHealthServer(s, hs) })
+}
+
+func TestRouter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	router := NewRouter(nil)
+	router.Register("alice", newAccount(t, grpc_health_v1.HealthCheckResponse_SERVING))
+	router.Register("bob", newAccount(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING))
+	require.Equal(t, []string{"alice", "bob"}, router.AccountIDs())
+
+	cc := serve(t, router.ServerOptions(), func(*grpc.Server) {})
+	client := grpc_health_v1.NewHealthClient(cc)
+	req := &grpc_health_v1.HealthCheckRequest{Service: "account"}
+
+	// unary
+	ret, err := client.Check(WithAccountID(ctx, "alice"), req)
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, ret.Status)
+
+	ret, err = client.Check(WithAccountID(ctx, "bob"), req)
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, ret.Status)
+
+	// server stream
+	stream, err := client.Watch(WithAccountID(ctx, "bob"), req)
+	require.NoError(t, err)
+	ret, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, ret.Status)
+
+	// bound connection
+	bound := grpc_health_v1.NewHealthClient(NewAccountConn(cc, "alice"))
+	ret, err = bound.Check(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, ret.Status)
+
+	// errors
+	_, err = client.Check(ctx, req)
+	require.Error(t, err)
+
+	// version, answered by the router itself
+	info, err := versionrpc.Get(ctx, cc)
+	require.NoError(t, err)
+	require.Equal(t, []string{Feature}, info.Features)
+
+	router.Unregister("alice")
+	_, err = client.Check(WithAccountID(ctx, "alice"), req)
+	require.Error(t, err)
+	require.Equal(t, []string{"bob"}, router.AccountIDs())
+}
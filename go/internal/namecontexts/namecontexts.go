@@ -0,0 +1,282 @@
+// Package namecontexts lets an account use a different display name in each
+// context of its life, e.g. `work` and `personal`, to keep its identities
+// apart. A context is chosen for a conversation when it is joined or when a
+// contact request is accepted, the display name of the context is then the
+// one sent to the members of the conversation. The conversations without a
+// context get the display name of the account.
+package namecontexts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	datastore "github.com/ipfs/go-datastore"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// DatastoreKey is the key of the account configuration in the root
+// datastore.
+const DatastoreKey = "display_name_contexts_config"
+
+// MaxContexts bounds the number of contexts of an account.
+const MaxContexts = 32
+
+// Config is the per-account configuration.
+type Config struct {
+	// Names are the display names by context.
+	Names map[string]string `json:"names,omitempty"`
+	// Conversations are the contexts by conversation public key.
+	Conversations map[string]string `json:"conversations,omitempty"`
+	// Contacts are the contexts by contact public key, they apply to the
+	// conversation with the contact, whose public key may not be known yet
+	// when the request is accepted.
+	Contacts map[string]string `json:"contacts,omitempty"`
+}
+
+func (c Config) clone() Config {
+	return Config{
+		Names:         cloneMap(c.Names),
+		Conversations: cloneMap(c.Conversations),
+		Contacts:      cloneMap(c.Contacts),
+	}
+}
+
+func cloneMap(m map[string]string) map[string]string {
+	clone := make(map[string]string, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+// Context is a display name of the account and where it is used.
+type Context struct {
+	Name          string   `json:"name"`
+	DisplayName   string   `json:"display_name"`
+	Conversations []string `json:"conversations,omitempty"`
+	Contacts      []string `json:"contacts,omitempty"`
+}
+
+// Store is the configuration of a running account, the changes are saved to
+// its datastore.
+type Store struct {
+	mu     sync.Mutex
+	ds     datastore.Datastore
+	config Config
+}
+
+// New returns the contexts of the account, ds is optional, the changes are
+// not saved without it.
+func New(ds datastore.Datastore, config Config) *Store {
+	return &Store{ds: ds, config: config.clone()}
+}
+
+// Contexts returns the contexts of the account, sorted by name.
+func (s *Store) Contexts() []*Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byName := make(map[string]*Context, len(s.config.Names))
+	contexts := make([]*Context, 0, len(s.config.Names))
+	for name, displayName := range s.config.Names {
+		c := &Context{Name: name, DisplayName: displayName}
+		byName[name] = c
+		contexts = append(contexts, c)
+	}
+
+	for conversationPK, name := range s.config.Conversations {
+		if c, ok := byName[name]; ok {
+			c.Conversations = append(c.Conversations, conversationPK)
+		}
+	}
+	for contactPK, name := range s.config.Contacts {
+		if c, ok := byName[name]; ok {
+			c.Contacts = append(c.Contacts, contactPK)
+		}
+	}
+
+	for _, c := range contexts {
+		sort.Strings(c.Conversations)
+		sort.Strings(c.Contacts)
+	}
+	sort.Slice(contexts, func(i, j int) bool { return contexts[i].Name < contexts[j].Name })
+
+	return contexts
+}
+
+// SetDisplayName creates a context, or renames it.
+func (s *Store) SetDisplayName(ctx context.Context, name, displayName string) error {
+	name, displayName = strings.TrimSpace(name), strings.TrimSpace(displayName)
+	if name == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("a context name is required"))
+	}
+	if displayName == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("a display name is required"))
+	}
+
+	return s.update(ctx, func(config *Config) error {
+		if _, ok := config.Names[name]; !ok && len(config.Names) >= MaxContexts {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("an account can not have more than %d contexts", MaxContexts))
+		}
+
+		config.Names[name] = displayName
+		return nil
+	})
+}
+
+// Remove deletes a context, its conversations and contacts get the display
+// name of the account again.
+func (s *Store) Remove(ctx context.Context, name string) error {
+	return s.update(ctx, func(config *Config) error {
+		if _, ok := config.Names[name]; !ok {
+			return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown context %q", name))
+		}
+
+		delete(config.Names, name)
+		for conversationPK, c := range config.Conversations {
+			if c == name {
+				delete(config.Conversations, conversationPK)
+			}
+		}
+		for contactPK, c := range config.Contacts {
+			if c == name {
+				delete(config.Contacts, contactPK)
+			}
+		}
+		return nil
+	})
+}
+
+// UseInConversation chooses the context of a conversation, an empty name
+// gives it the display name of the account again.
+func (s *Store) UseInConversation(ctx context.Context, conversationPK, name string) error {
+	if conversationPK == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	return s.update(ctx, func(config *Config) error {
+		return bind(config, config.Conversations, conversationPK, name)
+	})
+}
+
+// UseWithContact chooses the context of the conversation with a contact, an
+// empty name gives it the display name of the account again.
+func (s *Store) UseWithContact(ctx context.Context, contactPK, name string) error {
+	if contactPK == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	return s.update(ctx, func(config *Config) error {
+		return bind(config, config.Contacts, contactPK, name)
+	})
+}
+
+func bind(config *Config, bindings map[string]string, pk, name string) error {
+	if name == "" {
+		delete(bindings, pk)
+		return nil
+	}
+
+	if _, ok := config.Names[name]; !ok {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown context %q", name))
+	}
+
+	bindings[pk] = name
+	return nil
+}
+
+// ContextOf returns the context of a conversation, the one chosen for the
+// conversation, else the one chosen for the contact, contactPK is optional.
+// It is empty for nil contexts.
+func (s *Store) ContextOf(conversationPK, contactPK string) string {
+	if s == nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name, ok := s.config.Conversations[conversationPK]; ok {
+		return name
+	}
+	if contactPK != "" {
+		return s.config.Contacts[contactPK]
+	}
+	return ""
+}
+
+// DisplayName returns the display name to send to a conversation, the one
+// of its context, else fallback.
+func (s *Store) DisplayName(conversationPK, contactPK, fallback string) string {
+	name := s.ContextOf(conversationPK, contactPK)
+	if name == "" {
+		return fallback
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if displayName, ok := s.config.Names[name]; ok {
+		return displayName
+	}
+	return fallback
+}
+
+func (s *Store) update(ctx context.Context, change func(config *Config) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config := s.config.clone()
+	if err := change(&config); err != nil {
+		return err
+	}
+
+	if s.ds != nil {
+		if err := SaveConfig(ctx, s.ds, config); err != nil {
+			return err
+		}
+	}
+
+	s.config = config
+	return nil
+}
+
+// LoadConfig reads the account configuration, an empty one is returned if
+// none was saved.
+func LoadConfig(ctx context.Context, ds datastore.Datastore) (Config, error) {
+	var config Config
+
+	data, err := ds.Get(ctx, datastore.NewKey(DatastoreKey))
+	switch err {
+	case nil:
+	case datastore.ErrNotFound:
+		return config, nil
+	default:
+		return config, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return config, nil
+}
+
+// SaveConfig persists the account configuration.
+func SaveConfig(ctx context.Context, ds datastore.Datastore, config Config) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := ds.Put(ctx, datastore.NewKey(DatastoreKey), data); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
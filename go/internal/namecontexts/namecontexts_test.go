@@ -0,0 +1,62 @@
+package namecontexts
+
+import (
+	"context"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	ds := ds_sync.MutexWrap(datastore.NewMapDatastore())
+
+	config, err := LoadConfig(ctx, ds)
+	require.NoError(t, err)
+	store := New(ds, config)
+
+	require.Equal(t, "Alice", store.DisplayName("conv-1", "", "Alice"))
+	require.Empty(t, store.Contexts())
+
+	require.NoError(t, store.SetDisplayName(ctx, "work", "Alice Smith"))
+	require.NoError(t, store.SetDisplayName(ctx, "gaming", "xX_alice_Xx"))
+	require.True(t, errcode.Is(store.SetDisplayName(ctx, "", "Alice"), errcode.ErrMissingInput))
+	require.True(t, errcode.Is(store.SetDisplayName(ctx, "work", " "), errcode.ErrMissingInput))
+
+	require.NoError(t, store.UseInConversation(ctx, "conv-1", "work"))
+	require.NoError(t, store.UseWithContact(ctx, "contact-1", "gaming"))
+	require.True(t, errcode.Is(store.UseInConversation(ctx, "conv-2", "unknown"), errcode.ErrNotFound))
+
+	require.Equal(t, "Alice Smith", store.DisplayName("conv-1", "", "Alice"))
+	require.Equal(t, "xX_alice_Xx", store.DisplayName("conv-3", "contact-1", "Alice"))
+	require.Equal(t, "Alice", store.DisplayName("conv-2", "contact-2", "Alice"))
+
+	// the conversation choice wins over the contact one
+	require.NoError(t, store.UseInConversation(ctx, "conv-3", "work"))
+	require.Equal(t, "work", store.ContextOf("conv-3", "contact-1"))
+
+	require.Equal(t, []*Context{
+		{Name: "gaming", DisplayName: "xX_alice_Xx", Contacts: []string{"contact-1"}},
+		{Name: "work", DisplayName: "Alice Smith", Conversations: []string{"conv-1", "conv-3"}},
+	}, store.Contexts())
+
+	// the configuration is saved
+	config, err = LoadConfig(ctx, ds)
+	require.NoError(t, err)
+	require.Equal(t, "Alice Smith", New(nil, config).DisplayName("conv-1", "", "Alice"))
+
+	require.NoError(t, store.Remove(ctx, "work"))
+	require.True(t, errcode.Is(store.Remove(ctx, "work"), errcode.ErrNotFound))
+	require.Equal(t, "Alice", store.DisplayName("conv-1", "", "Alice"))
+	require.Equal(t, "", store.ContextOf("conv-3", ""))
+
+	require.NoError(t, store.UseWithContact(ctx, "contact-1", ""))
+	require.Equal(t, "Alice", store.DisplayName("conv-3", "contact-1", "Alice"))
+
+	var nilStore *Store
+	require.Equal(t, "Alice", nilStore.DisplayName("conv-1", "contact-1", "Alice"))
+}
@@ -0,0 +1,342 @@
+// Package netconf reads and edits the network configuration of an account,
+// the one the account service stores in the root datastore of the account
+// and turns into the flags of its node. The settings are addressed by a key,
+// e.g. `mdns` or `bootstrap`, and their values are validated before being
+// saved.
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	datastore "github.com/ipfs/go-datastore"
+	ma "github.com/multiformats/go-multiaddr"
+
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/pkg/accounttypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// the keywords of the lists of addresses, as initutil.KeywordNone and
+// initutil.KeywordDefault
+const (
+	keywordNone    = ":none:"
+	keywordDefault = ":default:"
+)
+
+// Default is the value of the settings left to the default of the node.
+const Default = "default"
+
+const (
+	KeyBootstrap            = "bootstrap"
+	KeyRendezvous           = "rendezvous"
+	KeyStaticRelay          = "static-relay"
+	KeyDHT                  = "dht"
+	KeyBLE                  = "ble"
+	KeyMultipeer            = "multipeer-connectivity"
+	KeyNearby               = "nearby"
+	KeyMDNS                 = "mdns"
+	KeyTor                  = "tor"
+	KeyShowDefaultServices  = "show-default-services"
+	KeyAllowInsecureService = "allow-insecure-grpc"
+)
+
+// Setting is a setting of the configuration.
+type Setting struct {
+	Key   string
+	Value string
+	// Help describes the setting and its values.
+	Help string
+}
+
+type field struct {
+	help string
+	get  func(*netConfig) string
+	set  func(*netConfig, string) error
+}
+
+// netConfig and netFlag shorten the declaration of the fields
+type (
+	netConfig = accounttypes.NetworkConfig
+	netFlag   = accounttypes.NetworkConfig_Flag
+)
+
+var fields = map[string]field{
+	KeyBootstrap:            listField("bootstrap peers", func(c *netConfig) *[]string { return &c.Bootstrap }),
+	KeyRendezvous:           listField("rendezvous points", func(c *netConfig) *[]string { return &c.Rendezvous }),
+	KeyStaticRelay:          listField("static relays", func(c *netConfig) *[]string { return &c.StaticRelay }),
+	KeyBLE:                  flagField("Bluetooth Low Energy transport", func(c *netConfig) *netFlag { return &c.BluetoothLE }),
+	KeyMultipeer:            flagField("Apple Multipeer Connectivity transport", func(c *netConfig) *netFlag { return &c.AppleMultipeerConnectivity }),
+	KeyNearby:               flagField("Android Nearby transport", func(c *netConfig) *netFlag { return &c.AndroidNearby }),
+	KeyMDNS:                 flagField("discovery of the peers of the local network", func(c *netConfig) *netFlag { return &c.MDNS }),
+	KeyShowDefaultServices:  flagField("list of the default services of the app", func(c *netConfig) *netFlag { return &c.ShowDefaultServices }),
+	KeyAllowInsecureService: flagField("gRPC connections without TLS", func(c *netConfig) *netFlag { return &c.AllowUnsecureGRPCConnections }),
+	KeyDHT: {
+		help: "DHT mode: disabled, client, server, auto, auto-server or default",
+		get: func(c *netConfig) string {
+			return dhtValues[c.DHT]
+		},
+		set: func(c *netConfig, value string) error {
+			value = strings.ToLower(value)
+			for mode, name := range dhtValues {
+				if name == value {
+					c.DHT = mode
+					return nil
+				}
+			}
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid DHT mode %q, expected disabled, client, server, auto, auto-server or default", value))
+		},
+	},
+	KeyTor: {
+		help: "Tor transport: disabled or default, Tor is not supported yet",
+		get: func(c *netConfig) string {
+			switch c.Tor {
+			case accounttypes.NetworkConfig_TorUndefined:
+				return Default
+			case accounttypes.NetworkConfig_TorDisabled:
+				return "disabled"
+			case accounttypes.NetworkConfig_TorOptional:
+				return "optional"
+			default:
+				return "required"
+			}
+		},
+		set: func(c *netConfig, value string) error {
+			switch value = strings.ToLower(value); value {
+			case Default:
+				c.Tor = accounttypes.NetworkConfig_TorUndefined
+			case "disabled", "off":
+				c.Tor = accounttypes.NetworkConfig_TorDisabled
+			case "optional", "required":
+				// the account service downgrades it to disabled
+				return errcode.ErrNotImplemented.Wrap(fmt.Errorf("tor is not supported yet"))
+			default:
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid tor mode %q, expected disabled or default", value))
+			}
+			return nil
+		},
+	},
+}
+
+var dhtValues = map[accounttypes.NetworkConfig_DHTFlag]string{
+	accounttypes.NetworkConfig_DHTUndefined:  Default,
+	accounttypes.NetworkConfig_DHTDisabled:   "disabled",
+	accounttypes.NetworkConfig_DHTClient:     "client",
+	accounttypes.NetworkConfig_DHTServer:     "server",
+	accounttypes.NetworkConfig_DHTAuto:       "auto",
+	accounttypes.NetworkConfig_DHTAutoServer: "auto-server",
+}
+
+func flagField(help string, ptr func(*netConfig) *netFlag) field {
+	return field{
+		help: help + ": on, off or default",
+		get: func(c *netConfig) string {
+			switch *ptr(c) {
+			case accounttypes.NetworkConfig_Enabled:
+				return "on"
+			case accounttypes.NetworkConfig_Disabled:
+				return "off"
+			default:
+				return Default
+			}
+		},
+		set: func(c *netConfig, value string) error {
+			switch value = strings.ToLower(value); value {
+			case "on", "true", "enabled":
+				*ptr(c) = accounttypes.NetworkConfig_Enabled
+			case "off", "false", "disabled":
+				*ptr(c) = accounttypes.NetworkConfig_Disabled
+			case Default:
+				*ptr(c) = accounttypes.NetworkConfig_Undefined
+			default:
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid value %q, expected on, off or default", value))
+			}
+			return nil
+		},
+	}
+}
+
+func listField(help string, ptr func(*netConfig) *[]string) field {
+	return field{
+		help: help + ": comma-separated multiaddrs, possibly with default, or none",
+		get: func(c *netConfig) string {
+			values := *ptr(c)
+			if len(values) == 0 {
+				return Default
+			}
+
+			words := make([]string, len(values))
+			for i, value := range values {
+				switch value {
+				case keywordDefault:
+					words[i] = Default
+				case keywordNone:
+					words[i] = "none"
+				default:
+					words[i] = value
+				}
+			}
+			return strings.Join(words, ",")
+		},
+		set: func(c *netConfig, value string) error {
+			addrs := []string{}
+			for _, word := range strings.Split(value, ",") {
+				switch word = strings.TrimSpace(word); strings.ToLower(word) {
+				case "":
+				case Default:
+					addrs = append(addrs, keywordDefault)
+				case "none":
+					addrs = append(addrs, keywordNone)
+				default:
+					addrs = append(addrs, word)
+				}
+			}
+
+			if err := validateAddrs(addrs); err != nil {
+				return err
+			}
+
+			*ptr(c) = addrs
+			return nil
+		},
+	}
+}
+
+// validateAddrs checks a list of addresses as the account service does.
+func validateAddrs(addrs []string) error {
+	for _, addr := range addrs {
+		switch addr {
+		case keywordNone:
+			if len(addrs) != 1 {
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("none can not be combined with other addresses"))
+			}
+		case keywordDefault:
+		default:
+			if _, err := ma.NewMultiaddr(addr); err != nil {
+				return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid address %q: %w", addr, err))
+			}
+		}
+	}
+
+	return nil
+}
+
+// Keys returns the keys of the settings, sorted.
+func Keys() []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Settings returns the settings of config, sorted by key.
+func Settings(config *accounttypes.NetworkConfig) []Setting {
+	if config == nil {
+		config = &accounttypes.NetworkConfig{}
+	}
+
+	settings := make([]Setting, 0, len(fields))
+	for _, key := range Keys() {
+		f := fields[key]
+		settings = append(settings, Setting{Key: key, Value: f.get(config), Help: f.help})
+	}
+
+	return settings
+}
+
+// Set changes a setting of config, it fails without changing it when the
+// key is unknown or the value is invalid.
+func Set(config *accounttypes.NetworkConfig, key, value string) error {
+	f, ok := fields[key]
+	if !ok {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown setting %q, expected one of: %s", key, strings.Join(Keys(), ", ")))
+	}
+
+	return f.set(config, strings.TrimSpace(value))
+}
+
+// Store is the network configuration of an account, kept in its root
+// datastore.
+type Store struct {
+	mu sync.Mutex
+	ds datastore.Datastore
+}
+
+func NewStore(ds datastore.Datastore) *Store {
+	return &Store{ds: ds}
+}
+
+// NetworkConfig returns the configuration of the account, an empty one, all
+// the settings being left to the defaults of the node, when none was saved.
+func (s *Store) NetworkConfig(ctx context.Context) (*accounttypes.NetworkConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.load(ctx)
+}
+
+func (s *Store) load(ctx context.Context) (*accounttypes.NetworkConfig, error) {
+	config := &accounttypes.NetworkConfig{}
+
+	data, err := s.ds.Get(ctx, datastore.NewKey(accountutils.AccountNetConfFileName))
+	switch err {
+	case nil:
+	case datastore.ErrNotFound:
+		return config, nil
+	default:
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := config.Unmarshal(data); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return config, nil
+}
+
+// Set changes and saves a setting of the configuration, the updated
+// configuration is returned.
+func (s *Store) Set(ctx context.Context, key, value string) (*accounttypes.NetworkConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Set(config, key, value); err != nil {
+		return nil, err
+	}
+
+	data, err := config.Marshal()
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := s.ds.Put(ctx, datastore.NewKey(accountutils.AccountNetConfFileName), data); err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return config, nil
+}
+
+// IsProximity returns true for the keys of the proximity transports, they
+// depend on the Bluetooth state of the net manager of the node.
+func IsProximity(key string) bool {
+	return key == KeyBLE || key == KeyMultipeer || key == KeyNearby
+}
+
+// ProximityDisabled returns true when every proximity transport is turned
+// off in config.
+func ProximityDisabled(config *accounttypes.NetworkConfig) bool {
+	return config.GetBluetoothLE() == accounttypes.NetworkConfig_Disabled &&
+		config.GetAppleMultipeerConnectivity() == accounttypes.NetworkConfig_Disabled &&
+		config.GetAndroidNearby() == accounttypes.NetworkConfig_Disabled
+}
@@ -0,0 +1,97 @@
+package netconf
+
+import (
+	"context"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/accounttypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func settingValue(t *testing.T, config *accounttypes.NetworkConfig, key string) string {
+	t.Helper()
+
+	for _, s := range Settings(config) {
+		if s.Key == key {
+			return s.Value
+		}
+	}
+
+	t.Fatalf("unknown setting %q", key)
+	return ""
+}
+
+func TestSet(t *testing.T) {
+	config := &accounttypes.NetworkConfig{}
+	for _, s := range Settings(config) {
+		require.Equal(t, Default, s.Value, s.Key)
+	}
+
+	require.NoError(t, Set(config, KeyMDNS, "OFF"))
+	require.Equal(t, accounttypes.NetworkConfig_Disabled, config.MDNS)
+	require.Equal(t, "off", settingValue(t, config, KeyMDNS))
+
+	require.NoError(t, Set(config, KeyDHT, "auto-server"))
+	require.Equal(t, accounttypes.NetworkConfig_DHTAutoServer, config.DHT)
+
+	// the peer IDs are case sensitive
+	relay := "/ip4/1.2.3.4/tcp/4040/p2p/12D3KooWHhDBv6DJJ4XDWjzEXq6sVNEs6VuxsV1WyBBEhPENHzcZ"
+	require.NoError(t, Set(config, KeyStaticRelay, "default, "+relay))
+	require.Equal(t, []string{keywordDefault, relay}, config.StaticRelay)
+	require.Equal(t, "default,"+relay, settingValue(t, config, KeyStaticRelay))
+
+	require.NoError(t, Set(config, KeyBootstrap, "none"))
+	require.Equal(t, []string{keywordNone}, config.Bootstrap)
+
+	// an invalid value leaves the setting as is
+	require.True(t, errcode.Is(Set(config, KeyBootstrap, "none,"+relay), errcode.ErrInvalidInput))
+	require.True(t, errcode.Is(Set(config, KeyRendezvous, "not-an-address"), errcode.ErrInvalidInput))
+	require.True(t, errcode.Is(Set(config, KeyMDNS, "maybe"), errcode.ErrInvalidInput))
+	require.True(t, errcode.Is(Set(config, "unknown", "on"), errcode.ErrInvalidInput))
+	require.True(t, errcode.Is(Set(config, KeyTor, "required"), errcode.ErrNotImplemented))
+	require.Equal(t, []string{keywordNone}, config.Bootstrap)
+	require.Equal(t, accounttypes.NetworkConfig_Disabled, config.MDNS)
+	require.Equal(t, accounttypes.NetworkConfig_TorUndefined, config.Tor)
+}
+
+func TestProximity(t *testing.T) {
+	config := &accounttypes.NetworkConfig{}
+	require.False(t, ProximityDisabled(config))
+
+	for _, key := range []string{KeyBLE, KeyMultipeer, KeyNearby} {
+		require.True(t, IsProximity(key))
+		require.NoError(t, Set(config, key, "off"))
+	}
+	require.True(t, ProximityDisabled(config))
+	require.False(t, IsProximity(KeyMDNS))
+
+	require.NoError(t, Set(config, KeyBLE, "on"))
+	require.False(t, ProximityDisabled(config))
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	config, err := store.NetworkConfig(ctx)
+	require.NoError(t, err)
+	require.Equal(t, &accounttypes.NetworkConfig{}, config)
+
+	_, err = store.Set(ctx, KeyMDNS, "off")
+	require.NoError(t, err)
+	config, err = store.Set(ctx, KeyDHT, "server")
+	require.NoError(t, err)
+	require.Equal(t, accounttypes.NetworkConfig_Disabled, config.MDNS)
+
+	_, err = store.Set(ctx, KeyDHT, "sometimes")
+	require.Error(t, err)
+
+	config, err = store.NetworkConfig(ctx)
+	require.NoError(t, err)
+	require.Equal(t, accounttypes.NetworkConfig_Disabled, config.MDNS)
+	require.Equal(t, accounttypes.NetworkConfig_DHTServer, config.DHT)
+}
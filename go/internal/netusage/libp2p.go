@@ -0,0 +1,59 @@
+package netusage
+
+import (
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/metrics"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// BandwidthReporter is the part of the libp2p bandwidth reporter used by
+// the counter, the reporter of the ipfs node.
+type BandwidthReporter interface {
+	GetBandwidthByPeer() map[peer.ID]metrics.Stats
+}
+
+type libp2pSource struct {
+	reporter BandwidthReporter
+	host     host.Host
+}
+
+// NewLibp2pSource reads the traffic from reporter and the connections from
+// the network of h.
+func NewLibp2pSource(reporter BandwidthReporter, h host.Host) Source {
+	return &libp2pSource{reporter: reporter, host: h}
+}
+
+func (s *libp2pSource) BandwidthByPeer() map[string]PeerTotals {
+	stats := s.reporter.GetBandwidthByPeer()
+
+	totals := make(map[string]PeerTotals, len(stats))
+	for p, stat := range stats {
+		totals[p.String()] = PeerTotals{In: stat.TotalIn, Out: stat.TotalOut}
+	}
+
+	return totals
+}
+
+func (s *libp2pSource) Transport(peerID string) string {
+	p, err := peer.Decode(peerID)
+	if err != nil {
+		return ""
+	}
+
+	// libp2p uses the direct connections first, a relayed one is only left
+	// when there is none
+	transport := ""
+	for _, conn := range s.host.Network().ConnsToPeer(p) {
+		names := []string{}
+		for _, proto := range conn.RemoteMultiaddr().Protocols() {
+			names = append(names, proto.Name)
+		}
+
+		transport = Classify(names)
+		if transport != TransportRelay {
+			break
+		}
+	}
+
+	return transport
+}
@@ -0,0 +1,39 @@
+package netusage
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	transportBytesDesc = prometheus.NewDesc(
+		"berty_network_transport_bytes_total",
+		"Bytes exchanged with the peers by transport.",
+		[]string{"transport", "direction"}, nil,
+	)
+	groupBytesDesc = prometheus.NewDesc(
+		"berty_network_group_bytes_total",
+		"Bytes exchanged with the peers by group, a peer member of several groups is counted in each of them.",
+		[]string{"group", "direction"}, nil,
+	)
+)
+
+var _ prometheus.Collector = (*Counter)(nil)
+
+func (c *Counter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- transportBytesDesc
+	ch <- groupBytesDesc
+}
+
+func (c *Counter) Collect(ch chan<- prometheus.Metric) {
+	usage := c.Usage()
+
+	for transport, stats := range usage.Transports {
+		ch <- prometheus.MustNewConstMetric(transportBytesDesc, prometheus.CounterValue, float64(stats.BytesSent), transport, "sent")
+		ch <- prometheus.MustNewConstMetric(transportBytesDesc, prometheus.CounterValue, float64(stats.BytesReceived), transport, "received")
+	}
+
+	for groupPK, stats := range usage.Groups {
+		ch <- prometheus.MustNewConstMetric(groupBytesDesc, prometheus.CounterValue, float64(stats.BytesSent), groupPK, "sent")
+		ch <- prometheus.MustNewConstMetric(groupBytesDesc, prometheus.CounterValue, float64(stats.BytesReceived), groupPK, "received")
+	}
+}
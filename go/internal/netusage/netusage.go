@@ -0,0 +1,231 @@
+// Package netusage attributes the bytes exchanged with the peers to the
+// transports they are reached through and to the groups they are members
+// of, so that the users on metered connections can see where their data
+// goes. The traffic is read from the per-peer counters of the libp2p
+// bandwidth reporter, polled at a regular interval, the difference since
+// the previous poll is attributed to the current connection of each peer.
+package netusage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// The transports the traffic is attributed to.
+const (
+	TransportTCP   = "tcp"
+	TransportQUIC  = "quic"
+	TransportRelay = "relay"
+	// TransportBLE is any proximity transport, BLE or nearby.
+	TransportBLE = "ble"
+	// TransportOther is used for the other transports and for the peers
+	// which were never seen connected.
+	TransportOther = "other"
+)
+
+// DefaultPollInterval is the interval used by the node between two polls
+// of the bandwidth reporter.
+const DefaultPollInterval = 10 * time.Second
+
+// Stats counts the bytes exchanged.
+type Stats struct {
+	BytesSent     uint64 `json:"bytes_sent"`
+	BytesReceived uint64 `json:"bytes_received"`
+}
+
+func (s *Stats) add(sent, received uint64) {
+	s.BytesSent += sent
+	s.BytesReceived += received
+}
+
+// Usage is the traffic since the counter was created.
+type Usage struct {
+	Since time.Time `json:"since"`
+	Total Stats     `json:"total"`
+	// Transports is the traffic by transport.
+	Transports map[string]Stats `json:"transports"`
+	// Groups is the traffic by group public key, the traffic of a peer
+	// member of several groups is counted in each of them.
+	Groups map[string]Stats `json:"groups"`
+}
+
+// PeerTotals is the traffic exchanged with a peer since it was first seen.
+type PeerTotals struct {
+	In  int64
+	Out int64
+}
+
+// Source reads the traffic and the connections of the node, see
+// NewLibp2pSource.
+type Source interface {
+	// BandwidthByPeer returns the traffic exchanged with each peer.
+	BandwidthByPeer() map[string]PeerTotals
+	// Transport returns the transport of the connection to the peer, it is
+	// empty when the peer is not connected.
+	Transport(peerID string) string
+}
+
+// Counter accumulates the traffic read from its Source.
+type Counter struct {
+	source Source
+
+	mu            sync.Mutex
+	usage         Usage
+	last          map[string]PeerTotals
+	lastTransport map[string]string
+	peerGroups    map[string]map[string]struct{}
+}
+
+func New(source Source) *Counter {
+	c := &Counter{
+		source:        source,
+		last:          map[string]PeerTotals{},
+		lastTransport: map[string]string{},
+		peerGroups:    map[string]map[string]struct{}{},
+	}
+	c.usage = Usage{Since: time.Now(), Transports: map[string]Stats{}, Groups: map[string]Stats{}}
+
+	// the traffic exchanged before the counter was created is not counted
+	for peerID, totals := range source.BandwidthByPeer() {
+		c.last[peerID] = totals
+	}
+
+	return c
+}
+
+// Associate attributes the next traffic of a peer to a group it is a member
+// of, until the counter is discarded.
+func (c *Counter) Associate(peerID string, groupPK string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	groups, ok := c.peerGroups[peerID]
+	if !ok {
+		groups = map[string]struct{}{}
+		c.peerGroups[peerID] = groups
+	}
+	groups[groupPK] = struct{}{}
+}
+
+// Poll attributes the traffic since the previous poll.
+func (c *Counter) Poll() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// read with the lock held, so that concurrent polls are applied in order
+	for peerID, current := range c.source.BandwidthByPeer() {
+		previous := c.last[peerID]
+		c.last[peerID] = current
+
+		// the reporter forgets the idle peers, their counters then start
+		// again from zero
+		if current.In < previous.In || current.Out < previous.Out {
+			previous = PeerTotals{}
+		}
+
+		sent, received := uint64(current.Out-previous.Out), uint64(current.In-previous.In)
+		if sent == 0 && received == 0 {
+			continue
+		}
+
+		transport := c.source.Transport(peerID)
+		if transport == "" {
+			transport = c.lastTransport[peerID]
+		} else {
+			c.lastTransport[peerID] = transport
+		}
+		if transport == "" {
+			transport = TransportOther
+		}
+
+		c.usage.Total.add(sent, received)
+
+		stats := c.usage.Transports[transport]
+		stats.add(sent, received)
+		c.usage.Transports[transport] = stats
+
+		for groupPK := range c.peerGroups[peerID] {
+			stats := c.usage.Groups[groupPK]
+			stats.add(sent, received)
+			c.usage.Groups[groupPK] = stats
+		}
+	}
+}
+
+// Usage polls the source and returns the traffic counted so far.
+func (c *Counter) Usage() *Usage {
+	if c == nil {
+		return nil
+	}
+
+	c.Poll()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	usage := &Usage{
+		Since:      c.usage.Since,
+		Total:      c.usage.Total,
+		Transports: make(map[string]Stats, len(c.usage.Transports)),
+		Groups:     make(map[string]Stats, len(c.usage.Groups)),
+	}
+	for transport, stats := range c.usage.Transports {
+		usage.Transports[transport] = stats
+	}
+	for groupPK, stats := range c.usage.Groups {
+		usage.Groups[groupPK] = stats
+	}
+
+	return usage
+}
+
+// Run polls the source every interval until ctx is done, so that the
+// traffic is attributed to the connection it went through.
+func (c *Counter) Run(ctx context.Context, interval time.Duration) {
+	if c == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Poll()
+		}
+	}
+}
+
+// Classify returns the transport of a connection from the names of the
+// protocols of its remote multiaddr, e.g. ip4, udp and quic-v1.
+func Classify(protocols []string) string {
+	has := map[string]bool{}
+	for _, p := range protocols {
+		has[p] = true
+	}
+
+	switch {
+	case has["p2p-circuit"]:
+		return TransportRelay
+	case has["mc"]:
+		return TransportBLE
+	case has["quic"], has["quic-v1"]:
+		return TransportQUIC
+	case has["tcp"]:
+		return TransportTCP
+	default:
+		return TransportOther
+	}
+}
@@ -0,0 +1,117 @@
+package netusage
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type testSource struct {
+	mu         sync.Mutex
+	totals     map[string]PeerTotals
+	transports map[string]string
+}
+
+func newTestSource() *testSource {
+	return &testSource{totals: map[string]PeerTotals{}, transports: map[string]string{}}
+}
+
+func (s *testSource) BandwidthByPeer() map[string]PeerTotals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := map[string]PeerTotals{}
+	for p, t := range s.totals {
+		totals[p] = t
+	}
+	return totals
+}
+
+func (s *testSource) Transport(peerID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.transports[peerID]
+}
+
+func (s *testSource) set(peerID string, in, out int64, transport string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totals[peerID] = PeerTotals{In: in, Out: out}
+	s.transports[peerID] = transport
+}
+
+func TestCounter(t *testing.T) {
+	source := newTestSource()
+	// exchanged before the counter was created
+	source.set("peerA", 1000, 1000, TransportTCP)
+
+	c := New(source)
+	c.Associate("peerA", "group1")
+	c.Associate("peerB", "group1")
+	c.Associate("peerB", "group2")
+
+	source.set("peerA", 1100, 1050, TransportTCP)
+	source.set("peerB", 10, 20, TransportQUIC)
+	c.Poll()
+
+	// peerA moved to a relay, then disconnected
+	source.set("peerA", 1200, 1050, TransportRelay)
+	c.Poll()
+	source.set("peerA", 1300, 1050, "")
+	source.set("peerC", 5, 5, "")
+
+	usage := c.Usage()
+	require.Equal(t, Stats{BytesReceived: 315, BytesSent: 75}, usage.Total)
+	require.Equal(t, map[string]Stats{
+		TransportTCP:   {BytesReceived: 100, BytesSent: 50},
+		TransportRelay: {BytesReceived: 200},
+		TransportQUIC:  {BytesReceived: 10, BytesSent: 20},
+		TransportOther: {BytesReceived: 5, BytesSent: 5},
+	}, usage.Transports)
+	require.Equal(t, map[string]Stats{
+		"group1": {BytesReceived: 310, BytesSent: 70},
+		"group2": {BytesReceived: 10, BytesSent: 20},
+	}, usage.Groups)
+
+	// the reporter forgot peerB, its counters start again
+	source.set("peerB", 3, 4, TransportQUIC)
+	usage = c.Usage()
+	require.Equal(t, Stats{BytesReceived: 13, BytesSent: 24}, usage.Transports[TransportQUIC])
+}
+
+func TestCounterMetrics(t *testing.T) {
+	source := newTestSource()
+	c := New(source)
+	c.Associate("peerA", "group1")
+	source.set("peerA", 10, 20, TransportBLE)
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(c))
+
+	expected := `
+# HELP berty_network_transport_bytes_total Bytes exchanged with the peers by transport.
+# TYPE berty_network_transport_bytes_total counter
+berty_network_transport_bytes_total{direction="received",transport="ble"} 10
+berty_network_transport_bytes_total{direction="sent",transport="ble"} 20
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "berty_network_transport_bytes_total"))
+	require.Equal(t, 4, testutil.CollectAndCount(c))
+}
+
+func TestClassify(t *testing.T) {
+	for expected, protocols := range map[string][]string{
+		TransportTCP:   {"ip4", "tcp"},
+		TransportQUIC:  {"ip6", "udp", "quic-v1"},
+		TransportRelay: {"ip4", "udp", "quic", "p2p", "p2p-circuit"},
+		TransportBLE:   {"mc"},
+		TransportOther: {"ip4", "udp", "webrtc"},
+	} {
+		require.Equal(t, expected, Classify(protocols), protocols)
+	}
+}
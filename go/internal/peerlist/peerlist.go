@@ -0,0 +1,333 @@
+// Package peerlist keeps the bootstrap peers and the relays added to an
+// account at runtime, in addition to the ones of the flags and the config,
+// so that a node can be pointed at its own infrastructure without editing
+// its config file.
+//
+// The entries are stored in the account root datastore and merged with the
+// configured ones when the node starts. The Manager also dials them as soon
+// as they are added.
+package peerlist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Kind is the role of a peer of the list.
+type Kind string
+
+const (
+	// KindBootstrap is a peer dialed at startup to join the network.
+	KindBootstrap Kind = "bootstrap"
+
+	// KindRelay is a static relay, the node keeps a connection to it and
+	// reserves a slot when it is not reachable directly.
+	KindRelay Kind = "relay"
+)
+
+// Key is the key of the list in the account root datastore.
+var Key = datastore.NewKey("peer-list")
+
+// DialTimeout bounds the dial of an added peer.
+const DialTimeout = 30 * time.Second
+
+// List are the entries added to the account, as multiaddrs ending with
+// the /p2p/ component of the peer.
+type List struct {
+	Bootstrap []string `json:"bootstrap"`
+	Relays    []string `json:"relays"`
+}
+
+func (l *List) entries(kind Kind) *[]string {
+	switch kind {
+	case KindBootstrap:
+		return &l.Bootstrap
+	case KindRelay:
+		return &l.Relays
+	}
+	return nil
+}
+
+// ParseKind parses the name of a kind.
+func ParseKind(s string) (Kind, error) {
+	switch kind := Kind(s); kind {
+	case KindBootstrap, KindRelay:
+		return kind, nil
+	}
+
+	return "", errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown peer kind %q, expected %q or %q", s, KindBootstrap, KindRelay))
+}
+
+// ParseAddr validates an entry, it must be a multiaddr with the address of
+// the peer and its /p2p/ component, e.g. /ip4/1.2.3.4/tcp/4001/p2p/12D3Koo....
+// It returns the canonical form of the multiaddr.
+func ParseAddr(addr string) (string, *peer.AddrInfo, error) {
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return "", nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid multiaddr %q: %w", addr, err))
+	}
+
+	info, err := peer.AddrInfoFromP2pAddr(maddr)
+	if err != nil {
+		return "", nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the multiaddr %q must end with the /p2p/ component of the peer: %w", addr, err))
+	}
+
+	if len(info.Addrs) == 0 {
+		return "", nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the multiaddr %q has no address to dial", addr))
+	}
+
+	return maddr.String(), info, nil
+}
+
+// Store stores the list in the account root datastore.
+type Store struct {
+	ds datastore.Datastore
+	mu sync.Mutex
+}
+
+func New(ds datastore.Datastore) *Store {
+	return &Store{ds: ds}
+}
+
+// Get returns the list, empty when nothing was added.
+func (s *Store) Get(ctx context.Context) (*List, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.get(ctx)
+}
+
+func (s *Store) get(ctx context.Context) (*List, error) {
+	list := &List{Bootstrap: []string{}, Relays: []string{}}
+
+	raw, err := s.ds.Get(ctx, Key)
+	if err == datastore.ErrNotFound {
+		return list, nil
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := json.Unmarshal(raw, list); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return list, nil
+}
+
+func (s *Store) put(ctx context.Context, list *List) error {
+	raw, err := json.Marshal(list)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := s.ds.Put(ctx, Key, raw); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// Add validates addr with ParseAddr and adds it to the entries of kind, it
+// does nothing if the entry is already there.
+func (s *Store) Add(ctx context.Context, kind Kind, addr string) (*List, *peer.AddrInfo, error) {
+	if _, err := ParseKind(string(kind)); err != nil {
+		return nil, nil, err
+	}
+
+	addr, info, err := ParseAddr(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.get(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := list.entries(kind)
+	for _, entry := range *entries {
+		if entry == addr {
+			return list, info, nil
+		}
+	}
+	*entries = append(*entries, addr)
+
+	if err := s.put(ctx, list); err != nil {
+		return nil, nil, err
+	}
+
+	return list, info, nil
+}
+
+// Remove removes addr from the entries of kind, it fails with ErrNotFound if
+// it is not there.
+func (s *Store) Remove(ctx context.Context, kind Kind, addr string) (*List, error) {
+	if _, err := ParseKind(string(kind)); err != nil {
+		return nil, err
+	}
+
+	// the entries are stored in the canonical form
+	if maddr, err := ma.NewMultiaddr(addr); err == nil {
+		addr = maddr.String()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := list.entries(kind)
+	kept := []string{}
+	for _, entry := range *entries {
+		if entry != addr {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == len(*entries) {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("%s %q is not in the list", kind, addr))
+	}
+	*entries = kept
+
+	if err := s.put(ctx, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Host dials the peers, it is implemented by the libp2p host.
+type Host interface {
+	Connect(ctx context.Context, pi peer.AddrInfo) error
+}
+
+// Peering keeps a connection to the relays, it is implemented by the
+// peering service of the IPFS node.
+type Peering interface {
+	AddPeer(info peer.AddrInfo)
+	RemovePeer(id peer.ID)
+}
+
+// Configured are the entries from the flags and the config, they cannot be
+// removed at runtime.
+type Configured struct {
+	Bootstrap []string
+	Relays    []string
+}
+
+// Manager applies the changes of the list to the running node.
+type Manager struct {
+	store      *Store
+	host       Host
+	peering    Peering
+	configured Configured
+	logger     *zap.Logger
+}
+
+// NewManager returns a manager of the list of store. The changes are only
+// stored, to be applied at the next start, when host is nil, e.g. when the
+// network is disabled.
+func NewManager(store *Store, host Host, peering Peering, configured Configured, logger *zap.Logger) *Manager {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &Manager{
+		store:      store,
+		host:       host,
+		peering:    peering,
+		configured: configured,
+		logger:     logger,
+	}
+}
+
+// Result is the reply of the calls of the service.
+type Result struct {
+	List       List
+	Configured Configured
+	// Connected is set by Add when the added peer was dialed successfully.
+	Connected bool
+	// DialError is why the added peer could not be dialed, the entry is
+	// kept anyway.
+	DialError string
+}
+
+func (m *Manager) List(ctx context.Context) (*Result, error) {
+	list, err := m.store.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{List: *list, Configured: m.configured}, nil
+}
+
+// Add stores the entry and dials it right away, the relays are kept
+// connected.
+func (m *Manager) Add(ctx context.Context, kind Kind, addr string) (*Result, error) {
+	list, info, err := m.store.Add(ctx, kind, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{List: *list, Configured: m.configured}
+	if m.host == nil {
+		return result, nil
+	}
+
+	if kind == KindRelay && m.peering != nil {
+		m.peering.AddPeer(*info)
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, DialTimeout)
+	defer cancel()
+
+	if err := m.host.Connect(dialCtx, *info); err != nil {
+		m.logger.Warn("unable to dial the added peer", zap.String("kind", string(kind)), zap.String("peer", info.ID.String()), zap.Error(err))
+		result.DialError = err.Error()
+	} else {
+		result.Connected = true
+	}
+
+	return result, nil
+}
+
+// Remove removes the entry, a relay is no longer kept connected unless
+// another entry, or a configured relay, has the same peer.
+func (m *Manager) Remove(ctx context.Context, kind Kind, addr string) (*Result, error) {
+	list, err := m.store.Remove(ctx, kind, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == KindRelay && m.peering != nil && m.host != nil {
+		if _, removed, err := ParseAddr(addr); err == nil && !hasPeer(list.Relays, removed.ID) && !hasPeer(m.configured.Relays, removed.ID) {
+			m.peering.RemovePeer(removed.ID)
+		}
+	}
+
+	return &Result{List: *list, Configured: m.configured}, nil
+}
+
+func hasPeer(entries []string, id peer.ID) bool {
+	for _, entry := range entries {
+		if _, info, err := ParseAddr(entry); err == nil && info.ID == id {
+			return true
+		}
+	}
+	return false
+}
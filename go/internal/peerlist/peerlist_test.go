@@ -0,0 +1,207 @@
+package peerlist
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func testPeerID(t *testing.T) peer.ID {
+	t.Helper()
+
+	_, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+
+	id, err := peer.IDFromPublicKey(pub)
+	require.NoError(t, err)
+
+	return id
+}
+
+type testHost struct {
+	dialed []peer.ID
+	err    error
+}
+
+func (h *testHost) Connect(_ context.Context, pi peer.AddrInfo) error {
+	h.dialed = append(h.dialed, pi.ID)
+	return h.err
+}
+
+type testPeering map[peer.ID]bool
+
+func (p testPeering) AddPeer(info peer.AddrInfo) { p[info.ID] = true }
+func (p testPeering) RemovePeer(id peer.ID)      { delete(p, id) }
+
+func TestParseAddr(t *testing.T) {
+	id := testPeerID(t)
+
+	addr, info, err := ParseAddr(fmt.Sprintf("/ip4/1.2.3.4/tcp/4001/p2p/%s", id))
+	require.NoError(t, err)
+	require.Equal(t, id, info.ID)
+	require.Len(t, info.Addrs, 1)
+	require.Equal(t, fmt.Sprintf("/ip4/1.2.3.4/tcp/4001/p2p/%s", id), addr)
+
+	for _, invalid := range []string{
+		"",
+		"not a multiaddr",
+		"/ip4/1.2.3.4/tcp/4001",
+		fmt.Sprintf("/p2p/%s", id),
+	} {
+		_, _, err := ParseAddr(invalid)
+		require.True(t, errcode.Is(err, errcode.ErrInvalidInput), invalid)
+	}
+
+	_, err = ParseKind("rdvp")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	ds := ds_sync.MutexWrap(datastore.NewMapDatastore())
+	s := New(ds)
+
+	list, err := s.Get(ctx)
+	require.NoError(t, err)
+	require.Empty(t, list.Bootstrap)
+	require.Empty(t, list.Relays)
+
+	bootstrap := fmt.Sprintf("/ip4/1.2.3.4/tcp/4001/p2p/%s", testPeerID(t))
+	relay := fmt.Sprintf("/dns4/relay.example.com/udp/4001/quic/p2p/%s", testPeerID(t))
+
+	_, _, err = s.Add(ctx, KindBootstrap, bootstrap)
+	require.NoError(t, err)
+	_, _, err = s.Add(ctx, KindBootstrap, bootstrap)
+	require.NoError(t, err)
+	_, _, err = s.Add(ctx, KindRelay, relay)
+	require.NoError(t, err)
+
+	// shared by the stores of the datastore
+	list, err = New(ds).Get(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{bootstrap}, list.Bootstrap)
+	require.Equal(t, []string{relay}, list.Relays)
+
+	_, _, err = s.Add(ctx, KindRelay, "/ip4/1.2.3.4/tcp/4001")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	list, err = s.Remove(ctx, KindBootstrap, bootstrap)
+	require.NoError(t, err)
+	require.Empty(t, list.Bootstrap)
+	require.Equal(t, []string{relay}, list.Relays)
+
+	_, err = s.Remove(ctx, KindBootstrap, bootstrap)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	host, peering := &testHost{}, testPeering{}
+	configured := Configured{Bootstrap: []string{"/dnsaddr/bootstrap.libp2p.io"}, Relays: []string{}}
+	m := NewManager(New(ds_sync.MutexWrap(datastore.NewMapDatastore())), host, peering, configured, nil)
+
+	relayID := testPeerID(t)
+	relay := fmt.Sprintf("/ip4/1.2.3.4/udp/4001/quic/p2p/%s", relayID)
+
+	result, err := m.Add(ctx, KindRelay, relay)
+	require.NoError(t, err)
+	require.True(t, result.Connected)
+	require.Equal(t, []string{relay}, result.List.Relays)
+	require.Equal(t, configured, result.Configured)
+	require.Equal(t, []peer.ID{relayID}, host.dialed)
+	require.True(t, peering[relayID])
+
+	// an unreachable peer is kept
+	host.err = fmt.Errorf("unreachable")
+	result, err = m.Add(ctx, KindBootstrap, fmt.Sprintf("/ip4/5.6.7.8/tcp/4001/p2p/%s", testPeerID(t)))
+	require.NoError(t, err)
+	require.False(t, result.Connected)
+	require.Equal(t, "unreachable", result.DialError)
+	require.Len(t, result.List.Bootstrap, 1)
+
+	// the relay is still kept connected through another address
+	other := fmt.Sprintf("/ip4/1.2.3.4/tcp/4001/p2p/%s", relayID)
+	_, err = m.Add(ctx, KindRelay, other)
+	require.NoError(t, err)
+	_, err = m.Remove(ctx, KindRelay, relay)
+	require.NoError(t, err)
+	require.True(t, peering[relayID])
+
+	result, err = m.Remove(ctx, KindRelay, other)
+	require.NoError(t, err)
+	require.Empty(t, result.List.Relays)
+	require.False(t, peering[relayID])
+
+	// without network, the entries are only stored
+	offline := NewManager(New(ds_sync.MutexWrap(datastore.NewMapDatastore())), nil, nil, Configured{}, nil)
+	result, err = offline.Add(ctx, KindRelay, relay)
+	require.NoError(t, err)
+	require.False(t, result.Connected)
+	require.Empty(t, result.DialError)
+}
+
+func TestRPC(t *testing.T) {
+	ctx := context.Background()
+	host := &testHost{}
+
+	l := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	Register(server, NewManager(New(ds_sync.MutexWrap(datastore.NewMapDatastore())), host, testPeering{}, Configured{}, nil))
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.Dial("buf",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	bootstrap := fmt.Sprintf("/ip4/1.2.3.4/tcp/4001/p2p/%s", testPeerID(t))
+
+	result, err := AddPeer(ctx, cc, KindBootstrap, bootstrap)
+	require.NoError(t, err)
+	require.True(t, result.Connected)
+	require.Len(t, host.dialed, 1)
+
+	result, err = Get(ctx, cc)
+	require.NoError(t, err)
+	require.Equal(t, []string{bootstrap}, result.List.Bootstrap)
+
+	result, err = RemovePeer(ctx, cc, KindBootstrap, bootstrap)
+	require.NoError(t, err)
+	require.Empty(t, result.List.Bootstrap)
+
+	_, err = AddPeer(ctx, cc, KindBootstrap, "/ip4/1.2.3.4/tcp/4001")
+	require.Error(t, err)
+}
+
+func TestRPCUnimplemented(t *testing.T) {
+	l := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.Dial("buf",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	_, err = Get(context.Background(), cc)
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+}
@@ -0,0 +1,131 @@
+package peerlist
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/peerlisttypes"
+)
+
+// Get returns the list of the node served by cc.
+func Get(ctx context.Context, cc grpc.ClientConnInterface) (*Result, error) {
+	reply, err := peerlisttypes.NewPeerListServiceClient(cc).List(ctx, &peerlisttypes.List_Request{})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return resultFromProto(reply.Result)
+}
+
+// AddPeer adds an entry to the list of the node served by cc, which dials it
+// right away.
+func AddPeer(ctx context.Context, cc grpc.ClientConnInterface, kind Kind, addr string) (*Result, error) {
+	reply, err := peerlisttypes.NewPeerListServiceClient(cc).Add(ctx, &peerlisttypes.Add_Request{Kind: string(kind), Addr: addr})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return resultFromProto(reply.Result)
+}
+
+// RemovePeer removes an entry from the list of the node served by cc.
+func RemovePeer(ctx context.Context, cc grpc.ClientConnInterface, kind Kind, addr string) (*Result, error) {
+	reply, err := peerlisttypes.NewPeerListServiceClient(cc).Remove(ctx, &peerlisttypes.Remove_Request{Kind: string(kind), Addr: addr})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return resultFromProto(reply.Result)
+}
+
+func rpcError(err error) error {
+	if status.Code(err) == codes.Unimplemented {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the node has no peer list service: %w", err))
+	}
+	return err
+}
+
+// Register adds the peer list service of m to server.
+func Register(server *grpc.Server, m *Manager) {
+	peerlisttypes.RegisterPeerListServiceServer(server, &listServer{manager: m})
+}
+
+type listServer struct {
+	peerlisttypes.UnimplementedPeerListServiceServer
+
+	manager *Manager
+}
+
+func (s *listServer) List(ctx context.Context, _ *peerlisttypes.List_Request) (*peerlisttypes.List_Reply, error) {
+	result, err := s.manager.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &peerlisttypes.List_Reply{Result: result.toProto()}, nil
+}
+
+func (s *listServer) Add(ctx context.Context, req *peerlisttypes.Add_Request) (*peerlisttypes.Add_Reply, error) {
+	kind, err := parseEntry(req.Kind, req.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.manager.Add(ctx, kind, req.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &peerlisttypes.Add_Reply{Result: result.toProto()}, nil
+}
+
+func (s *listServer) Remove(ctx context.Context, req *peerlisttypes.Remove_Request) (*peerlisttypes.Remove_Reply, error) {
+	kind, err := parseEntry(req.Kind, req.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.manager.Remove(ctx, kind, req.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &peerlisttypes.Remove_Reply{Result: result.toProto()}, nil
+}
+
+func parseEntry(kind, addr string) (Kind, error) {
+	parsed, err := ParseKind(kind)
+	if err != nil {
+		return "", err
+	}
+
+	if addr == "" {
+		return "", errcode.ErrMissingInput.Wrap(fmt.Errorf("a multiaddr is required"))
+	}
+
+	return parsed, nil
+}
+
+func (r *Result) toProto() *peerlisttypes.PeerListResult {
+	return &peerlisttypes.PeerListResult{
+		List:       peerlisttypes.PeerList{Bootstrap: r.List.Bootstrap, Relays: r.List.Relays},
+		Configured: peerlisttypes.PeerList{Bootstrap: r.Configured.Bootstrap, Relays: r.Configured.Relays},
+		Connected:  r.Connected,
+		DialError:  r.DialError,
+	}
+}
+
+func resultFromProto(result *peerlisttypes.PeerListResult) (*Result, error) {
+	if result == nil {
+		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("the node returned no peer list"))
+	}
+
+	return &Result{
+		List:       List{Bootstrap: result.List.Bootstrap, Relays: result.List.Relays},
+		Configured: Configured{Bootstrap: result.Configured.Bootstrap, Relays: result.Configured.Relays},
+		Connected:  result.Connected,
+		DialError:  result.DialError,
+	}, nil
+}
@@ -0,0 +1,198 @@
+// Package profileprivacy holds the per-account privacy settings. The main
+// one keeps the profile of the account private: its display name is then
+// never published, neither in its contact links nor in its contact requests
+// and conversations, and its contacts see a short public key instead.
+package profileprivacy
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	datastore "github.com/ipfs/go-datastore"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/pushtypes"
+)
+
+// DatastoreKey is the key of the account configuration in the root
+// datastore.
+const DatastoreKey = "profile_privacy_config"
+
+// Config is the per-account configuration.
+type Config struct {
+	// HideProfile prevents the display name of the account from being
+	// published.
+	HideProfile bool `json:"hide_profile,omitempty"`
+	// DisableTypingIndicators prevents the contacts from being told when a
+	// message is being typed.
+	DisableTypingIndicators bool `json:"disable_typing_indicators,omitempty"`
+	// DisableReadReceipts prevents the contacts from being told when their
+	// messages are read.
+	DisableReadReceipts bool `json:"disable_read_receipts,omitempty"`
+	// PushPayload is what the pushes of the account carry, `full`, `sender`
+	// or `none`, empty is `full`.
+	PushPayload string `json:"push_payload,omitempty"`
+}
+
+// Settings is the configuration of a running account, the changes are
+// saved to its datastore.
+type Settings struct {
+	mu     sync.Mutex
+	ds     datastore.Datastore
+	config Config
+}
+
+// NewSettings returns the settings of the account, ds is optional, the
+// changes are not saved without it.
+func NewSettings(ds datastore.Datastore, config Config) *Settings {
+	return &Settings{ds: ds, config: config}
+}
+
+// HideProfile returns true if the profile must not be published, it is
+// false for nil settings.
+func (s *Settings) HideProfile() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.config.HideProfile
+}
+
+// SetHideProfile changes and saves the setting.
+func (s *Settings) SetHideProfile(ctx context.Context, hide bool) error {
+	return s.update(ctx, func(config *Config) { config.HideProfile = hide })
+}
+
+// SendTypingIndicators returns true if the contacts can be told when a
+// message is being typed, it is true for nil settings.
+func (s *Settings) SendTypingIndicators() bool {
+	if s == nil {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.config.DisableTypingIndicators
+}
+
+// SetSendTypingIndicators changes and saves the setting.
+func (s *Settings) SetSendTypingIndicators(ctx context.Context, send bool) error {
+	return s.update(ctx, func(config *Config) { config.DisableTypingIndicators = !send })
+}
+
+// SendReadReceipts returns true if the contacts can be told when their
+// messages are read, it is true for nil settings.
+func (s *Settings) SendReadReceipts() bool {
+	if s == nil {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.config.DisableReadReceipts
+}
+
+// SetSendReadReceipts changes and saves the setting.
+func (s *Settings) SetSendReadReceipts(ctx context.Context, send bool) error {
+	return s.update(ctx, func(config *Config) { config.DisableReadReceipts = !send })
+}
+
+// PushPayload returns what the pushes of the account carry, it is
+// pushtypes.PayloadFull for nil settings or an unknown saved value.
+func (s *Settings) PushPayload() pushtypes.PayloadLevel {
+	if s == nil {
+		return pushtypes.PayloadFull
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	level, err := pushtypes.ParsePayloadLevel(s.config.PushPayload)
+	if err != nil {
+		return pushtypes.PayloadFull
+	}
+
+	return level
+}
+
+// SetPushPayload changes and saves the setting.
+func (s *Settings) SetPushPayload(ctx context.Context, level pushtypes.PayloadLevel) error {
+	if _, err := pushtypes.ParsePayloadLevel(level.String()); err != nil {
+		return errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	return s.update(ctx, func(config *Config) {
+		config.PushPayload = ""
+		if level != pushtypes.PayloadFull {
+			config.PushPayload = level.String()
+		}
+	})
+}
+
+func (s *Settings) update(ctx context.Context, change func(config *Config)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config := s.config
+	change(&config)
+
+	if s.ds != nil {
+		if err := SaveConfig(ctx, s.ds, config); err != nil {
+			return err
+		}
+	}
+
+	s.config = config
+	return nil
+}
+
+// PublishedDisplayName returns the display name to publish in place of
+// name, it is empty while the profile is hidden.
+func (s *Settings) PublishedDisplayName(name string) string {
+	if s.HideProfile() {
+		return ""
+	}
+
+	return name
+}
+
+// LoadConfig reads the account configuration, a default one is returned if
+// none was saved.
+func LoadConfig(ctx context.Context, ds datastore.Datastore) (Config, error) {
+	var config Config
+
+	data, err := ds.Get(ctx, datastore.NewKey(DatastoreKey))
+	switch err {
+	case nil:
+	case datastore.ErrNotFound:
+		return config, nil
+	default:
+		return config, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return config, nil
+}
+
+// SaveConfig persists the account configuration.
+func SaveConfig(ctx context.Context, ds datastore.Datastore, config Config) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := ds.Put(ctx, datastore.NewKey(DatastoreKey), data); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
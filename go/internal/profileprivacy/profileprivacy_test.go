@@ -0,0 +1,88 @@
+package profileprivacy
+
+import (
+	"context"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/pushtypes"
+)
+
+func TestSettings(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.NewMapDatastore()
+
+	config, err := LoadConfig(ctx, ds)
+	require.NoError(t, err)
+	require.False(t, config.HideProfile)
+
+	settings := NewSettings(ds, config)
+	require.Equal(t, "alice", settings.PublishedDisplayName("alice"))
+
+	require.NoError(t, settings.SetHideProfile(ctx, true))
+	require.True(t, settings.HideProfile())
+	require.Empty(t, settings.PublishedDisplayName("alice"))
+
+	// the setting is kept for the account
+	config, err = LoadConfig(ctx, ds)
+	require.NoError(t, err)
+	require.True(t, config.HideProfile)
+}
+
+func TestSettingsToggles(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.NewMapDatastore()
+
+	settings := NewSettings(ds, Config{})
+	require.True(t, settings.SendTypingIndicators())
+	require.True(t, settings.SendReadReceipts())
+
+	require.NoError(t, settings.SetSendTypingIndicators(ctx, false))
+	require.NoError(t, settings.SetSendReadReceipts(ctx, false))
+	require.False(t, settings.SendTypingIndicators())
+	require.False(t, settings.SendReadReceipts())
+	require.False(t, settings.HideProfile())
+
+	config, err := LoadConfig(ctx, ds)
+	require.NoError(t, err)
+	require.Equal(t, Config{DisableTypingIndicators: true, DisableReadReceipts: true}, config)
+}
+
+func TestSettingsPushPayload(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.NewMapDatastore()
+
+	settings := NewSettings(ds, Config{})
+	require.Equal(t, pushtypes.PayloadFull, settings.PushPayload())
+
+	require.NoError(t, settings.SetPushPayload(ctx, pushtypes.PayloadNone))
+	require.Equal(t, pushtypes.PayloadNone, settings.PushPayload())
+
+	config, err := LoadConfig(ctx, ds)
+	require.NoError(t, err)
+	require.Equal(t, Config{PushPayload: "none"}, config)
+
+	// the full payload is the default, it is not saved
+	require.NoError(t, settings.SetPushPayload(ctx, pushtypes.PayloadFull))
+	config, err = LoadConfig(ctx, ds)
+	require.NoError(t, err)
+	require.Equal(t, Config{}, config)
+
+	require.Error(t, settings.SetPushPayload(ctx, pushtypes.PayloadLevel(42)))
+	require.Equal(t, pushtypes.PayloadFull, settings.PushPayload())
+
+	// an unknown saved value falls back to the full payload
+	require.Equal(t, pushtypes.PayloadFull, NewSettings(nil, Config{PushPayload: "preview"}).PushPayload())
+}
+
+func TestNilSettings(t *testing.T) {
+	var settings *Settings
+
+	require.False(t, settings.HideProfile())
+	require.True(t, settings.SendTypingIndicators())
+	require.True(t, settings.SendReadReceipts())
+	require.Equal(t, pushtypes.PayloadFull, settings.PushPayload())
+	require.Equal(t, "alice", settings.PublishedDisplayName("alice"))
+}
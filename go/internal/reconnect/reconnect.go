@@ -0,0 +1,173 @@
+// Package reconnect runs the reconnections of the node as soon as the
+// network changes, e.g. from offline to online or from wifi to cellular,
+// rather than at the next tick of their backoff. The components register a
+// hook, the scheduler calls the hooks on the connectivity transitions
+// reported by the NetManager.
+package reconnect
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/weshnet/pkg/netmanager"
+)
+
+// DefaultSettleDelay is the time the connectivity must be stable before the
+// hooks are called, a switch of network often goes through several states,
+// e.g. wifi, none then cellular.
+const DefaultSettleDelay = time.Second
+
+// Hook reconnects a component, it is called in its own goroutine.
+type Hook func(ctx context.Context)
+
+// IsReconnection returns true when the connections of the node may have been
+// lost between from and to and should be established again: the node is
+// back online, or changed of network while online. Going offline is not a
+// reconnection, there is nothing to reconnect to.
+func IsReconnection(from, to netmanager.ConnectivityInfo) bool {
+	switch {
+	case to.State == netmanager.ConnectivityStateOff:
+		return false
+	case to.NetType == netmanager.ConnectivityNetNone:
+		return false
+	case from.State != to.State:
+		return true
+	default:
+		return from.NetType != to.NetType
+	}
+}
+
+// Scheduler calls the hooks on the reconnections.
+type Scheduler struct {
+	logger *zap.Logger
+	settle time.Duration
+
+	mu    sync.Mutex
+	hooks map[string]Hook
+}
+
+func New(logger *zap.Logger) *Scheduler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &Scheduler{
+		logger: logger,
+		settle: DefaultSettleDelay,
+		hooks:  map[string]Hook{},
+	}
+}
+
+// SetSettleDelay replaces DefaultSettleDelay, it must be called before Run.
+func (s *Scheduler) SetSettleDelay(d time.Duration) {
+	s.settle = d
+}
+
+// Register adds the hook of a component, it replaces its previous one. The
+// returned function removes it.
+func (s *Scheduler) Register(name string, hook Hook) (unregister func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks[name] = hook
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.hooks, name)
+	}
+}
+
+// Trigger calls all the hooks now, reason is logged.
+func (s *Scheduler) Trigger(ctx context.Context, reason string) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.hooks))
+	hooks := make([]Hook, 0, len(s.hooks))
+	for name := range s.hooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hooks = append(hooks, s.hooks[name])
+	}
+	s.mu.Unlock()
+
+	s.logger.Info("network changed, reconnecting", zap.String("reason", reason), zap.Strings("components", names))
+
+	for _, hook := range hooks {
+		go hook(ctx)
+	}
+}
+
+// Run calls the hooks on the reconnections reported by nm until ctx is
+// done.
+func (s *Scheduler) Run(ctx context.Context, nm *netmanager.NetManager) {
+	current := nm.GetCurrentState()
+
+	// the state before the transitions waiting to settle
+	var settled *netmanager.ConnectivityInfo
+	var timer *time.Timer
+	var timerC <-chan time.Time
+
+	changes := make(chan netmanager.ConnectivityInfo)
+	go func() {
+		state := current
+		for {
+			ok, _ := nm.WaitForStateChange(ctx, &state, netmanager.ConnectivityStateChanged|netmanager.ConnectivityNetTypeChanged)
+			if !ok {
+				return
+			}
+
+			state = nm.GetCurrentState()
+			select {
+			case changes <- state:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+
+		case state := <-changes:
+			if settled == nil {
+				previous := current
+				settled = &previous
+			}
+			current = state
+
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(s.settle)
+			timerC = timer.C
+
+		case <-timerC:
+			timer, timerC = nil, nil
+
+			from := *settled
+			settled = nil
+			if IsReconnection(from, current) {
+				s.Trigger(ctx, describe(from, current))
+			}
+		}
+	}
+}
+
+func describe(from, to netmanager.ConnectivityInfo) string {
+	if from.State != to.State {
+		return "back online on " + to.NetType.String()
+	}
+	return from.NetType.String() + " to " + to.NetType.String()
+}
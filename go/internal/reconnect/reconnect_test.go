@@ -0,0 +1,86 @@
+package reconnect
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/weshnet/pkg/netmanager"
+)
+
+func TestIsReconnection(t *testing.T) {
+	var (
+		offline  = netmanager.ConnectivityInfo{State: netmanager.ConnectivityStateOff, NetType: netmanager.ConnectivityNetNone}
+		wifi     = netmanager.ConnectivityInfo{State: netmanager.ConnectivityStateOn, NetType: netmanager.ConnectivityNetWifi}
+		cellular = netmanager.ConnectivityInfo{State: netmanager.ConnectivityStateOn, NetType: netmanager.ConnectivityNetCellular}
+	)
+
+	require.True(t, IsReconnection(offline, wifi))
+	require.True(t, IsReconnection(wifi, cellular))
+	require.True(t, IsReconnection(netmanager.ConnectivityInfo{}, wifi))
+	require.False(t, IsReconnection(wifi, offline))
+	require.False(t, IsReconnection(wifi, wifi))
+
+	// only the state and the network matter
+	metered := wifi
+	metered.Metering = netmanager.ConnectivityStateOn
+	require.False(t, IsReconnection(wifi, metered))
+}
+
+func TestSchedulerRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nm := netmanager.NewNetManager(netmanager.ConnectivityInfo{State: netmanager.ConnectivityStateOn, NetType: netmanager.ConnectivityNetWifi})
+
+	s := New(nil)
+	s.SetSettleDelay(50 * time.Millisecond)
+
+	calls := make(chan string, 10)
+	s.Register("a", func(context.Context) { calls <- "a" })
+	unregister := s.Register("b", func(context.Context) { calls <- "b" })
+
+	go s.Run(ctx, nm)
+	// let Run read the initial state
+	time.Sleep(20 * time.Millisecond)
+
+	// wifi to cellular through no network, the hooks are called once
+	nm.UpdateState(netmanager.ConnectivityInfo{State: netmanager.ConnectivityStateOn, NetType: netmanager.ConnectivityNetNone})
+	nm.UpdateState(netmanager.ConnectivityInfo{State: netmanager.ConnectivityStateOn, NetType: netmanager.ConnectivityNetCellular})
+
+	received := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case name := <-calls:
+			received[name] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("the hooks were not called")
+		}
+	}
+	require.Equal(t, map[string]bool{"a": true, "b": true}, received)
+
+	// going offline reconnects nothing
+	unregister()
+	nm.UpdateState(netmanager.ConnectivityInfo{State: netmanager.ConnectivityStateOff, NetType: netmanager.ConnectivityNetNone})
+	select {
+	case name := <-calls:
+		t.Fatalf("unexpected call of %s", name)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// back online, the unregistered hook is not called
+	nm.UpdateState(netmanager.ConnectivityInfo{State: netmanager.ConnectivityStateOn, NetType: netmanager.ConnectivityNetWifi})
+	select {
+	case name := <-calls:
+		require.Equal(t, "a", name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hook was not called")
+	}
+	select {
+	case name := <-calls:
+		t.Fatalf("unexpected call of %s", name)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,62 @@
+// Package replicationlag measures the replication lag of the groups, the delay
+// between the creation of a message by its sender and its materialization in
+// the local database, and exports it as prometheus histograms by group.
+//
+// The creation time is the sent date set by the sender, the lag of a peer
+// whose clock is ahead would be negative, such messages are counted in
+// berty_replication_clock_skew_total instead of the histograms.
+package replicationlag
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Recorder records the replication lag of the messages, it is a prometheus
+// collector.
+type Recorder struct {
+	lag       *prometheus.HistogramVec
+	clockSkew *prometheus.CounterVec
+}
+
+var _ prometheus.Collector = (*Recorder)(nil)
+
+// New returns an empty recorder.
+func New() *Recorder {
+	return &Recorder{
+		lag: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "berty_replication_lag_seconds",
+			Help: "Delay between the creation of a message by its sender and its materialization in the local database, by group.",
+			// from 100ms to about 5 days, the messages of an offline peer
+			// are replicated when it comes back online
+			Buckets: prometheus.ExponentialBuckets(0.1, 4, 12),
+		}, []string{"group"}),
+		clockSkew: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "berty_replication_clock_skew_total",
+			Help: "Messages materialized before their creation time, the clock of their sender is ahead, by group.",
+		}, []string{"group"}),
+	}
+}
+
+// Observe records the lag of a message of a group, createdAt is its sent
+// date.
+func (r *Recorder) Observe(groupPK string, createdAt, materializedAt time.Time) {
+	lag := materializedAt.Sub(createdAt)
+	if lag < 0 {
+		r.clockSkew.WithLabelValues(groupPK).Inc()
+		return
+	}
+
+	r.lag.WithLabelValues(groupPK).Observe(lag.Seconds())
+}
+
+func (r *Recorder) Describe(ch chan<- *prometheus.Desc) {
+	r.lag.Describe(ch)
+	r.clockSkew.Describe(ch)
+}
+
+func (r *Recorder) Collect(ch chan<- prometheus.Metric) {
+	r.lag.Collect(ch)
+	r.clockSkew.Collect(ch)
+}
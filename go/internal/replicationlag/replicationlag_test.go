@@ -0,0 +1,38 @@
+package replicationlag
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	r := New()
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(r))
+
+	now := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	r.Observe("group-a", now.Add(-50*time.Millisecond), now)
+	r.Observe("group-a", now.Add(-time.Minute), now)
+	r.Observe("group-b", now.Add(-2*time.Second), now)
+
+	// the clock of the sender is ahead
+	r.Observe("group-b", now.Add(time.Second), now)
+
+	require.Equal(t, 1.0, testutil.ToFloat64(r.clockSkew.WithLabelValues("group-b")))
+	require.Equal(t, 2, testutil.CollectAndCount(r.lag))
+
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP berty_replication_clock_skew_total Messages materialized before their creation time, the clock of their sender is ahead, by group.
+# TYPE berty_replication_clock_skew_total counter
+berty_replication_clock_skew_total{group="group-b"} 1
+`), "berty_replication_clock_skew_total"))
+
+	count, err := testutil.GatherAndCount(registry, "berty_replication_lag_seconds")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
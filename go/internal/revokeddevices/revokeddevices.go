@@ -0,0 +1,125 @@
+// Package revokeddevices keeps the devices of the account revoked by another
+// one in the account datastore, so that the messages and the revocations they
+// send to the account group are still ignored after a restart.
+package revokeddevices
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// Namespace is the key prefix used in the account root datastore.
+const Namespace = "revoked-devices"
+
+// Revocation is the revocation of a device of the account.
+type Revocation struct {
+	DevicePK string `json:"device_public_key"`
+	// By is the device which sent the revocation.
+	By string `json:"by"`
+	// SentDate is the sent date of the revocation, in ms.
+	SentDate int64 `json:"sent_date"`
+}
+
+// Store stores the revocations under `/<device public key>`.
+type Store struct {
+	ds datastore.Datastore
+	mu sync.Mutex
+}
+
+func New(ds datastore.Datastore) *Store {
+	return &Store{
+		ds: namespace.Wrap(ds, datastore.NewKey(Namespace)),
+	}
+}
+
+func deviceKey(devicePK string) (datastore.Key, error) {
+	switch {
+	case devicePK == "":
+		return datastore.Key{}, errcode.ErrMissingInput.Wrap(fmt.Errorf("a device is required"))
+	case strings.Contains(devicePK, "/"):
+		return datastore.Key{}, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid device public key"))
+	}
+
+	return datastore.NewKey(devicePK), nil
+}
+
+// Revoke records the revocation, the first revocation of a device is kept.
+// It returns false if the device was already revoked.
+func (s *Store) Revoke(ctx context.Context, revocation *Revocation) (bool, error) {
+	key, err := deviceKey(revocation.DevicePK)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch has, err := s.ds.Has(ctx, key); {
+	case err != nil:
+		return false, errcode.ErrDBRead.Wrap(err)
+	case has:
+		return false, nil
+	}
+
+	raw, err := json.Marshal(revocation)
+	if err != nil {
+		return false, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := s.ds.Put(ctx, key, raw); err != nil {
+		return false, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return true, nil
+}
+
+// IsRevoked returns true if the device was revoked.
+func (s *Store) IsRevoked(ctx context.Context, devicePK string) (bool, error) {
+	key, err := deviceKey(devicePK)
+	if err != nil {
+		return false, err
+	}
+
+	has, err := s.ds.Has(ctx, key)
+	if err != nil {
+		return false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return has, nil
+}
+
+// List returns the revocations, sorted by device.
+func (s *Store) List(ctx context.Context) ([]*Revocation, error) {
+	res, err := s.ds.Query(ctx, query.Query{})
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	defer res.Close()
+
+	revocations := []*Revocation{}
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, errcode.ErrDBRead.Wrap(r.Error)
+		}
+
+		revocation := &Revocation{}
+		if err := json.Unmarshal(r.Value, revocation); err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+		revocations = append(revocations, revocation)
+	}
+
+	sort.Slice(revocations, func(i, j int) bool { return revocations[i].DevicePK < revocations[j].DevicePK })
+
+	return revocations, nil
+}
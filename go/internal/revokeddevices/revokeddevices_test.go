@@ -0,0 +1,49 @@
+package revokeddevices
+
+import (
+	"context"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+	ds := ds_sync.MutexWrap(datastore.NewMapDatastore())
+	s := New(ds)
+
+	revoked, err := s.IsRevoked(ctx, "d2")
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	added, err := s.Revoke(ctx, &Revocation{DevicePK: "d2", By: "d1", SentDate: 1})
+	require.NoError(t, err)
+	require.True(t, added)
+
+	// the first revocation is kept
+	added, err = s.Revoke(ctx, &Revocation{DevicePK: "d2", By: "d3", SentDate: 2})
+	require.NoError(t, err)
+	require.False(t, added)
+
+	// persisted in the datastore
+	s = New(ds)
+	revoked, err = s.IsRevoked(ctx, "d2")
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	_, err = s.Revoke(ctx, &Revocation{DevicePK: "d0", By: "d1", SentDate: 3})
+	require.NoError(t, err)
+
+	revocations, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []*Revocation{{DevicePK: "d0", By: "d1", SentDate: 3}, {DevicePK: "d2", By: "d1", SentDate: 1}}, revocations)
+
+	_, err = s.Revoke(ctx, &Revocation{})
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+	_, err = s.IsRevoked(ctx, "a/b")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
@@ -0,0 +1,412 @@
+// Package sqliteds is a go-datastore on top of a SQLite (or SQLCipher)
+// table, compatible with the `key TEXT PRIMARY KEY, data BLOB` layout of the
+// sqlds based stores.
+//
+// Statements are prepared once when the datastore is created, and batches are
+// committed as a single transaction instead of one implicit transaction per
+// operation, which makes bulk writes like log replication several times
+// faster.
+package sqliteds
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	_ "github.com/mutecomm/go-sqlcipher/v4" // sqlite3 driver
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// SyncMode is the SQLite `synchronous` pragma, it trades durability on power
+// loss for write speed.
+type SyncMode string
+
+const (
+	SyncOff    SyncMode = "OFF"
+	SyncNormal SyncMode = "NORMAL"
+	SyncFull   SyncMode = "FULL"
+	SyncExtra  SyncMode = "EXTRA"
+)
+
+// DefaultTable is the table used when none is given.
+const DefaultTable = "data"
+
+// saltSize is the size of a SQLCipher salt, and plaintextHeaderSize the size
+// of the header of the database file left in plaintext when the salt is
+// given.
+const (
+	saltSize            = 16
+	plaintextHeaderSize = 32
+)
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Options configures a Datastore.
+type Options struct {
+	// Table defaults to DefaultTable.
+	Table string
+	// Key enables the SQLCipher encryption of the database.
+	Key []byte
+	// JournalMode defaults to WAL.
+	JournalMode string
+	// SyncMode defaults to NORMAL, which is safe from corruption in WAL
+	// journal mode and much faster than FULL.
+	SyncMode SyncMode
+	// Salt is the SQLCipher salt of the database, it is stored outside of
+	// the database file whose header is then left in plaintext, as iOS
+	// requires for the files opened by the background tasks.
+	Salt []byte
+	// MaxBatchSize splits the commit of larger batches in several
+	// transactions, 0 commits every batch in a single transaction.
+	MaxBatchSize int
+}
+
+// Datastore is a datastore.Batching backed by a SQLite table.
+type Datastore struct {
+	db           *sql.DB
+	table        string
+	maxBatchSize int
+
+	get     *sql.Stmt
+	has     *sql.Stmt
+	getSize *sql.Stmt
+	put     *sql.Stmt
+	delete  *sql.Stmt
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ datastore.Batching = (*Datastore)(nil)
+
+// Open opens the database at path, creates the table if needed and prepares
+// the statements of the datastore.
+func Open(ctx context.Context, path string, opts Options) (*Datastore, error) {
+	if path == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("missing path"))
+	}
+
+	table := opts.Table
+	if table == "" {
+		table = DefaultTable
+	}
+	if !tableNameRegexp.MatchString(table) {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid table name %q", table))
+	}
+
+	if opts.MaxBatchSize < 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid max batch size %d", opts.MaxBatchSize))
+	}
+
+	syncMode := opts.SyncMode
+	switch syncMode {
+	case "":
+		syncMode = SyncNormal
+	case SyncOff, SyncNormal, SyncFull, SyncExtra:
+	default:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid sync mode %q", opts.SyncMode))
+	}
+
+	journalMode := opts.JournalMode
+	if journalMode == "" {
+		journalMode = "WAL"
+	}
+
+	if len(opts.Salt) > 0 && len(opts.Salt) != saltSize {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid salt size %d, expected %d", len(opts.Salt), saltSize))
+	}
+
+	// pragmas set in the dsn apply to every connection of the pool
+	params := url.Values{}
+	params.Set("_journal_mode", journalMode)
+	params.Set("_synchronous", string(syncMode))
+	if len(opts.Key) > 0 {
+		params.Set("_pragma_key", fmt.Sprintf("x'%s'", hex.EncodeToString(opts.Key)))
+	}
+	if len(opts.Salt) > 0 {
+		params.Set("_pragma_cipher_plaintext_header_size", strconv.Itoa(plaintextHeaderSize))
+		params.Set("_pragma_cipher_salt", fmt.Sprintf("x'%s'", hex.EncodeToString(opts.Salt)))
+	}
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?%s", path, params.Encode()))
+	if err != nil {
+		return nil, errcode.ErrDBOpen.Wrap(err)
+	}
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (key TEXT PRIMARY KEY, data BLOB)", table)); err != nil {
+		_ = db.Close()
+		return nil, errcode.ErrDBOpen.Wrap(err)
+	}
+
+	d := &Datastore{db: db, table: table, maxBatchSize: opts.MaxBatchSize}
+
+	statements := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&d.get, "SELECT data FROM %s WHERE key = ?"},
+		{&d.has, "SELECT EXISTS(SELECT 1 FROM %s WHERE key = ?)"},
+		{&d.getSize, "SELECT length(data) FROM %s WHERE key = ?"},
+		{&d.put, "INSERT OR REPLACE INTO %s (key, data) VALUES (?, ?)"},
+		{&d.delete, "DELETE FROM %s WHERE key = ?"},
+	}
+	for _, s := range statements {
+		stmt, err := db.PrepareContext(ctx, fmt.Sprintf(s.query, table))
+		if err != nil {
+			_ = d.Close()
+			return nil, errcode.ErrDBOpen.Wrap(err)
+		}
+		*s.stmt = stmt
+	}
+
+	return d, nil
+}
+
+func (d *Datastore) Get(ctx context.Context, key datastore.Key) ([]byte, error) {
+	var data []byte
+	if err := d.get.QueryRowContext(ctx, key.String()).Scan(&data); err == sql.ErrNoRows {
+		return nil, datastore.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (d *Datastore) Has(ctx context.Context, key datastore.Key) (bool, error) {
+	var exists bool
+	if err := d.has.QueryRowContext(ctx, key.String()).Scan(&exists); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (d *Datastore) GetSize(ctx context.Context, key datastore.Key) (int, error) {
+	var size sql.NullInt64
+	if err := d.getSize.QueryRowContext(ctx, key.String()).Scan(&size); err == sql.ErrNoRows {
+		return -1, datastore.ErrNotFound
+	} else if err != nil {
+		return -1, err
+	}
+
+	return int(size.Int64), nil
+}
+
+func (d *Datastore) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	_, err := d.put.ExecContext(ctx, key.String(), value)
+	return err
+}
+
+func (d *Datastore) Delete(ctx context.Context, key datastore.Key) error {
+	_, err := d.delete.ExecContext(ctx, key.String())
+	return err
+}
+
+// Sync is a no-op, durability is ruled by the sync mode.
+func (d *Datastore) Sync(context.Context, datastore.Key) error {
+	return nil
+}
+
+// Query selects the keys under the query prefix in SQL, other query
+// features are applied on the results.
+func (d *Datastore) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	columns := "key, data"
+	if q.KeysOnly && !q.ReturnsSizes {
+		columns = "key, NULL"
+	} else if q.KeysOnly {
+		columns = "key, length(data)"
+	}
+
+	stmt := fmt.Sprintf("SELECT %s FROM %s", columns, d.table)
+	args := []interface{}(nil)
+
+	prefix := datastore.NewKey(q.Prefix).String()
+	if prefix != "/" {
+		// keys under /prefix are between "/prefix/" and "/prefix0"
+		stmt += " WHERE key > ? AND key < ?"
+		args = append(args, prefix+"/", prefix+"0")
+	}
+
+	if len(q.Orders) == 1 {
+		switch q.Orders[0].(type) {
+		case query.OrderByKey, *query.OrderByKey:
+			stmt += " ORDER BY key"
+			q.Orders = nil
+		case query.OrderByKeyDescending, *query.OrderByKeyDescending:
+			stmt += " ORDER BY key DESC"
+			q.Orders = nil
+		}
+	}
+
+	rows, err := d.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	done := false
+	results := query.ResultsFromIterator(q, query.Iterator{
+		Next: func() (query.Result, bool) {
+			if done {
+				return query.Result{}, false
+			}
+
+			if !rows.Next() {
+				done = true
+				if err := rows.Err(); err != nil {
+					return query.Result{Error: err}, true
+				}
+				return query.Result{}, false
+			}
+
+			var (
+				key   string
+				value []byte
+				size  sql.NullInt64
+			)
+
+			entry := query.Entry{}
+			if q.KeysOnly {
+				if err := rows.Scan(&key, &size); err != nil {
+					return query.Result{Error: err}, true
+				}
+				entry.Size = int(size.Int64)
+			} else {
+				if err := rows.Scan(&key, &value); err != nil {
+					return query.Result{Error: err}, true
+				}
+				entry.Value = value
+				entry.Size = len(value)
+			}
+
+			if !q.ReturnsSizes {
+				entry.Size = 0
+			}
+			entry.Key = key
+
+			return query.Result{Entry: entry}, true
+		},
+		Close: rows.Close,
+	})
+
+	// the prefix and the key order were handled by the statement
+	q.Prefix = ""
+	return query.NaiveQueryApply(q, results), nil
+}
+
+// Batch returns a batch committed in a single transaction.
+func (d *Datastore) Batch(context.Context) (datastore.Batch, error) {
+	return &batch{ds: d, ops: map[string]batchOp{}}, nil
+}
+
+// Close releases the prepared statements and closes the database.
+func (d *Datastore) Close() error {
+	d.closeOnce.Do(func() {
+		for _, stmt := range []*sql.Stmt{d.get, d.has, d.getSize, d.put, d.delete} {
+			if stmt != nil {
+				_ = stmt.Close()
+			}
+		}
+
+		d.closeErr = d.db.Close()
+	})
+
+	return d.closeErr
+}
+
+type batchOp struct {
+	value  []byte
+	delete bool
+}
+
+type batch struct {
+	ds *Datastore
+	mu sync.Mutex
+	// only the last operation on a key matters
+	ops  map[string]batchOp
+	keys []string
+}
+
+func (b *batch) Put(_ context.Context, key datastore.Key, value []byte) error {
+	b.add(key.String(), batchOp{value: value})
+	return nil
+}
+
+func (b *batch) Delete(_ context.Context, key datastore.Key) error {
+	b.add(key.String(), batchOp{delete: true})
+	return nil
+}
+
+func (b *batch) add(key string, op batchOp) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.ops[key]; !ok {
+		b.keys = append(b.keys, key)
+	}
+	b.ops[key] = op
+}
+
+func (b *batch) Commit(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	size := b.ds.maxBatchSize
+	if size == 0 {
+		size = len(b.keys)
+	}
+
+	for start := 0; start < len(b.keys); start += size {
+		end := start + size
+		if end > len(b.keys) {
+			end = len(b.keys)
+		}
+
+		if err := b.commitKeys(ctx, b.keys[start:end]); err != nil {
+			return err
+		}
+	}
+
+	b.ops = map[string]batchOp{}
+	b.keys = nil
+
+	return nil
+}
+
+func (b *batch) commitKeys(ctx context.Context, keys []string) error {
+	tx, err := b.ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	put := tx.StmtContext(ctx, b.ds.put)
+	del := tx.StmtContext(ctx, b.ds.delete)
+
+	for _, key := range keys {
+		op := b.ops[key]
+		if op.delete {
+			_, err = del.ExecContext(ctx, key)
+		} else {
+			_, err = put.ExecContext(ctx, key, op.value)
+		}
+
+		if err != nil {
+			_ = tx.Rollback()
+			return errcode.ErrDBWrite.Wrap(fmt.Errorf("unable to write %s: %w", key, err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package sqliteds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	dstest "github.com/ipfs/go-datastore/test"
+	"github.com/stretchr/testify/require"
+)
+
+func testDatastore(t testing.TB, opts Options) *Datastore {
+	t.Helper()
+
+	ds, err := Open(context.Background(), filepath.Join(t.TempDir(), "datastore.sqlite"), opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ds.Close() })
+
+	return ds
+}
+
+func TestSuite(t *testing.T) {
+	dstest.SubtestAll(t, testDatastore(t, Options{}))
+}
+
+func TestBatch(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"single transaction": {},
+		"split transactions": {MaxBatchSize: 7},
+	} {
+		opts := opts
+		t.Run(name, func(t *testing.T) {
+			dstest.RunBatchTest(t, testDatastore(t, opts))
+			dstest.RunBatchDeleteTest(t, testDatastore(t, opts))
+			dstest.RunBatchPutAndDeleteTest(t, testDatastore(t, opts))
+		})
+	}
+}
+
+func TestBatchLastOperationWins(t *testing.T) {
+	ctx := context.Background()
+	ds := testDatastore(t, Options{})
+
+	key := datastore.NewKey("/a")
+	require.NoError(t, ds.Put(ctx, key, []byte("old")))
+
+	b, err := ds.Batch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, b.Delete(ctx, key))
+	require.NoError(t, b.Put(ctx, key, []byte("new")))
+
+	// nothing is written before the commit
+	value, err := ds.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, []byte("old"), value)
+
+	require.NoError(t, b.Commit(ctx))
+
+	value, err = ds.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, []byte("new"), value)
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "datastore.sqlite")
+	opts := Options{Key: []byte("0123456789abcdef0123456789abcdef"), SyncMode: SyncFull}
+
+	ds, err := Open(ctx, path, opts)
+	require.NoError(t, err)
+	require.NoError(t, ds.Put(ctx, datastore.NewKey("/a"), []byte("a")))
+	require.NoError(t, ds.Close())
+	require.NoError(t, ds.Close())
+
+	ds, err = Open(ctx, path, opts)
+	require.NoError(t, err)
+	defer ds.Close()
+
+	value, err := ds.Get(ctx, datastore.NewKey("/a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("a"), value)
+}
+
+func TestInvalidOptions(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "datastore.sqlite")
+
+	_, err := Open(ctx, "", Options{})
+	require.Error(t, err)
+
+	_, err = Open(ctx, path, Options{Table: "data; DROP TABLE data"})
+	require.Error(t, err)
+
+	_, err = Open(ctx, path, Options{SyncMode: "SOMETIMES"})
+	require.Error(t, err)
+
+	_, err = Open(ctx, path, Options{MaxBatchSize: -1})
+	require.Error(t, err)
+
+	_, err = Open(ctx, path, Options{Key: []byte("0123456789abcdef0123456789abcdef"), Salt: []byte("short")})
+	require.Error(t, err)
+}
+
+func TestSalt(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "datastore.sqlite")
+	opts := Options{Key: []byte("0123456789abcdef0123456789abcdef"), Salt: []byte("0123456789abcdef")}
+
+	ds, err := Open(ctx, path, opts)
+	require.NoError(t, err)
+	require.NoError(t, ds.Put(ctx, datastore.NewKey("/a"), []byte("a")))
+	require.NoError(t, ds.Close())
+
+	// the header is left in plaintext
+	header := make([]byte, 16)
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	_, err = io.ReadFull(f, header)
+	require.NoError(t, f.Close())
+	require.NoError(t, err)
+	require.Equal(t, "SQLite format 3\x00", string(header))
+
+	_, err = Open(ctx, path, Options{Key: opts.Key, Salt: []byte("fedcba9876543210")})
+	require.Error(t, err)
+
+	ds, err = Open(ctx, path, opts)
+	require.NoError(t, err)
+	defer ds.Close()
+
+	value, err := ds.Get(ctx, datastore.NewKey("/a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("a"), value)
+}
+
+// benchmarkEntries mimics the small log entries written by the replication.
+func benchmarkEntries(n int) ([]datastore.Key, []byte) {
+	keys := make([]datastore.Key, n)
+	for i := range keys {
+		keys[i] = datastore.NewKey(fmt.Sprintf("/log/entries/%08d", i))
+	}
+
+	return keys, make([]byte, 512)
+}
+
+func BenchmarkPut(b *testing.B) {
+	for _, syncMode := range []SyncMode{SyncFull, SyncNormal} {
+		b.Run(string(syncMode), func(b *testing.B) {
+			ctx := context.Background()
+			ds := testDatastore(b, Options{SyncMode: syncMode})
+			keys, value := benchmarkEntries(b.N)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := ds.Put(ctx, keys[i], value); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBatchPut(b *testing.B) {
+	const batchSize = 100
+
+	for _, syncMode := range []SyncMode{SyncFull, SyncNormal} {
+		b.Run(string(syncMode), func(b *testing.B) {
+			ctx := context.Background()
+			ds := testDatastore(b, Options{SyncMode: syncMode})
+			keys, value := benchmarkEntries(b.N)
+
+			b.ResetTimer()
+			for start := 0; start < b.N; start += batchSize {
+				batch, err := ds.Batch(ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				for i := start; i < start+batchSize && i < b.N; i++ {
+					if err := batch.Put(ctx, keys[i], value); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				if err := batch.Commit(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+// Package usagestats aggregates opt-in usage counters locally.
+//
+// Nothing collected by this package ever leaves the device: counters are
+// stored in the account datastore and can only be exported by the user.
+package usagestats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	CounterMessagesSent   = "messages_sent"
+	CounterGroupsCreated  = "groups_created"
+	CounterGroupsJoined   = "groups_joined"
+	CounterContactsAdded  = "contacts_added"
+	CounterSessionsOpened = "sessions_opened"
+
+	// DatastoreKey is the key used to persist the aggregated report.
+	DatastoreKey = "usage_stats"
+)
+
+// Report is the aggregated usage of an account since collection was enabled.
+type Report struct {
+	Since         time.Time         `json:"since"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+	UptimeSeconds int64             `json:"uptimeSeconds"`
+	Counters      map[string]uint64 `json:"counters"`
+}
+
+// Collector aggregates counters in memory and periodically saves them.
+// A nil Collector is valid and discards everything, which is what callers
+// get when the user did not opt in.
+type Collector struct {
+	ds        datastore.Datastore
+	mu        sync.Mutex
+	report    Report
+	sessionAt time.Time
+}
+
+// New loads the previous report from ds, if any, and starts a new session.
+func New(ctx context.Context, ds datastore.Datastore) (*Collector, error) {
+	if ds == nil {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("missing datastore"))
+	}
+
+	now := time.Now()
+	c := &Collector{
+		ds:        ds,
+		sessionAt: now,
+		report:    Report{Since: now, Counters: map[string]uint64{}},
+	}
+
+	report, err := Load(ctx, ds)
+	switch {
+	case errcode.Is(err, errcode.ErrNotFound):
+		// first run, keep the empty report
+	case err != nil:
+		return nil, err
+	default:
+		c.report = *report
+	}
+
+	c.report.Counters[CounterSessionsOpened]++
+
+	return c, nil
+}
+
+// Load reads the last saved report from ds.
+func Load(ctx context.Context, ds datastore.Datastore) (*Report, error) {
+	raw, err := ds.Get(ctx, datastore.NewKey(DatastoreKey))
+	if err == datastore.ErrNotFound {
+		return nil, errcode.ErrNotFound
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	report := &Report{}
+	if err := json.Unmarshal(raw, report); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if report.Counters == nil {
+		report.Counters = map[string]uint64{}
+	}
+
+	return report, nil
+}
+
+// Incr increments the counter identified by name.
+func (c *Collector) Incr(name string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.report.Counters[name]++
+	c.mu.Unlock()
+}
+
+// Report returns a snapshot of the aggregated usage, including the uptime
+// of the current session.
+func (c *Collector) Report() *Report {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.snapshot(time.Now())
+}
+
+func (c *Collector) snapshot(now time.Time) *Report {
+	counters := make(map[string]uint64, len(c.report.Counters))
+	for k, v := range c.report.Counters {
+		counters[k] = v
+	}
+
+	return &Report{
+		Since:         c.report.Since,
+		UpdatedAt:     now,
+		UptimeSeconds: c.report.UptimeSeconds + int64(now.Sub(c.sessionAt).Seconds()),
+		Counters:      counters,
+	}
+}
+
+// Save persists the current report, the uptime of the current session is
+// folded into the stored value.
+func (c *Collector) Save(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	report := c.snapshot(now)
+
+	raw, err := json.Marshal(report)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := c.ds.Put(ctx, datastore.NewKey(DatastoreKey), raw); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	c.report = *report
+	c.sessionAt = now
+
+	return nil
+}
+
+// Run saves the report every interval until ctx is done, callers are
+// expected to call Save one last time before closing the datastore.
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	if c == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = c.Save(ctx)
+		}
+	}
+}
+
+// WriteJSON writes a human readable JSON export of the report to w.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Names returns the names of the collected counters in a stable order.
+func (r *Report) Names() []string {
+	names := make([]string, 0, len(r.Counters))
+	for name := range r.Counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
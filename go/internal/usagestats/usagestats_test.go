@@ -0,0 +1,50 @@
+package usagestats
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestCollectorPersistence(t *testing.T) {
+	ctx := context.Background()
+	ds := datastore.NewMapDatastore()
+
+	_, err := Load(ctx, ds)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	c, err := New(ctx, ds)
+	require.NoError(t, err)
+
+	c.Incr(CounterMessagesSent)
+	c.Incr(CounterMessagesSent)
+	c.Incr(CounterGroupsJoined)
+	require.NoError(t, c.Save(ctx))
+
+	report, err := Load(ctx, ds)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), report.Counters[CounterMessagesSent])
+	require.Equal(t, uint64(1), report.Counters[CounterGroupsJoined])
+	require.Equal(t, uint64(1), report.Counters[CounterSessionsOpened])
+
+	c, err = New(ctx, ds)
+	require.NoError(t, err)
+	c.Incr(CounterMessagesSent)
+
+	report = c.Report()
+	require.Equal(t, uint64(3), report.Counters[CounterMessagesSent])
+	require.Equal(t, uint64(2), report.Counters[CounterSessionsOpened])
+	require.Equal(t, []string{CounterGroupsJoined, CounterMessagesSent, CounterSessionsOpened}, report.Names())
+}
+
+func TestNilCollector(t *testing.T) {
+	var c *Collector
+
+	c.Incr(CounterMessagesSent)
+	require.Nil(t, c.Report())
+	require.NoError(t, c.Save(context.Background()))
+}
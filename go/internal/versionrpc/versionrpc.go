@@ -0,0 +1,172 @@
+// Package versionrpc exposes the build information and the features of a
+// daemon over gRPC, so that clients built from another version can check
+// they are compatible before using it.
+package versionrpc
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"berty.tech/berty/v2/go/internal/grpcutil"
+	"berty.tech/berty/v2/go/pkg/bertyversion"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/versiontypes"
+)
+
+// Method is the full name of the Version method.
+const Method = versiontypes.VersionService_Version_FullMethodName
+
+// MinClientVersion is the oldest client version able to use this daemon, it
+// is raised when a change breaks the clients built before it.
+var MinClientVersion = "v2.0.0"
+
+// Local returns the info of the running binary, advertising features.
+func Local(features ...string) *versiontypes.Info {
+	info := &versiontypes.Info{
+		Version:          bertyversion.Version,
+		VcsRef:           bertyversion.VcsRef,
+		GoVersion:        runtime.Version(),
+		OS:               runtime.GOOS,
+		Arch:             runtime.GOARCH,
+		Features:         normalizeFeatures(features),
+		MinClientVersion: MinClientVersion,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Build = map[string]string{}
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "-tags", "CGO_ENABLED", "vcs.revision", "vcs.time", "vcs.modified":
+				info.Build[setting.Key] = setting.Value
+			}
+		}
+	}
+
+	return info
+}
+
+func normalizeFeatures(features []string) []string {
+	seen := map[string]struct{}{}
+	normalized := []string{}
+	for _, f := range features {
+		if _, ok := seen[f]; ok || f == "" {
+			continue
+		}
+		seen[f] = struct{}{}
+		normalized = append(normalized, f)
+	}
+	sort.Strings(normalized)
+
+	return normalized
+}
+
+// Check returns an error if a client built as clientVersion cannot use the
+// daemon described by remote, or if the daemon lacks one of the required
+// features. Development builds, without a semantic version, are not
+// compared.
+func Check(remote *versiontypes.Info, clientVersion string, required ...string) error {
+	if min, err := semver.NewVersion(remote.MinClientVersion); err == nil {
+		if client, err := semver.NewVersion(clientVersion); err == nil && client.LessThan(min) {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the daemon %s requires a client %s or newer, this client is %s", remote.Version, remote.MinClientVersion, clientVersion))
+		}
+	}
+
+	missing := []string{}
+	for _, feature := range required {
+		if !remote.HasFeature(feature) {
+			missing = append(missing, feature)
+		}
+	}
+	if len(missing) > 0 {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the daemon %s does not support %s", remote.Version, strings.Join(missing, ", ")))
+	}
+
+	return nil
+}
+
+// Get asks the daemon served by cc for its info. The daemons released
+// before the version service fail with errcode.ErrNotImplemented.
+func Get(ctx context.Context, cc grpc.ClientConnInterface) (*versiontypes.Info, error) {
+	reply, err := versiontypes.NewVersionServiceClient(cc).Version(ctx, &versiontypes.Version_Request{})
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("the daemon predates the version service: %w", err))
+		}
+		return nil, err
+	}
+
+	if reply.Info == nil {
+		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("the daemon returned no version info"))
+	}
+
+	return reply.Info, nil
+}
+
+// Register adds the version service to s. The services registered on s are
+// advertised as features, in addition to the given ones.
+func Register(s *grpc.Server, features ...string) {
+	RegisterWithStartup(s, nil, features...)
+}
+
+// RegisterWithStartup is Register for a daemon reporting the stages of its
+// startup, startup is called on each Version call.
+func RegisterWithStartup(s *grpc.Server, startup func() []*versiontypes.Stage, features ...string) {
+	versiontypes.RegisterVersionServiceServer(s, &server{grpcServer: s, startup: startup, features: features})
+}
+
+type server struct {
+	versiontypes.UnimplementedVersionServiceServer
+
+	grpcServer *grpc.Server
+	startup    func() []*versiontypes.Stage
+	features   []string
+}
+
+func (s *server) Version(context.Context, *versiontypes.Version_Request) (*versiontypes.Version_Reply, error) {
+	return &versiontypes.Version_Reply{Info: s.info()}, nil
+}
+
+func (s *server) info() *versiontypes.Info {
+	features := append([]string{}, s.features...)
+	for name := range s.grpcServer.GetServiceInfo() {
+		if name != versiontypes.VersionService_ServiceDesc.ServiceName {
+			features = append(features, name)
+		}
+	}
+
+	info := Local(features...)
+	if s.startup != nil {
+		info.Startup = s.startup()
+	}
+
+	return info
+}
+
+// ServeLazy answers a Version call on a server forcing the
+// grpcutil.LazyCodec, which cannot serve registered services, e.g. the
+// multi-tenant router.
+func ServeLazy(ss grpc.ServerStream, info *versiontypes.Info) error {
+	if err := ss.RecvMsg(grpcutil.NewLazyMessage()); err != nil {
+		return errcode.ErrStreamRead.Wrap(err)
+	}
+
+	raw, err := (&versiontypes.Version_Reply{Info: info}).Marshal()
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := ss.SendMsg(grpcutil.NewLazyMessage().FromBytes(raw)); err != nil {
+		return errcode.ErrStreamWrite.Wrap(err)
+	}
+
+	return nil
+}
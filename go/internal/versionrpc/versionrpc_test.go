@@ -0,0 +1,103 @@
+package versionrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	"berty.tech/berty/v2/go/internal/grpcutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/versiontypes"
+)
+
+func serve(t *testing.T, opts []grpc.ServerOption, register func(s *grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+
+	l := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(opts...)
+	register(s)
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(s.Stop)
+
+	cc, err := grpc.Dial("buf",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+
+	return cc
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+
+	cc := serve(t, nil, func(s *grpc.Server) {
+		Register(s, "multitenant")
+		grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	})
+
+	info, err := Get(ctx, cc)
+	require.NoError(t, err)
+	require.Equal(t, []string{"grpc.health.v1.Health", "multitenant"}, info.Features)
+	require.Equal(t, MinClientVersion, info.MinClientVersion)
+	require.Equal(t, Local().Version, info.Version)
+	require.NoError(t, Check(info, "v2.1.0", "multitenant"))
+}
+
+func TestGetStartup(t *testing.T) {
+	stages := []*versiontypes.Stage{{Name: "ipfs", Duration: 1500 * time.Millisecond}, {Name: "messenger-db", Duration: 20 * time.Millisecond}}
+	cc := serve(t, nil, func(s *grpc.Server) {
+		RegisterWithStartup(s, func() []*versiontypes.Stage { return stages })
+	})
+
+	info, err := Get(context.Background(), cc)
+	require.NoError(t, err)
+	require.Equal(t, stages, info.Startup)
+}
+
+func TestGetUnimplemented(t *testing.T) {
+	cc := serve(t, nil, func(s *grpc.Server) {
+		grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	})
+
+	_, err := Get(context.Background(), cc)
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+}
+
+func TestServeLazy(t *testing.T) {
+	codec := grpcutil.NewLazyCodec()
+	cc := serve(t, []grpc.ServerOption{
+		grpc.ForceServerCodec(codec),
+		grpc.UnknownServiceHandler(func(_ interface{}, ss grpc.ServerStream) error {
+			return ServeLazy(ss, Local("multitenant"))
+		}),
+	}, func(*grpc.Server) {})
+
+	info, err := Get(context.Background(), cc)
+	require.NoError(t, err)
+	require.Equal(t, []string{"multitenant"}, info.Features)
+}
+
+func TestCheck(t *testing.T) {
+	remote := &versiontypes.Info{Version: "v2.5.0", MinClientVersion: "v2.3.0", Features: []string{"multitenant"}}
+
+	require.NoError(t, Check(remote, "v2.3.0"))
+	require.NoError(t, Check(remote, "v2.4.1", "multitenant"))
+	// development builds are not compared
+	require.NoError(t, Check(remote, "n/a"))
+
+	err := Check(remote, "v2.2.9")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	err = Check(remote, "v2.4.0", "multitenant", "replication")
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+}
@@ -0,0 +1,228 @@
+// Package appmessage encodes the structured user messages shared by the
+// Berty clients: text, location, poll, file reference, and the custom types
+// of third-party clients.
+//
+// A structured message is a UserMessage whose body is a text fallback,
+// displayed by the clients unaware of its type. The kind of the message, the
+// version of its encoding and its data are in its structured field. Text and
+// locations predate
+// the registry and keep their own encoding: a plain body, and the location
+// field of the UserMessage.
+//
+// The payloads are sent with the Interact RPC of the messenger as
+// UserMessage, e.g.
+//
+//	req, err := appmessage.InteractRequest(conversationPK, appmessage.Poll{
+//		Question: "lunch?",
+//		Options:  []string{"pizza", "sushi"},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	_, err = client.Interact(ctx, req)
+package appmessage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+
+	"berty.tech/berty/v2/go/internal/messagelocation"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// Message is the content of a structured message.
+type Message interface {
+	// Kind is the name of the type of the message in the registry, e.g.
+	// "berty.poll". Third-party types are named after a domain of their
+	// authors, e.g. "com.example.invoice".
+	Kind() string
+
+	// Fallback is the body of the message, displayed by the clients unaware
+	// of its kind.
+	Fallback() string
+}
+
+// Codec encodes and decodes the messages of a kind.
+type Codec struct {
+	Kind string
+
+	// Version is written with the encoded messages, Decode receives the
+	// version of each message to read the ones encoded by previous versions,
+	// and by the next ones as well as it can.
+	Version uint32
+
+	Encode func(m Message) ([]byte, error)
+	Decode func(version uint32, data []byte) (Message, error)
+}
+
+// Registry maps the kinds of messages to their codec.
+type Registry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+// Default is the registry of the built-in kinds, used by the package level
+// functions. Register the custom kinds of a client on it or on a registry of
+// its own.
+var Default = NewRegistry()
+
+// NewRegistry returns a registry of the built-in kinds.
+func NewRegistry() *Registry {
+	r := &Registry{codecs: map[string]Codec{}}
+	for _, c := range builtinCodecs() {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+
+	return r
+}
+
+// Register adds the codec of a new kind.
+func (r *Registry) Register(c Codec) error {
+	if c.Kind == "" || c.Encode == nil || c.Decode == nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a codec needs a kind, an encoder and a decoder"))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.codecs[c.Kind]; ok {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("kind %q is already registered", c.Kind))
+	}
+	r.codecs[c.Kind] = c
+
+	return nil
+}
+
+// Kinds returns the registered kinds, sorted.
+func (r *Registry) Kinds() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	kinds := make([]string, 0, len(r.codecs))
+	for kind := range r.codecs {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	return kinds
+}
+
+func (r *Registry) codec(kind string) (Codec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.codecs[kind]
+	return c, ok
+}
+
+// Marshal returns the UserMessage payload of m. A Custom message of an
+// unregistered kind is sent as it is.
+func (r *Registry) Marshal(m Message) ([]byte, error) {
+	switch m := m.(type) {
+	case Text:
+		payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: m.Body})
+		if err != nil {
+			return nil, errcode.ErrSerialization.Wrap(err)
+		}
+		return payload, nil
+	case Location:
+		return messagelocation.MarshalPayload(messagelocation.Location(m))
+	}
+
+	var (
+		version uint32
+		data    []byte
+	)
+	if c, ok := r.codec(m.Kind()); ok {
+		var err error
+		if data, err = c.Encode(m); err != nil {
+			return nil, err
+		}
+		version = c.Version
+	} else if custom, ok := m.(Custom); ok && custom.Type != "" {
+		version, data = custom.Version, custom.Data
+	} else {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("kind %q is not registered", m.Kind()))
+	}
+
+	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{
+		Body: m.Fallback(),
+		Structured: &messengertypes.AppMessage_UserMessage_Structured{
+			Kind:    m.Kind(),
+			Version: version,
+			Data:    data,
+		},
+	})
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	return payload, nil
+}
+
+// Unmarshal returns the message of a UserMessage payload: a Custom message
+// if its kind is not registered, a Text if it is not structured.
+func (r *Registry) Unmarshal(payload []byte) (Message, error) {
+	um := &messengertypes.AppMessage_UserMessage{}
+	if err := proto.Unmarshal(payload, um); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	structured := um.GetStructured()
+	if structured.GetKind() == "" {
+		if um.Location != nil {
+			l, err := messagelocation.FromProto(um.Location)
+			if err != nil {
+				return nil, err
+			}
+			return Location(l), nil
+		}
+
+		return Text{Body: um.Body}, nil
+	}
+
+	c, ok := r.codec(structured.Kind)
+	if !ok {
+		return Custom{Type: structured.Kind, Version: structured.Version, Data: structured.Data, Body: um.Body}, nil
+	}
+
+	return c.Decode(structured.Version, structured.Data)
+}
+
+// InteractRequest returns the request of the Interact RPC sending m to the
+// conversation.
+func (r *Registry) InteractRequest(conversationPK string, m Message) (*messengertypes.Interact_Request, error) {
+	payload, err := r.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &messengertypes.Interact_Request{
+		Type:                  messengertypes.AppMessage_TypeUserMessage,
+		Payload:               payload,
+		ConversationPublicKey: conversationPK,
+	}, nil
+}
+
+// Marshal returns the UserMessage payload of m with the Default registry.
+func Marshal(m Message) ([]byte, error) {
+	return Default.Marshal(m)
+}
+
+// Unmarshal returns the message of a UserMessage payload with the Default
+// registry.
+func Unmarshal(payload []byte) (Message, error) {
+	return Default.Unmarshal(payload)
+}
+
+// InteractRequest returns the request of the Interact RPC sending m to the
+// conversation, with the Default registry.
+func InteractRequest(conversationPK string, m Message) (*messengertypes.Interact_Request, error) {
+	return Default.InteractRequest(conversationPK, m)
+}
@@ -0,0 +1,147 @@
+package appmessage
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const testCID = "bafkreigh2akiscaildcqabsyg3dfr6chu3fgpregiymsck7e7aqa4s52zy"
+
+func TestRoundTrip(t *testing.T) {
+	for _, m := range []Message{
+		Text{Body: "hello"},
+		Location{Latitude: 48.8584, Longitude: 2.2945, Label: "Eiffel Tower"},
+		Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}, MultipleChoice: true},
+		Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}, ClosesAt: 1700000000000},
+		PollVote{Choices: []int{1}},
+		FileRef{CID: testCID, Name: "notes.txt", MimeType: "text/plain", Size: 42},
+	} {
+		payload, err := Marshal(m)
+		require.NoError(t, err, m.Kind())
+
+		// clients unaware of the kind display the fallback
+		um := &messengertypes.AppMessage_UserMessage{}
+		require.NoError(t, proto.Unmarshal(payload, um))
+		require.Equal(t, m.Fallback(), um.Body)
+
+		decoded, err := Unmarshal(payload)
+		require.NoError(t, err, m.Kind())
+		require.Equal(t, m, decoded)
+	}
+}
+
+func TestFallbacks(t *testing.T) {
+	require.Equal(t, "poll: lunch?\n1. pizza\n2. sushi", Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}}.Fallback())
+	require.Equal(t, "poll: lunch?\n1. pizza\n2. sushi\ncloses at 2023-11-14T22:13:20Z", Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}, ClosesAt: 1700000000000}.Fallback())
+	require.Equal(t, "voted: 1, 3", PollVote{Choices: []int{0, 2}}.Fallback())
+	require.Equal(t, "file: notes.txt (42 bytes) "+testCID, FileRef{CID: testCID, Name: "notes.txt", Size: 42}.Fallback())
+	require.Equal(t, "file: "+testCID+" "+testCID, FileRef{CID: testCID}.Fallback())
+}
+
+func TestValidation(t *testing.T) {
+	for _, m := range []Message{
+		Poll{Question: "lunch?", Options: []string{"pizza"}},
+		Poll{Options: []string{"pizza", "sushi"}},
+		Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}, ClosesAt: -1},
+		PollVote{},
+		PollVote{Choices: []int{-1}},
+		FileRef{CID: "not a cid"},
+		Location{Latitude: 91},
+		Custom{Body: "no type"},
+	} {
+		_, err := Marshal(m)
+		require.Error(t, err, "%#v", m)
+	}
+}
+
+type invoice struct {
+	Amount int `json:"amount"`
+	// Currency is added by the version 2
+	Currency string `json:"currency,omitempty"`
+}
+
+func (invoice) Kind() string       { return "com.example.invoice" }
+func (i invoice) Fallback() string { return fmt.Sprintf("invoice: %d %s", i.Amount, i.Currency) }
+
+func invoiceCodec(version uint32) Codec {
+	return Codec{
+		Kind:    "com.example.invoice",
+		Version: version,
+		Encode: func(m Message) ([]byte, error) {
+			return json.Marshal(m)
+		},
+		Decode: func(version uint32, data []byte) (Message, error) {
+			i := invoice{}
+			if err := json.Unmarshal(data, &i); err != nil {
+				return nil, err
+			}
+			// the version 1 had no currency
+			if version < 2 {
+				i.Currency = "EUR"
+			}
+			return i, nil
+		},
+	}
+}
+
+func TestCustomKinds(t *testing.T) {
+	v1 := NewRegistry()
+	require.NoError(t, v1.Register(invoiceCodec(1)))
+	require.Contains(t, v1.Kinds(), "com.example.invoice")
+	require.True(t, errcode.Is(v1.Register(invoiceCodec(1)), errcode.ErrInvalidInput))
+
+	v2 := NewRegistry()
+	require.NoError(t, v2.Register(invoiceCodec(2)))
+
+	payload, err := v1.Marshal(invoice{Amount: 12})
+	require.NoError(t, err)
+
+	um := &messengertypes.AppMessage_UserMessage{}
+	require.NoError(t, proto.Unmarshal(payload, um))
+	require.Equal(t, "com.example.invoice", um.GetStructured().GetKind())
+	require.Equal(t, uint32(1), um.GetStructured().GetVersion())
+
+	// the next version reads the previous one
+	decoded, err := v2.Unmarshal(payload)
+	require.NoError(t, err)
+	require.Equal(t, invoice{Amount: 12, Currency: "EUR"}, decoded)
+
+	// a registry without the kind keeps the message as it is
+	decoded, err = Unmarshal(payload)
+	require.NoError(t, err)
+	custom, ok := decoded.(Custom)
+	require.True(t, ok)
+	require.Equal(t, "com.example.invoice", custom.Type)
+	require.Equal(t, uint32(1), custom.Version)
+	require.JSONEq(t, `{"amount": 12}`, string(custom.Data))
+	require.Equal(t, "invoice: 12 ", custom.Body)
+
+	// and sends it again unchanged
+	forwarded, err := Marshal(custom)
+	require.NoError(t, err)
+	require.Equal(t, payload, forwarded)
+
+	_, err = Marshal(invoice{})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
+
+func TestInteractRequest(t *testing.T) {
+	req, err := InteractRequest("conversation", Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}})
+	require.NoError(t, err)
+	require.Equal(t, messengertypes.AppMessage_TypeUserMessage, req.Type)
+	require.Equal(t, "conversation", req.ConversationPublicKey)
+
+	m, err := Unmarshal(req.Payload)
+	require.NoError(t, err)
+	require.Equal(t, KindPoll, m.Kind())
+
+	_, err = Unmarshal([]byte{0xff})
+	require.Error(t, err)
+}
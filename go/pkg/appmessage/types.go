@@ -0,0 +1,244 @@
+package appmessage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ipfs/go-cid"
+
+	"berty.tech/berty/v2/go/internal/messagelocation"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// The built-in kinds.
+const (
+	KindText     = "berty.text"
+	KindLocation = "berty.location"
+	KindPoll     = "berty.poll"
+	KindPollVote = "berty.poll-vote"
+	KindFileRef  = "berty.file-ref"
+)
+
+const (
+	MaxPollOptions      = 20
+	MaxPollOptionLength = 256
+)
+
+// Text is a plain message.
+type Text struct {
+	Body string
+}
+
+func (Text) Kind() string       { return KindText }
+func (t Text) Fallback() string { return t.Body }
+
+// Location is a point on the WGS 84 ellipsoid, see messagelocation.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	Label     string
+}
+
+func (Location) Kind() string       { return KindLocation }
+func (l Location) Fallback() string { return messagelocation.Text(messagelocation.Location(l)) }
+
+// Poll asks the members of the conversation to choose among options, the
+// answers are PollVote messages targeting the poll.
+type Poll struct {
+	Question       string   `json:"question"`
+	Options        []string `json:"options"`
+	MultipleChoice bool     `json:"multiple_choice,omitempty"`
+	// ClosesAt is the time in milliseconds after which the votes are
+	// ignored, the poll stays open when it is 0.
+	ClosesAt int64 `json:"closes_at,omitempty"`
+}
+
+func (Poll) Kind() string { return KindPoll }
+
+func (p Poll) Fallback() string {
+	lines := []string{"poll: " + p.Question}
+	for i, option := range p.Options {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, option))
+	}
+	if p.ClosesAt > 0 {
+		lines = append(lines, "closes at "+time.UnixMilli(p.ClosesAt).UTC().Format(time.RFC3339))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p Poll) validate() error {
+	if p.Question == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("poll without a question"))
+	}
+
+	if len(p.Options) < 2 || len(p.Options) > MaxPollOptions {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a poll has between 2 and %d options", MaxPollOptions))
+	}
+
+	for _, option := range p.Options {
+		if option == "" || utf8.RuneCountInString(option) > MaxPollOptionLength {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("poll options have between 1 and %d characters", MaxPollOptionLength))
+		}
+	}
+
+	if p.ClosesAt < 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("negative poll close time"))
+	}
+
+	return nil
+}
+
+// PollVote answers a poll, it is sent with the CID of the poll as the target
+// of the interaction. Choices are the indexes of the options, from 0.
+type PollVote struct {
+	Choices []int `json:"choices"`
+}
+
+func (PollVote) Kind() string { return KindPollVote }
+
+func (v PollVote) Fallback() string {
+	choices := make([]string, len(v.Choices))
+	for i, choice := range v.Choices {
+		choices[i] = fmt.Sprint(choice + 1)
+	}
+	return "voted: " + strings.Join(choices, ", ")
+}
+
+func (v PollVote) validate() error {
+	if len(v.Choices) == 0 {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("vote without a choice"))
+	}
+
+	for _, choice := range v.Choices {
+		if choice < 0 || choice >= MaxPollOptions {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid choice %d", choice))
+		}
+	}
+
+	return nil
+}
+
+// FileRef references a file shared out of the message, e.g. a media of the
+// messenger or a file pinned on IPFS.
+type FileRef struct {
+	CID      string `json:"cid"`
+	Name     string `json:"name,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+func (FileRef) Kind() string { return KindFileRef }
+
+func (f FileRef) Fallback() string {
+	name := f.Name
+	if name == "" {
+		name = f.CID
+	}
+	if f.Size > 0 {
+		return fmt.Sprintf("file: %s (%d bytes) %s", name, f.Size, f.CID)
+	}
+	return fmt.Sprintf("file: %s %s", name, f.CID)
+}
+
+func (f FileRef) validate() error {
+	if _, err := cid.Decode(f.CID); err != nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid file cid: %w", err))
+	}
+
+	if f.Size < 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("negative file size"))
+	}
+
+	return nil
+}
+
+// Custom is a message of a kind unknown to the registry, it is sent and
+// received as it is.
+type Custom struct {
+	Type    string
+	Version uint32
+	Data    []byte
+	// Body is the fallback of the message.
+	Body string
+}
+
+func (c Custom) Kind() string     { return c.Type }
+func (c Custom) Fallback() string { return c.Body }
+
+// validator is implemented by the built-in messages encoded in JSON.
+type validator interface {
+	Message
+	validate() error
+}
+
+// jsonCodec returns the codec of a built-in kind encoded in JSON, decode
+// unmarshals the data in the message type. Unknown fields are ignored so the
+// messages of the next versions are read as well as possible.
+func jsonCodec(kind string, version uint32, decode func(data []byte) (validator, error)) Codec {
+	return Codec{
+		Kind:    kind,
+		Version: version,
+		Encode: func(m Message) ([]byte, error) {
+			typed, ok := m.(validator)
+			if !ok || m.Kind() != kind {
+				return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unexpected message %T for kind %q", m, kind))
+			}
+			if err := typed.validate(); err != nil {
+				return nil, err
+			}
+
+			data, err := json.Marshal(typed)
+			if err != nil {
+				return nil, errcode.ErrSerialization.Wrap(err)
+			}
+			return data, nil
+		},
+		Decode: func(_ uint32, data []byte) (Message, error) {
+			m, err := decode(data)
+			if err != nil {
+				return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("invalid %s message: %w", kind, err))
+			}
+			if err := m.validate(); err != nil {
+				return nil, err
+			}
+			return m, nil
+		},
+	}
+}
+
+// builtinCodecs returns the codecs of the built-in kinds, text and location
+// are registered for Kinds, Marshal and Unmarshal handle them directly.
+func builtinCodecs() []Codec {
+	ownEncoding := func(kind string) Codec {
+		err := errcode.ErrInternal.Wrap(fmt.Errorf("%s has its own encoding", kind))
+		return Codec{
+			Kind:    kind,
+			Version: 1,
+			Encode:  func(Message) ([]byte, error) { return nil, err },
+			Decode:  func(uint32, []byte) (Message, error) { return nil, err },
+		}
+	}
+
+	return []Codec{
+		ownEncoding(KindText),
+		ownEncoding(KindLocation),
+		jsonCodec(KindPoll, 1, func(data []byte) (validator, error) {
+			p := Poll{}
+			err := json.Unmarshal(data, &p)
+			return p, err
+		}),
+		jsonCodec(KindPollVote, 1, func(data []byte) (validator, error) {
+			v := PollVote{}
+			err := json.Unmarshal(data, &v)
+			return v, err
+		}),
+		jsonCodec(KindFileRef, 1, func(data []byte) (validator, error) {
+			f := FileRef{}
+			err := json.Unmarshal(data, &f)
+			return f, err
+		}),
+	}
+}
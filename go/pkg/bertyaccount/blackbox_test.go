@@ -681,3 +681,78 @@ func createAccountClient(ctx context.Context, t *testing.T, s accounttypes.Accou
 
 	return cl
 }
+
+func TestBundledAccount(t *testing.T) {
+	tempdir := t.TempDir()
+	rootDir := filepath.Join(tempdir, "root")
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	svc, err := bertyaccount.NewService(&bertyaccount.Options{
+		AppRootDirectory:  rootDir,
+		Logger:            logger,
+		BundleNewAccounts: true,
+	})
+	require.NoError(t, err)
+	defer svc.Close()
+
+	cl := createAccountClient(ctx, t, svc)
+
+	accountDir := filepath.Join(rootDir, "accounts", "account 1")
+	bundlePath := accountDir + ".bundle"
+
+	_, err = cl.CreateAccount(ctx, &accounttypes.CreateAccount_Request{
+		AccountID:   "account 1",
+		AccountName: "bundled account",
+	})
+	require.NoError(t, err)
+
+	// only the bundle is left once created
+	_, err = os.Stat(bundlePath)
+	require.NoError(t, err)
+	_, err = os.Stat(accountDir)
+	require.True(t, os.IsNotExist(err))
+
+	list, err := cl.ListAccounts(ctx, &accounttypes.ListAccounts_Request{})
+	require.NoError(t, err)
+	require.Len(t, list.Accounts, 1)
+	require.Equal(t, "bundled account", list.Accounts[0].Name)
+
+	// unpacked while open
+	_, err = cl.OpenAccount(ctx, &accounttypes.OpenAccount_Request{AccountID: "account 1"})
+	require.NoError(t, err)
+	_, err = os.Stat(accountDir)
+	require.NoError(t, err)
+
+	_, err = cl.CloseAccount(ctx, &accounttypes.CloseAccount_Request{})
+	require.NoError(t, err)
+	_, err = os.Stat(accountDir)
+	require.True(t, os.IsNotExist(err))
+
+	// the last opening date is sealed in the bundle
+	list, err = cl.ListAccounts(ctx, &accounttypes.ListAccounts_Request{})
+	require.NoError(t, err)
+	require.Len(t, list.Accounts, 1)
+	require.NotZero(t, list.Accounts[0].LastOpened)
+
+	bundler, ok := svc.(bertyaccount.AccountBundler)
+	require.True(t, ok)
+
+	require.NoError(t, bundler.UnbundleAccount(ctx, "account 1"))
+	_, err = os.Stat(bundlePath)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(accountDir)
+	require.NoError(t, err)
+
+	require.NoError(t, bundler.BundleAccount(ctx, "account 1"))
+	_, err = os.Stat(bundlePath)
+	require.NoError(t, err)
+
+	_, err = cl.DeleteAccount(ctx, &accounttypes.DeleteAccount_Request{AccountID: "account 1"})
+	require.NoError(t, err)
+	_, err = os.Stat(bundlePath)
+	require.True(t, os.IsNotExist(err))
+}
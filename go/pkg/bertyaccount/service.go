@@ -7,12 +7,16 @@ import (
 	"path"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/ipfs/go-datastore"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"golang.org/x/text/language"
 
+	"berty.tech/berty/v2/go/internal/accounthealth"
+	"berty.tech/berty/v2/go/internal/accountlock"
+	"berty.tech/berty/v2/go/internal/accountsession"
 	"berty.tech/berty/v2/go/internal/accountutils"
 	"berty.tech/berty/v2/go/internal/initutil"
 	"berty.tech/berty/v2/go/internal/migrations"
@@ -53,6 +57,12 @@ type Service interface {
 
 	// GetProtocolClient returns the Protocol Client of the actual Berty account if there is one selected.
 	GetProtocolClient() (protocoltypes.ProtocolServiceClient, error)
+
+	// Sessions returns the manager of the leases on the opened account, see accountsession.
+	Sessions() *accountsession.Manager
+
+	// AccountHealth returns the last error of an account, see accounthealth.
+	accounthealth.Reporter
 }
 
 type Options struct {
@@ -70,6 +80,19 @@ type Options struct {
 	Keystore              accountutils.NativeKeystore
 	Logger                *zap.Logger
 	ServiceListeners      string
+
+	// BundleNewAccounts stores the created accounts as a single encrypted
+	// bundle file, unpacked while the account is open.
+	BundleNewAccounts bool
+
+	// SessionLeaseTTL is the validity of the leases handed out by Sessions,
+	// it defaults to accountsession.DefaultLeaseTTL.
+	SessionLeaseTTL time.Duration
+
+	// DeleteRevokedAccounts deletes the account data once another device of
+	// the account revoked the current one. The user is only notified by
+	// default, and deletes the account with DeleteAccount.
+	DeleteRevokedAccounts bool
 }
 
 type service struct {
@@ -98,6 +121,15 @@ type service struct {
 	serviceListeners  string
 	openedAccountID   string
 
+	bundleNewAccounts     bool
+	deleteRevokedAccounts bool
+	openedAccountBundled  bool
+	openedAccountLock     *accountlock.Lock
+	sessions              *accountsession.Manager
+
+	// messengerDBReplay is set while RebuildMessengerDB opens an account
+	messengerDBReplay func(done, total int)
+
 	accounttypes.UnimplementedAccountServiceServer
 }
 
@@ -158,8 +190,16 @@ func NewService(opts *Options) (_ Service, err error) {
 		nativeKeystore:    opts.Keystore,
 		devicePushKeyPath: path.Join(opts.SharedRootDirectory, accountutils.DefaultPushKeyFilename),
 		serviceListeners:  opts.ServiceListeners,
+		bundleNewAccounts: opts.BundleNewAccounts,
+
+		deleteRevokedAccounts: opts.DeleteRevokedAccounts,
 	}
 
+	s.sessions = accountsession.New(&sessionAccounts{s: s}, accountsession.Opts{
+		LeaseTTL: opts.SessionLeaseTTL,
+		Logger:   s.logger.Named("session"),
+	})
+
 	go s.handleLifecycle(rootCtx)
 
 	// override grpc logger before manager start to avoid race condition
@@ -262,6 +302,8 @@ func (s *service) Close() (err error) {
 	endSection := tyber.SimpleSection(tyber.ContextWithoutTraceID(s.rootCtx), s.logger, "Closing AccountService")
 	defer func() { endSection(err) }()
 
+	s.sessions.Stop()
+
 	s.muService.Lock()
 	defer s.muService.Unlock()
 
@@ -270,6 +312,7 @@ func (s *service) Close() (err error) {
 	s.rootCancel()
 	if s.initManager != nil {
 		err = multierr.Append(err, s.initManager.Close(nil))
+		err = multierr.Append(err, s.closeOpenedAccount(context.Background()))
 	}
 
 	return err
@@ -19,6 +19,7 @@ import (
 	"moul.io/progress"
 	"moul.io/u"
 
+	"berty.tech/berty/v2/go/internal/accounthealth"
 	"berty.tech/berty/v2/go/internal/accountutils"
 	"berty.tech/berty/v2/go/internal/initutil"
 	"berty.tech/berty/v2/go/internal/migrationsaccount"
@@ -38,7 +39,7 @@ import (
 	"berty.tech/weshnet/pkg/username"
 )
 
-func (s *service) openAccount(ctx context.Context, req *accounttypes.OpenAccount_Request, prog *progress.Progress) (*accounttypes.AccountMetadata, error) {
+func (s *service) openAccount(ctx context.Context, req *accounttypes.OpenAccount_Request, prog *progress.Progress) (_ *accounttypes.AccountMetadata, err error) {
 	if req.AccountID == "" {
 		return nil, errcode.ErrBertyAccountNoIDSpecified
 	}
@@ -60,6 +61,46 @@ func (s *service) openAccount(ctx context.Context, req *accounttypes.OpenAccount
 		return nil, errcode.ErrBertyAccountDataNotFound
 	}
 
+	// the failure is kept for AccountHealth, the step in progress is its
+	// stage if failedStage is not set
+	failedStage := ""
+	defer func() { s.recordOpenResult(req.AccountID, failedStage, prog, err) }()
+
+	// another process opening the account would corrupt its databases
+	lock, err := s.lockAccount(req.AccountID)
+	if err != nil {
+		failedStage = accounthealth.StageLock
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = lock.Release()
+		}
+	}()
+
+	// a bundled account is unpacked while it is open, the directories left by
+	// an interrupted session are reused as they are
+	bundled, err := s.isAccountBundled(req.AccountID)
+	if err != nil {
+		failedStage = accounthealth.StageUnseal
+		return nil, err
+	}
+	if unpacked, err := s.isAccountUnpacked(req.AccountID); err != nil {
+		failedStage = accounthealth.StageUnseal
+		return nil, err
+	} else if bundled && !unpacked {
+		if err := s.unsealAccount(req.AccountID); err != nil {
+			failedStage = accounthealth.StageUnseal
+			return nil, err
+		}
+
+		defer func() {
+			if err != nil {
+				s.discardUnsealedAccount(req.AccountID)
+			}
+		}()
+	}
+
 	if prog == nil {
 		prog = progress.New()
 		defer prog.Close()
@@ -71,7 +112,10 @@ func (s *service) openAccount(ctx context.Context, req *accounttypes.OpenAccount
 	prog.AddStep("setup-logger")
 	prog.AddStep("setup-manager")
 	prog.AddStep("setup-manager-logger")
-	prog.AddStep("setup-local-ipfs")
+	prog.AddStep("setup-" + initutil.InitStageRootDatastore)
+	prog.AddStep("setup-" + initutil.InitStageIPFS)
+	prog.AddStep("setup-" + initutil.InitStageOrbitDB)
+	prog.AddStep("setup-" + initutil.InitStageMessengerDB)
 	prog.AddStep("setup-grpc-server")
 	prog.AddStep("setup-local-messenger-server")
 	prog.AddStep("setup-notification-manager")
@@ -177,6 +221,14 @@ func (s *service) openAccount(ctx context.Context, req *accounttypes.OpenAccount
 
 	errCleanup = u.CombineFuncs(errCleanup, func() { initManager.Close(nil) })
 
+	accountID := s.openedAccountID
+	if s.deleteRevokedAccounts {
+		initManager.SetDeviceRevokedHandler(func() { go s.wipeRevokedAccount(accountID) })
+	}
+	if s.messengerDBReplay != nil {
+		initManager.SetMessengerDBReplay(s.messengerDBReplay)
+	}
+
 	// setup manager logger
 	prog.Get("setup-manager-logger").SetAsCurrent()
 	{
@@ -186,10 +238,20 @@ func (s *service) openAccount(ctx context.Context, req *accounttypes.OpenAccount
 		}
 	}
 
-	// setup local IPFS
-	prog.Get("setup-local-ipfs").SetAsCurrent()
+	// setup the datastore, IPFS, orbitdb and the messenger db, the
+	// independent ones concurrently
+	prog.Get("setup-manager-logger").Done()
 	{
-		if _, _, err = initManager.GetLocalIPFS(); err != nil {
+		onStage := func(stage string, done bool) {
+			if done {
+				prog.Get("setup-" + stage).Done()
+			} else {
+				prog.Get("setup-" + stage).Start()
+			}
+		}
+
+		if err = initManager.InitConcurrently(onStage); err != nil {
+			failedStage = initManager.FailedInitStage()
 			errCleanup()
 			return nil, errcode.TODO.Wrap(err)
 		}
@@ -253,6 +315,8 @@ func (s *service) openAccount(ctx context.Context, req *accounttypes.OpenAccount
 	}
 
 	s.initManager = initManager
+	s.openedAccountBundled = bundled
+	s.openedAccountLock = lock
 	prog.Get("finishing").SetAsCurrent().Done()
 
 	return meta, nil
@@ -351,9 +415,10 @@ func (s *service) CloseAccount(ctx context.Context, req *accounttypes.CloseAccou
 		s.logger.Warn("unable to close account", zap.Error(err))
 		return nil, errcode.ErrBertyAccountManagerClose.Wrap(err)
 	}
-	s.initManager = nil
-	s.accountData = nil
-	s.openedAccountID = ""
+
+	if err := s.closeOpenedAccount(ctx); err != nil {
+		return nil, errcode.ErrBertyAccountManagerClose.Wrap(err)
+	}
 
 	return &accounttypes.CloseAccount_Reply{}, nil
 }
@@ -404,9 +469,10 @@ func (s *service) CloseAccountWithProgress(req *accounttypes.CloseAccountWithPro
 		s.logger.Warn("unable to close account", zap.Error(err))
 		return errcode.ErrBertyAccountManagerClose.Wrap(err)
 	}
-	s.initManager = nil
-	s.accountData = nil
-	s.openedAccountID = ""
+
+	if err := s.closeOpenedAccount(server.Context()); err != nil {
+		return errcode.ErrBertyAccountManagerClose.Wrap(err)
+	}
 
 	// wait
 	<-done
@@ -466,7 +532,7 @@ func (s *service) ListAccounts(ctx context.Context, _ *accounttypes.ListAccounts
 	s.muService.Lock()
 	defer s.muService.Unlock()
 
-	accounts, err := accountutils.ListAccounts(ctx, s.sharedRootDir, s.nativeKeystore, s.logger)
+	accounts, err := accountutils.ListAccountsWithErrors(ctx, s.sharedRootDir, s.nativeKeystore, s.logger, s.recordListError)
 	if err != nil {
 		return nil, err
 	}
@@ -493,6 +559,20 @@ func (s *service) getAccountMetaForName(ctx context.Context, accountID string) (
 		}
 	}
 
+	// a closed bundled account keeps its metadata in the bundle header
+	if unpacked, err := s.isAccountUnpacked(accountID); err != nil {
+		return nil, err
+	} else if bundled, err := s.isAccountBundled(accountID); err != nil {
+		return nil, err
+	} else if bundled && !unpacked {
+		bundleKey, err := accountutils.GetBundleKeyForAccount(s.sharedRootDir, s.nativeKeystore, accountID)
+		if err != nil {
+			return nil, err
+		}
+
+		return accountutils.GetAccountMetaFromBundle(ctx, s.sharedRootDir, accountID, bundleKey)
+	}
+
 	return accountutils.GetAccountMetaForName(ctx, s.sharedRootDir, accountID, storageKey, storageSalt, s.logger)
 }
 
@@ -519,6 +599,12 @@ func (s *service) DeleteAccount(ctx context.Context, request *accounttypes.Delet
 		return nil, errcode.ErrDBRead.Wrap(err)
 	}
 
+	lock, err := s.lockAccount(request.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = lock.Release() }()
+
 	if err := os.RemoveAll(accountutils.GetAccountDir(s.appRootDir, request.AccountID)); err != nil {
 		return nil, errcode.ErrBertyAccountFSError.Wrap(err)
 	}
@@ -527,9 +613,46 @@ func (s *service) DeleteAccount(ctx context.Context, request *accounttypes.Delet
 		return nil, errcode.ErrBertyAccountFSError.Wrap(err)
 	}
 
+	if bundled, err := s.isAccountBundled(request.AccountID); err != nil {
+		return nil, err
+	} else if bundled {
+		if err := os.Remove(s.accountBundlePath(request.AccountID)); err != nil {
+			return nil, errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+	}
+
+	if err := accounthealth.Clear(accountutils.GetAccountLastErrorPath(s.sharedRootDir, request.AccountID)); err != nil {
+		return nil, err
+	}
+
 	return &accounttypes.DeleteAccount_Reply{}, nil
 }
 
+// wipeRevokedAccount closes the account and deletes its data, it is called
+// when another device of the account revoked the current one and
+// DeleteRevokedAccounts is set.
+func (s *service) wipeRevokedAccount(accountID string) {
+	s.muService.Lock()
+	opened := s.initManager != nil && s.openedAccountID == accountID
+	s.muService.Unlock()
+
+	if !opened {
+		return
+	}
+
+	s.logger.Warn("device revoked, deleting the account data", logutil.PrivateString("account-id", accountID))
+
+	ctx := context.Background()
+	if _, err := s.CloseAccount(ctx, &accounttypes.CloseAccount_Request{}); err != nil {
+		s.logger.Error("unable to close the revoked account", zap.Error(err))
+		return
+	}
+
+	if _, err := s.DeleteAccount(ctx, &accounttypes.DeleteAccount_Request{AccountID: accountID}); err != nil {
+		s.logger.Error("unable to delete the revoked account", zap.Error(err))
+	}
+}
+
 func (s *service) putInAccountDatastore(ctx context.Context, accountID string, key string, value []byte) error {
 	var storageKey []byte
 	if s.nativeKeystore != nil {
@@ -547,20 +670,22 @@ func (s *service) putInAccountDatastore(ctx context.Context, accountID string, k
 		}
 	}
 
-	ds, err := accountutils.GetRootDatastoreForPath(accountutils.GetAccountDir(s.sharedRootDir, accountID), storageKey, storageSalt, s.logger)
-	if err != nil {
-		return err
-	}
+	return s.withAccountFiles(ctx, accountID, true, func() error {
+		ds, err := accountutils.GetRootDatastoreForPath(accountutils.GetAccountDir(s.sharedRootDir, accountID), storageKey, storageSalt, s.logger)
+		if err != nil {
+			return err
+		}
 
-	if err := ds.Put(ctx, datastore.NewKey(key), value); err != nil {
-		return errcode.ErrBertyAccountFSError.Wrap(err)
-	}
+		if err := ds.Put(ctx, datastore.NewKey(key), value); err != nil {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
 
-	if err := ds.Close(); err != nil {
-		return errcode.ErrDBClose.Wrap(err)
-	}
+		if err := ds.Close(); err != nil {
+			return errcode.ErrDBClose.Wrap(err)
+		}
 
-	return nil
+		return nil
+	})
 }
 
 func (s *service) updateAccountMetadataLastOpened(ctx context.Context, accountID string) (*accounttypes.AccountMetadata, error) {
@@ -785,13 +910,13 @@ func (s *service) createAccount(ctx context.Context, req *accounttypes.CreateAcc
 	}
 
 	if req.AccountID != "" {
-		_, err := os.Stat(accountutils.GetAccountDir(s.appRootDir, req.AccountID))
-		if err == nil {
-			return nil, errcode.ErrBertyAccountAlreadyExists
-		}
-		if err != nil && !os.IsNotExist(err) {
+		exists, err := s.accountExists(req.AccountID)
+		if err != nil {
 			return nil, errcode.TODO.Wrap(err)
 		}
+		if exists {
+			return nil, errcode.ErrBertyAccountAlreadyExists
+		}
 	} else {
 		var err error
 
@@ -826,6 +951,12 @@ func (s *service) createAccount(ctx context.Context, req *accounttypes.CreateAcc
 		return nil, errcode.TODO.Wrap(err)
 	}
 
+	if s.bundleNewAccounts && s.appRootDir != accountutils.InMemoryDir {
+		if err := s.sealAccount(ctx, req.AccountID); err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+	}
+
 	return meta, nil
 }
 
@@ -895,24 +1026,34 @@ func (s *service) UpdateAccount(ctx context.Context, req *accounttypes.UpdateAcc
 	defer func() { endSection(err) }()
 
 	// check if account exists
-	if _, err := os.Stat(accountutils.GetAccountDir(s.appRootDir, req.AccountID)); err != nil {
+	if exists, err := s.accountExists(req.AccountID); err != nil {
 		return nil, errcode.TODO.Wrap(err)
+	} else if !exists {
+		return nil, errcode.ErrBertyAccountDataNotFound
 	}
 
-	// migrate account
-	if err := migrationsaccount.MigrateToLatest(migrationsaccount.Options{
-		AppDir:         s.appRootDir,
-		SharedDir:      s.sharedRootDir,
-		NativeKeystore: s.nativeKeystore,
-		Logger:         s.logger,
-		AccountID:      req.AccountID,
-	}); err != nil {
-		return nil, errcode.TODO.Wrap(err)
-	}
+	var meta *accounttypes.AccountMetadata
+	err = s.withAccountFiles(ctx, req.AccountID, true, func() (err error) {
+		// migrate account
+		if err := migrationsaccount.MigrateToLatest(migrationsaccount.Options{
+			AppDir:         s.appRootDir,
+			SharedDir:      s.sharedRootDir,
+			NativeKeystore: s.nativeKeystore,
+			Logger:         s.logger,
+			AccountID:      req.AccountID,
+		}); err != nil {
+			return errcode.TODO.Wrap(err)
+		}
 
-	meta, err := s.updateAccount(ctx, req)
+		meta, err = s.updateAccount(ctx, req)
+		if err != nil {
+			return errcode.ErrBertyAccountUpdateFailed.Wrap(err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return nil, errcode.ErrBertyAccountUpdateFailed.Wrap(err)
+		return nil, err
 	}
 
 	return &accounttypes.UpdateAccount_Reply{
@@ -948,6 +1089,12 @@ func (s *service) generateNewAccountID() (string, error) {
 			continue
 		}
 
+		if bundled, err := s.isAccountBundled(candidateID); err != nil {
+			return "", errcode.ErrBertyAccountIDGenFailed.Wrap(err)
+		} else if bundled {
+			continue
+		}
+
 		return candidateID, nil
 	}
 }
@@ -1009,22 +1156,30 @@ func (s *service) NetworkConfigForAccount(ctx context.Context, accountID string)
 		}
 	}
 
-	ds, err := accountutils.GetRootDatastoreForPath(accountutils.GetAccountDir(s.sharedRootDir, accountID), storageKey, storageSalt, s.logger)
-	if err != nil {
-		s.logger.Warn("unable to read network configuration for account: failed to get root datastore", zap.Error(err), logutil.PrivateString("account-id", accountID))
-		return NetworkConfigGetDefault(), false
-	}
+	var netConfBytes []byte
+	err := s.withAccountFiles(ctx, accountID, false, func() error {
+		ds, err := accountutils.GetRootDatastoreForPath(accountutils.GetAccountDir(s.sharedRootDir, accountID), storageKey, storageSalt, s.logger)
+		if err != nil {
+			return fmt.Errorf("failed to get root datastore: %w", err)
+		}
 
-	netConfBytes, err := ds.Get(ctx, datastore.NewKey(accountutils.AccountNetConfFileName))
-	if err == datastore.ErrNotFound {
-		return NetworkConfigGetDefault(), false
-	} else if err != nil {
+		netConfBytes, err = ds.Get(ctx, datastore.NewKey(accountutils.AccountNetConfFileName))
+		if err != nil && err != datastore.ErrNotFound {
+			return err
+		}
+
+		if err := ds.Close(); err != nil {
+			s.logger.Warn("unable to close datastore after reading network configuration for account", zap.Error(err), logutil.PrivateString("account-id", accountID))
+		}
+
+		return nil
+	})
+	if err != nil {
 		s.logger.Warn("unable to read network configuration for account", zap.Error(err), logutil.PrivateString("account-id", accountID))
 		return NetworkConfigGetDefault(), false
 	}
-
-	if err := ds.Close(); err != nil {
-		s.logger.Warn("unable to close datastore after reading network configuration for account", zap.Error(err), logutil.PrivateString("account-id", accountID))
+	if netConfBytes == nil {
+		return NetworkConfigGetDefault(), false
 	}
 
 	ret := &accounttypes.NetworkConfig{}
@@ -1265,15 +1420,25 @@ func (s *service) PushReceive(ctx context.Context, req *accounttypes.PushReceive
 		return nil, errcode.ErrDeserialization.Wrap(err)
 	}
 
+	cat := localization.Catalog()
+	printer := cat.NewPrinter(s.languages...)
+
+	// the push server sent the push without its payload, there is nothing to
+	// decrypt
+	if len(payload) == 0 {
+		pushData := bertypush.ContentFreePush()
+		return &accounttypes.PushReceive_Reply{
+			PushData: pushData,
+			Push:     bertypush.FormatDecryptedPush(pushData, printer),
+		}, nil
+	}
+
 	initManager, err := s.getInitManager()
 	if err != nil {
 		s.logger.Warn("unable to retrieve init manager", zap.Error(err))
 		initManager = nil
 	}
 
-	cat := localization.Catalog()
-	printer := cat.NewPrinter(s.languages...)
-
 	s.muService.Lock()
 	defer s.muService.Unlock()
 
@@ -1374,7 +1539,7 @@ func (s *service) accountExists(accountID string) (bool, error) {
 		return true, nil
 	}
 	if os.IsNotExist(err) {
-		return false, nil
+		return s.isAccountBundled(accountID)
 	}
 	return false, err
 }
@@ -0,0 +1,251 @@
+package bertyaccount
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/accountbundle"
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/logutil"
+)
+
+// AccountBundler converts closed accounts between the directory storage and
+// the single bundle file storage, see accountbundle.
+type AccountBundler interface {
+	// BundleAccount stores a closed account as a single encrypted bundle file.
+	BundleAccount(ctx context.Context, accountID string) error
+
+	// UnbundleAccount stores a closed bundled account as directories again.
+	UnbundleAccount(ctx context.Context, accountID string) error
+}
+
+var _ AccountBundler = (*service)(nil)
+
+func (s *service) BundleAccount(ctx context.Context, accountID string) error {
+	s.muService.Lock()
+	defer s.muService.Unlock()
+
+	if err := s.checkClosedAccount(accountID); err != nil {
+		return err
+	}
+
+	if exists, err := s.accountExists(accountID); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	} else if !exists {
+		return errcode.ErrBertyAccountDataNotFound
+	}
+
+	// a bundled account is unpacked and sealed again, to recover a working
+	// copy left by an interrupted session
+	if err := s.unsealAccount(accountID); err != nil {
+		return err
+	}
+
+	return s.sealAccount(ctx, accountID)
+}
+
+func (s *service) UnbundleAccount(ctx context.Context, accountID string) error {
+	s.muService.Lock()
+	defer s.muService.Unlock()
+
+	if err := s.checkClosedAccount(accountID); err != nil {
+		return err
+	}
+
+	bundled, err := s.isAccountBundled(accountID)
+	if err != nil {
+		return err
+	}
+	if !bundled {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("account %s is not bundled", accountID))
+	}
+
+	if err := s.unsealAccount(accountID); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.accountBundlePath(accountID)); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+
+	return nil
+}
+
+func (s *service) checkClosedAccount(accountID string) error {
+	if accountID == "" {
+		return errcode.ErrBertyAccountNoIDSpecified
+	}
+
+	if s.appRootDir == accountutils.InMemoryDir {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("in memory accounts cannot be bundled"))
+	}
+
+	if s.initManager != nil && s.openedAccountID == accountID {
+		return errcode.ErrBertyAccountAlreadyOpened
+	}
+
+	return nil
+}
+
+func (s *service) accountBundlePath(accountID string) string {
+	return accountutils.GetAccountBundlePath(s.sharedRootDir, accountID)
+}
+
+// accountBundleDirs returns the directories of an account, the shared one is
+// the app one on desktop.
+func (s *service) accountBundleDirs(accountID string) []accountbundle.Dir {
+	dirs := []accountbundle.Dir{{Name: "app", Path: accountutils.GetAccountDir(s.appRootDir, accountID)}}
+	if s.sharedRootDir != s.appRootDir {
+		dirs = append(dirs, accountbundle.Dir{Name: "shared", Path: accountutils.GetAccountDir(s.sharedRootDir, accountID)})
+	}
+	return dirs
+}
+
+func (s *service) isAccountBundled(accountID string) (bool, error) {
+	if s.sharedRootDir == accountutils.InMemoryDir {
+		return false, nil
+	}
+
+	_, err := os.Stat(s.accountBundlePath(accountID))
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+}
+
+// isAccountUnpacked returns true when the directories of an account are on
+// disk, for a bundled account while it is open.
+func (s *service) isAccountUnpacked(accountID string) (bool, error) {
+	_, err := os.Stat(accountutils.GetAccountDir(s.appRootDir, accountID))
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, errcode.ErrBertyAccountFSError.Wrap(err)
+	}
+}
+
+// unsealAccount unpacks a bundled account into its directories, unless they
+// are already there.
+func (s *service) unsealAccount(accountID string) error {
+	if unpacked, err := s.isAccountUnpacked(accountID); err != nil || unpacked {
+		return err
+	}
+
+	bundleKey, err := accountutils.GetBundleKeyForAccount(s.sharedRootDir, s.nativeKeystore, accountID)
+	if err != nil {
+		return err
+	}
+
+	return accountbundle.Open(s.accountBundlePath(accountID), bundleKey, s.accountBundleDirs(accountID))
+}
+
+// sealAccount archives the directories of an account into its bundle, and
+// removes them once the bundle is written.
+func (s *service) sealAccount(ctx context.Context, accountID string) error {
+	meta, err := s.getAccountMetaForName(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	meta.AccountID = ""
+
+	metaBytes, err := proto.Marshal(meta)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	bundleKey, err := accountutils.GetBundleKeyForAccount(s.sharedRootDir, s.nativeKeystore, accountID)
+	if err != nil {
+		return err
+	}
+
+	dirs := s.accountBundleDirs(accountID)
+	if err := accountbundle.Seal(s.accountBundlePath(accountID), bundleKey, metaBytes, dirs); err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir.Path); err != nil {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// closeOpenedAccount forgets the closed account, and seals it again if it is
+// bundled. If sealing fails the directories are kept, and reused on the next
+// opening. The lock of the account is released last.
+func (s *service) closeOpenedAccount(ctx context.Context) error {
+	accountID, bundled, lock := s.openedAccountID, s.openedAccountBundled, s.openedAccountLock
+
+	s.initManager = nil
+	s.accountData = nil
+	s.openedAccountID = ""
+	s.openedAccountBundled = false
+	s.openedAccountLock = nil
+
+	if !bundled {
+		return lock.Release()
+	}
+
+	// sealed before the lock is released
+	return multierr.Append(s.sealAccount(ctx, accountID), lock.Release())
+}
+
+// discardUnsealedAccount removes the directories unpacked from the bundle of
+// an account which failed to open, the bundle is left as it was.
+func (s *service) discardUnsealedAccount(accountID string) {
+	for _, dir := range s.accountBundleDirs(accountID) {
+		if err := os.RemoveAll(dir.Path); err != nil {
+			s.logger.Warn("unable to remove unpacked account", zap.Error(err), logutil.PrivateString("account-id", accountID))
+		}
+	}
+}
+
+// withAccountFiles runs fn with the directories of accountID on disk. A
+// closed bundled account is unpacked for fn, and sealed again after it if
+// write is true.
+func (s *service) withAccountFiles(ctx context.Context, accountID string, write bool, fn func() error) error {
+	bundled, err := s.isAccountBundled(accountID)
+	if err != nil {
+		return err
+	}
+
+	unpacked, err := s.isAccountUnpacked(accountID)
+	if err != nil {
+		return err
+	}
+
+	if !bundled || unpacked {
+		return fn()
+	}
+
+	if err := s.unsealAccount(accountID); err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		s.discardUnsealedAccount(accountID)
+		return err
+	}
+
+	if !write {
+		s.discardUnsealedAccount(accountID)
+		return nil
+	}
+
+	return s.sealAccount(ctx, accountID)
+}
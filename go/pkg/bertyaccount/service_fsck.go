@@ -0,0 +1,76 @@
+package bertyaccount
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"berty.tech/berty/v2/go/internal/accountfsck"
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// AccountChecker checks the integrity of the data of an account without
+// modifying it, see accountfsck.
+type AccountChecker interface {
+	// CheckAccount returns the report of the checks of accountID, the
+	// account may be open. A bundled account is only checked while it is
+	// unpacked.
+	CheckAccount(ctx context.Context, accountID string) (*accountfsck.Report, error)
+}
+
+var _ AccountChecker = (*service)(nil)
+
+func (s *service) CheckAccount(ctx context.Context, accountID string) (*accountfsck.Report, error) {
+	s.muService.Lock()
+	defer s.muService.Unlock()
+
+	if accountID == "" {
+		return nil, errcode.ErrBertyAccountNoIDSpecified
+	}
+
+	if strings.ContainsAny(filepath.Clean(accountID), "/\\") {
+		return nil, errcode.ErrBertyAccountInvalidIDFormat
+	}
+
+	if s.sharedRootDir == accountutils.InMemoryDir {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("in memory accounts have no data to check"))
+	}
+
+	if exists, err := s.accountExists(accountID); err != nil {
+		return nil, errcode.ErrBertyAccountFSError.Wrap(err)
+	} else if !exists {
+		return nil, errcode.ErrBertyAccountDataNotFound
+	}
+
+	// the bundle is not unpacked to be checked, unpacking it writes the
+	// account
+	if unpacked, err := s.isAccountUnpacked(accountID); err != nil {
+		return nil, err
+	} else if !unpacked {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("the account is bundled, it can be checked while it is open"))
+	}
+
+	opts := accountfsck.Options{
+		AccountID:   accountID,
+		Dir:         accountutils.GetAccountDir(s.sharedRootDir, accountID),
+		PushKeyPath: s.devicePushKeyPath,
+		Logger:      s.logger,
+	}
+
+	if s.nativeKeystore != nil {
+		var err error
+		if opts.StorageKey, err = accountutils.GetOrCreateStorageKeyForAccount(s.nativeKeystore, accountID); err != nil {
+			return nil, err
+		}
+		if opts.RootDatastoreSalt, err = accountutils.GetOrCreateRootDatastoreSaltForAccount(s.nativeKeystore, accountID); err != nil {
+			return nil, err
+		}
+		if opts.MessengerDBSalt, err = accountutils.GetOrCreateMessengerDBSaltForAccount(s.nativeKeystore, accountID); err != nil {
+			return nil, err
+		}
+	}
+
+	return accountfsck.Run(ctx, opts)
+}
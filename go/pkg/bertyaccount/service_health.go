@@ -0,0 +1,107 @@
+package bertyaccount
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"moul.io/progress"
+
+	"berty.tech/berty/v2/go/internal/accounthealth"
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/logutil"
+)
+
+var _ accounthealth.Reporter = (*service)(nil)
+
+// AccountHealth returns the last error of accountID, kept until the account
+// is opened successfully, and the remediations to try.
+func (s *service) AccountHealth(_ context.Context, accountID string) (*accounthealth.Health, error) {
+	s.muService.Lock()
+	defer s.muService.Unlock()
+
+	if exists, err := s.accountExists(accountID); err != nil {
+		return nil, errcode.ErrBertyAccountFSError.Wrap(err)
+	} else if !exists {
+		return nil, errcode.ErrBertyAccountDataNotFound
+	}
+
+	record, err := s.accountLastError(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accounthealth.Health{
+		AccountID:    accountID,
+		LastError:    record,
+		Remediations: accounthealth.Remediations(record),
+	}, nil
+}
+
+// accountLastError returns the last error of accountID, or nil if it has
+// none.
+func (s *service) accountLastError(accountID string) (*accounthealth.Record, error) {
+	if s.sharedRootDir == accountutils.InMemoryDir {
+		return nil, nil
+	}
+
+	return accounthealth.Load(accountutils.GetAccountLastErrorPath(s.sharedRootDir, accountID))
+}
+
+// recordOpenResult keeps the failure of the opening of accountID at stage, or
+// clears the last error of the account if it was opened. An empty stage is
+// the step of prog in progress.
+func (s *service) recordOpenResult(accountID string, stage string, prog *progress.Progress, openErr error) {
+	if s.sharedRootDir == accountutils.InMemoryDir {
+		return
+	}
+
+	path := accountutils.GetAccountLastErrorPath(s.sharedRootDir, accountID)
+	if openErr == nil {
+		if err := accounthealth.Clear(path); err != nil {
+			s.logger.Warn("unable to clear the last error of the account", zap.Error(err), logutil.PrivateString("account-id", accountID))
+		}
+		return
+	}
+
+	if stage == "" {
+		stage = openStage(prog)
+	}
+
+	if _, err := accounthealth.Save(path, stage, openErr, time.Now()); err != nil {
+		s.logger.Warn("unable to record the last error of the account", zap.Error(err), logutil.PrivateString("account-id", accountID))
+	}
+}
+
+// recordListError keeps the failure of the listing of accountID, unless the
+// account already has a last error: the opening reports a more precise one.
+func (s *service) recordListError(accountID string, stage string, listErr error) {
+	if s.sharedRootDir == accountutils.InMemoryDir {
+		return
+	}
+
+	path := accountutils.GetAccountLastErrorPath(s.sharedRootDir, accountID)
+	if record, err := accounthealth.Load(path); err == nil && record != nil {
+		return
+	}
+
+	if _, err := accounthealth.Save(path, stage, listErr, time.Now()); err != nil {
+		s.logger.Warn("unable to record the last error of the account", zap.Error(err), logutil.PrivateString("account-id", accountID))
+	}
+}
+
+// openStage returns the step of the opening in progress, named as the stages
+// of accounthealth.
+func openStage(prog *progress.Progress) string {
+	if prog != nil {
+		for _, step := range prog.Steps {
+			if step.State == progress.StateInProgress {
+				return strings.TrimPrefix(step.ID, "setup-")
+			}
+		}
+	}
+
+	return "open"
+}
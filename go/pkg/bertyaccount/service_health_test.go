@@ -0,0 +1,60 @@
+package bertyaccount
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"moul.io/progress"
+
+	"berty.tech/berty/v2/go/internal/accounthealth"
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestRecordOpenResult(t *testing.T) {
+	s := &service{logger: zap.NewNop(), sharedRootDir: t.TempDir()}
+	require.NoError(t, os.MkdirAll(accountutils.GetAccountsDir(s.sharedRootDir), 0o700))
+
+	record, err := s.accountLastError("0")
+	require.NoError(t, err)
+	require.Nil(t, record)
+
+	// the stage is the step in progress
+	prog := progress.New()
+	defer prog.Close()
+	prog.AddStep("migrate")
+	prog.AddStep("setup-" + accounthealth.StageMessengerDB)
+	prog.Get("migrate").Start()
+	prog.Get("setup-" + accounthealth.StageMessengerDB).SetAsCurrent()
+
+	s.recordOpenResult("0", "", prog, errcode.ErrDBOpen.Wrap(fmt.Errorf("malformed")))
+	record, err = s.accountLastError("0")
+	require.NoError(t, err)
+	require.Equal(t, accounthealth.StageMessengerDB, record.Stage)
+	require.Equal(t, errcode.ErrDBOpen, record.Code)
+
+	// the listing does not replace the failure of the opening
+	s.recordListError("0", accounthealth.StageMetadata, errcode.ErrBertyAccountDataNotFound)
+	record, err = s.accountLastError("0")
+	require.NoError(t, err)
+	require.Equal(t, accounthealth.StageMessengerDB, record.Stage)
+
+	s.recordOpenResult("0", accounthealth.StageLock, nil, errcode.ErrBertyAccountAlreadyOpened)
+	record, err = s.accountLastError("0")
+	require.NoError(t, err)
+	require.Equal(t, accounthealth.StageLock, record.Stage)
+
+	// an opened account has no last error
+	s.recordOpenResult("0", "", nil, nil)
+	record, err = s.accountLastError("0")
+	require.NoError(t, err)
+	require.Nil(t, record)
+
+	s.recordListError("0", accounthealth.StageMetadata, errcode.ErrBertyAccountDataNotFound)
+	record, err = s.accountLastError("0")
+	require.NoError(t, err)
+	require.Equal(t, accounthealth.StageMetadata, record.Stage)
+}
@@ -0,0 +1,150 @@
+package bertyaccount
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/pkg/accounttypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// MessengerDBRebuilder materializes the messenger db of a closed account
+// again from the logs of its groups, the fix for a db which diverged from
+// the logs.
+type MessengerDBRebuilder interface {
+	// RebuildMessengerDB removes the messenger db of a closed account and
+	// replays the logs of its groups in a new one, the previous db is put
+	// back if the rebuild fails. progress is optional, it is called with a
+	// description of each step. The local state of the db, e.g. the unread
+	// counters, is lost.
+	RebuildMessengerDB(ctx context.Context, accountID string, progress func(step string)) error
+}
+
+var _ MessengerDBRebuilder = (*service)(nil)
+
+func (s *service) RebuildMessengerDB(ctx context.Context, accountID string, progress func(step string)) (err error) {
+	s.muService.Lock()
+	defer s.muService.Unlock()
+
+	if progress == nil {
+		progress = func(string) {}
+	}
+
+	if accountID == "" {
+		return errcode.ErrBertyAccountNoIDSpecified
+	}
+
+	if s.sharedRootDir == accountutils.InMemoryDir {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("in memory accounts have no messenger db to rebuild"))
+	}
+
+	// the node is opened to replay the logs, only one account can be open
+	if s.initManager != nil {
+		return errcode.ErrBertyAccountAlreadyOpened
+	}
+
+	if exists, err := s.accountExists(accountID); err != nil {
+		return errcode.ErrBertyAccountFSError.Wrap(err)
+	} else if !exists {
+		return errcode.ErrBertyAccountDataNotFound
+	}
+
+	// a bundled account is unpacked to replace its db, it is sealed again
+	// when closed
+	bundled, err := s.isAccountBundled(accountID)
+	if err != nil {
+		return err
+	}
+	if unpacked, err := s.isAccountUnpacked(accountID); err != nil {
+		return err
+	} else if bundled && !unpacked {
+		progress("unpacking the account bundle")
+		if err := s.unsealAccount(accountID); err != nil {
+			return err
+		}
+
+		defer func() {
+			if err != nil {
+				s.discardUnsealedAccount(accountID)
+			}
+		}()
+	}
+
+	dbPath := filepath.Join(accountutils.GetAccountDir(s.sharedRootDir, accountID), accountutils.MessengerDatabaseFilename)
+	files := []string{dbPath, dbPath + "-wal", dbPath + "-shm"}
+
+	progress("moving the messenger db aside")
+	if err := moveMessengerDB(files, "", accountutils.MessengerDBBackupSuffix); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err == nil {
+			err = removeMessengerDB(files, accountutils.MessengerDBBackupSuffix)
+			return
+		}
+
+		if restoreErr := s.restoreMessengerDB(files); restoreErr != nil {
+			s.logger.Error("unable to restore the previous messenger db", zap.Error(restoreErr))
+		}
+	}()
+
+	s.messengerDBReplay = func(done, total int) {
+		progress(fmt.Sprintf("replayed %d/%d groups", done, total))
+	}
+	defer func() { s.messengerDBReplay = nil }()
+
+	progress("opening the account and replaying the group logs")
+	if _, err := s.openAccount(ctx, &accounttypes.OpenAccount_Request{AccountID: accountID}, nil); err != nil {
+		return errcode.ErrBertyAccountOpenAccount.Wrap(err)
+	}
+
+	progress("closing the account")
+	closeErr := s.initManager.Close(nil)
+	if err := s.closeOpenedAccount(ctx); err != nil {
+		return errcode.ErrBertyAccountManagerClose.Wrap(err)
+	}
+	if closeErr != nil {
+		return errcode.ErrBertyAccountManagerClose.Wrap(closeErr)
+	}
+
+	progress("messenger db rebuilt")
+	return nil
+}
+
+// restoreMessengerDB replaces the messenger db left by a failed rebuild by
+// the previous one.
+func (s *service) restoreMessengerDB(files []string) error {
+	if err := removeMessengerDB(files, ""); err != nil {
+		return err
+	}
+
+	return moveMessengerDB(files, accountutils.MessengerDBBackupSuffix, "")
+}
+
+// moveMessengerDB renames the existing files of the messenger db, from their
+// name with the from suffix to their name with the to suffix.
+func moveMessengerDB(files []string, from, to string) error {
+	for _, file := range files {
+		if err := os.Rename(file+from, file+to); err != nil && !os.IsNotExist(err) {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func removeMessengerDB(files []string, suffix string) error {
+	for _, file := range files {
+		if err := os.Remove(file + suffix); err != nil && !os.IsNotExist(err) {
+			return errcode.ErrBertyAccountFSError.Wrap(err)
+		}
+	}
+
+	return nil
+}
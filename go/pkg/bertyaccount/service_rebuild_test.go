@@ -0,0 +1,46 @@
+package bertyaccount
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/accountutils"
+)
+
+func TestRestoreMessengerDB(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "messenger.sqlite")
+	files := []string{dbPath, dbPath + "-wal", dbPath + "-shm"}
+
+	// the previous db has no -shm file
+	require.NoError(t, os.WriteFile(dbPath, []byte("previous"), 0o600))
+	require.NoError(t, os.WriteFile(dbPath+"-wal", []byte("previous wal"), 0o600))
+
+	require.NoError(t, moveMessengerDB(files, "", accountutils.MessengerDBBackupSuffix))
+	require.NoFileExists(t, dbPath)
+	require.FileExists(t, dbPath+accountutils.MessengerDBBackupSuffix)
+
+	// the failed rebuild left a new db
+	for _, file := range files {
+		require.NoError(t, os.WriteFile(file, []byte("rebuilt"), 0o600))
+	}
+
+	s := &service{logger: zap.NewNop()}
+	require.NoError(t, s.restoreMessengerDB(files))
+
+	content, err := os.ReadFile(dbPath)
+	require.NoError(t, err)
+	require.Equal(t, "previous", string(content))
+
+	content, err = os.ReadFile(dbPath + "-wal")
+	require.NoError(t, err)
+	require.Equal(t, "previous wal", string(content))
+
+	require.NoFileExists(t, dbPath+"-shm")
+	for _, file := range files {
+		require.NoFileExists(t, file+accountutils.MessengerDBBackupSuffix)
+	}
+}
@@ -0,0 +1,91 @@
+package bertyaccount
+
+import (
+	"context"
+
+	"berty.tech/berty/v2/go/internal/accountlock"
+	"berty.tech/berty/v2/go/internal/accountsession"
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/pkg/accounttypes"
+)
+
+// Sessions returns the manager of the leases on the opened account.
+func (s *service) Sessions() *accountsession.Manager {
+	return s.sessions
+}
+
+// lockAccount prevents the other processes from opening accountID until the
+// lock is released, see accountlock.
+func (s *service) lockAccount(accountID string) (*accountlock.Lock, error) {
+	if s.sharedRootDir == accountutils.InMemoryDir {
+		return nil, nil
+	}
+
+	return accountlock.Acquire(accountutils.GetAccountDir(s.sharedRootDir, accountID))
+}
+
+// sessionAccounts is the account service used by the lease manager.
+type sessionAccounts struct {
+	s *service
+}
+
+var _ accountsession.Accounts = (*sessionAccounts)(nil)
+
+func (a *sessionAccounts) OpenAccount(ctx context.Context, accountID string, args []string) error {
+	_, err := a.s.OpenAccount(ctx, &accounttypes.OpenAccount_Request{AccountID: accountID, Args: args})
+	return err
+}
+
+func (a *sessionAccounts) CloseAccount(ctx context.Context) error {
+	_, err := a.s.CloseAccount(ctx, &accounttypes.CloseAccount_Request{})
+	return err
+}
+
+func (a *sessionAccounts) OpenedAccount(context.Context) (string, error) {
+	a.s.muService.RLock()
+	defer a.s.muService.RUnlock()
+
+	if a.s.initManager == nil {
+		return "", nil
+	}
+	return a.s.openedAccountID, nil
+}
+
+func (a *sessionAccounts) ListAccounts(ctx context.Context) ([]*accountsession.Account, error) {
+	opened, err := a.OpenedAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := a.s.ListAccounts(ctx, &accounttypes.ListAccounts_Request{})
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]*accountsession.Account, len(reply.Accounts))
+	for i, meta := range reply.Accounts {
+		accounts[i] = &accountsession.Account{
+			AccountID:  meta.AccountID,
+			Name:       meta.Name,
+			LastOpened: meta.LastOpened,
+			Error:      meta.Error,
+			Opened:     meta.AccountID == opened,
+		}
+
+		if accounts[i].Opened || a.s.sharedRootDir == accountutils.InMemoryDir {
+			continue
+		}
+
+		// an unreadable record is not worth hiding the account
+		accounts[i].LastError, _ = a.s.accountLastError(meta.AccountID)
+
+		holder, err := accountlock.ReadHolder(accountutils.GetAccountDir(a.s.sharedRootDir, meta.AccountID))
+		if err != nil {
+			accounts[i].Error = err.Error()
+			continue
+		}
+		accounts[i].LockedBy = holder
+	}
+
+	return accounts, nil
+}
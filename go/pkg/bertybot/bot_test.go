@@ -8,6 +8,7 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/stretchr/testify/require"
 
+	"berty.tech/berty/v2/go/pkg/appmessage"
 	"berty.tech/berty/v2/go/pkg/bertymessenger"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 	"berty.tech/weshnet/pkg/testutil"
@@ -24,7 +25,10 @@ func TestFlappyBotCommunication(t *testing.T) {
 
 	botClient, userClient := clients[0].Client, clients[1].Client
 
-	var commandCalled bool
+	var (
+		commandCalled bool
+		receivedPoll  appmessage.Message
+	)
 
 	// create bot
 	var bot *Bot
@@ -41,6 +45,11 @@ func TestFlappyBotCommunication(t *testing.T) {
 				ctx.ReplyString("pong")
 				commandCalled = true
 			}),
+			WithHandler(UserMessageHandler, func(ctx Context) {
+				if _, ok := ctx.AppMessage.(appmessage.Poll); ok && !ctx.IsMine {
+					receivedPoll = ctx.AppMessage
+				}
+			}),
 		)
 		require.NoError(t, err)
 	}
@@ -109,4 +118,15 @@ func TestFlappyBotCommunication(t *testing.T) {
 	}
 
 	require.True(t, commandCalled)
+
+	// send a poll
+	{
+		poll := appmessage.Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}}
+		req, err := appmessage.InteractRequest(theConv.PublicKey, poll)
+		require.NoError(t, err)
+		_, err = userClient.Interact(ctx, req)
+		require.NoError(t, err)
+		time.Sleep(200 * time.Millisecond) // FIXME: replace with dynamic waiting
+		require.Equal(t, poll, receivedPoll)
+	}
 }
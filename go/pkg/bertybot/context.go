@@ -7,6 +7,7 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"go.uber.org/zap"
 
+	"berty.tech/berty/v2/go/pkg/appmessage"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 )
 
@@ -33,6 +34,7 @@ type Context struct {
 	Device         *messengertypes.Device       `json:"Device,omitempty"`
 	ConversationPK string                       `json:"ConversationPK,omitempty"`
 	UserMessage    string                       `json:"UserMessage,omitempty"`
+	AppMessage     appmessage.Message           `json:"-"` // structured content of the user message, see appmessage
 	CommandArgs    []string
 
 	// internal
@@ -42,19 +44,21 @@ type Context struct {
 // ReplyString sends a text message on the conversation related to the context.
 // The conversation can be 1-1 or multi-member.
 func (ctx *Context) ReplyString(text string) error {
+	return ctx.Reply(appmessage.Text{Body: text})
+}
+
+// Reply sends a structured message on the conversation related to the
+// context, e.g. an appmessage.Poll, encoded with the default registry.
+func (ctx *Context) Reply(m appmessage.Message) error {
 	if ctx.ConversationPK == "" {
 		return fmt.Errorf("unknown conversation PK, cannot reply")
 	}
 	// FIXME: support group conversation
-	userMessage, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: text})
+	req, err := appmessage.InteractRequest(ctx.ConversationPK, m)
 	if err != nil {
 		return fmt.Errorf("marshal user message failed: %w", err)
 	}
-	_, err = ctx.Client.Interact(ctx.Context, &messengertypes.Interact_Request{
-		Type:                  messengertypes.AppMessage_TypeUserMessage,
-		Payload:               userMessage,
-		ConversationPublicKey: ctx.ConversationPK,
-	})
+	_, err = ctx.Client.Interact(ctx.Context, req)
 	if err != nil {
 		return fmt.Errorf("interact failed: %w", err)
 	}
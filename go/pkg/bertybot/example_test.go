@@ -9,6 +9,7 @@ import (
 	"go.uber.org/zap"
 	"moul.io/u"
 
+	"berty.tech/berty/v2/go/pkg/appmessage"
 	"berty.tech/berty/v2/go/pkg/bertybot"
 )
 
@@ -33,6 +34,9 @@ func Example() {
 		bertybot.WithHandler(bertybot.UserMessageHandler, func(ctx bertybot.Context) { // custom handler
 			ctx.ReplyString("hello world!")
 		}),
+		bertybot.WithCommand("lunch", "ask where to eat", func(ctx bertybot.Context) { // structured reply, see appmessage
+			ctx.Reply(appmessage.Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}})
+		}),
 	)
 
 	// display link and qr code
@@ -7,6 +7,7 @@ import (
 
 	"go.uber.org/zap"
 
+	"berty.tech/berty/v2/go/pkg/appmessage"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 )
 
@@ -92,6 +93,10 @@ func (b *Bot) handleEvent(ctx context.Context, event *messengertypes.StreamEvent
 		case messengertypes.AppMessage_TypeUserMessage:
 			receivedMessage := payload.(*messengertypes.AppMessage_UserMessage)
 			context.UserMessage = receivedMessage.GetBody()
+			if context.AppMessage, err = appmessage.Unmarshal(context.Interaction.Payload); err != nil {
+				b.logger.Warn("invalid structured message", zap.Error(err))
+				context.AppMessage = appmessage.Text{Body: context.UserMessage}
+			}
 			if len(b.commands) > 0 && len(context.UserMessage) > 1 && strings.HasPrefix(context.UserMessage, "/") {
 				if !context.IsMine && !context.IsReplay && !context.IsAck {
 					context.CommandArgs = strings.Split(strings.TrimSpace(context.UserMessage[1:]), " ")
@@ -0,0 +1,219 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/accountquota"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/messengerutil"
+)
+
+const (
+	// DefaultMessageRetention is the age under which the messages, and their
+	// attachments, are never pruned to bring the account under its quota.
+	DefaultMessageRetention = 30 * 24 * time.Hour
+
+	// quotaPruneBatch is the number of interactions pruned at once, the size
+	// of the account is measured again after each batch.
+	quotaPruneBatch = 100
+)
+
+// AccountQuota bounds the size of the account on disk. Over the quota, the
+// attachments of the oldest interactions are released, then the unpinned
+// blocks are collected, then the oldest messages are deleted, and the new
+// interactions and attachments are refused when that is not enough.
+type AccountQuota struct {
+	// Limit is the quota, in bytes, it is not enforced when zero.
+	Limit int64
+
+	// WarnRatio is the share of the quota the user is warned at,
+	// accountquota.DefaultWarnRatio when zero.
+	WarnRatio float64
+
+	// Size measures the account on disk, e.g. with accountquota.DirSize.
+	Size accountquota.SizeFunc
+
+	// PruneBlocks collects the blocks of the node which are not pinned, the
+	// step is skipped when nil.
+	PruneBlocks accountquota.PruneFunc
+
+	// MessageRetention is the age under which the messages and their
+	// attachments are kept, DefaultMessageRetention when zero.
+	MessageRetention time.Duration
+
+	// CheckInterval is the time between two checks of the size of the
+	// account, accountquota.DefaultCheckInterval when zero.
+	CheckInterval time.Duration
+}
+
+// newAccountQuota returns the enforcer of the quota, nil when there is none.
+func (svc *service) newAccountQuota(opts AccountQuota) (*accountquota.Enforcer, error) {
+	if opts.Limit == 0 {
+		return nil, nil
+	}
+
+	if opts.MessageRetention <= 0 {
+		opts.MessageRetention = DefaultMessageRetention
+	}
+
+	pruners := []accountquota.Pruner(nil)
+	if svc.attachments != nil {
+		pruners = append(pruners, accountquota.Pruner{Name: "attachments", Prune: func(ctx context.Context) (bool, error) {
+			return svc.pruneOldestAttachments(ctx, opts.MessageRetention)
+		}})
+	}
+	if opts.PruneBlocks != nil {
+		pruners = append(pruners, accountquota.Pruner{Name: "blocks", Prune: opts.PruneBlocks})
+	}
+	pruners = append(pruners, accountquota.Pruner{Name: "messages", Prune: func(context.Context) (bool, error) {
+		return svc.pruneOldestMessages(opts.MessageRetention)
+	}})
+
+	return accountquota.New(accountquota.Opts{
+		Logger:    svc.logger.Named("quota"),
+		Limit:     opts.Limit,
+		WarnRatio: opts.WarnRatio,
+		Size:      opts.Size,
+		Pruners:   pruners,
+		OnChange:  svc.notifyAccountQuota,
+	})
+}
+
+// runAccountQuota checks the size of the account until ctx is done.
+func (svc *service) runAccountQuota(ctx context.Context, interval time.Duration) {
+	ticker := svc.clock.Ticker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := svc.quota.Check(ctx); err != nil {
+			svc.logger.Warn("unable to check the account quota", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// notifyAccountQuota warns the user when the account gets close to its
+// quota, and when the writes start being refused.
+func (svc *service) notifyAccountQuota(previous, current accountquota.Status) {
+	svc.logger.Info("account quota level changed",
+		zap.Stringer("previous", previous.Level),
+		zap.Stringer("level", current.Level),
+		zap.Int64("size", current.Size),
+		zap.Int64("limit", current.Limit),
+	)
+
+	var title, body string
+	switch current.Level {
+	case accountquota.LevelWarning:
+		title = "Storage almost full"
+		body = fmt.Sprintf("The account uses %d of its %d bytes, the oldest attachments and messages will be deleted to make room", current.Size, current.Limit)
+	case accountquota.LevelExceeded:
+		title = "Storage full"
+		body = fmt.Sprintf("The account uses %d bytes, over its quota of %d bytes, new messages and attachments are refused until space is freed", current.Size, current.Limit)
+	default:
+		return
+	}
+
+	if err := svc.dispatcher.Notify(mt.StreamEvent_Notified_TypeBasic, title, body, nil); err != nil {
+		svc.logger.Warn("failed to notify", zap.Error(err))
+	}
+}
+
+// pruneOldestAttachments releases the attachments of the oldest
+// interactions sent before the retention.
+func (svc *service) pruneOldestAttachments(ctx context.Context, retention time.Duration) (bool, error) {
+	interactions, err := svc.attachments.Interactions(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	before := messengerutil.TimestampMs(svc.clock.Now().Add(-retention))
+	sentDates := make(map[string]int64, len(interactions))
+	candidates := []string(nil)
+	for _, interactionCID := range interactions {
+		// the attachments of the unknown interactions are released first
+		sentDate := int64(0)
+		interaction, err := svc.db.GetInteractionByCID(interactionCID)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			return false, errcode.ErrDBRead.Wrap(err)
+		default:
+			sentDate = interaction.GetSentDate()
+		}
+
+		if sentDate >= before {
+			continue
+		}
+
+		sentDates[interactionCID] = sentDate
+		candidates = append(candidates, interactionCID)
+	}
+
+	if len(candidates) == 0 {
+		return false, nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return sentDates[candidates[i]] < sentDates[candidates[j]] })
+
+	more := len(candidates) > quotaPruneBatch
+	if more {
+		candidates = candidates[:quotaPruneBatch]
+	}
+
+	removed, err := svc.attachments.Release(ctx, candidates...)
+	if err != nil {
+		return false, err
+	}
+
+	svc.logger.Debug("attachments pruned over the account quota", zap.Int("interactions", len(candidates)), zap.Int("removed", len(removed)))
+
+	return more, nil
+}
+
+// pruneOldestMessages deletes the oldest messages sent before the
+// retention, their attachments are released by the hook of the db.
+func (svc *service) pruneOldestMessages(retention time.Duration) (bool, error) {
+	before := messengerutil.TimestampMs(svc.clock.Now().Add(-retention))
+	interactions, err := svc.db.GetOldestUserMessages(before, quotaPruneBatch)
+	if err != nil || len(interactions) == 0 {
+		return false, err
+	}
+
+	cids := make([]string, len(interactions))
+	for i, interaction := range interactions {
+		cids[i] = interaction.GetCID()
+	}
+
+	if err := svc.db.DeleteInteractions(cids); err != nil {
+		return false, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	for _, interaction := range interactions {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeInteractionDeleted, &mt.StreamEvent_InteractionDeleted{CID: interaction.GetCID(), ConversationPublicKey: interaction.GetConversationPublicKey()}, false); err != nil {
+			svc.logger.Warn("unable to dispatch the pruned interaction", zap.Error(err))
+		}
+	}
+
+	// the rows are only given back to the file system by a vacuum
+	if err := svc.db.Vacuum(); err != nil {
+		return false, err
+	}
+
+	svc.logger.Debug("messages pruned over the account quota", zap.Int("count", len(cids)))
+
+	return len(interactions) == quotaPruneBatch, nil
+}
@@ -0,0 +1,245 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/addressbook"
+	"berty.tech/berty/v2/go/internal/groupkeys"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/bertylinks"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/logutil"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+func (svc *service) AddressBookExport(ctx context.Context, _ *mt.AddressBookExport_Request) (*mt.AddressBookExport_Reply, error) {
+	book, err := svc.exportAddressBook(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.AddressBookExport_Reply{Book: book.ToProto()}, nil
+}
+
+// exportAddressBook returns the contacts, with their link when their
+// rendezvous seed is known, and the conversations of the account.
+func (svc *service) exportAddressBook(ctx context.Context) (*addressbook.Book, error) {
+	seeds, err := svc.contactRendezvousSeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	contacts, err := svc.db.GetAllContacts()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	conversations, err := svc.db.GetAllConversations()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	book := &addressbook.Book{
+		Version:       addressbook.Version,
+		ExportedAt:    svc.clock.Now().UTC(),
+		Contacts:      make([]*addressbook.Contact, 0, len(contacts)),
+		Conversations: make([]*addressbook.Conversation, 0, len(conversations)),
+	}
+
+	for _, c := range contacts {
+		entry := &addressbook.Contact{
+			PublicKey:             c.GetPublicKey(),
+			DisplayName:           c.GetDisplayName(),
+			State:                 c.GetState().String(),
+			ConversationPublicKey: c.GetConversationPublicKey(),
+			CreatedDate:           time.UnixMilli(c.GetCreatedDate()).UTC(),
+		}
+
+		if seed, ok := seeds[c.GetPublicKey()]; ok {
+			entry.Link, err = contactWebLink(c, seed)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if c.GetState() == mt.Contact_Accepted {
+			entry.Verified = svc.contactKeysExchanged(ctx, c)
+		}
+
+		book.Contacts = append(book.Contacts, entry)
+	}
+
+	for _, c := range conversations {
+		entry := &addressbook.Conversation{
+			PublicKey:   c.GetPublicKey(),
+			DisplayName: c.GetDisplayName(),
+			Type:        c.GetType().String(),
+		}
+
+		if c.GetType() == mt.Conversation_MultiMemberType {
+			gpk, err := messengerutil.B64DecodeBytes(c.GetPublicKey())
+			if err != nil {
+				return nil, errcode.ErrDeserialization.Wrap(err)
+			}
+
+			ret, err := svc.ShareableBertyGroup(ctx, &mt.ShareableBertyGroup_Request{GroupPK: gpk, GroupName: c.GetDisplayName()})
+			if err != nil {
+				return nil, err
+			}
+			entry.Link = ret.GetWebURL()
+		}
+
+		book.Conversations = append(book.Conversations, entry)
+	}
+
+	return book, nil
+}
+
+func contactWebLink(c *mt.Contact, seed []byte) (string, error) {
+	pk, err := messengerutil.B64DecodeBytes(c.GetPublicKey())
+	if err != nil {
+		return "", errcode.ErrDeserialization.Wrap(err)
+	}
+
+	id := &mt.BertyID{
+		DisplayName:          c.GetDisplayName(),
+		PublicRendezvousSeed: seed,
+		AccountPK:            pk,
+	}
+
+	_, web, err := bertylinks.MarshalLink(id.GetBertyLink())
+	if err != nil {
+		return "", errcode.ErrSerialization.Wrap(err)
+	}
+
+	return web, nil
+}
+
+// contactKeysExchanged returns true if the chain keys of the contact
+// conversation were exchanged with every device of the contact.
+func (svc *service) contactKeysExchanged(ctx context.Context, c *mt.Contact) bool {
+	gpk, err := messengerutil.B64DecodeBytes(c.GetConversationPublicKey())
+	if err != nil {
+		return false
+	}
+
+	report, err := groupkeys.Status(ctx, svc.protocolClient, gpk)
+	if err != nil {
+		svc.logger.Warn("unable to check the keys of the contact", logutil.PrivateString("public-key", c.GetPublicKey()), zap.Error(err))
+		return false
+	}
+
+	return report.KeysExchanged()
+}
+
+// contactRendezvousSeeds returns the public rendezvous seeds of the contacts,
+// from the contact requests in the account group. A seed can be unknown, or
+// have been reset by the contact since.
+func (svc *service) contactRendezvousSeeds(ctx context.Context) (map[string][]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	metaList, err := svc.protocolClient.GroupMetadataList(ctx, &protocoltypes.GroupMetadataList_Request{
+		GroupPK:  svc.accountGroup,
+		UntilNow: true,
+	})
+	if err != nil {
+		return nil, errcode.ErrEventListMetadata.Wrap(err)
+	}
+
+	seeds := make(map[string][]byte)
+	for {
+		gme, err := metaList.Recv()
+		if err == io.EOF {
+			return seeds, nil
+		} else if err != nil {
+			return nil, errcode.ErrEventListMetadata.Wrap(err)
+		}
+
+		switch gme.GetMetadata().GetEventType() {
+		case protocoltypes.EventTypeAccountContactRequestOutgoingEnqueued:
+			var ev protocoltypes.AccountContactRequestOutgoingEnqueued
+			if err := proto.Unmarshal(gme.GetEvent(), &ev); err != nil {
+				svc.logger.Warn("unable to unmarshal outgoing contact request", zap.Error(err))
+				continue
+			}
+			if seed := ev.GetContact().GetPublicRendezvousSeed(); len(seed) > 0 {
+				seeds[messengerutil.B64EncodeBytes(ev.GetContact().GetPK())] = seed
+			}
+
+		case protocoltypes.EventTypeAccountContactRequestIncomingReceived:
+			var ev protocoltypes.AccountContactRequestIncomingReceived
+			if err := proto.Unmarshal(gme.GetEvent(), &ev); err != nil {
+				svc.logger.Warn("unable to unmarshal incoming contact request", zap.Error(err))
+				continue
+			}
+			if seed := ev.GetContactRendezvousSeed(); len(seed) > 0 {
+				seeds[messengerutil.B64EncodeBytes(ev.GetContactPK())] = seed
+			}
+		}
+	}
+}
+
+// AddressBookImport skips the contacts without link, which cannot be
+// requested, the contact conversations are restored with their contact.
+func (svc *service) AddressBookImport(ctx context.Context, req *mt.AddressBookImport_Request) (*mt.AddressBookImport_Reply, error) {
+	if req.Book == nil {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("an address book is required"))
+	}
+	book := addressbook.FromProto(req.Book)
+
+	reply := &mt.AddressBookImport_Reply{}
+	failed := func(pk string, err error) {
+		reply.Failed = append(reply.Failed, &mt.AddressBookImport_Reply_Failure{PublicKey: pk, Error: err.Error()})
+	}
+
+	for _, c := range book.Contacts {
+		if c.Link == "" {
+			reply.Skipped++
+			continue
+		}
+
+		if known, err := svc.db.GetContactByPK(c.PublicKey); err == nil && known != nil {
+			reply.Skipped++
+			continue
+		}
+
+		if _, err := svc.ContactRequest(ctx, &mt.ContactRequest_Request{Link: c.Link}); err != nil {
+			svc.logger.Warn("unable to import contact", logutil.PrivateString("public-key", c.PublicKey), zap.Error(err))
+			failed(c.PublicKey, err)
+			continue
+		}
+		reply.ContactsRequested++
+	}
+
+	for _, c := range book.Conversations {
+		if c.Link == "" {
+			continue
+		}
+
+		if known, err := svc.db.GetConversationByPK(c.PublicKey); err == nil && known != nil {
+			reply.Skipped++
+			continue
+		}
+
+		if _, err := svc.ConversationJoin(ctx, &mt.ConversationJoin_Request{Link: c.Link}); err != nil {
+			svc.logger.Warn("unable to import conversation", logutil.PrivateString("public-key", c.PublicKey), zap.Error(err))
+			failed(c.PublicKey, err)
+			continue
+		}
+		reply.ConversationsJoined++
+	}
+
+	if len(reply.Failed) > 0 && reply.ContactsRequested+reply.ConversationsJoined == 0 {
+		return nil, errcode.ErrInternal.Wrap(fmt.Errorf("unable to import the %d entries of the address book, the first one failed with: %s", len(reply.Failed), reply.Failed[0].Error))
+	}
+
+	return reply, nil
+}
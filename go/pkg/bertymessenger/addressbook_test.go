@@ -0,0 +1,55 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestAddressBook(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	conv, err := ts.Client.ConversationCreate(ctx, &messengertypes.ConversationCreate_Request{DisplayName: "conv"})
+	require.NoError(t, err)
+
+	var book *messengertypes.AddressBook
+	require.Eventually(t, func() bool {
+		ret, err := ts.Client.AddressBookExport(ctx, &messengertypes.AddressBookExport_Request{})
+		require.NoError(t, err)
+		book = ret.Book
+		return len(book.Conversations) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.Empty(t, book.Contacts)
+	require.NotZero(t, book.ExportedAt)
+
+	exported := book.Conversations[0]
+	require.Equal(t, conv.PublicKey, exported.PublicKey)
+	require.Equal(t, "conv", exported.DisplayName)
+	require.NotEmpty(t, exported.Link)
+
+	// the known conversations are skipped
+	book.Contacts = append(book.Contacts, &messengertypes.AddressBook_Contact{PublicKey: "no-link"})
+	report, err := ts.Client.AddressBookImport(ctx, &messengertypes.AddressBookImport_Request{Book: book})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), report.Skipped)
+	require.Zero(t, report.ContactsRequested)
+	require.Zero(t, report.ConversationsJoined)
+	require.Empty(t, report.Failed)
+
+	_, err = ts.Client.AddressBookImport(ctx, &messengertypes.AddressBookImport_Request{})
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+}
@@ -27,10 +27,12 @@ import (
 	"google.golang.org/grpc/status"
 	"moul.io/srand"
 
+	"berty.tech/berty/v2/go/internal/auditlog"
 	"berty.tech/berty/v2/go/internal/discordlog"
 	"berty.tech/berty/v2/go/internal/messengerdb"
 	"berty.tech/berty/v2/go/internal/messengerutil"
 	"berty.tech/berty/v2/go/internal/sysutil"
+	"berty.tech/berty/v2/go/internal/usagestats"
 	"berty.tech/berty/v2/go/pkg/authtypes"
 	"berty.tech/berty/v2/go/pkg/banner"
 	"berty.tech/berty/v2/go/pkg/bertylinks"
@@ -139,7 +141,7 @@ func (svc *service) internalInstanceShareableBertyID(ctx context.Context, req *m
 		return nil, errcode.TODO.Wrap(err)
 	}
 
-	displayName := strings.TrimSpace(req.DisplayName)
+	displayName := svc.profilePrivacy.PublishedDisplayName(strings.TrimSpace(req.DisplayName))
 	id := &messengertypes.BertyID{
 		DisplayName:          displayName,
 		PublicRendezvousSeed: res.PublicRendezvousSeed,
@@ -167,13 +169,20 @@ func (svc *service) internalInstanceShareableBertyID(ctx context.Context, req *m
 	return &ret, nil
 }
 
-func (svc *service) ParseDeepLink(_ context.Context, req *messengertypes.ParseDeepLink_Request) (*messengertypes.ParseDeepLink_Reply, error) {
+func (svc *service) ParseDeepLink(ctx context.Context, req *messengertypes.ParseDeepLink_Request) (*messengertypes.ParseDeepLink_Reply, error) {
 	if req == nil {
 		return nil, errcode.ErrMissingInput
 	}
 	ret := messengertypes.ParseDeepLink_Reply{}
 
-	link, err := bertylinks.UnmarshalLink(req.Link, req.Passphrase)
+	// short links are resolved with the relay, the verified link is parsed
+	uri, err := svc.resolveShortLink(ctx, req.Link)
+	if err != nil {
+		svc.logger.Error("unable to resolve short link", logutil.PrivateString("link", req.Link), zap.Error(err))
+		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(err)
+	}
+
+	link, err := bertylinks.UnmarshalLink(uri, req.Passphrase)
 	if err != nil {
 		svc.logger.Error("unable to parse deeplink", logutil.PrivateString("link", req.Link), zap.Error(err))
 		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(err)
@@ -300,7 +309,7 @@ func (svc *service) SystemInfo(ctx context.Context, req *messengertypes.SystemIn
 		errs = multierr.Append(errs, err)
 		reply.Messenger = &messengertypes.SystemInfo_Messenger{Process: process}
 		reply.Messenger.Process.StartedAt = svc.startedAt.Unix()
-		reply.Messenger.Process.UptimeMS = time.Since(svc.startedAt).Milliseconds()
+		reply.Messenger.Process.UptimeMS = svc.clock.Since(svc.startedAt).Milliseconds()
 	}
 
 	// messenger's db
@@ -382,8 +391,8 @@ func (svc *service) ConversationStream(req *messengertypes.ConversationStream_Re
 	}
 }
 
-func (svc *service) streamEverything(sub messengertypes.MessengerService_EventStreamServer) error {
-	if err := svc.streamShallow(sub, 0); err != nil {
+func (svc *service) streamEverything(sub messengertypes.MessengerService_EventStreamServer, systemEvents messengertypes.SystemEvents_Filter) error {
+	if err := svc.streamShallow(sub, 0, systemEvents); err != nil {
 		return err
 	}
 
@@ -395,6 +404,10 @@ func (svc *service) streamEverything(sub messengertypes.MessengerService_EventSt
 		}
 		svc.logger.Info("sending existing interactions", zap.Int("count", len(interactions)))
 		for _, inte := range interactions {
+			if !systemEvents.Match(inte) {
+				continue
+			}
+
 			iu, err := proto.Marshal(&messengertypes.StreamEvent_InteractionUpdated{Interaction: inte})
 			if err != nil {
 				return err
@@ -408,7 +421,7 @@ func (svc *service) streamEverything(sub messengertypes.MessengerService_EventSt
 	return nil
 }
 
-func (svc *service) streamShallow(sub messengertypes.MessengerService_EventStreamServer, includeInteractionsAndMedias int32) error {
+func (svc *service) streamShallow(sub messengertypes.MessengerService_EventStreamServer, includeInteractionsAndMedias int32, systemEvents messengertypes.SystemEvents_Filter) error {
 	// send account
 	{
 		svc.logger.Debug("sending account")
@@ -481,7 +494,7 @@ func (svc *service) streamShallow(sub messengertypes.MessengerService_EventStrea
 
 	// send interactions
 	if includeInteractionsAndMedias > 0 {
-		interactions, err := svc.db.GetPaginatedInteractions(&messengertypes.PaginatedInteractionsOptions{Amount: includeInteractionsAndMedias})
+		interactions, err := svc.db.GetFilteredPaginatedInteractions(&messengertypes.PaginatedInteractionsOptions{Amount: includeInteractionsAndMedias}, systemEvents)
 		if err != nil {
 			return err
 		}
@@ -501,12 +514,14 @@ func (svc *service) streamShallow(sub messengertypes.MessengerService_EventStrea
 }
 
 func (svc *service) EventStream(req *messengertypes.EventStream_Request, sub messengertypes.MessengerService_EventStreamServer) error {
+	systemEvents := req.SystemEvents
+
 	if req.ShallowAmount > 0 {
-		if err := svc.streamShallow(sub, req.ShallowAmount); err != nil {
+		if err := svc.streamShallow(sub, req.ShallowAmount, systemEvents); err != nil {
 			return err
 		}
 	} else if req.ShallowAmount == 0 {
-		err := svc.streamEverything(sub)
+		err := svc.streamEverything(sub, systemEvents)
 		if err != nil {
 			return err
 		}
@@ -528,38 +543,39 @@ func (svc *service) EventStream(req *messengertypes.EventStream_Request, sub mes
 	// FIXME: case where a model is created/updated/deleted between the list and the stream
 	// dunno how to add a test to trigger, maybe it can never happen? don't know how to prove either way
 
-	// stream new events
+	// stream new events, a client which does not keep up is disconnected
+	// instead of blocking the other streams, it resumes from its cursor
 	{
-		errch := make(chan error)
-		defer close(errch)
-		n := NotifieeBundle{StreamEventImpl: func(e *messengertypes.StreamEvent) error {
-			{
-				payload, err := e.UnmarshalPayload()
-				if err != nil {
-					svc.logger.Error("failed to unmarshal payload for logging", zap.Error(err))
-					payload = nil
-				}
-				svc.logger.Debug("sending stream event", zap.String("type", e.GetType().String()), logutil.PrivateAny("payload", payload))
+		buffer := newStreamBuffer(DefaultStreamBufferSize)
+		if systemEvents != messengertypes.SystemEvents_Included {
+			buffer.filter = func(e *messengertypes.StreamEvent) bool {
+				inte, ok := streamedInteraction(e, "")
+				return !ok || systemEvents.Match(inte)
 			}
-
-			if err := sub.Send(&messengertypes.EventStream_Reply{Event: e}); err != nil {
-				// next commented line allows me to manually test the behavior on a send error. How to isolate into an automatic test?
-				// errch <- errors.New("TEST ERROR")
-				// errch <- err
-				svc.logger.Error("err: ", zap.Error(err))
-			}
-
-			return nil
-		}}
-		unreg := svc.dispatcher.Register(&n)
+		}
+		unreg := svc.dispatcher.Register(buffer)
 		defer unreg()
 
-		// don't return until we have a send error or the context is canceled
-		select {
-		case err := <-errch:
-			return err
-		case <-sub.Context().Done():
-			return nil
+		for {
+			select {
+			case e := <-buffer.events:
+				{
+					payload, err := e.UnmarshalPayload()
+					if err != nil {
+						svc.logger.Error("failed to unmarshal payload for logging", zap.Error(err))
+						payload = nil
+					}
+					svc.logger.Debug("sending stream event", zap.String("type", e.GetType().String()), logutil.PrivateAny("payload", payload))
+				}
+
+				if err := sub.Send(&messengertypes.EventStream_Reply{Event: e}); err != nil {
+					return errcode.ErrStreamWrite.Wrap(err)
+				}
+			case <-buffer.overflow:
+				return errcode.ErrStreamWrite.Wrap(errStreamBufferFull)
+			case <-sub.Context().Done():
+				return nil
+			}
 		}
 	}
 }
@@ -613,7 +629,7 @@ func (svc *service) ConversationCreate(ctx context.Context, req *messengertypes.
 		Type:                   messengertypes.Conversation_MultiMemberType,
 		LocalDevicePublicKey:   messengerutil.B64EncodeBytes(gir.GetDevicePK()),
 		LocalMemberPublicKey:   messengerutil.B64EncodeBytes(gir.GetMemberPK()),
-		CreatedDate:            messengerutil.TimestampMs(time.Now()),
+		CreatedDate:            messengerutil.TimestampMs(svc.clock.Now()),
 	}
 
 	// Update database
@@ -648,7 +664,7 @@ func (svc *service) ConversationCreate(ctx context.Context, req *messengertypes.
 	}
 
 	for _, contactPK := range req.GetContactsToInvite() {
-		am, err := messengertypes.AppMessage_TypeGroupInvitation.MarshalPayload(messengerutil.TimestampMs(time.Now()), "", &messengertypes.AppMessage_GroupInvitation{Link: conv.GetLink()})
+		am, err := messengertypes.AppMessage_TypeGroupInvitation.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", &messengertypes.AppMessage_GroupInvitation{Link: conv.GetLink()})
 		if err != nil {
 			return nil, err
 		}
@@ -683,6 +699,8 @@ func (svc *service) ConversationCreate(ctx context.Context, req *messengertypes.
 		}
 	}
 
+	svc.usageStats.Incr(usagestats.CounterGroupsCreated)
+
 	rep := messengertypes.ConversationCreate_Reply{PublicKey: pkStr}
 	return &rep, nil
 }
@@ -736,7 +754,7 @@ func (svc *service) ConversationJoin(ctx context.Context, req *messengertypes.Co
 		Link:                   url,
 		Type:                   messengertypes.Conversation_MultiMemberType,
 		LocalDevicePublicKey:   messengerutil.B64EncodeBytes(gir.GetDevicePK()),
-		CreatedDate:            messengerutil.TimestampMs(time.Now()),
+		CreatedDate:            messengerutil.TimestampMs(svc.clock.Now()),
 	}
 
 	// update db
@@ -760,6 +778,8 @@ func (svc *service) ConversationJoin(ctx context.Context, req *messengertypes.Co
 		}
 	}
 
+	svc.usageStats.Incr(usagestats.CounterGroupsJoined)
+
 	return &messengertypes.ConversationJoin_Reply{}, nil
 }
 
@@ -857,7 +877,7 @@ func (svc *service) ContactRequest(ctx context.Context, req *messengertypes.Cont
 	if err != nil {
 		return nil, errcode.TODO.Wrap(err)
 	}
-	om, err := proto.Marshal(&messengertypes.ContactMetadata{DisplayName: acc.GetDisplayName()})
+	om, err := proto.Marshal(&messengertypes.ContactMetadata{DisplayName: svc.publishedDisplayName(acc)})
 	if err != nil {
 		return nil, errcode.ErrInternal.Wrap(err)
 	}
@@ -917,6 +937,9 @@ func (svc *service) ContactAccept(ctx context.Context, req *messengertypes.Conta
 
 	go svc.autoReplicateContactGroupOnAllServers(pkb)
 
+	svc.usageStats.Incr(usagestats.CounterContactsAdded)
+	svc.recordAuditEvent(auditlog.EventContactAccepted, map[string]string{"contact": pk})
+
 	return &messengertypes.ContactAccept_Reply{}, nil
 }
 
@@ -943,6 +966,11 @@ func (svc *service) Interact(ctx context.Context, req *messengertypes.Interact_R
 	default:
 	}
 
+	// the account is over its quota, see AccountQuota
+	if err := svc.quota.Allow(); err != nil {
+		return nil, err
+	}
+
 	ctx, newTrace, endSection := tyber.Section(ctx, svc.logger, fmt.Sprintf("Interacting with %s on group %s", strings.TrimPrefix(payloadType.String(), "Type"), gpk))
 	defer func() {
 		if err != nil {
@@ -968,25 +996,22 @@ func (svc *service) Interact(ctx context.Context, req *messengertypes.Interact_R
 	}
 	tyber.LogStep(ctx, svc.logger, "Unmarshaled payload", tyber.WithJSONDetail("AppMessagePayload", payload))
 
-	fp, err := req.GetType().MarshalPayload(messengerutil.TimestampMs(time.Now()), req.GetTargetCID(), payload)
+	// the payload is sent as given once parsed, its fields unknown to the
+	// generated messages are extensions of the clients, see appmessage
+	fp, err := proto.Marshal(&messengertypes.AppMessage{
+		Type:      payloadType,
+		TargetCID: req.GetTargetCID(),
+		Payload:   req.GetPayload(),
+		SentDate:  messengerutil.TimestampMs(svc.clock.Now()),
+	})
 	if err != nil {
 		return nil, errcode.ErrInternal.Wrap(err)
 	}
 
-	var cidBytes []byte
-
-	if req.GetMetadata() {
-		reply, err := svc.protocolClient.AppMetadataSend(ctx, &protocoltypes.AppMetadataSend_Request{GroupPK: gpkb, Payload: fp})
-		if err != nil {
-			return nil, errcode.ErrProtocolSend.Wrap(err)
-		}
-		cidBytes = reply.GetCID()
-	} else {
-		reply, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: fp})
-		if err != nil {
-			return nil, errcode.ErrProtocolSend.Wrap(err)
-		}
-		cidBytes = reply.GetCID()
+	// the messages over the max message size are sent in chunks
+	cidBytes, err := svc.sendAppMessage(ctx, gpkb, fp, req.GetMetadata())
+	if err != nil {
+		return nil, err
 	}
 
 	cid, err := ipfscid.Cast(cidBytes)
@@ -995,6 +1020,8 @@ func (svc *service) Interact(ctx context.Context, req *messengertypes.Interact_R
 	}
 
 	if payloadType == messengertypes.AppMessage_TypeUserMessage {
+		svc.usageStats.Incr(usagestats.CounterMessagesSent)
+
 		muts := []tyber.StepMutator{}
 		if newTrace {
 			muts = append(muts, tyber.EndTrace)
@@ -1033,7 +1060,7 @@ func (svc *service) EchoTest(req *messengertypes.EchoTest_Request, srv messenger
 			return errcode.ErrTestEchoSend.Wrap(err)
 		}
 
-		time.Sleep(time.Duration(req.Delay) * time.Millisecond)
+		svc.clock.Sleep(time.Duration(req.Delay) * time.Millisecond)
 	}
 }
 
@@ -1131,6 +1158,13 @@ func (svc *service) monitorGroupPeersStatus(groupPK string) error {
 				}
 
 				svc.muKnownPeers.Lock()
+				if len(connected.Transports) > 0 {
+					svc.peerTransports[messengerutil.B64EncodeBytes(connected.DevicePK)] = peerTransport{
+						peerID:    connected.PeerID,
+						transport: connected.Transports[0].String(),
+					}
+				}
+
 				if status, ok := svc.knownPeers[connected.PeerID]; !ok || status != kind {
 					svc.knownPeers[connected.PeerID] = kind
 
@@ -1156,6 +1190,7 @@ func (svc *service) monitorGroupPeersStatus(groupPK string) error {
 
 				if _, ok := groupPeers[connected.PeerID]; !ok {
 					groupPeers[connected.PeerID] = struct{}{}
+					svc.netUsage.Associate(connected.PeerID, groupPK)
 					err = svc.dispatcher.StreamEvent(
 						messengertypes.StreamEvent_TypePeerStatusGroupAssociated,
 						&messengertypes.StreamEvent_PeerStatusGroupAssociated{
@@ -1178,6 +1213,12 @@ func (svc *service) monitorGroupPeersStatus(groupPK string) error {
 				}
 
 				svc.muKnownPeers.Lock()
+				for devicePK, pt := range svc.peerTransports {
+					if pt.peerID == disconnected.PeerID {
+						delete(svc.peerTransports, devicePK)
+					}
+				}
+
 				if status, ok := svc.knownPeers[disconnected.PeerID]; !ok || status != kind {
 					svc.knownPeers[disconnected.PeerID] = kind
 					err = svc.dispatcher.StreamEvent(messengertypes.StreamEvent_TypePeerStatusDisconnected,
@@ -1321,8 +1362,36 @@ func (svc *service) InstanceExportData(_ *messengertypes.InstanceExportData_Requ
 	}
 
 	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
 
-	cl, err := svc.protocolClient.ServiceExportData(server.Context(), &protocoltypes.ServiceExportData_Request{})
+	if err := svc.exportInstanceData(server.Context(), tmpFile); err != nil {
+		return err
+	}
+
+	if _, err = tmpFile.Seek(0, io.SeekStart); err != nil {
+		return errcode.ErrInternal.Wrap(err)
+	}
+
+	buffer := make([]byte, 1024)
+	for {
+		_, err := tmpFile.Read(buffer)
+		if err == io.EOF {
+			svc.recordAuditEvent(auditlog.EventBackupExported, nil)
+			return nil
+		} else if err != nil {
+			return errcode.ErrInternal.Wrap(err)
+		}
+
+		if err := server.Send(&messengertypes.InstanceExportData_Reply{ExportedData: buffer}); err != nil {
+			return errcode.ErrInternal.Wrap(err)
+		}
+	}
+}
+
+// exportInstanceData writes the export of the protocol data followed by the
+// messenger data to f, it is used by the cloud backups too.
+func (svc *service) exportInstanceData(ctx context.Context, f *os.File) error {
+	cl, err := svc.protocolClient.ServiceExportData(ctx, &protocoltypes.ServiceExportData_Request{})
 	if err != nil {
 		return errcode.ErrInternal.Wrap(err)
 	}
@@ -1334,13 +1403,13 @@ func (svc *service) InstanceExportData(_ *messengertypes.InstanceExportData_Requ
 		} else if err != nil {
 			return errcode.ErrInternal.Wrap(err)
 		}
-		if _, err := tmpFile.Write(chunk.ExportedData); err != nil {
+		if _, err := f.Write(chunk.ExportedData); err != nil {
 			return errcode.ErrInternal.Wrap(err)
 		}
 	}
 
 	// Remove trailing headers to append messenger data
-	_, err = tmpFile.Seek(-1024, io.SeekEnd)
+	_, err = f.Seek(-1024, io.SeekEnd)
 	if err != nil {
 		return errcode.ErrInternal.Wrap(err)
 	}
@@ -1348,27 +1417,11 @@ func (svc *service) InstanceExportData(_ *messengertypes.InstanceExportData_Requ
 	svc.handlerMutex.Lock()
 	defer svc.handlerMutex.Unlock()
 
-	if err := exportMessengerData(tmpFile, svc.db); err != nil {
-		return errcode.ErrInternal.Wrap(err)
-	}
-
-	if _, err = tmpFile.Seek(0, io.SeekStart); err != nil {
+	if err := exportMessengerData(f, svc.db); err != nil {
 		return errcode.ErrInternal.Wrap(err)
 	}
 
-	buffer := make([]byte, 1024)
-	for {
-		_, err := tmpFile.Read(buffer)
-		if err == io.EOF {
-			return nil
-		} else if err != nil {
-			return errcode.ErrInternal.Wrap(err)
-		}
-
-		if err := server.Send(&messengertypes.InstanceExportData_Reply{ExportedData: buffer}); err != nil {
-			return errcode.ErrInternal.Wrap(err)
-		}
-	}
+	return nil
 }
 
 func (svc *service) ConversationLoad(ctx context.Context, request *messengertypes.ConversationLoad_Request) (*messengertypes.ConversationLoad_Reply, error) {
@@ -1376,7 +1429,7 @@ func (svc *service) ConversationLoad(ctx context.Context, request *messengertype
 		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("no conversation pk or ref cid specified"))
 	}
 
-	interactions, err := svc.db.GetPaginatedInteractions(request.Options)
+	interactions, err := svc.db.GetFilteredPaginatedInteractions(request.Options, request.SystemEvents)
 	if err != nil {
 		return nil, err
 	}
@@ -1431,6 +1484,12 @@ func (svc *service) ConversationMute(ctx context.Context, request *messengertype
 		return nil, errcode.ErrInternal.Wrap(err)
 	}
 
+	// the mute is local, the pushes of the conversation are dropped by the
+	// push servers once the other members have the updated token
+	if err := svc.pushShareMuteUpdate(ctx, conversation); err != nil {
+		svc.logger.Warn("unable to share the push token of the muted conversation", logutil.PrivateString("conversation-pk", conversation.PublicKey), zap.Error(err))
+	}
+
 	return &messengertypes.ConversationMute_Reply{}, nil
 }
 
@@ -1481,6 +1540,21 @@ func (svc *service) AccountPushConfigure(ctx context.Context, request *messenger
 		return nil, errcode.TODO.Wrap(err)
 	}
 
+	// the account mute is sealed in the push token shared in every
+	// conversation, like the mute of a conversation
+	if _, ok := updatedFields["muted_until"]; ok {
+		convos, err := svc.db.GetAllConversations()
+		if err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+
+		for _, conv := range convos {
+			if err := svc.pushShareMuteUpdate(ctx, conv); err != nil {
+				svc.logger.Warn("unable to share the push token of the muted account", logutil.PrivateString("conversation-pk", conv.PublicKey), zap.Error(err))
+			}
+		}
+	}
+
 	return &messengertypes.AccountPushConfigure_Reply{}, nil
 }
 
@@ -1630,7 +1704,7 @@ func (svc *service) TyberHostAttach(ctx context.Context, request *messengertypes
 			}
 
 			select {
-			case <-time.After(sleepDuration):
+			case <-svc.clock.After(sleepDuration):
 			case <-ctx.Done():
 				return
 			}
@@ -1768,10 +1842,10 @@ func (svc *service) DirectoryServiceRegister(ctx context.Context, request *messe
 		return nil, errcode.ErrServicesDirectory.Wrap(err)
 	}
 
-	am, err := messengertypes.AppMessage_TypeAccountDirectoryServiceRegistered.MarshalPayload(messengerutil.TimestampMs(time.Now()), "", &messengertypes.AppMessage_AccountDirectoryServiceRegistered{
+	am, err := messengertypes.AppMessage_TypeAccountDirectoryServiceRegistered.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", &messengertypes.AppMessage_AccountDirectoryServiceRegistered{
 		Identifier:                     selectedRegisteredVC.Identifier,
 		IdentifierProofIssuer:          selectedRegisteredVC.Issuer,
-		RegistrationDate:               time.Now().UnixNano(),
+		RegistrationDate:               svc.clock.Now().UnixNano(),
 		ExpirationDate:                 registrationResponse.ExpirationDate,
 		ServerAddr:                     request.ServerAddr,
 		DirectoryRecordToken:           registrationResponse.DirectoryRecordToken,
@@ -1822,7 +1896,7 @@ func (svc *service) DirectoryServiceUnregister(ctx context.Context, request *mes
 		}
 	}
 
-	am, err := messengertypes.AppMessage_TypeAccountDirectoryServiceUnregistered.MarshalPayload(messengerutil.TimestampMs(time.Now()), "", &messengertypes.AppMessage_AccountDirectoryServiceUnregistered{
+	am, err := messengertypes.AppMessage_TypeAccountDirectoryServiceUnregistered.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", &messengertypes.AppMessage_AccountDirectoryServiceUnregistered{
 		DirectoryRecordToken: record.DirectoryRecordToken,
 	})
 	if err != nil {
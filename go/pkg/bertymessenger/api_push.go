@@ -7,7 +7,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/gogo/protobuf/proto"
 	"github.com/ipfs/go-cid"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/nacl/box"
@@ -34,7 +33,7 @@ func (svc *service) PushSetDeviceToken(ctx context.Context, request *messengerty
 
 	request.Receiver.RecipientPublicKey = svc.pushHandler.PushPK()[:]
 
-	am, err := messengertypes.AppMessage_TypePushSetDeviceToken.MarshalPayload(messengerutil.TimestampMs(time.Now()), "", &messengertypes.AppMessage_PushSetDeviceToken{
+	am, err := messengertypes.AppMessage_TypePushSetDeviceToken.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", &messengertypes.AppMessage_PushSetDeviceToken{
 		DeviceToken: request.Receiver,
 	})
 	if err != nil {
@@ -61,7 +60,7 @@ func (svc *service) PushSetServer(ctx context.Context, request *messengertypes.P
 		return nil, err
 	}
 
-	am, err := messengertypes.AppMessage_TypePushSetServer.MarshalPayload(messengerutil.TimestampMs(time.Now()), "", &messengertypes.AppMessage_PushSetServer{
+	am, err := messengertypes.AppMessage_TypePushSetServer.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", &messengertypes.AppMessage_PushSetServer{
 		Server: request.Server,
 	})
 	if err != nil {
@@ -78,6 +77,19 @@ func (svc *service) PushSetServer(ctx context.Context, request *messengertypes.P
 
 // PushSealTokenForServer seals a device push token with the push server public key
 func PushSealTokenForServer(receiver *pushtypes.PushServiceReceiver, server *messengertypes.PushServer) (*messengertypes.PushMemberTokenUpdate, error) {
+	return PushSealMutedTokenForServer(receiver, server, time.Time{})
+}
+
+// PushSealMutedTokenForServer seals a device push token with the push server
+// public key, the server drops the pushes sent with it until mutedUntil.
+func PushSealMutedTokenForServer(receiver *pushtypes.PushServiceReceiver, server *messengertypes.PushServer, mutedUntil time.Time) (*messengertypes.PushMemberTokenUpdate, error) {
+	return PushSealTokenOptionsForServer(receiver, server, pushtypes.ReceiverOptions{MutedUntil: mutedUntil})
+}
+
+// PushSealTokenOptionsForServer seals a device push token with the push
+// server public key and the options the server applies to the pushes sent
+// with it.
+func PushSealTokenOptionsForServer(receiver *pushtypes.PushServiceReceiver, server *messengertypes.PushServer, opts pushtypes.ReceiverOptions) (*messengertypes.PushMemberTokenUpdate, error) {
 	if server == nil || len(server.Key) != cryptoutil.KeySize {
 		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("expected a server key of %d bytes", cryptoutil.KeySize))
 	}
@@ -89,7 +101,7 @@ func PushSealTokenForServer(receiver *pushtypes.PushServiceReceiver, server *mes
 	serverKey := [cryptoutil.KeySize]byte{}
 	copy(serverKey[:], server.Key)
 
-	opaqueToken, err := proto.Marshal(receiver)
+	opaqueToken, err := pushtypes.MarshalReceiverOptions(receiver, opts)
 	if err != nil {
 		return nil, errcode.ErrSerialization.Wrap(err)
 	}
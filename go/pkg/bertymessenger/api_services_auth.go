@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
-	"time"
 
 	"go.uber.org/zap"
 	"golang.org/x/net/context/ctxhttp"
@@ -155,7 +154,7 @@ func (svc *service) AuthServiceCompleteFlow(ctx context.Context, request *messen
 		Expiration:        -1,
 	}
 
-	am, err := messengertypes.AppMessage_TypeServiceAddToken.MarshalPayload(messengerutil.TimestampMs(time.Now()), "", serviceToken)
+	am, err := messengertypes.AppMessage_TypeServiceAddToken.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", serviceToken)
 	if err != nil {
 		return nil, errcode.ErrSerialization.Wrap(err)
 	}
@@ -262,7 +261,7 @@ func (svc *service) DebugAuthServiceSetToken(ctx context.Context, request *messe
 		Expiration:        -1,
 	}
 
-	am, err := messengertypes.AppMessage_TypeServiceAddToken.MarshalPayload(messengerutil.TimestampMs(time.Now()), "", serviceToken)
+	am, err := messengertypes.AppMessage_TypeServiceAddToken.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", serviceToken)
 	if err != nil {
 		return nil, errcode.ErrSerialization.Wrap(err)
 	}
@@ -0,0 +1,73 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// DefaultAttachmentJanitorInterval is the time between two passes of the
+// janitor releasing the sent attachments whose retention is over.
+const DefaultAttachmentJanitorInterval = time.Hour
+
+// runAttachmentJanitor enforces the retention of the sent attachments until
+// ctx is done.
+func (svc *service) runAttachmentJanitor(ctx context.Context, interval time.Duration) {
+	ticker := svc.clock.Ticker(interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := svc.attachments.Enforce(ctx, svc.clock.Now(), svc.attachmentRecipients)
+		switch {
+		case err != nil:
+			svc.logger.Warn("unable to enforce the attachment retention", zap.Error(err))
+		case len(removed) > 0:
+			svc.logger.Debug("expired attachments removed", zap.Int("count", len(removed)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// attachmentRecipients returns the members of the conversation of a sent
+// interaction, the account excluded.
+func (svc *service) attachmentRecipients(interactionCID string) ([]string, error) {
+	interaction, err := svc.db.GetInteractionByCID(interactionCID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, errcode.ErrNotFound.Wrap(err)
+	case err != nil:
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	members, err := svc.db.GetMembersByConversation(interaction.GetConversationPublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := []string(nil)
+	for _, member := range members {
+		if !member.GetIsMe() {
+			recipients = append(recipients, member.GetPublicKey())
+		}
+	}
+
+	return recipients, nil
+}
+
+// acknowledgeAttachment records the acknowledgements of the interactions
+// whose attachments are kept until every recipient acknowledged them.
+func (svc *service) acknowledgeAttachment(interactionCID string, memberPK string) {
+	if err := svc.attachments.Acknowledge(svc.ctx, interactionCID, memberPK); err != nil {
+		svc.logger.Warn("unable to record the attachment acknowledgement", zap.Error(err))
+	}
+}
@@ -0,0 +1,189 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+
+	"berty.tech/berty/v2/go/internal/attachmentstore"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const (
+	// DefaultMaxAttachmentTransfers is the number of attachment uploads and
+	// downloads running at once, the next ones wait for a slot.
+	DefaultMaxAttachmentTransfers = 4
+
+	// DefaultAttachmentChunkSize is the size of the downloaded chunks.
+	DefaultAttachmentChunkSize = 64 * 1024
+)
+
+// acquireTransfer waits for a transfer slot, the returned func releases it.
+func (svc *service) acquireTransfer(ctx context.Context) (func(), error) {
+	select {
+	case svc.transfers <- struct{}{}:
+		return func() { <-svc.transfers }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// AttachmentUpload stores the chunks received from the header offset, the
+// upload completes once the announced size is received and the content
+// matches the header CID, if set. When the stream breaks, the chunks received
+// are kept.
+func (svc *service) AttachmentUpload(stream mt.MessengerService_AttachmentUploadServer) error {
+	if svc.attachments == nil {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the attachment store is disabled"))
+	}
+
+	if err := svc.quota.Allow(); err != nil {
+		return err
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		return errcode.ErrStreamRead.Wrap(err)
+	}
+
+	header := first.GetHeader()
+	switch {
+	case header == nil:
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("the first request must have the header of the upload"))
+	case header.UploadID == "":
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("an upload id is required"))
+	case header.Total <= 0:
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("the size of the attachment is required"))
+	}
+
+	retention := svc.attachmentRetention
+	if header.Retention != "" {
+		if retention, err = attachmentstore.ParseRetention(header.Retention); err != nil {
+			return err
+		}
+	}
+
+	expected := cid.Undef
+	if header.CID != "" {
+		if expected, err = cid.Decode(header.CID); err != nil {
+			return errcode.ErrDeserialization.Wrap(err)
+		}
+	}
+
+	ctx := stream.Context()
+	release, err := svc.acquireTransfer(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	offset := header.Offset
+	for req := first; ; {
+		if chunk := req.GetChunk(); len(chunk) > 0 {
+			if offset+int64(len(chunk)) > header.Total {
+				return errcode.ErrInvalidRange.Wrap(fmt.Errorf("more than the %d bytes announced", header.Total))
+			}
+
+			if offset, err = svc.attachments.WriteChunk(ctx, header.UploadID, offset, chunk); err != nil {
+				return err
+			}
+		}
+
+		req, err = stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errcode.ErrStreamRead.Wrap(err)
+		}
+	}
+
+	if offset < header.Total {
+		return stream.SendAndClose(&mt.AttachmentUpload_Reply{Offset: offset})
+	}
+
+	c, err := svc.attachments.CompleteUpload(ctx, header.UploadID, expected, header.InteractionCID)
+	if err != nil {
+		return err
+	}
+
+	if header.InteractionCID != "" {
+		if err := svc.attachments.SetRetention(ctx, header.InteractionCID, retention, svc.clock.Now()); err != nil {
+			return err
+		}
+	}
+
+	return stream.SendAndClose(&mt.AttachmentUpload_Reply{Offset: offset, CID: c.String()})
+}
+
+func (svc *service) AttachmentUploadOffset(ctx context.Context, req *mt.AttachmentUploadOffset_Request) (*mt.AttachmentUploadOffset_Reply, error) {
+	if svc.attachments == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("the attachment store is disabled"))
+	}
+
+	offset, err := svc.attachments.UploadOffset(ctx, req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.AttachmentUploadOffset_Reply{Offset: offset}, nil
+}
+
+// AttachmentDownload sends a stored attachment in chunks, the client checks
+// the downloaded content with attachmentstore.Verify.
+func (svc *service) AttachmentDownload(req *mt.AttachmentDownload_Request, stream mt.MessengerService_AttachmentDownloadServer) error {
+	if svc.attachments == nil {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the attachment store is disabled"))
+	}
+
+	c, err := cid.Decode(req.CID)
+	if err != nil {
+		return errcode.ErrDeserialization.Wrap(err)
+	}
+
+	chunkSize := int(req.ChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = DefaultAttachmentChunkSize
+	}
+	if chunkSize > attachmentstore.MaxChunkSize {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("chunks of %d bytes, the maximum is %d", chunkSize, attachmentstore.MaxChunkSize))
+	}
+
+	ctx := stream.Context()
+	release, err := svc.acquireTransfer(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	data, err := svc.attachments.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if err := attachmentstore.Verify(c, data); err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	total := int64(len(data))
+	if req.Offset < 0 || req.Offset > total {
+		return errcode.ErrInvalidRange.Wrap(fmt.Errorf("offset %d out of the %d bytes attachment", req.Offset, total))
+	}
+
+	for offset := req.Offset; offset < total; {
+		end := offset + int64(chunkSize)
+		if end > total {
+			end = total
+		}
+
+		if err := stream.Send(&mt.AttachmentDownload_Reply{Chunk: data[offset:end], Offset: end, Total: total}); err != nil {
+			return errcode.ErrStreamWrite.Wrap(err)
+		}
+		offset = end
+	}
+
+	return nil
+}
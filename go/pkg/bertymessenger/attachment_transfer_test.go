@@ -0,0 +1,84 @@
+package bertymessenger
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/attachmentstore"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestAttachmentTransfer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	ts.Service.(*service).attachments = attachmentstore.New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	data := bytes.Repeat([]byte("attachment"), 1000)
+	header := &messengertypes.AttachmentUpload_Header{UploadID: "upload-1", Total: int64(len(data))}
+
+	upload := func(header *messengertypes.AttachmentUpload_Header, chunks ...[]byte) *messengertypes.AttachmentUpload_Reply {
+		stream, err := ts.Client.AttachmentUpload(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&messengertypes.AttachmentUpload_Request{Header: header}))
+		for _, chunk := range chunks {
+			require.NoError(t, stream.Send(&messengertypes.AttachmentUpload_Request{Chunk: chunk}))
+		}
+
+		reply, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		return reply
+	}
+
+	// the first part of the upload
+	reply := upload(header, data[:4000])
+	require.Equal(t, int64(4000), reply.Offset)
+	require.Empty(t, reply.CID)
+
+	offset, err := ts.Client.AttachmentUploadOffset(ctx, &messengertypes.AttachmentUploadOffset_Request{UploadID: "upload-1"})
+	require.NoError(t, err)
+	require.Equal(t, int64(4000), offset.Offset)
+
+	// resumed from the offset
+	header.Offset = offset.Offset
+	reply = upload(header, data[4000:8000], data[8000:])
+	require.Equal(t, int64(len(data)), reply.Offset)
+	require.NotEmpty(t, reply.CID)
+
+	download, err := ts.Client.AttachmentDownload(ctx, &messengertypes.AttachmentDownload_Request{CID: reply.CID, Offset: 1000, ChunkSize: 4096})
+	require.NoError(t, err)
+
+	downloaded := data[:1000:1000]
+	for {
+		chunk, err := download.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), chunk.Total)
+
+		downloaded = append(downloaded, chunk.Chunk...)
+		require.Equal(t, int64(len(downloaded)), chunk.Offset)
+	}
+	require.Equal(t, data, downloaded)
+
+	stream, err := ts.Client.AttachmentUpload(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&messengertypes.AttachmentUpload_Request{Chunk: data}))
+	_, err = stream.CloseAndRecv()
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+}
@@ -0,0 +1,64 @@
+package bertymessenger
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/auditlog"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) AuditLog(ctx context.Context, req *messengertypes.AuditLog_Request) (*messengertypes.AuditLog_Reply, error) {
+	filter := auditlog.Filter{
+		Event: req.Event,
+		Limit: int(req.Limit),
+	}
+	if req.SinceDate > 0 {
+		filter.Since = time.UnixMilli(req.SinceDate)
+	}
+	if req.UntilDate > 0 {
+		filter.Until = time.UnixMilli(req.UntilDate)
+	}
+
+	entries, err := svc.auditLog.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &messengertypes.AuditLog_Reply{Entries: make([]*messengertypes.AuditLogEntry, len(entries))}
+	for i, entry := range entries {
+		reply.Entries[i] = auditEntryToProto(entry)
+	}
+
+	return reply, nil
+}
+
+func (svc *service) VerifyAuditLog(ctx context.Context, _ *messengertypes.VerifyAuditLog_Request) (*messengertypes.VerifyAuditLog_Reply, error) {
+	if err := svc.auditLog.Verify(ctx); err != nil {
+		return nil, err
+	}
+
+	return &messengertypes.VerifyAuditLog_Reply{}, nil
+}
+
+// recordAuditEvent appends event to the audit log, failures are logged but
+// do not fail the recorded action.
+func (svc *service) recordAuditEvent(event string, details map[string]string) {
+	if err := svc.auditLog.Append(svc.ctx, event, details); err != nil {
+		svc.logger.Warn("unable to record audit event", zap.String("event", event), zap.Error(err))
+	}
+}
+
+func auditEntryToProto(entry *auditlog.Entry) *messengertypes.AuditLogEntry {
+	return &messengertypes.AuditLogEntry{
+		Seq:      entry.Seq,
+		Date:     messengerutil.TimestampMs(entry.Time),
+		Event:    entry.Event,
+		Details:  entry.Details,
+		PrevHash: entry.PrevHash,
+		Hash:     entry.Hash,
+	}
+}
@@ -0,0 +1,51 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/auditlog"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestAuditLog(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	_, err := ts.Client.AuditLog(ctx, &messengertypes.AuditLog_Request{})
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+
+	svc := ts.Service.(*service)
+	svc.auditLog, err = auditlog.Open(ctx, ds_sync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, err)
+
+	svc.recordAuditEvent(auditlog.EventDeviceLinked, map[string]string{"device": "d1"})
+	svc.recordAuditEvent(auditlog.EventKeyRotated, map[string]string{"group": "g1"})
+
+	ret, err := ts.Client.AuditLog(ctx, &messengertypes.AuditLog_Request{})
+	require.NoError(t, err)
+	require.Len(t, ret.Entries, 2)
+	require.Equal(t, auditlog.EventDeviceLinked, ret.Entries[0].Event)
+	require.Equal(t, "d1", ret.Entries[0].Details["device"])
+	require.Equal(t, ret.Entries[0].Hash, ret.Entries[1].PrevHash)
+
+	ret, err = ts.Client.AuditLog(ctx, &messengertypes.AuditLog_Request{Event: auditlog.EventKeyRotated})
+	require.NoError(t, err)
+	require.Len(t, ret.Entries, 1)
+	require.Equal(t, uint64(2), ret.Entries[0].Seq)
+
+	_, err = ts.Client.VerifyAuditLog(ctx, &messengertypes.VerifyAuditLog_Request{})
+	require.NoError(t, err)
+}
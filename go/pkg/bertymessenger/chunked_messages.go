@@ -0,0 +1,137 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/internal/msgchunk"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/logutil"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+const (
+	// DefaultMaxMessageSize is the size of the largest app message sent at
+	// once, the larger ones are sent in chunks.
+	DefaultMaxMessageSize = 256 * 1024
+
+	// DefaultMaxChunkedMessageSize is the size of the largest app message
+	// sent or reassembled from chunks.
+	DefaultMaxChunkedMessageSize = 8 * 1024 * 1024
+
+	// MinMaxMessageSize is the lowest limit accepted for MaxMessageSize.
+	MinMaxMessageSize = 1024
+
+	// chunkMessageOverhead is the room taken by the AppMessage wrapping a
+	// chunk, besides its payload.
+	chunkMessageOverhead = 32
+)
+
+// sendAppMessage sends the marshaled app message am to the group gpkb, as
+// metadata when metadata is true. A message larger than the max message size
+// is sent in chunks, it returns the CID of the last one, which is the CID of
+// the message once reassembled. The metadata are never chunked.
+func (svc *service) sendAppMessage(ctx context.Context, gpkb []byte, am []byte, metadata bool) ([]byte, error) {
+	if len(am) <= svc.maxMessageSize {
+		if metadata {
+			reply, err := svc.protocolClient.AppMetadataSend(ctx, &protocoltypes.AppMetadataSend_Request{GroupPK: gpkb, Payload: am})
+			if err != nil {
+				return nil, errcode.ErrProtocolSend.Wrap(err)
+			}
+			return reply.GetCID(), nil
+		}
+
+		reply, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: am})
+		if err != nil {
+			return nil, errcode.ErrProtocolSend.Wrap(err)
+		}
+		return reply.GetCID(), nil
+	}
+
+	switch {
+	case metadata:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("metadata of %d bytes over the limit of %d bytes", len(am), svc.maxMessageSize))
+	case len(am) > svc.maxChunkedMessageSize:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("message of %d bytes over the limit of %d bytes", len(am), svc.maxChunkedMessageSize))
+	}
+
+	chunks, err := msgchunk.Split(am, svc.maxMessageSize-msgchunk.Overhead-chunkMessageOverhead)
+	if err != nil {
+		return nil, err
+	}
+
+	sentDate := messengerutil.TimestampMs(svc.clock.Now())
+
+	var cid []byte
+	for _, c := range chunks {
+		payload, err := mt.AppMessage_TypeChunk.MarshalPayload(sentDate, "", c)
+		if err != nil {
+			return nil, errcode.ErrSerialization.Wrap(err)
+		}
+
+		reply, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: payload})
+		if err != nil {
+			return nil, errcode.ErrProtocolSend.Wrap(err)
+		}
+		cid = reply.GetCID()
+	}
+
+	svc.logger.Debug("sent chunked message", zap.Int("size", len(am)), zap.Int("chunks", len(chunks)))
+
+	return cid, nil
+}
+
+// chunkEvent is the value kept with the last chunk of a message, the
+// reassembled message is handled as if it was received with it.
+type chunkEvent struct {
+	gme      *protocoltypes.GroupMessageEvent
+	sentDate int64
+}
+
+// reassembleChunk adds the chunk am, received in gme from the group gpkb, to
+// r. It returns the reassembled app message with the event of its last chunk
+// once all the chunks are received, and nil otherwise.
+func reassembleChunk(r *msgchunk.Reassembler, gpkb []byte, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) (*protocoltypes.GroupMessageEvent, *mt.AppMessage, error) {
+	c, err := msgchunk.Unmarshal(am.GetPayload())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sender := messengerutil.B64EncodeBytes(gpkb) + "/" + messengerutil.B64EncodeBytes(gme.GetHeaders().GetDevicePK())
+	payload, value, err := r.Add(sender, c, chunkEvent{gme: gme, sentDate: am.GetSentDate()})
+	if err != nil || payload == nil {
+		return nil, nil, err
+	}
+
+	var whole mt.AppMessage
+	if err := proto.Unmarshal(payload, &whole); err != nil {
+		return nil, nil, errcode.ErrDeserialization.Wrap(err)
+	}
+	if whole.GetType() == mt.AppMessage_TypeChunk {
+		return nil, nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("nested chunked message"))
+	}
+
+	last := value.(chunkEvent)
+	whole.SentDate = last.sentDate
+
+	return last.gme, &whole, nil
+}
+
+// handleChunkMessage reassembles the chunked messages received, it returns
+// the whole message and the event to handle it with once complete, and nil
+// otherwise or on error.
+func (svc *service) handleChunkMessage(gpkb []byte, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) (*protocoltypes.GroupMessageEvent, *mt.AppMessage) {
+	gme, whole, err := reassembleChunk(svc.chunks, gpkb, gme, am)
+	if err != nil {
+		svc.logger.Warn("dropped chunked message", logutil.PrivateString("group", messengerutil.B64EncodeBytes(gpkb)), zap.Error(err))
+		return nil, nil
+	}
+
+	return gme, whole
+}
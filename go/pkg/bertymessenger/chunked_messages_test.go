@@ -0,0 +1,73 @@
+package bertymessenger
+
+import (
+	"strings"
+	"testing"
+
+	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/msgchunk"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+func TestReassembleChunk(t *testing.T) {
+	payload, err := mt.AppMessage_TypeUserMessage.MarshalPayload(1, "", &mt.AppMessage_UserMessage{Body: strings.Repeat("large ", 1000)})
+	require.NoError(t, err)
+
+	chunks, err := msgchunk.Split(payload, 1000)
+	require.NoError(t, err)
+	require.Greater(t, len(chunks), 2)
+
+	gpkb := []byte("group")
+	r := msgchunk.NewReassembler(DefaultMaxChunkedMessageSize, msgchunk.DefaultTTL)
+
+	for i, c := range chunks {
+		gme := &protocoltypes.GroupMessageEvent{
+			EventContext: &protocoltypes.EventContext{ID: []byte{byte(i)}},
+			Headers:      &protocoltypes.MessageHeaders{DevicePK: []byte("device")},
+		}
+		raw, err := c.Marshal()
+		require.NoError(t, err)
+		am := &mt.AppMessage{Type: mt.AppMessage_TypeChunk, Payload: raw, SentDate: int64(10 + i)}
+
+		last, whole, err := reassembleChunk(r, gpkb, gme, am)
+		require.NoError(t, err)
+
+		if i < len(chunks)-1 {
+			require.Nil(t, whole)
+			continue
+		}
+
+		// handled as if received with the last chunk
+		require.NotNil(t, whole)
+		require.Equal(t, gme, last)
+		require.Equal(t, mt.AppMessage_TypeUserMessage, whole.GetType())
+		require.Equal(t, int64(10+i), whole.GetSentDate())
+
+		body, err := whole.UnmarshalPayload()
+		require.NoError(t, err)
+		require.Equal(t, strings.Repeat("large ", 1000), body.(*mt.AppMessage_UserMessage).GetBody())
+	}
+
+	// a chunked message made of chunks is rejected
+	nested, err := proto.Marshal(&mt.AppMessage{Type: mt.AppMessage_TypeChunk, Payload: []byte(strings.Repeat("x", 2000))})
+	require.NoError(t, err)
+	chunks, err = msgchunk.Split(nested, 1500)
+	require.NoError(t, err)
+
+	gme := &protocoltypes.GroupMessageEvent{Headers: &protocoltypes.MessageHeaders{DevicePK: []byte("device")}}
+	for i, c := range chunks {
+		raw, err := c.Marshal()
+		require.NoError(t, err)
+		_, whole, err := reassembleChunk(r, gpkb, gme, &mt.AppMessage{Type: mt.AppMessage_TypeChunk, Payload: raw})
+		require.Nil(t, whole)
+		if i < len(chunks)-1 {
+			require.NoError(t, err)
+		} else {
+			require.Error(t, err)
+		}
+	}
+}
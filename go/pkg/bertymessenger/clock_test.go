@@ -0,0 +1,44 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestServiceClock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	mock := clock.NewMock()
+	mock.Set(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger, Clock: mock})
+	defer cleanup()
+
+	svc := ts.Service.(*service)
+
+	mock.Add(time.Hour)
+	reply, err := ts.Client.ConversationCreate(ctx, &messengertypes.ConversationCreate_Request{DisplayName: "conv"})
+	require.NoError(t, err)
+
+	// dated by the clock of the service, and of its db
+	conv, err := svc.db.GetConversationByPK(reply.PublicKey)
+	require.NoError(t, err)
+	require.Equal(t, messengerutil.TimestampMs(mock.Now()), conv.CreatedDate)
+	require.Equal(t, mock.Now(), svc.db.Now())
+
+	info, err := ts.Client.SystemInfo(ctx, &messengertypes.SystemInfo_Request{})
+	require.NoError(t, err)
+	require.Equal(t, time.Hour.Milliseconds(), info.Messenger.Process.UptimeMS)
+}
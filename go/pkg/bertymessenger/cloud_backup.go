@@ -0,0 +1,116 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/auditlog"
+	"berty.tech/berty/v2/go/internal/cloudbackup"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// cloudBackupCheckInterval bounds the time between two checks of the due
+// backups, so that a long interval is not restarted by each launch.
+const cloudBackupCheckInterval = 10 * time.Minute
+
+func (svc *service) CloudBackupList(ctx context.Context, _ *messengertypes.CloudBackupList_Request) (*messengertypes.CloudBackupList_Reply, error) {
+	if svc.cloudBackup == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("cloud backups are not configured"))
+	}
+
+	snapshots, err := svc.cloudBackup.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &messengertypes.CloudBackupList_Reply{Snapshots: make([]*messengertypes.CloudBackupSnapshot, len(snapshots))}
+	for i, snapshot := range snapshots {
+		reply.Snapshots[i] = cloudBackupSnapshotToProto(snapshot)
+	}
+
+	return reply, nil
+}
+
+func (svc *service) CloudBackupRestore(ctx context.Context, req *messengertypes.CloudBackupRestore_Request) (*messengertypes.CloudBackupRestore_Reply, error) {
+	if svc.cloudBackup == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("cloud backups are not configured"))
+	}
+
+	if req.SnapshotID == "" || req.Path == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a snapshot id and a path are required"))
+	}
+
+	f, err := os.OpenFile(req.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	snapshot, err := svc.cloudBackup.Restore(ctx, req.SnapshotID, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = errcode.ErrInternal.Wrap(closeErr)
+	}
+	if err != nil {
+		os.Remove(req.Path)
+		return nil, err
+	}
+
+	return &messengertypes.CloudBackupRestore_Reply{Snapshot: cloudBackupSnapshotToProto(snapshot)}, nil
+}
+
+func cloudBackupSnapshotToProto(snapshot *cloudbackup.Snapshot) *messengertypes.CloudBackupSnapshot {
+	return &messengertypes.CloudBackupSnapshot{
+		ID:          snapshot.ID,
+		CreatedDate: messengerutil.TimestampMs(snapshot.CreatedAt),
+		ExportSize:  snapshot.Size,
+		Chunks:      int64(snapshot.Chunks),
+	}
+}
+
+// runCloudBackups uploads a snapshot of the account every interval, and
+// removes the snapshots after the keep most recent ones, until ctx is done.
+func (svc *service) runCloudBackups(ctx context.Context, interval time.Duration, keep int) {
+	check := interval
+	if check > cloudBackupCheckInterval {
+		check = cloudBackupCheckInterval
+	}
+
+	ticker := svc.clock.Ticker(check)
+	defer ticker.Stop()
+
+	for {
+		if err := svc.cloudBackupIfDue(ctx, interval, keep); err != nil && ctx.Err() == nil {
+			svc.logger.Warn("unable to back up the account", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (svc *service) cloudBackupIfDue(ctx context.Context, interval time.Duration, keep int) error {
+	due, err := svc.cloudBackup.Due(ctx, svc.clock.Now(), interval)
+	if err != nil || !due {
+		return err
+	}
+
+	snapshot, err := svc.cloudBackup.Backup(ctx, func(f *os.File) error {
+		return svc.exportInstanceData(ctx, f)
+	})
+	if err != nil {
+		return err
+	}
+
+	svc.logger.Info("account backed up", zap.String("snapshot", snapshot.ID), zap.Int64("size", snapshot.Size))
+	svc.recordAuditEvent(auditlog.EventBackupExported, map[string]string{"snapshot": snapshot.ID})
+
+	return svc.cloudBackup.Prune(ctx, keep)
+}
@@ -0,0 +1,76 @@
+package bertymessenger
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+
+	"berty.tech/berty/v2/go/internal/cloudbackup"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestCloudBackups(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	_, err := ts.Client.CloudBackupList(ctx, &messengertypes.CloudBackupList_Request{})
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+
+	server := httptest.NewServer(&webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	})
+	defer server.Close()
+
+	target, err := cloudbackup.NewWebDAV(server.URL+"/backups", "", "", server.Client())
+	require.NoError(t, err)
+	require.NoError(t, target.MakeDir(ctx, ""))
+
+	backups := cloudbackup.New(target, "passphrase", ds_sync.MutexWrap(datastore.NewMapDatastore()), t.TempDir())
+	ts.Service.(*service).cloudBackup = backups
+
+	export := bytes.Repeat([]byte("berty export "), 100)
+	snapshot, err := backups.Backup(ctx, func(f *os.File) error {
+		_, err := f.Write(export)
+		return err
+	})
+	require.NoError(t, err)
+
+	list, err := ts.Client.CloudBackupList(ctx, &messengertypes.CloudBackupList_Request{})
+	require.NoError(t, err)
+	require.Len(t, list.Snapshots, 1)
+	require.Equal(t, snapshot.ID, list.Snapshots[0].ID)
+	require.Equal(t, int64(len(export)), list.Snapshots[0].ExportSize)
+
+	path := filepath.Join(t.TempDir(), "export.tar")
+	restored, err := ts.Client.CloudBackupRestore(ctx, &messengertypes.CloudBackupRestore_Request{SnapshotID: snapshot.ID, Path: path})
+	require.NoError(t, err)
+	require.Equal(t, list.Snapshots[0], restored.Snapshot)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, export, raw)
+
+	// the export is not overwritten
+	_, err = ts.Client.CloudBackupRestore(ctx, &messengertypes.CloudBackupRestore_Request{SnapshotID: snapshot.ID, Path: path})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	_, err = ts.Client.CloudBackupRestore(ctx, &messengertypes.CloudBackupRestore_Request{SnapshotID: "unknown", Path: filepath.Join(t.TempDir(), "other.tar")})
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+}
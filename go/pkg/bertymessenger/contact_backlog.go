@@ -0,0 +1,129 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/logutil"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// throttleContactRequest returns false when the request is deferred, the
+// users are warned once per epoch when the throttling activates.
+func (svc *service) throttleContactRequest(contact *mt.Contact) bool {
+	if svc.contactThrottle == nil {
+		return true
+	}
+
+	admitted, throttled, err := svc.contactThrottle.Admit(svc.ctx, contact.GetPublicKey(), contact.GetDisplayName())
+	if err != nil {
+		svc.logger.Warn("unable to defer contact request", logutil.PrivateString("contact-pk", contact.GetPublicKey()), zap.Error(err))
+		return true
+	}
+	if admitted {
+		return true
+	}
+
+	svc.logger.Info("contact request deferred", logutil.PrivateString("contact-pk", contact.GetPublicKey()))
+	if !throttled {
+		return false
+	}
+
+	svc.logger.Warn("contact requests throttled", zap.Int("limit", svc.contactThrottle.Limit()), zap.Int64("epoch", svc.contactThrottle.Epoch()))
+	if err := svc.dispatcher.Notify(
+		mt.StreamEvent_Notified_TypeBasic,
+		"Contact requests throttled",
+		fmt.Sprintf("More than %d contact requests were received since the rendezvous point rotated, the next ones are deferred to be reviewed later", svc.contactThrottle.Limit()),
+		nil,
+	); err != nil {
+		svc.logger.Warn("failed to notify", zap.Error(err))
+	}
+
+	return false
+}
+
+// ContactBacklogList returns the deferred contact requests, they are received
+// by the protocol as the others and listed in the incoming requests of the
+// account, but no notification is sent for them.
+func (svc *service) ContactBacklogList(ctx context.Context, _ *mt.ContactBacklogList_Request) (*mt.ContactBacklogList_Reply, error) {
+	if svc.contactThrottle == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("contact requests are not throttled"))
+	}
+
+	backlog, err := svc.contactThrottle.Backlog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the requests answered with ContactAccept or ContactRequestDiscard are
+	// not waiting anymore
+	reply := &mt.ContactBacklogList_Reply{}
+	for _, d := range backlog {
+		c, err := svc.db.GetContactByPK(d.ContactPK)
+		if err == nil && c.GetState() == mt.Contact_IncomingRequest {
+			reply.Requests = append(reply.Requests, &mt.DeferredContactRequest{
+				ContactPublicKey: d.ContactPK,
+				DisplayName:      d.DisplayName,
+				ReceivedDate:     messengerutil.TimestampMs(d.ReceivedAt),
+				Epoch:            d.Epoch,
+			})
+			continue
+		}
+
+		if _, err := svc.contactThrottle.Remove(ctx, d.ContactPK); err != nil {
+			svc.logger.Warn("unable to remove answered contact request", logutil.PrivateString("contact-pk", d.ContactPK), zap.Error(err))
+		}
+	}
+
+	return reply, nil
+}
+
+func (svc *service) ContactBacklogAccept(ctx context.Context, req *mt.ContactBacklogAccept_Request) (*mt.ContactBacklogAccept_Reply, error) {
+	if svc.contactThrottle == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("contact requests are not throttled"))
+	}
+
+	if req.ContactPublicKey == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	if _, err := svc.ContactAccept(ctx, &mt.ContactAccept_Request{PublicKey: req.ContactPublicKey}); err != nil {
+		return nil, err
+	}
+
+	if _, err := svc.contactThrottle.Remove(ctx, req.ContactPublicKey); err != nil && !errcode.Is(err, errcode.ErrNotFound) {
+		return nil, err
+	}
+
+	return &mt.ContactBacklogAccept_Reply{}, nil
+}
+
+func (svc *service) ContactBacklogDiscard(ctx context.Context, req *mt.ContactBacklogDiscard_Request) (*mt.ContactBacklogDiscard_Reply, error) {
+	if svc.contactThrottle == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("contact requests are not throttled"))
+	}
+
+	if req.ContactPublicKey == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	contactPKB, err := messengerutil.B64DecodeBytes(req.ContactPublicKey)
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if _, err := svc.protocolClient.ContactRequestDiscard(ctx, &protocoltypes.ContactRequestDiscard_Request{ContactPK: contactPKB}); err != nil {
+		return nil, errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	if _, err := svc.contactThrottle.Remove(ctx, req.ContactPublicKey); err != nil && !errcode.Is(err, errcode.ErrNotFound) {
+		return nil, err
+	}
+
+	return &mt.ContactBacklogDiscard_Reply{}, nil
+}
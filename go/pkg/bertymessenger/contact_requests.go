@@ -0,0 +1,113 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+func (svc *service) ContactRequestList(ctx context.Context, req *mt.ContactRequestList_Request) (*mt.ContactRequestList_Reply, error) {
+	states := []mt.Contact_State{mt.Contact_OutgoingRequestEnqueued, mt.Contact_OutgoingRequestSent}
+	if req.Incoming {
+		states = []mt.Contact_State{mt.Contact_IncomingRequest}
+	}
+
+	requests, err := svc.listContactRequests(states...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.ContactRequestList_Reply{Requests: requests}, nil
+}
+
+func (svc *service) ContactRequestCancel(ctx context.Context, req *mt.ContactRequestCancel_Request) (*mt.ContactRequestCancel_Reply, error) {
+	contactPK := req.ContactPublicKey
+	if contactPK == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a contact is required"))
+	}
+
+	contactPKB, err := messengerutil.B64DecodeBytes(contactPK)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	contact, err := svc.db.GetContactByPK(contactPK)
+	if err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	if contact.State != mt.Contact_OutgoingRequestEnqueued && contact.State != mt.Contact_OutgoingRequestSent {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("no outgoing contact request for %s", contactPK))
+	}
+
+	// blocking the contact removes it from the rendezvous points watched by
+	// the protocol, it is unblocked right away so a new request can be sent
+	// later
+	if _, err := svc.protocolClient.ContactBlock(ctx, &protocoltypes.ContactBlock_Request{ContactPK: contactPKB}); err != nil {
+		return nil, errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	if _, err := svc.protocolClient.ContactUnblock(ctx, &protocoltypes.ContactUnblock_Request{ContactPK: contactPKB}); err != nil {
+		return nil, errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	if err := svc.db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		contact, err := tx.DeleteOutgoingContactRequest(contactPK)
+		if err != nil {
+			return err
+		}
+
+		if contact.ConversationPublicKey == "" {
+			return nil
+		}
+
+		return svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationDeleted, &mt.StreamEvent_ConversationDeleted{PublicKey: contact.ConversationPublicKey}, false)
+	}); err != nil {
+		return nil, err
+	}
+
+	svc.logger.Info("contact request canceled", logutil.PrivateString("contact-pk", contactPK), zap.Stringer("state", contact.State))
+
+	return &mt.ContactRequestCancel_Reply{}, nil
+}
+
+func (svc *service) listContactRequests(states ...mt.Contact_State) ([]*mt.PendingContactRequest, error) {
+	requests := []*mt.PendingContactRequest(nil)
+
+	for _, state := range states {
+		contacts, err := svc.db.GetContactsByState(state)
+		if err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+
+		for _, c := range contacts {
+			requests = append(requests, &mt.PendingContactRequest{
+				ContactPublicKey:      c.GetPublicKey(),
+				DisplayName:           c.GetDisplayName(),
+				ConversationPublicKey: c.GetConversationPublicKey(),
+				Outgoing:              state != mt.Contact_IncomingRequest,
+				State:                 state,
+				CreatedDate:           c.GetCreatedDate(),
+				SentDate:              c.GetSentDate(),
+			})
+		}
+	}
+
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].CreatedDate < requests[j].CreatedDate
+	})
+
+	return requests, nil
+}
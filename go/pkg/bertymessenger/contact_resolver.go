@@ -0,0 +1,89 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"berty.tech/berty/v2/go/internal/contactnames"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// resolvableContacts returns the contacts which are not removed, by public
+// key.
+func (svc *service) resolvableContacts() (map[string]*mt.Contact, []contactnames.Entry, error) {
+	contacts, err := svc.db.GetAllContacts()
+	if err != nil {
+		return nil, nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	byPK := make(map[string]*mt.Contact, len(contacts))
+	entries := make([]contactnames.Entry, 0, len(contacts))
+	for _, c := range contacts {
+		if c.GetState() == mt.Contact_Undefined {
+			continue
+		}
+
+		byPK[c.GetPublicKey()] = c
+		entries = append(entries, contactnames.Entry{ID: c.GetPublicKey(), Name: c.GetDisplayName()})
+	}
+
+	return byPK, entries, nil
+}
+
+func resolvedContact(c *mt.Contact, refs map[string]string) *mt.ResolvedContact {
+	return &mt.ResolvedContact{
+		PublicKey:             c.GetPublicKey(),
+		ConversationPublicKey: c.GetConversationPublicKey(),
+		DisplayName:           c.GetDisplayName(),
+		Reference:             refs[c.GetPublicKey()],
+	}
+}
+
+// ResolveContact fails with ErrNotFound when no contact matches the query,
+// see the contactnames package.
+func (svc *service) ResolveContact(_ context.Context, req *mt.ResolveContact_Request) (*mt.ResolveContact_Reply, error) {
+	query := req.Query
+	if query == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a contact name is required"))
+	}
+
+	byPK, entries, err := svc.resolvableContacts()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := contactnames.Resolve(entries, query)
+	if len(matches) == 0 {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("no contact matches %q", query))
+	}
+
+	refs := contactnames.References(entries)
+	if len(matches) == 1 {
+		return &mt.ResolveContact_Reply{Contact: resolvedContact(byPK[matches[0].ID], refs)}, nil
+	}
+
+	resolution := &mt.ResolveContact_Reply{}
+	for _, m := range matches {
+		resolution.Candidates = append(resolution.Candidates, resolvedContact(byPK[m.ID], refs))
+	}
+
+	return resolution, nil
+}
+
+func (svc *service) ContactReferences(context.Context, *mt.ContactReferences_Request) (*mt.ContactReferences_Reply, error) {
+	byPK, entries, err := svc.resolvableContacts()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := contactnames.References(entries)
+	contacts := make([]*mt.ResolvedContact, 0, len(entries))
+	for _, e := range entries {
+		contacts = append(contacts, resolvedContact(byPK[e.ID], refs))
+	}
+	sort.Slice(contacts, func(i, j int) bool { return contacts[i].Reference < contacts[j].Reference })
+
+	return &mt.ContactReferences_Reply{Contacts: contacts}, nil
+}
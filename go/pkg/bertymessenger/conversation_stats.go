@@ -0,0 +1,49 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) ConversationStats(ctx context.Context, req *messengertypes.ConversationStats_Request) (*messengertypes.ConversationStats_Reply, error) {
+	if req.ConversationPublicKey == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	if _, err := svc.db.GetConversationByPK(req.ConversationPublicKey); err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	stats, err := svc.db.GetConversationStats(req.ConversationPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &messengertypes.ConversationStats_Reply{
+		Interactions:     stats.Interactions,
+		Messages:         stats.Messages,
+		PayloadSize:      stats.PayloadSize,
+		FirstMessageDate: stats.FirstMessageDate,
+		LastMessageDate:  stats.LastMessageDate,
+		MemberMessages:   stats.MemberMessages,
+	}
+	if svc.attachments == nil {
+		return reply, nil
+	}
+
+	cids, err := svc.db.GetInteractionCIDsForConversation(req.ConversationPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := svc.attachments.Usage(ctx, cids...)
+	if err != nil {
+		return nil, err
+	}
+	reply.Attachments, reply.AttachmentsSize = usage.Attachments, usage.Size
+
+	return reply, nil
+}
@@ -0,0 +1,57 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestConversationStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	conv, err := ts.Client.ConversationCreate(ctx, &messengertypes.ConversationCreate_Request{DisplayName: "conv"})
+	require.NoError(t, err)
+
+	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: "hello"})
+	require.NoError(t, err)
+
+	_, err = ts.Client.Interact(ctx, &messengertypes.Interact_Request{
+		Type:                  messengertypes.AppMessage_TypeUserMessage,
+		Payload:               payload,
+		ConversationPublicKey: conv.PublicKey,
+	})
+	require.NoError(t, err)
+
+	var stats *messengertypes.ConversationStats_Reply
+	require.Eventually(t, func() bool {
+		stats, err = ts.Client.ConversationStats(ctx, &messengertypes.ConversationStats_Request{ConversationPublicKey: conv.PublicKey})
+		require.NoError(t, err)
+		return stats.Messages == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.GreaterOrEqual(t, stats.Interactions, uint64(1))
+	require.NotZero(t, stats.PayloadSize)
+	require.NotZero(t, stats.FirstMessageDate)
+	require.Equal(t, stats.FirstMessageDate, stats.LastMessageDate)
+	require.Len(t, stats.MemberMessages, 1)
+
+	_, err = ts.Client.ConversationStats(ctx, &messengertypes.ConversationStats_Request{ConversationPublicKey: "unknown"})
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	_, err = ts.Client.ConversationStats(ctx, &messengertypes.ConversationStats_Request{})
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+}
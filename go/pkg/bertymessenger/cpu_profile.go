@@ -0,0 +1,27 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) CaptureCPUProfile(ctx context.Context, req *messengertypes.CaptureCPUProfile_Request) (*messengertypes.CaptureCPUProfile_Reply, error) {
+	if svc.captureCPUProfile == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("cpu profiling is not enabled"))
+	}
+
+	if req.Duration < 0 {
+		return nil, errcode.ErrInvalidRange.Wrap(fmt.Errorf("the duration can't be negative"))
+	}
+
+	path, err := svc.captureCPUProfile(time.Duration(req.Duration) * time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	return &messengertypes.CaptureCPUProfile_Reply{Path: path}, nil
+}
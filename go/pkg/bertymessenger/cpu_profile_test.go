@@ -0,0 +1,41 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestCaptureCPUProfile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	_, err := ts.Client.CaptureCPUProfile(ctx, &messengertypes.CaptureCPUProfile_Request{})
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+
+	var captured time.Duration
+	ts.Service.(*service).captureCPUProfile = func(d time.Duration) (string, error) {
+		captured = d
+		return "/account/profiles/cpu.pprof", nil
+	}
+
+	ret, err := ts.Client.CaptureCPUProfile(ctx, &messengertypes.CaptureCPUProfile_Request{Duration: 1500})
+	require.NoError(t, err)
+	require.Equal(t, "/account/profiles/cpu.pprof", ret.Path)
+	require.Equal(t, 1500*time.Millisecond, captured)
+
+	_, err = ts.Client.CaptureCPUProfile(ctx, &messengertypes.CaptureCPUProfile_Request{Duration: -1})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidRange))
+}
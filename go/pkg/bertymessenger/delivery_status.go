@@ -0,0 +1,199 @@
+package bertymessenger
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"berty.tech/berty/v2/go/internal/deliverystatus"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/authtypes"
+	"berty.tech/berty/v2/go/pkg/bertyreplication"
+	"berty.tech/berty/v2/go/pkg/bertyreplicationtypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/logutil"
+)
+
+// DefaultDeliveryStatusInterval is the time between two rounds of questions
+// to the replication servers about the messages they store.
+const DefaultDeliveryStatusInterval = 30 * time.Second
+
+// deliveryStatusBatch is the number of unacknowledged messages of a
+// conversation whose storage is checked, the latest ones.
+const deliveryStatusBatch = bertyreplication.MaxStoredEntriesQuery
+
+func (svc *service) DeliveryStatus(_ context.Context, req *mt.DeliveryStatus_Request) (*mt.DeliveryStatus_Reply, error) {
+	reply := &mt.DeliveryStatus_Reply{States: make(map[string]mt.DeliveryStatus_State, len(req.CIDs))}
+	for _, cid := range req.CIDs {
+		i, err := svc.db.GetInteractionByCID(cid)
+		if err != nil {
+			continue
+		}
+
+		reply.States[cid] = deliveryStateToProto(deliverystatus.Of(i, svc.deliveryStatus.IsStored(i.GetConversationPublicKey(), cid)))
+	}
+
+	return reply, nil
+}
+
+// runDeliveryStatus asks the replication servers which messages they store
+// until ctx is done.
+func (svc *service) runDeliveryStatus(ctx context.Context, interval time.Duration) {
+	ticker := svc.clock.Ticker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := svc.checkStoredMessages(ctx); err != nil {
+			svc.logger.Warn("unable to check the messages stored by the replication servers", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkStoredMessages asks the replication servers of each conversation,
+// for which the account has a token, which unacknowledged messages they
+// store. The clients are told about the newly stored ones with an
+// interaction update.
+func (svc *service) checkStoredMessages(ctx context.Context) error {
+	infos, err := svc.db.GetConversationsReplicationInfo()
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		return nil
+	}
+
+	tokens, err := svc.db.GetServiceTokens(messengerutil.B64EncodeBytes(svc.accountGroup))
+	if errcode.Is(err, errcode.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	byServer := map[string]string{}
+	for _, token := range tokens {
+		for _, s := range token.GetSupportedServices() {
+			if s.GetType() == authtypes.ServiceReplicationID {
+				byServer[s.GetAddress()] = token.GetToken()
+			}
+		}
+	}
+
+	for _, info := range infos {
+		token, ok := byServer[info.GetReplicationServer()]
+		if !ok {
+			continue
+		}
+
+		if err := svc.checkStoredConversationMessages(ctx, info, token); err != nil {
+			svc.logger.Debug("unable to check the messages stored by a replication server",
+				logutil.PrivateString("conversation", info.GetConversationPublicKey()),
+				logutil.PrivateString("server", info.GetReplicationServer()),
+				zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+func (svc *service) checkStoredConversationMessages(ctx context.Context, info *mt.ConversationReplicationInfo, token string) error {
+	conversationPK := info.GetConversationPublicKey()
+
+	messages, err := svc.db.GetUnacknowledgedUserMessages(conversationPK, deliveryStatusBatch)
+	if err != nil {
+		return err
+	}
+
+	all := make([]string, len(messages))
+	pending := []string{}
+	for i, m := range messages {
+		all[i] = m.GetCID()
+		if !svc.deliveryStatus.IsStored(conversationPK, m.GetCID()) {
+			pending = append(pending, m.GetCID())
+		}
+	}
+
+	// the delivered messages are no longer tracked
+	svc.deliveryStatus.Retain(conversationPK, all)
+	if len(pending) == 0 {
+		return nil
+	}
+
+	cc, err := svc.getReplicationClient(info.GetReplicationServer())
+	if err != nil {
+		return err
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "bearer "+token)
+	stored, err := bertyreplicationtypes.NewStoredEntriesServiceClient(cc).StoredEntries(ctx, &bertyreplicationtypes.StoredEntries_Request{GroupPublicKey: conversationPK, CIDs: pending})
+	if err != nil {
+		return err
+	}
+
+	for _, cid := range svc.deliveryStatus.MarkStored(conversationPK, stored.CIDs) {
+		i, err := svc.db.GetInteractionByCID(cid)
+		if err != nil {
+			continue
+		}
+
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeInteractionUpdated, &mt.StreamEvent_InteractionUpdated{Interaction: i}, false); err != nil {
+			svc.logger.Warn("unable to dispatch the stored interaction", zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// getReplicationClient returns a GRPC connection to the given replication
+// server.
+func (svc *service) getReplicationClient(host string) (*grpc.ClientConn, error) {
+	svc.muReplicationClients.Lock()
+	defer svc.muReplicationClients.Unlock()
+
+	if cc, ok := svc.replicationClients[host]; ok {
+		return cc, nil
+	}
+
+	var creds grpc.DialOption
+	if svc.grpcInsecure {
+		creds = grpc.WithTransportCredentials(insecure.NewCredentials())
+	} else {
+		tlsconfig := credentials.NewTLS(&tls.Config{
+			MinVersion: tls.VersionTLS12,
+		})
+		creds = grpc.WithTransportCredentials(tlsconfig)
+	}
+
+	cc, err := grpc.DialContext(svc.ctx, host, creds)
+	if err != nil {
+		return nil, err
+	}
+	svc.replicationClients[host] = cc
+
+	return cc, nil
+}
+
+func deliveryStateToProto(state deliverystatus.State) mt.DeliveryStatus_State {
+	switch state {
+	case deliverystatus.StateSent:
+		return mt.DeliveryStatus_Sent
+	case deliverystatus.StateStored:
+		return mt.DeliveryStatus_Stored
+	case deliverystatus.StateDelivered:
+		return mt.DeliveryStatus_Delivered
+	default:
+		return mt.DeliveryStatus_Unknown
+	}
+}
@@ -0,0 +1,46 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestDeliveryStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	conv, err := ts.Client.ConversationCreate(ctx, &messengertypes.ConversationCreate_Request{DisplayName: "conv"})
+	require.NoError(t, err)
+
+	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: "hello"})
+	require.NoError(t, err)
+
+	sent, err := ts.Client.Interact(ctx, &messengertypes.Interact_Request{
+		Type:                  messengertypes.AppMessage_TypeUserMessage,
+		Payload:               payload,
+		ConversationPublicKey: conv.PublicKey,
+	})
+	require.NoError(t, err)
+
+	var reply *messengertypes.DeliveryStatus_Reply
+	require.Eventually(t, func() bool {
+		reply, err = ts.Client.DeliveryStatus(ctx, &messengertypes.DeliveryStatus_Request{CIDs: []string{sent.CID, "unknown"}})
+		require.NoError(t, err)
+		return len(reply.States) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.Equal(t, messengertypes.DeliveryStatus_Sent, reply.States[sent.CID])
+}
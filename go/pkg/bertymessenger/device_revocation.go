@@ -0,0 +1,145 @@
+package bertymessenger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/auditlog"
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/internal/revokeddevices"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+func (svc *service) RevokeDevice(ctx context.Context, req *mt.RevokeDevice_Request) (*mt.RevokeDevice_Reply, error) {
+	devicePK := req.DevicePublicKey
+	if devicePK == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a device is required"))
+	}
+
+	dpkb, err := messengerutil.B64DecodeBytes(devicePK)
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	gi, err := svc.protocolClient.GroupInfo(ctx, &protocoltypes.GroupInfo_Request{GroupPK: svc.accountGroup})
+	if err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+
+	if bytes.Equal(gi.GetDevicePK(), dpkb) {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("cannot revoke the current device"))
+	}
+
+	device, err := svc.db.GetDeviceByPK(devicePK)
+	if err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	if device.GetMemberPublicKey() != messengerutil.B64EncodeBytes(gi.GetMemberPK()) {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("not a device of the account"))
+	}
+
+	am, err := mt.AppMessage_TypeDeviceRevoked.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", &mt.AppMessage_DeviceRevoked{DevicePK: dpkb})
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if _, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: svc.accountGroup, Payload: am}); err != nil {
+		return nil, errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	return &mt.RevokeDevice_Reply{}, nil
+}
+
+// handleDeviceRevocationMessage records the revocations of the devices of
+// the account and ignores the messages sent to the account group by the
+// revoked devices, it returns false for other messages. The user is notified
+// when the current device is the revoked one.
+func (svc *service) handleDeviceRevocationMessage(gpkb []byte, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) bool {
+	isRevocation := am.GetType() == mt.AppMessage_TypeDeviceRevoked
+
+	// the account group only has the devices of the account
+	if !bytes.Equal(gpkb, svc.accountGroup) {
+		return isRevocation
+	}
+
+	senderPKB := gme.GetHeaders().GetDevicePK()
+	senderPK := messengerutil.B64EncodeBytes(senderPKB)
+	if svc.revokedDevices != nil {
+		switch revoked, err := svc.revokedDevices.IsRevoked(svc.ctx, senderPK); {
+		case err != nil:
+			svc.logger.Warn("unable to check the sender device", zap.Error(err))
+		case revoked:
+			svc.logger.Warn("message from a revoked device of the account ignored",
+				logutil.PrivateString("device-pk", senderPK),
+				zap.String("type", am.GetType().String()),
+			)
+			return true
+		}
+	}
+
+	if !isRevocation {
+		return false
+	}
+
+	payload, err := am.UnmarshalPayload()
+	if err != nil {
+		svc.logger.Warn("unable to unmarshal the device revocation", zap.Error(err))
+		return true
+	}
+	revokedPKB := payload.(*mt.AppMessage_DeviceRevoked).GetDevicePK()
+	revokedPK := messengerutil.B64EncodeBytes(revokedPKB)
+
+	if svc.revokedDevices == nil {
+		svc.recordAuditEvent(auditlog.EventDeviceRevoked, map[string]string{"device": revokedPK, "by": senderPK})
+		svc.logger.Info("device of the account revoked", logutil.PrivateString("device-pk", revokedPK))
+		return true
+	}
+
+	// replayed revocations and the later revocations of a device are ignored
+	added, err := svc.revokedDevices.Revoke(svc.ctx, &revokeddevices.Revocation{
+		DevicePK: revokedPK,
+		By:       senderPK,
+		SentDate: am.GetSentDate(),
+	})
+	switch {
+	case err != nil:
+		svc.logger.Warn("unable to record the device revocation", zap.Error(err))
+		return true
+	case !added:
+		return true
+	}
+
+	svc.recordAuditEvent(auditlog.EventDeviceRevoked, map[string]string{"device": revokedPK, "by": senderPK})
+
+	gi, err := svc.protocolClient.GroupInfo(svc.ctx, &protocoltypes.GroupInfo_Request{GroupPK: gpkb})
+	if err != nil {
+		svc.logger.Warn("unable to check the revoked device", zap.Error(err))
+		return true
+	}
+
+	if !bytes.Equal(gi.GetDevicePK(), revokedPKB) || bytes.Equal(senderPKB, revokedPKB) {
+		svc.logger.Info("device of the account revoked", logutil.PrivateString("device-pk", revokedPK))
+		return true
+	}
+
+	svc.logger.Warn("current device revoked by another device of the account", logutil.PrivateString("by", senderPK))
+
+	title := "Device revoked"
+	body := "Another device of the account revoked this one, its messages are no longer accepted by the other devices of the account"
+	if err := svc.dispatcher.Notify(mt.StreamEvent_Notified_TypeBasic, title, body, nil); err != nil {
+		svc.logger.Warn("failed to notify", zap.Error(err))
+	}
+
+	if svc.onDeviceRevoked != nil {
+		svc.revokedOnce.Do(svc.onDeviceRevoked)
+	}
+
+	return true
+}
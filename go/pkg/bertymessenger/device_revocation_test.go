@@ -0,0 +1,110 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/internal/revokeddevices"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestDeviceRevocation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	ds := ds_sync.MutexWrap(datastore.NewMapDatastore())
+	svc := ts.Service.(*service)
+	svc.revokedDevices = revokeddevices.New(ds)
+
+	revoked := 0
+	svc.onDeviceRevoked = func() { revoked++ }
+
+	gi, err := svc.protocolClient.GroupInfo(ctx, &protocoltypes.GroupInfo_Request{GroupPK: svc.accountGroup})
+	require.NoError(t, err)
+	current := gi.GetDevicePK()
+
+	revoke := func(by, device []byte) bool {
+		raw, err := messengertypes.AppMessage_TypeDeviceRevoked.MarshalPayload(1, "", &messengertypes.AppMessage_DeviceRevoked{DevicePK: device})
+		require.NoError(t, err)
+
+		am := &messengertypes.AppMessage{}
+		require.NoError(t, am.Unmarshal(raw))
+
+		gme := &protocoltypes.GroupMessageEvent{Headers: &protocoltypes.MessageHeaders{DevicePK: by}}
+		return svc.handleDeviceRevocationMessage(svc.accountGroup, gme, am)
+	}
+
+	d1, d2 := []byte("device-1"), []byte("device-2")
+
+	// d1 revokes d2
+	require.True(t, revoke(d1, d2))
+	require.Equal(t, 0, revoked)
+
+	isRevoked, err := svc.revokedDevices.IsRevoked(ctx, messengerutil.B64EncodeBytes(d2))
+	require.NoError(t, err)
+	require.True(t, isRevoked)
+
+	// the revocations and the messages of d2 are ignored in the account group
+	require.True(t, revoke(d2, current))
+	require.Equal(t, 0, revoked)
+
+	isRevoked, err = svc.revokedDevices.IsRevoked(ctx, messengerutil.B64EncodeBytes(current))
+	require.NoError(t, err)
+	require.False(t, isRevoked)
+
+	gme := &protocoltypes.GroupMessageEvent{Headers: &protocoltypes.MessageHeaders{DevicePK: d2}}
+	require.True(t, svc.handleDeviceRevocationMessage(svc.accountGroup, gme, &messengertypes.AppMessage{Type: messengertypes.AppMessage_TypeSetUserInfo}))
+	require.False(t, svc.handleDeviceRevocationMessage([]byte("other-group"), gme, &messengertypes.AppMessage{Type: messengertypes.AppMessage_TypeSetUserInfo}))
+
+	// d1 revokes the current device, replays are ignored
+	for i := 0; i < 2; i++ {
+		require.True(t, revoke(d1, current))
+		require.Equal(t, 1, revoked)
+	}
+
+	// the revocations are kept in the datastore
+	revocations, err := revokeddevices.New(ds).List(ctx)
+	require.NoError(t, err)
+	require.Len(t, revocations, 2)
+}
+
+func TestDeviceRevocationNotPersisted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	svc := ts.Service.(*service)
+	revoked := false
+	svc.onDeviceRevoked = func() { revoked = true }
+
+	gi, err := svc.protocolClient.GroupInfo(ctx, &protocoltypes.GroupInfo_Request{GroupPK: svc.accountGroup})
+	require.NoError(t, err)
+
+	raw, err := messengertypes.AppMessage_TypeDeviceRevoked.MarshalPayload(1, "", &messengertypes.AppMessage_DeviceRevoked{DevicePK: gi.GetDevicePK()})
+	require.NoError(t, err)
+	am := &messengertypes.AppMessage{}
+	require.NoError(t, am.Unmarshal(raw))
+
+	// without a store the revocations are only logged
+	gme := &protocoltypes.GroupMessageEvent{Headers: &protocoltypes.MessageHeaders{DevicePK: []byte("device-1")}}
+	require.True(t, svc.handleDeviceRevocationMessage(svc.accountGroup, gme, am))
+	require.False(t, revoked)
+}
@@ -0,0 +1,184 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/namecontexts"
+	"berty.tech/berty/v2/go/pkg/bertylinks"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/messengerutil"
+	"berty.tech/weshnet/pkg/logutil"
+)
+
+// contextDisplayName returns the display name to send to a conversation, the
+// one of its context, else the one of the account.
+func (svc *service) contextDisplayName(conversationPK string, accountDisplayName string) string {
+	if svc.nameContexts == nil {
+		return accountDisplayName
+	}
+
+	contactPK := ""
+	if c, err := svc.db.GetContactByConversation(conversationPK); err == nil {
+		contactPK = c.GetPublicKey()
+	}
+
+	return svc.nameContexts.DisplayName(conversationPK, contactPK, accountDisplayName)
+}
+
+func (svc *service) checkNameContexts() error {
+	if svc.nameContexts == nil {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("display name contexts are not enabled"))
+	}
+	return nil
+}
+
+// resendContextDisplayName sends the display name of the account again to
+// the conversations which used, or use, a context.
+func (svc *service) resendContextDisplayName(ctx context.Context, c *namecontexts.Context) {
+	conversations := append([]string(nil), c.Conversations...)
+	for _, contactPK := range c.Contacts {
+		if contact, err := svc.db.GetContactByPK(contactPK); err == nil && contact.GetConversationPublicKey() != "" {
+			conversations = append(conversations, contact.GetConversationPublicKey())
+		}
+	}
+
+	for _, conversationPK := range conversations {
+		if err := svc.sendAccountUserInfo(ctx, conversationPK); err != nil {
+			svc.logger.Error("unable to send the display name of the context", logutil.PrivateString("conversation", conversationPK), zap.Error(err))
+		}
+	}
+}
+
+func (svc *service) findNameContext(name string) *namecontexts.Context {
+	for _, c := range svc.nameContexts.Contexts() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (svc *service) ListDisplayNameContexts(context.Context, *mt.ListDisplayNameContexts_Request) (*mt.ListDisplayNameContexts_Reply, error) {
+	if err := svc.checkNameContexts(); err != nil {
+		return nil, err
+	}
+
+	reply := &mt.ListDisplayNameContexts_Reply{}
+	for _, c := range svc.nameContexts.Contexts() {
+		reply.Contexts = append(reply.Contexts, &mt.DisplayNameContext{
+			Name:          c.Name,
+			DisplayName:   c.DisplayName,
+			Conversations: c.Conversations,
+			Contacts:      c.Contacts,
+		})
+	}
+
+	return reply, nil
+}
+
+func (svc *service) SetContextDisplayName(ctx context.Context, req *mt.SetContextDisplayName_Request) (*mt.SetContextDisplayName_Reply, error) {
+	if err := svc.checkNameContexts(); err != nil {
+		return nil, err
+	}
+
+	if err := svc.nameContexts.SetDisplayName(ctx, req.Name, req.DisplayName); err != nil {
+		return nil, err
+	}
+
+	if c := svc.findNameContext(req.Name); c != nil {
+		svc.resendContextDisplayName(ctx, c)
+	}
+
+	return &mt.SetContextDisplayName_Reply{}, nil
+}
+
+func (svc *service) RemoveDisplayNameContext(ctx context.Context, req *mt.RemoveDisplayNameContext_Request) (*mt.RemoveDisplayNameContext_Reply, error) {
+	if err := svc.checkNameContexts(); err != nil {
+		return nil, err
+	}
+
+	c := svc.findNameContext(req.Name)
+	if err := svc.nameContexts.Remove(ctx, req.Name); err != nil {
+		return nil, err
+	}
+
+	if c != nil {
+		svc.resendContextDisplayName(ctx, c)
+	}
+
+	return &mt.RemoveDisplayNameContext_Reply{}, nil
+}
+
+func (svc *service) UseDisplayNameContext(ctx context.Context, req *mt.UseDisplayNameContext_Request) (*mt.UseDisplayNameContext_Reply, error) {
+	if err := svc.checkNameContexts(); err != nil {
+		return nil, err
+	}
+
+	if _, err := svc.db.GetConversationByPK(req.ConversationPublicKey); err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	if err := svc.nameContexts.UseInConversation(ctx, req.ConversationPublicKey, req.Name); err != nil {
+		return nil, err
+	}
+
+	if err := svc.sendAccountUserInfo(ctx, req.ConversationPublicKey); err != nil {
+		return nil, err
+	}
+
+	return &mt.UseDisplayNameContext_Reply{}, nil
+}
+
+func (svc *service) AcceptContactAs(ctx context.Context, req *mt.AcceptContactAs_Request) (*mt.AcceptContactAs_Reply, error) {
+	if err := svc.checkNameContexts(); err != nil {
+		return nil, err
+	}
+
+	// the display name is sent once the conversation with the contact is
+	// joined, the context must be known by then
+	if err := svc.nameContexts.UseWithContact(ctx, req.ContactPublicKey, req.Name); err != nil {
+		return nil, err
+	}
+
+	if _, err := svc.ContactAccept(ctx, &mt.ContactAccept_Request{PublicKey: req.ContactPublicKey}); err != nil {
+		if err := svc.nameContexts.UseWithContact(ctx, req.ContactPublicKey, ""); err != nil {
+			svc.logger.Warn("unable to forget the context of the contact", zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return &mt.AcceptContactAs_Reply{}, nil
+}
+
+func (svc *service) JoinConversationAs(ctx context.Context, req *mt.JoinConversationAs_Request) (*mt.JoinConversationAs_Reply, error) {
+	if err := svc.checkNameContexts(); err != nil {
+		return nil, err
+	}
+
+	parsed, err := bertylinks.UnmarshalLink(req.Link, req.Passphrase)
+	if err != nil {
+		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(err)
+	}
+	if !parsed.IsGroup() {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("not a group link"))
+	}
+
+	// the display name is sent while the group is joined
+	conversationPK := messengerutil.B64EncodeBytes(parsed.GetBertyGroup().GetGroup().GetPublicKey())
+	if err := svc.nameContexts.UseInConversation(ctx, conversationPK, req.Name); err != nil {
+		return nil, err
+	}
+
+	if _, err := svc.ConversationJoin(ctx, &mt.ConversationJoin_Request{Link: req.Link, Passphrase: req.Passphrase}); err != nil {
+		if err := svc.nameContexts.UseInConversation(ctx, conversationPK, ""); err != nil {
+			svc.logger.Warn("unable to forget the context of the conversation", zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return &mt.JoinConversationAs_Reply{}, nil
+}
@@ -0,0 +1,72 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	"berty.tech/berty/v2/go/internal/messagedrafts"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) SaveDraft(ctx context.Context, req *messengertypes.SaveDraft_Request) (*messengertypes.SaveDraft_Reply, error) {
+	if svc.drafts == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("message drafts are not enabled"))
+	}
+
+	if req.ConversationPublicKey == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation is required"))
+	}
+
+	if _, err := svc.db.GetConversationByPK(req.ConversationPublicKey); err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	draft, err := svc.drafts.Save(ctx, req.ConversationPublicKey, req.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &messengertypes.SaveDraft_Reply{Draft: draftToProto(draft)}, nil
+}
+
+func (svc *service) GetDraft(ctx context.Context, req *messengertypes.GetDraft_Request) (*messengertypes.GetDraft_Reply, error) {
+	if svc.drafts == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("message drafts are not enabled"))
+	}
+
+	draft, err := svc.drafts.Get(ctx, req.ConversationPublicKey)
+	switch {
+	case errcode.Is(err, errcode.ErrNotFound):
+		return &messengertypes.GetDraft_Reply{Draft: &messengertypes.MessageDraft{ConversationPublicKey: req.ConversationPublicKey}}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return &messengertypes.GetDraft_Reply{Draft: draftToProto(draft)}, nil
+}
+
+func (svc *service) DeleteDraft(ctx context.Context, req *messengertypes.DeleteDraft_Request) (*messengertypes.DeleteDraft_Reply, error) {
+	if svc.drafts == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("message drafts are not enabled"))
+	}
+
+	if err := svc.drafts.Delete(ctx, req.ConversationPublicKey); err != nil {
+		return nil, err
+	}
+
+	return &messengertypes.DeleteDraft_Reply{}, nil
+}
+
+func draftToProto(draft *messagedrafts.Draft) *messengertypes.MessageDraft {
+	ret := &messengertypes.MessageDraft{
+		ConversationPublicKey: draft.ConversationPK,
+		Text:                  draft.Text,
+	}
+	if !draft.UpdatedAt.IsZero() {
+		ret.UpdatedDate = messengerutil.TimestampMs(draft.UpdatedAt)
+	}
+
+	return ret
+}
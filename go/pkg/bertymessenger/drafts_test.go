@@ -0,0 +1,78 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/messagedrafts"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestDrafts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	mock := clock.NewMock()
+	mock.Set(time.UnixMilli(1000))
+	drafts := messagedrafts.New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+	drafts.SetClock(mock)
+	ts.Service.(*service).drafts = drafts
+
+	conv, err := ts.Client.ConversationCreate(ctx, &messengertypes.ConversationCreate_Request{DisplayName: "conv"})
+	require.NoError(t, err)
+
+	got, err := ts.Client.GetDraft(ctx, &messengertypes.GetDraft_Request{ConversationPublicKey: conv.PublicKey})
+	require.NoError(t, err)
+	require.Equal(t, "", got.Draft.Text)
+
+	saved, err := ts.Client.SaveDraft(ctx, &messengertypes.SaveDraft_Request{ConversationPublicKey: conv.PublicKey, Text: "hello"})
+	require.NoError(t, err)
+	require.Equal(t, "hello", saved.Draft.Text)
+	require.Equal(t, int64(1000), saved.Draft.UpdatedDate)
+
+	got, err = ts.Client.GetDraft(ctx, &messengertypes.GetDraft_Request{ConversationPublicKey: conv.PublicKey})
+	require.NoError(t, err)
+	require.Equal(t, conv.PublicKey, got.Draft.ConversationPublicKey)
+	require.Equal(t, "hello", got.Draft.Text)
+	require.Equal(t, saved.Draft.UpdatedDate, got.Draft.UpdatedDate)
+
+	_, err = ts.Client.DeleteDraft(ctx, &messengertypes.DeleteDraft_Request{ConversationPublicKey: conv.PublicKey})
+	require.NoError(t, err)
+	got, err = ts.Client.GetDraft(ctx, &messengertypes.GetDraft_Request{ConversationPublicKey: conv.PublicKey})
+	require.NoError(t, err)
+	require.Equal(t, "", got.Draft.Text)
+
+	_, err = ts.Client.SaveDraft(ctx, &messengertypes.SaveDraft_Request{Text: "text"})
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+
+	_, err = ts.Client.SaveDraft(ctx, &messengertypes.SaveDraft_Request{ConversationPublicKey: "unknown", Text: "text"})
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+}
+
+func TestDraftsNotEnabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	_, err := ts.Client.GetDraft(ctx, &messengertypes.GetDraft_Request{ConversationPublicKey: "c1"})
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+}
@@ -0,0 +1,50 @@
+package bertymessenger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/eventjournal"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+func (svc *service) ReplayEvents(ctx context.Context, req *messengertypes.ReplayEvents_Request) (*messengertypes.ReplayEvents_Reply, error) {
+	page, err := svc.eventJournal.Replay(ctx, req.Since, int(req.Limit))
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &messengertypes.ReplayEvents_Reply{
+		Events: make([]*messengertypes.JournalEvent, len(page.Events)),
+		First:  page.First,
+		Last:   page.Last,
+		Pruned: page.Pruned,
+	}
+	for i, entry := range page.Events {
+		reply.Events[i] = journalEntryToProto(entry)
+	}
+
+	return reply, nil
+}
+
+// recordJournalEvent appends gme to the event journal, failures are logged
+// but do not fail the handling of the event.
+func (svc *service) recordJournalEvent(gme *protocoltypes.GroupMetadataEvent) {
+	if _, err := svc.eventJournal.Record(svc.ctx, gme); err != nil {
+		svc.logger.Warn("unable to journal protocol event", zap.String("type", gme.GetMetadata().GetEventType().String()), zap.Error(err))
+	}
+}
+
+func journalEntryToProto(entry *eventjournal.Entry) *messengertypes.JournalEvent {
+	return &messengertypes.JournalEvent{
+		Seq:            entry.Seq,
+		Date:           messengerutil.TimestampMs(entry.Time),
+		Kind:           string(entry.Kind),
+		GroupPublicKey: entry.GroupPK,
+		EventID:        entry.EventID,
+		Details:        entry.Details,
+	}
+}
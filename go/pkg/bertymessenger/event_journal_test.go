@@ -0,0 +1,64 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/eventjournal"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestReplayEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	journal, err := eventjournal.Open(ctx, datastore.NewMapDatastore(), 0)
+	require.NoError(t, err)
+	for _, kind := range []eventjournal.Kind{eventjournal.KindGroupJoined, eventjournal.KindMemberDeviceAdded, eventjournal.KindKeyRotated} {
+		_, err := journal.Append(ctx, &eventjournal.Entry{Kind: kind, GroupPK: "group", Details: map[string]string{"member": "pk"}})
+		require.NoError(t, err)
+	}
+	ts.Service.(*service).eventJournal = journal
+
+	reply, err := ts.Client.ReplayEvents(ctx, &messengertypes.ReplayEvents_Request{Since: 1, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, reply.Events, 1)
+	require.Equal(t, uint64(2), reply.Events[0].Seq)
+	require.Equal(t, string(eventjournal.KindMemberDeviceAdded), reply.Events[0].Kind)
+	require.Equal(t, "group", reply.Events[0].GroupPublicKey)
+	require.Equal(t, "pk", reply.Events[0].Details["member"])
+	require.NotZero(t, reply.Events[0].Date)
+	require.Equal(t, uint64(3), reply.Last)
+
+	reply, err = ts.Client.ReplayEvents(ctx, &messengertypes.ReplayEvents_Request{Since: 3})
+	require.NoError(t, err)
+	require.Empty(t, reply.Events)
+
+	_, err = ts.Client.ReplayEvents(ctx, &messengertypes.ReplayEvents_Request{Since: 10})
+	require.Error(t, err)
+}
+
+func TestReplayEventsNotEnabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	_, err := ts.Client.ReplayEvents(ctx, &messengertypes.ReplayEvents_Request{})
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+}
@@ -0,0 +1,76 @@
+package bertymessenger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/auditlog"
+	"berty.tech/berty/v2/go/internal/eventjournal"
+	"berty.tech/berty/v2/go/internal/groupkeys"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/logutil"
+)
+
+func (svc *service) GroupKeyStatus(ctx context.Context, req *mt.GroupKeyStatus_Request) (*mt.GroupKeyStatus_Reply, error) {
+	if len(req.GroupPK) == 0 {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a group public key is required"))
+	}
+
+	report, err := groupkeys.Status(ctx, svc.protocolClient, req.GroupPK)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &mt.GroupKeyStatus_Reply{Devices: make([]*mt.GroupKeyStatus_DeviceStatus, len(report.Devices))}
+	for i, d := range report.Devices {
+		reply.Devices[i] = &mt.GroupKeyStatus_DeviceStatus{
+			MemberPK:    d.MemberPK,
+			DevicePK:    d.DevicePK,
+			Self:        d.Self,
+			KeySent:     d.KeySent,
+			KeyReceived: d.KeyReceived,
+		}
+	}
+
+	return reply, nil
+}
+
+func (svc *service) RekeyGroup(ctx context.Context, req *mt.RekeyGroup_Request) (*mt.RekeyGroup_Reply, error) {
+	if len(req.GroupPK) == 0 {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a group public key is required"))
+	}
+
+	groupPK := req.GroupPK
+
+	svc.subsMutex.Lock()
+	defer svc.subsMutex.Unlock()
+
+	if err := groupkeys.Rekey(ctx, svc.protocolClient, groupPK); err != nil {
+		return nil, err
+	}
+
+	svc.logger.Info("group rekeyed", logutil.PrivateString("gpk", messengerutil.B64EncodeBytes(groupPK)))
+	svc.recordAuditEvent(auditlog.EventKeyRotated, map[string]string{"group": messengerutil.B64EncodeBytes(groupPK)})
+	if _, err := svc.eventJournal.Append(svc.ctx, &eventjournal.Entry{Kind: eventjournal.KindKeyRotated, GroupPK: messengerutil.B64EncodeBytes(groupPK)}); err != nil {
+		svc.logger.Warn("unable to journal the key rotation", zap.Error(err))
+	}
+
+	// the previous streams ended with the group deactivation
+	_, subscribed := svc.groupsToSubTo[messengerutil.B64EncodeBytes(groupPK)]
+	_, suspended := svc.suspendedGroups[messengerutil.B64EncodeBytes(groupPK)]
+	if svc.subsCtx == nil || suspended || (!subscribed && !bytes.Equal(groupPK, svc.accountGroup)) {
+		return &mt.RekeyGroup_Reply{}, nil
+	}
+
+	if err := svc.subscribeToGroup(svc.subsCtx, svc.ctx, groupPK); err != nil {
+		svc.logger.Error("unable to subscribe again to rekeyed group", logutil.PrivateString("gpk", messengerutil.B64EncodeBytes(groupPK)), zap.Error(err))
+		return nil, err
+	}
+
+	return &mt.RekeyGroup_Reply{}, nil
+}
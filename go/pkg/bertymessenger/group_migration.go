@@ -0,0 +1,303 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/auditlog"
+	"berty.tech/berty/v2/go/internal/groupmigration"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// GroupMigrator moves the multi-member groups to another account, see
+// groupmigration, it is implemented by the messenger service.
+type GroupMigrator interface {
+	// ExportGroup returns the bundle of the multi-member group with the
+	// public key conversationPK. Only the admins export a group in approval
+	// mode.
+	ExportGroup(ctx context.Context, conversationPK string) (*groupmigration.Bundle, error)
+
+	// ImportGroup creates a new group from a bundle exported by another
+	// account, with its history as imported messages, and invites the
+	// members who are contacts of the account.
+	ImportGroup(ctx context.Context, bundle *groupmigration.Bundle) (*GroupImport, error)
+
+	// AnnounceGroupMigration posts the invitation link of the new group in
+	// the previous group, every member can then rejoin.
+	AnnounceGroupMigration(ctx context.Context, conversationPK string, link string) error
+}
+
+// GroupImport is the result of ImportGroup.
+type GroupImport struct {
+	ConversationPK string
+	// Link is the invitation to the new group, to share with the members
+	// who were not invited.
+	Link string
+	// Invited are the contacts the new group was shared with.
+	Invited []string
+	// NotInvited are the members who are not contacts of the account.
+	NotInvited []groupmigration.Member
+	// Messages is the number of imported messages.
+	Messages int
+}
+
+var _ GroupMigrator = (*service)(nil)
+
+// groupMigrationPageSize is the number of interactions read at once from the
+// db.
+const groupMigrationPageSize = 100
+
+func (svc *service) ExportGroup(ctx context.Context, conversationPK string) (*groupmigration.Bundle, error) {
+	conv, err := svc.db.GetConversationByPK(conversationPK)
+	if err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+	if conv.GetType() != mt.Conversation_MultiMemberType {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("only the multi-member groups are migrated"))
+	}
+
+	own := conv.GetLocalMemberPublicKey()
+	if svc.joinApproval != nil {
+		policy, err := svc.joinApproval.Policy(ctx, conversationPK)
+		switch {
+		case errcode.Is(err, errcode.ErrNotFound):
+		case err != nil:
+			return nil, err
+		case !policy.IsAdmin(own):
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("only the admins export a group in approval mode"))
+		}
+	}
+
+	account, err := svc.db.GetAccount()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	bundle := &groupmigration.Bundle{
+		Version:    groupmigration.Version,
+		ExportedAt: svc.clock.Now(),
+		Group: groupmigration.Group{
+			PublicKey:   conversationPK,
+			DisplayName: conv.GetDisplayName(),
+		},
+		Exporter: own,
+	}
+
+	contacts, err := svc.db.GetContactsByState(mt.Contact_Accepted)
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	// the members are linked to the contacts by their display name, when it
+	// is not shared by several contacts
+	contactsByName := map[string][]string{}
+	for _, contact := range contacts {
+		if name := contact.GetDisplayName(); name != "" {
+			contactsByName[name] = append(contactsByName[name], contact.GetPublicKey())
+		}
+	}
+
+	members, err := svc.db.GetMembersByConversation(conversationPK)
+	if err != nil && !errcode.Is(err, errcode.ErrNotFound) {
+		return nil, err
+	}
+
+	for _, member := range members {
+		m := groupmigration.Member{PublicKey: member.GetPublicKey(), DisplayName: member.GetDisplayName()}
+		if matches := contactsByName[m.DisplayName]; !member.GetIsMe() && len(matches) == 1 {
+			m.ContactPublicKey = matches[0]
+		}
+		bundle.Members = append(bundle.Members, m)
+	}
+
+	for cursor := ""; ; {
+		page, err := svc.db.GetInteractionsAfter(conversationPK, cursor, groupMigrationPageSize, mt.SystemEvents_Included)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range page {
+			if m, ok := groupMigrationMessage(i, account, own); ok {
+				bundle.Messages = append(bundle.Messages, m)
+			}
+		}
+
+		if len(page) < groupMigrationPageSize {
+			break
+		}
+		cursor = page[len(page)-1].GetCID()
+	}
+
+	// the late messages are stored after the ones sent before them
+	sort.SliceStable(bundle.Messages, func(a, b int) bool { return bundle.Messages[a].SentAt.Before(bundle.Messages[b].SentAt) })
+	if extra := len(bundle.Messages) - groupmigration.MaxMessages; extra > 0 {
+		bundle.Messages = bundle.Messages[extra:]
+	}
+
+	svc.recordAuditEvent(auditlog.EventGroupExported, map[string]string{
+		"conversation": conversationPK,
+		"messages":     fmt.Sprint(len(bundle.Messages)),
+	})
+
+	return bundle, nil
+}
+
+// groupMigrationMessage returns the message of the bundle of i, the text
+// messages and the messages imported before are migrated.
+func groupMigrationMessage(i *mt.Interaction, account *mt.Account, own string) (groupmigration.Message, bool) {
+	m := groupmigration.Message{
+		CID:             i.GetCID(),
+		MemberPublicKey: i.GetMemberPublicKey(),
+		DisplayName:     i.GetMember().GetDisplayName(),
+		SentAt:          time.UnixMilli(i.GetSentDate()),
+	}
+
+	switch i.GetType() {
+	case mt.AppMessage_TypeUserMessage:
+		payload, err := i.UnmarshalPayload()
+		if err != nil {
+			return m, false
+		}
+		m.Body = payload.(*mt.AppMessage_UserMessage).GetBody()
+
+	case mt.AppMessage_TypeSystemEvent:
+		event, err := mt.UnmarshalSystemEvent(i.GetPayload())
+		if err != nil || event.Kind != mt.SystemEvent_MessageImported {
+			return m, false
+		}
+		m.CID, m.DisplayName, m.Body = event.SourceCID, event.DisplayName, event.Body
+
+	default:
+		return m, false
+	}
+
+	switch {
+	case i.GetIsMine() && i.GetType() == mt.AppMessage_TypeUserMessage:
+		m.MemberPublicKey, m.DisplayName = own, account.GetDisplayName()
+	case m.MemberPublicKey == "":
+		// the member of the device is not known yet
+		m.MemberPublicKey = i.GetDevicePublicKey()
+	}
+
+	return m, m.Body != "" && m.MemberPublicKey != ""
+}
+
+func (svc *service) ImportGroup(ctx context.Context, bundle *groupmigration.Bundle) (*GroupImport, error) {
+	if bundle == nil {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("no group migration bundle"))
+	}
+	if err := bundle.Validate(); err != nil {
+		return nil, err
+	}
+
+	contacts, err := svc.db.GetContactsByState(mt.Contact_Accepted)
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	accepted := map[string]bool{}
+	for _, contact := range contacts {
+		accepted[contact.GetPublicKey()] = true
+	}
+
+	result := &GroupImport{}
+	for _, contactPK := range bundle.Invitees() {
+		if accepted[contactPK] {
+			result.Invited = append(result.Invited, contactPK)
+		}
+	}
+
+	for _, m := range bundle.Members {
+		if m.PublicKey != bundle.Exporter && !accepted[m.ContactPublicKey] {
+			result.NotInvited = append(result.NotInvited, m)
+		}
+	}
+
+	reply, err := svc.ConversationCreate(ctx, &mt.ConversationCreate_Request{
+		DisplayName:      bundle.Group.DisplayName,
+		ContactsToInvite: result.Invited,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.ConversationPK = reply.GetPublicKey()
+
+	conv, err := svc.db.GetConversationByPK(result.ConversationPK)
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	result.Link = conv.GetLink()
+
+	// the history is only stored locally, the members keep their own
+	for _, m := range bundle.Messages {
+		event := &mt.SystemEvent{
+			Kind:            mt.SystemEvent_MessageImported,
+			MemberPublicKey: m.MemberPublicKey,
+			DisplayName:     m.DisplayName,
+			SourceCID:       m.CID,
+			Body:            m.Body,
+		}
+
+		_, isNew, err := svc.db.AddSystemEvent(result.ConversationPK, event, messengerutil.TimestampMs(m.SentAt))
+		if err != nil {
+			return nil, err
+		}
+		if isNew {
+			result.Messages++
+		}
+	}
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
+		svc.logger.Error("unable to stream the imported conversation", zap.Error(err))
+	}
+
+	svc.recordAuditEvent(auditlog.EventGroupImported, map[string]string{
+		"conversation": result.ConversationPK,
+		"previous":     bundle.Group.PublicKey,
+		"messages":     fmt.Sprint(result.Messages),
+		"invited":      fmt.Sprint(len(result.Invited)),
+	})
+
+	return result, nil
+}
+
+func (svc *service) AnnounceGroupMigration(ctx context.Context, conversationPK string, link string) error {
+	conv, err := svc.db.GetConversationByPK(conversationPK)
+	if err != nil {
+		return errcode.ErrNotFound.Wrap(err)
+	}
+	if conv.GetType() != mt.Conversation_MultiMemberType {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("only the multi-member groups are migrated"))
+	}
+
+	parsed, err := svc.ParseDeepLink(ctx, &mt.ParseDeepLink_Request{Link: link})
+	if err != nil {
+		return err
+	}
+	if parsed.GetLink().GetKind() != mt.BertyLink_GroupV1Kind {
+		return errcode.ErrMessengerInvalidDeepLink.Wrap(fmt.Errorf("not a group invitation"))
+	}
+
+	gpkb, err := messengerutil.B64DecodeBytes(conversationPK)
+	if err != nil {
+		return errcode.ErrDeserialization.Wrap(err)
+	}
+
+	am, err := mt.AppMessage_TypeGroupInvitation.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", &mt.AppMessage_GroupInvitation{Link: link})
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if _, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: am}); err != nil {
+		return errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package bertymessenger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestGroupMigrationMessage(t *testing.T) {
+	account := &mt.Account{DisplayName: "alice"}
+
+	userMessage := func(body string) []byte {
+		payload, err := (&mt.AppMessage_UserMessage{Body: body}).Marshal()
+		require.NoError(t, err)
+		return payload
+	}
+
+	// the messages of the account are sent by its member in the group
+	m, ok := groupMigrationMessage(&mt.Interaction{
+		CID:      "cid1",
+		Type:     mt.AppMessage_TypeUserMessage,
+		IsMine:   true,
+		SentDate: 1000,
+		Payload:  userMessage("hello"),
+	}, account, "own")
+	require.True(t, ok)
+	require.Equal(t, "own", m.MemberPublicKey)
+	require.Equal(t, "alice", m.DisplayName)
+	require.Equal(t, "hello", m.Body)
+	require.Equal(t, int64(1000), m.SentAt.UnixMilli())
+
+	// the device stands for its unknown member
+	m, ok = groupMigrationMessage(&mt.Interaction{
+		CID:             "cid2",
+		Type:            mt.AppMessage_TypeUserMessage,
+		DevicePublicKey: "device",
+		Payload:         userMessage("hi"),
+	}, account, "own")
+	require.True(t, ok)
+	require.Equal(t, "device", m.MemberPublicKey)
+
+	// the messages imported before keep their source
+	event, err := (&mt.SystemEvent{
+		Kind:            mt.SystemEvent_MessageImported,
+		MemberPublicKey: "bob",
+		DisplayName:     "Bob",
+		SourceCID:       "source",
+		Body:            "old",
+	}).Marshal()
+	require.NoError(t, err)
+
+	m, ok = groupMigrationMessage(&mt.Interaction{
+		CID:             "system:message_imported",
+		Type:            mt.AppMessage_TypeSystemEvent,
+		MemberPublicKey: "bob",
+		Payload:         event,
+	}, account, "own")
+	require.True(t, ok)
+	require.Equal(t, "source", m.CID)
+	require.Equal(t, "Bob", m.DisplayName)
+	require.Equal(t, "old", m.Body)
+
+	// the other system events and the messages without text are not
+	// migrated
+	joined, err := (&mt.SystemEvent{Kind: mt.SystemEvent_MemberJoined, MemberPublicKey: "bob"}).Marshal()
+	require.NoError(t, err)
+
+	_, ok = groupMigrationMessage(&mt.Interaction{CID: "cid3", Type: mt.AppMessage_TypeSystemEvent, MemberPublicKey: "bob", Payload: joined}, account, "own")
+	require.False(t, ok)
+
+	_, ok = groupMigrationMessage(&mt.Interaction{CID: "cid4", Type: mt.AppMessage_TypeUserMessage, MemberPublicKey: "bob", Payload: userMessage("")}, account, "own")
+	require.False(t, ok)
+
+	_, ok = groupMigrationMessage(&mt.Interaction{CID: "cid5", Type: mt.AppMessage_TypeGroupInvitation, MemberPublicKey: "bob"}, account, "own")
+	require.False(t, ok)
+}
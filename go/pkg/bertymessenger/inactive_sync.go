@@ -0,0 +1,127 @@
+package bertymessenger
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/tyber"
+)
+
+// InactiveSync defines which groups stay synced when the lifecycle manager
+// switches to lifecycle.StateInactive.
+type InactiveSync string
+
+const (
+	// InactiveSyncSuspend closes all the group subscriptions, nothing is
+	// received until the app is active again. It suits the mobile apps, woken
+	// up by push notifications.
+	InactiveSyncSuspend InactiveSync = "suspend"
+
+	// InactiveSyncLight keeps the account group and the contact groups
+	// subscribed, so that contact requests and direct messages are still
+	// received and notified. The multi-member groups are deactivated, which
+	// stops looking for their members on the network, and are synced again
+	// when the app is active.
+	InactiveSyncLight InactiveSync = "light"
+
+	// InactiveSyncPoll closes all the group subscriptions like
+	// InactiveSyncSuspend, but wakes up every Opts.PollInterval to sync the
+	// account group and the contact groups for a short while, the messages
+	// received meanwhile are notified locally. It is a fallback for the
+	// deployments without push notifications, e.g. headless or desktop nodes.
+	InactiveSyncPoll InactiveSync = "poll"
+)
+
+const (
+	// DefaultPollInterval is the time between two syncs in InactiveSyncPoll
+	// mode.
+	DefaultPollInterval = 15 * time.Minute
+
+	// pollSyncDuration is how long the groups stay subscribed when polling,
+	// it leaves time to reach the rendezvous points and the relays, and to
+	// replicate the pending events.
+	pollSyncDuration = time.Minute
+)
+
+// suspendedWhileInactive returns true for the groups deactivated in
+// InactiveSyncLight mode.
+func (svc *service) suspendedWhileInactive(groupPK string) bool {
+	conv, err := svc.db.GetConversationByPK(groupPK)
+	if err != nil {
+		// pending contact requests have no conversation yet
+		return false
+	}
+
+	return conv.GetType() == mt.Conversation_MultiMemberType
+}
+
+// pollGroups syncs the groups kept in InactiveSyncLight mode every interval
+// until the returned function is called, it returns once the groups are
+// unsubscribed again.
+func (svc *service) pollGroups(logger *zap.Logger, interval time.Duration, subscribe, unsubscribe func()) func() {
+	ctx, cancel := context.WithCancel(svc.ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := svc.clock.Ticker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			logger.Info("polling the account and contact groups")
+			subscribe()
+
+			select {
+			case <-ctx.Done():
+			case <-svc.clock.After(pollSyncDuration):
+			}
+
+			unsubscribe()
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// resumeSuspendedGroups subscribes again to the groups suspended while
+// inactive, svc.subsMutex must be held.
+func (svc *service) resumeSuspendedGroups(logger *zap.Logger) {
+	logger.Info("resuming the suspended group subscriptions", zap.Int("count", len(svc.suspendedGroups)))
+
+	tyberCtx, _, endSection := tyber.Section(context.TODO(), logger, "Resuming suspended groups")
+	var tyberErr error
+	defer func() { endSection(tyberErr, "") }()
+
+	for groupPK := range svc.suspendedGroups {
+		gpkb, err := messengerutil.B64DecodeBytes(groupPK)
+		if err != nil {
+			logger.Error("unable to resume subscription, decode error", zap.String("gpk", groupPK), zap.Error(err))
+			tyberErr = err
+			continue
+		}
+
+		if err := svc.subscribeToGroup(svc.subsCtx, tyberCtx, gpkb); err != nil {
+			if !errcode.Has(err, errcode.ErrBertyAccountAlreadyOpened) {
+				logger.Error("unable to resume subscription", zap.String("gpk", groupPK), zap.Error(err))
+			}
+			tyberErr = err
+		}
+	}
+
+	svc.suspendedGroups = nil
+}
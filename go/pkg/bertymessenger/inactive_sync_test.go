@@ -0,0 +1,249 @@
+package bertymessenger
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet"
+	"berty.tech/weshnet/pkg/lifecycle"
+	"berty.tech/weshnet/pkg/protocoltypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+// activationRecorder keeps track of the groups activated by the messenger.
+type activationRecorder struct {
+	weshnet.ServiceClient
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+func newActivationRecorder(client weshnet.ServiceClient) *activationRecorder {
+	return &activationRecorder{ServiceClient: client, active: map[string]bool{}}
+}
+
+func (r *activationRecorder) ActivateGroup(ctx context.Context, in *protocoltypes.ActivateGroup_Request, opts ...grpc.CallOption) (*protocoltypes.ActivateGroup_Reply, error) {
+	r.mu.Lock()
+	r.active[messengerutil.B64EncodeBytes(in.GetGroupPK())] = true
+	r.mu.Unlock()
+
+	return r.ServiceClient.ActivateGroup(ctx, in, opts...)
+}
+
+func (r *activationRecorder) DeactivateGroup(ctx context.Context, in *protocoltypes.DeactivateGroup_Request, opts ...grpc.CallOption) (*protocoltypes.DeactivateGroup_Reply, error) {
+	r.mu.Lock()
+	delete(r.active, messengerutil.B64EncodeBytes(in.GetGroupPK()))
+	r.mu.Unlock()
+
+	return r.ServiceClient.DeactivateGroup(ctx, in, opts...)
+}
+
+func (r *activationRecorder) isActive(groupPK string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.active[groupPK]
+}
+
+// newInactiveSyncTest returns a messenger with the account group, a contact
+// group and a multi-member group subscribed.
+func newInactiveSyncTest(ctx context.Context, t *testing.T, opts *TestingServiceOpts) (svc *service, recorder *activationRecorder, contactGroup, multiMemberGroup string) {
+	t.Helper()
+
+	logger, cleanup := testutil.Logger(t)
+	t.Cleanup(cleanup)
+
+	protocol, cleanup := weshnet.NewTestingProtocol(ctx, t, &weshnet.TestingOpts{Logger: logger}, nil)
+	t.Cleanup(cleanup)
+
+	recorder = newActivationRecorder(protocol.Client)
+	opts.Logger = logger
+	opts.Client = recorder
+	ts, cleanup := NewTestingService(ctx, t, opts)
+	t.Cleanup(cleanup)
+	svc = ts.Service.(*service)
+
+	created, err := ts.Client.ConversationCreate(ctx, &messengertypes.ConversationCreate_Request{DisplayName: "group"})
+	require.NoError(t, err)
+	multiMemberGroup = created.GetPublicKey()
+
+	// a contact group, the contact requests are not needed to subscribe to it
+	group, err := protocol.Client.MultiMemberGroupCreate(ctx, &protocoltypes.MultiMemberGroupCreate_Request{})
+	require.NoError(t, err)
+	contactGroup = messengerutil.B64EncodeBytes(group.GetGroupPK())
+	_, err = svc.db.AddConversationForContact(contactGroup, "member", "device", "contact")
+	require.NoError(t, err)
+	require.NoError(t, svc.ActivateGroup(group.GetGroupPK()))
+
+	accountGroup := messengerutil.B64EncodeBytes(svc.accountGroup)
+	require.Eventually(t, func() bool {
+		return recorder.isActive(accountGroup) && recorder.isActive(contactGroup) && recorder.isActive(multiMemberGroup)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	return svc, recorder, contactGroup, multiMemberGroup
+}
+
+func TestInactiveSyncLight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	svc, recorder, contactGroup, multiMemberGroup := newInactiveSyncTest(ctx, t, &TestingServiceOpts{InactiveSync: InactiveSyncLight})
+	accountGroup := messengerutil.B64EncodeBytes(svc.accountGroup)
+
+	isSuspended := func(groupPK string) bool {
+		svc.subsMutex.Lock()
+		defer svc.subsMutex.Unlock()
+
+		_, ok := svc.suspendedGroups[groupPK]
+		return ok
+	}
+
+	// only the multi-member group is suspended while inactive
+	svc.lcmanager.UpdateState(lifecycle.StateInactive)
+	require.Eventually(t, func() bool { return !recorder.isActive(multiMemberGroup) }, 5*time.Second, 50*time.Millisecond)
+	require.True(t, isSuspended(multiMemberGroup))
+	require.True(t, recorder.isActive(accountGroup))
+	require.True(t, recorder.isActive(contactGroup))
+	require.False(t, isSuspended(contactGroup))
+
+	// and resumed once active again
+	svc.lcmanager.UpdateState(lifecycle.StateActive)
+	require.Eventually(t, func() bool { return recorder.isActive(multiMemberGroup) }, 5*time.Second, 50*time.Millisecond)
+	require.False(t, isSuspended(multiMemberGroup))
+	require.True(t, recorder.isActive(accountGroup))
+	require.True(t, recorder.isActive(contactGroup))
+}
+
+func TestInactiveSyncSuspend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	svc, recorder, contactGroup, multiMemberGroup := newInactiveSyncTest(ctx, t, &TestingServiceOpts{})
+	accountGroup := messengerutil.B64EncodeBytes(svc.accountGroup)
+
+	// every group is closed while inactive
+	svc.lcmanager.UpdateState(lifecycle.StateInactive)
+	require.Eventually(t, func() bool {
+		return !recorder.isActive(accountGroup) && !recorder.isActive(contactGroup) && !recorder.isActive(multiMemberGroup)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	svc.lcmanager.UpdateState(lifecycle.StateActive)
+	require.Eventually(t, func() bool {
+		return recorder.isActive(accountGroup) && recorder.isActive(contactGroup) && recorder.isActive(multiMemberGroup)
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+// advanceUntil moves the mock clock forward by steps of pollSyncDuration/4
+// until cond is true. The timers of the poller are armed asynchronously, a
+// step shorter than a sync never fires a poll and its end at once.
+func advanceUntil(t *testing.T, mock *clock.Mock, cond func() bool) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		if cond() {
+			return true
+		}
+		mock.Add(pollSyncDuration / 4)
+		return false
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestPollGroups(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := clock.NewMock()
+	svc := &service{ctx: ctx, clock: mock}
+
+	var (
+		mu                       sync.Mutex
+		subscribes, unsubscribes int
+	)
+	counts := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return subscribes, unsubscribes
+	}
+	stop := svc.pollGroups(zap.NewNop(), 10*time.Minute,
+		func() { mu.Lock(); subscribes++; mu.Unlock() },
+		func() { mu.Lock(); unsubscribes++; mu.Unlock() },
+	)
+
+	// nothing is synced before the first interval
+	mock.Add(5 * time.Minute)
+	time.Sleep(50 * time.Millisecond)
+	s, u := counts()
+	require.Equal(t, 0, s)
+	require.Equal(t, 0, u)
+
+	// the groups are synced every interval, for pollSyncDuration
+	for i := 1; i <= 2; i++ {
+		advanceUntil(t, mock, func() bool { s, _ := counts(); return s == i })
+		_, u = counts()
+		require.Equal(t, i-1, u)
+
+		advanceUntil(t, mock, func() bool { _, u := counts(); return u == i })
+		s, _ = counts()
+		require.Equal(t, i, s)
+	}
+
+	// a stop during a sync unsubscribes the groups and ends the polling
+	advanceUntil(t, mock, func() bool { s, _ := counts(); return s == 3 })
+	stop()
+	s, u = counts()
+	require.Equal(t, 3, s)
+	require.Equal(t, 3, u)
+
+	mock.Add(time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	s, u = counts()
+	require.Equal(t, 3, s)
+	require.Equal(t, 3, u)
+}
+
+func TestInactiveSyncPoll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mock := clock.NewMock()
+	svc, recorder, contactGroup, multiMemberGroup := newInactiveSyncTest(ctx, t, &TestingServiceOpts{
+		InactiveSync: InactiveSyncPoll,
+		PollInterval: 10 * time.Minute,
+		Clock:        mock,
+	})
+	accountGroup := messengerutil.B64EncodeBytes(svc.accountGroup)
+
+	svc.lcmanager.UpdateState(lifecycle.StateInactive)
+	require.Eventually(t, func() bool {
+		return !recorder.isActive(accountGroup) && !recorder.isActive(contactGroup) && !recorder.isActive(multiMemberGroup)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// the poll only syncs the account and the contact groups
+	advanceUntil(t, mock, func() bool { return recorder.isActive(accountGroup) && recorder.isActive(contactGroup) })
+	require.False(t, recorder.isActive(multiMemberGroup))
+
+	advanceUntil(t, mock, func() bool { return !recorder.isActive(accountGroup) && !recorder.isActive(contactGroup) })
+
+	// the polling stops once active, during a sync as well
+	advanceUntil(t, mock, func() bool { return recorder.isActive(accountGroup) })
+	svc.lcmanager.UpdateState(lifecycle.StateActive)
+	require.Eventually(t, func() bool {
+		return recorder.isActive(accountGroup) && recorder.isActive(contactGroup) && recorder.isActive(multiMemberGroup)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	mock.Add(pollSyncDuration)
+	mock.Add(time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, recorder.isActive(accountGroup))
+	require.True(t, recorder.isActive(contactGroup))
+	require.True(t, recorder.isActive(multiMemberGroup))
+}
@@ -0,0 +1,499 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/joinapproval"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/logutil"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// MaxHeldJoinMessages bounds the messages of the pending members held in
+// memory for a group, the next ones are dropped.
+//
+// The messages of the pending members are held in memory until they are
+// approved, and the ones of the denied members are dropped. The clients
+// unaware of the approval mode show them anyway, and the messages replayed
+// from the group logs, e.g. with -node.rebuild-db, are not held.
+const MaxHeldJoinMessages = 256
+
+// heldJoinMessage is a message of a pending member.
+type heldJoinMessage struct {
+	gme *protocoltypes.GroupMessageEvent
+	am  *mt.AppMessage
+}
+
+func (svc *service) JoinApprovalSet(ctx context.Context, req *mt.JoinApprovalSet_Request) (*mt.JoinApprovalSet_Reply, error) {
+	if svc.joinApproval == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("join approval is not enabled"))
+	}
+
+	if req.ConversationPublicKey == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	conv, err := svc.db.GetConversationByPK(req.ConversationPublicKey)
+	if err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+	if conv.GetType() != mt.Conversation_MultiMemberType {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("only the multi-member groups have an approval mode"))
+	}
+
+	gpkb, err := messengerutil.B64DecodeBytes(req.ConversationPublicKey)
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	own, err := svc.localGroupMember(ctx, gpkb)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mt.AppMessage_JoinPolicy{Disabled: !req.Enabled}
+	if req.Enabled {
+		m.Admins = []string{own}
+		if current, err := svc.joinApproval.Policy(ctx, req.ConversationPublicKey); err == nil {
+			m.Admins = current.Admins
+		}
+
+		members, err := svc.db.GetMembersByConversation(req.ConversationPublicKey)
+		if err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+
+		// the members already in the group stay members, the pending and
+		// denied ones are not approved by the policy
+		for _, member := range members {
+			state, err := svc.joinApproval.State(ctx, req.ConversationPublicKey, member.GetPublicKey())
+			if err != nil {
+				return nil, err
+			}
+			if state == joinapproval.StateApproved {
+				m.Members = append(m.Members, member.GetPublicKey())
+			}
+		}
+	}
+
+	if _, err := svc.joinApproval.ApplyPolicy(ctx, req.ConversationPublicKey, own, m); err != nil {
+		return nil, err
+	}
+
+	if err := svc.sendJoinApprovalMessage(ctx, gpkb, mt.AppMessage_TypeJoinPolicy, m); err != nil {
+		return nil, err
+	}
+
+	return &mt.JoinApprovalSet_Reply{}, nil
+}
+
+func (svc *service) JoinRequests(ctx context.Context, req *mt.JoinRequests_Request) (*mt.JoinRequests_Reply, error) {
+	if svc.joinApproval == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("join approval is not enabled"))
+	}
+
+	if req.ConversationPublicKey == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	requests, err := svc.joinApproval.Requests(ctx, req.ConversationPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &mt.JoinRequests_Reply{Requests: make([]*mt.JoinApprovalRequest, len(requests))}
+	for i, r := range requests {
+		reply.Requests[i] = joinRequestToProto(r)
+	}
+
+	return reply, nil
+}
+
+func (svc *service) JoinState(ctx context.Context, req *mt.JoinState_Request) (*mt.JoinState_Reply, error) {
+	if svc.joinApproval == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("join approval is not enabled"))
+	}
+
+	if req.ConversationPublicKey == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	memberPK := req.MemberPublicKey
+	if memberPK == "" {
+		gpkb, err := messengerutil.B64DecodeBytes(req.ConversationPublicKey)
+		if err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+
+		if memberPK, err = svc.localGroupMember(ctx, gpkb); err != nil {
+			return nil, err
+		}
+	}
+
+	state, err := svc.joinApproval.State(ctx, req.ConversationPublicKey, memberPK)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.JoinState_Reply{State: joinStateToProto(state)}, nil
+}
+
+func (svc *service) JoinApprove(ctx context.Context, req *mt.JoinApprove_Request) (*mt.JoinApprove_Reply, error) {
+	if err := svc.decideJoin(ctx, req.ConversationPublicKey, req.MemberPublicKey, true); err != nil {
+		return nil, err
+	}
+
+	return &mt.JoinApprove_Reply{}, nil
+}
+
+func (svc *service) JoinDeny(ctx context.Context, req *mt.JoinDeny_Request) (*mt.JoinDeny_Reply, error) {
+	if err := svc.decideJoin(ctx, req.ConversationPublicKey, req.MemberPublicKey, false); err != nil {
+		return nil, err
+	}
+
+	return &mt.JoinDeny_Reply{}, nil
+}
+
+// decideJoin records the decision of the account and sends it to the group,
+// it is sent again when the member is already in that state.
+func (svc *service) decideJoin(ctx context.Context, conversationPK string, memberPK string, approved bool) error {
+	if svc.joinApproval == nil {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("join approval is not enabled"))
+	}
+
+	if conversationPK == "" || memberPK == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation public key and a member public key are required"))
+	}
+
+	gpkb, err := messengerutil.B64DecodeBytes(conversationPK)
+	if err != nil {
+		return errcode.ErrDeserialization.Wrap(err)
+	}
+
+	own, err := svc.localGroupMember(ctx, gpkb)
+	if err != nil {
+		return err
+	}
+
+	r, changed, err := svc.joinApproval.Decide(ctx, conversationPK, memberPK, own, approved)
+	if errcode.Is(err, errcode.ErrNotFound) {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the group is not in approval mode"))
+	} else if err != nil {
+		return err
+	}
+
+	if changed {
+		svc.addJoinSystemEvent(conversationPK, joinDecisionKind(approved), r.MemberPK, r.DisplayName)
+	}
+
+	return svc.sendJoinApprovalMessage(ctx, gpkb, mt.AppMessage_TypeJoinDecision, &mt.AppMessage_JoinDecision{MemberPublicKey: memberPK, Approved: approved})
+}
+
+func joinDecisionKind(approved bool) mt.SystemEvent_Kind {
+	if approved {
+		return mt.SystemEvent_JoinApproved
+	}
+	return mt.SystemEvent_JoinDenied
+}
+
+func (svc *service) sendJoinApprovalMessage(ctx context.Context, gpkb []byte, typ mt.AppMessage_Type, payload proto.Message) error {
+	am, err := typ.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", payload)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if _, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: am}); err != nil {
+		return errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	return nil
+}
+
+// localGroupMember returns the public key of the account in a group.
+func (svc *service) localGroupMember(ctx context.Context, gpkb []byte) (string, error) {
+	if conv, err := svc.db.GetConversationByPK(messengerutil.B64EncodeBytes(gpkb)); err == nil && conv.GetLocalMemberPublicKey() != "" {
+		return conv.GetLocalMemberPublicKey(), nil
+	}
+
+	gi, err := svc.protocolClient.GroupInfo(ctx, &protocoltypes.GroupInfo_Request{GroupPK: gpkb})
+	if err != nil {
+		return "", errcode.TODO.Wrap(err)
+	}
+
+	return messengerutil.B64EncodeBytes(gi.GetMemberPK()), nil
+}
+
+// senderMember returns the public key of the member who sent gme, or "" when
+// its device is not known yet.
+func (svc *service) senderMember(gme *protocoltypes.GroupMessageEvent) string {
+	device, err := svc.db.GetDeviceByPK(messengerutil.B64EncodeBytes(gme.GetHeaders().GetDevicePK()))
+	if err != nil {
+		return ""
+	}
+
+	return device.GetMemberPublicKey()
+}
+
+// handleJoinApprovalMessage applies the policies, the requests and the
+// decisions received, it returns false for other messages.
+func (svc *service) handleJoinApprovalMessage(gpkb []byte, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) bool {
+	switch am.GetType() {
+	case mt.AppMessage_TypeJoinPolicy, mt.AppMessage_TypeJoinRequest, mt.AppMessage_TypeJoinDecision:
+	default:
+		return false
+	}
+
+	if svc.joinApproval == nil {
+		return true
+	}
+
+	gpk := messengerutil.B64EncodeBytes(gpkb)
+	sender := svc.senderMember(gme)
+	if sender == "" {
+		svc.logger.Warn("join approval message from an unknown device", logutil.PrivateString("group", gpk))
+		return true
+	}
+
+	logError := func(err error) bool {
+		svc.logger.Warn("invalid join approval message", logutil.PrivateString("group", gpk), zap.String("type", am.GetType().String()), zap.Error(err))
+		return true
+	}
+
+	payload, err := am.UnmarshalPayload()
+	if err != nil {
+		return logError(err)
+	}
+
+	switch m := payload.(type) {
+	case *mt.AppMessage_JoinPolicy:
+		if _, err := svc.joinApproval.ApplyPolicy(svc.ctx, gpk, sender, m); err != nil {
+			return logError(err)
+		}
+
+		svc.requestJoinApproval(gpkb)
+
+	case *mt.AppMessage_JoinRequest:
+		r, isNew, err := svc.joinApproval.AddRequest(svc.ctx, gpk, sender, m.DisplayName)
+		if err != nil {
+			return logError(err)
+		}
+		if isNew {
+			svc.addJoinSystemEvent(gpk, mt.SystemEvent_JoinRequested, r.MemberPK, r.DisplayName)
+		}
+
+	case *mt.AppMessage_JoinDecision:
+		r, changed, err := svc.joinApproval.Decide(svc.ctx, gpk, m.MemberPublicKey, sender, m.Approved)
+		if err != nil {
+			return logError(err)
+		}
+		if changed {
+			svc.addJoinSystemEvent(gpk, joinDecisionKind(m.Approved), r.MemberPK, r.DisplayName)
+		}
+	}
+
+	svc.releaseJoinHeldMessages(gpkb)
+
+	return true
+}
+
+// requestJoinApproval sends the join request of the account once it knows
+// that it is pending.
+func (svc *service) requestJoinApproval(gpkb []byte) {
+	gpk := messengerutil.B64EncodeBytes(gpkb)
+
+	own, err := svc.localGroupMember(svc.ctx, gpkb)
+	if err != nil {
+		svc.logger.Warn("unable to get the member of the account", logutil.PrivateString("group", gpk), zap.Error(err))
+		return
+	}
+
+	if state, err := svc.joinApproval.State(svc.ctx, gpk, own); err != nil || state != joinapproval.StatePending {
+		return
+	}
+
+	m := &mt.AppMessage_JoinRequest{}
+	if !svc.profilePrivacy.HideProfile() {
+		if acc, err := svc.db.GetAccount(); err == nil {
+			m.DisplayName = svc.contextDisplayName(gpk, acc.GetDisplayName())
+		}
+	}
+
+	r, isNew, err := svc.joinApproval.AddRequest(svc.ctx, gpk, own, m.DisplayName)
+	if err != nil || !isNew {
+		return
+	}
+	svc.addJoinSystemEvent(gpk, mt.SystemEvent_JoinRequested, r.MemberPK, r.DisplayName)
+
+	go func() {
+		if err := svc.sendJoinApprovalMessage(svc.ctx, gpkb, mt.AppMessage_TypeJoinRequest, m); err != nil {
+			svc.logger.Warn("unable to send the join request", logutil.PrivateString("group", gpk), zap.Error(err))
+		}
+	}()
+}
+
+// holdJoinPendingMessage holds the messages of the pending members and drops
+// the ones of the denied members of the groups in approval mode, it returns
+// false for the messages of the approved members.
+func (svc *service) holdJoinPendingMessage(gpkb []byte, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) bool {
+	if svc.joinApproval == nil {
+		return false
+	}
+
+	gpk := messengerutil.B64EncodeBytes(gpkb)
+	policy, err := svc.joinApproval.Policy(svc.ctx, gpk)
+	if err != nil {
+		return false
+	}
+
+	own, err := svc.localGroupMember(svc.ctx, gpkb)
+	if err != nil {
+		svc.logger.Warn("unable to get the member of the account", logutil.PrivateString("group", gpk), zap.Error(err))
+		return false
+	}
+
+	// the member of a device received before its metadata is not known
+	state := joinapproval.StatePending
+	member := svc.senderMember(gme)
+	if member != "" {
+		if member == own {
+			return false
+		}
+
+		if state, err = svc.joinApproval.State(svc.ctx, gpk, member); err != nil {
+			svc.logger.Warn("unable to get the join state", logutil.PrivateString("group", gpk), zap.Error(err))
+			return false
+		}
+	}
+
+	switch state {
+	case joinapproval.StateApproved:
+		return false
+	case joinapproval.StateDenied:
+		svc.logger.Debug("dropped a message of a denied member", logutil.PrivateString("group", gpk), logutil.PrivateString("member", member))
+		return true
+	}
+
+	// the members who joined after the policy was sent do not know that they
+	// are pending, the admins send it again for them
+	if member != "" {
+		if r, isNew, err := svc.joinApproval.AddRequest(svc.ctx, gpk, member, ""); err == nil && isNew {
+			svc.addJoinSystemEvent(gpk, mt.SystemEvent_JoinRequested, r.MemberPK, r.DisplayName)
+
+			if policy.IsAdmin(own) {
+				m := &mt.AppMessage_JoinPolicy{Admins: policy.Admins, Members: policy.Members}
+				go func() {
+					if err := svc.sendJoinApprovalMessage(svc.ctx, gpkb, mt.AppMessage_TypeJoinPolicy, m); err != nil {
+						svc.logger.Warn("unable to send the join policy", logutil.PrivateString("group", gpk), zap.Error(err))
+					}
+				}()
+			}
+		}
+	}
+
+	svc.muJoinHeld.Lock()
+	defer svc.muJoinHeld.Unlock()
+
+	if len(svc.joinHeld[gpk]) >= MaxHeldJoinMessages {
+		svc.logger.Warn("dropped a message of a pending member, too many held messages", logutil.PrivateString("group", gpk))
+		return true
+	}
+	svc.joinHeld[gpk] = append(svc.joinHeld[gpk], heldJoinMessage{gme: gme, am: am})
+
+	return true
+}
+
+// releaseJoinHeldMessages handles the held messages of the members approved
+// since they were received, and drops the ones of the denied members.
+func (svc *service) releaseJoinHeldMessages(gpkb []byte) {
+	gpk := messengerutil.B64EncodeBytes(gpkb)
+
+	svc.muJoinHeld.Lock()
+	held := svc.joinHeld[gpk]
+	delete(svc.joinHeld, gpk)
+	svc.muJoinHeld.Unlock()
+
+	pending := []heldJoinMessage{}
+	for _, h := range held {
+		member := svc.senderMember(h.gme)
+		if member == "" {
+			pending = append(pending, h)
+			continue
+		}
+
+		state, err := svc.joinApproval.State(svc.ctx, gpk, member)
+		switch {
+		case err != nil || state == joinapproval.StatePending:
+			pending = append(pending, h)
+		case state == joinapproval.StateApproved:
+			svc.handleGroupAppMessage(gpkb, h.gme, h.am)
+		}
+	}
+
+	if len(pending) == 0 {
+		return
+	}
+
+	svc.muJoinHeld.Lock()
+	svc.joinHeld[gpk] = append(pending, svc.joinHeld[gpk]...)
+	svc.muJoinHeld.Unlock()
+}
+
+// addJoinSystemEvent stores and streams the system event of a request or a
+// decision.
+func (svc *service) addJoinSystemEvent(gpk string, kind mt.SystemEvent_Kind, memberPK string, displayName string) {
+	if displayName == "" {
+		if member, err := svc.db.GetMemberByPK(memberPK, gpk); err == nil {
+			displayName = member.GetDisplayName()
+		}
+	}
+
+	event := &mt.SystemEvent{Kind: kind, MemberPublicKey: memberPK, DisplayName: displayName}
+	i, isNew, err := svc.db.AddSystemEvent(gpk, event, messengerutil.TimestampMs(svc.clock.Now()))
+	if err != nil {
+		svc.logger.Error("unable to add the join system event", zap.Error(err))
+		return
+	}
+	if !isNew {
+		return
+	}
+
+	if err := messengerutil.StreamInteraction(svc.dispatcher, svc.db, i.GetCID(), true); err != nil {
+		svc.logger.Error("unable to stream the join system event", zap.Error(err))
+	}
+}
+
+func joinRequestToProto(r *joinapproval.Request) *mt.JoinApprovalRequest {
+	ret := &mt.JoinApprovalRequest{
+		ConversationPublicKey: r.GroupPK,
+		MemberPublicKey:       r.MemberPK,
+		DisplayName:           r.DisplayName,
+		State:                 joinStateToProto(r.State),
+		RequestedDate:         messengerutil.TimestampMs(r.RequestedAt),
+		DecidedBy:             r.DecidedBy,
+	}
+	if !r.DecidedAt.IsZero() {
+		ret.DecidedDate = messengerutil.TimestampMs(r.DecidedAt)
+	}
+
+	return ret
+}
+
+func joinStateToProto(state joinapproval.State) mt.JoinApprovalRequest_State {
+	switch state {
+	case joinapproval.StatePending:
+		return mt.JoinApprovalRequest_Pending
+	case joinapproval.StateApproved:
+		return mt.JoinApprovalRequest_Approved
+	case joinapproval.StateDenied:
+		return mt.JoinApprovalRequest_Denied
+	default:
+		return mt.JoinApprovalRequest_Undefined
+	}
+}
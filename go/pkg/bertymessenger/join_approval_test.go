@@ -0,0 +1,70 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/joinapproval"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestJoinApproval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	ts.Service.(*service).joinApproval = joinapproval.New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	conv, err := ts.Client.ConversationCreate(ctx, &messengertypes.ConversationCreate_Request{DisplayName: "conv"})
+	require.NoError(t, err)
+
+	_, err = ts.Client.JoinApprovalSet(ctx, &messengertypes.JoinApprovalSet_Request{ConversationPublicKey: conv.PublicKey, Enabled: true})
+	require.NoError(t, err)
+
+	state, err := ts.Client.JoinState(ctx, &messengertypes.JoinState_Request{ConversationPublicKey: conv.PublicKey})
+	require.NoError(t, err)
+	require.Equal(t, messengertypes.JoinApprovalRequest_Approved, state.State)
+
+	state, err = ts.Client.JoinState(ctx, &messengertypes.JoinState_Request{ConversationPublicKey: conv.PublicKey, MemberPublicKey: "unknown"})
+	require.NoError(t, err)
+	require.Equal(t, messengertypes.JoinApprovalRequest_Pending, state.State)
+
+	requests, err := ts.Client.JoinRequests(ctx, &messengertypes.JoinRequests_Request{ConversationPublicKey: conv.PublicKey})
+	require.NoError(t, err)
+	require.Empty(t, requests.Requests)
+
+	_, err = ts.Client.JoinApprove(ctx, &messengertypes.JoinApprove_Request{ConversationPublicKey: conv.PublicKey})
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+
+	_, err = ts.Client.JoinApprovalSet(ctx, &messengertypes.JoinApprovalSet_Request{ConversationPublicKey: conv.PublicKey})
+	require.NoError(t, err)
+
+	state, err = ts.Client.JoinState(ctx, &messengertypes.JoinState_Request{ConversationPublicKey: conv.PublicKey, MemberPublicKey: "unknown"})
+	require.NoError(t, err)
+	require.Equal(t, messengertypes.JoinApprovalRequest_Approved, state.State)
+}
+
+func TestJoinApprovalNotEnabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	_, err := ts.Client.JoinRequests(ctx, &messengertypes.JoinRequests_Request{ConversationPublicKey: "c1"})
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+}
@@ -0,0 +1,170 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	ipfscid "github.com/ipfs/go-cid"
+
+	"berty.tech/berty/v2/go/internal/auditlog"
+	"berty.tech/berty/v2/go/internal/keyescrow"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// KeyEscrow exports the key material of the conversations opted in to an
+// escrow, see keyescrow. Every change and export is recorded in the audit
+// log.
+type KeyEscrow interface {
+	// EnableKeyEscrow opts the conversation with the public key publicKey,
+	// or the one of the contact with this public key, in to the export to
+	// the escrow with the public key recipient.
+	EnableKeyEscrow(ctx context.Context, publicKey string, recipient *[32]byte) (*keyescrow.Enrollment, error)
+
+	// DisableKeyEscrow withdraws the conversation, the exported files stay
+	// readable by the escrow.
+	DisableKeyEscrow(ctx context.Context, publicKey string) error
+
+	// KeyEscrowEnrollment returns the opt-in of the conversation, it fails
+	// with ErrNotFound when the conversation did not opt in.
+	KeyEscrowEnrollment(ctx context.Context, publicKey string) (*keyescrow.Enrollment, error)
+
+	// ExportKeyEscrow writes the key material and the messages of the
+	// conversation to w, sealed to the escrow of its enrollment.
+	ExportKeyEscrow(ctx context.Context, publicKey string, w io.Writer) (*keyescrow.Archive, error)
+}
+
+var _ KeyEscrow = (*service)(nil)
+
+func (svc *service) EnableKeyEscrow(ctx context.Context, publicKey string, recipient *[32]byte) (*keyescrow.Enrollment, error) {
+	if svc.keyEscrow == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("the key escrow is disabled"))
+	}
+
+	conv, _, err := svc.conversationForExport(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment, err := svc.keyEscrow.Enable(ctx, conv.GetPublicKey(), recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.recordAuditEvent(auditlog.EventKeyEscrowEnabled, map[string]string{
+		"conversation": conv.GetPublicKey(),
+		"recipient":    keyescrow.Fingerprint(recipient),
+	})
+
+	return enrollment, nil
+}
+
+func (svc *service) DisableKeyEscrow(ctx context.Context, publicKey string) error {
+	if svc.keyEscrow == nil {
+		return errcode.ErrNotImplemented.Wrap(fmt.Errorf("the key escrow is disabled"))
+	}
+
+	conv, _, err := svc.conversationForExport(publicKey)
+	if err != nil {
+		return err
+	}
+
+	if err := svc.keyEscrow.Disable(ctx, conv.GetPublicKey()); err != nil {
+		return err
+	}
+
+	svc.recordAuditEvent(auditlog.EventKeyEscrowDisabled, map[string]string{"conversation": conv.GetPublicKey()})
+
+	return nil
+}
+
+func (svc *service) KeyEscrowEnrollment(ctx context.Context, publicKey string) (*keyescrow.Enrollment, error) {
+	if svc.keyEscrow == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("the key escrow is disabled"))
+	}
+
+	conv, _, err := svc.conversationForExport(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.keyEscrow.Get(ctx, conv.GetPublicKey())
+}
+
+func (svc *service) ExportKeyEscrow(ctx context.Context, publicKey string, w io.Writer) (*keyescrow.Archive, error) {
+	enrollment, err := svc.KeyEscrowEnrollment(ctx, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	recipient, err := keyescrow.ParseKey(enrollment.Recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	gpk, err := messengerutil.B64DecodeBytes(enrollment.ConversationPK)
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	gi, err := svc.protocolClient.GroupInfo(ctx, &protocoltypes.GroupInfo_Request{GroupPK: gpk})
+	if err != nil {
+		return nil, errcode.ErrProtocolGetGroupInfo.Wrap(err)
+	}
+
+	group := gi.GetGroup()
+	archive := &keyescrow.Archive{
+		Version:        keyescrow.Version,
+		ConversationPK: enrollment.ConversationPK,
+		ExportedAt:     svc.clock.Now(),
+		Group: keyescrow.Group{
+			PublicKey:  group.GetPublicKey(),
+			Type:       group.GetGroupType().String(),
+			Secret:     group.GetSecret(),
+			SecretSig:  group.GetSecretSig(),
+			SignPub:    group.GetSignPub(),
+			LinkKey:    group.GetLinkKey(),
+			LinkKeySig: group.GetLinkKeySig(),
+		},
+	}
+
+	list, err := svc.protocolClient.GroupMessageList(ctx, &protocoltypes.GroupMessageList_Request{GroupPK: gpk, UntilNow: true})
+	if err != nil {
+		return nil, errcode.ErrEventListMessage.Wrap(err)
+	}
+
+	for {
+		gme, err := list.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errcode.ErrEventListMessage.Wrap(err)
+		}
+
+		cid, err := ipfscid.Cast(gme.GetEventContext().GetID())
+		if err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+
+		archive.Messages = append(archive.Messages, keyescrow.Message{
+			CID:      cid.String(),
+			DevicePK: gme.GetHeaders().GetDevicePK(),
+			Counter:  gme.GetHeaders().GetCounter(),
+			Payload:  gme.GetMessage(),
+		})
+	}
+
+	if err := keyescrow.Seal(w, archive, recipient); err != nil {
+		return nil, err
+	}
+
+	svc.recordAuditEvent(auditlog.EventKeyEscrowExported, map[string]string{
+		"conversation": enrollment.ConversationPK,
+		"recipient":    keyescrow.Fingerprint(recipient),
+		"messages":     fmt.Sprint(len(archive.Messages)),
+	})
+
+	return archive, nil
+}
@@ -17,7 +17,7 @@ func (s *service) monitorState(ctx context.Context) {
 		case lifecycle.StateActive:
 			s.logger.Info("current state", zap.String("state", "Active State"))
 		case lifecycle.StateInactive:
-			s.logger.Info("current state", zap.String("state", "Inactive State"))
+			s.logger.Info("current state", zap.String("state", "Inactive State"), zap.String("sync", string(s.inactiveSync)))
 		}
 
 		if !s.lcmanager.WaitForStateChange(ctx, currentState) {
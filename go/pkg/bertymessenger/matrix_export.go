@@ -0,0 +1,141 @@
+package bertymessenger
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"berty.tech/berty/v2/go/internal/matrixexport"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// MatrixExporter exports the history of a conversation as Matrix room
+// events, see matrixexport.
+type MatrixExporter interface {
+	// ExportConversationToMatrix exports the text messages of the
+	// conversation with the public key publicKey, or of the conversation
+	// with the contact with this public key. The Matrix IDs are on the
+	// homeserver serverName, matrixexport.DefaultServerName when empty.
+	ExportConversationToMatrix(ctx context.Context, publicKey, serverName string) (*matrixexport.Export, error)
+}
+
+var _ MatrixExporter = (*service)(nil)
+
+// matrixExportPageSize is the number of interactions read at once from the
+// db.
+const matrixExportPageSize = 100
+
+func (svc *service) ExportConversationToMatrix(_ context.Context, publicKey, serverName string) (*matrixexport.Export, error) {
+	conv, contact, err := svc.conversationForExport(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := svc.db.GetAccount()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	roomName := conv.GetDisplayName()
+	if contact != nil {
+		roomName = contact.GetDisplayName()
+	}
+
+	export, err := matrixexport.New(conv.GetPublicKey(), roomName, serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := export.AddSender(account.GetPublicKey(), account.GetDisplayName(), true); err != nil {
+		return nil, err
+	}
+	if contact != nil {
+		if err := export.AddSender(contact.GetPublicKey(), contact.GetDisplayName(), false); err != nil {
+			return nil, err
+		}
+	}
+
+	messages := []*mt.Interaction(nil)
+	for cursor := ""; ; {
+		page, err := svc.db.GetInteractionsAfter(conv.GetPublicKey(), cursor, matrixExportPageSize, mt.SystemEvents_Excluded)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range page {
+			if i.GetType() == mt.AppMessage_TypeUserMessage {
+				messages = append(messages, i)
+			}
+		}
+
+		if len(page) < matrixExportPageSize {
+			break
+		}
+		cursor = page[len(page)-1].GetCID()
+	}
+
+	// the late messages are stored after the ones sent before them
+	sort.SliceStable(messages, func(a, b int) bool { return messages[a].GetSentDate() < messages[b].GetSentDate() })
+
+	for _, i := range messages {
+		payload, err := i.UnmarshalPayload()
+		if err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+
+		// the sender of a contact conversation is the contact, the other
+		// ones are keyed by member, or by device when the member is unknown
+		senderPK := account.GetPublicKey()
+		switch {
+		case i.GetIsMine():
+		case contact != nil:
+			senderPK = contact.GetPublicKey()
+		case i.GetMemberPublicKey() != "":
+			senderPK = i.GetMemberPublicKey()
+			if err := export.AddSender(senderPK, i.GetMember().GetDisplayName(), false); err != nil {
+				return nil, err
+			}
+		default:
+			senderPK = i.GetDevicePublicKey()
+			if err := export.AddSender(senderPK, "", false); err != nil {
+				return nil, err
+			}
+		}
+
+		body := payload.(*mt.AppMessage_UserMessage).GetBody()
+		if err := export.AddMessage(i.GetCID(), senderPK, time.UnixMilli(i.GetSentDate()), body, i.GetTargetCID()); err != nil {
+			return nil, err
+		}
+	}
+
+	return export, nil
+}
+
+// conversationForExport returns the conversation with the public key
+// publicKey, or the one of the contact with this public key, and its
+// contact for a contact conversation.
+func (svc *service) conversationForExport(publicKey string) (*mt.Conversation, *mt.Contact, error) {
+	conv, err := svc.db.GetConversationByPK(publicKey)
+	if err != nil {
+		contact, contactErr := svc.db.GetContactByPK(publicKey)
+		if contactErr != nil {
+			return nil, nil, errcode.ErrNotFound.Wrap(err)
+		}
+
+		if conv, err = svc.db.GetConversationByPK(contact.GetConversationPublicKey()); err != nil {
+			return nil, nil, errcode.ErrNotFound.Wrap(err)
+		}
+	}
+
+	if conv.GetType() != mt.Conversation_ContactType {
+		return conv, nil, nil
+	}
+
+	contact, err := svc.db.GetContactByPK(conv.GetContactPublicKey())
+	if err != nil {
+		return nil, nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	return conv, contact, nil
+}
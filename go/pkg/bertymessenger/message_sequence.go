@@ -0,0 +1,32 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	"berty.tech/berty/v2/go/internal/messagesequencer"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// MessageSequencer reports the messages not replicated yet, it is
+// implemented by the messenger service.
+type MessageSequencer interface {
+	// ConversationSequenceStatus returns the number of messages sent in the
+	// conversation and not received yet, detected from the gaps in the
+	// message counters of each device.
+	ConversationSequenceStatus(ctx context.Context, conversationPK string) (messagesequencer.Status, error)
+}
+
+var _ MessageSequencer = (*service)(nil)
+
+func (svc *service) ConversationSequenceStatus(ctx context.Context, conversationPK string) (messagesequencer.Status, error) {
+	if conversationPK == "" {
+		return messagesequencer.Status{}, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation is required"))
+	}
+
+	if _, err := svc.db.GetConversationByPK(conversationPK); err != nil {
+		return messagesequencer.Status{}, err
+	}
+
+	return svc.sequencer.Status(ctx, conversationPK)
+}
@@ -0,0 +1,37 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/internal/netusage"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) NetworkUsage(context.Context, *messengertypes.NetworkUsage_Request) (*messengertypes.NetworkUsage_Reply, error) {
+	if svc.netUsage == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("the network usage is not accounted"))
+	}
+
+	usage := svc.netUsage.Usage()
+	reply := &messengertypes.NetworkUsage_Reply{
+		SinceDate:     messengerutil.TimestampMs(usage.Since),
+		Total:         networkStatsToProto(usage.Total),
+		Transports:    make(map[string]*messengertypes.NetworkUsage_Stats, len(usage.Transports)),
+		Conversations: make(map[string]*messengertypes.NetworkUsage_Stats, len(usage.Groups)),
+	}
+	for transport, stats := range usage.Transports {
+		reply.Transports[transport] = networkStatsToProto(stats)
+	}
+	for groupPK, stats := range usage.Groups {
+		reply.Conversations[groupPK] = networkStatsToProto(stats)
+	}
+
+	return reply, nil
+}
+
+func networkStatsToProto(stats netusage.Stats) *messengertypes.NetworkUsage_Stats {
+	return &messengertypes.NetworkUsage_Stats{BytesSent: stats.BytesSent, BytesReceived: stats.BytesReceived}
+}
@@ -0,0 +1,66 @@
+package bertymessenger
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/netusage"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+type testNetworkSource struct {
+	mu     sync.Mutex
+	totals map[string]netusage.PeerTotals
+}
+
+func (s *testNetworkSource) BandwidthByPeer() map[string]netusage.PeerTotals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := make(map[string]netusage.PeerTotals, len(s.totals))
+	for peerID, t := range s.totals {
+		totals[peerID] = t
+	}
+	return totals
+}
+
+func (s *testNetworkSource) Transport(string) string {
+	return netusage.TransportTCP
+}
+
+func TestNetworkUsage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	_, err := ts.Client.NetworkUsage(ctx, &messengertypes.NetworkUsage_Request{})
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+
+	source := &testNetworkSource{totals: map[string]netusage.PeerTotals{}}
+	counter := netusage.New(source)
+	counter.Associate("p1", "c1")
+	ts.Service.(*service).netUsage = counter
+
+	source.mu.Lock()
+	source.totals["p1"] = netusage.PeerTotals{In: 50, Out: 10}
+	source.mu.Unlock()
+
+	usage, err := ts.Client.NetworkUsage(ctx, &messengertypes.NetworkUsage_Request{})
+	require.NoError(t, err)
+	require.NotZero(t, usage.SinceDate)
+
+	expected := &messengertypes.NetworkUsage_Stats{BytesSent: 10, BytesReceived: 50}
+	require.Equal(t, expected, usage.Total)
+	require.Equal(t, map[string]*messengertypes.NetworkUsage_Stats{netusage.TransportTCP: expected}, usage.Transports)
+	require.Equal(t, map[string]*messengertypes.NetworkUsage_Stats{"c1": expected}, usage.Conversations)
+}
@@ -0,0 +1,179 @@
+package bertymessenger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
+	"github.com/golang/protobuf/proto"
+	ipfscid "github.com/ipfs/go-cid"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+const (
+	defaultPingTimeout = 30 * time.Second
+	pingNonceSize      = 16
+)
+
+type pong struct {
+	devicePK  []byte
+	arrivedAt time.Time
+}
+
+// peerTransport is the connection of a group device, from its status.
+type peerTransport struct {
+	peerID    string
+	transport string
+}
+
+func (svc *service) PingContact(ctx context.Context, req *mt.PingContact_Request) (*mt.PingContact_Reply, error) {
+	if req.ContactPublicKey == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	contact, err := svc.db.GetContactByPK(req.ContactPublicKey)
+	if err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	if contact.GetState() != mt.Contact_Accepted {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("contact request not accepted yet"))
+	}
+
+	gpk, err := messengerutil.B64DecodeBytes(contact.GetConversationPublicKey())
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	// learn the transports used by the contact devices
+	if svc.isGroupMonitorEnabled {
+		_ = svc.monitorGroupPeersStatus(contact.GetConversationPublicKey())
+	}
+
+	nonce := make([]byte, pingNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errcode.ErrCryptoRandomGeneration.Wrap(err)
+	}
+
+	pongs := make(chan pong, 1)
+	key := hex.EncodeToString(nonce)
+
+	svc.muPings.Lock()
+	svc.pings[key] = pongs
+	svc.muPings.Unlock()
+
+	defer func() {
+		svc.muPings.Lock()
+		delete(svc.pings, key)
+		svc.muPings.Unlock()
+	}()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultPingTimeout)
+		defer cancel()
+	}
+
+	am, err := mt.AppMessage_TypePing.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", &mt.AppMessage_Ping{Nonce: nonce})
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	sentAt := svc.clock.Now()
+	if _, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpk, Payload: am}); err != nil {
+		return nil, errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, errcode.TODO.Wrap(fmt.Errorf("no pong received: %w", ctx.Err()))
+
+	case p := <-pongs:
+		devicePK := messengerutil.B64EncodeBytes(p.devicePK)
+
+		transport := "unknown"
+		svc.muKnownPeers.Lock()
+		if pt, ok := svc.peerTransports[devicePK]; ok {
+			transport = pt.transport
+		}
+		svc.muKnownPeers.Unlock()
+
+		return &mt.PingContact_Reply{
+			RoundTrip:       p.arrivedAt.Sub(sentAt).Milliseconds(),
+			DevicePublicKey: devicePK,
+			Transport:       transport,
+		}, nil
+	}
+}
+
+// handlePingMessage answers the pings of contacts and hands the pongs to the
+// pending PingContact calls, it returns false for other messages.
+func (svc *service) handlePingMessage(gpkb []byte, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) bool {
+	switch am.GetType() {
+	case mt.AppMessage_TypePing:
+		ping := &mt.AppMessage_Ping{}
+		if err := proto.Unmarshal(am.GetPayload(), ping); err != nil {
+			return true
+		}
+
+		svc.muPings.Lock()
+		_, own := svc.pings[hex.EncodeToString(ping.GetNonce())]
+		svc.muPings.Unlock()
+
+		if own || len(ping.GetNonce()) != pingNonceSize {
+			return true
+		}
+
+		conv, err := svc.db.GetConversationByPK(messengerutil.B64EncodeBytes(gpkb))
+		if err != nil || conv.GetType() != mt.Conversation_ContactType {
+			return true
+		}
+
+		cid, err := ipfscid.Cast(gme.GetEventContext().GetID())
+		if err != nil {
+			return true
+		}
+
+		go func() {
+			reply, err := mt.AppMessage_TypePong.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), cid.String(), &mt.AppMessage_Pong{Nonce: ping.GetNonce()})
+			if err == nil {
+				_, err = svc.protocolClient.AppMessageSend(svc.ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: reply})
+			}
+
+			if err != nil {
+				svc.logger.Warn("unable to answer ping", zap.Error(err))
+			}
+		}()
+
+		return true
+
+	case mt.AppMessage_TypePong:
+		p := &mt.AppMessage_Pong{}
+		if err := proto.Unmarshal(am.GetPayload(), p); err != nil {
+			return true
+		}
+
+		svc.muPings.Lock()
+		pongs, ok := svc.pings[hex.EncodeToString(p.GetNonce())]
+		svc.muPings.Unlock()
+
+		if ok {
+			select {
+			case pongs <- pong{devicePK: gme.GetHeaders().GetDevicePK(), arrivedAt: svc.clock.Now()}:
+			default: // another device answered first
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,61 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestPingContact(t *testing.T) {
+	testutil.FilterStabilityAndSpeed(t, testutil.Stable, testutil.Slow)
+
+	ctx, nodes, logger, clean := Testing1To1ProcessWholeStream(t)
+	defer clean()
+	user := nodes[0]
+	friend := nodes[1]
+
+	friendPK := friend.GetAccount().GetPublicKey()
+	require.Eventually(t, func() bool {
+		return user.GetAllContacts()[friendPK].GetState() == messengertypes.Contact_Accepted
+	}, 5*time.Second, 100*time.Millisecond)
+	friendAsContact := user.GetContact(t, friendPK)
+
+	logger.Info("pinging the friend")
+	{
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		ret, err := user.client.PingContact(pingCtx, &messengertypes.PingContact_Request{ContactPublicKey: friendPK})
+		require.NoError(t, err)
+		require.NotEmpty(t, ret.GetDevicePublicKey())
+		require.GreaterOrEqual(t, ret.GetRoundTrip(), int64(0))
+	}
+
+	// the friend stops listening to the contact group, the pings are never
+	// answered
+	gpk, err := messengerutil.B64DecodeBytes(friendAsContact.GetConversationPublicKey())
+	require.NoError(t, err)
+	_, err = friend.protocolClient.DeactivateGroup(ctx, &protocoltypes.DeactivateGroup_Request{GroupPK: gpk})
+	require.NoError(t, err)
+
+	logger.Info("pinging the unreachable friend")
+	{
+		pingCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		ret, err := user.client.PingContact(pingCtx, &messengertypes.PingContact_Request{ContactPublicKey: friendPK})
+		require.Error(t, err)
+		require.Nil(t, ret)
+	}
+
+	// unknown contacts cannot be pinged
+	_, err = user.client.PingContact(ctx, &messengertypes.PingContact_Request{ContactPublicKey: "unknown"})
+	require.Error(t, err)
+}
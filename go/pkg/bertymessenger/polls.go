@@ -0,0 +1,163 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/appmessage"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/logutil"
+)
+
+// PollBallot is a vote of a member of the conversation, see TallyPoll.
+type PollBallot struct {
+	// Voter identifies the member, or its device when the member is not
+	// known yet.
+	Voter string
+	// SentDate is the time of the vote in milliseconds.
+	SentDate int64
+	Vote     appmessage.PollVote
+}
+
+// PollResults are the counts of the votes of a poll, see the PollResults
+// RPC.
+type PollResults struct {
+	Poll appmessage.Poll
+	// Counts are the numbers of votes of each option.
+	Counts []int
+	// Voters is the number of members who voted.
+	Voters int
+	Closed bool
+}
+
+// TallyPoll counts the ballots of poll at now: the last ballot of a voter
+// before the close time replaces the previous ones, and the ballots with
+// choices the poll has not, or with several choices for a single choice
+// poll, are ignored.
+func TallyPoll(poll appmessage.Poll, ballots []PollBallot, now time.Time) *PollResults {
+	ballots = append([]PollBallot(nil), ballots...)
+	sort.SliceStable(ballots, func(i, j int) bool { return ballots[i].SentDate < ballots[j].SentDate })
+
+	last := map[string][]int{}
+	for _, b := range ballots {
+		if poll.ClosesAt > 0 && b.SentDate > poll.ClosesAt {
+			continue
+		}
+
+		if choices := pollChoices(poll, b.Vote); choices != nil {
+			last[b.Voter] = choices
+		}
+	}
+
+	results := &PollResults{
+		Poll:   poll,
+		Counts: make([]int, len(poll.Options)),
+		Voters: len(last),
+		Closed: poll.ClosesAt > 0 && now.UnixMilli() >= poll.ClosesAt,
+	}
+	for _, choices := range last {
+		for _, choice := range choices {
+			results.Counts[choice]++
+		}
+	}
+
+	return results
+}
+
+// pollChoices returns the distinct choices of a valid vote, nil otherwise.
+func pollChoices(poll appmessage.Poll, vote appmessage.PollVote) []int {
+	seen := map[int]bool{}
+	choices := []int(nil)
+	for _, choice := range vote.Choices {
+		if choice < 0 || choice >= len(poll.Options) {
+			return nil
+		}
+
+		if !seen[choice] {
+			seen[choice] = true
+			choices = append(choices, choice)
+		}
+	}
+
+	if len(choices) == 0 || (len(choices) > 1 && !poll.MultipleChoice) {
+		return nil
+	}
+
+	return choices
+}
+
+func (svc *service) PollResults(_ context.Context, req *messengertypes.PollResults_Request) (*messengertypes.PollResults_Reply, error) {
+	pollCID := req.PollCID
+	if pollCID == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a poll cid is required"))
+	}
+
+	interaction, err := svc.db.GetInteractionByCID(pollCID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, errcode.ErrNotFound.Wrap(err)
+	case err != nil:
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	poll, ok := appmessage.Poll{}, false
+	if interaction.GetType() == messengertypes.AppMessage_TypeUserMessage {
+		if m, err := appmessage.Unmarshal(interaction.GetPayload()); err == nil {
+			poll, ok = m.(appmessage.Poll)
+		}
+	}
+	if !ok {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("interaction %s is not a poll", pollCID))
+	}
+
+	answers, err := svc.db.GetUserMessagesTargeting(interaction.GetConversationPublicKey(), pollCID)
+	if err != nil {
+		return nil, err
+	}
+
+	ballots := []PollBallot(nil)
+	for _, answer := range answers {
+		m, err := appmessage.Unmarshal(answer.GetPayload())
+		if err != nil {
+			svc.logger.Warn("unable to decode a poll answer", zap.Error(err), logutil.PrivateString("cid", answer.GetCID()))
+			continue
+		}
+
+		vote, ok := m.(appmessage.PollVote)
+		if !ok {
+			continue
+		}
+
+		voter := answer.GetMemberPublicKey()
+		if voter == "" {
+			voter = answer.GetDevicePublicKey()
+		}
+		ballots = append(ballots, PollBallot{Voter: voter, SentDate: answer.GetSentDate(), Vote: vote})
+	}
+
+	results := TallyPoll(poll, ballots, svc.clock.Now())
+	reply := &messengertypes.PollResults_Reply{
+		PollCID: pollCID,
+		Poll: &messengertypes.Poll{
+			Question:       poll.Question,
+			Options:        poll.Options,
+			MultipleChoice: poll.MultipleChoice,
+			ClosesDate:     poll.ClosesAt,
+		},
+		Counts: make([]uint32, len(results.Counts)),
+		Voters: uint32(results.Voters),
+		Closed: results.Closed,
+	}
+	for i, count := range results.Counts {
+		reply.Counts[i] = uint32(count)
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,97 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/appmessage"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestTallyPoll(t *testing.T) {
+	poll := appmessage.Poll{Question: "lunch?", Options: []string{"pizza", "sushi", "salad"}}
+	vote := func(voter string, sentDate int64, choices ...int) PollBallot {
+		return PollBallot{Voter: voter, SentDate: sentDate, Vote: appmessage.PollVote{Choices: choices}}
+	}
+
+	ballots := []PollBallot{
+		vote("alice", 3, 1),
+		// replaced by the later vote of alice, whatever the order
+		vote("alice", 1, 0),
+		vote("bob", 2, 0),
+		// out of the options
+		vote("carol", 2, 3),
+		// several choices for a single choice poll
+		vote("dave", 2, 0, 1),
+	}
+
+	results := TallyPoll(poll, ballots, time.UnixMilli(10))
+	require.Equal(t, []int{1, 1, 0}, results.Counts)
+	require.Equal(t, 2, results.Voters)
+	require.False(t, results.Closed)
+
+	poll.MultipleChoice = true
+	results = TallyPoll(poll, append(ballots, vote("bob", 4, 2, 2, 1)), time.UnixMilli(10))
+	require.Equal(t, []int{1, 3, 1}, results.Counts)
+	require.Equal(t, 3, results.Voters)
+
+	// the votes sent after the close time are ignored
+	poll.ClosesAt = 2
+	results = TallyPoll(poll, ballots, time.UnixMilli(2))
+	require.Equal(t, []int{3, 1, 0}, results.Counts)
+	require.Equal(t, 3, results.Voters)
+	require.True(t, results.Closed)
+
+	results = TallyPoll(poll, nil, time.UnixMilli(1))
+	require.Equal(t, []int{0, 0, 0}, results.Counts)
+	require.False(t, results.Closed)
+}
+
+func TestPollResults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	conv, err := ts.Client.ConversationCreate(ctx, &messengertypes.ConversationCreate_Request{DisplayName: "conv"})
+	require.NoError(t, err)
+
+	req, err := appmessage.InteractRequest(conv.PublicKey, appmessage.Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}})
+	require.NoError(t, err)
+	poll, err := ts.Client.Interact(ctx, req)
+	require.NoError(t, err)
+
+	req, err = appmessage.InteractRequest(conv.PublicKey, appmessage.PollVote{Choices: []int{1}})
+	require.NoError(t, err)
+	req.TargetCID = poll.CID
+	_, err = ts.Client.Interact(ctx, req)
+	require.NoError(t, err)
+
+	var results *messengertypes.PollResults_Reply
+	require.Eventually(t, func() bool {
+		results, err = ts.Client.PollResults(ctx, &messengertypes.PollResults_Request{PollCID: poll.CID})
+		return err == nil && results.Voters == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.Equal(t, &messengertypes.PollResults_Reply{
+		PollCID: poll.CID,
+		Poll:    &messengertypes.Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}},
+		Counts:  []uint32{0, 1},
+		Voters:  1,
+	}, results)
+
+	_, err = ts.Client.PollResults(ctx, &messengertypes.PollResults_Request{})
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+
+	_, err = ts.Client.PollResults(ctx, &messengertypes.PollResults_Request{PollCID: "unknown"})
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+}
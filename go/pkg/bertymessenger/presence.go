@@ -0,0 +1,178 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/logutil"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// Presence is the availability of the account shown to its contacts.
+type Presence string
+
+const (
+	// PresenceActive is the presence of an account in use, it is assumed
+	// until the contact says otherwise.
+	PresenceActive Presence = "active"
+
+	// PresenceAway is the presence of an account whose user is not around,
+	// e.g. after a while without keyboard input.
+	PresenceAway Presence = "away"
+)
+
+func (p Presence) status() mt.AppMessage_Presence_Status {
+	switch p {
+	case PresenceActive:
+		return mt.AppMessage_Presence_Active
+	case PresenceAway:
+		return mt.AppMessage_Presence_Away
+	}
+
+	return mt.AppMessage_Presence_Undefined
+}
+
+// presenceFromStatus returns the presence of a received status, ok is false
+// when it is unknown, e.g. sent by a newer client.
+func presenceFromStatus(status mt.AppMessage_Presence_Status) (p Presence, ok bool) {
+	switch status {
+	case mt.AppMessage_Presence_Active:
+		return PresenceActive, true
+	case mt.AppMessage_Presence_Away:
+		return PresenceAway, true
+	}
+
+	return "", false
+}
+
+// ContactPresence is the last presence received from a contact.
+type ContactPresence struct {
+	Presence Presence
+	// Since is when the presence was sent.
+	Since time.Time
+}
+
+// PresencePublisher shares the presence of the account with its contacts,
+// it is implemented by the messenger service.
+type PresencePublisher interface {
+	// SetPresence sends the presence to the accepted contacts when it
+	// changes. The presence is not stored, the contacts assume the account
+	// is active after a restart until it is published again.
+	SetPresence(ctx context.Context, presence Presence) error
+
+	// ContactPresences returns the presences received from the contacts, by
+	// public key of the contact conversation.
+	ContactPresences() map[string]ContactPresence
+}
+
+var _ PresencePublisher = (*service)(nil)
+
+func (svc *service) SetPresence(ctx context.Context, presence Presence) error {
+	if presence != PresenceActive && presence != PresenceAway {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown presence %q", presence))
+	}
+
+	svc.muPresence.Lock()
+	changed := svc.presence != presence
+	svc.presence = presence
+	svc.muPresence.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	contacts, err := svc.db.GetContactsByState(mt.Contact_Accepted)
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	am, err := mt.AppMessage_TypePresence.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", &mt.AppMessage_Presence{Status: presence.status()})
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	// a contact unreachable for now must not prevent the others from
+	// knowing
+	var sendErr error
+	for _, contact := range contacts {
+		gpk, err := messengerutil.B64DecodeBytes(contact.GetConversationPublicKey())
+		if err != nil {
+			continue
+		}
+
+		if _, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpk, Payload: am}); err != nil {
+			svc.logger.Warn("unable to send presence", zap.Error(err), logutil.PrivateString("conversation", contact.GetConversationPublicKey()))
+			if sendErr == nil {
+				sendErr = errcode.ErrProtocolSend.Wrap(err)
+			}
+		}
+	}
+
+	return sendErr
+}
+
+func (svc *service) ContactPresences() map[string]ContactPresence {
+	svc.muPresence.Lock()
+	defer svc.muPresence.Unlock()
+
+	presences := make(map[string]ContactPresence, len(svc.contactPresences))
+	for conversationPK, p := range svc.contactPresences {
+		presences[conversationPK] = p
+	}
+
+	return presences
+}
+
+// handlePresenceMessage records the presences sent by the contacts, it
+// returns false for other messages.
+func (svc *service) handlePresenceMessage(gpkb []byte, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) bool {
+	if am.GetType() != mt.AppMessage_TypePresence {
+		return false
+	}
+
+	payload := mt.AppMessage_Presence{}
+	if err := proto.Unmarshal(am.GetPayload(), &payload); err != nil {
+		return true
+	}
+
+	presence, ok := presenceFromStatus(payload.GetStatus())
+	if !ok {
+		return true
+	}
+
+	gpk := messengerutil.B64EncodeBytes(gpkb)
+	conv, err := svc.db.GetConversationByPK(gpk)
+	if err != nil || conv.GetType() != mt.Conversation_ContactType {
+		return true
+	}
+
+	// the presences of the account are sent by its own devices too
+	dpk := messengerutil.B64EncodeBytes(gme.GetHeaders().GetDevicePK())
+	if dpk == conv.GetLocalDevicePublicKey() {
+		return true
+	}
+	if device, err := svc.db.GetDeviceByPK(dpk); err == nil && conv.GetLocalMemberPublicKey() != "" && device.GetMemberPublicKey() == conv.GetLocalMemberPublicKey() {
+		return true
+	}
+
+	since := time.UnixMilli(am.GetSentDate())
+
+	svc.muPresence.Lock()
+	defer svc.muPresence.Unlock()
+
+	// the messages of a group are not received in order
+	if last, ok := svc.contactPresences[gpk]; ok && last.Since.After(since) {
+		return true
+	}
+	svc.contactPresences[gpk] = ContactPresence{Presence: presence, Since: since}
+
+	return true
+}
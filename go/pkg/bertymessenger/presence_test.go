@@ -0,0 +1,57 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestHandlePresenceMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	svc := ts.Service.(*service)
+
+	gpkb := []byte("contact-group")
+	gpk := messengerutil.B64EncodeBytes(gpkb)
+	_, err := svc.db.AddConversationForContact(gpk, "own-member", "own-device", "contact")
+	require.NoError(t, err)
+
+	receive := func(sentDate int64, status messengertypes.AppMessage_Presence_Status) {
+		raw, err := messengertypes.AppMessage_TypePresence.MarshalPayload(sentDate, "", &messengertypes.AppMessage_Presence{Status: status})
+		require.NoError(t, err)
+
+		am := &messengertypes.AppMessage{}
+		require.NoError(t, am.Unmarshal(raw))
+
+		gme := &protocoltypes.GroupMessageEvent{Headers: &protocoltypes.MessageHeaders{DevicePK: []byte("contact-device")}}
+		require.True(t, svc.handlePresenceMessage(gpkb, gme, am))
+	}
+
+	receive(2000, messengertypes.AppMessage_Presence_Away)
+	require.Equal(t, ContactPresence{Presence: PresenceAway, Since: time.UnixMilli(2000)}, svc.ContactPresences()[gpk])
+
+	// the older presences and the unknown statuses are ignored
+	receive(1000, messengertypes.AppMessage_Presence_Active)
+	receive(3000, messengertypes.AppMessage_Presence_Undefined)
+	require.Equal(t, PresenceAway, svc.ContactPresences()[gpk].Presence)
+
+	receive(4000, messengertypes.AppMessage_Presence_Active)
+	require.Equal(t, PresenceActive, svc.ContactPresences()[gpk].Presence)
+
+	// the other messages are not handled
+	require.False(t, svc.handlePresenceMessage(gpkb, &protocoltypes.GroupMessageEvent{}, &messengertypes.AppMessage{Type: messengertypes.AppMessage_TypeUserMessage}))
+}
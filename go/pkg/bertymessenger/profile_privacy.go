@@ -0,0 +1,171 @@
+package bertymessenger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/pushtypes"
+)
+
+// ProfileHider keeps the profile of the account private, it is implemented
+// by the messenger service.
+type ProfileHider interface {
+	// HideProfile returns true while the display name of the account is not
+	// published.
+	HideProfile() bool
+	// SetHideProfile changes the setting for the account. The contact link
+	// of the account is updated, and the display name is sent again to the
+	// conversations when it is published again. A display name published
+	// before cannot be retracted from the contacts who received it.
+	SetHideProfile(ctx context.Context, hide bool) error
+}
+
+var _ ProfileHider = (*service)(nil)
+
+func (svc *service) HideProfile() bool {
+	return svc.profilePrivacy.HideProfile()
+}
+
+func (svc *service) SetHideProfile(ctx context.Context, hide bool) error {
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	if svc.profilePrivacy.HideProfile() == hide {
+		return nil
+	}
+
+	if err := svc.profilePrivacy.SetHideProfile(ctx, hide); err != nil {
+		return err
+	}
+
+	svc.logger.Info("profile privacy changed", zap.Bool("hide-profile", hide))
+
+	// the contact link embeds the display name
+	if err := svc.db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		acc, err := tx.GetAccount()
+		if err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		ret, err := svc.internalInstanceShareableBertyID(ctx, &mt.InstanceShareableBertyID_Request{DisplayName: acc.GetDisplayName()})
+		if err != nil {
+			return err
+		}
+
+		acc, err = tx.UpdateAccount(acc.PublicKey, ret.GetWebURL(), "")
+		if err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return svc.dispatcher.StreamEvent(mt.StreamEvent_TypeAccountUpdated, &mt.StreamEvent_AccountUpdated{Account: acc}, false)
+	}); err != nil {
+		return err
+	}
+
+	if hide {
+		return nil
+	}
+
+	convos, err := svc.db.GetAllConversations()
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	for _, conv := range convos {
+		if err := svc.sendAccountUserInfo(ctx, conv.GetPublicKey()); err != nil {
+			svc.logger.Error("SetHideProfile: send user info", zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// publishedDisplayName returns the display name of the account to send to
+// other accounts, it is empty while the profile is hidden.
+func (svc *service) publishedDisplayName(acc *mt.Account) string {
+	return svc.profilePrivacy.PublishedDisplayName(acc.GetDisplayName())
+}
+
+// PrivacySettings are the privacy toggles of the account, it is implemented
+// by the messenger service. The changes are saved for the account and apply
+// to the next messages.
+type PrivacySettings interface {
+	ProfileHider
+
+	// SendTypingIndicators returns true if the contacts can be told when a
+	// message is being typed.
+	SendTypingIndicators() bool
+	SetSendTypingIndicators(ctx context.Context, send bool) error
+
+	// SendReadReceipts returns true if the contacts can be told when their
+	// messages are read.
+	SendReadReceipts() bool
+	SetSendReadReceipts(ctx context.Context, send bool) error
+
+	// PushPayload returns what the pushes of the account carry. The level
+	// is sealed with the push token of the device, SetPushPayload shares it
+	// again in the conversations.
+	PushPayload() pushtypes.PayloadLevel
+	SetPushPayload(ctx context.Context, level pushtypes.PayloadLevel) error
+}
+
+var _ PrivacySettings = (*service)(nil)
+
+func (svc *service) SendTypingIndicators() bool {
+	return svc.profilePrivacy.SendTypingIndicators()
+}
+
+func (svc *service) SetSendTypingIndicators(ctx context.Context, send bool) error {
+	if err := svc.profilePrivacy.SetSendTypingIndicators(ctx, send); err != nil {
+		return err
+	}
+
+	svc.logger.Info("typing indicators privacy changed", zap.Bool("send-typing-indicators", send))
+	return nil
+}
+
+func (svc *service) SendReadReceipts() bool {
+	return svc.profilePrivacy.SendReadReceipts()
+}
+
+func (svc *service) SetSendReadReceipts(ctx context.Context, send bool) error {
+	if err := svc.profilePrivacy.SetSendReadReceipts(ctx, send); err != nil {
+		return err
+	}
+
+	svc.logger.Info("read receipts privacy changed", zap.Bool("send-read-receipts", send))
+	return nil
+}
+
+func (svc *service) PushPayload() pushtypes.PayloadLevel {
+	return svc.profilePrivacy.PushPayload()
+}
+
+func (svc *service) SetPushPayload(ctx context.Context, level pushtypes.PayloadLevel) error {
+	if svc.profilePrivacy.PushPayload() == level {
+		return nil
+	}
+
+	if err := svc.profilePrivacy.SetPushPayload(ctx, level); err != nil {
+		return err
+	}
+
+	svc.logger.Info("push payload privacy changed", zap.Stringer("push-payload", level))
+
+	convos, err := svc.db.GetAllConversations()
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	for _, conv := range convos {
+		if err := svc.pushShareMuteUpdate(ctx, conv); err != nil {
+			svc.logger.Error("SetPushPayload: share push token", zap.Error(err))
+		}
+	}
+
+	return nil
+}
@@ -275,7 +275,12 @@ func (svc *service) pushShareToken(ctx context.Context, conversation *messengert
 		Addr: pushServerRecord.ServerAddr,
 	}
 
-	memberToken, err := PushSealTokenForServer(pushReceiver, pushServer)
+	// the push server drops the pushes of the conversation while it is muted,
+	// and only pushes what the account wants them to carry
+	memberToken, err := PushSealTokenOptionsForServer(pushReceiver, pushServer, pushtypes.ReceiverOptions{
+		MutedUntil:   svc.conversationMutedUntil(conversation),
+		PayloadLevel: svc.profilePrivacy.PushPayload(),
+	})
 	if err != nil {
 		return errcode.ErrInternal.Wrap(err)
 	}
@@ -294,7 +299,7 @@ func (svc *service) pushShareToken(ctx context.Context, conversation *messengert
 		return errcode.ErrSerialization.Wrap(err)
 	}
 
-	am, err := messengertypes.AppMessage_TypePushSetMemberToken.MarshalPayload(messengerutil.TimestampMs(time.Now()), "", &messengertypes.AppMessage_PushSetMemberToken{MemberToken: memberToken})
+	am, err := messengertypes.AppMessage_TypePushSetMemberToken.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), "", &messengertypes.AppMessage_PushSetMemberToken{MemberToken: memberToken})
 	if err != nil {
 		return errcode.ErrSerialization.Wrap(err)
 	}
@@ -306,3 +311,63 @@ func (svc *service) pushShareToken(ctx context.Context, conversation *messengert
 
 	return nil
 }
+
+// conversationMutedUntil returns the mute deadline of the pushes of
+// conversation, the later of the mutes of the conversation and of the
+// account, or a zero time if neither is muted. The muted_until of the
+// conversations and of the account are in microseconds.
+func (svc *service) conversationMutedUntil(conversation *messengertypes.Conversation) time.Time {
+	mutedUntilMicro := conversation.MutedUntil
+	if account, err := svc.db.GetAccount(); err != nil {
+		svc.logger.Warn("unable to get the account mute", zap.Error(err))
+	} else if account.MutedUntil > mutedUntilMicro {
+		mutedUntilMicro = account.MutedUntil
+	}
+
+	if mutedUntilMicro <= 0 {
+		return time.Time{}
+	}
+
+	mutedUntil := time.UnixMicro(mutedUntilMicro)
+	if !mutedUntil.After(svc.clock.Now()) {
+		return time.Time{}
+	}
+
+	return mutedUntil
+}
+
+// pushShareMuteUpdate shares the push token of the device again in
+// conversation after its mute, the mute of the account or the push payload of
+// the account changed, the
+// other members replace the previous token of the device and the push
+// servers apply the new options. It does nothing if the device has no
+// push token.
+func (svc *service) pushShareMuteUpdate(ctx context.Context, conversation *messengertypes.Conversation) error {
+	accountPK := messengerutil.B64EncodeBytes(svc.accountGroup)
+
+	deviceToken, err := svc.db.GetPushDeviceToken(accountPK)
+	if errcode.Is(err, errcode.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	if deviceToken.TokenType == pushtypes.PushServiceTokenType_PushTokenUndefined || len(deviceToken.Token) == 0 {
+		return nil
+	}
+
+	pushServerRecords, err := svc.db.GetPushServerRecords(accountPK)
+	if errcode.Is(err, errcode.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	for _, pushServerRecord := range pushServerRecords {
+		if err := svc.pushShareToken(ctx, conversation, deviceToken, pushServerRecord); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
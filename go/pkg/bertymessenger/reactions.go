@@ -0,0 +1,139 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	ipfscid "github.com/ipfs/go-cid"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messagereactions"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+func (svc *service) SendReaction(ctx context.Context, req *mt.SendReaction_Request) (*mt.SendReaction_Reply, error) {
+	if svc.reactions == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("message reactions are not enabled"))
+	}
+
+	switch {
+	case req.ConversationPublicKey == "" || req.TargetCID == "" || req.Emoji == "":
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation, a message and an emoji are required"))
+	case len(req.Emoji) > messagereactions.MaxEmojiLength:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the emoji can't be longer than %d bytes", messagereactions.MaxEmojiLength))
+	}
+
+	if _, err := svc.db.GetConversationByPK(req.ConversationPublicKey); err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	gpkb, err := messengerutil.B64DecodeBytes(req.ConversationPublicKey)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	am, err := mt.AppMessage_TypeReaction.MarshalPayload(messengerutil.TimestampMs(svc.clock.Now()), req.TargetCID, &mt.AppMessage_Reaction{Emoji: req.Emoji, Removed: req.Removed})
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	reply, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: am})
+	if err != nil {
+		return nil, errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	cid, err := ipfscid.Cast(reply.GetCID())
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return &mt.SendReaction_Reply{CID: cid.String()}, nil
+}
+
+func (svc *service) ReactionsAggregate(ctx context.Context, req *mt.ReactionsAggregate_Request) (*mt.ReactionsAggregate_Reply, error) {
+	if svc.reactions == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("message reactions are not enabled"))
+	}
+
+	if req.ConversationPublicKey == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation is required"))
+	}
+
+	conv, err := svc.db.GetConversationByPK(req.ConversationPublicKey)
+	if err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	reply := &mt.ReactionsAggregate_Reply{}
+	for _, cid := range req.TargetCIDs {
+		counts, err := svc.reactions.Counts(ctx, req.ConversationPublicKey, cid)
+		if err != nil {
+			return nil, err
+		}
+		if len(counts) == 0 {
+			continue
+		}
+
+		reactions := &mt.MessageReactions{TargetCID: cid, Reactions: make([]*mt.ReactionCount, len(counts))}
+		for i, count := range counts {
+			reactions.Reactions[i] = &mt.ReactionCount{
+				Emoji:    count.Emoji,
+				Count:    uint32(len(count.Reactors)),
+				Reactors: count.Reactors,
+			}
+			for _, reactor := range count.Reactors {
+				if reactor == conv.GetLocalMemberPublicKey() {
+					reactions.Reactions[i].Own = true
+				}
+			}
+		}
+		reply.Reactions = append(reply.Reactions, reactions)
+	}
+
+	return reply, nil
+}
+
+// handleReactionMessage records the reactions received, it returns false for
+// other messages.
+func (svc *service) handleReactionMessage(gpkb []byte, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) bool {
+	if am.GetType() != mt.AppMessage_TypeReaction {
+		return false
+	}
+
+	if svc.reactions == nil || am.GetTargetCID() == "" {
+		return true
+	}
+
+	payload, err := am.UnmarshalPayload()
+	if err != nil {
+		svc.logger.Warn("unable to unmarshal the reaction", zap.Error(err))
+		return true
+	}
+	reaction := payload.(*mt.AppMessage_Reaction)
+
+	// the reactions of the account are received from its own devices too
+	reactor := svc.senderMember(gme)
+	if reactor == "" {
+		conv, err := svc.db.GetConversationByPK(messengerutil.B64EncodeBytes(gpkb))
+		if err != nil || conv.GetLocalDevicePublicKey() != messengerutil.B64EncodeBytes(gme.GetHeaders().GetDevicePK()) {
+			svc.logger.Debug("reaction from an unknown device ignored", logutil.PrivateString("cid", am.GetTargetCID()))
+			return true
+		}
+		reactor = conv.GetLocalMemberPublicKey()
+	}
+
+	if _, err := svc.reactions.Add(svc.ctx, messengerutil.B64EncodeBytes(gpkb), am.GetTargetCID(), &messagereactions.Reaction{
+		MemberPK: reactor,
+		Emoji:    reaction.GetEmoji(),
+		Removed:  reaction.GetRemoved(),
+		SentDate: am.GetSentDate(),
+	}); err != nil {
+		svc.logger.Warn("unable to record the reaction", zap.Error(err))
+	}
+
+	return true
+}
@@ -0,0 +1,81 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	datastore "github.com/ipfs/go-datastore"
+	ds_sync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/messagereactions"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestReactions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	ts.Service.(*service).reactions = messagereactions.New(ds_sync.MutexWrap(datastore.NewMapDatastore()))
+
+	conv, err := ts.Client.ConversationCreate(ctx, &messengertypes.ConversationCreate_Request{DisplayName: "conv"})
+	require.NoError(t, err)
+
+	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: "hello"})
+	require.NoError(t, err)
+
+	msg, err := ts.Client.Interact(ctx, &messengertypes.Interact_Request{
+		Type:                  messengertypes.AppMessage_TypeUserMessage,
+		Payload:               payload,
+		ConversationPublicKey: conv.PublicKey,
+	})
+	require.NoError(t, err)
+
+	_, err = ts.Client.SendReaction(ctx, &messengertypes.SendReaction_Request{ConversationPublicKey: conv.PublicKey, TargetCID: msg.CID, Emoji: "👍"})
+	require.NoError(t, err)
+
+	aggregate := func() *messengertypes.ReactionsAggregate_Reply {
+		ret, err := ts.Client.ReactionsAggregate(ctx, &messengertypes.ReactionsAggregate_Request{ConversationPublicKey: conv.PublicKey, TargetCIDs: []string{msg.CID, "unknown"}})
+		require.NoError(t, err)
+		return ret
+	}
+
+	require.Eventually(t, func() bool { return len(aggregate().Reactions) == 1 }, 5*time.Second, 50*time.Millisecond)
+	reactions := aggregate().Reactions[0]
+	require.Equal(t, msg.CID, reactions.TargetCID)
+	require.Len(t, reactions.Reactions, 1)
+	require.Equal(t, "👍", reactions.Reactions[0].Emoji)
+	require.Equal(t, uint32(1), reactions.Reactions[0].Count)
+	require.True(t, reactions.Reactions[0].Own)
+
+	_, err = ts.Client.SendReaction(ctx, &messengertypes.SendReaction_Request{ConversationPublicKey: conv.PublicKey, TargetCID: msg.CID, Emoji: "👍", Removed: true})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(aggregate().Reactions) == 0 }, 5*time.Second, 50*time.Millisecond)
+
+	_, err = ts.Client.SendReaction(ctx, &messengertypes.SendReaction_Request{ConversationPublicKey: conv.PublicKey, TargetCID: msg.CID})
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+}
+
+func TestReactionsNotEnabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	_, err := ts.Client.ReactionsAggregate(ctx, &messengertypes.ReactionsAggregate_Request{ConversationPublicKey: "c1"})
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+}
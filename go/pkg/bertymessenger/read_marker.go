@@ -0,0 +1,34 @@
+package bertymessenger
+
+import (
+	"context"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// ReadMarker marks the conversations as read, it is implemented by the
+// messenger service.
+type ReadMarker interface {
+	// MarkConversationRead resets the unread counter of a conversation. No
+	// read receipt is sent to the members yet, SendReadReceipts only stores
+	// the preference.
+	MarkConversationRead(ctx context.Context, conversationPK string) error
+}
+
+var _ ReadMarker = (*service)(nil)
+
+func (svc *service) MarkConversationRead(_ context.Context, conversationPK string) error {
+	conv, updated, err := svc.db.MarkConversationAsRead(conversationPK)
+	if err != nil {
+		return err
+	} else if !updated {
+		return nil
+	}
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
+		return errcode.TODO.Wrap(err)
+	}
+
+	return nil
+}
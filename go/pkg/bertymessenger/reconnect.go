@@ -0,0 +1,24 @@
+package bertymessenger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// reconnect is called when the network comes back, the scheduled messages
+// that failed are sent again without waiting for their backoff and the
+// replication servers are asked which messages they stored meanwhile.
+func (svc *service) reconnect(context.Context) {
+	if svc.scheduler != nil {
+		if err := svc.scheduler.RetryNow(svc.ctx); err != nil {
+			svc.logger.Warn("unable to retry the scheduled messages", zap.Error(err))
+		}
+	}
+
+	if svc.deliveryStatus != nil {
+		if err := svc.checkStoredMessages(svc.ctx); err != nil {
+			svc.logger.Warn("unable to check the stored messages", zap.Error(err))
+		}
+	}
+}
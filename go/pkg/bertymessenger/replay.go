@@ -12,6 +12,7 @@ import (
 	"berty.tech/berty/v2/go/internal/messengerdb"
 	"berty.tech/berty/v2/go/internal/messengerpayloads"
 	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/internal/msgchunk"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 	weshnet_errcode "berty.tech/weshnet/pkg/errcode"
@@ -21,11 +22,13 @@ import (
 
 func getEventsReplayerForDB(ctx context.Context, client protocoltypes.ProtocolServiceClient, log *zap.Logger) func(db *messengerdb.DBWrapper) error {
 	return func(db *messengerdb.DBWrapper) error {
-		return replayLogsToDB(ctx, client, db, log)
+		return replayLogsToDB(ctx, client, db, log, nil)
 	}
 }
 
-func replayLogsToDB(ctx context.Context, client protocoltypes.ProtocolServiceClient, wrappedDB *messengerdb.DBWrapper, log *zap.Logger) (err error) {
+// replayLogsToDB materializes the db from the logs of the groups of the
+// account, progress is optional, it is called after each replayed group.
+func replayLogsToDB(ctx context.Context, client protocoltypes.ProtocolServiceClient, wrappedDB *messengerdb.DBWrapper, log *zap.Logger, progress func(done, total int)) (err error) {
 	ctx, _, endSection := tyber.Section(ctx, log, "Replaying logs to database")
 	defer func() { endSection(err, "") }()
 
@@ -55,7 +58,12 @@ func replayLogsToDB(ctx context.Context, client protocoltypes.ProtocolServiceCli
 		return errcode.ErrDBRead.Wrap(err)
 	}
 
-	for _, conv := range convs {
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+	progress(0, len(convs))
+
+	for i, conv := range convs {
 		// Replay all other group metadata events
 		groupPK, err := messengerutil.B64DecodeBytes(conv.GetPublicKey())
 		if err != nil {
@@ -92,6 +100,8 @@ func replayLogsToDB(ctx context.Context, client protocoltypes.ProtocolServiceCli
 				return weshnet_errcode.ErrGroupDeactivate.Wrap(err)
 			}
 		}
+
+		progress(i+1, len(convs))
 	}
 
 	return nil
@@ -141,6 +151,9 @@ func processMessageList(groupPK []byte, handler *messengerpayloads.EventHandler,
 		return errcode.ErrEventListMessage.Wrap(err)
 	}
 
+	// the chunked messages are replayed once whole
+	chunks := msgchunk.NewReassembler(DefaultMaxChunkedMessageSize, msgchunk.DefaultTTL)
+
 	for {
 		if handler.Ctx().Err() != nil {
 			return errcode.ErrEventListMessage.Wrap(err)
@@ -158,6 +171,17 @@ func processMessageList(groupPK []byte, handler *messengerpayloads.EventHandler,
 			return errcode.ErrDeserialization.Wrap(err)
 		}
 
+		if appMsg.GetType() == messengertypes.AppMessage_TypeChunk {
+			gme, whole, err := reassembleChunk(chunks, groupPK, message, &appMsg)
+			if err != nil {
+				handler.Logger().Warn("dropped chunked message", zap.Error(err))
+				continue
+			} else if whole == nil {
+				continue
+			}
+			message, appMsg = gme, *whole
+		}
+
 		if err := handler.HandleAppMessage(groupPKStr, message, &appMsg); err != nil {
 			return errcode.TODO.Wrap(err)
 		}
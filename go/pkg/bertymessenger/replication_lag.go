@@ -0,0 +1,24 @@
+package bertymessenger
+
+import (
+	"time"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/weshnet/pkg/protocoltypes"
+)
+
+// observeReplicationLag records the lag of a message materialized from a
+// group, createdAt is the sent date set by its sender in milliseconds. The
+// messages of the local device are not replicated, they are ignored.
+func (svc *service) observeReplicationLag(gpkb []byte, gme *protocoltypes.GroupMessageEvent, createdAt int64) {
+	if svc.replicationLag == nil || createdAt == 0 {
+		return
+	}
+
+	gpk := messengerutil.B64EncodeBytes(gpkb)
+	if conv, err := svc.db.GetConversationByPK(gpk); err == nil && conv.GetLocalDevicePublicKey() == messengerutil.B64EncodeBytes(gme.GetHeaders().GetDevicePK()) {
+		return
+	}
+
+	svc.replicationLag.Observe(gpk, time.UnixMilli(createdAt), svc.clock.Now())
+}
@@ -0,0 +1,108 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messagescheduler"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) ScheduleInteraction(ctx context.Context, req *mt.ScheduleInteraction_Request) (*mt.ScheduleInteraction_Reply, error) {
+	if svc.scheduler == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("message scheduling is not enabled"))
+	}
+
+	interaction := req.GetInteraction()
+	if interaction.GetConversationPublicKey() == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation is required"))
+	}
+	if req.SendDate == 0 {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a send date is required"))
+	}
+
+	if _, err := svc.db.GetConversationByPK(interaction.GetConversationPublicKey()); err != nil {
+		return nil, err
+	}
+
+	payload, err := interaction.Marshal()
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	m, err := svc.scheduler.Schedule(ctx, interaction.GetConversationPublicKey(), payload, time.UnixMilli(req.SendDate))
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.ScheduleInteraction_Reply{Scheduled: scheduledToProto(m)}, nil
+}
+
+func (svc *service) ScheduledInteractions(ctx context.Context, req *mt.ScheduledInteractions_Request) (*mt.ScheduledInteractions_Reply, error) {
+	reply := &mt.ScheduledInteractions_Reply{}
+	if svc.scheduler == nil {
+		return reply, nil
+	}
+
+	messages, err := svc.scheduler.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range messages {
+		if req.ConversationPublicKey != "" && m.GroupPK != req.ConversationPublicKey {
+			continue
+		}
+
+		reply.Interactions = append(reply.Interactions, scheduledToProto(m))
+	}
+
+	return reply, nil
+}
+
+func (svc *service) CancelScheduledInteraction(ctx context.Context, req *mt.CancelScheduledInteraction_Request) (*mt.CancelScheduledInteraction_Reply, error) {
+	if svc.scheduler == nil {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown scheduled message %q", req.ID))
+	}
+
+	if err := svc.scheduler.Cancel(ctx, req.ID); err != nil {
+		return nil, err
+	}
+
+	return &mt.CancelScheduledInteraction_Reply{}, nil
+}
+
+func (svc *service) sendScheduledInteraction(ctx context.Context, m messagescheduler.Message) error {
+	req := &mt.Interact_Request{}
+	if err := req.Unmarshal(m.Payload); err != nil {
+		// retrying would not help
+		svc.logger.Error("dropping invalid scheduled interaction", zap.String("id", m.ID), zap.Error(err))
+		return nil
+	}
+
+	_, err := svc.Interact(ctx, req)
+	return err
+}
+
+func scheduledToProto(m messagescheduler.Message) *mt.ScheduledInteraction {
+	ret := &mt.ScheduledInteraction{
+		ID:                    m.ID,
+		ConversationPublicKey: m.GroupPK,
+		SendDate:              messengerutil.TimestampMs(m.SendAt),
+		DueDate:               messengerutil.TimestampMs(m.DueAt()),
+		Attempts:              uint32(m.Attempts),
+		LastError:             m.LastError,
+	}
+
+	interaction := &mt.Interact_Request{}
+	if err := interaction.Unmarshal(m.Payload); err == nil {
+		ret.Interaction = interaction
+	}
+
+	return ret
+}
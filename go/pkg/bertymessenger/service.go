@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
 	"github.com/golang/protobuf/proto"
 	ipfs_interface "github.com/ipfs/interface-go-ipfs-core"
@@ -21,13 +23,36 @@ import (
 	"moul.io/zapgorm2"
 	"moul.io/zapring"
 
+	"berty.tech/berty/v2/go/internal/accountquota"
+	"berty.tech/berty/v2/go/internal/attachmentstore"
+	"berty.tech/berty/v2/go/internal/auditlog"
+	"berty.tech/berty/v2/go/internal/cloudbackup"
+	"berty.tech/berty/v2/go/internal/contactspam"
+	"berty.tech/berty/v2/go/internal/contactthrottle"
 	"berty.tech/berty/v2/go/internal/dbfetcher"
+	"berty.tech/berty/v2/go/internal/deliverystatus"
+	"berty.tech/berty/v2/go/internal/eventjournal"
 	sqlite "berty.tech/berty/v2/go/internal/gorm-sqlcipher"
+	"berty.tech/berty/v2/go/internal/joinapproval"
+	"berty.tech/berty/v2/go/internal/keyescrow"
+	"berty.tech/berty/v2/go/internal/messagedrafts"
+	"berty.tech/berty/v2/go/internal/messagereactions"
+	"berty.tech/berty/v2/go/internal/messagescheduler"
+	"berty.tech/berty/v2/go/internal/messagesequencer"
 	"berty.tech/berty/v2/go/internal/messengerdb"
 	"berty.tech/berty/v2/go/internal/messengerpayloads"
 	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/internal/msgchunk"
+	"berty.tech/berty/v2/go/internal/namecontexts"
+	"berty.tech/berty/v2/go/internal/netusage"
 	"berty.tech/berty/v2/go/internal/notification"
+	"berty.tech/berty/v2/go/internal/profileprivacy"
+	"berty.tech/berty/v2/go/internal/reconnect"
+	"berty.tech/berty/v2/go/internal/replicationlag"
+	"berty.tech/berty/v2/go/internal/revokeddevices"
+	"berty.tech/berty/v2/go/internal/usagestats"
 	"berty.tech/berty/v2/go/pkg/bertypush"
+	"berty.tech/berty/v2/go/pkg/bertyshortlink"
 	"berty.tech/berty/v2/go/pkg/bertyversion"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
@@ -54,6 +79,7 @@ type service struct {
 	isGroupMonitorEnabled bool
 	protocolClient        protocoltypes.ProtocolServiceClient
 	startedAt             time.Time
+	clock                 clock.Clock
 	db                    *messengerdb.DBWrapper
 	dispatcher            *Dispatcher
 	cancelFn              func()
@@ -68,20 +94,63 @@ type service struct {
 	pushHandler           bertypush.PushHandler
 	pushClients           map[string]*grpc.ClientConn
 	muPushClients         sync.RWMutex
+	replicationClients    map[string]*grpc.ClientConn
+	muReplicationClients  sync.Mutex
 	tyberCleanup          func()
 	logFilePath           string
 	cancelGroupStatus     map[string] /*groupPK */ context.CancelFunc
 	muCancelGroupStatus   sync.Mutex
 	knownPeers            map[string] /* peer.ID */ protocoltypes.GroupDeviceStatus_Type
 	muKnownPeers          sync.Mutex
+	peerTransports        map[string] /* devicePK */ peerTransport
+	pings                 map[string] /* nonce */ chan pong
+	muPings               sync.Mutex
+	presence              Presence
+	contactPresences      map[string] /* conversationPK */ ContactPresence
+	muPresence            sync.Mutex
 	cancelSubsCtx         func()
 	subsCtx               context.Context
 	subsMutex             *sync.Mutex
 	groupsToSubTo         map[string]struct{}
+	inactiveSync          InactiveSync
+	pollInterval          time.Duration
+	suspendedGroups       map[string]struct{}
 	accountGroup          []byte
 	grpcInsecure          bool
 	dd                    debugCommand
 	authSession           atomic.Value
+	usageStats            *usagestats.Collector
+	attachments           *attachmentstore.Store
+	attachmentRetention   attachmentstore.Retention
+	transfers             chan struct{}
+	maxMessageSize        int
+	maxChunkedMessageSize int
+	chunks                *msgchunk.Reassembler
+	contactSpam           *contactspam.Scorer
+	contactThrottle       *contactthrottle.Throttle
+	profilePrivacy        *profileprivacy.Settings
+	nameContexts          *namecontexts.Store
+	scheduler             *messagescheduler.Scheduler
+	drafts                *messagedrafts.Store
+	reactions             *messagereactions.Store
+	joinApproval          *joinapproval.Store
+	joinHeld              map[string][]heldJoinMessage
+	muJoinHeld            sync.Mutex
+	keyEscrow             *keyescrow.Store
+	cloudBackup           *cloudbackup.Client
+	shortLinks            *bertyshortlink.Client
+	shortLinkKey          ed25519.PrivateKey
+	netUsage              *netusage.Counter
+	sequencer             *messagesequencer.Sequencer
+	replicationLag        *replicationlag.Recorder
+	deliveryStatus        *deliverystatus.Tracker
+	quota                 *accountquota.Enforcer
+	auditLog              *auditlog.Log
+	eventJournal          *eventjournal.Journal
+	captureCPUProfile     func(time.Duration) (string, error)
+	revokedDevices        *revokeddevices.Store
+	onDeviceRevoked       func()
+	revokedOnce           sync.Once
 
 	mt.UnimplementedMessengerServiceServer
 }
@@ -98,10 +167,177 @@ type Opts struct {
 	Ring                *zapring.Core
 	GRPCInsecureMode    bool
 
+	// UsageStats aggregates local usage counters, it is nil unless the user
+	// opted in.
+	UsageStats *usagestats.Collector
+
+	// AttachmentStore deduplicates attachments across the account
+	// conversations, its references are released when interactions are
+	// deleted.
+	AttachmentStore *attachmentstore.Store
+
+	// AttachmentRetention is the default retention of the attachments
+	// sent by the account, they are kept forever when zero.
+	AttachmentRetention attachmentstore.Retention
+
+	// AttachmentJanitorInterval is the time between two passes releasing
+	// the sent attachments whose retention is over,
+	// DefaultAttachmentJanitorInterval when zero.
+	AttachmentJanitorInterval time.Duration
+
+	// MaxAttachmentTransfers bounds the attachment uploads and downloads
+	// running at once, DefaultMaxAttachmentTransfers when zero.
+	MaxAttachmentTransfers int
+
+	// MaxMessageSize is the size of the largest app message sent at once,
+	// the larger ones are sent in chunks reassembled by the recipients,
+	// DefaultMaxMessageSize when zero.
+	MaxMessageSize int
+
+	// MaxChunkedMessageSize is the size of the largest app message sent or
+	// reassembled from chunks, DefaultMaxChunkedMessageSize when zero.
+	MaxChunkedMessageSize int
+
+	// ContactSpamScorer scores incoming contact requests and rejects the
+	// ones above the account threshold, requests are not scored when nil.
+	ContactSpamScorer *contactspam.Scorer
+
+	// ContactThrottle defers the contact requests received over its limit in
+	// a rendezvous epoch to a backlog, requests are not limited when nil.
+	ContactThrottle *contactthrottle.Throttle
+
+	// ProfilePrivacy keeps the display name of the account from being
+	// published, the profile is public and the setting is not saved when
+	// nil.
+	ProfilePrivacy *profileprivacy.Settings
+
+	// DisplayNameContexts gives the account a display name per context, the
+	// account has a single display name when nil.
+	DisplayNameContexts *namecontexts.Store
+
+	// MessageScheduler stores the interactions to send later, scheduling is
+	// disabled when nil.
+	MessageScheduler *messagescheduler.Scheduler
+
+	// MessageDrafts keeps the drafts of the conversations for the clients
+	// of the node, the draft service is disabled when nil.
+	MessageDrafts *messagedrafts.Store
+
+	// MessageReactions keeps the reactions to the messages of the
+	// conversations, the reactions are ignored when nil.
+	MessageReactions *messagereactions.Store
+
+	// JoinApproval keeps the groups whose new members wait for the approval
+	// of an admin, the approval mode is disabled when nil.
+	JoinApproval *joinapproval.Store
+
+	// KeyEscrow keeps the conversations opted in to the export of their
+	// key material to an escrow, the export is disabled when nil.
+	KeyEscrow *keyescrow.Store
+
+	// CloudBackup uploads encrypted snapshots of the account to a remote
+	// storage, the cloud backup service is disabled when nil.
+	CloudBackup *cloudbackup.Client
+
+	// CloudBackupInterval is the time between two scheduled snapshots,
+	// they are only uploaded on demand when zero.
+	CloudBackupInterval time.Duration
+
+	// CloudBackupKeep is the number of snapshots kept on the remote, every
+	// one is kept when zero.
+	CloudBackupKeep int
+
+	// ShortLinkRelay registers the invitation links for a short URL and
+	// resolves the short URLs given to ParseDeepLink, the short link
+	// service is disabled when nil.
+	ShortLinkRelay *bertyshortlink.Client
+
+	// ShortLinkKey signs the links registered with ShortLinkRelay, see
+	// bertyshortlink.LoadOrCreateKey.
+	ShortLinkKey ed25519.PrivateKey
+
+	// NetworkUsage attributes the traffic of the node to the groups of the
+	// peers seen by the group monitor, the usage service is disabled when
+	// nil.
+	NetworkUsage *netusage.Counter
+
+	// MessageSequencer tracks the message counters of the group devices to
+	// report the pending messages and order late arrivals, sent dates are
+	// used as is when nil.
+	MessageSequencer *messagesequencer.Sequencer
+
+	// ReplicationLag records the delay between the creation of the messages
+	// received from the groups and their materialization, the lag is not
+	// measured when nil.
+	ReplicationLag *replicationlag.Recorder
+
+	// AccountQuota bounds the size of the account on disk, the account is
+	// not bounded when its limit is zero.
+	AccountQuota AccountQuota
+
+	// DeliveryStatus records the messages acknowledged by the replication
+	// servers of their conversations, the messages are only sent or
+	// delivered when nil.
+	DeliveryStatus *deliverystatus.Tracker
+
+	// DeliveryStatusInterval is the time between two rounds of questions to
+	// the replication servers, it defaults to DefaultDeliveryStatusInterval.
+	DeliveryStatusInterval time.Duration
+
+	// Reconnect calls the messenger as soon as the network comes back, the
+	// pending deliveries then wait for their backoff when nil.
+	Reconnect *reconnect.Scheduler
+
+	// AuditLog records the security-relevant events of the account, they
+	// are not recorded when nil.
+	AuditLog *auditlog.Log
+
+	// EventJournal records the protocol events of the account for the
+	// clients replaying them after a downtime, the event journal service is
+	// disabled when nil.
+	EventJournal *eventjournal.Journal
+
+	// CaptureCPUProfile records a CPU profile of the node for the given
+	// duration and returns its path, the profiling service is disabled
+	// when nil.
+	CaptureCPUProfile func(time.Duration) (string, error)
+
+	// RevokedDevices keeps the revoked devices of the account, their
+	// messages to the account group are ignored. Revocations are only logged
+	// when nil.
+	RevokedDevices *revokeddevices.Store
+
+	// OnDeviceRevoked is called once when another device of the account
+	// revoked this one, after the user was notified. It is never called
+	// without RevokedDevices.
+	OnDeviceRevoked func()
+
+	// InactiveSync defines which groups stay synced while the app is
+	// inactive, InactiveSyncSuspend by default.
+	InactiveSync InactiveSync
+
+	// PollInterval is the time between two syncs in InactiveSyncPoll mode,
+	// DefaultPollInterval when zero.
+	PollInterval time.Duration
+
+	// ReplayLogs materializes the db again from the group logs even if its
+	// schema is up to date, e.g. after it was removed because it diverged
+	// from the logs.
+	ReplayLogs bool
+
+	// OnReplayProgress is optional, it is called after each group replayed
+	// with ReplayLogs.
+	OnReplayProgress func(done, total int)
+
 	// LogFilePath defines the location of the current session's log file.
 	//
 	// This variable is used by svc.TyberHostAttach.
 	LogFilePath string
+
+	// Clock dates the interactions and drives the timers and retries of the
+	// service, the system clock when nil. The db of the service uses it, the
+	// stores given in the other options keep their own, see their SetClock.
+	Clock clock.Clock
 }
 
 func (opts *Opts) applyDefaults() (func(), error) {
@@ -111,6 +347,26 @@ func (opts *Opts) applyDefaults() (func(), error) {
 		opts.Logger = zap.NewNop()
 	}
 
+	if opts.ProfilePrivacy == nil {
+		opts.ProfilePrivacy = profileprivacy.NewSettings(nil, profileprivacy.Config{})
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = clock.New()
+	}
+
+	if opts.ShortLinkRelay != nil && len(opts.ShortLinkKey) != ed25519.PrivateKeySize {
+		return cleanup, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a short link key is required with a short link relay"))
+	}
+
+	switch opts.InactiveSync {
+	case "":
+		opts.InactiveSync = InactiveSyncSuspend
+	case InactiveSyncSuspend, InactiveSyncLight, InactiveSyncPoll:
+	default:
+		return cleanup, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown inactive sync mode %q", opts.InactiveSync))
+	}
+
 	if opts.DB == nil {
 		opts.Logger.Warn("Messenger started without database, creating a volatile one in memory")
 		zapLogger := zapgorm2.New(opts.Logger.Named("gorm"))
@@ -129,6 +385,39 @@ func (opts *Opts) applyDefaults() (func(), error) {
 		opts.DB = db
 	}
 
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+
+	if opts.MaxAttachmentTransfers <= 0 {
+		opts.MaxAttachmentTransfers = DefaultMaxAttachmentTransfers
+	}
+
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = DefaultMaxMessageSize
+	} else if opts.MaxMessageSize < MinMaxMessageSize {
+		return cleanup, errcode.ErrInvalidInput.Wrap(fmt.Errorf("max message size of %d bytes below %d bytes", opts.MaxMessageSize, MinMaxMessageSize))
+	}
+
+	if opts.MaxChunkedMessageSize <= 0 {
+		opts.MaxChunkedMessageSize = DefaultMaxChunkedMessageSize
+	}
+	if opts.MaxChunkedMessageSize < opts.MaxMessageSize {
+		opts.MaxChunkedMessageSize = opts.MaxMessageSize
+	}
+
+	if opts.AttachmentJanitorInterval <= 0 {
+		opts.AttachmentJanitorInterval = DefaultAttachmentJanitorInterval
+	}
+
+	if opts.AccountQuota.CheckInterval <= 0 {
+		opts.AccountQuota.CheckInterval = accountquota.DefaultCheckInterval
+	}
+
+	if opts.DeliveryStatusInterval <= 0 {
+		opts.DeliveryStatusInterval = DefaultDeliveryStatusInterval
+	}
+
 	if opts.NotificationManager == nil {
 		opts.NotificationManager = notification.NewNoopManager()
 	}
@@ -185,12 +474,13 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 
 	ctx, cancel := context.WithCancel(context.Background())
 	db := messengerdb.NewDBWrapper(opts.DB, opts.Logger)
+	db.SetClock(opts.Clock)
 
 	if opts.StateBackup != nil {
 		tyber.LogStep(tyberCtx, opts.Logger, "Restoring db state")
 
 		if err := db.RestoreFromBackup(opts.StateBackup, func() error {
-			return replayLogsToDB(ctx, client, db, opts.Logger)
+			return replayLogsToDB(ctx, client, db, opts.Logger, nil)
 		}); err != nil {
 			cancel()
 			return nil, errcode.ErrDBWrite.Wrap(fmt.Errorf("unable to restore exported state: %w", err))
@@ -200,6 +490,15 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 		return nil, errcode.TODO.Wrap(fmt.Errorf("error during db init: %w", err))
 	}
 
+	if opts.ReplayLogs && opts.StateBackup == nil {
+		tyber.LogStep(tyberCtx, opts.Logger, "Rebuilding db from the group logs")
+
+		if err := replayLogsToDB(ctx, client, db, opts.Logger, opts.OnReplayProgress); err != nil {
+			cancel()
+			return nil, errcode.ErrDBReplay.Wrap(err)
+		}
+	}
+
 	tyber.LogStep(tyberCtx, opts.Logger, "Database initialization succeeded")
 
 	cancel()
@@ -228,7 +527,8 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 		protocolClient:        client,
 		logger:                opts.Logger,
 		isGroupMonitorEnabled: opts.EnableGroupMonitor,
-		startedAt:             time.Now(),
+		startedAt:             opts.Clock.Now(),
+		clock:                 opts.Clock,
 		db:                    db,
 		notifmanager:          opts.NotificationManager,
 		lcmanager:             opts.LifeCycleManager,
@@ -241,11 +541,57 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 		logFilePath:           opts.LogFilePath,
 		cancelGroupStatus:     make(map[string] /* groupPK */ context.CancelFunc),
 		knownPeers:            make(map[string] /* peer.ID */ protocoltypes.GroupDeviceStatus_Type),
+		peerTransports:        make(map[string] /* devicePK */ peerTransport),
+		pings:                 make(map[string] /* nonce */ chan pong),
+		presence:              PresenceActive,
+		contactPresences:      make(map[string] /* conversationPK */ ContactPresence),
 		subsMutex:             &sync.Mutex{},
 		groupsToSubTo:         make(map[string]struct{}),
+		inactiveSync:          opts.InactiveSync,
+		pollInterval:          opts.PollInterval,
 		accountGroup:          icr.GetAccountGroupPK(),
 		grpcInsecure:          opts.GRPCInsecureMode,
 		pushClients:           make(map[string]*grpc.ClientConn),
+		replicationClients:    make(map[string]*grpc.ClientConn),
+		usageStats:            opts.UsageStats,
+		auditLog:              opts.AuditLog,
+		eventJournal:          opts.EventJournal,
+		captureCPUProfile:     opts.CaptureCPUProfile,
+		attachments:           opts.AttachmentStore,
+		attachmentRetention:   opts.AttachmentRetention,
+		transfers:             make(chan struct{}, opts.MaxAttachmentTransfers),
+		maxMessageSize:        opts.MaxMessageSize,
+		maxChunkedMessageSize: opts.MaxChunkedMessageSize,
+		chunks:                msgchunk.NewReassembler(opts.MaxChunkedMessageSize, msgchunk.DefaultTTL),
+		contactSpam:           opts.ContactSpamScorer,
+		contactThrottle:       opts.ContactThrottle,
+		profilePrivacy:        opts.ProfilePrivacy,
+		nameContexts:          opts.DisplayNameContexts,
+		scheduler:             opts.MessageScheduler,
+		drafts:                opts.MessageDrafts,
+		reactions:             opts.MessageReactions,
+		joinApproval:          opts.JoinApproval,
+		joinHeld:              make(map[string][]heldJoinMessage),
+		keyEscrow:             opts.KeyEscrow,
+		cloudBackup:           opts.CloudBackup,
+		shortLinks:            opts.ShortLinkRelay,
+		shortLinkKey:          opts.ShortLinkKey,
+		netUsage:              opts.NetworkUsage,
+		sequencer:             opts.MessageSequencer,
+		replicationLag:        opts.ReplicationLag,
+		deliveryStatus:        opts.DeliveryStatus,
+		revokedDevices:        opts.RevokedDevices,
+		onDeviceRevoked:       opts.OnDeviceRevoked,
+	}
+
+	if svc.attachments != nil {
+		db.OnInteractionsDeleted(svc.releaseAttachments)
+		db.OnInteractionAcknowledged(svc.acknowledgeAttachment)
+	}
+
+	if svc.quota, err = svc.newAccountQuota(opts.AccountQuota); err != nil {
+		cancel()
+		return nil, err
 	}
 
 	svc.eventHandler = messengerpayloads.NewEventHandler(ctx, db, &MetaFetcherFromProtocolClient{client: client}, newPostActionsService(&svc), opts.Logger, svc.dispatcher, false)
@@ -286,6 +632,7 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 			tyber.LogStep(tyberCtx, opts.Logger, "Found account", tyber.WithDetail("PublicKey", pkStr))
 		}
 	}
+	svc.recordAuditEvent(auditlog.EventAccountOpened, map[string]string{"account": pkStr})
 
 	// monitor messenger lifecycle
 	go svc.monitorState(ctx)
@@ -379,10 +726,44 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 
 	go svc.manageSubscriptions()
 
+	// the conversations are active, missed messages can be sent
+	if svc.scheduler != nil {
+		go svc.scheduler.Run(ctx, svc.sendScheduledInteraction)
+	}
+
+	if svc.attachments != nil {
+		go svc.runAttachmentJanitor(ctx, opts.AttachmentJanitorInterval)
+	}
+
+	if svc.quota != nil {
+		go svc.runAccountQuota(ctx, opts.AccountQuota.CheckInterval)
+	}
+
+	if svc.deliveryStatus != nil {
+		go svc.runDeliveryStatus(ctx, opts.DeliveryStatusInterval)
+	}
+
+	if svc.cloudBackup != nil && opts.CloudBackupInterval > 0 {
+		go svc.runCloudBackups(ctx, opts.CloudBackupInterval, opts.CloudBackupKeep)
+	}
+
+	if opts.Reconnect != nil {
+		unregister := opts.Reconnect.Register("messenger", svc.reconnect)
+		go func() {
+			<-ctx.Done()
+			unregister()
+		}()
+	}
+
 	return &svc, nil
 }
 
 func (svc *service) sendAccountUserInfo(ctx context.Context, groupPK string) (err error) {
+	if svc.profilePrivacy.HideProfile() {
+		svc.logger.Debug("profile hidden, not sending account info", logutil.PrivateString("group", groupPK))
+		return nil
+	}
+
 	ctx, _, endSection := tyber.Section(ctx, svc.logger, fmt.Sprintf("Sending account info to group %s", groupPK))
 	defer func() {
 		if err != nil {
@@ -401,9 +782,9 @@ func (svc *service) sendAccountUserInfo(ctx context.Context, groupPK string) (er
 	}
 
 	am, err := mt.AppMessage_TypeSetUserInfo.MarshalPayload(
-		messengerutil.TimestampMs(time.Now()),
+		messengerutil.TimestampMs(svc.clock.Now()),
 		"",
-		&mt.AppMessage_SetUserInfo{DisplayName: acc.GetDisplayName()},
+		&mt.AppMessage_SetUserInfo{DisplayName: svc.contextDisplayName(groupPK, acc.GetDisplayName())},
 	)
 	if err != nil {
 		return errcode.ErrSerialization.Wrap(err)
@@ -439,8 +820,11 @@ func (svc *service) ActivateGroup(groupPK []byte) error {
 	// mark group
 	svc.groupsToSubTo[messengerutil.B64EncodeBytes(groupPK)] = struct{}{}
 
-	// subscribe to group if app is active
-	if svc.subsCtx != nil {
+	// subscribe to group if app is active, the groups joined while
+	// inactive are synced on resume
+	if svc.suspendedGroups != nil && svc.suspendedWhileInactive(messengerutil.B64EncodeBytes(groupPK)) {
+		svc.suspendedGroups[messengerutil.B64EncodeBytes(groupPK)] = struct{}{}
+	} else if svc.subsCtx != nil {
 		if err := svc.subscribeToGroup(svc.subsCtx, svc.ctx, groupPK); err != nil {
 			return err
 		}
@@ -511,3 +895,17 @@ func (svc *MetaFetcherFromProtocolClient) GroupPKForContact(ctx context.Context,
 
 	return groupInfoReply.GetGroup().GetPublicKey(), nil
 }
+
+// releaseAttachments drops the attachment references held by deleted
+// interactions.
+func (svc *service) releaseAttachments(cids []string) {
+	removed, err := svc.attachments.Release(svc.ctx, cids...)
+	if err != nil {
+		svc.logger.Warn("unable to release attachments", zap.Error(err))
+		return
+	}
+
+	if len(removed) > 0 {
+		svc.logger.Debug("unreferenced attachments removed", zap.Int("count", len(removed)))
+	}
+}
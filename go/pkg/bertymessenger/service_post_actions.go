@@ -3,10 +3,13 @@ package bertymessenger
 import (
 	"go.uber.org/zap"
 
+	"berty.tech/berty/v2/go/internal/auditlog"
+	"berty.tech/berty/v2/go/internal/contactspam"
 	"berty.tech/berty/v2/go/internal/messengerutil"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 	"berty.tech/weshnet/pkg/logutil"
+	"berty.tech/weshnet/pkg/protocoltypes"
 	"berty.tech/weshnet/pkg/tyber"
 )
 
@@ -93,3 +96,41 @@ func (p *serviceEventHandlerPostActions) PushServerOrTokenRegistered(account *me
 
 	return p.svc.pushDeviceTokenBroadcast(p.svc.ctx)
 }
+
+func (p *serviceEventHandlerPostActions) ContactRequestReceived(contact *messengertypes.Contact) (bool, error) {
+	if p.svc.contactSpam == nil {
+		return p.svc.throttleContactRequest(contact), nil
+	}
+
+	score := p.svc.contactSpam.Score(contactspam.Request{
+		ContactPK:   contact.PublicKey,
+		DisplayName: contact.DisplayName,
+		ReceivedAt:  p.svc.clock.Now(),
+	})
+	p.svc.logger.Info("contact request scored", logutil.PrivateString("contact-pk", contact.PublicKey), zap.Stringer("score", score))
+
+	// the rejected requests are not counted in the limit of the epoch
+	if !p.svc.contactSpam.ShouldReject(score) {
+		return p.svc.throttleContactRequest(contact), nil
+	}
+
+	contactPKB, err := messengerutil.B64DecodeBytes(contact.PublicKey)
+	if err != nil {
+		return true, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if _, err := p.svc.protocolClient.ContactRequestDiscard(p.svc.ctx, &protocoltypes.ContactRequestDiscard_Request{ContactPK: contactPKB}); err != nil {
+		return true, errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	p.svc.logger.Info("contact request rejected automatically", logutil.PrivateString("contact-pk", contact.PublicKey))
+
+	return false, nil
+}
+
+func (p *serviceEventHandlerPostActions) DeviceLinked(device *messengertypes.Device) error {
+	p.svc.logger.Info("device linked to the account", logutil.PrivateString("device-pk", device.GetPublicKey()))
+	p.svc.recordAuditEvent(auditlog.EventDeviceLinked, map[string]string{"device": device.GetPublicKey()})
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/bertylinks"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) ShortLinkRegister(ctx context.Context, req *messengertypes.ShortLinkRegister_Request) (*messengertypes.ShortLinkRegister_Reply, error) {
+	if svc.shortLinks == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("no short link relay configured"))
+	}
+
+	if req.Link == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a link is required"))
+	}
+
+	// only the links the app can open are shortened, encrypted ones stay
+	// encrypted
+	if _, err := bertylinks.UnmarshalLink(req.Link, nil); err != nil {
+		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(err)
+	}
+
+	shortURL, err := svc.shortLinks.Register(ctx, req.Link, svc.shortLinkKey, time.Duration(req.TTL)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	return &messengertypes.ShortLinkRegister_Reply{ShortURL: shortURL}, nil
+}
+
+func (svc *service) ShortLinkDelete(ctx context.Context, req *messengertypes.ShortLinkDelete_Request) (*messengertypes.ShortLinkDelete_Reply, error) {
+	if svc.shortLinks == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("no short link relay configured"))
+	}
+
+	if req.ShortURL == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a short url is required"))
+	}
+
+	if err := svc.shortLinks.Delete(ctx, req.ShortURL, svc.shortLinkKey); err != nil {
+		return nil, err
+	}
+
+	return &messengertypes.ShortLinkDelete_Reply{}, nil
+}
+
+// resolveShortLink returns the internal link of a short URL of the relay,
+// other links are returned as is.
+func (svc *service) resolveShortLink(ctx context.Context, link string) (string, error) {
+	if svc.shortLinks == nil {
+		return link, nil
+	}
+
+	if _, ok := svc.shortLinks.Code(link); !ok {
+		return link, nil
+	}
+
+	e, err := svc.shortLinks.Resolve(ctx, link)
+	if err != nil {
+		return "", err
+	}
+
+	return e.Link, nil
+}
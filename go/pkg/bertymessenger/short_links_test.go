@@ -0,0 +1,106 @@
+package bertymessenger
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/bertyshortlink"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func newTestShortLinkRelay(t *testing.T) *bertyshortlink.Client {
+	t.Helper()
+
+	hs := httptest.NewUnstartedServer(nil)
+	relay, err := bertyshortlink.NewServer(dssync.MutexWrap(datastore.NewMapDatastore()), bertyshortlink.ServerOpts{PublicURL: "http://" + hs.Listener.Addr().String()})
+	require.NoError(t, err)
+	hs.Config.Handler = relay
+	hs.Start()
+	t.Cleanup(hs.Close)
+
+	shortLinks, err := bertyshortlink.NewClient(hs.URL, hs.Client())
+	require.NoError(t, err)
+
+	return shortLinks
+}
+
+func TestShortLinks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	_, err := ts.Client.ShortLinkRegister(ctx, &messengertypes.ShortLinkRegister_Request{Link: "BERTY://PB/2D9OS-Q5CFG4RF-AD0XWQ"})
+	require.True(t, errcode.Is(err, errcode.ErrNotImplemented))
+
+	key, err := bertyshortlink.GenerateKey()
+	require.NoError(t, err)
+
+	svc := ts.Service.(*service)
+	svc.shortLinks, svc.shortLinkKey = newTestShortLinkRelay(t), key
+
+	reply, err := ts.Client.ShortLinkRegister(ctx, &messengertypes.ShortLinkRegister_Request{
+		Link: "BERTY://PB/2D9OS-Q5CFG4RF-AD0XWQ",
+		TTL:  time.Hour.Milliseconds(),
+	})
+	require.NoError(t, err)
+
+	link, err := svc.resolveShortLink(ctx, reply.ShortURL)
+	require.NoError(t, err)
+	require.Equal(t, "BERTY://PB/2D9OS-Q5CFG4RF-AD0XWQ", link)
+
+	_, err = ts.Client.ShortLinkDelete(ctx, &messengertypes.ShortLinkDelete_Request{ShortURL: reply.ShortURL})
+	require.NoError(t, err)
+	_, err = svc.resolveShortLink(ctx, reply.ShortURL)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	_, err = ts.Client.ShortLinkRegister(ctx, &messengertypes.ShortLinkRegister_Request{})
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+
+	_, err = ts.Client.ShortLinkRegister(ctx, &messengertypes.ShortLinkRegister_Request{Link: "https://example.com"})
+	require.True(t, errcode.Is(err, errcode.ErrMessengerInvalidDeepLink))
+}
+
+func TestResolveShortLink(t *testing.T) {
+	ctx := context.Background()
+
+	shortLinks := newTestShortLinkRelay(t)
+	key, err := bertyshortlink.GenerateKey()
+	require.NoError(t, err)
+
+	svc := &service{shortLinks: shortLinks, shortLinkKey: key}
+
+	shortURL, err := shortLinks.Register(ctx, "BERTY://PB/2D9OS-Q5CFG4RF-AD0XWQ", key, time.Minute)
+	require.NoError(t, err)
+
+	link, err := svc.resolveShortLink(ctx, shortURL)
+	require.NoError(t, err)
+	require.Equal(t, "BERTY://PB/2D9OS-Q5CFG4RF-AD0XWQ", link)
+
+	// other links are kept
+	link, err = svc.resolveShortLink(ctx, "https://berty.tech/id#key=abc")
+	require.NoError(t, err)
+	require.Equal(t, "https://berty.tech/id#key=abc", link)
+
+	_, err = svc.ShortLinkDelete(ctx, &messengertypes.ShortLinkDelete_Request{ShortURL: shortURL})
+	require.NoError(t, err)
+	_, err = svc.resolveShortLink(ctx, shortURL)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	// without a relay nothing is resolved
+	link, err = (&service{}).resolveShortLink(ctx, shortURL)
+	require.NoError(t, err)
+	require.Equal(t, shortURL, link)
+}
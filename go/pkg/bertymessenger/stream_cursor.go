@@ -0,0 +1,142 @@
+package bertymessenger
+
+import (
+	"fmt"
+	"sync"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// DefaultStreamBufferSize bounds the events waiting to be sent to a stream
+// client, the stream fails when the client does not keep up.
+const DefaultStreamBufferSize = 256
+
+// streamCatchUpPageSize is the amount of stored interactions read at once
+// when resuming a stream.
+const streamCatchUpPageSize = 100
+
+var errStreamBufferFull = fmt.Errorf("the client does not keep up with the stream")
+
+// streamBuffer queues the events of a stream client without blocking the
+// dispatcher.
+type streamBuffer struct {
+	events chan *mt.StreamEvent
+	// overflow is closed once an event was dropped
+	overflow chan struct{}
+	once     sync.Once
+	// filter skips the events the client is not interested in, if set
+	filter func(e *mt.StreamEvent) bool
+}
+
+func newStreamBuffer(size int) *streamBuffer {
+	return &streamBuffer{
+		events:   make(chan *mt.StreamEvent, size),
+		overflow: make(chan struct{}),
+	}
+}
+
+// StreamEvent implements Notifiee, it never blocks.
+func (b *streamBuffer) StreamEvent(e *mt.StreamEvent) error {
+	if b.filter != nil && !b.filter(e) {
+		return nil
+	}
+
+	select {
+	case b.events <- e:
+	default:
+		b.once.Do(func() { close(b.overflow) })
+	}
+
+	return nil
+}
+
+func (svc *service) InteractionStream(req *mt.InteractionStream_Request, srv mt.MessengerService_InteractionStreamServer) error {
+	if req.ConversationPublicKey == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	send := func(inte *mt.Interaction) error {
+		return srv.Send(&mt.InteractionStream_Reply{Interaction: inte})
+	}
+
+	size := int(req.BufferSize)
+	if size <= 0 {
+		size = DefaultStreamBufferSize
+	}
+
+	// registered before reading the stored interactions, for none to be
+	// missed in between
+	buffer := newStreamBuffer(size)
+	buffer.filter = func(e *mt.StreamEvent) bool {
+		inte, ok := streamedInteraction(e, req.ConversationPublicKey)
+		return ok && req.SystemEvents.Match(inte)
+	}
+	unreg := svc.dispatcher.Register(buffer)
+	defer unreg()
+
+	caughtUp := map[string]struct{}{}
+	cursor := req.LastEventID
+	for {
+		interactions, err := svc.db.GetInteractionsAfter(req.ConversationPublicKey, cursor, streamCatchUpPageSize, req.SystemEvents)
+		if err != nil {
+			return err
+		}
+
+		for _, inte := range interactions {
+			if err := send(inte); err != nil {
+				return errcode.ErrStreamWrite.Wrap(err)
+			}
+			caughtUp[inte.CID] = struct{}{}
+			cursor = inte.CID
+		}
+
+		if len(interactions) < streamCatchUpPageSize {
+			break
+		}
+	}
+
+	for {
+		select {
+		case e := <-buffer.events:
+			inte, ok := streamedInteraction(e, req.ConversationPublicKey)
+			if !ok {
+				continue
+			}
+
+			// already sent while catching up
+			if _, ok := caughtUp[inte.CID]; ok && e.IsNew {
+				delete(caughtUp, inte.CID)
+				continue
+			}
+
+			if err := send(inte); err != nil {
+				return errcode.ErrStreamWrite.Wrap(err)
+			}
+		case <-buffer.overflow:
+			return errcode.ErrStreamWrite.Wrap(errStreamBufferFull)
+		case <-srv.Context().Done():
+			return nil
+		}
+	}
+}
+
+// streamedInteraction returns the interaction of e if it belongs to the
+// conversation, or to any conversation when conversationPK is empty.
+func streamedInteraction(e *mt.StreamEvent, conversationPK string) (*mt.Interaction, bool) {
+	if e.GetType() != mt.StreamEvent_TypeInteractionUpdated {
+		return nil, false
+	}
+
+	payload, err := e.UnmarshalPayload()
+	if err != nil {
+		return nil, false
+	}
+
+	inte := payload.(*mt.StreamEvent_InteractionUpdated).GetInteraction()
+	if conversationPK != "" && inte.GetConversationPublicKey() != conversationPK {
+		return nil, false
+	}
+
+	return inte, true
+}
@@ -0,0 +1,143 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/weshnet/pkg/testutil"
+)
+
+func TestInteractionStreamResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	conv, err := ts.Client.ConversationCreate(ctx, &messengertypes.ConversationCreate_Request{DisplayName: "conv"})
+	require.NoError(t, err)
+
+	cids := []string{}
+	for _, body := range []string{"first", "second"} {
+		payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: body})
+		require.NoError(t, err)
+
+		ret, err := ts.Client.Interact(ctx, &messengertypes.Interact_Request{
+			Type:                  messengertypes.AppMessage_TypeUserMessage,
+			Payload:               payload,
+			ConversationPublicKey: conv.PublicKey,
+		})
+		require.NoError(t, err)
+		cids = append(cids, ret.CID)
+	}
+
+	require.Eventually(t, func() bool {
+		for _, cid := range cids {
+			if _, err := ts.Service.(*service).db.GetInteractionByCID(cid); err != nil {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// resumed after the first message, the second one is sent and not the
+	// first one
+	streamCtx, streamCancel := context.WithCancel(ctx)
+	defer streamCancel()
+	stream, err := ts.Client.InteractionStream(streamCtx, &messengertypes.InteractionStream_Request{ConversationPublicKey: conv.PublicKey, LastEventID: cids[0]})
+	require.NoError(t, err)
+
+	for {
+		reply, err := stream.Recv()
+		require.NoError(t, err)
+		require.NotEqual(t, cids[0], reply.Interaction.CID)
+		if reply.Interaction.CID == cids[1] {
+			break
+		}
+	}
+
+	stream, err = ts.Client.InteractionStream(ctx, &messengertypes.InteractionStream_Request{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+}
+
+func TestStreamBufferOverflow(t *testing.T) {
+	buffer := newStreamBuffer(2)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, buffer.StreamEvent(&messengertypes.StreamEvent{}))
+	}
+
+	select {
+	case <-buffer.overflow:
+		t.Fatal("the buffer is not full yet")
+	default:
+	}
+
+	// dropped, never blocking the dispatcher
+	require.NoError(t, buffer.StreamEvent(&messengertypes.StreamEvent{}))
+	require.Len(t, buffer.events, 2)
+
+	select {
+	case <-buffer.overflow:
+	default:
+		t.Fatal("the overflow is not signaled")
+	}
+}
+
+func TestEventStreamSlowConsumer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	ts, cleanup := NewTestingService(ctx, t, &TestingServiceOpts{Logger: logger})
+	defer cleanup()
+
+	svc := ts.Service.(*service)
+	notifiees := func() int {
+		svc.dispatcher.mutex.RLock()
+		defer svc.dispatcher.mutex.RUnlock()
+		return len(svc.dispatcher.notifiees)
+	}
+	registered := notifiees()
+
+	events, err := ts.Client.EventStream(ctx, &messengertypes.EventStream_Request{ShallowAmount: -1})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return notifiees() > registered }, 5*time.Second, 10*time.Millisecond)
+
+	// far more events than the buffer holds, large enough for the sends to
+	// block while the client does not read
+	name := strings.Repeat("x", 16*1024)
+	for i := 0; i < 4*DefaultStreamBufferSize; i++ {
+		err := svc.dispatcher.StreamEvent(messengertypes.StreamEvent_TypeConversationUpdated, &messengertypes.StreamEvent_ConversationUpdated{
+			Conversation: &messengertypes.Conversation{PublicKey: fmt.Sprintf("conv%d", i), DisplayName: name},
+		}, true)
+		require.NoError(t, err)
+	}
+
+	// the client is disconnected once it reads the events sent before
+	for {
+		_, err := events.Recv()
+		if err != nil {
+			require.True(t, errcode.Is(err, errcode.ErrStreamWrite), err)
+			break
+		}
+	}
+
+	// and no longer receives the events
+	require.Eventually(t, func() bool { return notifiees() == registered }, 5*time.Second, 10*time.Millisecond)
+}
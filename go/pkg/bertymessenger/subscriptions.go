@@ -29,6 +29,11 @@ func (svc *service) manageSubscriptions() {
 		defer svc.subsMutex.Unlock()
 
 		if svc.cancelSubsCtx != nil {
+			if svc.suspendedGroups != nil {
+				svc.resumeSuspendedGroups(logger)
+				return
+			}
+
 			logger.Error("sub to known groups already running")
 			return
 		}
@@ -113,11 +118,97 @@ func (svc *service) manageSubscriptions() {
 
 		svc.subsCtx = nil
 		svc.cancelSubsCtx = nil
+		svc.suspendedGroups = nil
+	}
+
+	// only keep the groups needed to notify the user while inactive
+	suspend := func() {
+		logger.Info("suspending the multi-member group subscriptions")
+
+		svc.subsMutex.Lock()
+		defer svc.subsMutex.Unlock()
+
+		if svc.subsCtx == nil || svc.suspendedGroups != nil {
+			return
+		}
+
+		svc.suspendedGroups = make(map[string]struct{})
+		for groupPK := range svc.groupsToSubTo {
+			if !svc.suspendedWhileInactive(groupPK) {
+				continue
+			}
+
+			groupPKBytes, err := messengerutil.B64DecodeBytes(groupPK)
+			if err != nil {
+				logger.Error("unable to suspend subscriptions, decode error", zap.String("gpk", groupPK), zap.Error(err))
+				continue
+			}
+			if _, err := svc.protocolClient.DeactivateGroup(svc.subsCtx, &protocoltypes.DeactivateGroup_Request{
+				GroupPK: groupPKBytes,
+			}); err != nil {
+				if !errcode.Has(err, errcode.ErrBertyAccount) {
+					logger.Error("unable to deactivate group", zap.String("gpk", groupPK), zap.Error(err))
+				}
+
+				continue
+			}
+
+			svc.suspendedGroups[groupPK] = struct{}{}
+		}
+	}
+
+	// only subscribe to the groups kept while inactive, the other ones are
+	// suspended until the app is active again
+	subscribeLight := func() {
+		svc.subsMutex.Lock()
+		defer svc.subsMutex.Unlock()
+
+		if svc.subsCtx != nil {
+			return
+		}
+
+		ctx, cancel := context.WithCancel(svc.ctx)
+		svc.cancelSubsCtx = cancel
+		svc.subsCtx = ctx
+		svc.suspendedGroups = make(map[string]struct{})
+
+		var tyberErr error
+		tyberCtx, _, endSection := tyber.Section(context.TODO(), logger, "Polling the account and contact groups")
+		defer func() { endSection(tyberErr, "") }()
+
+		if err := svc.subscribeToGroup(ctx, tyberCtx, svc.accountGroup); err != nil {
+			if !errcode.Has(err, errcode.ErrBertyAccountAlreadyOpened) {
+				logger.Error("unable subscribe to group", zap.String("gpk", messengerutil.B64EncodeBytes(svc.accountGroup)), zap.Error(err))
+			}
+			tyberErr = multierr.Append(tyberErr, err)
+		}
+
+		for groupPK := range svc.groupsToSubTo {
+			if svc.suspendedWhileInactive(groupPK) {
+				svc.suspendedGroups[groupPK] = struct{}{}
+				continue
+			}
+
+			gpkb, err := messengerutil.B64DecodeBytes(groupPK)
+			if err != nil {
+				logger.Error("unable subscribe, decode error", zap.String("gpk", groupPK), zap.Error(err))
+				tyberErr = multierr.Append(tyberErr, err)
+				continue
+			}
+
+			if err := svc.subscribeToGroup(ctx, tyberCtx, gpkb); err != nil {
+				if !errcode.Has(err, errcode.ErrBertyAccountAlreadyOpened) {
+					logger.Error("unable subscribe to group", zap.String("gpk", groupPK), zap.Error(err))
+				}
+				tyberErr = multierr.Append(tyberErr, err)
+			}
+		}
 	}
 
 	// start in inactive state, which should trigger the `startSubscription`
 	// method naturally when switching to active state at application startup
 	currentState := lifecycle.StateInactive
+	stopPolling := func() {}
 	for {
 		task, ok := svc.lcmanager.TaskWaitForStateChange(svc.ctx, currentState)
 		if !ok {
@@ -129,14 +220,27 @@ func (svc *service) manageSubscriptions() {
 
 		switch currentState {
 		case lifecycle.StateActive:
+			stopPolling()
+			stopPolling = func() {}
 			subscribe()
 		case lifecycle.StateInactive:
-			unsubscribe()
+			switch svc.inactiveSync {
+			case InactiveSyncLight:
+				suspend()
+			case InactiveSyncPoll:
+				stopPolling()
+				unsubscribe()
+				stopPolling = svc.pollGroups(logger, svc.pollInterval, subscribeLight, unsubscribe)
+			default:
+				unsubscribe()
+			}
 		}
 
 		task.Done()
 	}
 
+	stopPolling()
+
 	// if we are in any other state than inactive, close subscription
 	if currentState != lifecycle.StateInactive {
 		unsubscribe()
@@ -185,6 +289,8 @@ func (svc *service) subscribeToMetadata(ctx, tyberCtx context.Context, gpkb []by
 			} else {
 				eventHandler.Logger().Debug("Messenger event handler succeeded", tyber.FormatStepLogFields(eventHandler.Ctx(), []tyber.Detail{}, tyber.EndTrace)...)
 			}
+			// journaled in the order they are handled
+			svc.recordJournalEvent(gme)
 			svc.handlerMutex.Unlock()
 		}
 	}()
@@ -225,26 +331,78 @@ func (svc *service) subscribeToMessages(ctx, tyberCtx context.Context, gpkb []by
 				return
 			}
 
-			cid, err := ipfscid.Cast(gme.EventContext.ID)
-			eventHandler := svc.eventHandler
+			// the lag is measured from the date set by the sender
+			createdAt := am.GetSentDate()
+
+			// late arrivals are ordered by device counter, pings included
+			sentDate, err := svc.sequencer.Observe(ctx, messengerutil.B64EncodeBytes(gpkb), messengerutil.B64EncodeBytes(gme.GetHeaders().GetDevicePK()), gme.GetHeaders().GetCounter(), am.GetSentDate())
 			if err != nil {
-				svc.logger.Error("failed to cast cid for logging", zap.String("type", am.GetType().String()), logutil.PrivateBinary("cid-bytes", gme.EventContext.ID))
-				ctx, _ := tyber.ContextWithTraceID(svc.eventHandler.Ctx())
-				eventHandler = eventHandler.WithContext(ctx)
-			} else {
-				eventHandler = eventHandler.WithContext(tyber.ContextWithConstantTraceID(svc.eventHandler.Ctx(), "msgrcvd-"+cid.String()))
+				svc.logger.Warn("unable to sequence message", zap.Error(err))
 			}
+			am.SentDate = sentDate
 
-			if err := eventHandler.HandleAppMessage(messengerutil.B64EncodeBytes(gpkb), gme, &am); err != nil {
-				_ = tyber.LogFatalError(eventHandler.Ctx(), eventHandler.Logger(), "Failed to handle AppMessage", err)
-			} else {
-				eventHandler.Logger().Debug("AppMessage handler succeeded", tyber.FormatStepLogFields(eventHandler.Ctx(), []tyber.Detail{}, tyber.EndTrace)...)
+			// chunks are handled once the whole message is received
+			if am.GetType() == mt.AppMessage_TypeChunk {
+				whole := (*mt.AppMessage)(nil)
+				if gme, whole = svc.handleChunkMessage(gpkb, gme, &am); whole == nil {
+					continue
+				}
+				am = *whole
+			}
+
+			// pings are not stored
+			if svc.handlePingMessage(gpkb, gme, &am) {
+				continue
+			}
+
+			// neither are revocations
+			if svc.handleDeviceRevocationMessage(gpkb, gme, &am) {
+				continue
+			}
+
+			// nor presences
+			if svc.handlePresenceMessage(gpkb, gme, &am) {
+				continue
+			}
+
+			// the reactions are counted apart from the interactions
+			if svc.handleReactionMessage(gpkb, gme, &am) {
+				continue
+			}
+
+			// the join approval messages are not stored either, the messages
+			// of the members waiting for an approval are held
+			if svc.handleJoinApprovalMessage(gpkb, gme, &am) || svc.holdJoinPendingMessage(gpkb, gme, &am) {
+				continue
 			}
+
+			svc.handleGroupAppMessage(gpkb, gme, &am)
+			svc.observeReplicationLag(gpkb, gme, createdAt)
 		}
 	}()
 	return nil
 }
 
+// handleGroupAppMessage stores and dispatches an app message received from a
+// group.
+func (svc *service) handleGroupAppMessage(gpkb []byte, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) {
+	cid, err := ipfscid.Cast(gme.EventContext.ID)
+	eventHandler := svc.eventHandler
+	if err != nil {
+		svc.logger.Error("failed to cast cid for logging", zap.String("type", am.GetType().String()), logutil.PrivateBinary("cid-bytes", gme.EventContext.ID))
+		ctx, _ := tyber.ContextWithTraceID(svc.eventHandler.Ctx())
+		eventHandler = eventHandler.WithContext(ctx)
+	} else {
+		eventHandler = eventHandler.WithContext(tyber.ContextWithConstantTraceID(svc.eventHandler.Ctx(), "msgrcvd-"+cid.String()))
+	}
+
+	if err := eventHandler.HandleAppMessage(messengerutil.B64EncodeBytes(gpkb), gme, am); err != nil {
+		_ = tyber.LogFatalError(eventHandler.Ctx(), eventHandler.Logger(), "Failed to handle AppMessage", err)
+	} else {
+		eventHandler.Logger().Debug("AppMessage handler succeeded", tyber.FormatStepLogFields(eventHandler.Ctx(), []tyber.Detail{}, tyber.EndTrace)...)
+	}
+}
+
 func (svc *service) subscribeToGroup(ctx, tyberCtx context.Context, gpkb []byte) error {
 	tyberCtx, newTrace := tyber.ContextWithTraceID(tyberCtx)
 	if newTrace {
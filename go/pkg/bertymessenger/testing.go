@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	libp2p_mocknet "github.com/berty/go-libp2p-mock"
 	"github.com/golang/protobuf/proto"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
@@ -35,13 +36,16 @@ import (
 )
 
 type TestingServiceOpts struct {
-	Logger      *zap.Logger
-	Client      weshnet.ServiceClient
-	DB          *gorm.DB
-	Index       int
-	Ring        *zapring.Core
-	LogFilePath string
-	PushSK      *[32]byte
+	Logger       *zap.Logger
+	Client       weshnet.ServiceClient
+	DB           *gorm.DB
+	Index        int
+	Ring         *zapring.Core
+	LogFilePath  string
+	PushSK       *[32]byte
+	Clock        clock.Clock
+	InactiveSync InactiveSync
+	PollInterval time.Duration
 }
 
 type TestingService struct {
@@ -96,6 +100,9 @@ func NewTestingService(ctx context.Context, t testing.TB, opts *TestingServiceOp
 		LogFilePath:      opts.LogFilePath,
 		GRPCInsecureMode: true,
 		PushKey:          opts.PushSK,
+		Clock:            opts.Clock,
+		InactiveSync:     opts.InactiveSync,
+		PollInterval:     opts.PollInterval,
 	})
 	if err != nil {
 		cleanup()
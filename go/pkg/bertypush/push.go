@@ -8,6 +8,7 @@ import (
 	"berty.tech/berty/v2/go/internal/dbfetcher"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/pushtypes"
 	"berty.tech/weshnet/pkg/protocoltypes"
 )
 
@@ -40,7 +41,7 @@ func NewPushReceiver(pushHandler PushHandler, evtHandler EventHandler, dbFetcher
 }
 
 func (m *messengerPushReceiver) PushReceive(ctx context.Context, input []byte) (*messengertypes.PushReceive_Reply, error) {
-	oosMessage, err := m.pushHandler.PushReceive(ctx, input)
+	oosMessage, level, err := m.pushHandler.PushReceiveLevel(ctx, input)
 	if err != nil {
 		return nil, errcode.ErrInternal.Wrap(err)
 	}
@@ -50,6 +51,14 @@ func (m *messengerPushReceiver) PushReceive(ctx context.Context, input []byte) (
 		return nil, errcode.ErrInternal.Wrap(err)
 	}
 
+	// the receiver only wants its pushes to show who sent the message, the
+	// interaction is saved but its content is not returned to the push
+	if level == pushtypes.PayloadSender {
+		stripped := *i
+		stripped.Payload = nil
+		i = &stripped
+	}
+
 	if i.Conversation.Type == messengertypes.Conversation_ContactType {
 		i.Conversation.Contact, err = m.dbFetcher.GetContactByPK(i.Conversation.ContactPublicKey)
 		if err != nil {
@@ -50,7 +50,7 @@ func FormatDecryptedPush(decrypted *pushtypes.DecryptedPush, printer *message.Pr
 			break
 		}
 
-		fmtpush.Body = msg
+		fmtpush.Body = pushtypes.TruncatePreview(msg, pushtypes.MaxPreviewBytes)
 
 	case decrypted.PushType == pushtypes.DecryptedPush_GroupInvitation:
 		var groupName string
@@ -38,6 +38,9 @@ func (s *pushHandler) SetPushSK(key *[cryptoutil.KeySize]byte) {
 
 type PushHandler interface {
 	PushReceive(ctx context.Context, payload []byte) (*protocoltypes.OutOfStoreReceive_Reply, error)
+	// PushReceiveLevel is PushReceive which also returns the payload level
+	// the push server sent the push at.
+	PushReceiveLevel(ctx context.Context, payload []byte) (*protocoltypes.OutOfStoreReceive_Reply, pushtypes.PayloadLevel, error)
 	PushPK() *[cryptoutil.KeySize]byte
 }
 
@@ -82,35 +85,49 @@ func NewPushHandler(serviceClient oosmtypes.OutOfStoreMessageServiceClient, dbFe
 }
 
 func (s *pushHandler) PushReceive(ctx context.Context, payload []byte) (*protocoltypes.OutOfStoreReceive_Reply, error) {
+	oosMessage, _, err := s.PushReceiveLevel(ctx, payload)
+	return oosMessage, err
+}
+
+func (s *pushHandler) PushReceiveLevel(ctx context.Context, payload []byte) (*protocoltypes.OutOfStoreReceive_Reply, pushtypes.PayloadLevel, error) {
 	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
+	if len(payload) == 0 {
+		return nil, pushtypes.PayloadNone, errcode.ErrPushInvalidPayload.Wrap(fmt.Errorf("content-free push, nothing to decrypt"))
+	}
+
 	pushServerPK, err := s.getPushServerPubKey(ctx)
 	if err != nil {
-		return nil, errcode.ErrPushUnableToDecrypt.Wrap(err)
+		return nil, pushtypes.PayloadFull, errcode.ErrPushUnableToDecrypt.Wrap(err)
 	}
 
 	oosBytes, err := DecryptPushDataFromServer(payload, pushServerPK, s.pushSK)
 	if err != nil {
-		return nil, errcode.ErrPushUnableToDecrypt.Wrap(err)
+		return nil, pushtypes.PayloadFull, errcode.ErrPushUnableToDecrypt.Wrap(err)
+	}
+
+	level, err := pushtypes.EnvelopePayloadLevel(oosBytes)
+	if err != nil {
+		return nil, pushtypes.PayloadFull, errcode.ErrPushInvalidPayload.Wrap(err)
 	}
 
 	oosMessageEnv := &protocoltypes.OutOfStoreMessageEnvelope{}
 	if err := oosMessageEnv.Unmarshal(oosBytes); err != nil {
-		return nil, errcode.ErrDeserialization.Wrap(err)
+		return nil, level, errcode.ErrDeserialization.Wrap(err)
 	}
 
 	oosMessageEnvBytes, err := oosMessageEnv.Marshal()
 	if err != nil {
-		return nil, errcode.ErrSerialization.Wrap(err)
+		return nil, level, errcode.ErrSerialization.Wrap(err)
 	}
 
 	oosMessage, err := s.serviceClient.OutOfStoreReceive(ctx, &protocoltypes.OutOfStoreReceive_Request{Payload: oosMessageEnvBytes})
 	if err != nil {
-		return nil, errcode.ErrCryptoDecrypt.Wrap(err)
+		return nil, level, errcode.ErrCryptoDecrypt.Wrap(err)
 	}
 
-	return oosMessage, nil
+	return oosMessage, level, nil
 }
 
 func (s *pushHandler) getPushServerPubKey(_ context.Context) (*[cryptoutil.KeySize]byte, error) {
@@ -30,6 +30,10 @@ func PushDecryptStandalone(logger *zap.Logger, rootDir string, inputB64 string,
 		return nil, errcode.ErrInvalidInput.Wrap(err)
 	}
 
+	if len(input) == 0 {
+		return ContentFreePush(), nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
@@ -41,6 +45,18 @@ func PushDecryptStandalone(logger *zap.Logger, rootDir string, inputB64 string,
 	return PushEnrich(rawPushData, accountData, logger)
 }
 
+// ContentFreePush returns the push displayed for the pushes sent without a
+// payload, which the push server sends to the receivers who want none or when
+// the payload exceeds the budget of the platform.
+func ContentFreePush() *pushtypes.DecryptedPush {
+	return &pushtypes.DecryptedPush{
+		PushType:         pushtypes.DecryptedPush_Unknown,
+		PayloadAttrsJSON: "{}",
+		DeepLink:         bertylinks.LinkInternalPrefix,
+		HidePreview:      true,
+	}
+}
+
 func PushEnrich(rawPushData *messengertypes.PushReceivedData, accountData *accounttypes.AccountMetadata, logger *zap.Logger) (*pushtypes.DecryptedPush, error) {
 	if accountData == nil {
 		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("no account metadata specified"))
@@ -96,6 +112,11 @@ func PushEnrich(rawPushData *messengertypes.PushReceivedData, accountData *accou
 		payloadAttrs["message"] = m.Body
 
 	case messengertypes.AppMessage_TypeGroupInvitation:
+		// the payload was not returned, the receiver only shows the sender
+		if len(rawPushData.Interaction.Payload) == 0 {
+			break
+		}
+
 		d.PushType = pushtypes.DecryptedPush_GroupInvitation
 		invitation := &messengertypes.AppMessage_GroupInvitation{}
 		err := proto.Unmarshal(rawPushData.Interaction.Payload, invitation)
@@ -159,8 +180,10 @@ func PushDecrypt(ctx context.Context, rootDir string, input []byte, opts *PushDe
 	}
 
 	_, pushSK, err := accountutils.GetDevicePushKeyForPath(path.Join(rootDir, accountutils.DefaultPushKeyFilename), false)
-	if err != nil {
+	if errcode.Is(err, errcode.ErrNotFound) {
 		return nil, nil, errcode.ErrPushUnableToDecrypt.Wrap(fmt.Errorf("device has no known push key"))
+	} else if err != nil {
+		return nil, nil, err
 	}
 
 	accounts, err := accountutils.ListAccounts(ctx, rootDir, opts.Keystore, opts.Logger)
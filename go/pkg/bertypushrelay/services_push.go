@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 	"golang.org/x/crypto/curve25519"
@@ -100,8 +101,8 @@ func (d *pushService) Send(ctx context.Context, request *pushtypes.PushServiceSe
 	return &pushtypes.PushServiceSend_Reply{}, nil
 }
 
-func (d *pushService) decodeOpaqueReceiver(receiver *pushtypes.PushServiceOpaqueReceiver) (*pushtypes.PushServiceReceiver, error) {
-	return InternalDecodeOpaqueReceiver(d.publicKey, d.privateKey, d.dispatchers, receiver)
+func (d *pushService) decodeOpaqueReceiver(receiver *pushtypes.PushServiceOpaqueReceiver) (*pushtypes.PushServiceReceiver, pushtypes.ReceiverOptions, error) {
+	return InternalDecodeOpaqueReceiverOptions(d.publicKey, d.privateKey, d.dispatchers, receiver)
 }
 
 func (d *pushService) encryptPushPayloadForReceiver(rawPayload, recipientPublicKey []byte) ([]byte, error) {
@@ -109,21 +110,40 @@ func (d *pushService) encryptPushPayloadForReceiver(rawPayload, recipientPublicK
 }
 
 func InternalDecodeOpaqueReceiver(publicKey *[cryptoutil.KeySize]byte, privateKey *[cryptoutil.KeySize]byte, dispatchers map[string]PushDispatcher, receiver *pushtypes.PushServiceOpaqueReceiver) (*pushtypes.PushServiceReceiver, error) {
+	pushReceiver, _, err := InternalDecodeMutedOpaqueReceiver(publicKey, privateKey, dispatchers, receiver)
+	return pushReceiver, err
+}
+
+// InternalDecodeMutedOpaqueReceiver decodes receiver and the mute deadline
+// sealed with it, which is zero if the conversation of the token is not
+// muted.
+func InternalDecodeMutedOpaqueReceiver(publicKey *[cryptoutil.KeySize]byte, privateKey *[cryptoutil.KeySize]byte, dispatchers map[string]PushDispatcher, receiver *pushtypes.PushServiceOpaqueReceiver) (*pushtypes.PushServiceReceiver, time.Time, error) {
+	pushReceiver, opts, err := InternalDecodeOpaqueReceiverOptions(publicKey, privateKey, dispatchers, receiver)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return pushReceiver, opts.MutedUntil, nil
+}
+
+// InternalDecodeOpaqueReceiverOptions decodes receiver and the options sealed
+// with it.
+func InternalDecodeOpaqueReceiverOptions(publicKey *[cryptoutil.KeySize]byte, privateKey *[cryptoutil.KeySize]byte, dispatchers map[string]PushDispatcher, receiver *pushtypes.PushServiceOpaqueReceiver) (*pushtypes.PushServiceReceiver, pushtypes.ReceiverOptions, error) {
 	receiverBytes, ok := box.OpenAnonymous(nil, receiver.OpaqueToken, publicKey, privateKey)
 	if !ok {
-		return nil, errcode.ErrCryptoDecrypt.Wrap(fmt.Errorf("unable to decrypt push identifier"))
+		return nil, pushtypes.ReceiverOptions{}, errcode.ErrCryptoDecrypt.Wrap(fmt.Errorf("unable to decrypt push identifier"))
 	}
 
-	pushReceiver := &pushtypes.PushServiceReceiver{}
-	if err := pushReceiver.Unmarshal(receiverBytes); err != nil {
-		return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("unable to unmarshal push identifier: %w", err))
+	pushReceiver, opts, err := pushtypes.UnmarshalReceiverOptions(receiverBytes)
+	if err != nil {
+		return nil, pushtypes.ReceiverOptions{}, errcode.ErrDeserialization.Wrap(fmt.Errorf("unable to unmarshal push identifier: %w", err))
 	}
 
 	if _, ok := dispatchers[PushDispatcherKey(pushReceiver.TokenType, pushReceiver.BundleID)]; !ok {
-		return nil, errcode.ErrPushUnknownProvider.Wrap(fmt.Errorf("unsupported bundle id"))
+		return nil, pushtypes.ReceiverOptions{}, errcode.ErrPushUnknownProvider.Wrap(fmt.Errorf("unsupported bundle id"))
 	}
 
-	return pushReceiver, nil
+	return pushReceiver, opts, nil
 }
 
 func InternalEncryptPushPayloadForReceiver(privateKey *[cryptoutil.KeySize]byte, rawPayload, recipientPublicKey []byte) ([]byte, error) {
@@ -151,19 +171,26 @@ func InternalEncryptPushPayloadForReceiver(privateKey *[cryptoutil.KeySize]byte,
 }
 
 func (d *pushService) sendSingle(rawPayload []byte, receiver *pushtypes.PushServiceOpaqueReceiver) error {
-	pushReceiver, err := d.decodeOpaqueReceiver(receiver)
+	pushReceiver, opts, err := d.decodeOpaqueReceiver(receiver)
 	if err != nil {
 		return errcode.ErrCryptoDecrypt.Wrap(err)
 	}
 
+	// the receiver muted the conversation, the push is dropped without error
+	// as the sender can't know it
+	if pushtypes.MutedAt(opts.MutedUntil, time.Now()) {
+		d.logger.Debug("dropping a push for a muted receiver", zap.Time("muted-until", opts.MutedUntil))
+		return nil
+	}
+
 	dispatcher, ok := d.dispatchers[PushDispatcherKey(pushReceiver.TokenType, pushReceiver.BundleID)]
 	if !ok {
 		return errcode.ErrPushUnknownProvider.Wrap(fmt.Errorf("unsupported %s", PushDispatcherKey(pushReceiver.TokenType, pushReceiver.BundleID)))
 	}
 
-	payloadBytes, err := d.encryptPushPayloadForReceiver(rawPayload, pushReceiver.RecipientPublicKey)
+	payloadBytes, err := d.receiverPayload(rawPayload, pushReceiver, opts.PayloadLevel)
 	if err != nil {
-		return errcode.ErrCryptoEncrypt.Wrap(err)
+		return err
 	}
 
 	if err := dispatcher.Dispatch(payloadBytes, pushReceiver); err != nil {
@@ -173,6 +200,35 @@ func (d *pushService) sendSingle(rawPayload []byte, receiver *pushtypes.PushServ
 	return nil
 }
 
+// receiverPayload seals rawPayload for pushReceiver at level, the payload is
+// empty when the receiver wants none or when it exceeds the budget of the
+// platform, the app then fetches the message when it opens.
+func (d *pushService) receiverPayload(rawPayload []byte, pushReceiver *pushtypes.PushServiceReceiver, level pushtypes.PayloadLevel) ([]byte, error) {
+	if level == pushtypes.PayloadNone {
+		return nil, nil
+	}
+
+	leveledPayload, err := pushtypes.AppendPayloadLevel(rawPayload, level)
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	payloadBytes, err := d.encryptPushPayloadForReceiver(leveledPayload, pushReceiver.RecipientPublicKey)
+	if err != nil {
+		return nil, errcode.ErrCryptoEncrypt.Wrap(err)
+	}
+
+	if !pushtypes.FitsBudget(payloadBytes, pushReceiver.TokenType) {
+		d.logger.Debug("push payload over the budget of the platform, sending it without content",
+			zap.Int("size", len(payloadBytes)),
+			zap.Int("budget", pushtypes.PayloadBudget(pushReceiver.TokenType)),
+			zap.String("token-type", pushReceiver.TokenType.String()))
+		return nil, nil
+	}
+
+	return payloadBytes, nil
+}
+
 func (d *pushService) Close() error {
 	return nil
 }
@@ -2,7 +2,9 @@ package bertypushrelay_test
 
 import (
 	crand "crypto/rand"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,6 +17,7 @@ import (
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 	"berty.tech/berty/v2/go/pkg/pushtypes"
 	"berty.tech/weshnet/pkg/cryptoutil"
+	"berty.tech/weshnet/pkg/protocoltypes"
 )
 
 var (
@@ -193,6 +196,143 @@ func TestPushService_Send(t *testing.T) {
 	t.Skip("TODO")
 }
 
+func TestPushService_SendMuted(t *testing.T) {
+	dispatcher := pushtypes.NewPushMockedDispatcher(pushtypes.PushMockBundleID)
+	s, err := bertypushrelay.NewPushService(pushDefaultServerSK, []bertypushrelay.PushDispatcher{dispatcher}, nil)
+	require.NoError(t, err)
+
+	envelope, err := (&protocoltypes.OutOfStoreMessageEnvelope{
+		Nonce:          make([]byte, cryptoutil.NonceSize),
+		Box:            []byte("box"),
+		GroupReference: []byte("group"),
+	}).Marshal()
+	require.NoError(t, err)
+
+	server := &messengertypes.PushServer{Key: pushDefaultServerPK[:]}
+	send := func(token string, mutedUntil time.Time) {
+		t.Helper()
+
+		sealed, err := bertymessenger.PushSealMutedTokenForServer(&pushtypes.PushServiceReceiver{
+			TokenType:          pushtypes.PushServiceTokenType_PushTokenMQTT,
+			BundleID:           pushtypes.PushMockBundleID,
+			Token:              []byte(token),
+			RecipientPublicKey: pushTestRecipient1PK[:],
+		}, server, mutedUntil)
+		require.NoError(t, err)
+
+		// a muted receiver is not an error for the sender
+		_, err = s.Send(context.Background(), &pushtypes.PushServiceSend_Request{
+			Envelope:  envelope,
+			Receivers: []*pushtypes.PushServiceOpaqueReceiver{{OpaqueToken: sealed.Token}},
+		})
+		require.NoError(t, err)
+	}
+
+	send("unmuted", time.Time{})
+	require.Equal(t, 1, dispatcher.Len([]byte("unmuted")))
+
+	send("muted", time.Now().Add(time.Hour))
+	require.Equal(t, 0, dispatcher.Len([]byte("muted")))
+
+	send("forever", time.UnixMicro(math.MaxInt64))
+	require.Equal(t, 0, dispatcher.Len([]byte("forever")))
+
+	send("expired", time.Now().Add(-time.Hour))
+	require.Equal(t, 1, dispatcher.Len([]byte("expired")))
+}
+
+func TestPushService_SendPayloadLevel(t *testing.T) {
+	dispatcher := pushtypes.NewPushMockedDispatcher(pushtypes.PushMockBundleID)
+	s, err := bertypushrelay.NewPushService(pushDefaultServerSK, []bertypushrelay.PushDispatcher{dispatcher}, nil)
+	require.NoError(t, err)
+
+	server := &messengertypes.PushServer{Key: pushDefaultServerPK[:]}
+	send := func(token string, level pushtypes.PayloadLevel, sealedBox []byte) []byte {
+		t.Helper()
+
+		envelope, err := (&protocoltypes.OutOfStoreMessageEnvelope{
+			Nonce:          make([]byte, cryptoutil.NonceSize),
+			Box:            sealedBox,
+			GroupReference: []byte("group"),
+		}).Marshal()
+		require.NoError(t, err)
+
+		sealed, err := bertymessenger.PushSealTokenOptionsForServer(&pushtypes.PushServiceReceiver{
+			TokenType:          pushtypes.PushServiceTokenType_PushTokenMQTT,
+			BundleID:           pushtypes.PushMockBundleID,
+			Token:              []byte(token),
+			RecipientPublicKey: pushTestRecipient1PK[:],
+		}, server, pushtypes.ReceiverOptions{PayloadLevel: level})
+		require.NoError(t, err)
+
+		_, err = s.Send(context.Background(), &pushtypes.PushServiceSend_Request{
+			Envelope:  envelope,
+			Receivers: []*pushtypes.PushServiceOpaqueReceiver{{OpaqueToken: sealed.Token}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, dispatcher.Len([]byte(token)))
+
+		return dispatcher.Shift([]byte(token))
+	}
+
+	open := func(payload []byte) ([]byte, pushtypes.PayloadLevel) {
+		t.Helper()
+
+		decrypted, err := bertypush.DecryptPushDataFromServer(payload, pushDefaultServerPK, pushTestRecipient1SK)
+		require.NoError(t, err)
+
+		level, err := pushtypes.EnvelopePayloadLevel(decrypted)
+		require.NoError(t, err)
+
+		return decrypted, level
+	}
+
+	envelope, level := open(send("full", pushtypes.PayloadFull, []byte("box")))
+	require.Equal(t, pushtypes.PayloadFull, level)
+	require.NotEmpty(t, envelope)
+
+	envelope, level = open(send("sender", pushtypes.PayloadSender, []byte("box")))
+	require.Equal(t, pushtypes.PayloadSender, level)
+	require.NotEmpty(t, envelope)
+
+	// nothing of the message is pushed
+	require.Empty(t, send("none", pushtypes.PayloadNone, []byte("box")))
+
+	// the payloads over the budget of the platform are pushed without content
+	require.Empty(t, send("large", pushtypes.PayloadFull, make([]byte, bertypushrelay.ServicePushPayloadMax)))
+}
+
+func Test_decodeMutedOpaqueReceiver(t *testing.T) {
+	dispatcher := pushtypes.NewPushMockedDispatcher(pushtypes.PushMockBundleID)
+	dispatchers, _, err := bertypushrelay.PushServiceGenerateDispatchers([]bertypushrelay.PushDispatcher{dispatcher})
+	require.NoError(t, err)
+
+	receiver := &pushtypes.PushServiceReceiver{
+		TokenType:          pushtypes.PushServiceTokenType_PushTokenMQTT,
+		BundleID:           pushtypes.PushMockBundleID,
+		Token:              []byte("testtoken"),
+		RecipientPublicKey: pushTestRecipient1PK[:],
+	}
+	mutedUntil := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+
+	sealed, err := bertymessenger.PushSealMutedTokenForServer(receiver, &messengertypes.PushServer{Key: pushDefaultServerPK[:]}, mutedUntil)
+	require.NoError(t, err)
+
+	decrypted, decryptedMutedUntil, err := bertypushrelay.InternalDecodeMutedOpaqueReceiver(pushDefaultServerPK, pushDefaultServerSK, dispatchers, &pushtypes.PushServiceOpaqueReceiver{OpaqueToken: sealed.Token})
+	require.NoError(t, err)
+	require.True(t, mutedUntil.Equal(decryptedMutedUntil))
+	require.Equal(t, receiver.Token, decrypted.Token)
+	require.Equal(t, receiver.RecipientPublicKey, decrypted.RecipientPublicKey)
+
+	// the receivers sealed without a deadline are not muted
+	sealed, err = bertymessenger.PushSealTokenForServer(receiver, &messengertypes.PushServer{Key: pushDefaultServerPK[:]})
+	require.NoError(t, err)
+
+	_, decryptedMutedUntil, err = bertypushrelay.InternalDecodeMutedOpaqueReceiver(pushDefaultServerPK, pushDefaultServerSK, dispatchers, &pushtypes.PushServiceOpaqueReceiver{OpaqueToken: sealed.Token})
+	require.NoError(t, err)
+	require.True(t, decryptedMutedUntil.IsZero())
+}
+
 func init() {
 	var err error
 	pushDefaultServerPK, pushDefaultServerSK, err = box.GenerateKey(crand.Reader)
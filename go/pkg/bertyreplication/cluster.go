@@ -0,0 +1,290 @@
+package bertyreplication
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/weshnet/pkg/replicationtypes"
+)
+
+// DefaultLeaseTTL is the time a server of the cluster keeps the groups it
+// stopped renewing, before the other servers take them over.
+const DefaultLeaseTTL = time.Minute
+
+// ClusterOpts enables the cluster mode, where several replication servers
+// share the same database, e.g. a Postgres one, and split the replicated
+// groups between them.
+type ClusterOpts struct {
+	// NodeID identifies the server in the lease table, it must be unique in
+	// the cluster and stable across restarts.
+	NodeID string
+
+	// LeaseTTL is DefaultLeaseTTL when zero, the leases are renewed three
+	// times per TTL.
+	LeaseTTL time.Duration
+
+	// Clock dates the leases and the heartbeats, it defaults to the system
+	// clock, e.g. a mock is used in tests.
+	Clock clock.Clock
+}
+
+// ReplicatedGroupLease gives the replication of a group to Holder until
+// ExpiresAt, in unix nanoseconds as the other replication tables.
+type ReplicatedGroupLease struct {
+	GroupPublicKey string `gorm:"primaryKey"`
+	Holder         string `gorm:"index"`
+	ExpiresAt      int64
+}
+
+// ReplicationClusterNode is the heartbeat of a server of the cluster, the
+// groups are split between the servers seen during the last lease TTL.
+type ReplicationClusterNode struct {
+	ID       string `gorm:"primaryKey"`
+	LastSeen int64
+}
+
+// clusterCoordinator claims the leases of a fair share of the replicated
+// groups and starts or stops their replication accordingly.
+type clusterCoordinator struct {
+	db     *gorm.DB
+	nodeID string
+	ttl    time.Duration
+	clock  clock.Clock
+	logger *zap.Logger
+	start  func(groupPK string) error
+	stop   func(groupPK string)
+
+	mu      sync.Mutex
+	started map[string]struct{}
+}
+
+func newClusterCoordinator(db *gorm.DB, opts ClusterOpts, logger *zap.Logger, start func(groupPK string) error, stop func(groupPK string)) (*clusterCoordinator, error) {
+	if opts.NodeID == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a cluster node id is required"))
+	}
+
+	if opts.LeaseTTL <= 0 {
+		opts.LeaseTTL = DefaultLeaseTTL
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = clock.New()
+	}
+
+	if err := db.AutoMigrate(&ReplicatedGroupLease{}, &ReplicationClusterNode{}); err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return &clusterCoordinator{
+		db:      db,
+		nodeID:  opts.NodeID,
+		ttl:     opts.LeaseTTL,
+		clock:   opts.Clock,
+		logger:  logger,
+		start:   start,
+		stop:    stop,
+		started: make(map[string]struct{}),
+	}, nil
+}
+
+func (c *clusterCoordinator) run(ctx context.Context) {
+	ticker := c.clock.Ticker(c.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		if err := c.tick(); err != nil {
+			c.logger.Error("unable to update the group leases", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick renews the leases of the server, then releases or claims groups to
+// reach its share of them.
+func (c *clusterCoordinator) tick() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	expiresAt := now.Add(c.ttl).UnixNano()
+
+	if err := c.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&ReplicationClusterNode{ID: c.nodeID, LastSeen: now.UnixNano()}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	if err := c.db.Model(&ReplicatedGroupLease{}).Where("holder = ?", c.nodeID).Update("expires_at", expiresAt).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	held := []string(nil)
+	if err := c.db.Model(&ReplicatedGroupLease{}).Where("holder = ?", c.nodeID).Order("group_public_key").Pluck("group_public_key", &held).Error; err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	// the leases lost while the database was unreachable were taken over
+	c.apply(held)
+
+	share, err := c.share(now)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(held) > share:
+		// another server joined, the extra groups are left to it
+		extra := held[share:]
+		if err := c.db.Where("holder = ? AND group_public_key IN ?", c.nodeID, extra).Delete(&ReplicatedGroupLease{}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+		c.apply(held[:share])
+
+	case len(held) < share:
+		candidates := []string(nil)
+		if err := c.db.Model(&replicationtypes.ReplicatedGroup{}).
+			Joins("LEFT JOIN replicated_group_leases ON replicated_group_leases.group_public_key = replicated_groups.public_key").
+			Where("replicated_group_leases.group_public_key IS NULL OR replicated_group_leases.expires_at < ?", now.UnixNano()).
+			Order("replicated_groups.created_at").
+			Limit(share-len(held)).
+			Pluck("replicated_groups.public_key", &candidates).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		for _, groupPK := range candidates {
+			if err := c.claim(groupPK, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// share returns the number of groups the server should replicate.
+func (c *clusterCoordinator) share(now time.Time) (int, error) {
+	nodes := int64(0)
+	if err := c.db.Model(&ReplicationClusterNode{}).Where("last_seen > ?", now.Add(-c.ttl).UnixNano()).Count(&nodes).Error; err != nil {
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+
+	groups := int64(0)
+	if err := c.db.Model(&replicationtypes.ReplicatedGroup{}).Count(&groups).Error; err != nil {
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if nodes == 0 {
+		nodes = 1
+	}
+
+	return int((groups + nodes - 1) / nodes), nil
+}
+
+// claimGroup takes the lease of a newly registered group, the shares are
+// balanced again on the next ticks.
+func (c *clusterCoordinator) claimGroup(groupPK string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.claim(groupPK, c.clock.Now())
+}
+
+// claim takes the lease of a group if it is free or expired and starts its
+// replication.
+func (c *clusterCoordinator) claim(groupPK string, now time.Time) error {
+	lease := &ReplicatedGroupLease{GroupPublicKey: groupPK, Holder: c.nodeID, ExpiresAt: now.Add(c.ttl).UnixNano()}
+
+	res := c.db.Clauses(clause.OnConflict{DoNothing: true}).Create(lease)
+	if res.Error != nil {
+		return errcode.ErrDBWrite.Wrap(res.Error)
+	}
+
+	if res.RowsAffected == 0 {
+		res = c.db.Model(&ReplicatedGroupLease{}).
+			Where("group_public_key = ? AND (holder = ? OR expires_at < ?)", groupPK, c.nodeID, now.UnixNano()).
+			Updates(map[string]interface{}{"holder": c.nodeID, "expires_at": lease.ExpiresAt})
+		if res.Error != nil {
+			return errcode.ErrDBWrite.Wrap(res.Error)
+		}
+
+		// another server was faster
+		if res.RowsAffected == 0 {
+			return nil
+		}
+	}
+
+	if _, ok := c.started[groupPK]; ok {
+		return nil
+	}
+
+	if err := c.start(groupPK); err != nil {
+		c.logger.Error("unable to replicate group, releasing its lease", zap.String("group", groupPK), zap.Error(err))
+		return c.release(groupPK)
+	}
+
+	c.started[groupPK] = struct{}{}
+	return nil
+}
+
+// apply starts the replication of the held groups and stops the other ones.
+func (c *clusterCoordinator) apply(held []string) {
+	keep := make(map[string]struct{}, len(held))
+	for _, groupPK := range held {
+		keep[groupPK] = struct{}{}
+
+		if _, ok := c.started[groupPK]; ok {
+			continue
+		}
+
+		// held before a restart
+		if err := c.start(groupPK); err != nil {
+			c.logger.Error("unable to replicate group", zap.String("group", groupPK), zap.Error(err))
+			continue
+		}
+		c.started[groupPK] = struct{}{}
+	}
+
+	for groupPK := range c.started {
+		if _, ok := keep[groupPK]; !ok {
+			c.stop(groupPK)
+			delete(c.started, groupPK)
+		}
+	}
+}
+
+func (c *clusterCoordinator) release(groupPK string) error {
+	if err := c.db.Where("holder = ? AND group_public_key = ?", c.nodeID, groupPK).Delete(&ReplicatedGroupLease{}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// releaseAll gives the groups of the server to the other ones without
+// waiting for the leases to expire, when it stops.
+func (c *clusterCoordinator) releaseAll() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.db.Where("holder = ?", c.nodeID).Delete(&ReplicatedGroupLease{}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	if err := c.db.Where("id = ?", c.nodeID).Delete(&ReplicationClusterNode{}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	c.apply(nil)
+	return nil
+}
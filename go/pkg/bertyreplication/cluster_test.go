@@ -0,0 +1,112 @@
+package bertyreplication
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/weshnet/pkg/replicationtypes"
+)
+
+type testClusterNode struct {
+	mu          sync.Mutex
+	replicating map[string]struct{}
+	*clusterCoordinator
+}
+
+func newTestClusterNode(t *testing.T, db *gorm.DB, clk clock.Clock, nodeID string) *testClusterNode {
+	t.Helper()
+
+	node := &testClusterNode{replicating: map[string]struct{}{}}
+	start := func(groupPK string) error {
+		node.mu.Lock()
+		defer node.mu.Unlock()
+
+		node.replicating[groupPK] = struct{}{}
+		return nil
+	}
+	stop := func(groupPK string) {
+		node.mu.Lock()
+		defer node.mu.Unlock()
+
+		delete(node.replicating, groupPK)
+	}
+
+	c, err := newClusterCoordinator(db, ClusterOpts{NodeID: nodeID, LeaseTTL: time.Minute, Clock: clk}, zap.NewNop(), start, stop)
+	require.NoError(t, err)
+
+	node.clusterCoordinator = c
+	return node
+}
+
+func (n *testClusterNode) groups() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	groups := []string{}
+	for groupPK := range n.replicating {
+		groups = append(groups, groupPK)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+func TestClusterLeases(t *testing.T) {
+	db := DBForTests(t, zap.NewNop())
+	require.NoError(t, db.AutoMigrate(&replicationtypes.ReplicatedGroup{}))
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, db.Create(&replicationtypes.ReplicatedGroup{PublicKey: fmt.Sprintf("group-%d", i), CreatedAt: int64(i)}).Error)
+	}
+
+	mock := clock.NewMock()
+	mock.Set(time.Now())
+	a := newTestClusterNode(t, db, mock, "a")
+	b := newTestClusterNode(t, db, mock, "b")
+
+	// alone, a replicates every group
+	require.NoError(t, a.tick())
+	require.Len(t, a.groups(), 4)
+
+	// b joins, a gives it half of them
+	require.NoError(t, b.tick())
+	require.Empty(t, b.groups())
+	mock.Add(time.Second)
+	require.NoError(t, a.tick())
+	require.Len(t, a.groups(), 2)
+	require.NoError(t, b.tick())
+	require.Len(t, b.groups(), 2)
+	require.NotContains(t, a.groups(), b.groups()[0])
+	require.NotContains(t, a.groups(), b.groups()[1])
+
+	// a newly registered group is replicated by the server receiving it
+	require.NoError(t, db.Create(&replicationtypes.ReplicatedGroup{PublicKey: "group-4", CreatedAt: 4}).Error)
+	require.NoError(t, b.claimGroup("group-4"))
+	require.Contains(t, b.groups(), "group-4")
+	require.NoError(t, a.claimGroup("group-4"))
+	require.NotContains(t, a.groups(), "group-4")
+
+	// b stops renewing its leases, a takes its groups over once they expire
+	mock.Add(2 * time.Minute)
+	require.NoError(t, a.tick())
+	require.Len(t, a.groups(), 5)
+
+	// b comes back and notices it lost them
+	mock.Add(time.Second)
+	require.NoError(t, b.tick())
+	require.Empty(t, b.groups())
+
+	// a stopping releases its leases at once
+	require.NoError(t, a.releaseAll())
+	require.Empty(t, a.groups())
+	mock.Add(time.Second)
+	require.NoError(t, b.tick())
+	require.Len(t, b.groups(), 5)
+}
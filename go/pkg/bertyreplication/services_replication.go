@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/ed25519"
 	"fmt"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -11,6 +12,7 @@ import (
 
 	"berty.tech/berty/v2/go/internal/messengerutil"
 	"berty.tech/berty/v2/go/pkg/authtypes"
+	"berty.tech/berty/v2/go/pkg/bertyreplicationtypes"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	orbitdb "berty.tech/go-orbit-db"
 	"berty.tech/go-orbit-db/iface"
@@ -32,7 +34,20 @@ type replicationService struct {
 	db        *gorm.DB
 	startedAt time.Time
 
+	// cluster is nil unless the groups are split between several servers
+	cluster *clusterCoordinator
+
+	subsMutex     sync.Mutex
+	subscriptions map[string]*groupSubscription
+
 	replicationtypes.UnimplementedReplicationServiceServer
+	bertyreplicationtypes.UnimplementedStoredEntriesServiceServer
+}
+
+type groupSubscription struct {
+	cancel        context.CancelFunc
+	metadataStore iface.Store
+	messageStore  iface.Store
 }
 
 func (s *replicationService) ReplicateGlobalStats(ctx context.Context, request *replicationtypes.ReplicateGlobalStats_Request) (*replicationtypes.ReplicateGlobalStats_Reply, error) {
@@ -112,6 +127,12 @@ func (s *replicationService) GroupRegister(token, tokenIssuer string, group *pro
 			TokenIssuer:              tokenIssuer,
 		})
 
+		// in cluster mode, the group is replicated by the server holding
+		// its lease
+		if s.cluster != nil {
+			return nil
+		}
+
 		if err := s.GroupSubscribe(group, pkStr); err != nil {
 			return err
 		}
@@ -121,6 +142,10 @@ func (s *replicationService) GroupRegister(token, tokenIssuer string, group *pro
 		return err
 	}
 
+	if s.cluster != nil {
+		return s.cluster.claimGroup(pkStr)
+	}
+
 	return nil
 }
 
@@ -140,6 +165,15 @@ func (s *replicationService) GroupSubscribe(group *protocoltypes.Group, pkStr st
 		return fmt.Errorf("unable to subscribe to message store events")
 	}
 
+	ctx, cancel := context.WithCancel(s.ctx)
+
+	s.subsMutex.Lock()
+	if previous, ok := s.subscriptions[pkStr]; ok {
+		previous.cancel()
+	}
+	s.subscriptions[pkStr] = &groupSubscription{cancel: cancel, metadataStore: metadataStore, messageStore: messageStore}
+	s.subsMutex.Unlock()
+
 	go func() {
 		defer subMetadata.Close()
 		defer subMessage.Close()
@@ -151,7 +185,7 @@ func (s *replicationService) GroupSubscribe(group *protocoltypes.Group, pkStr st
 				s.updateGroupDB(metadataStore, pkStr, updatedMetaStore)
 			case <-subMessage.Out():
 				s.updateGroupDB(messageStore, pkStr, updatedMessageStore)
-			case <-s.ctx.Done():
+			case <-ctx.Done():
 				return
 			}
 		}
@@ -160,6 +194,43 @@ func (s *replicationService) GroupSubscribe(group *protocoltypes.Group, pkStr st
 	return nil
 }
 
+// groupStart replicates a registered group, when the server takes its
+// lease.
+func (s *replicationService) groupStart(pkStr string) error {
+	replicatedGroup := &replicationtypes.ReplicatedGroup{}
+	if err := s.db.Model(&replicationtypes.ReplicatedGroup{}).Where("public_key = ?", pkStr).First(replicatedGroup).Error; err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	g, err := replicatedGroup.ToGroup()
+	if err != nil {
+		return err
+	}
+
+	return s.GroupSubscribe(g, pkStr)
+}
+
+// groupStop stops the replication of a group, when its lease is given to
+// another server.
+func (s *replicationService) groupStop(pkStr string) {
+	s.subsMutex.Lock()
+	sub, ok := s.subscriptions[pkStr]
+	delete(s.subscriptions, pkStr)
+	s.subsMutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	sub.cancel()
+
+	for _, store := range []iface.Store{sub.metadataStore, sub.messageStore} {
+		if err := store.Close(); err != nil {
+			s.logger.Warn("unable to close group store", zap.String("group", pkStr), zap.Error(err))
+		}
+	}
+}
+
 type groupInfoUpdatedStore int32
 
 const (
@@ -262,6 +333,10 @@ func (s *replicationService) OrbitDB() BertyOrbitDB {
 }
 
 func (s *replicationService) Close() error {
+	if s.cluster != nil {
+		return s.cluster.releaseAll()
+	}
+
 	return nil
 }
 
@@ -269,11 +344,24 @@ var _ ReplicationService = (*replicationService)(nil)
 
 type ReplicationService interface {
 	replicationtypes.ReplicationServiceServer
+	bertyreplicationtypes.StoredEntriesServiceServer
 
 	Close() error
 }
 
 func NewReplicationService(ctx context.Context, db *gorm.DB, odb BertyOrbitDB, logger *zap.Logger) (ReplicationService, error) {
+	return newReplicationService(ctx, db, odb, logger, nil)
+}
+
+// NewClusterReplicationService returns a replication service sharing db with
+// the other servers of a cluster, each of them replicates the groups whose
+// lease it holds. db is typically a Postgres database reachable by every
+// server.
+func NewClusterReplicationService(ctx context.Context, db *gorm.DB, odb BertyOrbitDB, logger *zap.Logger, opts ClusterOpts) (ReplicationService, error) {
+	return newReplicationService(ctx, db, odb, logger, &opts)
+}
+
+func newReplicationService(ctx context.Context, db *gorm.DB, odb BertyOrbitDB, logger *zap.Logger, clusterOpts *ClusterOpts) (ReplicationService, error) {
 	if db == nil {
 		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("db should not be nil"))
 	}
@@ -287,11 +375,12 @@ func NewReplicationService(ctx context.Context, db *gorm.DB, odb BertyOrbitDB, l
 	}
 
 	r := &replicationService{
-		ctx:       ctx,
-		logger:    logger,
-		odb:       odb,
-		db:        db,
-		startedAt: time.Now(),
+		ctx:           ctx,
+		logger:        logger,
+		odb:           odb,
+		db:            db,
+		startedAt:     time.Now(),
+		subscriptions: make(map[string]*groupSubscription),
 	}
 
 	// Create/migrate models in DB
@@ -300,6 +389,18 @@ func NewReplicationService(ctx context.Context, db *gorm.DB, odb BertyOrbitDB, l
 		return nil, errcode.ErrDBWrite.Wrap(err)
 	}
 
+	if clusterOpts != nil {
+		cluster, err := newClusterCoordinator(db, *clusterOpts, logger.Named("cluster"), r.groupStart, r.groupStop)
+		if err != nil {
+			return nil, err
+		}
+
+		r.cluster = cluster
+		go cluster.run(ctx)
+
+		return r, nil
+	}
+
 	// Resubscribe to known groups
 	groups := []replicationtypes.ReplicatedGroup(nil)
 	if err := db.Model(&replicationtypes.ReplicatedGroup{}).FindInBatches(&groups, 10, func(tx *gorm.DB, batch int) error {
@@ -20,6 +20,7 @@ import (
 	"berty.tech/berty/v2/go/pkg/authtypes"
 	"berty.tech/berty/v2/go/pkg/bertyauth"
 	"berty.tech/berty/v2/go/pkg/bertyreplication"
+	"berty.tech/berty/v2/go/pkg/bertyreplicationtypes"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	orbitdb "berty.tech/go-orbit-db"
 	"berty.tech/go-orbit-db/iface"
@@ -90,6 +91,42 @@ func TestReplicationService_GroupSubscribe(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestReplicationService_StoredEntries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New()
+	defer mn.Close()
+
+	db := bertyreplication.DBForTests(t, zap.NewNop())
+
+	repl, _ := bertyreplication.TestHelperNewReplicationService(ctx, t, nil, mn, tinder.NewMockDriverServer(), nil, db)
+
+	g, _, err := weshnet.NewGroupMultiMember()
+	require.NoError(t, err)
+
+	replGroup, err := weshnet.FilterGroupForReplication(g)
+	require.NoError(t, err)
+
+	pk := messengerutil.B64EncodeBytes(replGroup.PublicKey)
+	unknown := "bafkreigh2akiscaildcqabsyg3dfr6chu3fgpregiymsck7e7aqa4s52zy"
+
+	_, err = repl.StoredEntries(ctx, &bertyreplicationtypes.StoredEntries_Request{GroupPublicKey: pk, CIDs: []string{unknown}})
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	require.NoError(t, repl.GroupSubscribe(replGroup, pk))
+
+	stored, err := repl.StoredEntries(ctx, &bertyreplicationtypes.StoredEntries_Request{GroupPublicKey: pk, CIDs: []string{unknown}})
+	require.NoError(t, err)
+	require.Empty(t, stored.CIDs)
+
+	_, err = repl.StoredEntries(ctx, &bertyreplicationtypes.StoredEntries_Request{GroupPublicKey: pk, CIDs: []string{"not-a-cid"}})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	_, err = repl.StoredEntries(ctx, &bertyreplicationtypes.StoredEntries_Request{CIDs: []string{unknown}})
+	require.True(t, errcode.Is(err, errcode.ErrMissingInput))
+}
+
 func TestReplicationService_GroupRegister(t *testing.T) {
 	testutil.FilterStability(t, testutil.Flappy)
 
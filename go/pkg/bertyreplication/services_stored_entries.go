@@ -0,0 +1,49 @@
+package bertyreplication
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+
+	"berty.tech/berty/v2/go/pkg/bertyreplicationtypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// MaxStoredEntriesQuery bounds the number of CIDs of a StoredEntries call.
+const MaxStoredEntriesQuery = 100
+
+func (s *replicationService) StoredEntries(_ context.Context, req *bertyreplicationtypes.StoredEntries_Request) (*bertyreplicationtypes.StoredEntries_Reply, error) {
+	if req.GroupPublicKey == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a group public key is required"))
+	}
+	if len(req.CIDs) > MaxStoredEntriesQuery {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("at most %d entries can be queried at once, got %d", MaxStoredEntriesQuery, len(req.CIDs)))
+	}
+
+	keys := make([]cid.Cid, len(req.CIDs))
+	for i, raw := range req.CIDs {
+		c, err := cid.Decode(raw)
+		if err != nil {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid cid %q: %w", raw, err))
+		}
+		keys[i] = c
+	}
+
+	// in cluster mode, the group may be replicated by another server
+	s.subsMutex.Lock()
+	sub, ok := s.subscriptions[req.GroupPublicKey]
+	s.subsMutex.Unlock()
+	if !ok {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("the group is not replicated by this server"))
+	}
+
+	reply := &bertyreplicationtypes.StoredEntries_Reply{CIDs: []string{}}
+	for i, c := range keys {
+		if _, ok := sub.messageStore.OpLog().Get(c); ok {
+			reply.CIDs = append(reply.CIDs, req.CIDs[i])
+		}
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,195 @@
+package bertyshortlink
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// DefaultTTL is the time a link is registered for when no other is given.
+const DefaultTTL = 7 * 24 * time.Hour
+
+// Client registers and resolves the links of a relay.
+type Client struct {
+	base   string
+	client *http.Client
+}
+
+// NewClient returns the client of the relay at relayURL, the base of its
+// short URLs. http.DefaultClient is used when client is nil.
+func NewClient(relayURL string, client *http.Client) (*Client, error) {
+	u, err := url.Parse(relayURL)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid short link relay url: %w", err))
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unsupported short link relay url scheme %q", u.Scheme))
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Client{base: strings.TrimSuffix(u.String(), "/"), client: client}, nil
+}
+
+// Register signs link with key and registers it for ttl, DefaultTTL when
+// zero, it returns the short URL.
+func (c *Client) Register(ctx context.Context, link string, key ed25519.PrivateKey, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	e, err := NewEnvelope(link, key, time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return "", errcode.ErrSerialization.Wrap(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+RegisterPath, bytes.NewReader(body))
+	if err != nil {
+		return "", errcode.ErrInvalidInput.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	reply := &RegisterReply{}
+	if err := c.do(req, http.StatusCreated, reply); err != nil {
+		return "", err
+	}
+
+	// the relay cannot choose the code
+	if reply.Code != e.Code() {
+		return "", errcode.ErrCryptoSignatureVerification.Wrap(fmt.Errorf("the relay returned the code %q instead of %q", reply.Code, e.Code()))
+	}
+
+	return c.base + LinkPath + reply.Code, nil
+}
+
+// Code returns the code of a short URL of the relay, ok is false for the
+// other URLs.
+func (c *Client) Code(shortURL string) (code string, ok bool) {
+	prefix := c.base + LinkPath
+	if len(shortURL) <= len(prefix) || !strings.EqualFold(shortURL[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	code = shortURL[len(prefix):]
+	if strings.ContainsAny(code, "/?#") {
+		return "", false
+	}
+
+	return code, true
+}
+
+// Resolve returns the envelope of a short URL of the relay, once its
+// signature and its code are checked.
+func (c *Client) Resolve(ctx context.Context, shortURL string) (*Envelope, error) {
+	code, ok := c.Code(shortURL)
+	if !ok {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("not a short link of %s", c.base))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+LinkPath+code, nil)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	e := &Envelope{}
+	if err := c.do(req, http.StatusOK, e); err != nil {
+		return nil, err
+	}
+
+	if err := e.Verify(code, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Delete removes the link of a short URL registered with key.
+func (c *Client) Delete(ctx context.Context, shortURL string, key ed25519.PrivateKey) error {
+	code, ok := c.Code(shortURL)
+	if !ok {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("not a short link of %s", c.base))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.base+LinkPath+code, nil)
+	if err != nil {
+		return errcode.ErrInvalidInput.Wrap(err)
+	}
+	req.Header.Set(DeleteSignatureHeader, base64.StdEncoding.EncodeToString(DeleteSignature(code, key)))
+
+	return c.do(req, http.StatusNoContent, nil)
+}
+
+func (c *Client) do(req *http.Request, expected int, reply interface{}) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errcode.ErrStreamRead.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown or expired short link"))
+	case resp.StatusCode != expected:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("short link relay: %s: %s", resp.Status, strings.TrimSpace(string(msg))))
+	case reply == nil:
+		return nil
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxEnvelopeSize)).Decode(reply); err != nil {
+		return errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return nil
+}
+
+// KeyDatastoreKey is the key of the account link key in the root datastore.
+const KeyDatastoreKey = "short_link_key"
+
+// LoadOrCreateKey returns the link key of the account, it is created on the
+// first use.
+func LoadOrCreateKey(ctx context.Context, ds datastore.Datastore) (ed25519.PrivateKey, error) {
+	data, err := ds.Get(ctx, datastore.NewKey(KeyDatastoreKey))
+	switch err {
+	case nil:
+		if len(data) != ed25519.PrivateKeySize {
+			return nil, errcode.ErrDeserialization.Wrap(fmt.Errorf("invalid stored link key"))
+		}
+		return ed25519.PrivateKey(data), nil
+	case datastore.ErrNotFound:
+	default:
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	key, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ds.Put(ctx, datastore.NewKey(KeyDatastoreKey), key); err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return key, nil
+}
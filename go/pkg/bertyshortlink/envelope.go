@@ -0,0 +1,141 @@
+// Package bertyshortlink registers invitation links with a link-shortening
+// relay, so that they are short enough for a SMS, and resolves them back.
+//
+// The relay stores signed envelopes. The short code of an envelope is a hash
+// of its content, so a relay cannot change the link it serves without the
+// client noticing, and only the signer of an envelope can delete it.
+package bertyshortlink
+
+import (
+	"crypto/ed25519"
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mr-tron/base58"
+	"golang.org/x/crypto/sha3"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// MaxLinkSize bounds the size of the registered links, the internal
+	// links of the invitations are well below it.
+	MaxLinkSize = 4096
+
+	// codeSize is the number of bytes of the envelope hash in the short
+	// code, 80 bits are out of reach of a second preimage.
+	codeSize = 10
+
+	// internalLinkPrefix is bertylinks.LinkInternalPrefix, the relay does
+	// not depend on the messenger packages.
+	internalLinkPrefix = "BERTY://"
+
+	signaturePrefix = "berty short link v1\n"
+	deletePrefix    = "berty short link delete v1\n"
+)
+
+// Envelope is a link registered with a relay.
+type Envelope struct {
+	// Link is the internal URL of the invitation, see
+	// bertylinks.MarshalLink.
+	Link string `json:"link"`
+	// SignerPK is the ed25519 public key of the account link key.
+	SignerPK []byte `json:"signer_pk"`
+	// ExpiresAt is the unix time after which the relay forgets the link.
+	ExpiresAt int64  `json:"expires_at"`
+	Signature []byte `json:"signature"`
+}
+
+// NewEnvelope signs link with key, it expires at expiresAt.
+func NewEnvelope(link string, key ed25519.PrivateKey, expiresAt time.Time) (*Envelope, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid link key"))
+	}
+
+	e := &Envelope{
+		Link:      link,
+		SignerPK:  key.Public().(ed25519.PublicKey),
+		ExpiresAt: expiresAt.Unix(),
+	}
+
+	if err := e.validate(); err != nil {
+		return nil, err
+	}
+
+	e.Signature = ed25519.Sign(key, e.signedBytes())
+	return e, nil
+}
+
+// GenerateKey returns a new link key.
+func GenerateKey() (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		return nil, errcode.ErrCryptoKeyGeneration.Wrap(err)
+	}
+
+	return key, nil
+}
+
+// Code returns the short code of the envelope, derived from its content.
+func (e *Envelope) Code() string {
+	h := sha3.New256()
+	h.Write(e.signedBytes())
+	h.Write(e.Signature)
+	return base58.Encode(h.Sum(nil)[:codeSize])
+}
+
+// Verify checks the signature and the expiration of the envelope, and that
+// it is the one of code when not empty.
+func (e *Envelope) Verify(code string, now time.Time) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(e.SignerPK, e.signedBytes(), e.Signature) {
+		return errcode.ErrCryptoSignatureVerification.Wrap(fmt.Errorf("invalid short link signature"))
+	}
+
+	if code != "" && e.Code() != code {
+		return errcode.ErrCryptoSignatureVerification.Wrap(fmt.Errorf("the short link %q does not match the served envelope", code))
+	}
+
+	if now.Unix() > e.ExpiresAt {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("the short link expired"))
+	}
+
+	return nil
+}
+
+func (e *Envelope) validate() error {
+	switch {
+	case !strings.HasPrefix(strings.ToLower(e.Link), strings.ToLower(internalLinkPrefix)):
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("only internal berty links can be shortened"))
+	case len(e.Link) > MaxLinkSize:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the link is larger than %d bytes", MaxLinkSize))
+	case len(e.SignerPK) != ed25519.PublicKeySize:
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid signer public key"))
+	}
+
+	return nil
+}
+
+func (e *Envelope) signedBytes() []byte {
+	b := make([]byte, 0, len(signaturePrefix)+len(e.SignerPK)+8+len(e.Link))
+	b = append(b, signaturePrefix...)
+	b = append(b, e.SignerPK...)
+	b = binary.BigEndian.AppendUint64(b, uint64(e.ExpiresAt))
+	return append(b, e.Link...)
+}
+
+// DeleteSignature authorizes the deletion of the link of code by the holder
+// of key.
+func DeleteSignature(code string, key ed25519.PrivateKey) []byte {
+	return ed25519.Sign(key, []byte(deletePrefix+code))
+}
+
+func verifyDeleteSignature(code string, signerPK ed25519.PublicKey, sig []byte) bool {
+	return ed25519.Verify(signerPK, []byte(deletePrefix+code), sig)
+}
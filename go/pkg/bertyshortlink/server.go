@@ -0,0 +1,268 @@
+package bertyshortlink
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// DefaultMaxTTL is the longest time a relay keeps a link by default.
+	DefaultMaxTTL = 30 * 24 * time.Hour
+
+	// RegisterPath receives the envelopes to shorten.
+	RegisterPath = "/links"
+	// LinkPath is the prefix of the short URLs.
+	LinkPath = "/l/"
+
+	// DeleteSignatureHeader carries the base64 DeleteSignature of a DELETE
+	// request.
+	DeleteSignatureHeader = "X-Berty-Signature"
+
+	maxEnvelopeSize = MaxLinkSize + 1024
+)
+
+var linksKey = datastore.NewKey("links")
+
+// ServerOpts configures a relay.
+type ServerOpts struct {
+	// PublicURL is the base of the returned short URLs, e.g.
+	// https://s.example.com.
+	PublicURL string
+
+	// MaxTTL bounds the expiration of the registered links, DefaultMaxTTL
+	// when zero.
+	MaxTTL time.Duration
+
+	Logger *zap.Logger
+}
+
+// Server is the http.Handler of a self-hostable relay.
+//
+// POST RegisterPath stores an envelope and returns its short URL, GET on a
+// short URL returns the envelope to the clients asking for JSON and
+// redirects the others to the link, DELETE on it removes the envelope when
+// signed by its signer.
+type Server struct {
+	ds        datastore.Datastore
+	publicURL string
+	maxTTL    time.Duration
+	logger    *zap.Logger
+}
+
+var _ http.Handler = (*Server)(nil)
+
+// RegisterReply is the reply to a registration.
+type RegisterReply struct {
+	Code string `json:"code"`
+	URL  string `json:"url"`
+}
+
+func NewServer(ds datastore.Datastore, opts ServerOpts) (*Server, error) {
+	if opts.PublicURL == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("the public url of the relay is required"))
+	}
+
+	if opts.MaxTTL <= 0 {
+		opts.MaxTTL = DefaultMaxTTL
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+
+	return &Server{
+		ds:        ds,
+		publicURL: strings.TrimSuffix(opts.PublicURL, "/"),
+		maxTTL:    opts.MaxTTL,
+		logger:    opts.Logger,
+	}, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == RegisterPath && r.Method == http.MethodPost:
+		s.register(w, r)
+	case strings.HasPrefix(r.URL.Path, LinkPath) && r.Method == http.MethodGet:
+		s.resolve(w, r, strings.TrimPrefix(r.URL.Path, LinkPath))
+	case strings.HasPrefix(r.URL.Path, LinkPath) && r.Method == http.MethodDelete:
+		s.delete(w, r, strings.TrimPrefix(r.URL.Path, LinkPath))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	e := &Envelope{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxEnvelopeSize)).Decode(e); err != nil {
+		http.Error(w, "invalid envelope", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if err := e.Verify("", now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if time.Unix(e.ExpiresAt, 0).After(now.Add(s.maxTTL)) {
+		http.Error(w, fmt.Sprintf("the link cannot be kept more than %s", s.maxTTL), http.StatusBadRequest)
+		return
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		http.Error(w, "invalid envelope", http.StatusBadRequest)
+		return
+	}
+
+	code := e.Code()
+	if err := s.ds.Put(r.Context(), linksKey.ChildString(code), data); err != nil {
+		s.logger.Error("unable to store short link", zap.Error(err))
+		http.Error(w, "unable to store the link", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, &RegisterReply{Code: code, URL: s.publicURL + LinkPath + code})
+}
+
+func (s *Server) resolve(w http.ResponseWriter, r *http.Request, code string) {
+	e, err := s.get(r.Context(), code)
+	switch {
+	case errcode.Is(err, errcode.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		s.logger.Error("unable to read short link", zap.Error(err))
+		http.Error(w, "unable to read the link", http.StatusInternalServerError)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, http.StatusOK, e)
+		return
+	}
+
+	// opened from a SMS, the app handles the internal link
+	http.Redirect(w, r, e.Link, http.StatusFound)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request, code string) {
+	e, err := s.get(r.Context(), code)
+	switch {
+	case errcode.Is(err, errcode.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		s.logger.Error("unable to read short link", zap.Error(err))
+		http.Error(w, "unable to read the link", http.StatusInternalServerError)
+		return
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(r.Header.Get(DeleteSignatureHeader))
+	if err != nil || !verifyDeleteSignature(code, e.SignerPK, sig) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+
+	if err := s.ds.Delete(r.Context(), linksKey.ChildString(code)); err != nil {
+		s.logger.Error("unable to delete short link", zap.Error(err))
+		http.Error(w, "unable to delete the link", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// get returns the envelope of code, ErrNotFound if it is unknown or expired.
+func (s *Server) get(ctx context.Context, code string) (*Envelope, error) {
+	if code == "" || strings.Contains(code, "/") {
+		return nil, errcode.ErrNotFound
+	}
+
+	data, err := s.ds.Get(ctx, linksKey.ChildString(code))
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		return nil, errcode.ErrNotFound
+	case err != nil:
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	e := &Envelope{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if time.Now().Unix() > e.ExpiresAt {
+		return nil, errcode.ErrNotFound
+	}
+
+	return e, nil
+}
+
+// Prune removes the expired links, it returns the number of removed ones.
+func (s *Server) Prune(ctx context.Context, now time.Time) (int, error) {
+	results, err := s.ds.Query(ctx, query.Query{Prefix: linksKey.String()})
+	if err != nil {
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+	defer results.Close()
+
+	expired := []datastore.Key(nil)
+	for result := range results.Next() {
+		if result.Error != nil {
+			return 0, errcode.ErrDBRead.Wrap(result.Error)
+		}
+
+		e := &Envelope{}
+		if err := json.Unmarshal(result.Value, e); err != nil || now.Unix() > e.ExpiresAt {
+			expired = append(expired, datastore.NewKey(result.Key))
+		}
+	}
+
+	for _, key := range expired {
+		if err := s.ds.Delete(ctx, key); err != nil {
+			return 0, errcode.ErrDBWrite.Wrap(err)
+		}
+	}
+
+	return len(expired), nil
+}
+
+// RunPruner prunes the expired links every interval until ctx is done.
+func (s *Server) RunPruner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if removed, err := s.Prune(ctx, time.Now()); err != nil {
+			s.logger.Warn("unable to prune the expired short links", zap.Error(err))
+		} else if removed > 0 {
+			s.logger.Debug("expired short links removed", zap.Int("count", removed))
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,140 @@
+package bertyshortlink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const testLink = "BERTY://PB/2D9OS-Q5CFG4RF-AD0XWQ"
+
+func newTestRelay(t *testing.T) (*Server, *Client, *httptest.Server) {
+	t.Helper()
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	mux := http.NewServeMux()
+	hs := httptest.NewServer(mux)
+	t.Cleanup(hs.Close)
+
+	server, err := NewServer(ds, ServerOpts{PublicURL: hs.URL, MaxTTL: time.Hour})
+	require.NoError(t, err)
+	mux.Handle("/", server)
+
+	client, err := NewClient(hs.URL, hs.Client())
+	require.NoError(t, err)
+
+	return server, client, hs
+}
+
+func TestShortLink(t *testing.T) {
+	ctx := context.Background()
+	_, client, hs := newTestRelay(t)
+
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	key, err := LoadOrCreateKey(ctx, ds)
+	require.NoError(t, err)
+	stored, err := LoadOrCreateKey(ctx, ds)
+	require.NoError(t, err)
+	require.Equal(t, key, stored)
+
+	shortURL, err := client.Register(ctx, testLink, key, time.Minute)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(shortURL, hs.URL+LinkPath))
+	require.Less(t, len(shortURL)-len(hs.URL), 20)
+
+	e, err := client.Resolve(ctx, shortURL)
+	require.NoError(t, err)
+	require.Equal(t, testLink, e.Link)
+
+	// a browser is redirected to the app
+	noRedirect := *hs.Client()
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := noRedirect.Get(shortURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	require.Equal(t, testLink, resp.Header.Get("Location"))
+
+	// longer than the relay keeps links
+	_, err = client.Register(ctx, testLink, key, 2*time.Hour)
+	require.Error(t, err)
+
+	// only internal links
+	_, err = client.Register(ctx, "https://example.com", key, time.Minute)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	// only the signer deletes a link
+	other, err := GenerateKey()
+	require.NoError(t, err)
+	require.Error(t, client.Delete(ctx, shortURL, other))
+	require.NoError(t, client.Delete(ctx, shortURL, key))
+
+	_, err = client.Resolve(ctx, shortURL)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+}
+
+func TestShortLinkTampered(t *testing.T) {
+	ctx := context.Background()
+	server, client, hs := newTestRelay(t)
+
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	shortURL, err := client.Register(ctx, testLink, key, time.Minute)
+	require.NoError(t, err)
+	code, ok := client.Code(shortURL)
+	require.True(t, ok)
+
+	// the relay serves another link, validly signed by its own key
+	relayKey, err := GenerateKey()
+	require.NoError(t, err)
+	forged, err := NewEnvelope("BERTY://PB/FORGED", relayKey, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	data, err := json.Marshal(forged)
+	require.NoError(t, err)
+	require.NoError(t, server.ds.Put(ctx, linksKey.ChildString(code), data))
+
+	_, err = client.Resolve(ctx, shortURL)
+	require.True(t, errcode.Is(err, errcode.ErrCryptoSignatureVerification))
+
+	// or alters the signed one
+	e, err := NewEnvelope(testLink, key, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	e.Link = "BERTY://PB/FORGED"
+	require.True(t, errcode.Is(e.Verify("", time.Now()), errcode.ErrCryptoSignatureVerification))
+
+	_, ok = client.Code(hs.URL + "/other/" + code)
+	require.False(t, ok)
+}
+
+func TestShortLinkPrune(t *testing.T) {
+	ctx := context.Background()
+	server, client, _ := newTestRelay(t)
+
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	shortURL, err := client.Register(ctx, testLink, key, time.Minute)
+	require.NoError(t, err)
+
+	removed, err := server.Prune(ctx, time.Now())
+	require.NoError(t, err)
+	require.Zero(t, removed)
+
+	removed, err = server.Prune(ctx, time.Now().Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+
+	_, err = client.Resolve(ctx, shortURL)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+}
@@ -5,4 +5,9 @@ type EventHandlerPostActions interface {
 	ContactConversationJoined(contact *Contact) error
 	InteractionReceived(i *Interaction) error
 	PushServerOrTokenRegistered(account *Account) error
+	// ContactRequestReceived returns false when the request was rejected and
+	// should not be notified.
+	ContactRequestReceived(contact *Contact) (bool, error)
+	// DeviceLinked is called when another device joins the account group.
+	DeviceLinked(device *Device) error
 }
@@ -21,3 +21,11 @@ func (p *serviceEventHandlerPostActionsNoop) InteractionReceived(i *Interaction)
 func (p *serviceEventHandlerPostActionsNoop) PushServerOrTokenRegistered(account *Account) error {
 	return nil
 }
+
+func (p *serviceEventHandlerPostActionsNoop) ContactRequestReceived(contact *Contact) (bool, error) {
+	return true, nil
+}
+
+func (p *serviceEventHandlerPostActionsNoop) DeviceLinked(device *Device) error {
+	return nil
+}
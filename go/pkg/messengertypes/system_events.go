@@ -0,0 +1,119 @@
+package messengertypes
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+type SystemEvent_Kind string
+
+const (
+	SystemEvent_MemberJoined SystemEvent_Kind = "member_joined"
+	SystemEvent_DeviceAdded  SystemEvent_Kind = "device_added"
+
+	// the join requests of the groups in approval mode
+	SystemEvent_JoinRequested SystemEvent_Kind = "join_requested"
+	SystemEvent_JoinApproved  SystemEvent_Kind = "join_approved"
+	SystemEvent_JoinDenied    SystemEvent_Kind = "join_denied"
+
+	// the history of a group migrated from another account, see
+	// groupmigration
+	SystemEvent_MessageImported SystemEvent_Kind = "message_imported"
+)
+
+// SystemEvent is the payload of the AppMessage_TypeSystemEvent interactions.
+type SystemEvent struct {
+	Kind            SystemEvent_Kind `json:"kind"`
+	MemberPublicKey string           `json:"member_public_key"`
+	DevicePublicKey string           `json:"device_public_key,omitempty"`
+	// DisplayName is the name of the member when the event occurred, if
+	// known.
+	DisplayName string `json:"display_name,omitempty"`
+
+	// SourceCID and Body are the CID and the text of an imported message.
+	SourceCID string `json:"source_cid,omitempty"`
+	Body      string `json:"body,omitempty"`
+}
+
+// SystemEventCID returns the CID of the interaction of a system event, it is
+// derived from the event for the event to be stored once when the group
+// metadata are replayed, and the imported messages once per source CID.
+func SystemEventCID(conversationPK string, event *SystemEvent) string {
+	if event.SourceCID != "" {
+		return fmt.Sprintf("system:%s:%s:%s:%s", event.Kind, conversationPK, event.MemberPublicKey, event.SourceCID)
+	}
+
+	return fmt.Sprintf("system:%s:%s:%s:%s", event.Kind, conversationPK, event.MemberPublicKey, event.DevicePublicKey)
+}
+
+func (e *SystemEvent) Marshal() ([]byte, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	return payload, nil
+}
+
+func UnmarshalSystemEvent(payload []byte) (*SystemEvent, error) {
+	e := &SystemEvent{}
+	if err := json.Unmarshal(payload, e); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return e, nil
+}
+
+// Reset, String and ProtoMessage let a SystemEvent be returned by
+// Interaction.UnmarshalPayload.
+func (e *SystemEvent) Reset()         { *e = SystemEvent{} }
+func (e *SystemEvent) String() string { return e.Text() }
+func (*SystemEvent) ProtoMessage()    {}
+
+// Text is the sentence displayed in the history, e.g. "Alice joined".
+func (e *SystemEvent) Text() string {
+	name := e.DisplayName
+	if name == "" {
+		name = "a member"
+		if len(e.MemberPublicKey) > 6 {
+			name = fmt.Sprintf("member %s", e.MemberPublicKey[:6])
+		}
+	}
+
+	switch e.Kind {
+	case SystemEvent_MemberJoined:
+		return fmt.Sprintf("%s joined", name)
+	case SystemEvent_DeviceAdded:
+		return fmt.Sprintf("%s added a device", name)
+	case SystemEvent_JoinRequested:
+		return fmt.Sprintf("%s asks to join, waiting for an admin", name)
+	case SystemEvent_JoinApproved:
+		return fmt.Sprintf("%s was approved", name)
+	case SystemEvent_JoinDenied:
+		return fmt.Sprintf("%s was denied", name)
+	case SystemEvent_MessageImported:
+		return fmt.Sprintf("%s (imported): %s", name, e.Body)
+	default:
+		return fmt.Sprintf("%s: %s", name, e.Kind)
+	}
+}
+
+// Match returns true if the interaction is selected by the filter.
+func (f SystemEvents_Filter) Match(interaction *Interaction) bool {
+	switch f {
+	case SystemEvents_Excluded:
+		return !interaction.IsSystemEvent()
+	case SystemEvents_Only:
+		return interaction.IsSystemEvent()
+	default:
+		return true
+	}
+}
+
+// IsSystemEvent returns true if the interaction was generated by the
+// messenger, see AppMessage_TypeSystemEvent.
+func (interaction *Interaction) IsSystemEvent() bool {
+	return interaction.GetType() == AppMessage_TypeSystemEvent
+}
@@ -79,6 +79,24 @@ func (am AppMessage) UnmarshalPayload() (proto.Message, error) {
 		message = &AppMessage_PushSetServer{}
 	case AppMessage_TypePushSetMemberToken:
 		message = &AppMessage_PushSetMemberToken{}
+	case AppMessage_TypePing:
+		message = &AppMessage_Ping{}
+	case AppMessage_TypePong:
+		message = &AppMessage_Pong{}
+	case AppMessage_TypeJoinPolicy:
+		message = &AppMessage_JoinPolicy{}
+	case AppMessage_TypeJoinRequest:
+		message = &AppMessage_JoinRequest{}
+	case AppMessage_TypeJoinDecision:
+		message = &AppMessage_JoinDecision{}
+	case AppMessage_TypeDeviceRevoked:
+		message = &AppMessage_DeviceRevoked{}
+	case AppMessage_TypeReaction:
+		message = &AppMessage_Reaction{}
+	case AppMessage_TypePresence:
+		message = &AppMessage_Presence{}
+	case AppMessage_TypeChunk:
+		message = &AppMessage_Chunk{}
 	default:
 		return nil, errcode.TODO.Wrap(fmt.Errorf("unsupported AppMessage type: %q", am.GetType()))
 	}
@@ -157,6 +175,11 @@ func (event *StreamEvent_Notified) UnmarshalPayload() (proto.Message, error) {
 }
 
 func (interaction *Interaction) UnmarshalPayload() (proto.Message, error) {
+	// never received from the network, see AppMessage_TypeSystemEvent
+	if interaction.IsSystemEvent() {
+		return UnmarshalSystemEvent(interaction.GetPayload())
+	}
+
 	appMessage := AppMessage{
 		Type:    interaction.GetType(),
 		Payload: interaction.GetPayload(),
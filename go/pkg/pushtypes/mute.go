@@ -0,0 +1,29 @@
+package pushtypes
+
+import (
+	"time"
+)
+
+// MarshalReceiver marshals receiver with its mute deadline, the push server
+// drops the pushes for receiver until mutedUntil. A zero mutedUntil is not
+// marshaled.
+func MarshalReceiver(receiver *PushServiceReceiver, mutedUntil time.Time) ([]byte, error) {
+	return MarshalReceiverOptions(receiver, ReceiverOptions{MutedUntil: mutedUntil})
+}
+
+// UnmarshalReceiver unmarshals a receiver marshaled by MarshalReceiver, it
+// returns a zero time when the receiver is not muted.
+func UnmarshalReceiver(raw []byte) (*PushServiceReceiver, time.Time, error) {
+	receiver, opts, err := UnmarshalReceiverOptions(raw)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return receiver, opts.MutedUntil, nil
+}
+
+// MutedAt returns true if the pushes are dropped at t for a receiver muted
+// until mutedUntil.
+func MutedAt(mutedUntil, t time.Time) bool {
+	return !mutedUntil.IsZero() && t.Before(mutedUntil)
+}
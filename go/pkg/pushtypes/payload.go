@@ -0,0 +1,168 @@
+package pushtypes
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ParsePayloadLevel parses `full`, `sender` or `none`, an empty string is
+// `full`.
+func ParsePayloadLevel(s string) (PayloadLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "full":
+		return PayloadFull, nil
+	case "sender":
+		return PayloadSender, nil
+	case "none":
+		return PayloadNone, nil
+	}
+
+	return PayloadFull, fmt.Errorf("unknown push payload level %q, expected full, sender or none", s)
+}
+
+func (l PayloadLevel) String() string {
+	switch l {
+	case PayloadFull:
+		return "full"
+	case PayloadSender:
+		return "sender"
+	case PayloadNone:
+		return "none"
+	}
+
+	return fmt.Sprintf("PayloadLevel(%d)", int32(l))
+}
+
+// ReceiverOptions are sealed with a PushServiceReceiver, they are only read
+// by the push server.
+type ReceiverOptions struct {
+	// MutedUntil drops the pushes until then, disabled when zero.
+	MutedUntil time.Time
+	// PayloadLevel is what the pushes carry.
+	PayloadLevel PayloadLevel
+}
+
+// MarshalReceiverOptions marshals receiver with opts, the zero options are
+// not marshaled.
+func MarshalReceiverOptions(receiver *PushServiceReceiver, opts ReceiverOptions) ([]byte, error) {
+	sealed := *receiver
+	sealed.MutedUntil = 0
+	if !opts.MutedUntil.IsZero() {
+		sealed.MutedUntil = opts.MutedUntil.UnixMilli()
+	}
+	sealed.PayloadLevel = opts.PayloadLevel
+
+	return sealed.Marshal()
+}
+
+// UnmarshalReceiverOptions unmarshals a receiver marshaled by
+// MarshalReceiverOptions.
+func UnmarshalReceiverOptions(raw []byte) (*PushServiceReceiver, ReceiverOptions, error) {
+	opts := ReceiverOptions{}
+
+	receiver := &PushServiceReceiver{}
+	if err := receiver.Unmarshal(raw); err != nil {
+		return nil, opts, err
+	}
+
+	switch {
+	case receiver.MutedUntil < 0:
+		return nil, opts, fmt.Errorf("invalid mute deadline %d", receiver.MutedUntil)
+	case receiver.MutedUntil > 0:
+		opts.MutedUntil = time.UnixMilli(receiver.MutedUntil)
+	}
+
+	if _, ok := PayloadLevel_name[int32(receiver.PayloadLevel)]; !ok {
+		return nil, opts, fmt.Errorf("invalid push payload level %d", receiver.PayloadLevel)
+	}
+	opts.PayloadLevel = receiver.PayloadLevel
+
+	return receiver, opts, nil
+}
+
+// AppendPayloadLevel appends level to the envelope the push server seals for
+// the receiver, so its app displays the push at this level. It is appended as
+// PushEnvelopeOptions, which the apps that don't know them skip.
+func AppendPayloadLevel(envelope []byte, level PayloadLevel) ([]byte, error) {
+	if level == PayloadFull {
+		return envelope, nil
+	}
+
+	options, err := (&PushEnvelopeOptions{PayloadLevel: level}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	// the envelope is shared by the receivers of a push, it is not appended
+	// in place
+	appended := make([]byte, 0, len(envelope)+len(options))
+	appended = append(appended, envelope...)
+	return append(appended, options...), nil
+}
+
+// EnvelopePayloadLevel returns the level appended by AppendPayloadLevel to
+// envelope, it is PayloadFull when the push server didn't append it.
+func EnvelopePayloadLevel(envelope []byte) (PayloadLevel, error) {
+	options := &PushEnvelopeOptions{}
+	if err := options.Unmarshal(envelope); err != nil {
+		return PayloadFull, err
+	}
+
+	if _, ok := PayloadLevel_name[int32(options.PayloadLevel)]; !ok {
+		return PayloadFull, fmt.Errorf("invalid push payload level %d", options.PayloadLevel)
+	}
+
+	return options.PayloadLevel, nil
+}
+
+// payloadReserve is kept in the budgets for the JSON of the platforms around
+// the payload, its key, the alert and the flags.
+const payloadReserve = 256
+
+// PayloadBudget returns the maximum size of the payload of a push sent with
+// tokenType, before its base64 encoding.
+func PayloadBudget(tokenType PushServiceTokenType) int {
+	limit := 4096
+	switch tokenType {
+	case PushServiceTokenType_PushTokenWindowsPushNotificationService:
+		limit = 5120
+	case PushServiceTokenType_PushTokenAmazonDeviceMessaging:
+		limit = 6144
+	}
+
+	return base64.RawURLEncoding.DecodedLen(limit - payloadReserve)
+}
+
+// FitsBudget returns true if payload can be pushed with tokenType.
+func FitsBudget(payload []byte, tokenType PushServiceTokenType) bool {
+	return len(payload) <= PayloadBudget(tokenType)
+}
+
+// MaxPreviewBytes is the size of the message previews displayed in the
+// pushes.
+const MaxPreviewBytes = 240
+
+// previewEllipsis ends the truncated previews.
+const previewEllipsis = "…"
+
+// TruncatePreview truncates text to maxBytes at a rune boundary, the
+// truncated text ends with an ellipsis which is counted in maxBytes.
+func TruncatePreview(text string, maxBytes int) string {
+	if len(text) <= maxBytes {
+		return text
+	}
+
+	cut := maxBytes - len(previewEllipsis)
+	if cut <= 0 {
+		return ""
+	}
+
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+
+	return strings.TrimRight(text[:cut], " \t\r\n") + previewEllipsis
+}
@@ -0,0 +1,120 @@
+package pushtypes
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePayloadLevel(t *testing.T) {
+	for input, expected := range map[string]PayloadLevel{
+		"":         PayloadFull,
+		"full":     PayloadFull,
+		"Sender":   PayloadSender,
+		" none ":   PayloadNone,
+		"preview":  PayloadFull,
+		"sender ?": PayloadFull,
+	} {
+		level, err := ParsePayloadLevel(input)
+		require.Equal(t, expected, level, input)
+		if input == "preview" || input == "sender ?" {
+			require.Error(t, err, input)
+			continue
+		}
+		require.NoError(t, err, input)
+
+		// the levels are parsed back from their names
+		parsed, err := ParsePayloadLevel(level.String())
+		require.NoError(t, err)
+		require.Equal(t, level, parsed)
+	}
+}
+
+func TestReceiverOptions(t *testing.T) {
+	receiver := &PushServiceReceiver{
+		TokenType: PushServiceTokenType_PushTokenApplePushNotificationService,
+		BundleID:  "bundle",
+		Token:     []byte("token"),
+	}
+
+	opts := ReceiverOptions{
+		MutedUntil:   time.UnixMilli(time.Now().Add(time.Hour).UnixMilli()),
+		PayloadLevel: PayloadSender,
+	}
+
+	raw, err := MarshalReceiverOptions(receiver, opts)
+	require.NoError(t, err)
+
+	decoded, decodedOpts, err := UnmarshalReceiverOptions(raw)
+	require.NoError(t, err)
+	require.Equal(t, receiver.Token, decoded.Token)
+	require.True(t, opts.MutedUntil.Equal(decodedOpts.MutedUntil))
+	require.Equal(t, PayloadSender, decodedOpts.PayloadLevel)
+	require.Equal(t, opts.MutedUntil.UnixMilli(), decoded.MutedUntil)
+	require.Zero(t, receiver.MutedUntil)
+
+	// the receivers marshaled for a mute deadline have the full payload
+	raw, err = MarshalReceiver(receiver, time.Time{})
+	require.NoError(t, err)
+
+	_, decodedOpts, err = UnmarshalReceiverOptions(raw)
+	require.NoError(t, err)
+	require.Equal(t, ReceiverOptions{}, decodedOpts)
+}
+
+func TestEnvelopePayloadLevel(t *testing.T) {
+	envelope, err := (&PushServiceReceiver{Token: []byte("envelope")}).Marshal()
+	require.NoError(t, err)
+
+	for _, level := range []PayloadLevel{PayloadFull, PayloadSender, PayloadNone} {
+		appended, err := AppendPayloadLevel(envelope, level)
+		require.NoError(t, err)
+
+		// the envelope is still readable by the apps that don't know the level
+		decoded := &PushServiceReceiver{}
+		require.NoError(t, decoded.Unmarshal(appended))
+		require.Equal(t, []byte("envelope"), decoded.Token)
+
+		appendedLevel, err := EnvelopePayloadLevel(appended)
+		require.NoError(t, err)
+		require.Equal(t, level, appendedLevel)
+	}
+
+	_, err = EnvelopePayloadLevel([]byte("not protobuf"))
+	require.Error(t, err)
+}
+
+func TestPayloadBudget(t *testing.T) {
+	for _, tokenType := range []PushServiceTokenType{
+		PushServiceTokenType_PushTokenMQTT,
+		PushServiceTokenType_PushTokenApplePushNotificationService,
+		PushServiceTokenType_PushTokenFirebaseCloudMessaging,
+		PushServiceTokenType_PushTokenWindowsPushNotificationService,
+		PushServiceTokenType_PushTokenHuaweiPushKit,
+		PushServiceTokenType_PushTokenAmazonDeviceMessaging,
+	} {
+		budget := PayloadBudget(tokenType)
+		require.True(t, FitsBudget(make([]byte, budget), tokenType), tokenType)
+		require.False(t, FitsBudget(make([]byte, budget+1), tokenType), tokenType)
+	}
+
+	require.Less(t, PayloadBudget(PushServiceTokenType_PushTokenApplePushNotificationService), PayloadBudget(PushServiceTokenType_PushTokenAmazonDeviceMessaging))
+}
+
+func TestTruncatePreview(t *testing.T) {
+	require.Equal(t, "hello", TruncatePreview("hello", 5))
+	require.Equal(t, "hello…", TruncatePreview("hello world", 9))
+	require.Equal(t, "", TruncatePreview("hello world", 2))
+
+	// the multibyte runes are not cut
+	text := strings.Repeat("é", 100)
+	for n := 0; n < len(text); n++ {
+		truncated := TruncatePreview(text, n)
+		require.True(t, utf8.ValidString(truncated), n)
+		require.LessOrEqual(t, len(truncated), n)
+		require.Equal(t, truncated, TruncatePreview(text, n))
+	}
+}
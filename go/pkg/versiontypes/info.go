@@ -0,0 +1,11 @@
+package versiontypes
+
+// HasFeature returns true if the daemon advertises feature.
+func (i *Info) HasFeature(feature string) bool {
+	for _, f := range i.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}